@@ -0,0 +1,54 @@
+// Command gateway runs the API gateway described by a YAML file: the routes to the upstreams, and the rate limits,
+// authentication, CORS, compression, caching and observability in front of them.
+//
+//    gateway --config gateway.yaml
+//
+// See gateway.GatewayConfig for the configuration, and examples/gateway/gateway.yaml for an example.
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/gateway"
+    "log/slog"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+)
+
+func main() {
+    configPath := flag.String("config", "gateway.yaml", "YAML file of the GatewayConfig")
+    flag.Parse()
+    if err := run(*configPath); err != nil {
+        slog.Error("Error running gateway", "error", err)
+        os.Exit(1)
+    }
+}
+
+func run(configPath string) error {
+    config, err := gateway.LoadFile(configPath)
+    if err != nil {
+        return err
+    }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    g, err := gateway.New(ctx, config)
+    if err != nil {
+        return err
+    }
+    errs := make(chan error, 1)
+    go func() {
+        errs <- g.Run()
+    }()
+    slog.Info("gateway started", "addr", config.Addr, "routes", len(config.Routes))
+    select {
+    case err := <-errs:
+        return err
+    case <-ctx.Done():
+        slog.Info("Shutting down")
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        return g.Shutdown(shutdownCtx)
+    }
+}
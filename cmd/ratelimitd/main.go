@@ -0,0 +1,240 @@
+// Command ratelimitd serves the decisions of the rate limiter to the services not written in Go, as a sidecar or as a
+// shared service.
+//
+//    ratelimitd --config limits.json --http :8080 --grpc :8081 --redis localhost:6379
+//
+// Over HTTP, POST /v1/decide takes the descriptors of the decision protocol, see NewDecideHandler, and POST /json a
+// RateLimitRequest of the Envoy rate limit service in its JSON form, answered with 429 when over the limit. Over gRPC,
+// envoy.service.ratelimit.v3.RateLimitService/ShouldRateLimit, see NewRateLimitService.
+//
+// The counters are kept in Redis, or in memory per instance without --redis. The configuration file is the JSON of a
+// RateLimiterConfig, read again on SIGHUP.
+//
+// With --remote-write, the metrics of the decisions are pushed to a Prometheus remote write endpoint, for the sidecars
+// the server can't scrape, labelled with job="ratelimitd" and the host name as instance.
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bootstrap"
+    grpcserver "github.com/aswinkm-tc/go-web-concepts/internal/grpc_server"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/health"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/encoding/protojson"
+    "log/slog"
+    "net"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+)
+
+func main() {
+    configPath := flag.String("config", "", "JSON file of the RateLimiterConfig, read again on SIGHUP")
+    httpAddr := flag.String("http", ":8080", "Address of the HTTP decision API, empty to disable it")
+    grpcAddr := flag.String("grpc", ":8081", "Address of the gRPC rate limit service, empty to disable it")
+    redisAddr := flag.String("redis", "", "Address of the Redis server holding the counters, in memory if empty")
+    keyPrefix := flag.String("key-prefix", "", "Prefix of the Redis keys, for a Redis shared with other applications")
+    storeErrorPolicy := flag.String("store-error-policy", ratelimiter.StoreErrorAllow, "Policy of the endpoints without on_store_error when the store fails: allow, reject or local")
+    remoteWriteURL := flag.String("remote-write", "", "URL of the Prometheus remote write endpoint the metrics are pushed to, e.g. http://prometheus:9090/api/v1/write, disabled if empty")
+    remoteWriteInterval := flag.Duration("remote-write-interval", 15*time.Second, "Interval at which the metrics are pushed to the remote write endpoint")
+    flag.Parse()
+    if err := run(*configPath, *httpAddr, *grpcAddr, *redisAddr, *keyPrefix, *storeErrorPolicy, *remoteWriteURL, *remoteWriteInterval); err != nil {
+        slog.Error("Error running ratelimitd", "error", err)
+        os.Exit(1)
+    }
+}
+
+func run(configPath, httpAddr, grpcAddr, redisAddr, keyPrefix, storeErrorPolicy, remoteWriteURL string, remoteWriteInterval time.Duration) error {
+    if configPath == "" {
+        return fmt.Errorf("--config is required")
+    }
+    config, err := loadConfig(configPath)
+    if err != nil {
+        return err
+    }
+    store, err := newStore(redisAddr, keyPrefix)
+    if err != nil {
+        return err
+    }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    var sink *metrics.RemoteWriteSink
+    opts := []ratelimiter.Option{ratelimiter.WithStoreErrorPolicy(storeErrorPolicy)}
+    if remoteWriteURL != "" {
+        if sink, err = newRemoteWriteSink(ctx, remoteWriteURL, remoteWriteInterval); err != nil {
+            return err
+        }
+        opts = append(opts, ratelimiter.WithMetrics(sink))
+    }
+    limiter := ratelimiter.NewRateLimiter(config, store, nil, opts...)
+    defer limiter.Close()
+    decide, err := ratelimiter.NewDecideHandler(limiter, ratelimiter.DecideConfig{})
+    if err != nil {
+        return err
+    }
+    rls, err := ratelimiter.NewRateLimitService(limiter, ratelimiter.RateLimitServiceConfig{})
+    if err != nil {
+        return err
+    }
+
+    errs := make(chan error, 2)
+    var h *server.Hertz
+    if httpAddr != "" {
+        h = server.New(server.WithHostPorts(httpAddr), server.WithDisablePrintRoute(true))
+        h.POST(ratelimiter.DecidePath, decide)
+        h.POST("/json", envoyJSONHandler(rls))
+        h.GET("/healthz", func(_ context.Context, c *app.RequestContext) {
+            c.JSON(consts.StatusOK, utils.H{"status": "ok"})
+        })
+        go func() {
+            errs <- h.Run()
+        }()
+    }
+    var (
+        gs *grpc.Server
+        hs *health.Server
+    )
+    if grpcAddr != "" {
+        lis, err := net.Listen("tcp", grpcAddr)
+        if err != nil {
+            return fmt.Errorf("failed to listen on %s: %w", grpcAddr, err)
+        }
+        gs, hs = newGRPCServer(rls)
+        go func() {
+            errs <- gs.Serve(lis)
+        }()
+    }
+    slog.Info("ratelimitd started", "http", httpAddr, "grpc", grpcAddr, "endpoints", len(config))
+
+    reload := make(chan os.Signal, 1)
+    signal.Notify(reload, syscall.SIGHUP)
+    defer signal.Stop(reload)
+    for {
+        select {
+        case <-reload:
+            // A broken file keeps the configuration in use
+            config, err := loadConfig(configPath)
+            if err != nil {
+                slog.Error("Error reloading configuration", "error", err)
+                continue
+            }
+            limiter.UpdateConfig(config)
+            slog.Info("Configuration reloaded", "endpoints", len(config))
+        case err := <-errs:
+            return err
+        case <-ctx.Done():
+            slog.Info("Shutting down")
+            shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            if gs != nil {
+                // Tells the clients watching the health to go elsewhere before the calls in flight finish
+                hs.Shutdown()
+                gs.GracefulStop()
+            }
+            var shutdownErr error
+            if h != nil {
+                shutdownErr = h.Shutdown(shutdownCtx)
+            }
+            if sink != nil {
+                // The decisions since the last push
+                if err := sink.Flush(shutdownCtx); err != nil {
+                    slog.Error("Error pushing metrics", "error", err)
+                }
+            }
+            return shutdownErr
+        }
+    }
+}
+
+func newStore(redisAddr, keyPrefix string) (ratelimiterstore.Store, error) {
+    if redisAddr == "" {
+        return ratelimiterstore.NewMemoryStore(), nil
+    }
+    client, err := bootstrap.ProvideRedisClient(bootstrap.RedisConfig{Addr: redisAddr})
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+    }
+    return bootstrap.ProvideRateLimiterStore(client, bootstrap.StoreConfig{ScanCount: 100, KeyPrefix: keyPrefix})
+}
+
+func newRemoteWriteSink(ctx context.Context, url string, interval time.Duration) (*metrics.RemoteWriteSink, error) {
+    hostname, err := os.Hostname()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get host name: %w", err)
+    }
+    return metrics.NewRemoteWriteSink(ctx, metrics.RemoteWriteConfig{
+        URL:           url,
+        Tags:          []metrics.Tag{{Key: "job", Value: "ratelimitd"}, {Key: "instance", Value: hostname}},
+        FlushInterval: interval,
+    })
+}
+
+func newGRPCServer(rls rlsv3.RateLimitServiceServer) (*grpc.Server, *health.Server) {
+    gs, hs := grpcserver.NewServer(grpcserver.DefaultServerConfig())
+    rlsv3.RegisterRateLimitServiceServer(gs, rls)
+    hs.SetServingStatus(ratelimiter.RateLimitServiceName, healthpb.HealthCheckResponse_SERVING)
+    return gs, hs
+}
+
+// envoyJSONHandler serves the rate limit service as JSON, like the /json endpoint of the Envoy ratelimit service.
+func envoyJSONHandler(rls rlsv3.RateLimitServiceServer) app.HandlerFunc {
+    return func(ctx context.Context, c *app.RequestContext) {
+        var req rlsv3.RateLimitRequest
+        if err := protojson.Unmarshal(c.Request.Body(), &req); err != nil {
+            c.JSON(consts.StatusBadRequest, utils.H{"error": "Invalid rate limit request: " + err.Error()})
+            return
+        }
+        resp, err := rls.ShouldRateLimit(ctx, &req)
+        if err != nil {
+            code := consts.StatusInternalServerError
+            switch status.Code(err) {
+            case codes.InvalidArgument:
+                code = consts.StatusBadRequest
+            case codes.Unavailable:
+                code = consts.StatusServiceUnavailable
+            }
+            c.JSON(code, utils.H{"error": status.Convert(err).Message()})
+            return
+        }
+        body, err := protojson.Marshal(resp)
+        if err != nil {
+            c.JSON(consts.StatusInternalServerError, utils.H{"error": err.Error()})
+            return
+        }
+        code := consts.StatusOK
+        if resp.GetOverallCode() == rlsv3.RateLimitResponse_OVER_LIMIT {
+            code = consts.StatusTooManyRequests
+        }
+        c.Data(code, consts.MIMEApplicationJSON, body)
+    }
+}
+
+func loadConfig(path string) (ratelimiter.RateLimiterConfig, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read %s: %w", path, err)
+    }
+    var config ratelimiter.RateLimiterConfig
+    if err := json.Unmarshal(data, &config); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+    }
+    if err := config.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+    }
+    return config, nil
+}
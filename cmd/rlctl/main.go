@@ -0,0 +1,263 @@
+// Command rlctl helps debug the rate limiter configurations.
+//
+//    rlctl eval --config limits.json --method GET --path /api/v1/users/42 --ip 1.2.3.4
+//
+// eval prints the endpoint the path matched, the limit applying to the request and the decision of the rate limiter
+// after the user already sent --used requests.
+//
+//    rlctl lint --config limits.json
+//
+// lint prints the risky endpoint configurations, see RateLimiterConfig.Lint, and exits with 1 if it finds any so it can
+// run before a configuration is rolled out.
+//
+//    rlctl notes --redis localhost:6379 --key 1.2.3.4
+//
+// notes prints the notes of the operators on the keys, or on the key, with whether the key is banned or exempted.
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/admin"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bootstrap"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/mediocregopher/radix/v4"
+    "io"
+    "log/slog"
+    "os"
+    "slices"
+    "strings"
+    "time"
+)
+
+func main() {
+    if len(os.Args) < 2 {
+        usage()
+    }
+    switch os.Args[1] {
+    case "eval":
+        if err := eval(os.Args[2:], os.Stdout); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    case "lint":
+        found, err := lint(os.Args[2:], os.Stdout)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+        if found {
+            os.Exit(1)
+        }
+    case "notes":
+        if err := notes(os.Args[2:], os.Stdout); err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(1)
+        }
+    default:
+        usage()
+    }
+}
+
+func usage() {
+    fmt.Fprintln(os.Stderr, "usage: rlctl eval --config limits.json --path /api/v1/users/42 [--method GET] [--ip 1.2.3.4] [--used 0] [--methods methods.json]")
+    fmt.Fprintln(os.Stderr, "       rlctl lint --config limits.json [--store-error-policy allow]")
+    fmt.Fprintln(os.Stderr, "       rlctl notes --redis localhost:6379 [--key 1.2.3.4]")
+    os.Exit(2)
+}
+
+func eval(args []string, out io.Writer) error {
+    flags := flag.NewFlagSet("eval", flag.ExitOnError)
+    configPath := flags.String("config", "", "JSON file of the RateLimiterConfig, as saved to the last known good path of config_sync")
+    methodsPath := flags.String("methods", "", "JSON file of the MethodConfig, if the methods are limited apart")
+    method := flags.String("method", "GET", "Method of the request")
+    path := flags.String("path", "/", "Path of the request")
+    ip := flags.String("ip", "127.0.0.1", "IP of the user")
+    used := flags.Int("used", 0, "Requests the user already sent to the endpoint")
+    _ = flags.Parse(args)
+    if *configPath == "" {
+        return fmt.Errorf("--config is required")
+    }
+
+    var config ratelimiter.RateLimiterConfig
+    if err := readJSON(*configPath, &config); err != nil {
+        return err
+    }
+    if err := config.Validate(); err != nil {
+        return fmt.Errorf("invalid configuration: %w", err)
+    }
+    opts := []ratelimiter.Option{
+        ratelimiter.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+        ratelimiter.WithHeaders(ratelimiter.DraftHeaders()),
+    }
+    var methods ratelimiter.MethodConfig
+    if *methodsPath != "" {
+        if err := readJSON(*methodsPath, &methods); err != nil {
+            return err
+        }
+        opts = append(opts, ratelimiter.WithMethods(methods))
+    }
+
+    endpoint := matchEndpoint(config, *path)
+    if endpoint == "" {
+        fmt.Fprintf(out, "endpoint: none, %s is not rate limited\n", *path)
+        return nil
+    }
+    fmt.Fprintf(out, "endpoint: %s\n", endpoint)
+    conf, budget := config[endpoint], endpoint
+    if slices.Contains(methods.Exempt, *method) {
+        budget = "none, " + *method + " is exempt"
+    } else if limit, ok := methods.Limits[*method]; ok {
+        conf, budget = limit, *method+" "+endpoint
+    }
+    fmt.Fprintf(out, "budget: %s\n", budget)
+    fmt.Fprintf(out, "limit: %s\n", describe(conf))
+
+    rl := ratelimiter.NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func([]byte) string { return endpoint }, opts...)
+    ctx := context.Background()
+    for range *used {
+        rl.Middleware(ctx, request(*method, *path, *ip))
+    }
+    c := request(*method, *path, *ip)
+    rl.Middleware(ctx, c)
+    if c.IsAborted() {
+        fmt.Fprintf(out, "decision: rejected with %d\n", c.Response.StatusCode())
+    } else {
+        fmt.Fprintln(out, "decision: allowed")
+    }
+    for _, h := range []string{"RateLimit-Remaining", "RateLimit-Reset", "Retry-After"} {
+        if v := c.Response.Header.Get(h); v != "" {
+            fmt.Fprintf(out, "%s: %s\n", strings.ToLower(h), v)
+        }
+    }
+    return nil
+}
+
+// lint prints the findings of the configuration and tells whether there are any.
+func lint(args []string, out io.Writer) (bool, error) {
+    flags := flag.NewFlagSet("lint", flag.ExitOnError)
+    configPath := flags.String("config", "", "JSON file of the RateLimiterConfig, as saved to the last known good path of config_sync")
+    policy := flags.String("store-error-policy", ratelimiter.StoreErrorAllow, "Store error policy of the endpoints without one, as set with WithStoreErrorPolicy")
+    _ = flags.Parse(args)
+    if *configPath == "" {
+        return false, fmt.Errorf("--config is required")
+    }
+
+    var config ratelimiter.RateLimiterConfig
+    if err := readJSON(*configPath, &config); err != nil {
+        return false, err
+    }
+    if err := config.Validate(); err != nil {
+        return false, fmt.Errorf("invalid configuration: %w", err)
+    }
+    findings := config.Lint(ratelimiter.LintOptions{DefaultStoreErrorPolicy: *policy})
+    for _, f := range findings {
+        fmt.Fprintln(out, f)
+    }
+    return len(findings) > 0, nil
+}
+
+// notes prints the notes on the keys, one per line.
+func notes(args []string, out io.Writer) error {
+    flags := flag.NewFlagSet("notes", flag.ExitOnError)
+    redisAddr := flags.String("redis", "localhost:6379", "Address of the Redis server holding the policies")
+    key := flags.String("key", "", "Key whose note to print, all of them if empty")
+    _ = flags.Parse(args)
+
+    client, err := bootstrap.ProvideRedisClient(bootstrap.RedisConfig{Addr: *redisAddr})
+    if err != nil {
+        return fmt.Errorf("failed to connect to Redis: %w", err)
+    }
+    defer client.Close()
+    ctx := context.Background()
+    store := admin.NewRedisNoteStore(client, 100)
+    var list []admin.KeyNote
+    if *key == "" {
+        if list, err = store.List(ctx); err != nil {
+            return err
+        }
+    } else {
+        note, ok, err := store.Get(ctx, *key)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            return fmt.Errorf("no note on %s", *key)
+        }
+        list = append(list, note)
+    }
+    for _, note := range list {
+        var policies []string
+        for _, p := range []struct{ name, prefix string }{{"banned", ratelimiter.BanPrefix}, {"exempt", ratelimiter.ExemptPrefix}} {
+            var exists int
+            if err := client.Do(ctx, radix.Cmd(&exists, "EXISTS", p.prefix+note.Key)); err != nil {
+                return fmt.Errorf("failed to check %s: %w", p.prefix+note.Key, err)
+            }
+            if exists > 0 {
+                policies = append(policies, p.name)
+            }
+        }
+        fmt.Fprintf(out, "%s", note.Key)
+        if len(policies) > 0 {
+            fmt.Fprintf(out, " [%s]", strings.Join(policies, ", "))
+        }
+        if len(note.Labels) > 0 {
+            fmt.Fprintf(out, " labels=%s", strings.Join(note.Labels, ","))
+        }
+        fmt.Fprintf(out, " by %s on %s", note.Author, note.UpdatedAt.Format(time.RFC3339))
+        if !note.ExpiresAt.IsZero() {
+            fmt.Fprintf(out, " until %s", note.ExpiresAt.Format(time.RFC3339))
+        }
+        fmt.Fprintf(out, ": %s\n", note.Note)
+    }
+    return nil
+}
+
+// matchEndpoint returns the configured endpoint of the path, itself or else its longest configured prefix of whole
+// segments, the usual shape of a SanitizerFunc.
+func matchEndpoint(config ratelimiter.RateLimiterConfig, path string) string {
+    for p := path; p != ""; p = p[:strings.LastIndex(p, "/")] {
+        if _, ok := config[p]; ok {
+            return p
+        }
+    }
+    if _, ok := config["/"]; ok {
+        return "/"
+    }
+    return ""
+}
+
+func describe(conf ratelimiter.EndpointConfig) string {
+    algorithm := conf.Algorithm
+    if algorithm == "" {
+        algorithm = ratelimiter.AlgorithmSlidingWindow
+    }
+    store := conf.Store
+    if store == "" {
+        store = "default"
+    }
+    return fmt.Sprintf("%d requests per %s, %s algorithm with windows of %s, %s store", conf.MaxRequests, conf.TimeWindow, algorithm, conf.SlidingWindowInterval, store)
+}
+
+func request(method, path, ip string) *app.RequestContext {
+    c := app.NewContext(0)
+    c.Request.SetMethod(method)
+    c.Request.SetRequestURI(path)
+    c.Request.Header.Set("X-Forwarded-For", ip)
+    return c
+}
+
+func readJSON(path string, v any) error {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return fmt.Errorf("failed to read %s: %w", path, err)
+    }
+    if err := json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("failed to parse %s: %w", path, err)
+    }
+    return nil
+}
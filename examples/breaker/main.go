@@ -0,0 +1,47 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/breaker"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "sync/atomic"
+    "time"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "Address the example server listens on")
+    openDuration := flag.Duration("open-duration", 10*time.Second, "How long the open breaker rejects the requests")
+    flag.Parse()
+
+    // The inventory service the orders depend on starts down, POST /inventory/up brings it back
+    var inventoryUp atomic.Bool
+
+    b, err := breaker.NewBreaker(breaker.BreakerConfig{
+        FailureThreshold: 3,             // Open after 3 consecutive failures
+        OpenDuration:     *openDuration, // Then fail fast before probing the inventory again
+    })
+    if err != nil {
+        panic(err)
+    }
+
+    h := server.Default(server.WithHostPorts(*addr))
+    h.GET("/orders", b.Middleware, func(ctx context.Context, c *app.RequestContext) {
+        if !inventoryUp.Load() {
+            c.JSON(consts.StatusBadGateway, utils.H{"error": "Inventory unavailable"})
+            return
+        }
+        c.JSON(consts.StatusOK, utils.H{"orders": []string{"#1", "#2"}})
+    })
+    h.GET("/breaker", func(ctx context.Context, c *app.RequestContext) {
+        c.JSON(consts.StatusOK, utils.H{"state": b.State()})
+    })
+    h.POST("/inventory/up", func(ctx context.Context, c *app.RequestContext) {
+        inventoryUp.Store(true)
+        c.JSON(consts.StatusOK, utils.H{"inventory": "up"})
+    })
+    h.Spin()
+}
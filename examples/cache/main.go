@@ -0,0 +1,49 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cache"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "time"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "Address the caching proxy listens on")
+    flag.Parse()
+
+    // Start the upstream in the same process so the example has no external dependency
+    go upstream(":8081")
+
+    p, err := proxy.NewReverseProxy(proxy.ProxyConfig{
+        Upstream: "http://localhost:8081",
+        Cache: &proxy.CacheConfig{
+            Store: cache.NewMemoryStore(1000), // Keep up to 1000 responses
+        },
+    })
+    if err != nil {
+        panic(err)
+    }
+
+    h := server.Default(server.WithHostPorts(*addr))
+    h.Any("/*path", p.Handler)
+    h.Spin()
+}
+
+// upstream serves responses that are fresh for 10 seconds, then can be served stale for 30 seconds while revalidated.
+func upstream(addr string) {
+    h := server.New(server.WithHostPorts(addr))
+    h.GET("/time", func(ctx context.Context, c *app.RequestContext) {
+        c.Header("Cache-Control", "max-age=10, stale-while-revalidate=30")
+        c.JSON(consts.StatusOK, utils.H{"time": time.Now().Format(time.RFC3339)})
+    })
+    h.GET("/private", func(ctx context.Context, c *app.RequestContext) {
+        c.Header("Cache-Control", "private, max-age=10")
+        c.JSON(consts.StatusOK, utils.H{"time": time.Now().Format(time.RFC3339)})
+    })
+    h.Spin()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/gateway"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strings"
+    "time"
+)
+
+func main() {
+    configPath := flag.String("config", "examples/gateway/gateway.yaml", "YAML file of the gateway")
+    flag.Parse()
+
+    // Start the upstream in the same process so the example has no external dependency
+    go upstream(":8081")
+
+    config, err := gateway.LoadFile(*configPath)
+    if err != nil {
+        panic(err)
+    }
+    g, err := gateway.New(context.Background(), config)
+    if err != nil {
+        panic(err)
+    }
+    g.Spin()
+}
+
+// upstream serves a cacheable catalog, large enough to be compressed, and the orders.
+func upstream(addr string) {
+    h := server.New(server.WithHostPorts(addr))
+    h.GET("/catalog", func(ctx context.Context, c *app.RequestContext) {
+        c.Header("Cache-Control", "max-age=10")
+        c.JSON(consts.StatusOK, utils.H{
+            "time":        time.Now().Format(time.RFC3339),
+            "description": strings.Repeat("A concept of the repository. ", 20),
+        })
+    })
+    h.Any("/orders", func(ctx context.Context, c *app.RequestContext) {
+        c.JSON(consts.StatusOK, utils.H{"orders": []string{}})
+    })
+    h.Spin()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    "github.com/aswinkm-tc/go-web-concepts/internal/transform"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "time"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "Address the proxy listens on")
+    flag.Parse()
+
+    // Start the upstreams in the same process so the example has no external dependency
+    go upstream(":8081", "v1")
+    go upstream(":8082", "v1-replica")
+    go upstream(":8083", "v2-canary")
+    go upstream(":8084", "shadow")
+
+    p, err := proxy.NewReverseProxy(proxy.ProxyConfig{
+        Upstreams: []string{"http://localhost:8081", "http://localhost:8082"},
+        Affinity: proxy.AffinityConfig{
+            Mode: proxy.AffinityCookie, // Keep a client on the same upstream
+        },
+        Canary: &proxy.CanaryConfig{
+            Upstream:          "http://localhost:8083",
+            Weight:            10,                     // Route 10% of the requests to the canary
+            MaxAverageLatency: 200 * time.Millisecond, // Roll back above 200ms average latency
+        },
+        Mirrors: []proxy.MirrorConfig{
+            {
+                Upstream:             "http://localhost:8084",
+                Percentage:           50, // Copy half of the requests to the shadow upstream
+                MaxRequestsPerSecond: 10, // Never send more than 10 requests per second to the shadow
+            },
+        },
+    })
+    if err != nil {
+        panic(err)
+    }
+
+    t, err := transform.NewTransformer(transform.TransformConfig{
+        Request: []transform.Rule{
+            {
+                PathPrefix:  "/api/",
+                SetHeaders:  map[string]string{"X-Gateway": "go-web-concepts"},
+                RewritePath: &transform.PathRewrite{Match: "^/api/(.*)", Replacement: "/$1"},
+            },
+        },
+        Response: []transform.Rule{
+            {
+                PathPrefix:   "/api/",
+                RedactFields: []string{"secret"},
+            },
+        },
+    })
+    if err != nil {
+        panic(err)
+    }
+
+    h := server.Default(server.WithHostPorts(*addr))
+    h.Any("/api/*path", t.Middleware, p.Handler)
+    h.Spin()
+}
+
+// upstream serves a JSON response telling which version handled the request.
+func upstream(addr, version string) {
+    h := server.New(server.WithHostPorts(addr))
+    h.Any("/*path", func(ctx context.Context, c *app.RequestContext) {
+        slog.Info("Upstream received request", "version", version, "path", string(c.Path()))
+        c.JSON(consts.StatusOK, utils.H{
+            "version": version,
+            "path":    string(c.Path()),
+            "gateway": string(c.GetHeader("X-Gateway")),
+            "secret":  "redacted by the proxy",
+        })
+    })
+    h.Spin()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
     "context"
+    "flag"
     ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
     ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
     "github.com/cloudwego/hertz/pkg/app"
@@ -13,10 +14,13 @@ import (
 )
 
 func main() {
+    addr := flag.String("addr", ":8888", "Address the example server listens on")
+    redisAddr := flag.String("redis", "localhost:6379", "Address of the Redis server started by hack/docker-compose.yaml")
+    flag.Parse()
     ctx := context.Background()
 
     // Create a Redis store for each endpoint with a TTL of 1 minute
-    store, err := ratelimiterstore.NewRedisStore(ctx, "localhost:6379", 100) // 100 keys per scan
+    store, err := ratelimiterstore.NewRedisStore(ctx, *redisAddr, 100) // 100 keys per scan
     if err != nil {
         panic(err)
     }
@@ -34,8 +38,10 @@ func main() {
 
     // Create a new rate limiter for the endpoint
     rateLimiter := ratelimiter.NewRateLimiter(rateLimiterConfig, store, sanitizePath)
+    // Close the Redis store once the server shut down
+    defer rateLimiter.Close()
 
-    h := server.Default()
+    h := server.Default(server.WithHostPorts(*addr))
     // Register the rate limiter middleware for the endpoint
     h.Use(rateLimiter.Middleware)
 
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strconv"
+    "sync"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "Address the proxy listens on")
+    flag.Parse()
+
+    // Start the upstreams in the same process so the example has no external dependency
+    go upstream(":8081", "app-1")
+    go upstream(":8082", "app-2")
+
+    p, err := proxy.NewReverseProxy(proxy.ProxyConfig{
+        Upstreams: []string{"http://localhost:8081", "http://localhost:8082"},
+        Affinity: proxy.AffinityConfig{
+            Mode:       proxy.AffinityCookie, // Keep a client on the upstream holding its session
+            CookieName: "app_affinity",
+        },
+    })
+    if err != nil {
+        panic(err)
+    }
+
+    h := server.Default(server.WithHostPorts(*addr))
+    h.Any("/*path", p.Handler)
+    h.Spin()
+}
+
+// upstream keeps the sessions in its own memory, like the applications that need sticky sessions: a client sent to
+// the other upstream would start a new session.
+func upstream(addr, name string) {
+    var (
+        mu       sync.Mutex
+        sessions = make(map[string]int) // Visits, keyed by session id
+        next     int
+    )
+    h := server.New(server.WithHostPorts(addr))
+    h.GET("/visits", func(ctx context.Context, c *app.RequestContext) {
+        mu.Lock()
+        defer mu.Unlock()
+        id := string(c.Cookie("session"))
+        if _, ok := sessions[id]; !ok {
+            next++
+            id = name + "-" + strconv.Itoa(next)
+            c.SetCookie("session", id, 0, "/", "", 0, false, true)
+        }
+        sessions[id]++
+        c.JSON(consts.StatusOK, utils.H{"upstream": name, "session": id, "visits": sessions[id]})
+    })
+    h.Spin()
+}
@@ -0,0 +1,189 @@
+package examples
+
+import (
+    "encoding/json"
+    "github.com/alicebob/miniredis/v2"
+    "io"
+    "net/http"
+    "net/http/cookiejar"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestExamples builds and starts the runnable examples one at a time, and checks their responses.
+func TestExamples(t *testing.T) {
+    if testing.Short() {
+        t.Skip("builds and runs every example")
+    }
+    t.Run("rate_limiter", func(t *testing.T) {
+        mr := miniredis.RunT(t)
+        start(t, "rate_limiter", "http://localhost:8888/", "-redis", mr.Addr())
+        for range 5 {
+            expectStatus(t, get(t, http.DefaultClient, "http://localhost:8888/ping", nil), 200)
+        }
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8888/ping", nil), 429)
+    })
+    t.Run("proxy", func(t *testing.T) {
+        start(t, "proxy", "http://localhost:8080/")
+        body := expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/api/users", nil), 200)
+        for _, want := range []string{`"gateway":"go-web-concepts"`, `"path":"/users"`, `"secret":"[REDACTED]"`} {
+            if !strings.Contains(body, want) {
+                t.Fatalf("body %s, %s expected", body, want)
+            }
+        }
+    })
+    t.Run("cache", func(t *testing.T) {
+        start(t, "cache", "http://localhost:8080/")
+        for _, test := range []struct{ path, status string }{
+            {"/time", "MISS"}, {"/time", "HIT"}, {"/private", "MISS"}, {"/private", "MISS"},
+        } {
+            expectHeader(t, get(t, http.DefaultClient, "http://localhost:8080"+test.path, nil), "X-Cache", test.status)
+        }
+    })
+    t.Run("gateway", func(t *testing.T) {
+        start(t, "gateway", "http://localhost:8080/")
+        // The upstream runs in the same process, it may start after the gateway
+        waitFor(t, "http://localhost:8081/orders")
+        expectHeader(t, get(t, http.DefaultClient, "http://localhost:8080/catalog", nil), "X-Cache", "MISS")
+        expectHeader(t, get(t, http.DefaultClient, "http://localhost:8080/catalog", nil), "X-Cache", "HIT")
+        // Asking for gzip explicitly keeps the client from decompressing it
+        expectHeader(t, get(t, http.DefaultClient, "http://localhost:8080/catalog", http.Header{"Accept-Encoding": {"gzip"}}), "Content-Encoding", "gzip")
+        for range 5 {
+            expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", nil), 200)
+        }
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", nil), 429)
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", http.Header{"X-API-Key": {"acme-secret-key"}}), 200)
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", http.Header{"X-API-Key": {"unknown"}}), 401)
+    })
+    t.Run("breaker", func(t *testing.T) {
+        start(t, "breaker", "http://localhost:8080/breaker", "-open-duration", "500ms")
+        for range 3 {
+            expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", nil), 502)
+        }
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", nil), 503)
+        resp, err := http.Post("http://localhost:8080/inventory/up", "", nil)
+        if err != nil {
+            t.Fatalf("POST /inventory/up: %v", err)
+        }
+        expectStatus(t, resp, 200)
+        time.Sleep(500 * time.Millisecond)
+        expectStatus(t, get(t, http.DefaultClient, "http://localhost:8080/orders", nil), 200)
+    })
+    t.Run("sessions", func(t *testing.T) {
+        start(t, "sessions", "http://localhost:8080/visits")
+        waitFor(t, "http://localhost:8081/visits")
+        waitFor(t, "http://localhost:8082/visits")
+        jar, _ := cookiejar.New(nil)
+        client := &http.Client{Jar: jar}
+        var first string
+        for visits := 1; visits <= 3; visits++ {
+            var session struct {
+                Upstream string `json:"upstream"`
+                Visits   int    `json:"visits"`
+            }
+            body := expectStatus(t, get(t, client, "http://localhost:8080/visits", nil), 200)
+            if err := json.Unmarshal([]byte(body), &session); err != nil {
+                t.Fatalf("visit %d: %s: %v", visits, body, err)
+            }
+            if first == "" {
+                first = session.Upstream
+            }
+            if session.Upstream != first || session.Visits != visits {
+                t.Fatalf("visit %d: %s, %d visits on %s expected", visits, body, visits, first)
+            }
+        }
+    })
+    t.Run("sse", func(t *testing.T) {
+        start(t, "sse", "http://localhost:8080/", "-events", "3")
+        sse := http.Header{"Accept": {"text/event-stream"}}
+        stream := get(t, http.DefaultClient, "http://localhost:8080/events", sse)
+        defer stream.Body.Close()
+        first := make([]byte, len("id: 1"))
+        if _, err := io.ReadFull(stream.Body, first); err != nil || string(first) != "id: 1" {
+            t.Fatalf("first event %q: %v", first, err)
+        }
+        // A second stream of the client is refused with a retry delay while the first one is open
+        second := get(t, http.DefaultClient, "http://localhost:8080/events", sse)
+        contentType := second.Header.Get("Content-Type")
+        if body := expectStatus(t, second, 200); body != "retry: 5000\n\n" || contentType != "text/event-stream" {
+            t.Fatalf("second stream %q of type %s, refused with a retry delay expected", body, contentType)
+        }
+    })
+}
+
+// start builds the example and runs it with the arguments until the test ends, once url answers.
+func start(t *testing.T, example, url string, args ...string) {
+    t.Helper()
+    binary := filepath.Join(t.TempDir(), example)
+    if out, err := exec.Command("go", "build", "-o", binary, "./"+example).CombinedOutput(); err != nil {
+        t.Fatalf("go build %s: %v\n%s", example, err, out)
+    }
+    cmd := exec.Command(binary, args...)
+    // The examples read their files relative to the root of the repository
+    cmd.Dir = ".."
+    var log strings.Builder
+    cmd.Stdout, cmd.Stderr = &log, &log
+    if err := cmd.Start(); err != nil {
+        t.Fatalf("start %s: %v", example, err)
+    }
+    t.Cleanup(func() {
+        _ = cmd.Process.Kill()
+        _ = cmd.Wait()
+        if t.Failed() {
+            t.Logf("output of %s:\n%s", example, log.String())
+        }
+    })
+    waitFor(t, url)
+}
+
+// waitFor waits until url answers, whatever its status.
+func waitFor(t *testing.T, url string) {
+    t.Helper()
+    for range 100 {
+        if resp, err := http.Get(url); err == nil {
+            resp.Body.Close()
+            return
+        }
+        time.Sleep(100 * time.Millisecond)
+    }
+    t.Fatalf("%s did not answer", url)
+}
+
+func get(t *testing.T, client *http.Client, url string, header http.Header) *http.Response {
+    t.Helper()
+    req, err := http.NewRequest(http.MethodGet, url, nil)
+    if err != nil {
+        t.Fatalf("NewRequest: %v", err)
+    }
+    for k, v := range header {
+        req.Header[k] = v
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        t.Fatalf("GET %s: %v", url, err)
+    }
+    return resp
+}
+
+// expectStatus checks the status of the response, and returns its body.
+func expectStatus(t *testing.T, resp *http.Response, status int) string {
+    t.Helper()
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(resp.Body)
+    if resp.StatusCode != status {
+        t.Fatalf("%s %s: %d %s, %d expected", resp.Request.Method, resp.Request.URL, resp.StatusCode, body, status)
+    }
+    return string(body)
+}
+
+func expectHeader(t *testing.T, resp *http.Response, name, value string) {
+    t.Helper()
+    defer resp.Body.Close()
+    _, _ = io.Copy(io.Discard, resp.Body)
+    if got := resp.Header.Get(name); got != value {
+        t.Fatalf("GET %s: %s %q, %q expected", resp.Request.URL, name, got, value)
+    }
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+    "time"
+)
+
+func main() {
+    addr := flag.String("addr", ":8080", "Address the example server listens on")
+    events := flag.Int("events", 30, "Number of events of a stream, one per second")
+    flag.Parse()
+
+    rateLimiter := ratelimiter.NewRateLimiter(ratelimiter.RateLimiterConfig{
+        "/events": ratelimiter.EndpointConfig{
+            MaxRequests:           10, // Allow a maximum of 10 connections per minute
+            TimeWindow:            time.Minute,
+            SlidingWindowInterval: time.Second,
+        },
+    }, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    }, ratelimiter.WithConnectionLimits(ratelimiter.ConnectionConfig{
+        MaxConcurrent: 1,               // A client holds a single stream open at once
+        RetryAfter:    5 * time.Second, // EventSource reconnects after 5 seconds when refused
+    }))
+    defer rateLimiter.Close()
+
+    h := server.Default(server.WithHostPorts(*addr))
+    h.Use(rateLimiter.Middleware)
+    h.GET("/events", func(ctx context.Context, c *app.RequestContext) {
+        c.SetContentType("text/event-stream")
+        c.Header("Cache-Control", "no-cache")
+        // The stream lives in the handler, the events are flushed to the client as they are written
+        c.Response.HijackWriter(resp.NewChunkedBodyWriter(&c.Response, c.GetWriter()))
+        for i := 1; i <= *events; i++ {
+            if _, err := fmt.Fprintf(c, "id: %d\ndata: {\"time\":%q}\n\n", i, time.Now().Format(time.RFC3339)); err != nil {
+                return
+            }
+            if err := c.Flush(); err != nil {
+                return
+            }
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(time.Second):
+            }
+        }
+    })
+    h.Spin()
+}
@@ -0,0 +1,203 @@
+package admin
+
+import (
+    "context"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "time"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// PrincipalKey is the key of the Principal of the request in the request context, set by the middleware.
+const PrincipalKey = "admin.principal"
+
+// Role of an admin API caller, each role is allowed what the roles below it are.
+type Role string
+
+const (
+    // RoleReader reads the state of the admin API, e.g. the quotas or the configuration history
+    RoleReader Role = "reader"
+    // RoleOperator also changes it, e.g. resets a key, bans a user or rolls a configuration back
+    RoleOperator Role = "operator"
+)
+
+func (r Role) rank() int {
+    switch r {
+    case RoleReader:
+        return 1
+    case RoleOperator:
+        return 2
+    }
+    return 0
+}
+
+// Allows tells whether the role is allowed what the required role is.
+func (r Role) Allows(required Role) bool {
+    return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+// Principal is an authenticated caller of the admin API.
+type Principal struct {
+    // Name identifies the caller in the audit log, e.g. the name of a token, a SPIFFE ID or the email of an OIDC user
+    Name string `json:"name"`
+    Role Role   `json:"role,omitempty"`
+    // Method is the authentication method of the caller, e.g. token, mtls or oidc
+    Method string `json:"method"`
+}
+
+// Authenticator authenticates the callers of the admin API with one kind of credentials.
+type Authenticator interface {
+    // Authenticate returns the principal of the request, false if the request carries no credentials of this kind
+    // and an error wrapping ErrInvalidCredentials if they are not valid
+    Authenticate(ctx context.Context, c *app.RequestContext) (Principal, bool, error)
+}
+
+// PermissionFunc returns the role required for a request, "" to use the default: RoleReader for the GET, HEAD and
+// OPTIONS requests and RoleOperator for the others.
+type PermissionFunc func(c *app.RequestContext) Role
+
+type Option func(*AccessControl)
+
+// WithPermissions sets the roles required for the requests, e.g. to require RoleOperator to read the tokens of an
+// endpoint.
+func WithPermissions(permissions PermissionFunc) Option {
+    return func(a *AccessControl) {
+        a.permissions = permissions
+    }
+}
+
+// WithAuditLog sets where the mutations are recorded.
+//
+// Defaults to the slog default logger if not specified
+func WithAuditLog(audit AuditLog) Option {
+    return func(a *AccessControl) {
+        a.audit = audit
+    }
+}
+
+// AccessControl authenticates the callers of the admin API, checks their roles and records every mutation they make
+// in an audit log.
+type AccessControl struct {
+    authenticators []Authenticator
+    permissions    PermissionFunc
+    audit          AuditLog
+    now            func() time.Time
+}
+
+// NewAccessControl creates an AccessControl trying the authenticators in order, the first one finding credentials
+// in a request authenticates it.
+func NewAccessControl(authenticators []Authenticator, opts ...Option) *AccessControl {
+    a := &AccessControl{
+        authenticators: authenticators,
+        audit:          NewSlogAuditLog(slog.Default()),
+        now:            time.Now,
+    }
+    for _, opt := range opts {
+        opt(a)
+    }
+    return a
+}
+
+// Authenticate returns the principal of the request from the first authenticator finding credentials in it.
+func (a *AccessControl) Authenticate(ctx context.Context, c *app.RequestContext) (Principal, error) {
+    for _, authenticator := range a.authenticators {
+        principal, ok, err := authenticator.Authenticate(ctx, c)
+        if err != nil {
+            return Principal{}, err
+        }
+        if ok {
+            return principal, nil
+        }
+    }
+    return Principal{}, ErrInvalidCredentials
+}
+
+func (a *AccessControl) required(c *app.RequestContext) Role {
+    if a.permissions != nil {
+        if role := a.permissions(c); role != "" {
+            return role
+        }
+    }
+    if !mutation(c) {
+        return RoleReader
+    }
+    return RoleOperator
+}
+
+// mutation reports whether the request may change something: any request but GET, HEAD and OPTIONS, whatever the
+// role required for it.
+func mutation(c *app.RequestContext) bool {
+    switch string(c.Method()) {
+    case consts.MethodGet, consts.MethodHead, consts.MethodOptions:
+        return false
+    }
+    return true
+}
+
+// Middleware rejects the requests without valid credentials with 401, with 503 when they can't be verified, and the
+// requests of a role not allowed to make them with 403. The principal of an accepted request is set under
+// PrincipalKey.
+//
+// Every mutation, any request but GET, HEAD and OPTIONS whatever the role required for it, is recorded in the audit
+// log once handled, with the status of its response, and so are the ones rejected with 403.
+func (a *AccessControl) Middleware(ctx context.Context, c *app.RequestContext) {
+    principal, err := a.Authenticate(ctx, c)
+    switch {
+    case errors.Is(err, ErrInvalidCredentials):
+        c.Header("WWW-Authenticate", `Bearer`)
+        c.AbortWithStatusJSON(consts.StatusUnauthorized, utils.H{"error": "Invalid credentials"})
+        return
+    case err != nil:
+        slog.Error("Error authenticating admin request", "error", err)
+        c.AbortWithStatusJSON(consts.StatusServiceUnavailable, utils.H{"error": "Authentication unavailable"})
+        return
+    }
+    required := a.required(c)
+    mutates := mutation(c)
+    start := a.now()
+    if !principal.Role.Allows(required) {
+        c.AbortWithStatusJSON(consts.StatusForbidden, utils.H{"error": "Forbidden"})
+    } else {
+        c.Set(PrincipalKey, principal)
+        c.Next(ctx)
+    }
+    if mutates {
+        a.record(ctx, c, principal, start)
+    }
+}
+
+func (a *AccessControl) record(ctx context.Context, c *app.RequestContext, principal Principal, start time.Time) {
+    entry := AuditEntry{
+        Time:      start,
+        Principal: principal,
+        Method:    string(c.Method()),
+        Path:      string(c.Request.URI().RequestURI()),
+        ClientIP:  c.ClientIP(),
+        Status:    c.Response.StatusCode(),
+    }
+    entry.Notes, _ = c.Value(NotesKey).([]KeyNote)
+    if body := c.Request.Body(); len(body) > maxAuditBody {
+        entry.Body = string(body[:maxAuditBody])
+        entry.Truncated = true
+    } else {
+        entry.Body = string(body)
+    }
+    // Recorded even if the caller went away, the mutation may have been applied
+    if err := a.audit.Record(context.WithoutCancel(ctx), entry); err != nil {
+        slog.Error("Error recording admin audit entry", "error", err, "principal", principal.Name, "path", entry.Path)
+    }
+}
+
+// Identity returns the name of the principal of the request, as authenticated by the middleware. It can be the author
+// of a config_history revision, or match ratelimiter.IdentityFunc to limit the admin API per caller.
+func (a *AccessControl) Identity(_ context.Context, c *app.RequestContext) string {
+    principal, ok := c.Value(PrincipalKey).(Principal)
+    if !ok {
+        return ""
+    }
+    return principal.Name
+}
@@ -0,0 +1,167 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "github.com/mediocregopher/radix/v4"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// recordedAuditLog keeps the entries recorded, for the tests.
+type recordedAuditLog struct {
+    mu      sync.Mutex
+    entries []AuditEntry
+}
+
+func (l *recordedAuditLog) Record(_ context.Context, entry AuditEntry) error {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.entries = append(l.entries, entry)
+    return nil
+}
+
+// failingAuthenticator fails like an identity provider that can't be reached.
+type failingAuthenticator struct{}
+
+func (failingAuthenticator) Authenticate(context.Context, *app.RequestContext) (Principal, bool, error) {
+    return Principal{}, false, errors.New("connection refused")
+}
+
+func TestRoleAllows(t *testing.T) {
+    for _, test := range []struct {
+        role, required Role
+        allows         bool
+    }{
+        {RoleReader, RoleReader, true},
+        {RoleReader, RoleOperator, false},
+        {RoleOperator, RoleReader, true},
+        {RoleOperator, RoleOperator, true},
+        // An authenticated caller without a role is allowed nothing
+        {"", RoleReader, false},
+        {"admin", RoleReader, false},
+    } {
+        if got := test.role.Allows(test.required); got != test.allows {
+            t.Fatalf("%q allows %q: %t, %t expected", test.role, test.required, got, test.allows)
+        }
+    }
+}
+
+func TestAccessControl(t *testing.T) {
+    audit := &recordedAuditLog{}
+    access := NewAccessControl([]Authenticator{NewStaticTokens(map[string]StaticToken{
+        "reader-token":   {Name: "dashboard", Role: RoleReader},
+        "operator-token": {Name: "deploy-bot", Role: RoleOperator},
+        "no-role-token":  {Name: "intern"},
+    })}, WithAuditLog(audit), WithPermissions(func(c *app.RequestContext) Role {
+        // The tokens of the endpoints are secrets
+        if strings.HasPrefix(string(c.Path()), "/admin/tokens") {
+            return RoleOperator
+        }
+        return ""
+    }))
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.Use(access.Middleware)
+    handler := func(ctx context.Context, c *app.RequestContext) {
+        c.String(200, access.Identity(ctx, c))
+    }
+    engine.GET("/admin/keys", handler)
+    engine.POST("/admin/keys/reset", handler)
+    engine.GET("/admin/tokens", handler)
+
+    for _, test := range []struct {
+        method, path, authorization string
+        status                      int
+        body                        string
+    }{
+        {"GET", "/admin/keys", "", 401, ""},
+        {"GET", "/admin/keys", "Bearer wrong-token", 401, ""},
+        {"GET", "/admin/keys", "Basic reader-token", 401, ""},
+        {"GET", "/admin/keys", "Bearer reader-token", 200, "dashboard"},
+        {"GET", "/admin/keys", "bearer  operator-token ", 200, "deploy-bot"},
+        {"GET", "/admin/keys", "Bearer no-role-token", 403, ""},
+        {"POST", "/admin/keys/reset", "Bearer reader-token", 403, ""},
+        {"POST", "/admin/keys/reset", "Bearer operator-token", 200, "deploy-bot"},
+        {"GET", "/admin/tokens", "Bearer reader-token", 403, ""},
+        {"GET", "/admin/tokens", "Bearer operator-token", 200, "deploy-bot"},
+    } {
+        var headers []ut.Header
+        if test.authorization != "" {
+            headers = append(headers, ut.Header{Key: "Authorization", Value: test.authorization})
+        }
+        resp := ut.PerformRequest(engine, test.method, test.path, &ut.Body{Body: strings.NewReader(`{"user":"10.0.0.1"}`), Len: 19}, headers...).Result()
+        if resp.StatusCode() != test.status || (test.body != "" && string(resp.Body()) != test.body) {
+            t.Fatalf("%s %s with %q: %d %s, %d %s expected", test.method, test.path, test.authorization, resp.StatusCode(), resp.Body(), test.status, test.body)
+        }
+        if test.status == 401 && string(resp.Header.Peek("WWW-Authenticate")) != "Bearer" {
+            t.Fatalf("401 without WWW-Authenticate")
+        }
+    }
+
+    // Only the mutations are audited, the forbidden ones too
+    if len(audit.entries) != 2 {
+        t.Fatalf("audited %+v, the 2 POST expected", audit.entries)
+    }
+    for i, want := range []struct {
+        name   string
+        status int
+    }{{"dashboard", 403}, {"deploy-bot", 200}} {
+        entry := audit.entries[i]
+        if entry.Principal.Name != want.name || entry.Status != want.status || entry.Path != "/admin/keys/reset" || entry.Body != `{"user":"10.0.0.1"}` {
+            t.Fatalf("audit entry %d: %+v, %s with %d expected", i, entry, want.name, want.status)
+        }
+    }
+}
+
+func TestAccessControlUnavailable(t *testing.T) {
+    access := NewAccessControl([]Authenticator{failingAuthenticator{}, NewStaticTokens(map[string]StaticToken{
+        "operator-token": {Name: "deploy-bot", Role: RoleOperator},
+    })}, WithAuditLog(&recordedAuditLog{}))
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.GET("/admin/keys", access.Middleware, func(_ context.Context, c *app.RequestContext) {
+        c.Status(200)
+    })
+    // The credentials can't be checked, the request is neither let through nor told its credentials are wrong
+    resp := ut.PerformRequest(engine, "GET", "/admin/keys", nil, ut.Header{Key: "Authorization", Value: "Bearer operator-token"}).Result()
+    if resp.StatusCode() != 503 {
+        t.Fatalf("status %d, 503 expected", resp.StatusCode())
+    }
+}
+
+func TestRedisAuditLogKeepsTheLastEntries(t *testing.T) {
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    defer client.Close()
+    audit := NewRedisAuditLog(client, "admin:audit", 3)
+    for i := range 5 {
+        if err := audit.Record(context.Background(), AuditEntry{Method: "POST", Path: fmt.Sprintf("/admin/keys/%d", i)}); err != nil {
+            t.Fatalf("Record: %v", err)
+        }
+    }
+    values, err := mr.List("admin:audit")
+    if err != nil {
+        t.Fatalf("List: %v", err)
+    }
+    var paths []string
+    for _, value := range values {
+        var entry AuditEntry
+        if err := json.Unmarshal([]byte(value), &entry); err != nil {
+            t.Fatalf("Unmarshal: %v", err)
+        }
+        paths = append(paths, entry.Path)
+    }
+    if got := strings.Join(paths, " "); got != "/admin/keys/4 /admin/keys/3 /admin/keys/2" {
+        t.Fatalf("entries %s, the last 3 most recent first expected", got)
+    }
+}
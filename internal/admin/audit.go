@@ -0,0 +1,103 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "time"
+)
+
+// maxAuditBody is the largest request body kept in an audit entry, larger ones are truncated.
+const maxAuditBody = 4096
+
+// AuditEntry records a mutation requested from the admin API.
+type AuditEntry struct {
+    Time      time.Time `json:"time"`
+    Principal Principal `json:"principal"`
+    Method    string    `json:"method"`
+    // Path of the request, with its query
+    Path     string `json:"path"`
+    ClientIP string `json:"client_ip"`
+    // Status of the response, 403 for the mutations the principal was not allowed to make
+    Status int `json:"status"`
+    // Body of the request, e.g. the key reset or the share changed
+    Body      string `json:"body,omitempty"`
+    Truncated bool   `json:"truncated,omitempty"`
+    // Notes of the keys the mutation concerns, see AttachNotes
+    Notes []KeyNote `json:"notes,omitempty"`
+}
+
+// AuditLog records the mutations requested from the admin API.
+type AuditLog interface {
+    Record(ctx context.Context, entry AuditEntry) error
+}
+
+type slogAuditLog struct {
+    logger *slog.Logger
+}
+
+// NewSlogAuditLog creates an AuditLog writing the entries to the logger, e.g. to ship them with the other logs.
+func NewSlogAuditLog(logger *slog.Logger) AuditLog {
+    return &slogAuditLog{logger: logger}
+}
+
+func (l *slogAuditLog) Record(ctx context.Context, entry AuditEntry) error {
+    l.logger.InfoContext(ctx, "Admin mutation",
+        "principal", entry.Principal.Name,
+        "role", entry.Principal.Role,
+        "auth", entry.Principal.Method,
+        "method", entry.Method,
+        "path", entry.Path,
+        "client_ip", entry.ClientIP,
+        "status", entry.Status,
+        "body", entry.Body,
+        "notes", entry.Notes,
+    )
+    return nil
+}
+
+type redisAuditLog struct {
+    client radix.Client
+    key    string
+    size   int
+}
+
+// NewRedisAuditLog creates an AuditLog keeping the last size entries of all the instances in a Redis list, most
+// recent first.
+func NewRedisAuditLog(client radix.Client, key string, size int) AuditLog {
+    return &redisAuditLog{
+        client: client,
+        key:    key,
+        size:   size,
+    }
+}
+
+func (l *redisAuditLog) Record(ctx context.Context, entry AuditEntry) error {
+    value, err := json.Marshal(entry)
+    if err != nil {
+        return fmt.Errorf("failed to encode audit entry: %w", err)
+    }
+    p := radix.NewPipeline()
+    p.Append(radix.Cmd(nil, "LPUSH", l.key, string(value)))
+    p.Append(radix.FlatCmd(nil, "LTRIM", l.key, 0, l.size-1))
+    if err = l.client.Do(ctx, p); err != nil {
+        return fmt.Errorf("failed to record audit entry %s: %w", l.key, err)
+    }
+    return nil
+}
+
+// MultiAuditLog records the entries in all the logs, e.g. in Redis and in the logs.
+type MultiAuditLog []AuditLog
+
+func (m MultiAuditLog) Record(ctx context.Context, entry AuditEntry) error {
+    var errs []error
+    for _, l := range m {
+        if err := l.Record(ctx, entry); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    return errors.Join(errs...)
+}
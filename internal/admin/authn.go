@@ -0,0 +1,91 @@
+package admin
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/x509"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/network"
+    "strings"
+)
+
+// StaticToken is a bearer token of an admin API caller.
+type StaticToken struct {
+    // Name of the caller in the audit log, e.g. deploy-bot
+    Name string `json:"name"`
+    Role Role   `json:"role"`
+}
+
+type staticTokens struct {
+    tokens map[[sha256.Size]byte]StaticToken
+}
+
+// NewStaticTokens creates an Authenticator of the bearer tokens of the map, e.g. for the automation calling the
+// admin API. The tokens are only kept hashed.
+func NewStaticTokens(tokens map[string]StaticToken) Authenticator {
+    s := &staticTokens{tokens: make(map[[sha256.Size]byte]StaticToken, len(tokens))}
+    for token, t := range tokens {
+        s.tokens[sha256.Sum256([]byte(token))] = t
+    }
+    return s
+}
+
+func (s *staticTokens) Authenticate(_ context.Context, c *app.RequestContext) (Principal, bool, error) {
+    token := bearerToken(c)
+    if token == "" {
+        return Principal{}, false, nil
+    }
+    // Looked up by hash, so the comparisons don't leak the tokens through their timing
+    t, ok := s.tokens[sha256.Sum256([]byte(token))]
+    if !ok {
+        return Principal{}, false, nil
+    }
+    return Principal{Name: t.Name, Role: t.Role, Method: "token"}, true, nil
+}
+
+type mtls struct {
+    roles map[string]Role
+}
+
+// NewMTLS creates an Authenticator of the verified client certificates, identified by their first URI SAN, e.g. a
+// SPIFFE ID, or else their common name. The roles map the identities to their roles, the ones missing from it are
+// authenticated without a role.
+//
+// The server must verify the client certificates, e.g. with tls.VerifyClientCertIfGiven, on the standard transport:
+// the netpoll transport doesn't support TLS.
+func NewMTLS(roles map[string]Role) Authenticator {
+    return &mtls{roles: roles}
+}
+
+func (m *mtls) Authenticate(_ context.Context, c *app.RequestContext) (Principal, bool, error) {
+    conn, ok := c.GetConn().(network.ConnTLSer)
+    if !ok {
+        return Principal{}, false, nil
+    }
+    state := conn.ConnectionState()
+    if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+        return Principal{}, false, nil
+    }
+    name := certificateIdentity(state.VerifiedChains[0][0])
+    if name == "" {
+        return Principal{}, false, fmt.Errorf("%w: client certificate without identity", ErrInvalidCredentials)
+    }
+    return Principal{Name: name, Role: m.roles[name], Method: "mtls"}, true, nil
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+    if len(cert.URIs) > 0 {
+        return cert.URIs[0].String()
+    }
+    return cert.Subject.CommonName
+}
+
+// bearerToken returns the bearer token of the Authorization header, "" if there is none.
+func bearerToken(c *app.RequestContext) string {
+    scheme, token, ok := strings.Cut(string(c.GetHeader("Authorization")), " ")
+    if !ok || !strings.EqualFold(scheme, "Bearer") {
+        return ""
+    }
+    return strings.TrimSpace(token)
+}
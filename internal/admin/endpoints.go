@@ -0,0 +1,284 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "maps"
+    "slices"
+    "sync"
+    "time"
+)
+
+// MetricEndpointToggles counts the changes of the disabled endpoints, tagged with the endpoint and the action: disable,
+// restore or expire.
+const MetricEndpointToggles = "admin.endpoint_toggles"
+
+// ApplyFunc applies a configuration of the rate limiter, e.g. its UpdateConfig, or the SetConfig of the control plane
+// so the whole fleet gets it.
+type ApplyFunc func(ctx context.Context, config ratelimiter.RateLimiterConfig) error
+
+type ToggleConfig struct {
+    // MaxTTL is the longest an endpoint may be disabled for, so a forgotten migration doesn't leave it unlimited
+    //
+    // Defaults to 24 hours if not specified
+    MaxTTL time.Duration `json:"max_ttl,omitempty"`
+}
+
+// ToggleRequest is the body of a request disabling an endpoint with PUT or restoring it with DELETE.
+type ToggleRequest struct {
+    Endpoint string `json:"endpoint"`
+    // TTLSeconds is how long the endpoint is disabled for, ignored when restoring it
+    TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+    // Reason is logged with the change, e.g. the ticket of the migration
+    Reason string `json:"reason,omitempty"`
+}
+
+// DisabledEndpoint is an endpoint whose limit is disabled.
+type DisabledEndpoint struct {
+    Endpoint      string    `json:"endpoint"`
+    DisabledUntil time.Time `json:"disabled_until"`
+}
+
+type ToggleOption func(*EndpointToggle)
+
+// WithToggleApply applies the changes with the function instead of the UpdateConfig of the rate limiter.
+func WithToggleApply(apply ApplyFunc) ToggleOption {
+    return func(t *EndpointToggle) {
+        t.apply = apply
+    }
+}
+
+// WithToggleAuditLog records the endpoints restored when their TTL expires, the changes requested from the admin API
+// are recorded by the AccessControl in front of it.
+//
+// Defaults to NewSlogAuditLog(slog.Default()) if not specified
+func WithToggleAuditLog(audit AuditLog) ToggleOption {
+    return func(t *EndpointToggle) {
+        t.audit = audit
+    }
+}
+
+// WithToggleMetrics counts the changes as MetricEndpointToggles.
+//
+// Defaults to metrics.Discard if not specified
+func WithToggleMetrics(sink metrics.Sink) ToggleOption {
+    return func(t *EndpointToggle) {
+        t.metrics = sink
+    }
+}
+
+// EndpointToggle soft-deletes the limits of endpoints for a while through the admin API, e.g. during a migration, and
+// restores them, see ratelimiter.EndpointConfig.DisabledUntil. The configurations of the endpoints are kept.
+//
+// A limit applies again once its TTL expires on every instance reading the configuration, whatever happens to the
+// toggle. The instance that disabled it also clears DisabledUntil then, and records it in the audit log.
+type EndpointToggle struct {
+    limiter ratelimiter.RateLimiter
+    apply   ApplyFunc
+    maxTTL  time.Duration
+    audit   AuditLog
+    metrics metrics.Sink
+    now     func() time.Time
+    mu      sync.Mutex
+    // Timers restoring the endpoints disabled by this instance when they expire
+    timers map[string]*time.Timer
+}
+
+// NewEndpointToggle creates an EndpointToggle changing the configuration of the rate limiter.
+func NewEndpointToggle(limiter ratelimiter.RateLimiter, config ToggleConfig, opts ...ToggleOption) *EndpointToggle {
+    if config.MaxTTL == 0 {
+        config.MaxTTL = 24 * time.Hour
+    }
+    t := &EndpointToggle{
+        limiter: limiter,
+        apply: func(_ context.Context, config ratelimiter.RateLimiterConfig) error {
+            limiter.UpdateConfig(config)
+            return nil
+        },
+        maxTTL:  config.MaxTTL,
+        audit:   NewSlogAuditLog(slog.Default()),
+        metrics: metrics.Discard,
+        now:     time.Now,
+        timers:  make(map[string]*time.Timer),
+    }
+    for _, opt := range opts {
+        opt(t)
+    }
+    return t
+}
+
+// Handler lists the disabled endpoints on GET, disables one from a ToggleRequest on PUT and restores one on DELETE.
+// It must be registered behind an AccessControl, e.g. adminGroup.Any("/endpoints/disabled", toggle.Handler).
+func (t *EndpointToggle) Handler(ctx context.Context, c *app.RequestContext) {
+    switch string(c.Method()) {
+    case consts.MethodGet:
+        c.JSON(consts.StatusOK, t.Disabled())
+        return
+    case consts.MethodPut, consts.MethodDelete:
+    default:
+        c.JSON(consts.StatusMethodNotAllowed, utils.H{"error": "Expected GET, PUT or DELETE"})
+        return
+    }
+    var req ToggleRequest
+    if err := json.Unmarshal(c.Request.Body(), &req); err != nil || req.Endpoint == "" {
+        c.JSON(consts.StatusBadRequest, utils.H{"error": "Expected an endpoint"})
+        return
+    }
+    if string(c.Method()) == consts.MethodDelete {
+        status, err := t.Restore(ctx, req.Endpoint)
+        if err != nil {
+            c.JSON(status, utils.H{"error": err.Error()})
+            return
+        }
+        slog.Info("Endpoint limit restored", "endpoint", req.Endpoint, "reason", req.Reason)
+        c.JSON(consts.StatusOK, utils.H{"endpoint": req.Endpoint})
+        return
+    }
+    ttl := time.Duration(req.TTLSeconds) * time.Second
+    if ttl <= 0 || ttl > t.maxTTL {
+        c.JSON(consts.StatusBadRequest, utils.H{"error": fmt.Sprintf("Expected a ttl_seconds between 1 and %d", int64(t.maxTTL/time.Second))})
+        return
+    }
+    disabled, status, err := t.Disable(ctx, req.Endpoint, ttl, string(c.Path()))
+    if err != nil {
+        c.JSON(status, utils.H{"error": err.Error()})
+        return
+    }
+    slog.Info("Endpoint limit disabled", "endpoint", req.Endpoint, "until", disabled.DisabledUntil, "reason", req.Reason)
+    c.JSON(consts.StatusOK, disabled)
+}
+
+// Disabled returns the endpoints whose limit is disabled, sorted by endpoint.
+func (t *EndpointToggle) Disabled() []DisabledEndpoint {
+    config := t.limiter.Config()
+    now := t.now()
+    disabled := []DisabledEndpoint{}
+    for _, endpoint := range slices.Sorted(maps.Keys(config)) {
+        if conf := config[endpoint]; conf.Disabled(now) {
+            disabled = append(disabled, DisabledEndpoint{Endpoint: endpoint, DisabledUntil: conf.DisabledUntil})
+        }
+    }
+    return disabled
+}
+
+// Disable disables the limit of the endpoint for the ttl, or extends it. The path is the one of the admin API, recorded
+// with the restore when the ttl expires. The status tells the failure of a request, 404 for an unknown endpoint.
+func (t *EndpointToggle) Disable(ctx context.Context, endpoint string, ttl time.Duration, path string) (DisabledEndpoint, int, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    until := t.now().Add(ttl)
+    status, err := t.update(ctx, endpoint, func(conf ratelimiter.EndpointConfig) (ratelimiter.EndpointConfig, error) {
+        conf.DisabledUntil = until
+        return conf, nil
+    })
+    if err != nil {
+        return DisabledEndpoint{}, status, err
+    }
+    t.metrics.Count(MetricEndpointToggles, 1, metrics.Tag{Key: "endpoint", Value: endpoint}, metrics.Tag{Key: "action", Value: "disable"})
+    if timer, ok := t.timers[endpoint]; ok {
+        timer.Stop()
+    }
+    // Assigned under the lock, the timer only reads it once it holds the lock too
+    var timer *time.Timer
+    timer = time.AfterFunc(ttl, func() {
+        t.mu.Lock()
+        defer t.mu.Unlock()
+        t.expire(endpoint, timer, until, path)
+    })
+    t.timers[endpoint] = timer
+    return DisabledEndpoint{Endpoint: endpoint, DisabledUntil: until}, consts.StatusOK, nil
+}
+
+// Restore applies the limit of a disabled endpoint again. The status tells the failure of a request, 404 for an
+// unknown endpoint or one not disabled.
+func (t *EndpointToggle) Restore(ctx context.Context, endpoint string) (int, error) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    status, err := t.update(ctx, endpoint, func(conf ratelimiter.EndpointConfig) (ratelimiter.EndpointConfig, error) {
+        if !conf.Disabled(t.now()) {
+            return conf, fmt.Errorf("endpoint %s is not disabled", endpoint)
+        }
+        conf.DisabledUntil = time.Time{}
+        return conf, nil
+    })
+    if err != nil {
+        return status, err
+    }
+    t.metrics.Count(MetricEndpointToggles, 1, metrics.Tag{Key: "endpoint", Value: endpoint}, metrics.Tag{Key: "action", Value: "restore"})
+    if timer, ok := t.timers[endpoint]; ok {
+        timer.Stop()
+        delete(t.timers, endpoint)
+    }
+    return consts.StatusOK, nil
+}
+
+// expire clears DisabledUntil once the ttl is over, unless the endpoint was disabled again or restored meanwhile. A
+// timer stopped too late to keep it from firing is no longer the one of the endpoint, it restores nothing. It is called
+// with the lock held.
+func (t *EndpointToggle) expire(endpoint string, timer *time.Timer, until time.Time, path string) {
+    if t.timers[endpoint] != timer {
+        return
+    }
+    delete(t.timers, endpoint)
+    ctx := context.Background()
+    _, err := t.update(ctx, endpoint, func(conf ratelimiter.EndpointConfig) (ratelimiter.EndpointConfig, error) {
+        if !conf.DisabledUntil.Equal(until) {
+            return conf, fmt.Errorf("endpoint %s was changed meanwhile", endpoint)
+        }
+        conf.DisabledUntil = time.Time{}
+        return conf, nil
+    })
+    if err != nil {
+        slog.Warn("Disabled endpoint not restored on expiry", "endpoint", endpoint, "error", err)
+        return
+    }
+    t.metrics.Count(MetricEndpointToggles, 1, metrics.Tag{Key: "endpoint", Value: endpoint}, metrics.Tag{Key: "action", Value: "expire"})
+    body, _ := json.Marshal(ToggleRequest{Endpoint: endpoint, Reason: "ttl expired"})
+    entry := AuditEntry{
+        Time:      t.now(),
+        Principal: Principal{Name: "endpoint-toggle", Method: "expiry"},
+        Method:    consts.MethodDelete,
+        Path:      path,
+        Status:    consts.StatusOK,
+        Body:      string(body),
+    }
+    if err := t.audit.Record(ctx, entry); err != nil {
+        slog.Error("Error recording admin audit entry", "error", err, "principal", entry.Principal.Name, "path", path)
+    }
+}
+
+// update applies the configuration with the endpoint changed by the function.
+func (t *EndpointToggle) update(ctx context.Context, endpoint string, change func(ratelimiter.EndpointConfig) (ratelimiter.EndpointConfig, error)) (int, error) {
+    current := t.limiter.Config()
+    conf, ok := current[endpoint]
+    if !ok {
+        return consts.StatusNotFound, fmt.Errorf("endpoint %s is not configured", endpoint)
+    }
+    conf, err := change(conf)
+    if err != nil {
+        return consts.StatusNotFound, err
+    }
+    config := maps.Clone(current)
+    config[endpoint] = conf
+    if err := t.apply(ctx, config); err != nil {
+        return consts.StatusInternalServerError, fmt.Errorf("failed to apply configuration: %w", err)
+    }
+    return consts.StatusOK, nil
+}
+
+// Close stops restoring the endpoints when they expire, their limits still apply again then.
+func (t *EndpointToggle) Close() {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    for endpoint, timer := range t.timers {
+        timer.Stop()
+        delete(t.timers, endpoint)
+    }
+}
@@ -0,0 +1,156 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "sync"
+    "testing"
+    "time"
+)
+
+// countingSink counts the toggles by action.
+type countingSink struct {
+    metrics.Sink
+    mu      sync.Mutex
+    actions map[string]int64
+}
+
+func (s *countingSink) Count(name string, value int64, tags ...metrics.Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    for _, tag := range tags {
+        if name == MetricEndpointToggles && tag.Key == "action" {
+            s.actions[tag.Value] += value
+        }
+    }
+}
+
+func (s *countingSink) count(action string) int64 {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.actions[action]
+}
+
+func newToggle(t *testing.T, opts ...ToggleOption) (*EndpointToggle, ratelimiter.RateLimiter) {
+    t.Helper()
+    limiter := ratelimiter.NewRateLimiter(ratelimiter.RateLimiterConfig{
+        "/api": {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+    }, ratelimiterstore.NewMemoryStore(), nil)
+    toggle := NewEndpointToggle(limiter, ToggleConfig{MaxTTL: time.Hour}, opts...)
+    t.Cleanup(func() {
+        toggle.Close()
+        _ = limiter.Close()
+    })
+    return toggle, limiter
+}
+
+func toggleRequest(toggle *EndpointToggle, method, body string) (int, []byte) {
+    c := app.NewContext(0)
+    c.Request.SetMethod(method)
+    c.Request.SetRequestURI("/admin/endpoints/disabled")
+    c.Request.SetBodyString(body)
+    toggle.Handler(context.Background(), c)
+    return c.Response.StatusCode(), c.Response.Body()
+}
+
+func TestEndpointToggle(t *testing.T) {
+    sink := &countingSink{actions: map[string]int64{}}
+    toggle, limiter := newToggle(t, WithToggleMetrics(sink))
+
+    if status, body := toggleRequest(toggle, "GET", ""); status != 200 || string(body) != "[]" {
+        t.Fatalf("GET: %d %s", status, body)
+    }
+    status, body := toggleRequest(toggle, "PUT", `{"endpoint":"/api","ttl_seconds":600,"reason":"MIG-42"}`)
+    var disabled DisabledEndpoint
+    if err := json.Unmarshal(body, &disabled); status != 200 || err != nil || time.Until(disabled.DisabledUntil) <= 9*time.Minute {
+        t.Fatalf("PUT: %d %s", status, body)
+    }
+    // The configuration of the endpoint is kept, only disabled
+    if conf := limiter.Config()["/api"]; !conf.Disabled(time.Now()) || conf.MaxRequests != 10 {
+        t.Fatalf("configuration %+v, disabled expected", conf)
+    }
+    var list []DisabledEndpoint
+    if status, body := toggleRequest(toggle, "GET", ""); status != 200 || json.Unmarshal(body, &list) != nil || len(list) != 1 || list[0].Endpoint != "/api" {
+        t.Fatalf("GET: %d %s", status, body)
+    }
+
+    for _, test := range []struct {
+        method, body string
+        status       int
+    }{
+        {"PUT", `{"endpoint":"/api","ttl_seconds":7200}`, 400},
+        {"PUT", `{"endpoint":"/api"}`, 400},
+        {"PUT", `{"endpoint":"/users","ttl_seconds":600}`, 404},
+        {"PUT", `{"ttl_seconds":600}`, 400},
+        {"POST", `{"endpoint":"/api","ttl_seconds":600}`, 405},
+        {"DELETE", `{"endpoint":"/api"}`, 200},
+        // Already restored
+        {"DELETE", `{"endpoint":"/api"}`, 404},
+    } {
+        if status, body := toggleRequest(toggle, test.method, test.body); status != test.status {
+            t.Fatalf("%s %s: %d %s, %d expected", test.method, test.body, status, body, test.status)
+        }
+    }
+    if limiter.Config()["/api"].Disabled(time.Now()) {
+        t.Fatalf("endpoint still disabled after DELETE")
+    }
+    if sink.count("disable") != 1 || sink.count("restore") != 1 {
+        t.Fatalf("toggles %v", sink.actions)
+    }
+}
+
+func TestEndpointToggleExpiry(t *testing.T) {
+    audit := &recordedAuditLog{}
+    sink := &countingSink{actions: map[string]int64{}}
+    toggle, limiter := newToggle(t, WithToggleAuditLog(audit), WithToggleMetrics(sink))
+    ctx := context.Background()
+
+    if _, _, err := toggle.Disable(ctx, "/api", 20*time.Millisecond, "/admin/endpoints/disabled"); err != nil {
+        t.Fatalf("Disable: %v", err)
+    }
+    deadline := time.Now().Add(5 * time.Second)
+    for sink.count("expire") == 0 {
+        if time.Now().After(deadline) {
+            t.Fatalf("endpoint not restored on expiry")
+        }
+        time.Sleep(time.Millisecond)
+    }
+    if !limiter.Config()["/api"].DisabledUntil.IsZero() {
+        t.Fatalf("DisabledUntil not cleared on expiry")
+    }
+    audit.mu.Lock()
+    entries := audit.entries
+    audit.mu.Unlock()
+    if len(entries) != 1 || entries[0].Method != "DELETE" || entries[0].Path != "/admin/endpoints/disabled" || entries[0].Principal.Method != "expiry" {
+        t.Fatalf("audit entries %+v, the restore expected", entries)
+    }
+
+    // Extending the ttl keeps the endpoint disabled past the first expiry
+    if _, _, err := toggle.Disable(ctx, "/api", 20*time.Millisecond, "/admin/endpoints/disabled"); err != nil {
+        t.Fatalf("Disable: %v", err)
+    }
+    if _, _, err := toggle.Disable(ctx, "/api", time.Hour, "/admin/endpoints/disabled"); err != nil {
+        t.Fatalf("Disable: %v", err)
+    }
+    time.Sleep(100 * time.Millisecond)
+    if !limiter.Config()["/api"].Disabled(time.Now()) || sink.count("expire") != 1 {
+        t.Fatalf("extended endpoint restored")
+    }
+}
+
+func TestEndpointToggleApplyFails(t *testing.T) {
+    toggle, _ := newToggle(t, WithToggleApply(func(context.Context, ratelimiter.RateLimiterConfig) error {
+        return errors.New("control plane unavailable")
+    }))
+    if status, body := toggleRequest(toggle, "PUT", `{"endpoint":"/api","ttl_seconds":600}`); status != 500 {
+        t.Fatalf("PUT: %d %s, 500 expected", status, body)
+    }
+    if len(toggle.Disabled()) != 0 {
+        t.Fatalf("endpoint disabled while the configuration failed to apply")
+    }
+}
@@ -0,0 +1,144 @@
+package admin
+
+import (
+    "context"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "net"
+    "net/netip"
+    "strings"
+    "time"
+)
+
+type GuardConfig struct {
+    // Limits of each client IP on the internal endpoints under each path, e.g. /admin covers /admin and /admin/keys
+    //
+    // Defaults to 60 requests per minute under each of /admin, /metrics and /debug if not specified
+    Limits ratelimiter.RateLimiterConfig `json:"limits,omitempty"`
+    // Allowlist of the IPs and CIDRs allowed to reach the internal endpoints, the other clients are answered 404 as if
+    // they didn't exist
+    //
+    // Defaults to the loopback and private networks if not specified
+    Allowlist []string `json:"allowlist,omitempty"`
+    // ForwardedFor reads the client IP from X-Forwarded-For, only for a service behind a proxy overwriting it, the
+    // remote address is used otherwise so the allowlist can't be bypassed with a forged header
+    ForwardedFor bool `json:"forwarded_for,omitempty"`
+}
+
+// defaultAllowlist are the loopback and private networks.
+var defaultAllowlist = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// InternalGuard protects the operational endpoints of a service, the admin API, the metrics and the debug handlers,
+// so they can't be used to overload the service or be scraped from outside: only the clients of the allowlist reach
+// them, each within a limit stricter than the ones of the API.
+type InternalGuard struct {
+    paths        []string
+    allowlist    []netip.Prefix
+    forwardedFor bool
+    limiter      ratelimiter.RateLimiter
+}
+
+// NewInternalGuard creates an InternalGuard counting the requests in a memory store of its own, so the operational
+// endpoints stay reachable while the store of the API fails. The options are passed to its rate limiter, e.g.
+// WithMetrics.
+func NewInternalGuard(config GuardConfig, opts ...ratelimiter.Option) (*InternalGuard, error) {
+    if len(config.Limits) == 0 {
+        limit := ratelimiter.EndpointConfig{MaxRequests: 60, TimeWindow: time.Minute, SlidingWindowInterval: 5 * time.Second}
+        config.Limits = ratelimiter.RateLimiterConfig{"/admin": limit, "/metrics": limit, "/debug": limit}
+    }
+    if err := config.Limits.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid internal limits: %w", err)
+    }
+    if len(config.Allowlist) == 0 {
+        config.Allowlist = defaultAllowlist
+    }
+    g := &InternalGuard{forwardedFor: config.ForwardedFor}
+    limits := make(ratelimiter.RateLimiterConfig, len(config.Limits))
+    for path, limit := range config.Limits {
+        path = strings.TrimSuffix(path, "/")
+        g.paths = append(g.paths, path)
+        limits[path] = limit
+    }
+    for _, entry := range config.Allowlist {
+        prefix, err := netip.ParsePrefix(entry)
+        if err != nil {
+            addr, addrErr := netip.ParseAddr(entry)
+            if addrErr != nil {
+                return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+            }
+            prefix = netip.PrefixFrom(addr, addr.BitLen())
+        }
+        g.allowlist = append(g.allowlist, prefix.Masked())
+    }
+    // Counted per the client IP of the allowlist, X-Forwarded-For would let a client spread its requests over
+    // made up IPs
+    opts = append(opts, ratelimiter.WithIdentity(func(_ context.Context, c *app.RequestContext) string {
+        return g.clientIP(c)
+    }))
+    g.limiter = ratelimiter.NewRateLimiter(limits, ratelimiterstore.NewMemoryStore(), g.endpoint, opts...)
+    return g, nil
+}
+
+// endpoint returns the internal path the request path is under, "" if it is not an internal endpoint.
+func (g *InternalGuard) endpoint(path []byte) string {
+    p := string(path)
+    for _, internal := range g.paths {
+        if p == internal || strings.HasPrefix(p, internal+"/") {
+            return internal
+        }
+    }
+    return ""
+}
+
+func (g *InternalGuard) clientIP(c *app.RequestContext) string {
+    if g.forwardedFor {
+        return c.ClientIP()
+    }
+    addr := c.RemoteAddr()
+    if addr == nil {
+        return ""
+    }
+    host, _, err := net.SplitHostPort(addr.String())
+    if err != nil {
+        return addr.String()
+    }
+    return host
+}
+
+func (g *InternalGuard) allowed(ip string) bool {
+    addr, err := netip.ParseAddr(ip)
+    if err != nil {
+        return false
+    }
+    addr = addr.Unmap()
+    for _, prefix := range g.allowlist {
+        if prefix.Contains(addr) {
+            return true
+        }
+    }
+    return false
+}
+
+// Middleware answers the requests to the internal endpoints from clients missing from the allowlist with 404, and
+// limits the others. It must run before the handlers of the internal endpoints, e.g. with h.Use, the other requests
+// are passed on untouched.
+func (g *InternalGuard) Middleware(ctx context.Context, c *app.RequestContext) {
+    if g.endpoint(c.Path()) == "" {
+        c.Next(ctx)
+        return
+    }
+    if !g.allowed(g.clientIP(c)) {
+        c.AbortWithStatusJSON(consts.StatusNotFound, utils.H{"error": "Not found"})
+        return
+    }
+    g.limiter.Middleware(ctx, c)
+}
+
+// Close closes the rate limiter of the guard.
+func (g *InternalGuard) Close() error {
+    return g.limiter.Close()
+}
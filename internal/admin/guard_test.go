@@ -0,0 +1,116 @@
+package admin
+
+import (
+    "context"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/network"
+    "net"
+    "testing"
+    "time"
+)
+
+// remoteConn is a connection from a client address, the only method the guard calls.
+type remoteConn struct {
+    network.Conn
+    addr net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr {
+    return c.addr
+}
+
+// guard runs the middleware of the guard on a request to the path from the client IP, and returns the status of the
+// response, 200 if the request was passed on.
+func guard(g *InternalGuard, ip, path string, headers ...string) int {
+    c := app.NewContext(0)
+    c.SetConn(remoteConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+    c.Request.SetRequestURI(path)
+    for i := 0; i+1 < len(headers); i += 2 {
+        c.Request.Header.Set(headers[i], headers[i+1])
+    }
+    g.Middleware(context.Background(), c)
+    return c.Response.StatusCode()
+}
+
+func TestInternalGuard(t *testing.T) {
+    g, err := NewInternalGuard(GuardConfig{
+        Limits: ratelimiter.RateLimiterConfig{
+            "/admin/": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+        },
+        Allowlist: []string{"10.0.0.0/8", "203.0.113.7"},
+    })
+    if err != nil {
+        t.Fatalf("NewInternalGuard: %v", err)
+    }
+    defer g.Close()
+
+    for _, test := range []struct {
+        ip, path string
+        headers  []string
+        status   int
+    }{
+        // The other requests are passed on untouched
+        {"198.51.100.1", "/api/users", nil, 200},
+        {"198.51.100.1", "/administrators", nil, 200},
+        // The internal endpoints don't exist for the clients missing from the allowlist
+        {"198.51.100.1", "/admin", nil, 404},
+        {"198.51.100.1", "/admin/keys", nil, 404},
+        {"198.51.100.1", "/admin/keys", []string{"X-Forwarded-For", "10.0.0.1"}, 404},
+        {"::ffff:10.0.0.1", "/admin/keys", nil, 200},
+        {"203.0.113.7", "/admin/keys", nil, 200},
+        {"203.0.113.8", "/admin/keys", nil, 404},
+        // Each client IP is limited on its own, whatever it forwards for
+        {"10.0.0.1", "/admin", []string{"X-Forwarded-For", "10.9.9.9"}, 200},
+        {"10.0.0.1", "/admin/quotas", []string{"X-Forwarded-For", "10.8.8.8"}, 429},
+        {"203.0.113.7", "/admin", nil, 200},
+        {"203.0.113.7", "/admin", nil, 429},
+    } {
+        if status := guard(g, test.ip, test.path, test.headers...); status != test.status {
+            t.Fatalf("%s from %s %v: %d, %d expected", test.path, test.ip, test.headers, status, test.status)
+        }
+    }
+}
+
+func TestInternalGuardDefaults(t *testing.T) {
+    g, err := NewInternalGuard(GuardConfig{})
+    if err != nil {
+        t.Fatalf("NewInternalGuard: %v", err)
+    }
+    defer g.Close()
+    for _, test := range []struct {
+        ip, path string
+        status   int
+    }{
+        {"127.0.0.1", "/metrics", 200},
+        {"192.168.1.10", "/debug/pprof/heap", 200},
+        {"::1", "/admin", 200},
+        {"8.8.8.8", "/metrics", 404},
+        {"8.8.8.8", "/debug/pprof/heap", 404},
+    } {
+        if status := guard(g, test.ip, test.path); status != test.status {
+            t.Fatalf("%s from %s: %d, %d expected", test.path, test.ip, status, test.status)
+        }
+    }
+}
+
+// Behind a proxy overwriting X-Forwarded-For, the client IP is read from it.
+func TestInternalGuardForwardedFor(t *testing.T) {
+    g, err := NewInternalGuard(GuardConfig{ForwardedFor: true, Allowlist: []string{"10.0.0.0/8"}})
+    if err != nil {
+        t.Fatalf("NewInternalGuard: %v", err)
+    }
+    defer g.Close()
+    if status := guard(g, "192.168.0.2", "/admin", "X-Forwarded-For", "10.0.0.1"); status != 200 {
+        t.Fatalf("forwarded for an allowed IP: %d, 200 expected", status)
+    }
+    if status := guard(g, "192.168.0.2", "/admin", "X-Forwarded-For", "198.51.100.1"); status != 404 {
+        t.Fatalf("forwarded for another IP: %d, 404 expected", status)
+    }
+}
+
+func TestNewInternalGuardRejectsBadAllowlist(t *testing.T) {
+    if _, err := NewInternalGuard(GuardConfig{Allowlist: []string{"10.0.0.0/33"}}); err == nil {
+        t.Fatalf("invalid allowlist entry accepted")
+    }
+}
@@ -0,0 +1,220 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "slices"
+    "strings"
+    "time"
+)
+
+// NotesKey is the key of the notes attached to the audit entry of a request in the request context, see AttachNotes.
+const NotesKey = "admin.notes"
+
+// KeyNote is a note of the operators on a key, e.g. "pentest vendor until Friday" or "VIP customer", kept alongside
+// its ban or exemption.
+type KeyNote struct {
+    // Key is the user id, as in the keys of the bans and exemptions
+    Key    string   `json:"key"`
+    Labels []string `json:"labels,omitempty"`
+    Note   string   `json:"note,omitempty"`
+    // Author is the principal who wrote the note
+    Author    string    `json:"author,omitempty"`
+    UpdatedAt time.Time `json:"updated_at"`
+    // ExpiresAt is when the note is deleted, the zero time if it is kept until deleted
+    ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+// NoteStore keeps the notes of the keys.
+type NoteStore interface {
+    // Get returns the note of the key, false if it has none
+    Get(ctx context.Context, key string) (KeyNote, bool, error)
+    // Set writes the note of its key, replacing the previous one
+    Set(ctx context.Context, note KeyNote) error
+    // Delete deletes the note of the key, if any
+    Delete(ctx context.Context, key string) error
+    // List returns the notes of all the keys, sorted by key
+    List(ctx context.Context) ([]KeyNote, error)
+}
+
+type redisNoteStore struct {
+    client    radix.Client
+    scanCount int
+}
+
+// NewRedisNoteStore creates a NoteStore keeping each note under ratelimiter.NotePrefix followed by its key, next to the
+// bans and exemptions. List scans the keys scanCount at a time.
+func NewRedisNoteStore(client radix.Client, scanCount int) NoteStore {
+    return &redisNoteStore{client: client, scanCount: scanCount}
+}
+
+func (s *redisNoteStore) Get(ctx context.Context, key string) (KeyNote, bool, error) {
+    var value []byte
+    maybe := radix.Maybe{Rcv: &value}
+    if err := s.client.Do(ctx, radix.Cmd(&maybe, "GET", ratelimiter.NotePrefix+key)); err != nil {
+        return KeyNote{}, false, fmt.Errorf("failed to get note %s: %w", key, err)
+    }
+    if maybe.Null {
+        return KeyNote{}, false, nil
+    }
+    var note KeyNote
+    if err := json.Unmarshal(value, &note); err != nil {
+        return KeyNote{}, false, fmt.Errorf("failed to decode note %s: %w", key, err)
+    }
+    return note, true, nil
+}
+
+func (s *redisNoteStore) Set(ctx context.Context, note KeyNote) error {
+    value, err := json.Marshal(note)
+    if err != nil {
+        return fmt.Errorf("failed to encode note %s: %w", note.Key, err)
+    }
+    args := []string{ratelimiter.NotePrefix + note.Key, string(value)}
+    if !note.ExpiresAt.IsZero() {
+        args = append(args, "PX", fmt.Sprint(max(time.Until(note.ExpiresAt).Milliseconds(), 1)))
+    }
+    if err := s.client.Do(ctx, radix.Cmd(nil, "SET", args...)); err != nil {
+        return fmt.Errorf("failed to set note %s: %w", note.Key, err)
+    }
+    return nil
+}
+
+func (s *redisNoteStore) Delete(ctx context.Context, key string) error {
+    if err := s.client.Do(ctx, radix.Cmd(nil, "DEL", ratelimiter.NotePrefix+key)); err != nil {
+        return fmt.Errorf("failed to delete note %s: %w", key, err)
+    }
+    return nil
+}
+
+func (s *redisNoteStore) List(ctx context.Context) ([]KeyNote, error) {
+    scanner := radix.ScannerConfig{Pattern: ratelimiter.NotePrefix + "*", Count: s.scanCount}.New(s.client)
+    var (
+        k     string
+        notes []KeyNote
+        found = make(map[string]struct{})
+    )
+    for scanner.Next(ctx, &k) {
+        key := strings.TrimPrefix(k, ratelimiter.NotePrefix)
+        if _, ok := found[key]; ok {
+            // A scan may return a key twice
+            continue
+        }
+        found[key] = struct{}{}
+        note, ok, err := s.Get(ctx, key)
+        if err != nil {
+            return nil, err
+        }
+        // Expired since it was scanned otherwise
+        if ok {
+            notes = append(notes, note)
+        }
+    }
+    if err := scanner.Close(); err != nil {
+        return nil, fmt.Errorf("failed to scan notes: %w", err)
+    }
+    slices.SortFunc(notes, func(a, b KeyNote) int {
+        return strings.Compare(a.Key, b.Key)
+    })
+    return notes, nil
+}
+
+// AttachNotes adds the notes to the audit entry of the request, e.g. the note of a key being banned or reset.
+func AttachNotes(c *app.RequestContext, notes ...KeyNote) {
+    attached, _ := c.Value(NotesKey).([]KeyNote)
+    c.Set(NotesKey, append(attached, notes...))
+}
+
+// AttachKeyNotes adds the notes of the keys a request acts on to its audit entry, so the entry tells e.g. that the key
+// reset belongs to a VIP customer. The keys without a note are skipped, and so are the notes that can't be read.
+func AttachKeyNotes(ctx context.Context, c *app.RequestContext, store NoteStore, keys ...string) {
+    for _, key := range keys {
+        note, ok, err := store.Get(ctx, key)
+        if err != nil {
+            slog.Error("Error reading note for the audit log", "key", key, "error", err)
+            continue
+        }
+        if ok {
+            AttachNotes(c, note)
+        }
+    }
+}
+
+// NoteRequest is the body of a request writing a note with PUT.
+type NoteRequest struct {
+    Key    string   `json:"key"`
+    Labels []string `json:"labels,omitempty"`
+    Note   string   `json:"note,omitempty"`
+    // TTLSeconds is how long the note is kept, e.g. as long as the exemption it explains
+    //
+    // Defaults to 0 if not specified, the note is kept until deleted
+    TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+}
+
+// NotesHandler serves the notes of a NoteStore behind an AccessControl, e.g. adminGroup.Any("/notes",
+// admin.NotesHandler(store)): GET lists them, or returns the one of the key query parameter, PUT writes one from a
+// NoteRequest, authored by the principal of the request, and DELETE deletes the one of the key query parameter. The
+// notes written and deleted are attached to the audit entries.
+func NotesHandler(store NoteStore) app.HandlerFunc {
+    return func(ctx context.Context, c *app.RequestContext) {
+        key := c.Query("key")
+        switch string(c.Method()) {
+        case consts.MethodGet:
+            if key == "" {
+                notes, err := store.List(ctx)
+                if err != nil {
+                    c.JSON(consts.StatusInternalServerError, utils.H{"error": err.Error()})
+                    return
+                }
+                c.JSON(consts.StatusOK, append([]KeyNote{}, notes...))
+                return
+            }
+            note, ok, err := store.Get(ctx, key)
+            switch {
+            case err != nil:
+                c.JSON(consts.StatusInternalServerError, utils.H{"error": err.Error()})
+            case !ok:
+                c.JSON(consts.StatusNotFound, utils.H{"error": "No note on the key"})
+            default:
+                c.JSON(consts.StatusOK, note)
+            }
+        case consts.MethodPut:
+            var req NoteRequest
+            if err := json.Unmarshal(c.Request.Body(), &req); err != nil || req.Key == "" || req.TTLSeconds < 0 {
+                c.JSON(consts.StatusBadRequest, utils.H{"error": "Expected a key, and a positive ttl_seconds if any"})
+                return
+            }
+            principal, _ := c.Value(PrincipalKey).(Principal)
+            note := KeyNote{Key: req.Key, Labels: req.Labels, Note: req.Note, Author: principal.Name, UpdatedAt: time.Now()}
+            if req.TTLSeconds > 0 {
+                note.ExpiresAt = note.UpdatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+            }
+            if err := store.Set(ctx, note); err != nil {
+                c.JSON(consts.StatusInternalServerError, utils.H{"error": err.Error()})
+                return
+            }
+            AttachNotes(c, note)
+            c.JSON(consts.StatusOK, note)
+        case consts.MethodDelete:
+            if key == "" {
+                c.JSON(consts.StatusBadRequest, utils.H{"error": "Expected a key"})
+                return
+            }
+            // The note deleted is recorded in the audit log
+            AttachKeyNotes(ctx, c, store, key)
+            if err := store.Delete(ctx, key); err != nil {
+                c.JSON(consts.StatusInternalServerError, utils.H{"error": err.Error()})
+                return
+            }
+            c.JSON(consts.StatusOK, utils.H{"key": key})
+        default:
+            c.JSON(consts.StatusMethodNotAllowed, utils.H{"error": "Expected GET, PUT or DELETE"})
+        }
+    }
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "github.com/mediocregopher/radix/v4"
+    "strings"
+    "testing"
+    "time"
+)
+
+func newNoteStore(t *testing.T) (NoteStore, *miniredis.Miniredis) {
+    t.Helper()
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    return NewRedisNoteStore(client, 10), mr
+}
+
+func TestRedisNoteStore(t *testing.T) {
+    store, mr := newNoteStore(t)
+    ctx := context.Background()
+    for _, note := range []KeyNote{
+        {Key: "user:grace", Note: "VIP customer"},
+        {Key: "ip:10.0.0.1", Labels: []string{"pentest"}, Note: "pentest vendor until Friday", ExpiresAt: time.Now().Add(time.Hour)},
+    } {
+        if err := store.Set(ctx, note); err != nil {
+            t.Fatalf("Set: %v", err)
+        }
+    }
+    // The notes are kept next to the bans and exemptions, until they expire
+    if ttl := mr.TTL(ratelimiter.NotePrefix + "ip:10.0.0.1"); ttl <= 59*time.Minute || ttl > time.Hour {
+        t.Fatalf("note kept for %s, an hour expected", ttl)
+    }
+    if ttl := mr.TTL(ratelimiter.NotePrefix + "user:grace"); ttl != 0 {
+        t.Fatalf("note without expiry kept for %s", ttl)
+    }
+    notes, err := store.List(ctx)
+    if err != nil || len(notes) != 2 || notes[0].Key != "ip:10.0.0.1" || notes[0].Labels[0] != "pentest" || notes[1].Key != "user:grace" {
+        t.Fatalf("List: %+v, %v, the notes sorted by key expected", notes, err)
+    }
+    if err := store.Delete(ctx, "user:grace"); err != nil {
+        t.Fatalf("Delete: %v", err)
+    }
+    if _, ok, err := store.Get(ctx, "user:grace"); ok || err != nil {
+        t.Fatalf("Get of a deleted note: %t, %v", ok, err)
+    }
+}
+
+func TestNotesHandler(t *testing.T) {
+    store, _ := newNoteStore(t)
+    audit := &recordedAuditLog{}
+    access := NewAccessControl([]Authenticator{NewStaticTokens(map[string]StaticToken{
+        "operator-token": {Name: "deploy-bot", Role: RoleOperator},
+    })}, WithAuditLog(audit))
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.Use(access.Middleware)
+    engine.Any("/admin/notes", NotesHandler(store))
+    request := func(method, path, body string) (int, []byte) {
+        var b *ut.Body
+        if body != "" {
+            b = &ut.Body{Body: strings.NewReader(body), Len: len(body)}
+        }
+        resp := ut.PerformRequest(engine, method, path, b, ut.Header{Key: "Authorization", Value: "Bearer operator-token"}).Result()
+        return resp.StatusCode(), resp.Body()
+    }
+
+    status, body := request("PUT", "/admin/notes", `{"key":"ip:10.0.0.1","labels":["pentest"],"note":"pentest vendor","ttl_seconds":3600}`)
+    var note KeyNote
+    if err := json.Unmarshal(body, &note); status != 200 || err != nil || note.Author != "deploy-bot" || time.Until(note.ExpiresAt) <= 59*time.Minute {
+        t.Fatalf("PUT: %d %s", status, body)
+    }
+    if status, body := request("GET", "/admin/notes?key=ip:10.0.0.1", ""); status != 200 || !strings.Contains(string(body), "pentest vendor") {
+        t.Fatalf("GET: %d %s", status, body)
+    }
+    if status, body := request("GET", "/admin/notes", ""); status != 200 || !strings.HasPrefix(string(body), `[{"key":"ip:10.0.0.1"`) {
+        t.Fatalf("GET of the list: %d %s", status, body)
+    }
+    for _, test := range []struct {
+        method, path, body string
+        status             int
+    }{
+        {"GET", "/admin/notes?key=user:grace", "", 404},
+        {"PUT", "/admin/notes", `{"note":"no key"}`, 400},
+        {"PUT", "/admin/notes", `{"key":"user:grace","ttl_seconds":-1}`, 400},
+        {"DELETE", "/admin/notes", "", 400},
+        {"DELETE", "/admin/notes?key=ip:10.0.0.1", "", 200},
+        {"GET", "/admin/notes?key=ip:10.0.0.1", "", 404},
+    } {
+        if status, body := request(test.method, test.path, test.body); status != test.status {
+            t.Fatalf("%s %s: %d %s, %d expected", test.method, test.path, status, body, test.status)
+        }
+    }
+
+    // The notes written and deleted are in the audit log
+    var noted []string
+    for _, entry := range audit.entries {
+        if entry.Status == 200 {
+            for _, n := range entry.Notes {
+                noted = append(noted, entry.Method+" "+n.Note)
+            }
+        }
+    }
+    if strings.Join(noted, ", ") != "PUT pentest vendor, DELETE pentest vendor" {
+        t.Fatalf("notes audited %q", noted)
+    }
+}
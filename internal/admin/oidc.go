@@ -0,0 +1,98 @@
+package admin
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/jwt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strings"
+    "time"
+)
+
+type OIDCConfig struct {
+    // Issuer of the tokens, its keys are found from its /.well-known/openid-configuration document
+    Issuer string `json:"issuer"`
+    // Audience the tokens must be issued for, e.g. the client id of the admin console
+    Audience string `json:"audience"`
+    // NameClaim is the claim naming the caller in the audit log
+    //
+    // Defaults to email if not specified
+    NameClaim string `json:"name_claim,omitempty"`
+    // RolesClaim is the claim holding the groups of the caller, a string or a list of strings
+    //
+    // Defaults to groups if not specified
+    RolesClaim string `json:"roles_claim,omitempty"`
+    // Roles maps the groups to their roles, a caller gets the highest role of its groups
+    Roles map[string]Role `json:"roles"`
+    // KeysTTL is how long the keys of the issuer are cached, they are fetched again earlier for a token signed with an
+    // unknown key
+    //
+    // Defaults to 1 hour if not specified
+    KeysTTL time.Duration `json:"keys_ttl,omitempty"`
+    // Leeway accepted on the expiry and the not before time of the tokens, for the clock skew with the issuer
+    //
+    // Defaults to 1 minute if not specified
+    Leeway time.Duration `json:"leeway,omitempty"`
+    // Timeout of the requests to the issuer
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type oidc struct {
+    config   OIDCConfig
+    verifier *jwt.Verifier
+}
+
+// NewOIDC creates an Authenticator of the OpenID Connect tokens of the issuer sent as bearer tokens, e.g. the ID tokens
+// of the operators signed in to an admin console. RS256, RS384, RS512, ES256, ES384 and ES512 signatures are supported.
+// Bearer tokens that are not JWTs are left to the other authenticators.
+func NewOIDC(config OIDCConfig) Authenticator {
+    config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+    if config.NameClaim == "" {
+        config.NameClaim = "email"
+    }
+    if config.RolesClaim == "" {
+        config.RolesClaim = "groups"
+    }
+    return &oidc{
+        config: config,
+        verifier: jwt.NewVerifier(jwt.Config{
+            Issuer:   config.Issuer,
+            Audience: config.Audience,
+            KeysTTL:  config.KeysTTL,
+            Leeway:   config.Leeway,
+            Timeout:  config.Timeout,
+        }),
+    }
+}
+
+func (o *oidc) Authenticate(ctx context.Context, c *app.RequestContext) (Principal, bool, error) {
+    token := bearerToken(c)
+    if strings.Count(token, ".") != 2 {
+        return Principal{}, false, nil
+    }
+    if o.config.Audience == "" {
+        // The tokens issued for any other client of the issuer would be accepted
+        return Principal{}, true, fmt.Errorf("%w: no audience configured", ErrInvalidCredentials)
+    }
+    claims, err := o.verifier.Verify(ctx, token)
+    if errors.Is(err, jwt.ErrInvalidToken) {
+        return Principal{}, true, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+    }
+    if err != nil {
+        return Principal{}, true, err
+    }
+    name, _ := claims[o.config.NameClaim].(string)
+    if name == "" {
+        name, _ = claims["sub"].(string)
+    }
+    principal := Principal{Name: name, Method: "oidc"}
+    for _, group := range jwt.StringsClaim(claims[o.config.RolesClaim]) {
+        if role := o.config.Roles[group]; role.rank() > principal.Role.rank() {
+            principal.Role = role
+        }
+    }
+    return principal, true, nil
+}
@@ -0,0 +1,109 @@
+package admin
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// issuer serves the discovery document and the key set of an ES256 key, and signs tokens with it.
+type issuer struct {
+    server *httptest.Server
+    key    *ecdsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    i := &issuer{key: key}
+    encode := base64.RawURLEncoding.EncodeToString
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string]string{"issuer": i.server.URL, "jwks_uri": i.server.URL + "/keys"})
+    })
+    mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string][]map[string]string{"keys": {{
+            "kty": "EC", "kid": "ec", "crv": "P-256", "use": "sig",
+            "x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32))),
+        }}})
+    })
+    i.server = httptest.NewServer(mux)
+    t.Cleanup(i.server.Close)
+    return i
+}
+
+func (i *issuer) token(t *testing.T, claims map[string]any) string {
+    t.Helper()
+    claims["iss"] = i.server.URL
+    claims["exp"] = time.Now().Add(time.Hour).Unix()
+    header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec", "typ": "JWT"})
+    payload, _ := json.Marshal(claims)
+    input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+    digest := sha256.Sum256([]byte(input))
+    r, s, err := ecdsa.Sign(rand.Reader, i.key, digest[:])
+    if err != nil {
+        t.Fatalf("Sign: %v", err)
+    }
+    return input + "." + base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+}
+
+func authenticate(authenticator Authenticator, token string) (Principal, bool, error) {
+    c := app.NewContext(0)
+    c.Request.Header.Set("Authorization", "Bearer "+token)
+    return authenticator.Authenticate(context.Background(), c)
+}
+
+func TestOIDC(t *testing.T) {
+    i := newIssuer(t)
+    oidc := NewOIDC(OIDCConfig{
+        Issuer:   i.server.URL + "/",
+        Audience: "admin-console",
+        Roles:    map[string]Role{"viewers": RoleReader, "sre": RoleOperator},
+    })
+    for _, test := range []struct {
+        name   string
+        claims map[string]any
+        want   Principal
+    }{
+        {"highest role of the groups", map[string]any{"aud": "admin-console", "sub": "42", "email": "ada@example.com", "groups": []string{"viewers", "sre"}},
+            Principal{Name: "ada@example.com", Role: RoleOperator, Method: "oidc"}},
+        {"single group", map[string]any{"aud": "admin-console", "sub": "42", "email": "ada@example.com", "groups": "viewers"},
+            Principal{Name: "ada@example.com", Role: RoleReader, Method: "oidc"}},
+        {"no email", map[string]any{"aud": []string{"admin-console"}, "sub": "42", "groups": []string{"unknown"}},
+            Principal{Name: "42", Method: "oidc"}},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            principal, ok, err := authenticate(oidc, i.token(t, test.claims))
+            if err != nil || !ok || principal != test.want {
+                t.Fatalf("Authenticate: %+v, %t, %v, %+v expected", principal, ok, err, test.want)
+            }
+        })
+    }
+
+    // A token issued for another client of the issuer
+    if _, ok, err := authenticate(oidc, i.token(t, map[string]any{"aud": "billing", "sub": "42"})); !ok || !errors.Is(err, ErrInvalidCredentials) {
+        t.Fatalf("other audience: %t, %v, ErrInvalidCredentials expected", ok, err)
+    }
+    // The opaque tokens are left to the other authenticators
+    if _, ok, err := authenticate(oidc, "operator-token"); ok || err != nil {
+        t.Fatalf("opaque token: %t, %v, not found expected", ok, err)
+    }
+    // Without an audience, the tokens of every client of the issuer would be accepted
+    noAudience := NewOIDC(OIDCConfig{Issuer: i.server.URL, Roles: map[string]Role{"sre": RoleOperator}})
+    if _, _, err := authenticate(noAudience, i.token(t, map[string]any{"aud": "billing", "sub": "42", "groups": "sre"})); !errors.Is(err, ErrInvalidCredentials) {
+        t.Fatalf("no audience configured: %v, ErrInvalidCredentials expected", err)
+    }
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "github.com/mediocregopher/radix/v4"
+    "golang.org/x/sync/singleflight"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+var ErrInactiveToken = errors.New("token is not active")
+
+// IntrospectionKey is the key of the Introspection of the request token in the request context, set by the middleware.
+const IntrospectionKey = "auth.introspection"
+
+type IntrospectionConfig struct {
+    // URL of the RFC 7662 introspection endpoint of the authorization server
+    URL string `json:"url"`
+    // ClientID and ClientSecret authenticate the resource server to the endpoint with HTTP basic authentication
+    ClientID     string `json:"client_id"`
+    ClientSecret string `json:"client_secret"`
+    // CacheTTL is the longest an active token is cached, it is never cached beyond its expiry
+    //
+    // Defaults to 5 minutes if not specified
+    CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+    // NegativeTTL is how long an inactive token is cached, so clients retrying a revoked token don't reach the endpoint
+    //
+    // Defaults to 30 seconds if not specified
+    NegativeTTL time.Duration `json:"negative_ttl,omitempty"`
+    // Timeout of an introspection, the instances waiting for another one to introspect the same token wait as long
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+    // KeyPrefix of the cached introspections in Redis, the tokens are hashed into the keys
+    //
+    // Defaults to auth:introspection: if not specified
+    KeyPrefix string `json:"key_prefix,omitempty"`
+}
+
+// Introspection is the response of the introspection endpoint, with the members used to identify the caller.
+type Introspection struct {
+    Active    bool   `json:"active"`
+    Subject   string `json:"sub,omitempty"`
+    ClientID  string `json:"client_id,omitempty"`
+    Username  string `json:"username,omitempty"`
+    Scope     string `json:"scope,omitempty"`
+    ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+type Introspector struct {
+    client radix.Client
+    http   *http.Client
+    config IntrospectionConfig
+    group  singleflight.Group // Concurrent introspections of a token in this instance
+}
+
+// NewIntrospector creates an Introspector validating opaque tokens at the introspection endpoint, with the results
+// cached in Redis and shared by the instances.
+//
+// A token missing from the cache is introspected once: the requests of an instance wait for the same introspection,
+// and the instances wait for the one holding a short lock on the token to cache the result, so a popular token
+// expiring doesn't send a burst of introspections to the authorization server. The cache is best effort, the tokens
+// are introspected directly while Redis fails.
+func NewIntrospector(client radix.Client, config IntrospectionConfig) *Introspector {
+    if config.CacheTTL == 0 {
+        config.CacheTTL = 5 * time.Minute
+    }
+    if config.NegativeTTL == 0 {
+        config.NegativeTTL = 30 * time.Second
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 5 * time.Second
+    }
+    if config.KeyPrefix == "" {
+        config.KeyPrefix = "auth:introspection:"
+    }
+    return &Introspector{
+        client: client,
+        http:   &http.Client{Timeout: config.Timeout},
+        config: config,
+    }
+}
+
+// Introspect returns the introspection of the token, or ErrInactiveToken if it is not active.
+func (i *Introspector) Introspect(ctx context.Context, token string) (Introspection, error) {
+    sum := sha256.Sum256([]byte(token))
+    key := i.config.KeyPrefix + hex.EncodeToString(sum[:])
+    v, err, _ := i.group.Do(key, func() (any, error) {
+        // Shared by the waiting requests, so not cancelled with the request that started it
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*i.config.Timeout)
+        defer cancel()
+        return i.introspect(ctx, key, token)
+    })
+    if err != nil {
+        return Introspection{}, err
+    }
+    result := v.(Introspection)
+    if !result.Active {
+        return result, ErrInactiveToken
+    }
+    return result, nil
+}
+
+func (i *Introspector) introspect(ctx context.Context, key, token string) (Introspection, error) {
+    // Redis gets one Timeout, so the introspection keeps the other while Redis hangs
+    redisCtx, cancel := context.WithTimeout(ctx, i.config.Timeout)
+    defer cancel()
+    result, ok, err := i.cached(redisCtx, key)
+    if ok {
+        return result, nil
+    }
+    if err != nil {
+        // The cache is best effort, the token is introspected directly while Redis fails
+        return i.fetch(ctx, token)
+    }
+    lock := key + ":lock"
+    var locked string
+    if err := i.client.Do(redisCtx, radix.FlatCmd(&locked, "SET", lock, 1, "NX", "PX", i.config.Timeout.Milliseconds())); err != nil {
+        slog.Warn("Error locking token introspection", "error", err)
+        return i.fetch(ctx, token)
+    } else if locked == "" {
+        // Another instance introspects the token, wait for its result
+        if result, ok := i.await(redisCtx, key); ok {
+            return result, nil
+        }
+    } else {
+        defer func() {
+            if err := i.client.Do(ctx, radix.Cmd(nil, "DEL", lock)); err != nil {
+                slog.Warn("Error unlocking token introspection", "error", err)
+            }
+        }()
+    }
+    if result, err = i.fetch(ctx, token); err != nil {
+        return Introspection{}, err
+    }
+    i.cache(ctx, key, result)
+    return result, nil
+}
+
+// cached returns the cached introspection of the token, and the error of Redis.
+func (i *Introspector) cached(ctx context.Context, key string) (Introspection, bool, error) {
+    var data []byte
+    maybe := radix.Maybe{Rcv: &data}
+    if err := i.client.Do(ctx, radix.Cmd(&maybe, "GET", key)); err != nil {
+        slog.Warn("Error reading cached token introspection", "error", err)
+        return Introspection{}, false, err
+    }
+    var result Introspection
+    if maybe.Null || json.Unmarshal(data, &result) != nil {
+        return Introspection{}, false, nil
+    }
+    return result, true, nil
+}
+
+// await polls the cache until the instance holding the lock cached the introspection, or the lock times out.
+func (i *Introspector) await(ctx context.Context, key string) (Introspection, bool) {
+    ticker := time.NewTicker(50 * time.Millisecond)
+    defer ticker.Stop()
+    timeout := time.After(i.config.Timeout)
+    for {
+        select {
+        case <-ctx.Done():
+            return Introspection{}, false
+        case <-timeout:
+            return Introspection{}, false
+        case <-ticker.C:
+        }
+        if result, ok, _ := i.cached(ctx, key); ok {
+            return result, true
+        }
+    }
+}
+
+func (i *Introspector) cache(ctx context.Context, key string, result Introspection) {
+    ttl := i.config.NegativeTTL
+    if result.Active {
+        ttl = i.config.CacheTTL
+        if result.ExpiresAt != 0 {
+            ttl = min(ttl, time.Until(time.Unix(result.ExpiresAt, 0)))
+        }
+    }
+    if ttl < time.Millisecond {
+        return
+    }
+    data, err := json.Marshal(result)
+    if err != nil {
+        return
+    }
+    if err = i.client.Do(ctx, radix.FlatCmd(nil, "SET", key, data, "PX", ttl.Milliseconds())); err != nil {
+        slog.Warn("Error caching token introspection", "error", err)
+    }
+}
+
+// fetch introspects the token at the endpoint.
+func (i *Introspector) fetch(ctx context.Context, token string) (Introspection, error) {
+    form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.config.URL, strings.NewReader(form.Encode()))
+    if err != nil {
+        return Introspection{}, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    req.Header.Set("Accept", "application/json")
+    if i.config.ClientID != "" {
+        req.SetBasicAuth(url.QueryEscape(i.config.ClientID), url.QueryEscape(i.config.ClientSecret))
+    }
+    resp, err := i.http.Do(req)
+    if err != nil {
+        return Introspection{}, fmt.Errorf("failed to introspect token: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return Introspection{}, fmt.Errorf("failed to introspect token: unexpected status %s", resp.Status)
+    }
+    var result Introspection
+    if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+        return Introspection{}, fmt.Errorf("failed to parse token introspection: %w", err)
+    }
+    if result.Active && result.ExpiresAt != 0 && !time.Now().Before(time.Unix(result.ExpiresAt, 0)) {
+        result.Active = false
+    }
+    return result, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header, "" if there is none.
+func bearerToken(c *app.RequestContext) string {
+    scheme, token, ok := strings.Cut(string(c.GetHeader("Authorization")), " ")
+    if !ok || !strings.EqualFold(scheme, "Bearer") {
+        return ""
+    }
+    return strings.TrimSpace(token)
+}
+
+// Middleware rejects the requests without an active bearer token with 401, and with 503 when the token can't be
+// introspected. The introspection of an accepted token is set under IntrospectionKey.
+func (i *Introspector) Middleware(ctx context.Context, c *app.RequestContext) {
+    token := bearerToken(c)
+    if token == "" {
+        c.Header("WWW-Authenticate", `Bearer`)
+        c.AbortWithStatusJSON(consts.StatusUnauthorized, utils.H{"error": "Missing bearer token"})
+        return
+    }
+    start := time.Now()
+    result, err := i.Introspect(ctx, token)
+    servertiming.Since(c, servertiming.StageAuth, start)
+    switch {
+    case errors.Is(err, ErrInactiveToken):
+        c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+        c.AbortWithStatusJSON(consts.StatusUnauthorized, utils.H{"error": "Invalid token"})
+        return
+    case err != nil:
+        slog.Error("Error introspecting token", "error", err)
+        c.AbortWithStatusJSON(consts.StatusServiceUnavailable, utils.H{"error": "Authorization server unavailable"})
+        return
+    }
+    c.Set(IntrospectionKey, result)
+    c.Next(ctx)
+}
+
+// Identity returns the subject of the bearer token, or its client for the tokens of the client credentials grant, ""
+// without an active token. It matches ratelimiter.IdentityFunc, e.g. ratelimiter.WithIdentity(introspector.Identity),
+// and reuses the introspection of the middleware.
+func (i *Introspector) Identity(ctx context.Context, c *app.RequestContext) string {
+    result, ok := c.Value(IntrospectionKey).(Introspection)
+    if !ok {
+        token := bearerToken(c)
+        if token == "" {
+            return ""
+        }
+        var err error
+        if result, err = i.Introspect(ctx, token); err != nil {
+            return ""
+        }
+    }
+    if result.Subject != "" {
+        return result.Subject
+    }
+    return result.ClientID
+}
@@ -0,0 +1,199 @@
+package auth
+
+import (
+    "context"
+    "errors"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "github.com/mediocregopher/radix/v4"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// authorizationServer introspects the tokens of its map, and counts the introspections.
+type authorizationServer struct {
+    *httptest.Server
+    calls  atomic.Int64
+    delay  time.Duration
+    tokens map[string]string
+}
+
+func newAuthorizationServer(t *testing.T, tokens map[string]string) *authorizationServer {
+    t.Helper()
+    s := &authorizationServer{tokens: tokens}
+    s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        s.calls.Add(1)
+        time.Sleep(s.delay)
+        if id, secret, ok := r.BasicAuth(); !ok || id != "gateway" || secret != "s3cret" {
+            w.WriteHeader(http.StatusUnauthorized)
+            return
+        }
+        response, ok := s.tokens[r.PostFormValue("token")]
+        if !ok {
+            response = `{"active":false}`
+        }
+        _, _ = w.Write([]byte(response))
+    }))
+    t.Cleanup(s.Close)
+    return s
+}
+
+func newIntrospector(t *testing.T, server *authorizationServer) (*Introspector, *miniredis.Miniredis) {
+    t.Helper()
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    return NewIntrospector(client, IntrospectionConfig{URL: server.URL, ClientID: "gateway", ClientSecret: "s3cret", Timeout: time.Second}), mr
+}
+
+func TestIntrospector(t *testing.T) {
+    server := newAuthorizationServer(t, map[string]string{
+        "user-token":    `{"active":true,"sub":"ada","scope":"orders:read"}`,
+        "client-token":  `{"active":true,"client_id":"billing"}`,
+        "expired-token": `{"active":true,"sub":"ada","exp":1}`,
+    })
+    introspector, mr := newIntrospector(t, server)
+    ctx := context.Background()
+
+    result, err := introspector.Introspect(ctx, "user-token")
+    if err != nil || result.Subject != "ada" || result.Scope != "orders:read" {
+        t.Fatalf("Introspect: %+v, %v", result, err)
+    }
+    // The introspection is cached, the token is hashed into the key
+    if _, err := introspector.Introspect(ctx, "user-token"); err != nil || server.calls.Load() != 1 {
+        t.Fatalf("Introspect of a cached token: %v, %d introspections", err, server.calls.Load())
+    }
+    for _, key := range mr.Keys() {
+        if len(key) != len("auth:introspection:")+64 {
+            t.Fatalf("key %s, the hash of the token expected", key)
+        }
+    }
+
+    // The inactive tokens are cached too
+    for range 2 {
+        if _, err := introspector.Introspect(ctx, "revoked-token"); !errors.Is(err, ErrInactiveToken) {
+            t.Fatalf("Introspect of a revoked token: %v, ErrInactiveToken expected", err)
+        }
+    }
+    if server.calls.Load() != 2 {
+        t.Fatalf("%d introspections, the revoked token must be cached", server.calls.Load())
+    }
+    if _, err := introspector.Introspect(ctx, "expired-token"); !errors.Is(err, ErrInactiveToken) {
+        t.Fatalf("Introspect of an expired token: %v, ErrInactiveToken expected", err)
+    }
+}
+
+func TestIntrospectorCachesUntilTheExpiry(t *testing.T) {
+    exp := time.Now().Add(10 * time.Second).Unix()
+    server := newAuthorizationServer(t, map[string]string{
+        "expiring-token": `{"active":true,"sub":"ada","exp":` + strconv.FormatInt(exp, 10) + `}`,
+    })
+    introspector, mr := newIntrospector(t, server)
+    if _, err := introspector.Introspect(context.Background(), "expiring-token"); err != nil {
+        t.Fatalf("Introspect: %v", err)
+    }
+    keys := mr.Keys()
+    if len(keys) != 1 {
+        t.Fatalf("keys %v, the cached introspection expected", keys)
+    }
+    if ttl := mr.TTL(keys[0]); ttl <= 0 || ttl > 10*time.Second {
+        t.Fatalf("cached for %s, at most until the expiry of the token expected", ttl)
+    }
+}
+
+func TestIntrospectorIntrospectsOnce(t *testing.T) {
+    server := newAuthorizationServer(t, map[string]string{"user-token": `{"active":true,"sub":"ada"}`})
+    server.delay = 100 * time.Millisecond
+    // Two instances sharing the cache
+    first, mr := newIntrospector(t, server)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    defer client.Close()
+    second := NewIntrospector(client, first.config)
+
+    var wg sync.WaitGroup
+    for i := range 20 {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            introspector := first
+            if i%2 == 1 {
+                introspector = second
+            }
+            if result, err := introspector.Introspect(context.Background(), "user-token"); err != nil || result.Subject != "ada" {
+                t.Errorf("Introspect: %+v, %v", result, err)
+            }
+        }()
+    }
+    wg.Wait()
+    if calls := server.calls.Load(); calls != 1 {
+        t.Fatalf("%d introspections, 1 expected", calls)
+    }
+}
+
+func TestIntrospectorWithoutRedis(t *testing.T) {
+    server := newAuthorizationServer(t, map[string]string{"user-token": `{"active":true,"sub":"ada"}`})
+    introspector, mr := newIntrospector(t, server)
+    mr.Close()
+    // The cache is best effort
+    if result, err := introspector.Introspect(context.Background(), "user-token"); err != nil || result.Subject != "ada" {
+        t.Fatalf("Introspect while Redis is down: %+v, %v", result, err)
+    }
+}
+
+func TestIntrospectorMiddleware(t *testing.T) {
+    server := newAuthorizationServer(t, map[string]string{
+        "user-token":   `{"active":true,"sub":"ada"}`,
+        "client-token": `{"active":true,"client_id":"billing"}`,
+    })
+    introspector, _ := newIntrospector(t, server)
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.GET("/orders", introspector.Middleware, func(ctx context.Context, c *app.RequestContext) {
+        c.String(200, introspector.Identity(ctx, c))
+    })
+    for _, test := range []struct {
+        authorization, wwwAuthenticate string
+        status                         int
+        body                           string
+    }{
+        {"", "Bearer", 401, ""},
+        {"Basic user-token", "Bearer", 401, ""},
+        {"Bearer revoked-token", `Bearer error="invalid_token"`, 401, ""},
+        {"Bearer user-token", "", 200, "ada"},
+        // The tokens of the client credentials grant identify the client
+        {"bearer client-token", "", 200, "billing"},
+    } {
+        var headers []ut.Header
+        if test.authorization != "" {
+            headers = append(headers, ut.Header{Key: "Authorization", Value: test.authorization})
+        }
+        resp := ut.PerformRequest(engine, "GET", "/orders", nil, headers...).Result()
+        if resp.StatusCode() != test.status || (test.body != "" && string(resp.Body()) != test.body) ||
+            string(resp.Header.Peek("WWW-Authenticate")) != test.wwwAuthenticate {
+            t.Fatalf("%q: %d %s %q, %d %s %q expected", test.authorization, resp.StatusCode(), resp.Body(),
+                resp.Header.Peek("WWW-Authenticate"), test.status, test.body, test.wwwAuthenticate)
+        }
+    }
+
+    // The authorization server rejects the credentials of the gateway
+    introspector.config.ClientSecret = "wrong"
+    resp := ut.PerformRequest(engine, "GET", "/orders", nil, ut.Header{Key: "Authorization", Value: "Bearer other-token"}).Result()
+    if resp.StatusCode() != 503 {
+        t.Fatalf("introspection failed: %d, 503 expected", resp.StatusCode())
+    }
+}
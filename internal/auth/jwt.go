@@ -0,0 +1,102 @@
+package auth
+
+import (
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/jwt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strconv"
+    "time"
+)
+
+// ErrInvalidToken is wrapped by the errors of the tokens that are not valid.
+var ErrInvalidToken = jwt.ErrInvalidToken
+
+// ClaimsKey is the key of the claims of the verified JWT in the request context, set by JWTVerifier.Key.
+const ClaimsKey = "auth.claims"
+
+type JWTConfig struct {
+    // JWKSURL is the URL of the JSON Web Key Set the tokens are signed with
+    JWKSURL string `json:"jwks_url"`
+    // Issuer the tokens must be issued by
+    //
+    // Defaults to any issuer if not specified
+    Issuer string `json:"issuer,omitempty"`
+    // Audience the tokens must be issued for
+    //
+    // Defaults to any audience if not specified
+    Audience string `json:"audience,omitempty"`
+    // Claim identifying the caller, e.g. tenant_id to count the requests per tenant
+    //
+    // Defaults to sub if not specified
+    Claim string `json:"claim,omitempty"`
+    // KeysTTL is how long the keys are cached, they are fetched again earlier for a token signed with an unknown key
+    //
+    // Defaults to 1 hour if not specified
+    KeysTTL time.Duration `json:"keys_ttl,omitempty"`
+    // Leeway accepted on the expiry and the not before time of the tokens, for the clock skew with the issuer
+    //
+    // Defaults to 1 minute if not specified
+    Leeway time.Duration `json:"leeway,omitempty"`
+    // Timeout of the requests fetching the keys
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type JWTVerifier struct {
+    config   JWTConfig
+    verifier *jwt.Verifier
+}
+
+// NewJWTVerifier creates a JWTVerifier of the JWTs signed with the keys of the key set, sent as bearer tokens. RS256,
+// RS384, RS512, ES256, ES384 and ES512 signatures are supported.
+func NewJWTVerifier(config JWTConfig) *JWTVerifier {
+    if config.Claim == "" {
+        config.Claim = "sub"
+    }
+    return &JWTVerifier{
+        config: config,
+        verifier: jwt.NewVerifier(jwt.Config{
+            JWKSURL:  config.JWKSURL,
+            Issuer:   config.Issuer,
+            Audience: config.Audience,
+            KeysTTL:  config.KeysTTL,
+            Leeway:   config.Leeway,
+            Timeout:  config.Timeout,
+        }),
+    }
+}
+
+// Key returns the claim of the bearer token identifying the caller, "" without a bearer token, and an error wrapping
+// ErrInvalidToken if the token is not valid or has no such claim. It matches ratelimiter.KeyExtractor, e.g.
+// ratelimiter.WithKeyExtractor(verifier.Key), so the requests with an invalid token are answered with 401. The claims
+// of the token are set under ClaimsKey for the next handlers.
+func (v *JWTVerifier) Key(ctx context.Context, c *app.RequestContext) (string, error) {
+    claims, ok := c.Value(ClaimsKey).(map[string]any)
+    if !ok {
+        token := bearerToken(c)
+        if token == "" {
+            return "", nil
+        }
+        var err error
+        if claims, err = v.Verify(ctx, token); err != nil {
+            return "", err
+        }
+        c.Set(ClaimsKey, claims)
+    }
+    switch claim := claims[v.config.Claim].(type) {
+    case string:
+        if claim != "" {
+            return claim, nil
+        }
+    case float64:
+        return strconv.FormatFloat(claim, 'f', -1, 64), nil
+    }
+    return "", fmt.Errorf("%w: no %s claim", ErrInvalidToken, v.config.Claim)
+}
+
+// Verify checks the signature and the registered claims of the token, and returns its claims.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (map[string]any, error) {
+    return v.verifier.Verify(ctx, token)
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// issuer serves the key set of an ES256 key, and signs tokens with it.
+type issuer struct {
+    server *httptest.Server
+    key    *ecdsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    encode := base64.RawURLEncoding.EncodeToString
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string][]map[string]string{"keys": {{
+            "kty": "EC", "kid": "ec", "crv": "P-256", "use": "sig",
+            "x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32))),
+        }}})
+    }))
+    t.Cleanup(server.Close)
+    return &issuer{server: server, key: key}
+}
+
+func (i *issuer) token(t *testing.T, claims map[string]any) string {
+    t.Helper()
+    claims["exp"] = time.Now().Add(time.Hour).Unix()
+    header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec", "typ": "JWT"})
+    payload, _ := json.Marshal(claims)
+    input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+    digest := sha256.Sum256([]byte(input))
+    r, s, err := ecdsa.Sign(rand.Reader, i.key, digest[:])
+    if err != nil {
+        t.Fatalf("Sign: %v", err)
+    }
+    return input + "." + base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+}
+
+func TestJWTVerifierKey(t *testing.T) {
+    i := newIssuer(t)
+    verifier := NewJWTVerifier(JWTConfig{JWKSURL: i.server.URL, Claim: "tenant_id"})
+    key := func(authorization string) (string, error) {
+        c := app.NewContext(0)
+        if authorization != "" {
+            c.Request.Header.Set("Authorization", authorization)
+        }
+        return verifier.Key(context.Background(), c)
+    }
+
+    for _, test := range []struct {
+        name          string
+        authorization string
+        key           string
+        err           bool
+    }{
+        {"no token", "", "", false},
+        {"basic credentials", "Basic YWRhOnMzY3JldA==", "", false},
+        {"string claim", "Bearer " + i.token(t, map[string]any{"sub": "ada", "tenant_id": "acme"}), "acme", false},
+        {"number claim", "Bearer " + i.token(t, map[string]any{"sub": "ada", "tenant_id": 1042}), "1042", false},
+        // The token is valid but doesn't identify the caller
+        {"no claim", "Bearer " + i.token(t, map[string]any{"sub": "ada"}), "", true},
+        {"empty claim", "Bearer " + i.token(t, map[string]any{"sub": "ada", "tenant_id": ""}), "", true},
+        {"invalid token", "Bearer not.a.jwt", "", true},
+    } {
+        key, err := key(test.authorization)
+        if key != test.key || (err != nil) != test.err || (err != nil && !errors.Is(err, ErrInvalidToken)) {
+            t.Fatalf("%s: %q, %v, %q expected", test.name, key, err, test.key)
+        }
+    }
+}
+
+func TestJWTVerifierKeyReusesTheClaims(t *testing.T) {
+    // The claims verified by a previous handler are not verified again
+    verifier := NewJWTVerifier(JWTConfig{JWKSURL: "http://127.0.0.1:1/keys"})
+    c := app.NewContext(0)
+    c.Request.Header.Set("Authorization", "Bearer not.a.jwt")
+    c.Set(ClaimsKey, map[string]any{"sub": "ada"})
+    if key, err := verifier.Key(context.Background(), c); err != nil || key != "ada" {
+        t.Fatalf("Key: %q, %v, ada expected", key, err)
+    }
+}
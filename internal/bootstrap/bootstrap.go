@@ -0,0 +1,155 @@
+package bootstrap
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cache"
+    confighistory "github.com/aswinkm-tc/go-web-concepts/internal/config_history"
+    leaderelection "github.com/aswinkm-tc/go-web-concepts/internal/leader_election"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/mediocregopher/radix/v4"
+    "time"
+)
+
+// Providers lists every provider of the package, e.g. fx.Provide(bootstrap.Providers...).
+//
+// Applications supply the configuration types (RedisConfig, StoreConfig, CacheConfig, HistoryConfig,
+// ratelimiter.RateLimiterConfig, ratelimiter.SanitizerFunc, proxy.ProxyConfig, leaderelection.ElectionConfig) and get the
+// subsystems built on a single shared Redis client.
+var Providers = []any{
+    ProvideRedisClient,
+    ProvideRateLimiterStore,
+    ratelimiter.NewRateLimiter,
+    ProvideCacheStore,
+    ProvideConfigHistory,
+    ProvideElector,
+    proxy.NewReverseProxy,
+}
+
+type RedisConfig struct {
+    // Addr of the Redis server, or the path of its socket for the unix network
+    Addr string `json:"addr"`
+    // Network is "tcp" or "unix"
+    //
+    // Defaults to tcp if not specified
+    Network string `json:"network,omitempty"`
+    // Cluster connects to a Redis Cluster, Addr is then a comma separated list of seed nodes
+    Cluster bool `json:"cluster,omitempty"`
+    // SentinelPrimary is the name of the primary monitored by Redis Sentinel, Addr is then a comma separated list of
+    // sentinels
+    SentinelPrimary string `json:"sentinel_primary,omitempty"`
+    // SentinelUsername and SentinelPassword authenticate the connections to the sentinels
+    SentinelUsername string `json:"sentinel_username,omitempty"`
+    SentinelPassword string `json:"sentinel_password,omitempty"`
+    // Username and Password authenticate the connections, leave Username empty for the legacy requirepass
+    Username string `json:"username,omitempty"`
+    Password string `json:"password,omitempty"`
+    // TLS connects over TLS when set
+    TLS *ratelimiterstore.TLSConfig `json:"tls,omitempty"`
+    // DB is the logical database, it must be 0 on a cluster
+    DB int `json:"db,omitempty"`
+    // PoolSize is the number of connections, per node on a cluster
+    //
+    // Defaults to 4 times GOMAXPROCS if not specified
+    PoolSize int `json:"pool_size,omitempty"`
+    // DialTimeout bounds the creation of the connection pool and of each connection
+    //
+    // Defaults to 5 seconds if not specified
+    DialTimeout time.Duration `json:"dial_timeout,omitempty"`
+    // CommandTimeout bounds each command, both writing it and reading its reply
+    CommandTimeout time.Duration `json:"command_timeout,omitempty"`
+}
+
+type StoreConfig struct {
+    // ScanCount is the number of keys to scan in each iteration
+    ScanCount int `json:"scan_count"`
+    // KeyPrefix is prepended to every key, e.g. "ratelimit:orders:", for applications sharing a Redis
+    KeyPrefix string `json:"key_prefix,omitempty"`
+    // MigrationTimeout bounds the key schema check on startup
+    //
+    // Defaults to 5 seconds if not specified
+    MigrationTimeout time.Duration `json:"migration_timeout,omitempty"`
+}
+
+type CacheConfig struct {
+    // MaxEntries of the in-memory cache, the least recently used entries are evicted beyond it
+    MaxEntries int `json:"max_entries"`
+}
+
+type HistoryConfig struct {
+    // Key of the Redis list holding the revisions
+    Key string `json:"key"`
+    // Size is the number of revisions kept
+    Size int `json:"size"`
+}
+
+// ProvideRedisClient creates the Redis connection pool shared by the subsystems.
+func ProvideRedisClient(config RedisConfig) (radix.Client, error) {
+    if config.DialTimeout == 0 {
+        config.DialTimeout = 5 * time.Second
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), config.DialTimeout)
+    defer cancel()
+    opts := []ratelimiterstore.RedisOption{ratelimiterstore.WithDialTimeout(config.DialTimeout)}
+    if config.Network == "unix" {
+        opts = append(opts, ratelimiterstore.WithUnixSocket())
+    }
+    if config.Cluster {
+        opts = append(opts, ratelimiterstore.WithCluster())
+    }
+    if config.SentinelPrimary != "" {
+        opts = append(opts, ratelimiterstore.WithSentinel(config.SentinelPrimary))
+    }
+    if config.SentinelPassword != "" {
+        opts = append(opts, ratelimiterstore.WithSentinelAuth(config.SentinelUsername, config.SentinelPassword))
+    }
+    if config.Password != "" {
+        opts = append(opts, ratelimiterstore.WithAuth(config.Username, config.Password))
+    }
+    if config.TLS != nil {
+        tlsConfig, err := config.TLS.Load()
+        if err != nil {
+            return nil, err
+        }
+        opts = append(opts, ratelimiterstore.WithTLS(tlsConfig))
+    }
+    if config.DB != 0 {
+        opts = append(opts, ratelimiterstore.WithDB(config.DB))
+    }
+    if config.PoolSize != 0 {
+        opts = append(opts, ratelimiterstore.WithPoolSize(config.PoolSize))
+    }
+    if config.CommandTimeout != 0 {
+        opts = append(opts, ratelimiterstore.WithCommandTimeout(config.CommandTimeout))
+    }
+    return ratelimiterstore.NewRedisClient(ctx, config.Addr, opts...)
+}
+
+// ProvideRateLimiterStore creates the rate limiter Store on the shared Redis client, migrating the key schema if needed.
+func ProvideRateLimiterStore(client radix.Client, config StoreConfig) (ratelimiterstore.Store, error) {
+    if config.MigrationTimeout == 0 {
+        config.MigrationTimeout = 5 * time.Second
+    }
+    ctx, cancel := context.WithTimeout(context.Background(), config.MigrationTimeout)
+    defer cancel()
+    return ratelimiterstore.NewRedisStoreWithClient(ctx, client, config.ScanCount, ratelimiterstore.WithKeyPrefix(config.KeyPrefix))
+}
+
+// ProvideCacheStore creates the cache Store shared by the caching proxy and the response cache middleware.
+func ProvideCacheStore(config CacheConfig) cache.Store {
+    return cache.NewMemoryStore(config.MaxEntries)
+}
+
+// ProvideConfigHistory creates the configuration History applying the revisions to the rate limiter.
+func ProvideConfigHistory(client radix.Client, config HistoryConfig, limiter ratelimiter.RateLimiter) confighistory.History {
+    return confighistory.NewRedisHistory(client, config.Key, config.Size, func(_ string, c ratelimiter.RateLimiterConfig) error {
+        limiter.UpdateConfig(c)
+        return nil
+    })
+}
+
+// ProvideElector creates the leader Elector for the singleton background tasks.
+func ProvideElector(client radix.Client, config leaderelection.ElectionConfig) (leaderelection.Elector, error) {
+    return leaderelection.NewRedisElector(client, config)
+}
@@ -0,0 +1,95 @@
+package bootstrap
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/mediocregopher/radix/v4"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestProviders(t *testing.T) {
+    // The dependency injection frameworks need one provider of each type
+    provided := map[reflect.Type]string{}
+    for _, p := range Providers {
+        v := reflect.ValueOf(p)
+        if v.Kind() != reflect.Func || v.Type().NumOut() == 0 {
+            t.Fatalf("provider %T is not a constructor", p)
+        }
+        out := v.Type().Out(0)
+        if other, ok := provided[out]; ok {
+            t.Fatalf("%s provided twice, by %s and %T", out, other, p)
+        }
+        provided[out] = v.Type().String()
+    }
+}
+
+func TestProvideRedisClient(t *testing.T) {
+    mr := miniredis.RunT(t)
+    mr.RequireUserAuth("limiter", "s3cret")
+    unauthenticated, err := ProvideRedisClient(RedisConfig{Addr: mr.Addr(), DialTimeout: time.Second})
+    if err != nil {
+        t.Fatalf("ProvideRedisClient: %v", err)
+    }
+    defer unauthenticated.Close()
+    if err := unauthenticated.Do(context.Background(), radix.Cmd(nil, "PING")); err == nil {
+        t.Fatalf("PING without credentials: answered")
+    }
+    client, err := ProvideRedisClient(RedisConfig{Addr: mr.Addr(), Username: "limiter", Password: "s3cret", DB: 2})
+    if err != nil {
+        t.Fatalf("ProvideRedisClient: %v", err)
+    }
+    defer client.Close()
+    if err := client.Do(context.Background(), radix.Cmd(nil, "SET", "greeting", "hello")); err != nil {
+        t.Fatalf("SET: %v", err)
+    }
+    if value, err := mr.DB(2).Get("greeting"); err != nil || value != "hello" {
+        t.Fatalf("greeting in DB 2: %q, %v", value, err)
+    }
+}
+
+func TestProvideRateLimiterStore(t *testing.T) {
+    mr := miniredis.RunT(t)
+    client, err := ProvideRedisClient(RedisConfig{Addr: mr.Addr()})
+    if err != nil {
+        t.Fatalf("ProvideRedisClient: %v", err)
+    }
+    defer client.Close()
+    store, err := ProvideRateLimiterStore(client, StoreConfig{ScanCount: 100, KeyPrefix: "ratelimit:orders:"})
+    if err != nil {
+        t.Fatalf("ProvideRateLimiterStore: %v", err)
+    }
+    key := ratelimiterstore.RateLimiterKey{UserId: "ip:10.0.0.1", Endpoint: "/api"}
+    if err := store.Set(context.Background(), key, time.Now(), time.Second, time.Minute); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    for _, k := range mr.Keys() {
+        if !strings.HasPrefix(k, "ratelimit:orders:") {
+            t.Fatalf("key %s, the prefix expected", k)
+        }
+    }
+}
+
+func TestProvideConfigHistory(t *testing.T) {
+    mr := miniredis.RunT(t)
+    client, err := ProvideRedisClient(RedisConfig{Addr: mr.Addr()})
+    if err != nil {
+        t.Fatalf("ProvideRedisClient: %v", err)
+    }
+    defer client.Close()
+    limiter := ratelimiter.NewRateLimiter(ratelimiter.RateLimiterConfig{}, ratelimiterstore.NewMemoryStore(), nil)
+    defer limiter.Close()
+    history := ProvideConfigHistory(client, HistoryConfig{Key: "ratelimiter:history", Size: 10}, limiter)
+    config := ratelimiter.RateLimiterConfig{"/api": {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    if _, err := history.Apply(context.Background(), config, "ada", ""); err != nil {
+        t.Fatalf("Apply: %v", err)
+    }
+    // The revisions are applied to the rate limiter
+    if limiter.Config()["/api"].MaxRequests != 10 {
+        t.Fatalf("limiter configuration %v, the applied one expected", limiter.Config())
+    }
+}
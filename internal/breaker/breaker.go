@@ -0,0 +1,204 @@
+package breaker
+
+import (
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "math"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Names of the metrics of the circuit breaker.
+const (
+    // MetricTransitions counts the changes of state, tagged with the new state
+    MetricTransitions = "breaker.transitions"
+    // MetricRejections counts the requests rejected without running the next handlers, tagged with the state
+    MetricRejections = "breaker.rejections"
+)
+
+type State string
+
+const (
+    // StateClosed runs every request, the failures are counted
+    StateClosed State = "closed"
+    // StateOpen rejects every request until OpenDuration passed
+    StateOpen State = "open"
+    // StateHalfOpen runs HalfOpenRequests probes, the breaker closes if they all succeed and opens again on a failure
+    StateHalfOpen State = "half_open"
+)
+
+type BreakerConfig struct {
+    // FailureThreshold is the number of consecutive failures opening the breaker
+    //
+    // Defaults to 5 if not specified
+    FailureThreshold int `json:"failure_threshold,omitempty"`
+    // OpenDuration is how long the open breaker rejects the requests before probing the handlers again
+    //
+    // Defaults to 30 seconds if not specified
+    OpenDuration time.Duration `json:"open_duration,omitempty"`
+    // HalfOpenRequests is the number of probes run by the half-open breaker, the requests beyond are rejected
+    //
+    // Defaults to 1 if not specified
+    HalfOpenRequests int `json:"half_open_requests,omitempty"`
+}
+
+// Breaker interface defines the methods of a circuit breaker, failing fast while the handlers or their dependencies
+// are failing rather than piling up requests that will fail anyway, and giving them time to recover.
+type Breaker interface {
+    // Middleware runs the next handlers if the breaker lets the request through, or answers it with 503 Service
+    // Unavailable
+    Middleware(ctx context.Context, c *app.RequestContext)
+    // State returns the current state of the breaker
+    State() State
+}
+
+// FailureFunc tells if the response of the next handlers is a failure.
+type FailureFunc func(c *app.RequestContext) bool
+
+type Option func(*breaker)
+
+// WithFailure sets what a failed request is, e.g. only the 502, 503 and 504 of a proxied dependency.
+//
+// Defaults to the responses with a 5xx status if not specified
+func WithFailure(failure FailureFunc) Option {
+    return func(b *breaker) {
+        b.failure = failure
+    }
+}
+
+// WithMetrics reports the changes of state and the rejections of the breaker to the sink.
+//
+// Defaults to metrics.Discard if not specified
+func WithMetrics(sink metrics.Sink) Option {
+    return func(b *breaker) {
+        b.metrics = sink
+    }
+}
+
+type breaker struct {
+    config  BreakerConfig
+    failure FailureFunc
+    metrics metrics.Sink
+    now     func() time.Time
+
+    mu         sync.Mutex
+    state      State
+    generation uint64 // Incremented on every change of state, the outcomes of the requests of a previous one are ignored
+    failures   int    // Consecutive failures of the closed breaker
+    openedAt   time.Time
+    probes     int // Probes running or done in the half-open state
+    successes  int // Probes that succeeded in the half-open state
+}
+
+// NewBreaker creates a circuit breaker of the next handlers, per process.
+func NewBreaker(config BreakerConfig, opts ...Option) (Breaker, error) {
+    if config.FailureThreshold < 0 || config.OpenDuration < 0 || config.HalfOpenRequests < 0 {
+        return nil, fmt.Errorf("limits of the breaker must not be negative")
+    }
+    if config.FailureThreshold == 0 {
+        config.FailureThreshold = 5
+    }
+    if config.OpenDuration == 0 {
+        config.OpenDuration = 30 * time.Second
+    }
+    if config.HalfOpenRequests == 0 {
+        config.HalfOpenRequests = 1
+    }
+    b := &breaker{
+        config: config,
+        failure: func(c *app.RequestContext) bool {
+            return c.Response.StatusCode() >= consts.StatusInternalServerError
+        },
+        metrics: metrics.Discard,
+        now:     time.Now,
+        state:   StateClosed,
+    }
+    for _, opt := range opts {
+        opt(b)
+    }
+    return b, nil
+}
+
+func (b *breaker) Middleware(ctx context.Context, c *app.RequestContext) {
+    generation, retryAfter, ok := b.allow()
+    if !ok {
+        c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+        c.AbortWithStatusJSON(consts.StatusServiceUnavailable, utils.H{"error": "Service unavailable"})
+        return
+    }
+    c.Next(ctx)
+    b.done(generation, !b.failure(c))
+}
+
+func (b *breaker) State() State {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    return b.state
+}
+
+// allow reports if the request may run the next handlers, with the generation its outcome belongs to. A rejected
+// request gets the time until the breaker probes the handlers again.
+func (b *breaker) allow() (uint64, time.Duration, bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.state == StateOpen {
+        left := b.openedAt.Add(b.config.OpenDuration).Sub(b.now())
+        if left > 0 {
+            b.metrics.Count(MetricRejections, 1, metrics.Tag{Key: "state", Value: string(b.state)})
+            return 0, left, false
+        }
+        b.transition(StateHalfOpen)
+    }
+    if b.state == StateHalfOpen {
+        if b.probes >= b.config.HalfOpenRequests {
+            // The probes still run, they decide soon
+            b.metrics.Count(MetricRejections, 1, metrics.Tag{Key: "state", Value: string(b.state)})
+            return 0, 0, false
+        }
+        b.probes++
+    }
+    return b.generation, 0, true
+}
+
+// done records the outcome of a request run in the generation.
+func (b *breaker) done(generation uint64, success bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if generation != b.generation {
+        return
+    }
+    switch b.state {
+    case StateClosed:
+        if success {
+            b.failures = 0
+            return
+        }
+        if b.failures++; b.failures >= b.config.FailureThreshold {
+            b.transition(StateOpen)
+        }
+    case StateHalfOpen:
+        if !success {
+            b.transition(StateOpen)
+            return
+        }
+        if b.successes++; b.successes >= b.config.HalfOpenRequests {
+            b.transition(StateClosed)
+        }
+    }
+}
+
+// transition changes the state and starts a new generation, b.mu is held.
+func (b *breaker) transition(state State) {
+    b.state = state
+    b.generation++
+    b.failures, b.probes, b.successes = 0, 0, 0
+    if state == StateOpen {
+        b.openedAt = b.now()
+    }
+    b.metrics.Count(MetricTransitions, 1, metrics.Tag{Key: "state", Value: string(state)})
+}
@@ -0,0 +1,93 @@
+package breaker
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "testing"
+    "time"
+)
+
+func TestBreaker(t *testing.T) {
+    b, err := NewBreaker(BreakerConfig{FailureThreshold: 3, OpenDuration: 10 * time.Second})
+    if err != nil {
+        t.Fatalf("NewBreaker: %v", err)
+    }
+    now := time.Now()
+    b.(*breaker).now = func() time.Time {
+        return now
+    }
+    status, calls := 500, 0
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.GET("/orders", b.Middleware, func(_ context.Context, c *app.RequestContext) {
+        calls++
+        c.Status(status)
+    })
+    get := func(code int, state State) {
+        t.Helper()
+        resp := ut.PerformRequest(engine, "GET", "/orders", nil).Result()
+        if resp.StatusCode() != code || b.State() != state {
+            t.Fatalf("%d in state %s, %d in state %s expected", resp.StatusCode(), b.State(), code, state)
+        }
+    }
+
+    // A success resets the consecutive failures
+    get(500, StateClosed)
+    get(500, StateClosed)
+    status = 200
+    get(200, StateClosed)
+    status = 500
+    get(500, StateClosed)
+    get(500, StateClosed)
+    get(500, StateOpen)
+    calls = 0
+    resp := ut.PerformRequest(engine, "GET", "/orders", nil).Result()
+    if resp.StatusCode() != 503 || string(resp.Header.Peek("Retry-After")) != "10" || calls != 0 {
+        t.Fatalf("open breaker: %d with Retry-After %q, %d calls", resp.StatusCode(), resp.Header.Peek("Retry-After"), calls)
+    }
+
+    // A failed probe opens it again, a successful one closes it
+    now = now.Add(10 * time.Second)
+    get(500, StateOpen)
+    get(503, StateOpen)
+    now = now.Add(10 * time.Second)
+    status = 200
+    get(200, StateClosed)
+    get(200, StateClosed)
+}
+
+// The half-open breaker runs HalfOpenRequests probes at once, and rejects the others while they run.
+func TestBreakerHalfOpenProbes(t *testing.T) {
+    b, err := NewBreaker(BreakerConfig{FailureThreshold: 1, OpenDuration: time.Second, HalfOpenRequests: 2})
+    if err != nil {
+        t.Fatalf("NewBreaker: %v", err)
+    }
+    br := b.(*breaker)
+    now := time.Now()
+    br.now = func() time.Time {
+        return now
+    }
+    generation, _, _ := br.allow()
+    br.done(generation, false)
+    now = now.Add(time.Second)
+    first, _, ok1 := br.allow()
+    second, _, ok2 := br.allow()
+    if _, _, ok3 := br.allow(); !ok1 || !ok2 || ok3 {
+        t.Fatalf("probes admitted %t %t %t, true true false expected", ok1, ok2, ok3)
+    }
+    br.done(first, true)
+    if b.State() != StateHalfOpen {
+        t.Fatalf("state %s after one successful probe, %s expected", b.State(), StateHalfOpen)
+    }
+    br.done(second, true)
+    if b.State() != StateClosed {
+        t.Fatalf("state %s after the successful probes, %s expected", b.State(), StateClosed)
+    }
+    // The outcome of a request of a previous state is ignored
+    br.done(generation, false)
+    if b.State() != StateClosed {
+        t.Fatalf("state %s after a stale failure, %s expected", b.State(), StateClosed)
+    }
+}
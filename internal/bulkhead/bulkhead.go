@@ -0,0 +1,310 @@
+package bulkhead
+
+import (
+    "container/heap"
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// Names of the metrics of the bulkhead.
+const (
+    // MetricAdmissions counts the requests, tagged with the result: admitted, shed, expired or displaced
+    MetricAdmissions = "bulkhead.admissions"
+    // MetricQueueWait times the wait of the queued requests, tagged with the result: admitted, expired or displaced
+    MetricQueueWait = "bulkhead.queue_wait"
+    // MetricInFlight is the number of requests running the next handlers
+    MetricInFlight = "bulkhead.in_flight"
+    // MetricQueued is the number of requests waiting in the queue
+    MetricQueued = "bulkhead.queued"
+)
+
+type Mode string
+
+const (
+    // ModeShed rejects the requests beyond MaxConcurrent immediately
+    ModeShed Mode = "shed"
+    // ModeQueue holds the requests beyond MaxConcurrent in a queue, the requests of the highest priority are admitted
+    // first and the ones whose deadline passes while they wait are dropped without running the next handlers
+    ModeQueue Mode = "queue"
+)
+
+type BulkheadConfig struct {
+    // MaxConcurrent requests running the next handlers at once
+    //
+    // Defaults to 100 if not specified
+    MaxConcurrent int `json:"max_concurrent,omitempty"`
+    // Mode of admission of the requests beyond MaxConcurrent
+    //
+    // Defaults to ModeShed if not specified
+    Mode Mode `json:"mode,omitempty"`
+    // QueueDepth is the number of requests ModeQueue holds, the requests beyond are shed unless they have a higher
+    // priority than a queued one, which is then displaced
+    //
+    // Defaults to MaxConcurrent if not specified
+    QueueDepth int `json:"queue_depth,omitempty"`
+    // MaxWait is the longest a request waits in the queue, a request whose context has an earlier deadline is dropped
+    // at that deadline
+    //
+    // Defaults to 1 second if not specified
+    MaxWait time.Duration `json:"max_wait,omitempty"`
+    // RetryAfter is the delay hinted to the clients whose request is shed or dropped
+    //
+    // Defaults to 1 second if not specified
+    RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+// Bulkhead interface defines the methods of a limit of the requests running at once, shedding the excess load rather
+// than letting it pile up in the handlers and their dependencies.
+type Bulkhead interface {
+    // Middleware admits the request to the next handlers, or answers it with 503 Service Unavailable
+    Middleware(ctx context.Context, c *app.RequestContext)
+}
+
+// PriorityFunc returns the priority of a request, the queued requests of the highest priority are admitted first,
+// e.g. the interactive requests before the batch ones.
+type PriorityFunc func(ctx context.Context, c *app.RequestContext) int
+
+type Option func(*bulkhead)
+
+// WithPriority sets the priority of the requests in the queue, see ModeQueue.
+//
+// Defaults to the same priority for every request if not specified, admitted in their order of arrival
+func WithPriority(priority PriorityFunc) Option {
+    return func(b *bulkhead) {
+        b.priority = priority
+    }
+}
+
+// WithMetrics reports the admissions, the queue wait and the load of the bulkhead to the sink.
+//
+// Defaults to metrics.Discard if not specified
+func WithMetrics(sink metrics.Sink) Option {
+    return func(b *bulkhead) {
+        b.metrics = sink
+    }
+}
+
+// result is what happened to a request reaching the bulkhead.
+type result string
+
+const (
+    admitted  result = "admitted"
+    shed      result = "shed"
+    expired   result = "expired"   // Its deadline passed while it waited
+    displaced result = "displaced" // A request of a higher priority took its place in the full queue
+)
+
+// waiter is a request waiting in the queue.
+type waiter struct {
+    priority int
+    deadline time.Time
+    seq      uint64        // Order of arrival, among the requests of the same priority
+    index    int           // In the queue, -1 once it left it
+    done     chan struct{} // Closed once result is set
+    result   result
+}
+
+// queue is a heap of the waiters, the next one admitted first.
+type queue []*waiter
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+    if q[i].priority != q[j].priority {
+        return q[i].priority > q[j].priority
+    }
+    return q[i].seq < q[j].seq
+}
+
+func (q queue) Swap(i, j int) {
+    q[i], q[j] = q[j], q[i]
+    q[i].index = i
+    q[j].index = j
+}
+
+func (q *queue) Push(x any) {
+    w := x.(*waiter)
+    w.index = len(*q)
+    *q = append(*q, w)
+}
+
+func (q *queue) Pop() any {
+    old := *q
+    w := old[len(old)-1]
+    old[len(old)-1] = nil
+    w.index = -1
+    *q = old[:len(old)-1]
+    return w
+}
+
+type bulkhead struct {
+    config   BulkheadConfig
+    priority PriorityFunc
+    metrics  metrics.Sink
+
+    mu      sync.Mutex
+    running int
+    queue   queue
+    seq     uint64
+}
+
+// NewBulkhead limits the requests running the next handlers at once, per process.
+func NewBulkhead(config BulkheadConfig, opts ...Option) (Bulkhead, error) {
+    if config.MaxConcurrent < 0 || config.QueueDepth < 0 || config.MaxWait < 0 || config.RetryAfter < 0 {
+        return nil, fmt.Errorf("limits of the bulkhead must not be negative")
+    }
+    if config.MaxConcurrent == 0 {
+        config.MaxConcurrent = 100
+    }
+    switch config.Mode {
+    case "":
+        config.Mode = ModeShed
+    case ModeShed, ModeQueue:
+    default:
+        return nil, fmt.Errorf("unknown bulkhead mode %q", config.Mode)
+    }
+    if config.QueueDepth == 0 {
+        config.QueueDepth = config.MaxConcurrent
+    }
+    if config.MaxWait == 0 {
+        config.MaxWait = time.Second
+    }
+    if config.RetryAfter == 0 {
+        config.RetryAfter = time.Second
+    }
+    b := &bulkhead{
+        config:  config,
+        metrics: metrics.Discard,
+    }
+    for _, opt := range opts {
+        opt(b)
+    }
+    return b, nil
+}
+
+func (b *bulkhead) Middleware(ctx context.Context, c *app.RequestContext) {
+    reached := time.Now()
+    w, res := b.acquire(ctx, c, reached)
+    if w != nil {
+        res = b.wait(ctx, w)
+        wait := time.Since(reached)
+        b.metrics.Timing(MetricQueueWait, wait, metrics.Tag{Key: "result", Value: string(res)})
+        servertiming.Add(c, servertiming.StageQueue, wait)
+    }
+    b.metrics.Count(MetricAdmissions, 1, metrics.Tag{Key: "result", Value: string(res)})
+    if res != admitted {
+        c.Header("Retry-After", strconv.FormatInt(int64((b.config.RetryAfter+time.Second-1)/time.Second), 10))
+        c.AbortWithStatusJSON(consts.StatusServiceUnavailable, utils.H{"error": "Server overloaded"})
+        return
+    }
+    defer b.release()
+    c.Next(ctx)
+}
+
+// acquire admits the request if a slot is free, or queues it. It returns the waiter of a queued request, nil with the
+// result otherwise.
+func (b *bulkhead) acquire(ctx context.Context, c *app.RequestContext, reached time.Time) (*waiter, result) {
+    var priority int
+    if b.priority != nil && b.config.Mode == ModeQueue {
+        priority = b.priority(ctx, c)
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if b.running < b.config.MaxConcurrent && len(b.queue) == 0 {
+        b.running++
+        b.report()
+        return nil, admitted
+    }
+    if b.config.Mode != ModeQueue {
+        return nil, shed
+    }
+    if len(b.queue) >= b.config.QueueDepth {
+        lowest := b.lowest()
+        if lowest == nil || lowest.priority >= priority {
+            return nil, shed
+        }
+        heap.Remove(&b.queue, lowest.index)
+        b.finish(lowest, displaced)
+    }
+    deadline := reached.Add(b.config.MaxWait)
+    if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+        deadline = d
+    }
+    b.seq++
+    w := &waiter{priority: priority, deadline: deadline, seq: b.seq, done: make(chan struct{})}
+    heap.Push(&b.queue, w)
+    b.report()
+    return w, ""
+}
+
+// lowest returns the queued request admitted last, nil if the queue is empty.
+func (b *bulkhead) lowest() *waiter {
+    var lowest *waiter
+    for _, w := range b.queue {
+        if lowest == nil || w.priority < lowest.priority || w.priority == lowest.priority && w.seq > lowest.seq {
+            lowest = w
+        }
+    }
+    return lowest
+}
+
+// wait waits for the queued request to be admitted, or for its deadline.
+func (b *bulkhead) wait(ctx context.Context, w *waiter) result {
+    timer := time.NewTimer(time.Until(w.deadline))
+    defer timer.Stop()
+    select {
+    case <-w.done:
+        return w.result
+    case <-timer.C:
+    case <-ctx.Done():
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if w.index >= 0 {
+        heap.Remove(&b.queue, w.index)
+        b.finish(w, expired)
+        b.report()
+    }
+    // It may have been admitted or displaced meanwhile
+    return w.result
+}
+
+// release hands the slot of a finished request to the next queued one, dropping the queued requests whose deadline
+// passed on the way.
+func (b *bulkhead) release() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    now := time.Now()
+    for len(b.queue) > 0 {
+        w := heap.Pop(&b.queue).(*waiter)
+        if now.After(w.deadline) {
+            b.finish(w, expired)
+            continue
+        }
+        // The slot passes to the waiter, running doesn't change
+        b.finish(w, admitted)
+        b.report()
+        return
+    }
+    b.running--
+    b.report()
+}
+
+func (b *bulkhead) finish(w *waiter, res result) {
+    w.result = res
+    close(w.done)
+}
+
+// report sets the gauges of the load, b.mu is held.
+func (b *bulkhead) report() {
+    b.metrics.Gauge(MetricInFlight, float64(b.running))
+    b.metrics.Gauge(MetricQueued, float64(len(b.queue)))
+}
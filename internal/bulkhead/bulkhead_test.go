@@ -0,0 +1,210 @@
+package bulkhead
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+)
+
+// admissions counts the admissions by result, for the tests.
+type admissions struct {
+    mu      sync.Mutex
+    results map[string]int64
+}
+
+func (a *admissions) Count(name string, value int64, tags ...metrics.Tag) {
+    if name != MetricAdmissions {
+        return
+    }
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.results[tags[0].Value] += value
+}
+
+func (*admissions) Gauge(string, float64, ...metrics.Tag)        {}
+func (*admissions) Timing(string, time.Duration, ...metrics.Tag) {}
+
+// request runs a request through the bulkhead in the background, its handler holds the slot until release is closed.
+type request struct {
+    entered chan struct{}
+    release chan struct{}
+    status  chan int
+}
+
+func start(ctx context.Context, b Bulkhead, priority int) *request {
+    r := &request{entered: make(chan struct{}), release: make(chan struct{}), status: make(chan int, 1)}
+    go func() {
+        c := app.NewContext(0)
+        c.Request.Header.Set("X-Priority", strconv.Itoa(priority))
+        c.SetHandlers(app.HandlersChain{func(context.Context, *app.RequestContext) {
+            close(r.entered)
+            <-r.release
+        }})
+        b.Middleware(ctx, c)
+        r.status <- c.Response.StatusCode()
+    }()
+    return r
+}
+
+func (r *request) admitted(t *testing.T) bool {
+    t.Helper()
+    select {
+    case <-r.entered:
+        return true
+    case <-time.After(50 * time.Millisecond):
+        return false
+    }
+}
+
+func (r *request) finish(t *testing.T) int {
+    t.Helper()
+    select {
+    case <-r.release:
+    default:
+        close(r.release)
+    }
+    select {
+    case status := <-r.status:
+        return status
+    case <-time.After(5 * time.Second):
+        t.Fatalf("request still running")
+        return 0
+    }
+}
+
+// queued waits until n requests are in the queue, so the following ones arrive after them.
+func queued(t *testing.T, b Bulkhead, n int) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        bh := b.(*bulkhead)
+        bh.mu.Lock()
+        length := len(bh.queue)
+        bh.mu.Unlock()
+        if length == n {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%d requests queued, %d expected", length, n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestBulkheadSheds(t *testing.T) {
+    sink := &admissions{results: make(map[string]int64)}
+    b, err := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, RetryAfter: 1500 * time.Millisecond}, WithMetrics(sink))
+    if err != nil {
+        t.Fatalf("NewBulkhead: %v", err)
+    }
+    running := start(context.Background(), b, 0)
+    if !running.admitted(t) {
+        t.Fatalf("first request not admitted")
+    }
+
+    c := app.NewContext(0)
+    b.Middleware(context.Background(), c)
+    if c.Response.StatusCode() != 503 || string(c.Response.Header.Peek("Retry-After")) != "2" {
+        t.Fatalf("request over the limit: %d, Retry-After %q, 503 and 2 expected", c.Response.StatusCode(), c.Response.Header.Peek("Retry-After"))
+    }
+    if status := running.finish(t); status != 200 {
+        t.Fatalf("first request: %d", status)
+    }
+    // The slot is released
+    next := start(context.Background(), b, 0)
+    if !next.admitted(t) {
+        t.Fatalf("request after the release not admitted")
+    }
+    next.finish(t)
+    if sink.results["admitted"] != 2 || sink.results["shed"] != 1 {
+        t.Fatalf("admissions %v", sink.results)
+    }
+}
+
+func TestBulkheadQueuesByPriority(t *testing.T) {
+    b, err := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, Mode: ModeQueue, QueueDepth: 2, MaxWait: 5 * time.Second},
+        WithPriority(func(_ context.Context, c *app.RequestContext) int {
+            priority, _ := strconv.Atoi(string(c.GetHeader("X-Priority")))
+            return priority
+        }))
+    if err != nil {
+        t.Fatalf("NewBulkhead: %v", err)
+    }
+    running := start(context.Background(), b, 0)
+    if !running.admitted(t) {
+        t.Fatalf("first request not admitted")
+    }
+    batch := start(context.Background(), b, 0)
+    queued(t, b, 1)
+    interactive := start(context.Background(), b, 1)
+    queued(t, b, 2)
+    // The queue is full, a request of the same priority is shed and one of a higher priority displaces the lowest
+    c := app.NewContext(0)
+    c.Request.Header.Set("X-Priority", "0")
+    b.Middleware(context.Background(), c)
+    if c.Response.StatusCode() != 503 {
+        t.Fatalf("request of the lowest priority in a full queue: %d, 503 expected", c.Response.StatusCode())
+    }
+    urgent := start(context.Background(), b, 2)
+    if status := batch.finish(t); status != 503 {
+        t.Fatalf("displaced request: %d, 503 expected", status)
+    }
+
+    // The queued requests are admitted by priority, one at a time
+    running.finish(t)
+    if !urgent.admitted(t) || interactive.admitted(t) {
+        t.Fatalf("the request of the highest priority must be admitted first, alone")
+    }
+    urgent.finish(t)
+    if !interactive.admitted(t) {
+        t.Fatalf("queued request not admitted")
+    }
+    if status := interactive.finish(t); status != 200 {
+        t.Fatalf("queued request: %d", status)
+    }
+}
+
+func TestBulkheadDropsExpiredRequests(t *testing.T) {
+    b, err := NewBulkhead(BulkheadConfig{MaxConcurrent: 1, Mode: ModeQueue, MaxWait: time.Minute})
+    if err != nil {
+        t.Fatalf("NewBulkhead: %v", err)
+    }
+    running := start(context.Background(), b, 0)
+    if !running.admitted(t) {
+        t.Fatalf("first request not admitted")
+    }
+    // The deadline of the request is earlier than MaxWait
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    waiting := start(ctx, b, 0)
+    if status := waiting.finish(t); status != 503 {
+        t.Fatalf("expired request: %d, 503 expected", status)
+    }
+    if waiting.admitted(t) {
+        t.Fatalf("expired request ran the handlers")
+    }
+    queued(t, b, 0)
+    running.finish(t)
+
+    next := start(context.Background(), b, 0)
+    if !next.admitted(t) {
+        t.Fatalf("request after the expiry not admitted, the slot leaked")
+    }
+    next.finish(t)
+}
+
+func TestNewBulkheadRejectsInvalidConfig(t *testing.T) {
+    for name, config := range map[string]BulkheadConfig{
+        "negative limit": {MaxConcurrent: -1},
+        "negative wait":  {MaxWait: -time.Second},
+        "unknown mode":   {Mode: "lifo"},
+    } {
+        if _, err := NewBulkhead(config); err == nil {
+            t.Fatalf("%s: accepted", name)
+        }
+    }
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+    "container/list"
+    "context"
+    "sync"
+    "time"
+)
+
+type memoryEntry struct {
+    key       string
+    value     []byte
+    expiresAt time.Time
+}
+
+type memory struct {
+    mu         sync.Mutex
+    maxEntries int
+    entries    map[string]*list.Element
+    lru        *list.List // Most recently used entries are at the front
+}
+
+// NewMemoryStore creates an in-process Store evicting the least recently used entries beyond maxEntries.
+func NewMemoryStore(maxEntries int) Store {
+    return &memory{
+        maxEntries: maxEntries,
+        entries:    make(map[string]*list.Element),
+        lru:        list.New(),
+    }
+}
+
+func (m *memory) Get(_ context.Context, key string) ([]byte, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    el, ok := m.entries[key]
+    if !ok {
+        return nil, ErrKeyNotFound
+    }
+    entry := el.Value.(*memoryEntry)
+    if time.Now().After(entry.expiresAt) {
+        m.remove(el)
+        return nil, ErrKeyNotFound
+    }
+    m.lru.MoveToFront(el)
+    return entry.value, nil
+}
+
+func (m *memory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    entry := &memoryEntry{
+        key:       key,
+        value:     value,
+        expiresAt: time.Now().Add(ttl),
+    }
+    if el, ok := m.entries[key]; ok {
+        el.Value = entry
+        m.lru.MoveToFront(el)
+        return nil
+    }
+    m.entries[key] = m.lru.PushFront(entry)
+    for m.maxEntries > 0 && m.lru.Len() > m.maxEntries {
+        m.remove(m.lru.Back())
+    }
+    return nil
+}
+
+func (m *memory) Delete(_ context.Context, key string) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if el, ok := m.entries[key]; ok {
+        m.remove(el)
+    }
+    return nil
+}
+
+func (m *memory) remove(el *list.Element) {
+    m.lru.Remove(el)
+    delete(m.entries, el.Value.(*memoryEntry).key)
+}
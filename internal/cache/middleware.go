@@ -0,0 +1,140 @@
+package cache
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// StatusHeader tells the client whether the response was served from the cache.
+const StatusHeader = "X-Cache"
+
+// responseKeyPrefix keeps the keys of the middleware apart from the ones of the caching proxy in a shared Store.
+const responseKeyPrefix = "response:"
+
+type ResponseCacheConfig struct {
+    // Store is the cache backend, it can be shared with the caching proxy
+    //
+    // Defaults to an in-memory store of 10000 responses if not specified
+    Store Store `json:"-"`
+    // TTL of the cached responses
+    //
+    // Defaults to 1 minute if not specified
+    TTL time.Duration `json:"ttl,omitempty"`
+    // MaxBodySize in bytes of the cached responses, larger ones are not cached
+    //
+    // Defaults to 1MiB if not specified
+    MaxBodySize int `json:"max_body_size,omitempty"`
+}
+
+// storedResponse is the representation of a response of the middleware in the Store.
+type storedResponse struct {
+    Status   int         `json:"status"`
+    Header   [][2]string `json:"header"`
+    Body     []byte      `json:"body"`
+    StoredAt time.Time   `json:"stored_at"`
+}
+
+// ResponseCache serves the responses of the next handlers from the cache, for the handlers that are expensive to
+// compute and can be served slightly outdated.
+type ResponseCache struct {
+    config ResponseCacheConfig
+}
+
+// NewResponseCache creates the response cache middleware of the configuration.
+func NewResponseCache(config ResponseCacheConfig) *ResponseCache {
+    if config.Store == nil {
+        config.Store = NewMemoryStore(10000)
+    }
+    if config.TTL == 0 {
+        config.TTL = time.Minute
+    }
+    if config.MaxBodySize == 0 {
+        config.MaxBodySize = 1 << 20
+    }
+    return &ResponseCache{config: config}
+}
+
+// Middleware serves the GET requests from the cache, and caches the 200 responses of the next handlers for the TTL.
+// The requests with an Authorization header, and the responses that are streamed, set cookies, have a Vary header or
+// a no-store, no-cache or private Cache-Control are neither served from the cache nor cached.
+func (rc *ResponseCache) Middleware(ctx context.Context, c *app.RequestContext) {
+    if string(c.Method()) != consts.MethodGet || len(c.GetHeader("Authorization")) > 0 {
+        c.Next(ctx)
+        return
+    }
+    key := responseKeyPrefix + string(c.Request.Host()) + string(c.Request.RequestURI())
+    if entry := rc.lookup(ctx, key); entry != nil {
+        c.Response.SetStatusCode(entry.Status)
+        for _, h := range entry.Header {
+            if h[0] != consts.HeaderContentLength {
+                c.Response.Header.Add(h[0], h[1])
+            }
+        }
+        c.Response.Header.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+        c.Response.Header.Set(StatusHeader, "HIT")
+        c.Response.SetBody(entry.Body)
+        c.Abort()
+        return
+    }
+
+    c.Next(ctx)
+    resp := &c.Response
+    if resp.StatusCode() != consts.StatusOK || resp.IsBodyStream() || len(resp.Body()) > rc.config.MaxBodySize ||
+        len(resp.Header.Peek("Set-Cookie")) > 0 || len(resp.Header.Peek("Vary")) > 0 || !storable(resp.Header.Peek("Cache-Control")) {
+        return
+    }
+    entry := storedResponse{
+        Status:   resp.StatusCode(),
+        Body:     resp.Body(),
+        StoredAt: time.Now(),
+    }
+    resp.Header.VisitAll(func(k, v []byte) {
+        entry.Header = append(entry.Header, [2]string{string(k), string(v)})
+    })
+    value, err := json.Marshal(entry)
+    if err != nil {
+        slog.Error("Error encoding cached response", "key", key, "error", err)
+        return
+    }
+    if err = rc.config.Store.Set(ctx, key, value, rc.config.TTL); err != nil {
+        slog.Error("Error caching response", "key", key, "error", err)
+        return
+    }
+    resp.Header.Set(StatusHeader, "MISS")
+}
+
+// lookup returns the stored response of the key, nil when it is missing or the Store fails.
+func (rc *ResponseCache) lookup(ctx context.Context, key string) *storedResponse {
+    value, err := rc.config.Store.Get(ctx, key)
+    if err != nil {
+        if !errors.Is(err, ErrKeyNotFound) {
+            slog.Error("Error retrieving cached response", "key", key, "error", err)
+        }
+        return nil
+    }
+    var entry storedResponse
+    if err = json.Unmarshal(value, &entry); err != nil {
+        slog.Error("Error decoding cached response", "key", key, "error", err)
+        return nil
+    }
+    return &entry
+}
+
+// storable tells if the Cache-Control of a response lets it be stored.
+func storable(cacheControl []byte) bool {
+    for _, part := range strings.Split(string(cacheControl), ",") {
+        name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+        switch strings.ToLower(name) {
+        case "no-store", "no-cache", "private":
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "testing"
+)
+
+func TestResponseCache(t *testing.T) {
+    store := NewMemoryStore(10)
+    rc := NewResponseCache(ResponseCacheConfig{Store: store})
+    engine := route.NewEngine(config.NewOptions(nil))
+    calls := 0
+    engine.GET("/report", rc.Middleware, func(_ context.Context, c *app.RequestContext) {
+        calls++
+        c.String(200, "report %d", calls)
+    })
+    engine.GET("/private", rc.Middleware, func(_ context.Context, c *app.RequestContext) {
+        calls++
+        c.Header("Cache-Control", "private, max-age=60")
+        c.String(200, "private %d", calls)
+    })
+
+    for _, test := range []struct {
+        path   string
+        header ut.Header
+        body   string
+        status string
+    }{
+        {path: "/report", body: "report 1", status: "MISS"},
+        {path: "/report", body: "report 1", status: "HIT"},
+        // Authenticated requests reach the handler
+        {path: "/report", header: ut.Header{Key: "Authorization", Value: "Bearer token"}, body: "report 2"},
+        {path: "/report?page=2", body: "report 3", status: "MISS"},
+        {path: "/private", body: "private 4"},
+        {path: "/private", body: "private 5"},
+    } {
+        resp := ut.PerformRequest(engine, "GET", test.path, nil, test.header).Result()
+        if body := string(resp.Body()); body != test.body {
+            t.Fatalf("GET %s: %q, %q expected", test.path, body, test.body)
+        }
+        if status := string(resp.Header.Peek(StatusHeader)); status != test.status {
+            t.Fatalf("GET %s: %s %q, %q expected", test.path, StatusHeader, status, test.status)
+        }
+    }
+    // The keys don't collide with the ones of the caching proxy sharing the store, the host and the URI
+    if _, err := store.Get(context.Background(), "response:/report"); err != nil {
+        t.Fatalf("Get: %v", err)
+    }
+    if _, err := store.Get(context.Background(), "/report"); err != ErrKeyNotFound {
+        t.Fatalf("Get: %v, ErrKeyNotFound expected", err)
+    }
+}
@@ -0,0 +1,19 @@
+package cache
+
+import (
+    "context"
+    "errors"
+    "time"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// Store is the cache backend shared by the caching proxy and the response cache middleware.
+type Store interface {
+    // Get retrieves the value associated with the given key, it returns ErrKeyNotFound if the key is missing or expired
+    Get(ctx context.Context, key string) ([]byte, error)
+    // Set stores the value for the given key until the ttl expires
+    Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+    // Delete removes the value associated with the given key
+    Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,280 @@
+package client_cache
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "strconv"
+    "sync"
+    "time"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+// invalidateChannel is the channel Redis publishes the invalidated keys on, when redirecting them in RESP2.
+const invalidateChannel = "__redis__:invalidate"
+
+// Cache serves repeated reads of slow-changing Redis keys from memory, e.g. bans, exemptions and configuration
+// overrides, while they are still managed centrally in Redis.
+type Cache interface {
+    // Get returns the value of the key, or ErrKeyNotFound if it doesn't exist
+    Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// DialFunc creates a dedicated connection to the Redis server the client reads from.
+type DialFunc func(ctx context.Context) (radix.Conn, error)
+
+type CacheConfig struct {
+    // Prefixes of the cached keys, Redis sends an invalidation for any change of a key with one of them
+    Prefixes []string `json:"prefixes"`
+    // MaxEntries kept in memory, an arbitrary entry is evicted beyond it
+    //
+    // Defaults to 10000 if not specified
+    MaxEntries int `json:"max_entries,omitempty"`
+    // HealthInterval is how often the invalidation connections are checked, they are reconnected when they have been
+    // silent for 3 intervals
+    //
+    // Defaults to 1 second if not specified
+    HealthInterval time.Duration `json:"health_interval,omitempty"`
+}
+
+type cachedValue struct {
+    value []byte
+    found bool // Missing keys are cached too, most users are neither banned nor exempted
+}
+
+type redisCache struct {
+    client radix.Client
+    dial   DialFunc
+    config CacheConfig
+
+    mu       sync.Mutex
+    tracking bool // Entries are only cached while the invalidations are received
+    entries  map[string]cachedValue
+    pending  map[string]uint64 // Reads in flight, removed when the key is invalidated during the read
+    seq      uint64
+}
+
+// NewRedisCache creates a Cache using Redis 6 client-side caching in broadcasting mode: Redis pushes the keys
+// matching the prefixes whenever they change, and the cached values are dropped.
+//
+// Two connections are created with dial, one subscribed to the invalidations and one enabling the tracking. When they
+// are lost every entry is dropped and the reads go to Redis until they are recreated. They are closed when ctx is done.
+func NewRedisCache(ctx context.Context, client radix.Client, dial DialFunc, config CacheConfig) (Cache, error) {
+    if config.MaxEntries == 0 {
+        config.MaxEntries = 10000
+    }
+    if config.HealthInterval == 0 {
+        config.HealthInterval = time.Second
+    }
+    c := &redisCache{
+        client:  client,
+        dial:    dial,
+        config:  config,
+        entries: make(map[string]cachedValue),
+        pending: make(map[string]uint64),
+    }
+    // Track synchronously first so an unsupported server fails the startup
+    t, err := c.track(ctx)
+    if err != nil {
+        return nil, err
+    }
+    go c.run(ctx, t)
+    return c, nil
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+    c.mu.Lock()
+    if v, ok := c.entries[key]; ok {
+        c.mu.Unlock()
+        if !v.found {
+            return nil, ErrKeyNotFound
+        }
+        return v.value, nil
+    }
+    c.seq++
+    seq := c.seq
+    if c.tracking {
+        c.pending[key] = seq
+    }
+    c.mu.Unlock()
+
+    var value []byte
+    maybe := radix.Maybe{Rcv: &value}
+    if err := c.client.Do(ctx, radix.Cmd(&maybe, "GET", key)); err != nil {
+        c.mu.Lock()
+        if c.pending[key] == seq {
+            delete(c.pending, key)
+        }
+        c.mu.Unlock()
+        return nil, fmt.Errorf("failed to get %s: %w", key, err)
+    }
+
+    c.mu.Lock()
+    // Only cache the value if no invalidation arrived during the read, it could be older than the invalidation
+    if c.tracking && c.pending[key] == seq {
+        if len(c.entries) >= c.config.MaxEntries {
+            for k := range c.entries {
+                delete(c.entries, k)
+                break
+            }
+        }
+        c.entries[key] = cachedValue{value: value, found: !maybe.Null}
+    }
+    if c.pending[key] == seq {
+        delete(c.pending, key)
+    }
+    c.mu.Unlock()
+    if maybe.Null {
+        return nil, ErrKeyNotFound
+    }
+    return value, nil
+}
+
+// tracking holds the connections of the client-side caching.
+type tracking struct {
+    subscriber radix.Conn
+    tracker    radix.Conn
+}
+
+func (t *tracking) close() {
+    if t.subscriber != nil {
+        _ = t.subscriber.Close()
+    }
+    if t.tracker != nil {
+        _ = t.tracker.Close()
+    }
+}
+
+// track subscribes to the invalidations and enables the tracking of the prefixes.
+func (c *redisCache) track(ctx context.Context) (*tracking, error) {
+    t := &tracking{}
+    var err error
+    if t.subscriber, err = c.dial(ctx); err != nil {
+        return nil, fmt.Errorf("failed to dial invalidation connection: %w", err)
+    }
+    var id int64
+    if err := t.subscriber.Do(ctx, radix.Cmd(&id, "CLIENT", "ID")); err != nil {
+        t.close()
+        return nil, fmt.Errorf("failed to get invalidation client id: %w", err)
+    }
+    if err := t.subscriber.Do(ctx, radix.Cmd(nil, "SUBSCRIBE", invalidateChannel)); err != nil {
+        t.close()
+        return nil, fmt.Errorf("failed to subscribe to invalidations: %w", err)
+    }
+    if t.tracker, err = c.dial(ctx); err != nil {
+        t.close()
+        return nil, fmt.Errorf("failed to dial tracking connection: %w", err)
+    }
+    args := []string{"TRACKING", "ON", "REDIRECT", strconv.FormatInt(id, 10), "BCAST"}
+    for _, prefix := range c.config.Prefixes {
+        args = append(args, "PREFIX", prefix)
+    }
+    if err := t.tracker.Do(ctx, radix.Cmd(nil, "CLIENT", args...)); err != nil {
+        t.close()
+        return nil, fmt.Errorf("failed to enable tracking: %w", err)
+    }
+    c.setTracking(true)
+    return t, nil
+}
+
+// setTracking drops every entry, they may have missed invalidations, and enables or disables caching.
+func (c *redisCache) setTracking(tracking bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.tracking = tracking
+    clear(c.entries)
+    clear(c.pending)
+}
+
+// invalidate drops the keys, or every entry when Redis was flushed.
+func (c *redisCache) invalidate(keys []string, flushed bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if flushed {
+        clear(c.entries)
+        clear(c.pending)
+        return
+    }
+    for _, k := range keys {
+        delete(c.entries, k)
+        delete(c.pending, k)
+    }
+}
+
+// run receives the invalidations until ctx is done, recreating the connections when they are lost.
+func (c *redisCache) run(ctx context.Context, t *tracking) {
+    for {
+        err := c.receive(ctx, t)
+        t.close()
+        c.setTracking(false)
+        if ctx.Err() != nil {
+            return
+        }
+        slog.Error("Error receiving cache invalidations", "error", err)
+        for t = nil; t == nil; {
+            select {
+            case <-ctx.Done():
+                return
+            case <-time.After(c.config.HealthInterval):
+            }
+            if t, err = c.track(ctx); err != nil {
+                slog.Error("Error tracking cached keys", "error", err)
+            }
+        }
+    }
+}
+
+// receive applies the invalidations pushed on the subscriber, pinging both connections when they are idle.
+func (c *redisCache) receive(ctx context.Context, t *tracking) error {
+    lastSeen := time.Now()
+    for {
+        var msg []any
+        readCtx, cancel := context.WithTimeout(ctx, c.config.HealthInterval)
+        err := t.subscriber.EncodeDecode(readCtx, nil, &msg)
+        cancel()
+        switch {
+        case ctx.Err() != nil:
+            return ctx.Err()
+        case errors.Is(err, context.DeadlineExceeded):
+            if time.Since(lastSeen) > 3*c.config.HealthInterval {
+                return errors.New("invalidation connection is unresponsive")
+            }
+            if err := t.tracker.Do(ctx, radix.Cmd(nil, "PING")); err != nil {
+                return fmt.Errorf("failed to ping tracking connection: %w", err)
+            }
+            // The reply is received as a message on the subscriber
+            if err := t.subscriber.EncodeDecode(ctx, radix.Cmd(nil, "PING"), nil); err != nil {
+                return fmt.Errorf("failed to ping invalidation connection: %w", err)
+            }
+            continue
+        case err != nil:
+            return err
+        }
+        lastSeen = time.Now()
+        // Invalidations are ["message", "__redis__:invalidate", keys], keys is nil when Redis was flushed
+        if len(msg) != 3 || asString(msg[0]) != "message" {
+            continue
+        }
+        keys, _ := msg[2].([]any)
+        invalidated := make([]string, 0, len(keys))
+        for _, k := range keys {
+            invalidated = append(invalidated, asString(k))
+        }
+        c.invalidate(invalidated, msg[2] == nil)
+    }
+}
+
+// asString converts a blob string, received as bytes, or a simple string.
+func asString(v any) string {
+    switch s := v.(type) {
+    case []byte:
+        return string(s)
+    case string:
+        return s
+    default:
+        return fmt.Sprint(v)
+    }
+}
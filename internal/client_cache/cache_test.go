@@ -0,0 +1,219 @@
+package client_cache
+
+import (
+    "context"
+    "errors"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/mediocregopher/radix/v4"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// pushConn is an invalidation connection receiving the messages pushed on its channel.
+type pushConn struct {
+    radix.Conn
+    messages chan []any
+    pings    atomic.Int64
+}
+
+func (c *pushConn) Do(context.Context, radix.Action) error {
+    c.pings.Add(1)
+    return nil
+}
+
+func (c *pushConn) EncodeDecode(ctx context.Context, marshal, unmarshalInto any) error {
+    if marshal != nil {
+        c.pings.Add(1)
+        return nil
+    }
+    select {
+    case msg := <-c.messages:
+        *unmarshalInto.(*[]any) = msg
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (c *pushConn) Close() error {
+    return nil
+}
+
+// newCache creates a cache reading from miniredis and tracking its keys, without the connections miniredis doesn't
+// support.
+func newCache(t *testing.T, maxEntries int) (*redisCache, *miniredis.Miniredis) {
+    t.Helper()
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    c := &redisCache{
+        client:   client,
+        config:   CacheConfig{MaxEntries: maxEntries, HealthInterval: 20 * time.Millisecond},
+        tracking: true,
+        entries:  make(map[string]cachedValue),
+        pending:  make(map[string]uint64),
+    }
+    return c, mr
+}
+
+func TestRedisCache(t *testing.T) {
+    c, mr := newCache(t, 10)
+    ctx := context.Background()
+    mr.Set("bans:ada", "1")
+
+    if value, err := c.Get(ctx, "bans:ada"); err != nil || string(value) != "1" {
+        t.Fatalf("Get: %s, %v", value, err)
+    }
+    // The value and the missing keys are served from memory until they are invalidated
+    mr.Set("bans:ada", "2")
+    mr.Set("bans:grace", "1")
+    if _, err := c.Get(ctx, "bans:grace"); err != nil {
+        t.Fatalf("Get: %v", err)
+    }
+    mr.Del("bans:grace")
+    if value, err := c.Get(ctx, "bans:ada"); err != nil || string(value) != "1" {
+        t.Fatalf("Get of a cached key: %s, %v, 1 expected", value, err)
+    }
+    if _, err := c.Get(ctx, "bans:grace"); err != nil {
+        t.Fatalf("Get of a cached key: %v", err)
+    }
+    c.invalidate([]string{"bans:ada"}, false)
+    if value, err := c.Get(ctx, "bans:ada"); err != nil || string(value) != "2" {
+        t.Fatalf("Get of an invalidated key: %s, %v, 2 expected", value, err)
+    }
+    c.invalidate(nil, true)
+    if _, err := c.Get(ctx, "bans:grace"); !errors.Is(err, ErrKeyNotFound) {
+        t.Fatalf("Get after a flush: %v, ErrKeyNotFound expected", err)
+    }
+
+    // Nothing is cached while the invalidations are not received
+    c.setTracking(false)
+    if _, err := c.Get(ctx, "bans:ada"); err != nil || len(c.entries) != 0 {
+        t.Fatalf("Get without tracking: %v, %d entries cached", err, len(c.entries))
+    }
+}
+
+func TestRedisCacheInvalidationDuringRead(t *testing.T) {
+    c, mr := newCache(t, 10)
+    mr.Set("bans:ada", "1")
+    // The key is invalidated while the GET is in flight, the value read may be older than the invalidation
+    c.client = radix.Client(&invalidatingClient{Client: c.client, cache: c})
+    if _, err := c.Get(context.Background(), "bans:ada"); err != nil {
+        t.Fatalf("Get: %v", err)
+    }
+    if _, ok := c.entries["bans:ada"]; ok {
+        t.Fatalf("value read during an invalidation cached")
+    }
+}
+
+// invalidatingClient invalidates the keys it reads before answering.
+type invalidatingClient struct {
+    radix.Client
+    cache *redisCache
+}
+
+func (c *invalidatingClient) Do(ctx context.Context, action radix.Action) error {
+    for _, key := range action.Properties().Keys {
+        c.cache.invalidate([]string{key}, false)
+    }
+    return c.Client.Do(ctx, action)
+}
+
+func TestRedisCacheMaxEntries(t *testing.T) {
+    c, _ := newCache(t, 2)
+    for _, key := range []string{"bans:ada", "bans:grace", "bans:linus"} {
+        if _, err := c.Get(context.Background(), key); !errors.Is(err, ErrKeyNotFound) {
+            t.Fatalf("Get: %v", err)
+        }
+    }
+    if len(c.entries) != 2 {
+        t.Fatalf("%d entries, 2 expected", len(c.entries))
+    }
+}
+
+func TestRedisCacheReceive(t *testing.T) {
+    c, _ := newCache(t, 10)
+    c.entries["bans:ada"] = cachedValue{value: []byte("1"), found: true}
+    c.entries["bans:grace"] = cachedValue{}
+    subscriber := &pushConn{messages: make(chan []any, 2)}
+    tracker := &pushConn{}
+    done := make(chan error, 1)
+    go func() {
+        done <- c.receive(context.Background(), &tracking{subscriber: subscriber, tracker: tracker})
+    }()
+
+    subscriber.messages <- []any{[]byte("message"), []byte(invalidateChannel), []any{[]byte("bans:ada")}}
+    waitFor(t, func() bool {
+        return c.entryCount("bans:ada") == 0
+    })
+    if c.entryCount("bans:grace") != 1 {
+        t.Fatalf("entry not invalidated dropped")
+    }
+    // Redis was flushed
+    subscriber.messages <- []any{[]byte("message"), []byte(invalidateChannel), nil}
+    waitFor(t, func() bool {
+        return c.entryCount() == 0
+    })
+
+    // The idle connections are pinged, then given up when the subscriber stays silent
+    select {
+    case err := <-done:
+        if err == nil || subscriber.pings.Load() == 0 || tracker.pings.Load() == 0 {
+            t.Fatalf("receive: %v, %d and %d pings", err, subscriber.pings.Load(), tracker.pings.Load())
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("silent invalidation connection not given up")
+    }
+}
+
+// entryCount counts the cached entries of the keys, of every key without them.
+func (c *redisCache) entryCount(keys ...string) int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if len(keys) == 0 {
+        return len(c.entries)
+    }
+    count := 0
+    for _, key := range keys {
+        if _, ok := c.entries[key]; ok {
+            count++
+        }
+    }
+    return count
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        if condition() {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("condition not met")
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestNewRedisCacheRejectsUnsupportedServer(t *testing.T) {
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    defer client.Close()
+    dial := func(ctx context.Context) (radix.Conn, error) {
+        return radix.Dial(ctx, "tcp", mr.Addr())
+    }
+    // miniredis doesn't support the client-side caching of Redis 6
+    if _, err := NewRedisCache(context.Background(), client, dial, CacheConfig{Prefixes: []string{"bans:"}}); err == nil {
+        t.Fatalf("NewRedisCache: tracking on a server without it accepted")
+    }
+}
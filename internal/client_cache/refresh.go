@@ -0,0 +1,142 @@
+package client_cache
+
+import (
+    "context"
+    "errors"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+// CacheFunc adapts a lookup in a remote provider, e.g. a configuration service or a database, to a Cache.
+type CacheFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f CacheFunc) Get(ctx context.Context, key string) ([]byte, error) {
+    return f(ctx, key)
+}
+
+type RefreshConfig struct {
+    // SoftTTL is the age after which a read still returns the cached value but refreshes it in the background
+    //
+    // Defaults to 10 seconds if not specified
+    SoftTTL time.Duration `json:"soft_ttl,omitempty"`
+    // HardTTL is the age after which the cached value is no longer returned and the read waits for the source, so a
+    // value the source failed to refresh for that long isn't served forever
+    //
+    // Defaults to 10 minutes if not specified
+    HardTTL time.Duration `json:"hard_ttl,omitempty"`
+    // RefreshTimeout bounds a refresh in the background, it doesn't depend on the request that triggered it
+    //
+    // Defaults to 5 seconds if not specified
+    RefreshTimeout time.Duration `json:"refresh_timeout,omitempty"`
+    // MaxEntries kept in memory, an arbitrary entry is evicted beyond it
+    //
+    // Defaults to 10000 if not specified
+    MaxEntries int `json:"max_entries,omitempty"`
+}
+
+type refreshEntry struct {
+    cachedValue
+    fetchedAt  time.Time
+    refreshing bool // A refresh is in flight, the next reads don't start another one
+}
+
+type refreshAheadCache struct {
+    source Cache
+    config RefreshConfig
+
+    mu      sync.Mutex
+    entries map[string]*refreshEntry
+}
+
+// NewRefreshAheadCache creates a Cache serving the values of the source from memory, so the lookups never add
+// latency to the request path once a key has been read:
+//   - A value younger than SoftTTL is returned as is
+//   - A value older than SoftTTL is returned too, and refreshed from the source in the background
+//   - A value older than HardTTL, or a key read for the first time, is read from the source
+//
+// Missing keys are cached like values. When a refresh fails the previous value is kept until HardTTL and the next read
+// retries.
+func NewRefreshAheadCache(source Cache, config RefreshConfig) Cache {
+    if config.SoftTTL == 0 {
+        config.SoftTTL = 10 * time.Second
+    }
+    if config.HardTTL == 0 {
+        config.HardTTL = 10 * time.Minute
+    }
+    if config.RefreshTimeout == 0 {
+        config.RefreshTimeout = 5 * time.Second
+    }
+    if config.MaxEntries == 0 {
+        config.MaxEntries = 10000
+    }
+    return &refreshAheadCache{
+        source:  source,
+        config:  config,
+        entries: make(map[string]*refreshEntry),
+    }
+}
+
+func (c *refreshAheadCache) Get(ctx context.Context, key string) ([]byte, error) {
+    now := time.Now()
+    c.mu.Lock()
+    e, ok := c.entries[key]
+    if ok && now.Sub(e.fetchedAt) < c.config.HardTTL {
+        if now.Sub(e.fetchedAt) >= c.config.SoftTTL && !e.refreshing {
+            e.refreshing = true
+            go c.refresh(context.WithoutCancel(ctx), key)
+        }
+        v := e.cachedValue
+        c.mu.Unlock()
+        if !v.found {
+            return nil, ErrKeyNotFound
+        }
+        return v.value, nil
+    }
+    c.mu.Unlock()
+
+    value, err := c.source.Get(ctx, key)
+    if err != nil && !errors.Is(err, ErrKeyNotFound) {
+        return nil, err
+    }
+    c.store(key, value, err == nil, now)
+    return value, err
+}
+
+// refresh reads the key from the source in the background, keeping the cached value if it fails.
+func (c *refreshAheadCache) refresh(ctx context.Context, key string) {
+    ctx, cancel := context.WithTimeout(ctx, c.config.RefreshTimeout)
+    defer cancel()
+    fetchedAt := time.Now()
+    value, err := c.source.Get(ctx, key)
+    if err != nil && !errors.Is(err, ErrKeyNotFound) {
+        slog.Error("Error refreshing cached key", "key", key, "error", err)
+        c.mu.Lock()
+        if e, ok := c.entries[key]; ok {
+            e.refreshing = false
+        }
+        c.mu.Unlock()
+        return
+    }
+    c.store(key, value, err == nil, fetchedAt)
+}
+
+// store caches the value read at fetchedAt, unless a newer read already did.
+func (c *refreshAheadCache) store(key string, value []byte, found bool, fetchedAt time.Time) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if e, ok := c.entries[key]; ok {
+        if e.fetchedAt.After(fetchedAt) {
+            return
+        }
+    } else if len(c.entries) >= c.config.MaxEntries {
+        for k := range c.entries {
+            delete(c.entries, k)
+            break
+        }
+    }
+    c.entries[key] = &refreshEntry{
+        cachedValue: cachedValue{value: value, found: found},
+        fetchedAt:   fetchedAt,
+    }
+}
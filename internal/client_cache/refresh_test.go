@@ -0,0 +1,121 @@
+package client_cache
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+    "time"
+)
+
+// source is a remote provider of values counting its reads.
+type source struct {
+    mu     sync.Mutex
+    values map[string]string
+    reads  int
+    err    error
+}
+
+func (s *source) Get(_ context.Context, key string) ([]byte, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.reads++
+    if s.err != nil {
+        return nil, s.err
+    }
+    value, ok := s.values[key]
+    if !ok {
+        return nil, ErrKeyNotFound
+    }
+    return []byte(value), nil
+}
+
+func (s *source) set(key, value string, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.values[key] = value
+    s.err = err
+}
+
+func (s *source) readCount() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.reads
+}
+
+func TestRefreshAheadCache(t *testing.T) {
+    s := &source{values: map[string]string{"overrides:acme": "100"}}
+    cache := NewRefreshAheadCache(CacheFunc(s.Get), RefreshConfig{SoftTTL: 50 * time.Millisecond, HardTTL: 200 * time.Millisecond})
+    ctx := context.Background()
+    get := func() string {
+        t.Helper()
+        value, err := cache.Get(ctx, "overrides:acme")
+        if err != nil {
+            t.Fatalf("Get: %v", err)
+        }
+        return string(value)
+    }
+
+    if value := get(); value != "100" || s.readCount() != 1 {
+        t.Fatalf("Get: %s, %d reads", value, s.readCount())
+    }
+    s.set("overrides:acme", "200", nil)
+    // A fresh value is returned as is
+    if value := get(); value != "100" || s.readCount() != 1 {
+        t.Fatalf("Get of a fresh value: %s, %d reads", value, s.readCount())
+    }
+    // A stale value is returned too, and refreshed in the background
+    time.Sleep(60 * time.Millisecond)
+    if value := get(); value != "100" {
+        t.Fatalf("Get of a stale value: %s, the cached value expected", value)
+    }
+    waitFor(t, func() bool {
+        return get() == "200"
+    })
+
+    // A failed refresh keeps the value until HardTTL, then the read waits for the source and fails
+    s.set("overrides:acme", "300", errors.New("connection refused"))
+    time.Sleep(60 * time.Millisecond)
+    if value := get(); value != "200" {
+        t.Fatalf("Get while the source fails: %s, the cached value expected", value)
+    }
+    time.Sleep(200 * time.Millisecond)
+    if _, err := cache.Get(ctx, "overrides:acme"); err == nil {
+        t.Fatalf("Get of an expired value while the source fails: the error of the source expected")
+    }
+}
+
+func TestRefreshAheadCacheMissingKeys(t *testing.T) {
+    s := &source{values: map[string]string{}}
+    cache := NewRefreshAheadCache(CacheFunc(s.Get), RefreshConfig{})
+    for range 3 {
+        if _, err := cache.Get(context.Background(), "overrides:acme"); !errors.Is(err, ErrKeyNotFound) {
+            t.Fatalf("Get: %v, ErrKeyNotFound expected", err)
+        }
+    }
+    if s.readCount() != 1 {
+        t.Fatalf("%d reads, the missing key cached expected", s.readCount())
+    }
+}
+
+func TestRefreshAheadCacheRefreshesOnce(t *testing.T) {
+    s := &source{values: map[string]string{"overrides:acme": "100"}}
+    cache := NewRefreshAheadCache(CacheFunc(s.Get), RefreshConfig{SoftTTL: time.Nanosecond})
+    ctx := context.Background()
+    if _, err := cache.Get(ctx, "overrides:acme"); err != nil {
+        t.Fatalf("Get: %v", err)
+    }
+    c := cache.(*refreshAheadCache)
+    c.mu.Lock()
+    // A refresh in flight
+    c.entries["overrides:acme"].refreshing = true
+    c.mu.Unlock()
+    for range 10 {
+        if _, err := cache.Get(ctx, "overrides:acme"); err != nil {
+            t.Fatalf("Get: %v", err)
+        }
+    }
+    if s.readCount() != 1 {
+        t.Fatalf("%d reads, no other refresh expected", s.readCount())
+    }
+}
@@ -0,0 +1,99 @@
+package compression
+
+import (
+    "bytes"
+    "compress/gzip"
+    "context"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/compress"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strconv"
+    "strings"
+)
+
+type CompressionConfig struct {
+    // Level of the gzip compression, from 1 for the fastest to 9 for the smallest
+    //
+    // Defaults to 6 if not specified
+    Level int `json:"level,omitempty"`
+    // MinSize in bytes of the responses compressed, smaller ones don't shrink enough to be worth it
+    //
+    // Defaults to 1KiB if not specified
+    MinSize int `json:"min_size,omitempty"`
+    // ContentTypes compressed, matched as prefixes of the Content-Type of the responses
+    //
+    // Defaults to text/, application/json, application/javascript, application/xml and image/svg+xml if not specified
+    ContentTypes []string `json:"content_types,omitempty"`
+}
+
+// Compression gzips the responses of the clients accepting it.
+type Compression struct {
+    config CompressionConfig
+}
+
+// NewCompression creates the compression middleware of the configuration.
+func NewCompression(config CompressionConfig) (*Compression, error) {
+    if config.Level == 0 {
+        config.Level = 6
+    }
+    if config.Level < gzip.BestSpeed || config.Level > gzip.BestCompression {
+        return nil, fmt.Errorf("invalid gzip level %d", config.Level)
+    }
+    if config.MinSize == 0 {
+        config.MinSize = 1 << 10
+    }
+    if len(config.ContentTypes) == 0 {
+        config.ContentTypes = []string{"text/", "application/json", "application/javascript", "application/xml", "image/svg+xml"}
+    }
+    return &Compression{config: config}, nil
+}
+
+// Middleware compresses the response of the next handlers once they are done, so it should run before the handlers
+// and the middlewares writing the responses, e.g. the proxy and its cache. The streamed responses and the ones
+// already encoded, e.g. by the upstream, are left as they are.
+func (cp *Compression) Middleware(ctx context.Context, c *app.RequestContext) {
+    c.Next(ctx)
+    resp := &c.Response
+    if !acceptsGzip(c.GetHeader("Accept-Encoding")) || string(c.Method()) == consts.MethodHead || resp.IsBodyStream() ||
+        len(resp.Header.ContentEncoding()) > 0 || len(resp.Body()) < cp.config.MinSize || !cp.compressible(resp.Header.ContentType()) {
+        return
+    }
+    resp.SetBody(compress.AppendGzipBytesLevel(nil, resp.Body(), cp.config.Level))
+    resp.Header.SetContentEncoding("gzip")
+    resp.Header.Add("Vary", "Accept-Encoding")
+}
+
+func (cp *Compression) compressible(contentType []byte) bool {
+    for _, prefix := range cp.config.ContentTypes {
+        if bytes.HasPrefix(contentType, []byte(prefix)) {
+            return true
+        }
+    }
+    return false
+}
+
+// acceptsGzip tells if the Accept-Encoding header accepts gzip, not refused with q=0. An explicit gzip takes
+// precedence over *.
+func acceptsGzip(header []byte) bool {
+    accepted := false
+    for _, coding := range strings.Split(string(header), ",") {
+        name, params, _ := strings.Cut(coding, ";")
+        name = strings.TrimSpace(name)
+        if name != "gzip" && name != "*" {
+            continue
+        }
+        weight := 1.0
+        if _, q, found := strings.Cut(strings.ReplaceAll(params, " ", ""), "q="); found {
+            var err error
+            if weight, err = strconv.ParseFloat(q, 64); err != nil {
+                weight = 0
+            }
+        }
+        if name == "gzip" {
+            return weight > 0
+        }
+        accepted = weight > 0
+    }
+    return accepted
+}
@@ -0,0 +1,99 @@
+package compression
+
+import (
+    "bytes"
+    "compress/gzip"
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "io"
+    "strings"
+    "testing"
+)
+
+// serve runs the middleware before a handler answering the body with the content type.
+func serve(cp *Compression, method, acceptEncoding, contentType, body string) *app.RequestContext {
+    c := app.NewContext(0)
+    c.Request.SetMethod(method)
+    if acceptEncoding != "" {
+        c.Request.Header.Set("Accept-Encoding", acceptEncoding)
+    }
+    c.SetHandlers(app.HandlersChain{func(ctx context.Context, c *app.RequestContext) {
+        c.Data(200, contentType, []byte(body))
+    }})
+    cp.Middleware(context.Background(), c)
+    return c
+}
+
+func TestCompression(t *testing.T) {
+    cp, err := NewCompression(CompressionConfig{})
+    if err != nil {
+        t.Fatalf("NewCompression: %v", err)
+    }
+    large := strings.Repeat(`{"id":1042,"name":"ada"}`, 100)
+
+    c := serve(cp, "GET", "br, gzip", "application/json; charset=utf-8", large)
+    if string(c.Response.Header.ContentEncoding()) != "gzip" || string(c.Response.Header.Peek("Vary")) != "Accept-Encoding" {
+        t.Fatalf("headers %s, gzip expected", c.Response.Header.Header())
+    }
+    r, err := gzip.NewReader(bytes.NewReader(c.Response.Body()))
+    if err != nil {
+        t.Fatalf("gzip: %v", err)
+    }
+    if body, err := io.ReadAll(r); err != nil || string(body) != large {
+        t.Fatalf("decompressed body %.20q, %v", body, err)
+    }
+
+    for _, test := range []struct {
+        name, method, acceptEncoding, contentType, body string
+    }{
+        {"no gzip", "GET", "br", "application/json", large},
+        {"gzip refused", "GET", "gzip;q=0, *", "application/json", large},
+        {"head", "HEAD", "gzip", "application/json", large},
+        {"small", "GET", "gzip", "application/json", `{"id":1042}`},
+        {"image", "GET", "gzip", "image/png", large},
+    } {
+        c := serve(cp, test.method, test.acceptEncoding, test.contentType, test.body)
+        if len(c.Response.Header.ContentEncoding()) > 0 || string(c.Response.Body()) != test.body {
+            t.Fatalf("%s: compressed", test.name)
+        }
+    }
+
+    // The responses already encoded are left as they are
+    c = app.NewContext(0)
+    c.Request.Header.Set("Accept-Encoding", "gzip")
+    c.SetHandlers(app.HandlersChain{func(ctx context.Context, c *app.RequestContext) {
+        c.Response.Header.SetContentEncoding("br")
+        c.Data(200, "application/json", []byte(large))
+    }})
+    cp.Middleware(context.Background(), c)
+    if string(c.Response.Header.ContentEncoding()) != "br" || string(c.Response.Body()) != large {
+        t.Fatalf("encoded response compressed again: %s", c.Response.Header.Header())
+    }
+}
+
+func TestAcceptsGzip(t *testing.T) {
+    for header, accepted := range map[string]bool{
+        "":                false,
+        "gzip":            true,
+        "deflate, gzip":   true,
+        "gzip;q=0.5":      true,
+        "gzip; q=0":       false,
+        "gzip;q=invalid":  false,
+        "*":               true,
+        "*;q=0":           false,
+        "*;q=0, gzip":     true,
+        "gzip;q=0, *":     false,
+        "identity, br":    false,
+        "x-gzip, deflate": false,
+    } {
+        if acceptsGzip([]byte(header)) != accepted {
+            t.Fatalf("%q: %t expected", header, accepted)
+        }
+    }
+}
+
+func TestNewCompressionRejectsInvalidLevel(t *testing.T) {
+    if _, err := NewCompression(CompressionConfig{Level: 10}); err == nil {
+        t.Fatalf("invalid level accepted")
+    }
+}
@@ -0,0 +1,127 @@
+package config_history
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is one applied version of the limiter configuration.
+type Revision struct {
+    // Version is a sequence number increasing with every applied configuration
+    Version int64                         `json:"version"`
+    Config  ratelimiter.RateLimiterConfig `json:"config"`
+    // Author is the identity of the admin API caller who applied the configuration
+    Author    string    `json:"author"`
+    AppliedAt time.Time `json:"applied_at"`
+    Comment   string    `json:"comment,omitempty"`
+    // RollbackOf is the version restored by this revision, 0 if it is not a rollback
+    RollbackOf int64 `json:"rollback_of,omitempty"`
+}
+
+// ApplyFunc applies a version of the configuration, e.g. RateLimiter.UpdateConfig or the SetConfig of the control plane.
+type ApplyFunc func(version string, config ratelimiter.RateLimiterConfig) error
+
+// History interface defines the methods for applying configurations while keeping the last ones for rollbacks.
+type History interface {
+    // Apply validates and applies the configuration, then records it as a new revision
+    Apply(ctx context.Context, config ratelimiter.RateLimiterConfig, author, comment string) (Revision, error)
+    // Rollback applies the configuration of a previous revision again, recording it as a new revision
+    Rollback(ctx context.Context, version int64, author string) (Revision, error)
+    // List returns the kept revisions, most recent first
+    List(ctx context.Context) ([]Revision, error)
+}
+
+type redisHistory struct {
+    client radix.Client
+    key    string
+    size   int
+    apply  ApplyFunc
+}
+
+// NewRedisHistory creates a History keeping the last size revisions in a Redis list.
+func NewRedisHistory(client radix.Client, key string, size int, apply ApplyFunc) History {
+    return &redisHistory{
+        client: client,
+        key:    key,
+        size:   size,
+        apply:  apply,
+    }
+}
+
+func (h *redisHistory) Apply(ctx context.Context, config ratelimiter.RateLimiterConfig, author, comment string) (Revision, error) {
+    return h.record(ctx, Revision{
+        Config:  config,
+        Author:  author,
+        Comment: comment,
+    })
+}
+
+func (h *redisHistory) Rollback(ctx context.Context, version int64, author string) (Revision, error) {
+    revisions, err := h.List(ctx)
+    if err != nil {
+        return Revision{}, err
+    }
+    for _, r := range revisions {
+        if r.Version != version {
+            continue
+        }
+        return h.record(ctx, Revision{
+            Config:     r.Config,
+            Author:     author,
+            Comment:    fmt.Sprintf("rollback to version %d", version),
+            RollbackOf: version,
+        })
+    }
+    return Revision{}, fmt.Errorf("failed to roll back to version %d: %w", version, ErrRevisionNotFound)
+}
+
+func (h *redisHistory) List(ctx context.Context) ([]Revision, error) {
+    var values []string
+    if err := h.client.Do(ctx, radix.FlatCmd(&values, "LRANGE", h.key, 0, h.size-1)); err != nil {
+        return nil, fmt.Errorf("failed to list revisions %s: %w", h.key, err)
+    }
+    revisions := make([]Revision, 0, len(values))
+    for _, v := range values {
+        var r Revision
+        if err := json.Unmarshal([]byte(v), &r); err != nil {
+            return nil, fmt.Errorf("failed to decode revision: %w", err)
+        }
+        revisions = append(revisions, r)
+    }
+    return revisions, nil
+}
+
+// record applies the configuration of the revision and pushes it to the history, trimming the oldest revisions.
+func (h *redisHistory) record(ctx context.Context, r Revision) (Revision, error) {
+    if err := r.Config.Validate(); err != nil {
+        return Revision{}, fmt.Errorf("invalid configuration: %w", err)
+    }
+    if err := h.client.Do(ctx, radix.Cmd(&r.Version, "INCR", h.key+":version")); err != nil {
+        return Revision{}, fmt.Errorf("failed to allocate revision version: %w", err)
+    }
+    r.AppliedAt = time.Now().UTC()
+    if err := h.apply(strconv.FormatInt(r.Version, 10), r.Config); err != nil {
+        return Revision{}, fmt.Errorf("failed to apply version %d: %w", r.Version, err)
+    }
+
+    value, err := json.Marshal(r)
+    if err != nil {
+        return Revision{}, fmt.Errorf("failed to encode revision: %w", err)
+    }
+    p := radix.NewPipeline()
+    p.Append(radix.Cmd(nil, "LPUSH", h.key, string(value)))
+    p.Append(radix.FlatCmd(nil, "LTRIM", h.key, 0, h.size-1))
+    if err = h.client.Do(ctx, p); err != nil {
+        // The configuration is live, only the audit trail is missing the revision
+        return r, fmt.Errorf("applied version %d but failed to record it: %w", r.Version, err)
+    }
+    return r, nil
+}
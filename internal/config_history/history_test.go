@@ -0,0 +1,98 @@
+package config_history
+
+import (
+    "context"
+    "errors"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/mediocregopher/radix/v4"
+    "testing"
+    "time"
+)
+
+// applied records the configurations applied by the history.
+type applied struct {
+    versions []string
+    configs  []ratelimiter.RateLimiterConfig
+    err      error
+}
+
+func (a *applied) apply(version string, config ratelimiter.RateLimiterConfig) error {
+    if a.err != nil {
+        return a.err
+    }
+    a.versions = append(a.versions, version)
+    a.configs = append(a.configs, config)
+    return nil
+}
+
+func newHistory(t *testing.T, size int) (History, *applied) {
+    t.Helper()
+    mr := miniredis.RunT(t)
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    a := &applied{}
+    return NewRedisHistory(client, "ratelimiter:config:history", size, a.apply), a
+}
+
+func limit(maxRequests int) ratelimiter.RateLimiterConfig {
+    return ratelimiter.RateLimiterConfig{
+        "/api": {MaxRequests: maxRequests, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+    }
+}
+
+func TestHistory(t *testing.T) {
+    h, a := newHistory(t, 3)
+    ctx := context.Background()
+    for i, maxRequests := range []int{10, 20, 30, 40} {
+        r, err := h.Apply(ctx, limit(maxRequests), "ada", "")
+        if err != nil || r.Version != int64(i+1) || r.Author != "ada" || r.AppliedAt.IsZero() {
+            t.Fatalf("Apply %d: %+v, %v", i, r, err)
+        }
+    }
+    if len(a.versions) != 4 || a.versions[3] != "4" {
+        t.Fatalf("applied versions %v", a.versions)
+    }
+
+    // The oldest revisions are trimmed, the most recent come first
+    revisions, err := h.List(ctx)
+    if err != nil || len(revisions) != 3 || revisions[0].Version != 4 || revisions[2].Version != 2 {
+        t.Fatalf("List: %+v, %v, versions 4 to 2 expected", revisions, err)
+    }
+
+    r, err := h.Rollback(ctx, 2, "grace")
+    if err != nil || r.Version != 5 || r.RollbackOf != 2 || r.Author != "grace" || r.Config["/api"].MaxRequests != 20 {
+        t.Fatalf("Rollback: %+v, %v", r, err)
+    }
+    if a.configs[len(a.configs)-1]["/api"].MaxRequests != 20 {
+        t.Fatalf("applied %+v, the configuration of version 2 expected", a.configs[len(a.configs)-1])
+    }
+    // Version 1 was trimmed
+    if _, err := h.Rollback(ctx, 1, "grace"); !errors.Is(err, ErrRevisionNotFound) {
+        t.Fatalf("Rollback to a trimmed version: %v, ErrRevisionNotFound expected", err)
+    }
+}
+
+func TestHistoryRejects(t *testing.T) {
+    h, a := newHistory(t, 3)
+    ctx := context.Background()
+    invalid := ratelimiter.RateLimiterConfig{
+        "/api": {MaxRequests: 10, TimeWindow: time.Second, SlidingWindowInterval: time.Minute},
+    }
+    if _, err := h.Apply(ctx, invalid, "ada", ""); err == nil {
+        t.Fatalf("invalid configuration applied")
+    }
+    a.err = errors.New("control plane unavailable")
+    if _, err := h.Apply(ctx, limit(10), "ada", ""); err == nil {
+        t.Fatalf("Apply: the error of the apply function expected")
+    }
+    // Neither configuration is recorded
+    if revisions, err := h.List(ctx); err != nil || len(revisions) != 0 {
+        t.Fatalf("List: %+v, %v, no revision expected", revisions, err)
+    }
+}
@@ -0,0 +1,192 @@
+package config_sync
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "google.golang.org/grpc"
+    "log/slog"
+    "maps"
+    "os"
+    "slices"
+    "time"
+)
+
+type ClientConfig struct {
+    // NodeID identifies the limiter instance in the control plane logs
+    NodeID string `json:"node_id"`
+    // LastKnownGoodPath is a file where the last applied configuration is saved and loaded from on startup, so the
+    // instance keeps enforcing it while the control plane is unreachable
+    //
+    // Defaults to no persistence if not specified
+    LastKnownGoodPath string `json:"last_known_good_path,omitempty"`
+    // RetryInterval is the delay before reconnecting to the control plane after the stream failed
+    //
+    // Defaults to 5 seconds if not specified
+    RetryInterval time.Duration `json:"retry_interval,omitempty"`
+}
+
+// lastKnownGood is the content of ClientConfig.LastKnownGoodPath.
+type lastKnownGood struct {
+    Version       string                        `json:"version"`
+    Config        ratelimiter.RateLimiterConfig `json:"config"`
+    SchemaVersion int                           `json:"schema_version,omitempty"`
+}
+
+type subscriber struct {
+    conn    grpc.ClientConnInterface
+    config  ClientConfig
+    limiter ratelimiter.RateLimiter
+    version string
+    current ratelimiter.RateLimiterConfig
+    schema  int // Schema of current, newer than SchemaVersion if it has unknown fields
+}
+
+// Subscribe streams the configuration from the control plane into the limiter until the context is cancelled.
+//
+// Every response is validated before being applied and acknowledged, an invalid one is rejected with a NACK and the
+// limiter keeps its last known good configuration. The stream is re-established after RetryInterval when it fails.
+func Subscribe(ctx context.Context, conn grpc.ClientConnInterface, config ClientConfig, limiter ratelimiter.RateLimiter) error {
+    if config.RetryInterval == 0 {
+        config.RetryInterval = 5 * time.Second
+    }
+    s := &subscriber{
+        conn:    conn,
+        config:  config,
+        limiter: limiter,
+    }
+    if err := s.loadLastKnownGood(); err != nil {
+        slog.Warn("Error loading last known good configuration", "path", config.LastKnownGoodPath, "error", err)
+    }
+    for {
+        err := s.stream(ctx)
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        slog.Error("Config stream failed, keeping the last known good configuration", "version", s.version, "error", err)
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(config.RetryInterval):
+        }
+    }
+}
+
+func (s *subscriber) stream(ctx context.Context) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    stream, err := s.conn.NewStream(ctx, &streamDesc, streamMethod, grpc.CallContentSubtype(codecName))
+    if err != nil {
+        return fmt.Errorf("failed to open config stream: %w", err)
+    }
+    if err = stream.SendMsg(&DiscoveryRequest{NodeID: s.config.NodeID, VersionInfo: s.version, SchemaVersion: SchemaVersion}); err != nil {
+        return fmt.Errorf("failed to subscribe: %w", err)
+    }
+    for {
+        var resp DiscoveryResponse
+        if err = stream.RecvMsg(&resp); err != nil {
+            return err
+        }
+        ack := &DiscoveryRequest{NodeID: s.config.NodeID, ResponseNonce: resp.Nonce, SchemaVersion: SchemaVersion}
+        if err = s.apply(&resp); err != nil {
+            slog.Warn("Rejecting configuration", "version", resp.VersionInfo, "error", err)
+            ack.ErrorDetail = err.Error()
+        }
+        ack.VersionInfo = s.version
+        if err = stream.SendMsg(ack); err != nil {
+            return fmt.Errorf("failed to acknowledge version %s: %w", resp.VersionInfo, err)
+        }
+    }
+}
+
+// apply builds the configuration from a snapshot or a delta, validates it and swaps it into the limiter.
+func (s *subscriber) apply(resp *DiscoveryResponse) error {
+    next := resp.Config
+    if resp.Delta {
+        if s.current == nil {
+            return errors.New("received a delta without a base configuration")
+        }
+        next = maps.Clone(s.current)
+        maps.Copy(next, resp.Config)
+        for _, endpoint := range resp.Removed {
+            delete(next, endpoint)
+        }
+    }
+    if next == nil {
+        next = ratelimiter.RateLimiterConfig{}
+    }
+    if err := next.Validate(); err != nil {
+        return err
+    }
+    warnUnknownFields(resp.VersionInfo, resp.SchemaVersion, resp.Config)
+    s.limiter.UpdateConfig(next)
+    s.version = resp.VersionInfo
+    s.current = next
+    if !resp.Delta || resp.SchemaVersion > s.schema {
+        // The endpoints of a delta not updated keep the fields of the previous schema
+        s.schema = resp.SchemaVersion
+    }
+    if err := s.saveLastKnownGood(); err != nil {
+        slog.Warn("Error saving last known good configuration", "path", s.config.LastKnownGoodPath, "error", err)
+    }
+    return nil
+}
+
+// warnUnknownFields warns about the fields of a configuration newer than this instance, which are kept but not
+// enforced until the instance is upgraded.
+func warnUnknownFields(version string, schemaVersion int, config ratelimiter.RateLimiterConfig) {
+    if schemaVersion <= SchemaVersion {
+        return
+    }
+    unknown := make(map[string]struct{})
+    for _, conf := range config {
+        for name := range conf.Unknown {
+            unknown[name] = struct{}{}
+        }
+    }
+    slog.Warn("Configuration has a newer schema, the unknown fields are not enforced", "version", version, "schema_version", schemaVersion, "fields", slices.Sorted(maps.Keys(unknown)))
+}
+
+func (s *subscriber) loadLastKnownGood() error {
+    if s.config.LastKnownGoodPath == "" {
+        return nil
+    }
+    data, err := os.ReadFile(s.config.LastKnownGoodPath)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    var lkg lastKnownGood
+    if err = json.Unmarshal(data, &lkg); err != nil {
+        return err
+    }
+    if err = lkg.Config.Validate(); err != nil {
+        return err
+    }
+    warnUnknownFields(lkg.Version, lkg.SchemaVersion, lkg.Config)
+    s.limiter.UpdateConfig(lkg.Config)
+    s.version = lkg.Version
+    s.current = lkg.Config
+    s.schema = lkg.SchemaVersion
+    return nil
+}
+
+func (s *subscriber) saveLastKnownGood() error {
+    if s.config.LastKnownGoodPath == "" {
+        return nil
+    }
+    data, err := json.Marshal(lastKnownGood{Version: s.version, Config: s.current, SchemaVersion: s.schema})
+    if err != nil {
+        return err
+    }
+    // Write to a temporary file first so a crash never leaves a truncated configuration behind
+    tmp := s.config.LastKnownGoodPath + ".tmp"
+    if err = os.WriteFile(tmp, data, 0o644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, s.config.LastKnownGoodPath)
+}
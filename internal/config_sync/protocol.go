@@ -0,0 +1,97 @@
+package config_sync
+
+import (
+    "encoding/json"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/encoding"
+)
+
+// codecName is the gRPC content-subtype of the protocol, messages are plain JSON so no generated code is needed.
+const codecName = "json"
+
+const (
+    serviceName = "configsync.v1.ConfigDiscoveryService"
+    streamName  = "StreamConfig"
+    // streamMethod is the full method name of the bidirectional config stream
+    streamMethod = "/" + serviceName + "/" + streamName
+)
+
+// SchemaVersion is the version of the encoding of the configuration understood by this version of the protocol.
+//
+// A version only adds optional fields, so the versions are compatible both ways: the fields missing from an older
+// configuration take their defaults, and the fields unknown to an older instance are ignored but kept, see
+// ratelimiter.EndpointConfig.Unknown. A fleet can then be upgraded gradually while the control plane pushes the newer
+// encoding.
+//
+// - 1: the RateLimiterConfig with the durations in nanoseconds, 0 for the peers predating the versioning
+const SchemaVersion = 1
+
+// DiscoveryRequest is sent by a limiter instance to subscribe, and then to ACK or NACK every DiscoveryResponse.
+type DiscoveryRequest struct {
+    // NodeID identifies the limiter instance
+    NodeID string `json:"node_id"`
+    // VersionInfo is the last version successfully applied by the instance, empty before the first ACK
+    VersionInfo string `json:"version_info,omitempty"`
+    // ResponseNonce is the nonce of the DiscoveryResponse this request acknowledges, empty for the initial request
+    ResponseNonce string `json:"response_nonce,omitempty"`
+    // ErrorDetail is set when the instance rejected the response (NACK), it keeps running VersionInfo
+    ErrorDetail string `json:"error_detail,omitempty"`
+    // SchemaVersion is the newest schema of the configuration the instance understands
+    SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// DiscoveryResponse carries either a full snapshot of the configuration or a delta against the last ACKed version.
+type DiscoveryResponse struct {
+    // VersionInfo is the version of the configuration after this response is applied
+    VersionInfo string `json:"version_info"`
+    // Nonce identifies the response in the following DiscoveryRequest
+    Nonce string `json:"nonce"`
+    // Delta is true when Config only contains the updated endpoints and Removed the deleted ones
+    Delta bool `json:"delta,omitempty"`
+    // Config is the full configuration, or the added and updated endpoints when Delta is set
+    Config ratelimiter.RateLimiterConfig `json:"config"`
+    // Removed lists the endpoints deleted since the last ACKed version
+    Removed []string `json:"removed,omitempty"`
+    // SchemaVersion is the schema Config is encoded with
+    SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+// jsonCodec encodes the protocol messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+    return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+    return codecName
+}
+
+func init() {
+    encoding.RegisterCodec(jsonCodec{})
+}
+
+// configDiscoveryServer is the interface implemented by the control plane.
+type configDiscoveryServer interface {
+    StreamConfig(stream grpc.ServerStream) error
+}
+
+var streamDesc = grpc.StreamDesc{
+    StreamName:    streamName,
+    ServerStreams: true,
+    ClientStreams: true,
+    Handler: func(srv any, stream grpc.ServerStream) error {
+        return srv.(configDiscoveryServer).StreamConfig(stream)
+    },
+}
+
+var serviceDesc = grpc.ServiceDesc{
+    ServiceName: serviceName,
+    HandlerType: (*configDiscoveryServer)(nil),
+    Streams:     []grpc.StreamDesc{streamDesc},
+}
@@ -0,0 +1,192 @@
+package config_sync
+
+import (
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "google.golang.org/grpc"
+    "log/slog"
+    "reflect"
+    "strconv"
+    "sync"
+    "sync/atomic"
+)
+
+// Server is the control plane pushing the limiter configuration to the subscribed instances.
+type Server interface {
+    // Register adds the config discovery service to the gRPC server
+    Register(s *grpc.Server)
+    // SetConfig publishes a new version of the configuration to every subscribed instance
+    SetConfig(version string, config ratelimiter.RateLimiterConfig) error
+}
+
+type snapshot struct {
+    version string
+    config  ratelimiter.RateLimiterConfig
+}
+
+type server struct {
+    mu          sync.Mutex
+    current     snapshot
+    subscribers map[chan struct{}]struct{} // Notified when a new version is published
+    nonce       atomic.Uint64
+}
+
+// NewServer creates a control plane serving the given initial version of the configuration.
+func NewServer(version string, config ratelimiter.RateLimiterConfig) (Server, error) {
+    if err := config.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid configuration %s: %w", version, err)
+    }
+    return &server{
+        current:     snapshot{version: version, config: config},
+        subscribers: make(map[chan struct{}]struct{}),
+    }, nil
+}
+
+func (s *server) Register(gs *grpc.Server) {
+    gs.RegisterService(&serviceDesc, s)
+}
+
+func (s *server) SetConfig(version string, config ratelimiter.RateLimiterConfig) error {
+    if err := config.Validate(); err != nil {
+        return fmt.Errorf("invalid configuration %s: %w", version, err)
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.current = snapshot{version: version, config: config}
+    for notify := range s.subscribers {
+        select {
+        case notify <- struct{}{}:
+        default:
+            // A notification is already pending, the stream will pick up the latest version
+        }
+    }
+    return nil
+}
+
+func (s *server) subscribe() (chan struct{}, func()) {
+    notify := make(chan struct{}, 1)
+    s.mu.Lock()
+    s.subscribers[notify] = struct{}{}
+    s.mu.Unlock()
+    return notify, func() {
+        s.mu.Lock()
+        delete(s.subscribers, notify)
+        s.mu.Unlock()
+    }
+}
+
+func (s *server) snapshot() snapshot {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.current
+}
+
+// StreamConfig serves one limiter instance: it sends the configuration whenever a new version is published and
+// tracks which version the instance acknowledged, so following updates are sent as deltas.
+func (s *server) StreamConfig(stream grpc.ServerStream) error {
+    var first DiscoveryRequest
+    if err := stream.RecvMsg(&first); err != nil {
+        return err
+    }
+    nodeID := first.NodeID
+    if first.SchemaVersion < SchemaVersion {
+        slog.Warn("Subscriber runs an older config schema, the fields it doesn't know are not enforced", "node_id", nodeID, "schema_version", first.SchemaVersion)
+    }
+
+    requests := make(chan DiscoveryRequest)
+    recvErr := make(chan error, 1)
+    go func() {
+        for {
+            var req DiscoveryRequest
+            if err := stream.RecvMsg(&req); err != nil {
+                recvErr <- err
+                return
+            }
+            select {
+            case requests <- req:
+            case <-stream.Context().Done():
+                return
+            }
+        }
+    }()
+
+    notify, unsubscribe := s.subscribe()
+    defer unsubscribe()
+    select {
+    case notify <- struct{}{}:
+    default:
+        // SetConfig already notified the stream since it subscribed
+    }
+
+    // A reconnecting instance always starts with a full snapshot, whatever version it reports
+    var (
+        acked   *snapshot // Last configuration applied by the instance
+        pending *snapshot // Configuration sent and waiting for an ACK or NACK
+        nonce   string
+    )
+    for {
+        select {
+        case <-stream.Context().Done():
+            return stream.Context().Err()
+        case err := <-recvErr:
+            return err
+        case req := <-requests:
+            if req.ResponseNonce != nonce || pending == nil {
+                // Stale acknowledgement of a response superseded by a newer one
+                continue
+            }
+            if req.ErrorDetail != "" {
+                slog.Warn("Config rejected by subscriber", "node_id", nodeID, "version", pending.version, "error", req.ErrorDetail)
+            } else {
+                acked = pending
+            }
+            pending = nil
+        case <-notify:
+            current := s.snapshot()
+            if pending != nil && pending.version == current.version || acked != nil && acked.version == current.version {
+                continue
+            }
+            base := acked
+            if pending != nil {
+                // The instance may or may not apply the unacknowledged response, only a snapshot is safe
+                base = nil
+            }
+            nonce = strconv.FormatUint(s.nonce.Add(1), 10)
+            resp := buildResponse(base, current, nonce)
+            if err := stream.SendMsg(resp); err != nil {
+                return err
+            }
+            pending = &current
+        }
+    }
+}
+
+// buildResponse returns a delta from the acknowledged configuration, or a full snapshot if nothing was acknowledged yet.
+func buildResponse(acked *snapshot, current snapshot, nonce string) *DiscoveryResponse {
+    if acked == nil {
+        return &DiscoveryResponse{
+            VersionInfo:   current.version,
+            Nonce:         nonce,
+            Config:        current.config,
+            SchemaVersion: SchemaVersion,
+        }
+    }
+    resp := &DiscoveryResponse{
+        VersionInfo:   current.version,
+        Nonce:         nonce,
+        Delta:         true,
+        Config:        ratelimiter.RateLimiterConfig{},
+        SchemaVersion: SchemaVersion,
+    }
+    for endpoint, conf := range current.config {
+        if previous, ok := acked.config[endpoint]; !ok || !reflect.DeepEqual(previous, conf) {
+            resp.Config[endpoint] = conf
+        }
+    }
+    for endpoint := range acked.config {
+        if _, ok := current.config[endpoint]; !ok {
+            resp.Removed = append(resp.Removed, endpoint)
+        }
+    }
+    return resp
+}
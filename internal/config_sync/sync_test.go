@@ -0,0 +1,198 @@
+package config_sync
+
+import (
+    "context"
+    "encoding/json"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/test/bufconn"
+    "net"
+    "os"
+    "path/filepath"
+    "slices"
+    "testing"
+    "time"
+)
+
+func endpoint(maxRequests int) ratelimiter.EndpointConfig {
+    return ratelimiter.EndpointConfig{MaxRequests: maxRequests, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}
+}
+
+func newLimiter(t *testing.T) ratelimiter.RateLimiter {
+    t.Helper()
+    limiter := ratelimiter.NewRateLimiter(ratelimiter.RateLimiterConfig{}, ratelimiterstore.NewMemoryStore(), nil)
+    t.Cleanup(func() {
+        _ = limiter.Close()
+    })
+    return limiter
+}
+
+// serve runs the control plane on an in-memory listener and returns a connection to it, and a function stopping it.
+func serve(t *testing.T, srv Server) (*grpc.ClientConn, func()) {
+    t.Helper()
+    lis := bufconn.Listen(1 << 20)
+    gs := grpc.NewServer()
+    srv.Register(gs)
+    go func() {
+        _ = gs.Serve(lis)
+    }()
+    conn, err := grpc.NewClient("passthrough:///control-plane",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+            return lis.DialContext(ctx)
+        }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatalf("NewClient: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = conn.Close()
+    })
+    return conn, gs.Stop
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatalf("timed out waiting for %s", what)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func endpoints(limiter ratelimiter.RateLimiter) []string {
+    var names []string
+    for name := range limiter.Config() {
+        names = append(names, name)
+    }
+    slices.Sort(names)
+    return names
+}
+
+func TestSubscribe(t *testing.T) {
+    srv, err := NewServer("v1", ratelimiter.RateLimiterConfig{"/login": endpoint(5), "/search": endpoint(100)})
+    if err != nil {
+        t.Fatalf("NewServer: %v", err)
+    }
+    conn, stop := serve(t, srv)
+    path := filepath.Join(t.TempDir(), "last-known-good.json")
+    limiter := newLimiter(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() {
+        done <- Subscribe(ctx, conn, ClientConfig{NodeID: "limiter-1", LastKnownGoodPath: path, RetryInterval: 10 * time.Millisecond}, limiter)
+    }()
+
+    waitFor(t, "the initial snapshot", func() bool {
+        return slices.Equal(endpoints(limiter), []string{"/login", "/search"})
+    })
+    // A version updating, adding and removing endpoints is applied as a delta
+    if err := srv.SetConfig("v2", ratelimiter.RateLimiterConfig{"/login": endpoint(3), "/upload": endpoint(10)}); err != nil {
+        t.Fatalf("SetConfig: %v", err)
+    }
+    waitFor(t, "v2", func() bool {
+        return slices.Equal(endpoints(limiter), []string{"/login", "/upload"}) && limiter.Config()["/login"].MaxRequests == 3
+    })
+    // An invalid version is never published
+    if err := srv.SetConfig("v3", ratelimiter.RateLimiterConfig{"/login": {MaxRequests: -1, TimeWindow: time.Minute}}); err == nil {
+        t.Fatalf("invalid configuration published")
+    }
+
+    waitFor(t, "the last known good configuration", func() bool {
+        data, err := os.ReadFile(path)
+        var lkg lastKnownGood
+        return err == nil && json.Unmarshal(data, &lkg) == nil && lkg.Version == "v2" && len(lkg.Config) == 2
+    })
+    cancel()
+    select {
+    case err := <-done:
+        if err != context.Canceled {
+            t.Fatalf("Subscribe: %v, context.Canceled expected", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("Subscribe still running after the context was cancelled")
+    }
+
+    // A restarted instance enforces the last known good configuration while the control plane is down
+    stop()
+    restarted := newLimiter(t)
+    ctx, cancel = context.WithCancel(context.Background())
+    defer cancel()
+    go func() {
+        _ = Subscribe(ctx, conn, ClientConfig{NodeID: "limiter-1", LastKnownGoodPath: path, RetryInterval: 10 * time.Millisecond}, restarted)
+    }()
+    waitFor(t, "the configuration of the last known good file", func() bool {
+        return slices.Equal(endpoints(restarted), []string{"/login", "/upload"})
+    })
+}
+
+func TestSubscriberRejects(t *testing.T) {
+    limiter := newLimiter(t)
+    s := &subscriber{limiter: limiter}
+    if err := s.apply(&DiscoveryResponse{VersionInfo: "v1", Delta: true, Config: ratelimiter.RateLimiterConfig{"/login": endpoint(5)}}); err == nil {
+        t.Fatalf("delta without a base configuration applied")
+    }
+    if err := s.apply(&DiscoveryResponse{VersionInfo: "v1", Config: ratelimiter.RateLimiterConfig{"/login": endpoint(5)}}); err != nil {
+        t.Fatalf("apply: %v", err)
+    }
+    invalid := ratelimiter.RateLimiterConfig{"/login": {MaxRequests: 5, TimeWindow: time.Second, SlidingWindowInterval: time.Minute}}
+    if err := s.apply(&DiscoveryResponse{VersionInfo: "v2", Config: invalid}); err == nil {
+        t.Fatalf("invalid configuration applied")
+    }
+    // The limiter keeps the last configuration it applied
+    if s.version != "v1" || limiter.Config()["/login"].TimeWindow != time.Minute {
+        t.Fatalf("version %s, config %+v, v1 expected", s.version, limiter.Config())
+    }
+}
+
+func TestBuildResponse(t *testing.T) {
+    acked := &snapshot{version: "v1", config: ratelimiter.RateLimiterConfig{"/login": endpoint(5), "/search": endpoint(100), "/upload": endpoint(10)}}
+    current := snapshot{version: "v2", config: ratelimiter.RateLimiterConfig{"/login": endpoint(3), "/search": endpoint(100), "/export": endpoint(1)}}
+
+    snapshot := buildResponse(nil, current, "1")
+    if snapshot.Delta || len(snapshot.Config) != 3 || snapshot.VersionInfo != "v2" || snapshot.Nonce != "1" {
+        t.Fatalf("snapshot %+v", snapshot)
+    }
+    delta := buildResponse(acked, current, "2")
+    if !delta.Delta || !slices.Equal(delta.Removed, []string{"/upload"}) {
+        t.Fatalf("delta %+v", delta)
+    }
+    if len(delta.Config) != 2 || delta.Config["/login"].MaxRequests != 3 || delta.Config["/export"].MaxRequests != 1 {
+        t.Fatalf("delta config %+v, /login and /export expected", delta.Config)
+    }
+}
+
+// The fields of a newer schema are kept in the last known good file, and a delta of an older schema doesn't downgrade
+// the endpoints it doesn't update.
+func TestSubscriberKeepsNewerSchemas(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "last-known-good.json")
+    s := &subscriber{config: ClientConfig{LastKnownGoodPath: path}, limiter: newLimiter(t)}
+    var resp DiscoveryResponse
+    if err := json.Unmarshal([]byte(`{"version_info":"v1","nonce":"1","schema_version":2,"config":{
+        "/login":{"max_requests":5,"time_window":60000000000,"sliding_window_interval":1000000000,"burst":10}}}`), &resp); err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    if err := s.apply(&resp); err != nil {
+        t.Fatalf("apply: %v", err)
+    }
+    if err := s.apply(&DiscoveryResponse{VersionInfo: "v2", Delta: true, SchemaVersion: 1, Config: ratelimiter.RateLimiterConfig{"/search": endpoint(100)}}); err != nil {
+        t.Fatalf("apply: %v", err)
+    }
+    if s.schema != 2 {
+        t.Fatalf("schema %d after an older delta, 2 expected", s.schema)
+    }
+
+    restarted := &subscriber{config: ClientConfig{LastKnownGoodPath: path}, limiter: newLimiter(t)}
+    if err := restarted.loadLastKnownGood(); err != nil {
+        t.Fatalf("loadLastKnownGood: %v", err)
+    }
+    if restarted.version != "v2" || restarted.schema != 2 || len(restarted.current) != 2 {
+        t.Fatalf("last known good %s, schema %d, %+v", restarted.version, restarted.schema, restarted.current)
+    }
+    if burst := string(restarted.current["/login"].Unknown["burst"]); burst != "10" {
+        t.Fatalf("burst %q, the unknown field must be kept", burst)
+    }
+}
@@ -0,0 +1,146 @@
+package cors
+
+import (
+    "context"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type CORSConfig struct {
+    // AllowOrigins are the origins allowed to call the API from a browser, e.g. https://app.example.com, "*" allows
+    // every origin and *.example.com the subdomains of example.com
+    AllowOrigins []string `json:"allow_origins"`
+    // AllowMethods allowed by the preflights
+    //
+    // Defaults to GET, HEAD, POST, PUT, PATCH and DELETE if not specified
+    AllowMethods []string `json:"allow_methods,omitempty"`
+    // AllowHeaders are the request headers allowed by the preflights
+    //
+    // Defaults to the headers the preflight asks for if not specified
+    AllowHeaders []string `json:"allow_headers,omitempty"`
+    // ExposeHeaders are the response headers the scripts can read besides the CORS-safelisted ones, e.g. the rate
+    // limit headers
+    ExposeHeaders []string `json:"expose_headers,omitempty"`
+    // AllowCredentials lets the browsers send the cookies and the Authorization header of the origin
+    AllowCredentials bool `json:"allow_credentials,omitempty"`
+    // MaxAge the browsers cache a preflight for
+    //
+    // Defaults to 10 minutes if not specified
+    MaxAge time.Duration `json:"max_age,omitempty"`
+}
+
+// CORS answers the preflights of the allowed origins and tells the browsers they may read the responses, see
+// https://fetch.spec.whatwg.org/#http-cors-protocol.
+type CORS struct {
+    config       CORSConfig
+    anyOrigin    bool
+    origins      map[string]struct{}
+    suffixes     []string // Of the *.example.com origins, with the leading dot
+    allowMethods string
+    allowHeaders string
+    expose       string
+    maxAge       string
+}
+
+// NewCORS creates the CORS middleware of the configuration.
+func NewCORS(config CORSConfig) (*CORS, error) {
+    if len(config.AllowMethods) == 0 {
+        config.AllowMethods = []string{consts.MethodGet, consts.MethodHead, consts.MethodPost, consts.MethodPut, consts.MethodPatch, consts.MethodDelete}
+    }
+    if config.MaxAge == 0 {
+        config.MaxAge = 10 * time.Minute
+    }
+    c := &CORS{
+        config:       config,
+        origins:      make(map[string]struct{}, len(config.AllowOrigins)),
+        allowMethods: strings.ToUpper(strings.Join(config.AllowMethods, ", ")),
+        allowHeaders: strings.Join(config.AllowHeaders, ", "),
+        expose:       strings.Join(config.ExposeHeaders, ", "),
+        maxAge:       strconv.FormatInt(int64(config.MaxAge/time.Second), 10),
+    }
+    for _, origin := range config.AllowOrigins {
+        switch {
+        case origin == "*":
+            c.anyOrigin = true
+        case strings.HasPrefix(origin, "*."):
+            c.suffixes = append(c.suffixes, strings.ToLower(origin[1:]))
+        case strings.Contains(origin, "*"):
+            return nil, fmt.Errorf("invalid origin %q, only a leading *. is supported", origin)
+        default:
+            c.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+        }
+    }
+    return c, nil
+}
+
+func (cr *CORS) allowed(origin string) bool {
+    if cr.anyOrigin {
+        return true
+    }
+    origin = strings.ToLower(origin)
+    if _, ok := cr.origins[origin]; ok {
+        return true
+    }
+    for _, suffix := range cr.suffixes {
+        if strings.HasSuffix(origin, suffix) {
+            return true
+        }
+    }
+    return false
+}
+
+// Middleware answers the preflights with 204, or 403 for an origin that is not allowed, without reaching the next
+// handlers, so it should run before the rate limiter and the authentication. The other requests of an allowed origin
+// get the CORS headers of their response.
+func (cr *CORS) Middleware(ctx context.Context, c *app.RequestContext) {
+    origin := string(c.GetHeader("Origin"))
+    if origin == "" {
+        c.Next(ctx)
+        return
+    }
+    c.Response.Header.Add("Vary", "Origin")
+    allowed := cr.allowed(origin)
+    preflight := string(c.Method()) == consts.MethodOptions && len(c.GetHeader("Access-Control-Request-Method")) > 0
+    if preflight {
+        if !allowed {
+            c.AbortWithStatusJSON(consts.StatusForbidden, utils.H{"error": "Origin not allowed"})
+            return
+        }
+        cr.setOrigin(c, origin)
+        c.Header("Access-Control-Allow-Methods", cr.allowMethods)
+        headers := cr.allowHeaders
+        if headers == "" {
+            headers = string(c.GetHeader("Access-Control-Request-Headers"))
+        }
+        if headers != "" {
+            c.Header("Access-Control-Allow-Headers", headers)
+        }
+        c.Header("Access-Control-Max-Age", cr.maxAge)
+        c.AbortWithStatus(consts.StatusNoContent)
+        return
+    }
+    if allowed {
+        cr.setOrigin(c, origin)
+        if cr.expose != "" {
+            c.Header("Access-Control-Expose-Headers", cr.expose)
+        }
+    }
+    c.Next(ctx)
+}
+
+// setOrigin allows the origin, the credentials can't be allowed to every origin with *.
+func (cr *CORS) setOrigin(c *app.RequestContext, origin string) {
+    if cr.anyOrigin && !cr.config.AllowCredentials {
+        c.Header("Access-Control-Allow-Origin", "*")
+        return
+    }
+    c.Header("Access-Control-Allow-Origin", origin)
+    if cr.config.AllowCredentials {
+        c.Header("Access-Control-Allow-Credentials", "true")
+    }
+}
@@ -0,0 +1,91 @@
+package cors
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "testing"
+)
+
+// serve runs the middleware before a handler answering 200, and returns the context of the request.
+func serve(cr *CORS, method string, headers ...string) *app.RequestContext {
+    c := app.NewContext(0)
+    c.Request.SetMethod(method)
+    for i := 0; i+1 < len(headers); i += 2 {
+        c.Request.Header.Set(headers[i], headers[i+1])
+    }
+    c.SetHandlers(app.HandlersChain{func(ctx context.Context, c *app.RequestContext) {
+        c.String(200, "handled")
+    }})
+    cr.Middleware(context.Background(), c)
+    return c
+}
+
+func TestCORS(t *testing.T) {
+    cr, err := NewCORS(CORSConfig{
+        AllowOrigins:     []string{"https://app.example.com/", "*.example.org"},
+        ExposeHeaders:    []string{"X-RateLimit-Remaining"},
+        AllowCredentials: true,
+    })
+    if err != nil {
+        t.Fatalf("NewCORS: %v", err)
+    }
+    for _, test := range []struct {
+        origin, allowOrigin string
+    }{
+        {"", ""},
+        {"https://app.example.com", "https://app.example.com"},
+        {"https://APP.example.com", "https://APP.example.com"},
+        {"https://admin.example.org", "https://admin.example.org"},
+        {"https://example.org", ""},
+        {"https://evilexample.org", ""},
+        {"https://app.example.com.evil.net", ""},
+    } {
+        c := serve(cr, "GET", "Origin", test.origin)
+        header := c.Response.Header.Get
+        // The other requests are handled whether the origin is allowed or not, the browser hides their response
+        if c.Response.StatusCode() != 200 || header("Access-Control-Allow-Origin") != test.allowOrigin {
+            t.Fatalf("%q: %d, allowed origin %q, %q expected", test.origin, c.Response.StatusCode(), header("Access-Control-Allow-Origin"), test.allowOrigin)
+        }
+        if test.allowOrigin != "" && (header("Access-Control-Allow-Credentials") != "true" ||
+            header("Access-Control-Expose-Headers") != "X-RateLimit-Remaining" || header("Vary") != "Origin") {
+            t.Fatalf("%q: headers %s", test.origin, c.Response.Header.Header())
+        }
+    }
+}
+
+func TestCORSPreflight(t *testing.T) {
+    cr, err := NewCORS(CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowMethods: []string{"get", "post"}})
+    if err != nil {
+        t.Fatalf("NewCORS: %v", err)
+    }
+    c := serve(cr, "OPTIONS", "Origin", "https://app.example.com", "Access-Control-Request-Method", "POST",
+        "Access-Control-Request-Headers", "Authorization, Content-Type")
+    header := c.Response.Header.Get
+    if c.Response.StatusCode() != 204 || string(c.Response.Body()) == "handled" || header("Access-Control-Allow-Methods") != "GET, POST" ||
+        header("Access-Control-Allow-Headers") != "Authorization, Content-Type" || header("Access-Control-Max-Age") != "600" {
+        t.Fatalf("preflight: %d %s", c.Response.StatusCode(), c.Response.Header.Header())
+    }
+    if c := serve(cr, "OPTIONS", "Origin", "https://evil.net", "Access-Control-Request-Method", "POST"); c.Response.StatusCode() != 403 {
+        t.Fatalf("preflight of another origin: %d, 403 expected", c.Response.StatusCode())
+    }
+    // An OPTIONS request without Access-Control-Request-Method is not a preflight
+    if c := serve(cr, "OPTIONS", "Origin", "https://app.example.com"); c.Response.StatusCode() != 200 {
+        t.Fatalf("OPTIONS: %d, 200 expected", c.Response.StatusCode())
+    }
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+    cr, _ := NewCORS(CORSConfig{AllowOrigins: []string{"*"}})
+    if c := serve(cr, "GET", "Origin", "https://app.example.com"); c.Response.Header.Get("Access-Control-Allow-Origin") != "*" {
+        t.Fatalf("allowed origin %q, * expected", c.Response.Header.Get("Access-Control-Allow-Origin"))
+    }
+    // The credentials can't be allowed with *, the origin is echoed instead
+    cr, _ = NewCORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+    if c := serve(cr, "GET", "Origin", "https://app.example.com"); c.Response.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+        t.Fatalf("allowed origin %q, the origin expected", c.Response.Header.Get("Access-Control-Allow-Origin"))
+    }
+
+    if _, err := NewCORS(CORSConfig{AllowOrigins: []string{"https://*.example.com"}}); err == nil {
+        t.Fatalf("invalid origin accepted")
+    }
+}
@@ -0,0 +1,204 @@
+package gateway
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/auth"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bootstrap"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bulkhead"
+    "github.com/aswinkm-tc/go-web-concepts/internal/compression"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "gopkg.in/yaml.v3"
+    "os"
+    "reflect"
+    "strings"
+    "time"
+)
+
+type GatewayConfig struct {
+    // Addr the gateway listens on
+    //
+    // Defaults to :8080 if not specified
+    Addr string `json:"addr,omitempty"`
+    // TrustedProxies are the CIDRs of the proxies in front of the gateway, e.g. 10.0.0.0/8 for a load balancer. The
+    // client IP is read from the X-Forwarded-For or X-Real-IP header they set, it is the remote address otherwise
+    //
+    // Defaults to no proxy if not specified, the requests are limited per remote address
+    TrustedProxies []string `json:"trusted_proxies,omitempty"`
+    // Redis holds the counters of the rate limiter and the cached token introspections
+    //
+    // Defaults to counting in memory per instance if not specified, the token introspection then requires it
+    Redis *bootstrap.RedisConfig `json:"redis,omitempty"`
+    // Routes forward the requests under their prefix to their upstreams, the longest matching prefix wins
+    Routes []RouteConfig `json:"routes"`
+    // Cache of the routes caching the responses of their upstreams
+    //
+    // Defaults to 10000 entries in memory if not specified
+    Cache bootstrap.CacheConfig `json:"cache,omitempty"`
+    // RateLimit limits the requests, per caller if they are authenticated
+    RateLimit *RateLimitConfig `json:"rate_limit,omitempty"`
+    // Auth authenticates the callers
+    Auth *AuthConfig `json:"auth,omitempty"`
+    // CORS lets the browsers of other origins call the gateway
+    CORS *cors.CORSConfig `json:"cors,omitempty"`
+    // Compression gzips the responses
+    Compression *compression.CompressionConfig `json:"compression,omitempty"`
+    // Bulkhead limits the requests forwarded at once
+    Bulkhead *bulkhead.BulkheadConfig `json:"bulkhead,omitempty"`
+    // Observability configures the access log, the metrics and the Server-Timing header
+    Observability ObservabilityConfig `json:"observability,omitempty"`
+}
+
+type RouteConfig struct {
+    // Prefix of the request paths forwarded, e.g. /api covers /api and /api/users
+    Prefix string `json:"prefix"`
+    // Proxy forwards the requests, they are cached when its cache is set, e.g. cache: {}
+    proxy.ProxyConfig
+}
+
+type RateLimitConfig struct {
+    // Endpoints are the limits of the request paths, each covering the paths under it like the route prefixes
+    Endpoints ratelimiter.RateLimiterConfig `json:"endpoints"`
+    // KeyPrefix of the Redis keys, for a Redis shared with other applications
+    KeyPrefix string `json:"key_prefix,omitempty"`
+    // StoreErrorPolicy of the endpoints without on_store_error when the store fails: allow, reject or local
+    //
+    // Defaults to allow if not specified
+    StoreErrorPolicy string `json:"store_error_policy,omitempty"`
+    // APIKeys identify the callers by their API key and apply the limits of their key
+    APIKeys *APIKeysConfig `json:"api_keys,omitempty"`
+}
+
+type APIKeysConfig struct {
+    ratelimiter.APIKeyConfig
+    // Keys and the callers they belong to
+    Keys ratelimiter.StaticKeyResolver `json:"keys"`
+}
+
+type AuthConfig struct {
+    // JWT verifies the bearer JWTs, the requests are limited per caller
+    JWT *auth.JWTConfig `json:"jwt,omitempty"`
+    // Introspection validates the opaque bearer tokens at the introspection endpoint, it requires Redis
+    Introspection *auth.IntrospectionConfig `json:"introspection,omitempty"`
+    // Required answers the requests without a valid JWT with 401, the introspection always requires a token
+    Required bool `json:"required,omitempty"`
+}
+
+type ObservabilityConfig struct {
+    // AccessLog logs every request with its status and duration
+    AccessLog bool `json:"access_log,omitempty"`
+    // StatsD receives the metrics of the rate limiter and the bulkhead
+    StatsD *metrics.StatsDConfig `json:"statsd,omitempty"`
+    // ServerTiming reports the time spent in each middleware stage
+    ServerTiming *servertiming.ServerTimingConfig `json:"server_timing,omitempty"`
+}
+
+// LoadFile reads a YAML GatewayConfig.
+func LoadFile(path string) (GatewayConfig, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return GatewayConfig{}, fmt.Errorf("failed to read configuration %s: %w", path, err)
+    }
+    var config GatewayConfig
+    if err := Unmarshal(data, &config); err != nil {
+        return GatewayConfig{}, fmt.Errorf("failed to decode configuration %s: %w", path, err)
+    }
+    return config, nil
+}
+
+// Unmarshal decodes YAML into the configuration types of the modules, with their JSON field names. The durations are
+// written like 1m30s rather than in nanoseconds.
+func Unmarshal(data []byte, v any) error {
+    var doc any
+    if err := yaml.Unmarshal(data, &doc); err != nil {
+        return err
+    }
+    doc, err := normalize(doc, reflect.TypeOf(v))
+    if err != nil {
+        return err
+    }
+    encoded, err := json.Marshal(doc)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(encoded, v)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// normalize converts the durations of the YAML document to nanoseconds, following the type it is decoded into.
+func normalize(doc any, t reflect.Type) (any, error) {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    switch v := doc.(type) {
+    case string:
+        if t != durationType {
+            return v, nil
+        }
+        d, err := time.ParseDuration(v)
+        if err != nil {
+            return nil, err
+        }
+        return int64(d), nil
+    case []any:
+        if t.Kind() != reflect.Slice {
+            return v, nil
+        }
+        for i, e := range v {
+            var err error
+            if v[i], err = normalize(e, t.Elem()); err != nil {
+                return nil, err
+            }
+        }
+        return v, nil
+    case map[string]any:
+        for key, e := range v {
+            field, ok := fieldType(t, key)
+            if !ok {
+                continue
+            }
+            var err error
+            if v[key], err = normalize(e, field); err != nil {
+                return nil, fmt.Errorf("%s: %w", key, err)
+            }
+        }
+        return v, nil
+    }
+    return doc, nil
+}
+
+// fieldType returns the type of the value under the key of a map or of a struct, found by its JSON name.
+func fieldType(t reflect.Type, key string) (reflect.Type, bool) {
+    for t.Kind() == reflect.Pointer {
+        t = t.Elem()
+    }
+    switch t.Kind() {
+    case reflect.Map:
+        return t.Elem(), true
+    case reflect.Struct:
+    default:
+        return nil, false
+    }
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+        if f.Anonymous && name == "" {
+            if ft, ok := fieldType(f.Type, key); ok {
+                return ft, true
+            }
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        if strings.EqualFold(name, key) {
+            return f.Type, true
+        }
+    }
+    return nil, false
+}
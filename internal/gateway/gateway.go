@@ -0,0 +1,324 @@
+package gateway
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/auth"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bootstrap"
+    "github.com/aswinkm-tc/go-web-concepts/internal/bulkhead"
+    "github.com/aswinkm-tc/go-web-concepts/internal/compression"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "github.com/aswinkm-tc/go-web-concepts/internal/proxy"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/server"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "net"
+    "sort"
+    "strings"
+    "time"
+)
+
+// HealthPath answers 200 while the gateway runs, it is not limited nor authenticated.
+const HealthPath = "/healthz"
+
+// Gateway is an API gateway composed of the modules of the repository from a single configuration: the requests go
+// through the Server-Timing, the access log, CORS, the compression, the bulkhead, the authentication and the rate
+// limiter, in that order, before being forwarded to the upstream of their route.
+type Gateway struct {
+    h       *server.Hertz
+    limiter ratelimiter.RateLimiter // Nil if the requests are neither limited nor authenticated
+    redis   radix.Client            // Nil without Redis, left open by the store of the limiter
+}
+
+type route struct {
+    prefix string
+    proxy  proxy.ReverseProxy
+}
+
+// New builds the gateway of the configuration, the metrics are flushed until ctx is done.
+func New(ctx context.Context, config GatewayConfig) (*Gateway, error) {
+    if config.Addr == "" {
+        config.Addr = ":8080"
+    }
+    routes, err := newRoutes(config)
+    if err != nil {
+        return nil, err
+    }
+    clientIP, err := newClientIP(config.TrustedProxies)
+    if err != nil {
+        return nil, err
+    }
+    var sink metrics.Sink = metrics.Discard
+    if config.Observability.StatsD != nil {
+        if sink, err = metrics.NewStatsDSink(ctx, *config.Observability.StatsD); err != nil {
+            return nil, err
+        }
+    }
+    var client radix.Client
+    if config.Redis != nil {
+        if client, err = bootstrap.ProvideRedisClient(*config.Redis); err != nil {
+            return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+        }
+    }
+
+    g := &Gateway{redis: client}
+    var handlers []app.HandlerFunc
+    if config.Observability.ServerTiming != nil {
+        st, err := servertiming.NewServerTiming(*config.Observability.ServerTiming)
+        if err != nil {
+            return nil, err
+        }
+        handlers = append(handlers, st.Middleware)
+    }
+    if config.Observability.AccessLog {
+        handlers = append(handlers, accessLog)
+    }
+    if config.CORS != nil {
+        cr, err := cors.NewCORS(*config.CORS)
+        if err != nil {
+            return nil, err
+        }
+        handlers = append(handlers, cr.Middleware)
+    }
+    if config.Compression != nil {
+        cp, err := compression.NewCompression(*config.Compression)
+        if err != nil {
+            return nil, err
+        }
+        handlers = append(handlers, cp.Middleware)
+    }
+    if config.Bulkhead != nil {
+        b, err := bulkhead.NewBulkhead(*config.Bulkhead, bulkhead.WithMetrics(sink))
+        if err != nil {
+            return nil, err
+        }
+        handlers = append(handlers, b.Middleware)
+    }
+    authn, opts, err := newAuth(config.Auth, client)
+    if err != nil {
+        return nil, err
+    }
+    handlers = append(handlers, authn...)
+    if config.RateLimit != nil || len(opts) > 0 {
+        if g.limiter, err = newLimiter(config.RateLimit, client, append(opts, ratelimiter.WithMetrics(sink))); err != nil {
+            return nil, err
+        }
+        handlers = append(handlers, g.limiter.Middleware)
+    }
+
+    g.h = server.New(server.WithHostPorts(config.Addr), server.WithDisablePrintRoute(true))
+    g.h.SetClientIPFunc(clientIP)
+    // Registered before the middlewares, which don't apply to it
+    g.h.GET(HealthPath, func(_ context.Context, c *app.RequestContext) {
+        c.JSON(consts.StatusOK, utils.H{"status": "ok"})
+    })
+    g.h.Use(handlers...)
+    g.h.Any("/*path", func(ctx context.Context, c *app.RequestContext) {
+        r := match(routes, c.Path())
+        if r == nil {
+            c.JSON(consts.StatusNotFound, utils.H{"error": "Not found"})
+            return
+        }
+        r.proxy.Handler(ctx, c)
+    })
+    return g, nil
+}
+
+func newRoutes(config GatewayConfig) ([]route, error) {
+    if len(config.Routes) == 0 {
+        return nil, errors.New("the gateway has no route")
+    }
+    if config.Cache.MaxEntries == 0 {
+        config.Cache.MaxEntries = 10000
+    }
+    store := bootstrap.ProvideCacheStore(config.Cache)
+    routes := make([]route, 0, len(config.Routes))
+    prefixes := make(map[string]struct{}, len(config.Routes))
+    for _, rc := range config.Routes {
+        prefix := trimPrefix(rc.Prefix)
+        if !strings.HasPrefix(prefix, "/") {
+            return nil, fmt.Errorf("route prefix %q must start with /", rc.Prefix)
+        }
+        if _, exists := prefixes[prefix]; exists {
+            return nil, fmt.Errorf("route prefix %q is declared twice", rc.Prefix)
+        }
+        prefixes[prefix] = struct{}{}
+        if rc.Cache != nil && rc.Cache.Store == nil {
+            // The routes share the cache, the responses are keyed by host and URI
+            rc.Cache.Store = store
+        }
+        p, err := proxy.NewReverseProxy(rc.ProxyConfig)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create proxy of route %s: %w", rc.Prefix, err)
+        }
+        routes = append(routes, route{prefix: prefix, proxy: p})
+    }
+    // Longest prefix first, so the first match is the most specific
+    sort.Slice(routes, func(i, j int) bool {
+        return len(routes[i].prefix) > len(routes[j].prefix)
+    })
+    return routes, nil
+}
+
+// newAuth returns the authentication middlewares and the options of the rate limiter identifying the callers.
+func newAuth(config *AuthConfig, client radix.Client) ([]app.HandlerFunc, []ratelimiter.Option, error) {
+    switch {
+    case config == nil:
+        return nil, nil, nil
+    case config.JWT != nil && config.Introspection != nil:
+        return nil, nil, errors.New("auth can't verify both JWTs and opaque tokens")
+    case config.JWT != nil:
+        verifier := auth.NewJWTVerifier(*config.JWT)
+        extractor := ratelimiter.KeyExtractor(verifier.Key)
+        if config.Required {
+            extractor = ratelimiter.RequireKey(extractor)
+        }
+        return nil, []ratelimiter.Option{ratelimiter.WithKeyExtractor(extractor)}, nil
+    case config.Introspection != nil:
+        if client == nil {
+            return nil, nil, errors.New("token introspection requires Redis")
+        }
+        introspector := auth.NewIntrospector(client, *config.Introspection)
+        identity := func(ctx context.Context, c *app.RequestContext) string {
+            if id := introspector.Identity(ctx, c); id != "" {
+                return id
+            }
+            return ratelimiter.ClientIP(ctx, c)
+        }
+        return []app.HandlerFunc{introspector.Middleware}, []ratelimiter.Option{ratelimiter.WithIdentity(identity)}, nil
+    }
+    return nil, nil, nil
+}
+
+func newLimiter(config *RateLimitConfig, client radix.Client, opts []ratelimiter.Option) (ratelimiter.RateLimiter, error) {
+    if config == nil {
+        // Only extracts the identities of the callers, rejecting the invalid ones
+        config = &RateLimitConfig{}
+    }
+    if err := config.Endpoints.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid rate limits: %w", err)
+    }
+    var store ratelimiterstore.Store = ratelimiterstore.NewMemoryStore()
+    if client != nil {
+        var err error
+        if store, err = bootstrap.ProvideRateLimiterStore(client, bootstrap.StoreConfig{ScanCount: 100, KeyPrefix: config.KeyPrefix}); err != nil {
+            return nil, err
+        }
+    }
+    if config.StoreErrorPolicy != "" {
+        opts = append(opts, ratelimiter.WithStoreErrorPolicy(config.StoreErrorPolicy))
+    }
+    if config.APIKeys != nil {
+        opts = append(opts, ratelimiter.WithAPIKeys(config.APIKeys.Keys, config.APIKeys.APIKeyConfig))
+    }
+    // The anonymous requests are counted for the client IP of the trusted proxies rather than X-Forwarded-For, which
+    // the clients could set to get a budget per request. The introspection replaces it with its own identity.
+    opts = append([]ratelimiter.Option{ratelimiter.WithIdentity(ratelimiter.ClientIP)}, opts...)
+    var limiter ratelimiter.RateLimiter
+    endpoint := func(path []byte) string {
+        // The limit of the longest endpoint covering the path, the configuration may be updated
+        best := ""
+        for e := range limiter.Config() {
+            if len(e) > len(best) && covers(trimPrefix(e), path) {
+                best = e
+            }
+        }
+        if best == "" {
+            return string(path)
+        }
+        return best
+    }
+    limiter = ratelimiter.NewRateLimiter(config.Endpoints, store, endpoint, opts...)
+    return limiter, nil
+}
+
+// newClientIP returns the client IP of the requests: the remote address, or the address the trusted proxies forwarded
+// the request for.
+func newClientIP(proxies []string) (app.ClientIP, error) {
+    cidrs := make([]*net.IPNet, 0, len(proxies))
+    for _, proxy := range proxies {
+        _, cidr, err := net.ParseCIDR(proxy)
+        if err != nil {
+            return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+        }
+        cidrs = append(cidrs, cidr)
+    }
+    return app.ClientIPWithOption(app.ClientIPOptions{
+        RemoteIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"},
+        TrustedCIDRs:    cidrs,
+    }), nil
+}
+
+// trimPrefix removes the trailing slash of a prefix but the root one.
+func trimPrefix(prefix string) string {
+    if len(prefix) > 1 {
+        return strings.TrimSuffix(prefix, "/")
+    }
+    return prefix
+}
+
+// covers tells if the path is the prefix or under it, e.g. /api covers /api and /api/users but not /apis.
+func covers(prefix string, path []byte) bool {
+    p := string(path)
+    return prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+func match(routes []route, path []byte) *route {
+    for i := range routes {
+        if covers(routes[i].prefix, path) {
+            return &routes[i]
+        }
+    }
+    return nil
+}
+
+func accessLog(ctx context.Context, c *app.RequestContext) {
+    start := time.Now()
+    c.Next(ctx)
+    slog.Info("Request", "method", string(c.Method()), "path", string(c.Path()), "status", c.Response.StatusCode(),
+        "duration", time.Since(start), "client_ip", c.ClientIP())
+}
+
+// Run serves the requests until the gateway is shut down.
+func (g *Gateway) Run() error {
+    return g.h.Run()
+}
+
+// Spin runs the gateway until the process receives SIGINT or SIGTERM, waits for the requests in flight, then closes
+// the rate limiter and the Redis client.
+func (g *Gateway) Spin() {
+    g.h.Spin()
+    if err := g.close(); err != nil {
+        slog.Error("Error closing gateway", "error", err)
+    }
+}
+
+// Shutdown stops accepting requests and waits for the requests in flight until ctx is done, then closes the rate
+// limiter and the Redis client.
+func (g *Gateway) Shutdown(ctx context.Context) error {
+    return errors.Join(g.h.Shutdown(ctx), g.close())
+}
+
+// close closes the rate limiter, then the Redis client its store uses.
+func (g *Gateway) close() error {
+    var err error
+    if g.limiter != nil {
+        if closeErr := g.limiter.Close(); closeErr != nil {
+            err = fmt.Errorf("failed to close rate limiter: %w", closeErr)
+        }
+    }
+    if g.redis != nil {
+        if closeErr := g.redis.Close(); closeErr != nil {
+            err = errors.Join(err, fmt.Errorf("failed to close Redis client: %w", closeErr))
+        }
+    }
+    return err
+}
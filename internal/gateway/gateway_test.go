@@ -0,0 +1,252 @@
+package gateway
+
+import (
+    "context"
+    "fmt"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/aswinkm-tc/go-web-concepts/internal/auth"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// upstream answers the path of the requests, prefixed with its name.
+func upstream(t *testing.T, name string) string {
+    t.Helper()
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _, _ = fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+    }))
+    t.Cleanup(server.Close)
+    return server.URL
+}
+
+// testGateway is a gateway serving on a local port, the client IP of its requests is the loopback address.
+type testGateway struct {
+    *Gateway
+    url string
+}
+
+// client doesn't keep its connections open, which the shutdown of the gateways would wait for.
+var client = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+func newGateway(t *testing.T, yaml string) *testGateway {
+    t.Helper()
+    var config GatewayConfig
+    if err := Unmarshal([]byte(yaml), &config); err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    lis, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen: %v", err)
+    }
+    config.Addr = lis.Addr().String()
+    _ = lis.Close()
+    g, err := New(context.Background(), config)
+    if err != nil {
+        t.Fatalf("New: %v", err)
+    }
+    go func() {
+        _ = g.Run()
+    }()
+    t.Cleanup(func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        _ = g.Shutdown(ctx)
+    })
+    tg := &testGateway{Gateway: g, url: "http://" + config.Addr}
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        status, _, err := tg.get(HealthPath)
+        if err == nil && status == http.StatusOK {
+            return tg
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("gateway not serving: %d, %v", status, err)
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func (g *testGateway) get(path string, headers ...string) (int, string, error) {
+    req, err := http.NewRequest(http.MethodGet, g.url+path, nil)
+    if err != nil {
+        return 0, "", err
+    }
+    for i := 0; i+1 < len(headers); i += 2 {
+        req.Header.Set(headers[i], headers[i+1])
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return 0, "", err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(resp.Body)
+    return resp.StatusCode, string(body), err
+}
+
+func (g *testGateway) status(t *testing.T, path string, headers ...string) int {
+    t.Helper()
+    status, _, err := g.get(path, headers...)
+    if err != nil {
+        t.Fatalf("GET %s: %v", path, err)
+    }
+    return status
+}
+
+func TestUnmarshal(t *testing.T) {
+    var config GatewayConfig
+    err := Unmarshal([]byte(`
+routes:
+  - prefix: /api
+    upstream: http://localhost:8081
+    mirrors:
+      - upstream: http://localhost:8082
+        timeout: 2s
+rate_limit:
+  endpoints:
+    /api:
+      max_requests: 5
+      time_window: 1m30s
+      sliding_window_interval: 5s
+bulkhead:
+  max_wait: 500ms
+`), &config)
+    if err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    // The fields of the embedded proxy configuration are found by their JSON names too
+    if len(config.Routes) != 1 || config.Routes[0].Prefix != "/api" || config.Routes[0].Upstream != "http://localhost:8081" ||
+        len(config.Routes[0].Mirrors) != 1 || config.Routes[0].Mirrors[0].Timeout != 2*time.Second {
+        t.Fatalf("routes %+v", config.Routes)
+    }
+    if api := config.RateLimit.Endpoints["/api"]; api.MaxRequests != 5 || api.TimeWindow != 90*time.Second || api.SlidingWindowInterval != 5*time.Second {
+        t.Fatalf("endpoint %+v", api)
+    }
+    if config.Bulkhead.MaxWait != 500*time.Millisecond {
+        t.Fatalf("max wait %s", config.Bulkhead.MaxWait)
+    }
+
+    if err := Unmarshal([]byte("bulkhead:\n  max_wait: soon\n"), &config); err == nil {
+        t.Fatalf("invalid duration accepted")
+    }
+    // The configuration of the example stays valid
+    if _, err := LoadFile("../../examples/gateway/gateway.yaml"); err != nil {
+        t.Fatalf("LoadFile: %v", err)
+    }
+}
+
+func TestGatewayRoutes(t *testing.T) {
+    g := newGateway(t, fmt.Sprintf(`
+routes:
+  - prefix: /api
+    upstream: %s
+  - prefix: /api/admin/
+    upstream: %s
+`, upstream(t, "api"), upstream(t, "admin")))
+    for _, test := range []struct {
+        path   string
+        status int
+        body   string
+    }{
+        {"/api", 200, "api /api"},
+        {"/api/users", 200, "api /api/users"},
+        // The longest prefix wins
+        {"/api/admin/keys", 200, "admin /api/admin/keys"},
+        {"/apis", 404, ""},
+        {"/healthz", 200, `{"status":"ok"}`},
+    } {
+        status, body, err := g.get(test.path)
+        if err != nil || status != test.status || (test.body != "" && body != test.body) {
+            t.Fatalf("%s: %d %s %v, %d %s expected", test.path, status, body, err, test.status, test.body)
+        }
+    }
+}
+
+func TestGatewayLimitsPerClientIP(t *testing.T) {
+    routes := fmt.Sprintf(`
+routes:
+  - prefix: /
+    upstream: %s
+rate_limit:
+  endpoints:
+    /api:
+      max_requests: 2
+      time_window: 1m
+      sliding_window_interval: 1s
+`, upstream(t, "api"))
+
+    // Without trusted proxies, X-Forwarded-For is set by the clients and doesn't get them another budget
+    g := newGateway(t, routes)
+    for i, want := range []int{200, 200, 429, 429} {
+        if status := g.status(t, "/api/users", "X-Forwarded-For", fmt.Sprintf("10.0.0.%d", i)); status != want {
+            t.Fatalf("request %d: %d, %d expected", i, status, want)
+        }
+    }
+    // The health checks are not limited
+    if status := g.status(t, HealthPath); status != 200 {
+        t.Fatalf("%s: %d", HealthPath, status)
+    }
+
+    // Behind a trusted proxy, every client it forwards for has its own budget
+    g = newGateway(t, routes+"trusted_proxies: [127.0.0.1/32]\n")
+    for i, want := range []int{200, 200, 429} {
+        if status := g.status(t, "/api/users", "X-Forwarded-For", "10.0.0.1"); status != want {
+            t.Fatalf("request %d of 10.0.0.1: %d, %d expected", i, status, want)
+        }
+    }
+    if status := g.status(t, "/api/users", "X-Forwarded-For", "10.0.0.2"); status != 200 {
+        t.Fatalf("request of 10.0.0.2: %d, 200 expected", status)
+    }
+}
+
+func TestGatewayClosesRedis(t *testing.T) {
+    mr := miniredis.RunT(t)
+    g := newGateway(t, fmt.Sprintf(`
+redis:
+  addr: %s
+routes:
+  - prefix: /
+    upstream: http://localhost:8081
+rate_limit:
+  endpoints:
+    /api:
+      max_requests: 2
+      time_window: 1m
+      sliding_window_interval: 1s
+`, mr.Addr()))
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := g.Shutdown(ctx); err != nil {
+        t.Fatalf("Shutdown: %v", err)
+    }
+    deadline := time.Now().Add(5 * time.Second)
+    for mr.CurrentConnectionCount() > 0 {
+        if time.Now().After(deadline) {
+            t.Fatalf("%d connections to Redis left open", mr.CurrentConnectionCount())
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+    jwt := &auth.JWTConfig{JWKSURL: "https://issuer.example.com/keys"}
+    introspection := &auth.IntrospectionConfig{URL: "https://issuer.example.com/introspect"}
+    for name, config := range map[string]GatewayConfig{
+        "no route":          {},
+        "relative prefix":   {Routes: []RouteConfig{{Prefix: "api"}}},
+        "duplicate prefix":  {Routes: []RouteConfig{{Prefix: "/api"}, {Prefix: "/api/"}}},
+        "invalid proxy":     {Routes: []RouteConfig{{Prefix: "/"}}, TrustedProxies: []string{"10.0.0.1"}},
+        "jwt and opaque":    {Routes: []RouteConfig{{Prefix: "/"}}, Auth: &AuthConfig{JWT: jwt, Introspection: introspection}},
+        "opaque with no db": {Routes: []RouteConfig{{Prefix: "/"}}, Auth: &AuthConfig{Introspection: introspection}},
+    } {
+        for i := range config.Routes {
+            config.Routes[i].Upstream = "http://localhost:8081"
+        }
+        if _, err := New(context.Background(), config); err == nil {
+            t.Fatalf("%s: accepted", name)
+        }
+    }
+}
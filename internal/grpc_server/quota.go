@@ -0,0 +1,278 @@
+package grpc_server
+
+import (
+    "context"
+    "crypto/x509"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+    "log/slog"
+    "maps"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    // AnyMethod configures the methods not listed in a QuotaConfig
+    AnyMethod = "*"
+    // OtherCallers is the share of each caller not listed in MethodQuota.Shares
+    OtherCallers = "*"
+    // UnknownCaller is the identity of the requests whose caller can't be identified, e.g. without a client certificate
+    UnknownCaller = "unknown"
+)
+
+// Names of the metrics of the caller quotas, tagged with the method and the caller.
+const (
+    // MetricQuotaRequests counts the decisions, tagged with the result: allowed or rejected
+    MetricQuotaRequests = "grpc.quota.requests"
+    // MetricQuotaStoreErrors counts the requests allowed because the store failed
+    MetricQuotaStoreErrors = "grpc.quota.store_errors"
+)
+
+// CallerFunc returns the service calling a method, "" if it can't be identified.
+type CallerFunc func(ctx context.Context) string
+
+// MTLSCaller identifies the caller by its verified client certificate: its SPIFFE ID, the first URI SAN, or else its
+// common name.
+func MTLSCaller(ctx context.Context) string {
+    p, ok := peer.FromContext(ctx)
+    if !ok {
+        return ""
+    }
+    info, ok := p.AuthInfo.(credentials.TLSInfo)
+    if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+        return ""
+    }
+    return certificateIdentity(info.State.VerifiedChains[0][0])
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+    if len(cert.URIs) > 0 {
+        return cert.URIs[0].String()
+    }
+    return cert.Subject.CommonName
+}
+
+type MethodQuota struct {
+    // MaxRequests is the capacity of the method per TimeWindow, split between the callers by their shares
+    MaxRequests int64 `json:"max_requests"`
+    // TimeWindow is the time window for the rate limit
+    TimeWindow time.Duration `json:"time_window"`
+    // SlidingWindowInterval is the interval the requests are counted in
+    //
+    // Defaults to a tenth of TimeWindow if not specified
+    SlidingWindowInterval time.Duration `json:"sliding_window_interval,omitempty"`
+    // Shares of the capacity by caller, OtherCallers is the share of each caller not listed and a share of 0 blocks a
+    // caller. A caller may use MaxRequests * share / sum of the shares.
+    //
+    // Defaults to an OtherCallers share of 1 if not specified
+    Shares map[string]int64 `json:"shares,omitempty"`
+}
+
+// QuotaConfig holds the quota of each method by full method name, e.g. /orders.v1.Orders/Get, AnyMethod applies to
+// the methods not listed. Methods without a quota are not limited.
+type QuotaConfig map[string]MethodQuota
+
+// limit returns the requests the caller may make per TimeWindow.
+func (q MethodQuota) limit(caller string) int64 {
+    var total int64
+    for _, share := range q.Shares {
+        total += share
+    }
+    if _, ok := q.Shares[OtherCallers]; !ok {
+        // The implicit share of the other callers counts for every caller, like an explicit one
+        total++
+    }
+    share, ok := q.Shares[caller]
+    if !ok {
+        share, ok = q.Shares[OtherCallers]
+    }
+    if !ok {
+        share = 1
+    }
+    if share <= 0 || total <= 0 {
+        return 0
+    }
+    return max(q.MaxRequests*share/total, 1)
+}
+
+// CallerQuotas splits the capacity of the methods of a shared internal service between the services calling it, so
+// one noisy caller can't starve the others. Each caller is limited to its share of each method, counted in a Store so
+// the instances of the service enforce the quotas together.
+type CallerQuotas struct {
+    config  atomic.Pointer[QuotaConfig]
+    mu      sync.Mutex // Serializes the updates of the shares
+    store   ratelimiterstore.AtomicStore
+    caller  CallerFunc
+    metrics metrics.Sink
+    now     func() time.Time
+}
+
+// QuotaOption configures optional behaviour of the CallerQuotas.
+type QuotaOption func(*CallerQuotas)
+
+// WithCaller identifies the callers with the function.
+//
+// Defaults to MTLSCaller if not specified
+func WithCaller(caller CallerFunc) QuotaOption {
+    return func(q *CallerQuotas) {
+        q.caller = caller
+    }
+}
+
+// WithQuotaMetrics reports the decisions per method and caller to the sink.
+//
+// Defaults to metrics.Discard if not specified
+func WithQuotaMetrics(sink metrics.Sink) QuotaOption {
+    return func(q *CallerQuotas) {
+        q.metrics = sink
+    }
+}
+
+// NewCallerQuotas creates the CallerQuotas of the configuration, the store must implement
+// ratelimiterstore.AtomicStore so concurrent calls can't all take the last request of a share.
+func NewCallerQuotas(config QuotaConfig, store ratelimiterstore.Store, opts ...QuotaOption) (*CallerQuotas, error) {
+    atomicStore, ok := store.(ratelimiterstore.AtomicStore)
+    if !ok {
+        return nil, fmt.Errorf("store %T can't count the quotas atomically: %w", store, errors.ErrUnsupported)
+    }
+    q := &CallerQuotas{
+        store:   atomicStore,
+        caller:  MTLSCaller,
+        metrics: metrics.Discard,
+        now:     time.Now,
+    }
+    for _, opt := range opts {
+        opt(q)
+    }
+    q.config.Store(&config)
+    return q, nil
+}
+
+// UnaryServerInterceptor rejects the calls over the share of their caller with ResourceExhausted.
+func (q *CallerQuotas) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+    return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+        if err := q.allow(ctx, info.FullMethod); err != nil {
+            return nil, err
+        }
+        return handler(ctx, req)
+    }
+}
+
+// StreamServerInterceptor rejects the streams over the share of their caller with ResourceExhausted, a stream counts
+// as one request however many messages it carries.
+func (q *CallerQuotas) StreamServerInterceptor() grpc.StreamServerInterceptor {
+    return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+        if err := q.allow(ss.Context(), info.FullMethod); err != nil {
+            return err
+        }
+        return handler(srv, ss)
+    }
+}
+
+// allow counts the call against the share of its caller, store errors let the call through.
+func (q *CallerQuotas) allow(ctx context.Context, method string) error {
+    config := *q.config.Load()
+    quota, ok := config[method]
+    if !ok {
+        if quota, ok = config[AnyMethod]; !ok {
+            return nil
+        }
+    }
+    caller := q.caller(ctx)
+    if caller == "" {
+        caller = UnknownCaller
+    }
+    tags := []metrics.Tag{{Key: "method", Value: method}, {Key: "caller", Value: caller}}
+    limit := quota.limit(caller)
+    allowed := limit > 0
+    if allowed {
+        interval := quota.SlidingWindowInterval
+        if interval == 0 {
+            interval = max(quota.TimeWindow/10, time.Second)
+        }
+        key := ratelimiterstore.RateLimiterKey{UserId: caller, Endpoint: "grpc:" + method}
+        var err error
+        if _, allowed, err = q.store.AddIfBelow(ctx, key, 1, limit, q.now(), interval, quota.TimeWindow); err != nil {
+            slog.Error("Error counting caller quota", "method", method, "caller", caller, "error", err)
+            q.metrics.Count(MetricQuotaStoreErrors, 1, tags...)
+            allowed = true
+        }
+    }
+    result := "allowed"
+    if !allowed {
+        result = "rejected"
+    }
+    metrics.CountContext(ctx, q.metrics, MetricQuotaRequests, 1, append(tags, metrics.Tag{Key: "result", Value: result})...)
+    if !allowed {
+        return status.Errorf(codes.ResourceExhausted, "caller %s is over its share of %s", caller, method)
+    }
+    return nil
+}
+
+// Config returns the current quotas.
+func (q *CallerQuotas) Config() QuotaConfig {
+    return *q.config.Load()
+}
+
+// SetShare changes the share of a caller for a method at runtime, a negative share removes the caller from the
+// shares. The other callers keep their shares, so their quotas change with the total.
+func (q *CallerQuotas) SetShare(method, caller string, share int64) error {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    config := maps.Clone(*q.config.Load())
+    quota, ok := config[method]
+    if !ok {
+        return fmt.Errorf("no quota configured for method %s", method)
+    }
+    quota.Shares = maps.Clone(quota.Shares)
+    if quota.Shares == nil {
+        quota.Shares = make(map[string]int64)
+    }
+    if share < 0 {
+        delete(quota.Shares, caller)
+    } else {
+        quota.Shares[caller] = share
+    }
+    config[method] = quota
+    q.config.Store(&config)
+    return nil
+}
+
+// ShareUpdate is the body of the admin requests changing a share.
+type ShareUpdate struct {
+    Method string `json:"method"`
+    Caller string `json:"caller"`
+    Share  int64  `json:"share"`
+}
+
+// AdminHandler serves the quotas as JSON on GET and changes a share from a ShareUpdate on PUT, it must be registered
+// on an admin listener only reachable by the operators.
+func (q *CallerQuotas) AdminHandler(_ context.Context, c *app.RequestContext) {
+    if string(c.Method()) != consts.MethodPut {
+        c.JSON(consts.StatusOK, q.Config())
+        return
+    }
+    var update ShareUpdate
+    if err := json.Unmarshal(c.Request.Body(), &update); err != nil || update.Method == "" || update.Caller == "" {
+        c.JSON(consts.StatusBadRequest, utils.H{"error": "Expected a method, a caller and a share"})
+        return
+    }
+    if err := q.SetShare(update.Method, update.Caller, update.Share); err != nil {
+        c.JSON(consts.StatusNotFound, utils.H{"error": err.Error()})
+        return
+    }
+    slog.Info("Caller share updated", "method", update.Method, "caller", update.Caller, "share", update.Share)
+    c.JSON(consts.StatusOK, q.Config()[update.Method])
+}
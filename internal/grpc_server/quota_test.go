@@ -0,0 +1,182 @@
+package grpc_server
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/status"
+    "testing"
+    "time"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+// plainStore hides the atomic operations of a store.
+type plainStore struct {
+    ratelimiterstore.Store
+}
+
+// failingStore fails like a store that can't be reached.
+type failingStore struct {
+    ratelimiterstore.Store
+}
+
+func (failingStore) SetIfBelow(context.Context, ratelimiterstore.RateLimiterKey, int64, time.Time, time.Duration, time.Duration) (bool, error) {
+    return false, errors.New("connection refused")
+}
+
+func (failingStore) AddIfBelow(context.Context, ratelimiterstore.RateLimiterKey, int64, int64, time.Time, time.Duration, time.Duration) (int64, bool, error) {
+    return 0, false, errors.New("connection refused")
+}
+
+// callerHeader identifies the callers of the tests by their x-caller metadata.
+func callerHeader(ctx context.Context) string {
+    if values := metadata.ValueFromIncomingContext(ctx, "x-caller"); len(values) > 0 {
+        return values[0]
+    }
+    return ""
+}
+
+// check calls the health check as the caller, "" for a caller that can't be identified, and returns the status code.
+func check(client healthpb.HealthClient, caller string) codes.Code {
+    ctx := context.Background()
+    if caller != "" {
+        ctx = metadata.AppendToOutgoingContext(ctx, "x-caller", caller)
+    }
+    _, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+    return status.Code(err)
+}
+
+func TestMethodQuotaLimit(t *testing.T) {
+    for _, test := range []struct {
+        name   string
+        quota  MethodQuota
+        caller string
+        limit  int64
+    }{
+        {"no shares", MethodQuota{MaxRequests: 100}, "orders", 100},
+        // The implicit share of the other callers counts in the total, like an explicit one
+        {"listed caller", MethodQuota{MaxRequests: 100, Shares: map[string]int64{"orders": 3, "billing": 1}}, "orders", 60},
+        // The callers not listed share the implicit share of 1
+        {"other caller", MethodQuota{MaxRequests: 100, Shares: map[string]int64{"orders": 3, "billing": 1}}, "search", 20},
+        {"other callers share", MethodQuota{MaxRequests: 100, Shares: map[string]int64{"orders": 3, OtherCallers: 2}}, "search", 40},
+        {"blocked caller", MethodQuota{MaxRequests: 100, Shares: map[string]int64{"orders": 1, "batch": 0}}, "batch", 0},
+        {"blocked other callers", MethodQuota{MaxRequests: 100, Shares: map[string]int64{"orders": 1, OtherCallers: 0}}, "search", 0},
+        // A tiny share still gets a request
+        {"tiny share", MethodQuota{MaxRequests: 2, Shares: map[string]int64{"orders": 100, "billing": 1}}, "billing", 1},
+    } {
+        if limit := test.quota.limit(test.caller); limit != test.limit {
+            t.Fatalf("%s: %d, %d expected", test.name, limit, test.limit)
+        }
+    }
+}
+
+func TestCallerQuotas(t *testing.T) {
+    q, err := NewCallerQuotas(QuotaConfig{
+        checkMethod: {MaxRequests: 4, TimeWindow: time.Minute, Shares: map[string]int64{"orders": 2, "billing": 1}},
+        AnyMethod:   {MaxRequests: 10, TimeWindow: time.Minute, Shares: map[string]int64{OtherCallers: 0}},
+    }, ratelimiterstore.NewMemoryStore(), WithCaller(callerHeader))
+    if err != nil {
+        t.Fatalf("NewCallerQuotas: %v", err)
+    }
+    s, _ := NewServer(ServerConfig{}, grpc.UnaryInterceptor(q.UnaryServerInterceptor()), grpc.StreamInterceptor(q.StreamServerInterceptor()))
+    client := healthpb.NewHealthClient(dial(t, s))
+
+    for i, test := range []struct {
+        caller string
+        code   codes.Code
+    }{
+        {"orders", codes.OK},
+        {"orders", codes.OK},
+        {"orders", codes.ResourceExhausted},
+        // The noisy caller doesn't take the share of the others
+        {"billing", codes.OK},
+        {"billing", codes.ResourceExhausted},
+        {"", codes.OK},
+        {"", codes.ResourceExhausted},
+    } {
+        if code := check(client, test.caller); code != test.code {
+            t.Fatalf("call %d of %q: %s, %s expected", i, test.caller, code, test.code)
+        }
+    }
+
+    // The streams of the methods without a quota of their own take the one of AnyMethod
+    stream, err := client.Watch(metadata.AppendToOutgoingContext(context.Background(), "x-caller", "orders"), &healthpb.HealthCheckRequest{})
+    if err != nil {
+        t.Fatalf("Watch: %v", err)
+    }
+    if _, err := stream.Recv(); status.Code(err) != codes.ResourceExhausted {
+        t.Fatalf("Watch: %v, ResourceExhausted expected", err)
+    }
+
+    // The operators raise the share of a caller at runtime
+    if err := q.SetShare(checkMethod, "billing", 5); err != nil {
+        t.Fatalf("SetShare: %v", err)
+    }
+    if code := check(client, "billing"); code != codes.OK {
+        t.Fatalf("call of billing after its share was raised: %s", code)
+    }
+    if err := q.SetShare("/orders.v1.Orders/Get", "billing", 5); err == nil {
+        t.Fatalf("share of a method without quota set")
+    }
+    if err := q.SetShare(checkMethod, "billing", -1); err != nil {
+        t.Fatalf("SetShare: %v", err)
+    }
+    if _, ok := q.Config()[checkMethod].Shares["billing"]; ok {
+        t.Fatalf("share not removed: %v", q.Config()[checkMethod].Shares)
+    }
+}
+
+func TestCallerQuotasStores(t *testing.T) {
+    if _, err := NewCallerQuotas(QuotaConfig{}, plainStore{ratelimiterstore.NewMemoryStore()}); !errors.Is(err, errors.ErrUnsupported) {
+        t.Fatalf("NewCallerQuotas of a store without atomic operations: %v, ErrUnsupported expected", err)
+    }
+
+    // The calls are let through when the store fails
+    q, err := NewCallerQuotas(QuotaConfig{AnyMethod: {MaxRequests: 1, TimeWindow: time.Minute}}, failingStore{}, WithCaller(callerHeader))
+    if err != nil {
+        t.Fatalf("NewCallerQuotas: %v", err)
+    }
+    for range 3 {
+        if err := q.allow(context.Background(), checkMethod); err != nil {
+            t.Fatalf("allow with a failing store: %v", err)
+        }
+    }
+}
+
+func TestCallerQuotasAdminHandler(t *testing.T) {
+    q, err := NewCallerQuotas(QuotaConfig{checkMethod: {MaxRequests: 4, TimeWindow: time.Minute}}, ratelimiterstore.NewMemoryStore())
+    if err != nil {
+        t.Fatalf("NewCallerQuotas: %v", err)
+    }
+    serve := func(method, body string) (int, []byte) {
+        c := app.NewContext(0)
+        c.Request.SetMethod(method)
+        c.Request.SetBodyString(body)
+        q.AdminHandler(context.Background(), c)
+        return c.Response.StatusCode(), c.Response.Body()
+    }
+
+    status, body := serve("PUT", `{"method":"`+checkMethod+`","caller":"orders","share":3}`)
+    var quota MethodQuota
+    if err := json.Unmarshal(body, &quota); status != 200 || err != nil || quota.Shares["orders"] != 3 {
+        t.Fatalf("PUT: %d %s", status, body)
+    }
+    status, body = serve("GET", "")
+    var config QuotaConfig
+    if err := json.Unmarshal(body, &config); status != 200 || err != nil || config[checkMethod].Shares["orders"] != 3 {
+        t.Fatalf("GET: %d %s", status, body)
+    }
+    if status, body := serve("PUT", `{"method":"`+checkMethod+`"}`); status != 400 {
+        t.Fatalf("PUT without a caller: %d %s, 400 expected", status, body)
+    }
+    if status, body := serve("PUT", `{"method":"/orders.v1.Orders/Get","caller":"orders","share":3}`); status != 404 {
+        t.Fatalf("PUT of a method without quota: %d %s, 404 expected", status, body)
+    }
+}
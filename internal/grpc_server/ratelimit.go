@@ -0,0 +1,148 @@
+package grpc_server
+
+import (
+    "context"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "google.golang.org/genproto/googleapis/rpc/errdetails"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/durationpb"
+    "math"
+    "net"
+    "strconv"
+    "time"
+)
+
+// Trailers of the rate limited calls, the counterparts of the rate limit headers of the HTTP middleware.
+const (
+    // TrailerRetryAfter is the number of seconds a rejected caller should wait
+    TrailerRetryAfter = "retry-after"
+    // TrailerLimit and TrailerRemaining are the budget of the caller after the call
+    TrailerLimit     = "ratelimit-limit"
+    TrailerRemaining = "ratelimit-remaining"
+    // TrailerReset is the number of seconds until the budget frees calls
+    TrailerReset = "ratelimit-reset"
+)
+
+// MetadataCaller identifies the caller by the value of a metadata key, e.g. x-api-key.
+func MetadataCaller(key string) CallerFunc {
+    return func(ctx context.Context) string {
+        if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+            return values[0]
+        }
+        return ""
+    }
+}
+
+// PeerIP identifies the caller by the IP of the peer, like the HTTP middleware counts the requests without identity.
+func PeerIP(ctx context.Context) string {
+    p, ok := peer.FromContext(ctx)
+    if !ok || p.Addr == nil {
+        return ""
+    }
+    host, _, err := net.SplitHostPort(p.Addr.String())
+    if err != nil {
+        return p.Addr.String()
+    }
+    return host
+}
+
+// RateLimiter limits the calls of a gRPC server with a rate limiter, its store and its configuration, the endpoints
+// of the configuration being the full method names, e.g. /orders.v1.Orders/Get.
+type RateLimiter struct {
+    limiter ratelimiter.RateLimiter
+    callers []CallerFunc
+}
+
+// NewRateLimiter creates a RateLimiter counting the calls of each caller, the first identity among the caller
+// functions. The calls are counted per PeerIP if none identifies the caller.
+//
+// Defaults to MTLSCaller if no caller function is specified
+func NewRateLimiter(limiter ratelimiter.RateLimiter, callers ...CallerFunc) *RateLimiter {
+    if len(callers) == 0 {
+        callers = []CallerFunc{MTLSCaller}
+    }
+    return &RateLimiter{
+        limiter: limiter,
+        callers: callers,
+    }
+}
+
+func (r *RateLimiter) caller(ctx context.Context) string {
+    for _, caller := range r.callers {
+        if id := caller(ctx); id != "" {
+            return id
+        }
+    }
+    return PeerIP(ctx)
+}
+
+// UnaryServerInterceptor rejects the calls over their limit with ResourceExhausted, with a RetryInfo detail and the
+// rate limit trailers, and with Unavailable when the store fails under StoreErrorReject.
+func (r *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+    return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+        trailer, err := r.allow(ctx, info.FullMethod)
+        if trailer != nil {
+            _ = grpc.SetTrailer(ctx, trailer)
+        }
+        if err != nil {
+            return nil, err
+        }
+        return handler(ctx, req)
+    }
+}
+
+// StreamServerInterceptor limits the streams like UnaryServerInterceptor limits the calls, a stream counts as one
+// call however many messages it carries.
+func (r *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+    return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+        trailer, err := r.allow(ss.Context(), info.FullMethod)
+        if trailer != nil {
+            ss.SetTrailer(trailer)
+        }
+        if err != nil {
+            return err
+        }
+        return handler(srv, ss)
+    }
+}
+
+// allow decides on the call and returns its trailers, nil if the method is not limited, and the status of a rejected
+// call.
+func (r *RateLimiter) allow(ctx context.Context, method string) (metadata.MD, error) {
+    caller := r.caller(ctx)
+    d, err := r.limiter.AllowRequest(ctx, method, caller)
+    if err != nil && !d.Allowed {
+        return nil, status.Errorf(codes.Unavailable, "rate limiter unavailable for %s", method)
+    }
+    var trailer metadata.MD
+    if d.Limit > 0 {
+        trailer = metadata.Pairs(TrailerLimit, strconv.FormatInt(d.Limit, 10), TrailerRemaining, strconv.FormatInt(d.Remaining, 10))
+        if !d.ResetAt.IsZero() {
+            trailer.Set(TrailerReset, strconv.FormatInt(ceilSeconds(time.Until(d.ResetAt)), 10))
+        }
+    }
+    if d.Allowed {
+        return trailer, nil
+    }
+    st := status.New(codes.ResourceExhausted, fmt.Sprintf("caller %s is over its limit of %s", caller, method))
+    if d.RetryAfter > 0 {
+        if trailer == nil {
+            trailer = metadata.MD{}
+        }
+        trailer.Set(TrailerRetryAfter, strconv.FormatInt(ceilSeconds(d.RetryAfter), 10))
+        if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(d.RetryAfter)}); err == nil {
+            st = detailed
+        }
+    }
+    return trailer, st.Err()
+}
+
+// ceilSeconds rounds the duration up to whole seconds, a client retrying after the rounded delay isn't rejected again.
+func ceilSeconds(d time.Duration) int64 {
+    return int64(math.Ceil(max(d, 0).Seconds()))
+}
@@ -0,0 +1,118 @@
+package grpc_server
+
+import (
+    "context"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "google.golang.org/genproto/googleapis/rpc/errdetails"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/status"
+    "net"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func newLimitedClient(t *testing.T, config ratelimiter.RateLimiterConfig, store ratelimiterstore.Store) healthpb.HealthClient {
+    t.Helper()
+    limiter := ratelimiter.NewRateLimiter(config, store, nil)
+    t.Cleanup(func() {
+        _ = limiter.Close()
+    })
+    r := NewRateLimiter(limiter, MetadataCaller("x-api-key"))
+    s, _ := NewServer(ServerConfig{}, grpc.UnaryInterceptor(r.UnaryServerInterceptor()), grpc.StreamInterceptor(r.StreamServerInterceptor()))
+    return healthpb.NewHealthClient(dial(t, s))
+}
+
+func trailerValue(trailer metadata.MD, key string) string {
+    if values := trailer.Get(key); len(values) == 1 {
+        return values[0]
+    }
+    return ""
+}
+
+func TestRateLimiter(t *testing.T) {
+    client := newLimitedClient(t, ratelimiter.RateLimiterConfig{
+        checkMethod: {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+    }, ratelimiterstore.NewMemoryStore())
+    call := func(key string) (metadata.MD, error) {
+        var trailer metadata.MD
+        ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", key)
+        _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+        return trailer, err
+    }
+
+    for i, remaining := range []string{"1", "0"} {
+        trailer, err := call("acme")
+        if err != nil {
+            t.Fatalf("call %d: %v", i, err)
+        }
+        if trailerValue(trailer, TrailerLimit) != "2" || trailerValue(trailer, TrailerRemaining) != remaining {
+            t.Fatalf("call %d: trailer %v, limit 2 and %s remaining expected", i, trailer, remaining)
+        }
+    }
+
+    trailer, err := call("acme")
+    st := status.Convert(err)
+    if st.Code() != codes.ResourceExhausted {
+        t.Fatalf("call over the limit: %v, ResourceExhausted expected", err)
+    }
+    retryAfter, _ := strconv.Atoi(trailerValue(trailer, TrailerRetryAfter))
+    if retryAfter < 1 || retryAfter > 60 {
+        t.Fatalf("trailer %v, a retry-after of 1 to 60 seconds expected", trailer)
+    }
+    var retryInfo *errdetails.RetryInfo
+    for _, detail := range st.Details() {
+        if info, ok := detail.(*errdetails.RetryInfo); ok {
+            retryInfo = info
+        }
+    }
+    if retryInfo == nil || retryInfo.RetryDelay.AsDuration() <= 0 {
+        t.Fatalf("details %v, a RetryInfo expected", st.Details())
+    }
+
+    // Another caller has its own budget
+    if _, err := call("globex"); err != nil {
+        t.Fatalf("call of another caller: %v", err)
+    }
+    // The methods without a limit are not limited, nor their streams
+    stream, err := client.Watch(metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "acme"), &healthpb.HealthCheckRequest{})
+    if err != nil {
+        t.Fatalf("Watch: %v", err)
+    }
+    if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+        t.Fatalf("Watch: %v, %v, SERVING expected", resp, err)
+    }
+}
+
+func TestRateLimiterStoreErrors(t *testing.T) {
+    client := newLimitedClient(t, ratelimiter.RateLimiterConfig{
+        checkMethod: {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second, OnStoreError: ratelimiter.StoreErrorReject},
+    }, failingStore{ratelimiterstore.NewMemoryStore()})
+    // The caller is not over its limit, it should retry another instance rather than back off
+    if code := check(client, "acme"); code != codes.Unavailable {
+        t.Fatalf("call with a failing store: %s, Unavailable expected", code)
+    }
+}
+
+func TestPeerIP(t *testing.T) {
+    for _, test := range []struct {
+        addr net.Addr
+        ip   string
+    }{
+        {&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}, "10.0.0.1"},
+        {&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}, "2001:db8::1"},
+        {&net.UnixAddr{Name: "/run/orders.sock", Net: "unix"}, "/run/orders.sock"},
+    } {
+        if ip := PeerIP(peer.NewContext(context.Background(), &peer.Peer{Addr: test.addr})); ip != test.ip {
+            t.Fatalf("PeerIP of %s: %q, %q expected", test.addr, ip, test.ip)
+        }
+    }
+    if ip := PeerIP(context.Background()); ip != "" {
+        t.Fatalf("PeerIP without a peer: %q", ip)
+    }
+}
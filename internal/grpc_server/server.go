@@ -0,0 +1,84 @@
+package grpc_server
+
+import (
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/health"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/keepalive"
+    "google.golang.org/grpc/reflection"
+    "time"
+)
+
+type ServerConfig struct {
+    // KeepaliveTime is the idle time after which the server pings the client to check the connection is alive
+    //
+    // Defaults to 2 hours if not specified
+    KeepaliveTime time.Duration `json:"keepalive_time,omitempty"`
+    // KeepaliveTimeout is how long the server waits for the ping acknowledgement before closing the connection
+    //
+    // Defaults to 20 seconds if not specified
+    KeepaliveTimeout time.Duration `json:"keepalive_timeout,omitempty"`
+    // MaxConnectionAge forces clients to reconnect periodically so load balancers can rebalance long-lived connections
+    //
+    // Defaults to no limit if not specified
+    MaxConnectionAge time.Duration `json:"max_connection_age,omitempty"`
+    // MinClientPingInterval is the minimum interval between client pings, clients pinging more often are disconnected
+    //
+    // Defaults to 10 seconds if not specified
+    MinClientPingInterval time.Duration `json:"min_client_ping_interval,omitempty"`
+    // DisableReflection hides the services from tools like grpcurl
+    DisableReflection bool `json:"disable_reflection,omitempty"`
+}
+
+// DefaultServerConfig returns the default configuration for a gRPC server.
+//
+// Defaults are:
+// - KeepaliveTime: 2 hours
+// - KeepaliveTimeout: 20 seconds
+// - MinClientPingInterval: 10 seconds
+func DefaultServerConfig() ServerConfig {
+    return ServerConfig{
+        KeepaliveTime:         2 * time.Hour,    // Default keepalive time of 2 hours
+        KeepaliveTimeout:      20 * time.Second, // Default keepalive timeout of 20 seconds
+        MinClientPingInterval: 10 * time.Second, // Default minimum client ping interval of 10 seconds
+    }
+}
+
+// NewServer creates a gRPC server with keepalive tuning and the standard grpc.health.v1 and reflection services registered.
+//
+// The returned health server reports SERVING for the overall server, services registered afterwards should set their
+// own status with SetServingStatus and the daemon should call Shutdown on it before stopping the server.
+func NewServer(config ServerConfig, opts ...grpc.ServerOption) (*grpc.Server, *health.Server) {
+    defaults := DefaultServerConfig()
+    if config.KeepaliveTime == 0 {
+        config.KeepaliveTime = defaults.KeepaliveTime
+    }
+    if config.KeepaliveTimeout == 0 {
+        config.KeepaliveTimeout = defaults.KeepaliveTimeout
+    }
+    if config.MinClientPingInterval == 0 {
+        config.MinClientPingInterval = defaults.MinClientPingInterval
+    }
+
+    opts = append([]grpc.ServerOption{
+        grpc.KeepaliveParams(keepalive.ServerParameters{
+            Time:             config.KeepaliveTime,
+            Timeout:          config.KeepaliveTimeout,
+            MaxConnectionAge: config.MaxConnectionAge,
+        }),
+        grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+            MinTime: config.MinClientPingInterval,
+            // Clients such as Envoy keep idle connections open with pings
+            PermitWithoutStream: true,
+        }),
+    }, opts...)
+    s := grpc.NewServer(opts...)
+
+    h := health.NewServer()
+    healthpb.RegisterHealthServer(s, h)
+    h.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+    if !config.DisableReflection {
+        reflection.Register(s)
+    }
+    return s, h
+}
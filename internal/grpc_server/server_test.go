@@ -0,0 +1,62 @@
+package grpc_server
+
+import (
+    "context"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/credentials/insecure"
+    healthpb "google.golang.org/grpc/health/grpc_health_v1"
+    "google.golang.org/grpc/test/bufconn"
+    "net"
+    "testing"
+)
+
+// dial serves the server on an in-memory listener and returns a connection to it.
+func dial(t *testing.T, s *grpc.Server) *grpc.ClientConn {
+    t.Helper()
+    lis := bufconn.Listen(1 << 20)
+    go func() {
+        _ = s.Serve(lis)
+    }()
+    t.Cleanup(s.Stop)
+    conn, err := grpc.NewClient("passthrough:///server",
+        grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+            return lis.DialContext(ctx)
+        }),
+        grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatalf("NewClient: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = conn.Close()
+    })
+    return conn
+}
+
+func TestNewServer(t *testing.T) {
+    s, h := NewServer(ServerConfig{})
+    if _, ok := s.GetServiceInfo()["grpc.reflection.v1.ServerReflection"]; !ok {
+        t.Fatalf("reflection not registered: %v", s.GetServiceInfo())
+    }
+    client := healthpb.NewHealthClient(dial(t, s))
+    resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+    if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+        t.Fatalf("Check: %v, %v, SERVING expected", resp, err)
+    }
+
+    // The daemon reports NOT_SERVING while it drains before stopping the server
+    h.Shutdown()
+    resp, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+    if err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+        t.Fatalf("Check after Shutdown: %v, %v, NOT_SERVING expected", resp, err)
+    }
+}
+
+func TestNewServerDisableReflection(t *testing.T) {
+    s, _ := NewServer(ServerConfig{DisableReflection: true})
+    defer s.Stop()
+    for name := range s.GetServiceInfo() {
+        if name != healthpb.Health_ServiceDesc.ServiceName {
+            t.Fatalf("service %s registered, only the health service expected", name)
+        }
+    }
+}
@@ -0,0 +1,349 @@
+package jwt
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "golang.org/x/sync/singleflight"
+    "math/big"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Config struct {
+    // JWKSURL is the URL of the JSON Web Key Set the tokens are signed with
+    //
+    // Defaults to the jwks_uri of the /.well-known/openid-configuration document of the Issuer if not specified
+    JWKSURL string `json:"jwks_url,omitempty"`
+    // Issuer the tokens must be issued by, a trailing slash is ignored
+    //
+    // Defaults to any issuer if not specified
+    Issuer string `json:"issuer,omitempty"`
+    // Audience the tokens must be issued for
+    //
+    // Defaults to any audience if not specified
+    Audience string `json:"audience,omitempty"`
+    // KeysTTL is how long the keys are cached, they are fetched again earlier for a token signed with an unknown key
+    //
+    // Defaults to 1 hour if not specified
+    KeysTTL time.Duration `json:"keys_ttl,omitempty"`
+    // Leeway accepted on the expiry and the not before time of the tokens, for the clock skew with the issuer
+    //
+    // Defaults to 1 minute if not specified
+    Leeway time.Duration `json:"leeway,omitempty"`
+    // Timeout of the requests fetching the keys
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// minKeysRefresh is the shortest interval between two fetches of the keys, so tokens with made up key ids don't
+// reach the key set on every request.
+const minKeysRefresh = time.Minute
+
+// Verifier verifies the JWTs signed with the keys of a JSON Web Key Set, caching the keys.
+type Verifier struct {
+    config Config
+    http   *http.Client
+    group  singleflight.Group
+    now    func() time.Time
+
+    mu        sync.Mutex
+    keys      map[string]crypto.PublicKey
+    fetchedAt time.Time
+}
+
+// NewVerifier creates a Verifier of the JWTs signed with the keys of the key set of the configuration, or of the issuer
+// found through its discovery document. RS256, RS384, RS512, ES256, ES384 and ES512 signatures are supported.
+func NewVerifier(config Config) *Verifier {
+    config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+    if config.KeysTTL == 0 {
+        config.KeysTTL = time.Hour
+    }
+    if config.Leeway == 0 {
+        config.Leeway = time.Minute
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 5 * time.Second
+    }
+    return &Verifier{
+        config: config,
+        http:   &http.Client{Timeout: config.Timeout},
+        now:    time.Now,
+    }
+}
+
+// Verify checks the signature and the registered claims of the token, and returns its claims. The errors of a token
+// that is not valid wrap ErrInvalidToken, the others are failures to fetch the keys.
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]any, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+    }
+    var header struct {
+        Alg string `json:"alg"`
+        Kid string `json:"kid"`
+    }
+    if err := decodeSegment(parts[0], &header); err != nil {
+        return nil, err
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+    }
+    key, err := v.key(ctx, header.Kid)
+    if err != nil {
+        return nil, err
+    }
+    if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+        return nil, err
+    }
+
+    var claims map[string]any
+    if err = decodeSegment(parts[1], &claims); err != nil {
+        return nil, err
+    }
+    if iss, _ := claims["iss"].(string); v.config.Issuer != "" && strings.TrimSuffix(iss, "/") != v.config.Issuer {
+        return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, iss)
+    }
+    if v.config.Audience != "" {
+        audienceOK := false
+        for _, aud := range StringsClaim(claims["aud"]) {
+            audienceOK = audienceOK || aud == v.config.Audience
+        }
+        if !audienceOK {
+            return nil, fmt.Errorf("%w: token not issued for %s", ErrInvalidToken, v.config.Audience)
+        }
+    }
+    now := v.now()
+    exp, ok := claims["exp"].(float64)
+    if !ok || !now.Before(time.Unix(int64(exp), 0).Add(v.config.Leeway)) {
+        return nil, fmt.Errorf("%w: token expired", ErrInvalidToken)
+    }
+    if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+        return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidToken)
+    }
+    return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+    data, err := base64.RawURLEncoding.DecodeString(segment)
+    if err != nil {
+        return fmt.Errorf("%w: malformed token", ErrInvalidToken)
+    }
+    if err = json.Unmarshal(data, v); err != nil {
+        return fmt.Errorf("%w: malformed token", ErrInvalidToken)
+    }
+    return nil
+}
+
+// StringsClaim returns the values of a claim holding a string or a list of strings.
+func StringsClaim(claim any) []string {
+    switch v := claim.(type) {
+    case string:
+        return []string{v}
+    case []any:
+        values := make([]string, 0, len(v))
+        for _, e := range v {
+            if s, ok := e.(string); ok {
+                values = append(values, s)
+            }
+        }
+        return values
+    }
+    return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, input string, signature []byte) error {
+    var hash crypto.Hash
+    switch alg[min(len(alg), 2):] {
+    case "256":
+        hash = crypto.SHA256
+    case "384":
+        hash = crypto.SHA384
+    case "512":
+        hash = crypto.SHA512
+    default:
+        return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+    }
+    h := hash.New()
+    h.Write([]byte(input))
+    digest := h.Sum(nil)
+
+    switch k := key.(type) {
+    case *rsa.PublicKey:
+        if !strings.HasPrefix(alg, "RS") {
+            break
+        }
+        if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+            return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+        }
+        return nil
+    case *ecdsa.PublicKey:
+        size := (k.Curve.Params().BitSize + 7) / 8
+        if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+            break
+        }
+        r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+        if !ecdsa.Verify(k, digest, r, s) {
+            return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+        }
+        return nil
+    }
+    return fmt.Errorf("%w: algorithm %s doesn't match the key", ErrInvalidToken, alg)
+}
+
+// key returns the key with the id, fetching the key set when it is stale or doesn't have it.
+func (v *Verifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+    v.mu.Lock()
+    key, ok := v.keys[kid]
+    fetchedAt := v.fetchedAt
+    v.mu.Unlock()
+    age := v.now().Sub(fetchedAt)
+    if ok && age < v.config.KeysTTL {
+        return key, nil
+    }
+    if !ok && age < minKeysRefresh {
+        return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+    }
+    keys, err, _ := v.group.Do("keys", func() (any, error) {
+        // Shared by the waiting requests, so not cancelled with the request that started it
+        timeout := v.config.Timeout
+        if v.config.JWKSURL == "" {
+            // The discovery document is fetched first
+            timeout *= 2
+        }
+        ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+        defer cancel()
+        return v.fetchKeys(ctx)
+    })
+    if err != nil {
+        if ok {
+            // The key set is unavailable, keep using the stale key
+            return key, nil
+        }
+        return nil, err
+    }
+    if key, ok = keys.(map[string]crypto.PublicKey)[kid]; !ok {
+        return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+    }
+    return key, nil
+}
+
+// fetchKeys fetches the signing keys of the key set, found from the discovery document of the issuer without a
+// JWKSURL.
+func (v *Verifier) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+    jwksURL := v.config.JWKSURL
+    if jwksURL == "" {
+        var discovery struct {
+            Issuer  string `json:"issuer"`
+            JWKSURI string `json:"jwks_uri"`
+        }
+        if err := v.get(ctx, v.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+            return nil, err
+        }
+        if strings.TrimSuffix(discovery.Issuer, "/") != v.config.Issuer || discovery.JWKSURI == "" {
+            return nil, fmt.Errorf("failed to discover issuer %s: unexpected discovery document", v.config.Issuer)
+        }
+        jwksURL = discovery.JWKSURI
+    }
+    var set struct {
+        Keys []jwk `json:"keys"`
+    }
+    if err := v.get(ctx, jwksURL, &set); err != nil {
+        return nil, err
+    }
+    keys := make(map[string]crypto.PublicKey, len(set.Keys))
+    for _, k := range set.Keys {
+        if k.Use != "" && k.Use != "sig" {
+            continue
+        }
+        if key, err := k.publicKey(); err == nil {
+            keys[k.Kid] = key
+        }
+    }
+    v.mu.Lock()
+    v.keys = keys
+    v.fetchedAt = v.now()
+    v.mu.Unlock()
+    return keys, nil
+}
+
+func (v *Verifier) get(ctx context.Context, url string, value any) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Accept", "application/json")
+    resp, err := v.http.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to fetch %s: %w", url, err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("failed to fetch %s: unexpected status %s", url, resp.Status)
+    }
+    if err = json.NewDecoder(resp.Body).Decode(value); err != nil {
+        return fmt.Errorf("failed to parse %s: %w", url, err)
+    }
+    return nil
+}
+
+// jwk is a public key of a JSON Web Key Set.
+type jwk struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    N   string `json:"n"`
+    E   string `json:"e"`
+    Crv string `json:"crv"`
+    X   string `json:"x"`
+    Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+    switch k.Kty {
+    case "RSA":
+        n, err := base64.RawURLEncoding.DecodeString(k.N)
+        if err != nil {
+            return nil, err
+        }
+        e, err := base64.RawURLEncoding.DecodeString(k.E)
+        if err != nil {
+            return nil, err
+        }
+        return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+    case "EC":
+        var curve elliptic.Curve
+        switch k.Crv {
+        case "P-256":
+            curve = elliptic.P256()
+        case "P-384":
+            curve = elliptic.P384()
+        case "P-521":
+            curve = elliptic.P521()
+        default:
+            return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+        }
+        x, err := base64.RawURLEncoding.DecodeString(k.X)
+        if err != nil {
+            return nil, err
+        }
+        y, err := base64.RawURLEncoding.DecodeString(k.Y)
+        if err != nil {
+            return nil, err
+        }
+        return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+    }
+    return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
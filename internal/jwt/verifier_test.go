@@ -0,0 +1,130 @@
+package jwt
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// issuer serves the discovery document and the key set of an RSA and an EC key.
+type issuer struct {
+    server *httptest.Server
+    rsa    *rsa.PrivateKey
+    ec     *ecdsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+    t.Helper()
+    rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    i := &issuer{rsa: rsaKey, ec: ecKey}
+    encode := base64.RawURLEncoding.EncodeToString
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string]string{"issuer": i.server.URL, "jwks_uri": i.server.URL + "/keys"})
+    })
+    mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string][]jwk{"keys": {
+            {Kty: "RSA", Kid: "rsa", Use: "sig", N: encode(rsaKey.N.Bytes()), E: "AQAB"},
+            {Kty: "EC", Kid: "ec", Crv: "P-256", X: encode(ecKey.X.FillBytes(make([]byte, 32))), Y: encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+        }})
+    })
+    i.server = httptest.NewServer(mux)
+    t.Cleanup(i.server.Close)
+    return i
+}
+
+// token signs the claims with the key of the id, RS256 for rsa and ES256 for ec.
+func (i *issuer) token(t *testing.T, kid string, claims map[string]any) string {
+    t.Helper()
+    alg := map[string]string{"rsa": "RS256", "ec": "ES256"}[kid]
+    header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+    payload, _ := json.Marshal(claims)
+    input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+    digest := sha256.Sum256([]byte(input))
+    var signature []byte
+    if kid == "rsa" {
+        var err error
+        if signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsa, crypto.SHA256, digest[:]); err != nil {
+            t.Fatalf("SignPKCS1v15: %v", err)
+        }
+    } else {
+        r, s, err := ecdsa.Sign(rand.Reader, i.ec, digest[:])
+        if err != nil {
+            t.Fatalf("Sign: %v", err)
+        }
+        signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+    }
+    return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerify(t *testing.T) {
+    i := newIssuer(t)
+    now := time.Now()
+    claims := func(changes map[string]any) map[string]any {
+        c := map[string]any{"iss": i.server.URL + "/", "aud": []string{"console"}, "sub": "alice", "exp": now.Add(time.Hour).Unix()}
+        for k, v := range changes {
+            c[k] = v
+        }
+        return c
+    }
+    for _, tt := range []struct {
+        name    string
+        config  Config
+        kid     string
+        claims  map[string]any
+        invalid bool
+    }{
+        {name: "discovered", config: Config{Issuer: i.server.URL, Audience: "console"}, kid: "rsa", claims: claims(nil)},
+        {name: "key set", config: Config{JWKSURL: i.server.URL + "/keys"}, kid: "ec", claims: claims(nil)},
+        {name: "expired within the leeway", config: Config{Issuer: i.server.URL}, kid: "rsa", claims: claims(map[string]any{"exp": now.Add(-time.Second).Unix()})},
+        {name: "expired", config: Config{Issuer: i.server.URL}, kid: "rsa", claims: claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}), invalid: true},
+        {name: "not valid yet", config: Config{Issuer: i.server.URL}, kid: "ec", claims: claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}), invalid: true},
+        {name: "other audience", config: Config{Issuer: i.server.URL, Audience: "api"}, kid: "rsa", claims: claims(nil), invalid: true},
+        {name: "other issuer", config: Config{JWKSURL: i.server.URL + "/keys", Issuer: "https://other.example.com"}, kid: "rsa", claims: claims(nil), invalid: true},
+    } {
+        t.Run(tt.name, func(t *testing.T) {
+            v := NewVerifier(tt.config)
+            got, err := v.Verify(context.Background(), i.token(t, tt.kid, tt.claims))
+            if tt.invalid {
+                if !errors.Is(err, ErrInvalidToken) {
+                    t.Fatalf("Verify: %v, ErrInvalidToken expected", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("Verify: %v", err)
+            }
+            if got["sub"] != "alice" {
+                t.Fatalf("sub %v, alice expected", got["sub"])
+            }
+        })
+    }
+}
+
+// A token signed by another key with the id of a known one is rejected.
+func TestVerifySignatureMismatch(t *testing.T) {
+    i, other := newIssuer(t), newIssuer(t)
+    v := NewVerifier(Config{Issuer: i.server.URL})
+    token := other.token(t, "rsa", map[string]any{"iss": i.server.URL, "exp": time.Now().Add(time.Hour).Unix()})
+    if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+        t.Fatalf("Verify: %v, ErrInvalidToken expected", err)
+    }
+}
@@ -0,0 +1,210 @@
+package leader_election
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "strconv"
+    "sync/atomic"
+    "time"
+)
+
+// renewScript extends the lease only if it is still held by this node.
+var renewScript = radix.NewEvalScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the lease only if it is still held by this node.
+var releaseScript = radix.NewEvalScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+    return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Elector interface defines the methods for electing a single leader among the instances of a fleet.
+type Elector interface {
+    // Run campaigns for leadership until the context is cancelled, task is run while this instance is the leader with a
+    // context that is cancelled as soon as the leadership is lost
+    Run(ctx context.Context, task func(ctx context.Context)) error
+    // IsLeader reports whether this instance currently holds the leadership
+    IsLeader() bool
+    // Leader returns the node ID of the current leader, or an empty string if there is none
+    Leader(ctx context.Context) (string, error)
+}
+
+type ElectionConfig struct {
+    // Key is the Redis key holding the lease, one per singleton task, e.g. "leader:usage-export"
+    Key string `json:"key"`
+    // NodeID identifies this instance, it must be unique in the fleet
+    NodeID string `json:"node_id"`
+    // LeaseDuration is how long the leadership is kept without being renewed, it bounds the failover time
+    //
+    // Defaults to 15 seconds if not specified
+    LeaseDuration time.Duration `json:"lease_duration,omitempty"`
+    // RenewInterval is how often the leader renews its lease and followers try to acquire it
+    //
+    // Defaults to a third of LeaseDuration if not specified
+    RenewInterval time.Duration `json:"renew_interval,omitempty"`
+    // OnChange is called whenever this instance gains or loses the leadership
+    OnChange func(leader bool) `json:"-"`
+}
+
+type redisElector struct {
+    client radix.Client
+    config ElectionConfig
+    leader atomic.Bool
+}
+
+// NewRedisElector creates an Elector holding its lease in Redis.
+func NewRedisElector(client radix.Client, config ElectionConfig) (Elector, error) {
+    if config.Key == "" || config.NodeID == "" {
+        return nil, errors.New("leader election requires a key and a node ID")
+    }
+    if config.LeaseDuration == 0 {
+        config.LeaseDuration = 15 * time.Second
+    }
+    if config.RenewInterval == 0 {
+        config.RenewInterval = config.LeaseDuration / 3
+    }
+    if config.RenewInterval >= config.LeaseDuration {
+        return nil, fmt.Errorf("renew interval %s must be shorter than the lease duration %s", config.RenewInterval, config.LeaseDuration)
+    }
+    return &redisElector{
+        client: client,
+        config: config,
+    }, nil
+}
+
+func (e *redisElector) Run(ctx context.Context, task func(ctx context.Context)) error {
+    var running *runningTask
+    stopTask := func() {
+        if running != nil {
+            running.stop()
+            running = nil
+        }
+    }
+    defer func() {
+        stopTask()
+        if e.leader.Load() {
+            // Step down right away instead of letting the followers wait for the lease to expire
+            releaseCtx, cancel := context.WithTimeout(context.Background(), e.config.RenewInterval)
+            defer cancel()
+            if err := e.client.Do(releaseCtx, releaseScript.Cmd(nil, []string{e.config.Key}, e.config.NodeID)); err != nil {
+                slog.Error("Error releasing leadership", "key", e.config.Key, "error", err)
+            }
+            e.setLeader(false)
+        }
+    }()
+
+    ticker := time.NewTicker(e.config.RenewInterval)
+    defer ticker.Stop()
+    // leaseDeadline is the earliest the lease held by this instance can expire, LeaseDuration after the last confirmed
+    // renew or acquisition was sent. No other instance can acquire the lease before, the task is stopped by then.
+    var leaseDeadline time.Time
+    for {
+        start := time.Now()
+        // A hung connection can't keep the loop waiting, nor the task running past the lease
+        deadline := start.Add(e.config.RenewInterval)
+        if e.leader.Load() && leaseDeadline.Before(deadline) {
+            deadline = leaseDeadline
+        }
+        campaignCtx, cancel := context.WithDeadline(ctx, deadline)
+        leader, err := e.campaign(campaignCtx)
+        cancel()
+        if err != nil {
+            slog.Error("Error campaigning for leadership", "key", e.config.Key, "error", err)
+            // A lease that failed to renew is still held until its deadline, the next renew may succeed before
+            leader = leader && time.Now().Before(leaseDeadline)
+        } else if leader {
+            leaseDeadline = start.Add(e.config.LeaseDuration)
+        }
+        if leader && running == nil {
+            running = startTask(ctx, task)
+        } else if !leader {
+            stopTask()
+        }
+        e.setLeader(leader)
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
+
+// runningTask is the singleton task started when the leadership was acquired.
+type runningTask struct {
+    cancel context.CancelFunc
+    done   chan struct{}
+}
+
+func startTask(ctx context.Context, task func(ctx context.Context)) *runningTask {
+    taskCtx, cancel := context.WithCancel(ctx)
+    t := &runningTask{
+        cancel: cancel,
+        done:   make(chan struct{}),
+    }
+    go func() {
+        defer close(t.done)
+        task(taskCtx)
+    }()
+    return t
+}
+
+// stop cancels the task and waits for it to return.
+func (t *runningTask) stop() {
+    t.cancel()
+    <-t.done
+}
+
+// campaign renews the lease if this instance holds it, otherwise it tries to acquire it.
+//
+// A renew that failed reports the leadership with its error, as the lease may still be held.
+func (e *redisElector) campaign(ctx context.Context) (bool, error) {
+    ttl := strconv.FormatInt(e.config.LeaseDuration.Milliseconds(), 10)
+    if e.leader.Load() {
+        var renewed int
+        if err := e.client.Do(ctx, renewScript.Cmd(&renewed, []string{e.config.Key}, e.config.NodeID, ttl)); err != nil {
+            return true, fmt.Errorf("failed to renew lease %s: %w", e.config.Key, err)
+        }
+        if renewed == 1 {
+            return true, nil
+        }
+    }
+    var acquired radix.Maybe
+    if err := e.client.Do(ctx, radix.Cmd(&acquired, "SET", e.config.Key, e.config.NodeID, "NX", "PX", ttl)); err != nil {
+        return false, fmt.Errorf("failed to acquire lease %s: %w", e.config.Key, err)
+    }
+    return !acquired.Null, nil
+}
+
+func (e *redisElector) setLeader(leader bool) {
+    if e.leader.Swap(leader) == leader {
+        return
+    }
+    slog.Info("Leadership changed", "key", e.config.Key, "node_id", e.config.NodeID, "leader", leader)
+    if e.config.OnChange != nil {
+        e.config.OnChange(leader)
+    }
+}
+
+func (e *redisElector) IsLeader() bool {
+    return e.leader.Load()
+}
+
+func (e *redisElector) Leader(ctx context.Context) (string, error) {
+    var leader radix.Maybe
+    var node string
+    leader.Rcv = &node
+    if err := e.client.Do(ctx, radix.Cmd(&leader, "GET", e.config.Key)); err != nil {
+        return "", fmt.Errorf("failed to get leader %s: %w", e.config.Key, err)
+    }
+    return node, nil
+}
@@ -0,0 +1,125 @@
+package leader_election
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/mediocregopher/radix/v4"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// hangingClient stops answering once hang is set, like a Redis behind a dead connection, the calls block until their
+// context is done.
+type hangingClient struct {
+    radix.Client
+    hang atomic.Bool
+}
+
+func (c *hangingClient) Do(ctx context.Context, action radix.Action) error {
+    if c.hang.Load() {
+        <-ctx.Done()
+        return ctx.Err()
+    }
+    return c.Client.Do(ctx, action)
+}
+
+func newClient(t *testing.T, mr *miniredis.Miniredis) radix.Client {
+    t.Helper()
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    return client
+}
+
+// run runs the elector until the test ends or cancel is called, and returns the channels of the starts and the ends of its task.
+func run(t *testing.T, elector Elector) (cancel context.CancelFunc, started, stopped chan struct{}) {
+    ctx, cancel := context.WithCancel(context.Background())
+    started, stopped = make(chan struct{}, 10), make(chan struct{}, 10)
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        _ = elector.Run(ctx, func(ctx context.Context) {
+            started <- struct{}{}
+            <-ctx.Done()
+            stopped <- struct{}{}
+        })
+    }()
+    t.Cleanup(func() {
+        cancel()
+        <-done
+    })
+    return cancel, started, stopped
+}
+
+func wait(t *testing.T, ch chan struct{}, timeout time.Duration, what string) {
+    t.Helper()
+    select {
+    case <-ch:
+    case <-time.After(timeout):
+        t.Fatalf("%s not within %s", what, timeout)
+    }
+}
+
+func TestElectionFailsOverOnShutdown(t *testing.T) {
+    mr := miniredis.RunT(t)
+    config := ElectionConfig{Key: "leader:test", LeaseDuration: 3 * time.Second, RenewInterval: 50 * time.Millisecond}
+    config.NodeID = "node-1"
+    first, err := NewRedisElector(newClient(t, mr), config)
+    if err != nil {
+        t.Fatalf("NewRedisElector: %v", err)
+    }
+    config.NodeID = "node-2"
+    second, err := NewRedisElector(newClient(t, mr), config)
+    if err != nil {
+        t.Fatalf("NewRedisElector: %v", err)
+    }
+
+    cancel, started, stopped := run(t, first)
+    wait(t, started, time.Second, "first leader")
+    _, secondStarted, _ := run(t, second)
+    time.Sleep(200 * time.Millisecond)
+    if !first.IsLeader() || second.IsLeader() {
+        t.Fatalf("leaders %t %t, only the first expected", first.IsLeader(), second.IsLeader())
+    }
+    if leader, err := second.Leader(context.Background()); err != nil || leader != "node-1" {
+        t.Fatalf("Leader: %q, %v, node-1 expected", leader, err)
+    }
+
+    // The leader releases the lease on shutdown, the follower doesn't wait for it to expire
+    cancel()
+    wait(t, stopped, time.Second, "task of the first leader stopped")
+    wait(t, secondStarted, time.Second, "second leader")
+    if first.IsLeader() || !second.IsLeader() {
+        t.Fatalf("leaders %t %t, only the second expected", first.IsLeader(), second.IsLeader())
+    }
+}
+
+// A leader whose renews hang steps down by the end of its lease, before another instance can acquire it.
+func TestElectionStepsDownWhenRenewsHang(t *testing.T) {
+    mr := miniredis.RunT(t)
+    client := &hangingClient{Client: newClient(t, mr)}
+    const lease = 500 * time.Millisecond
+    elector, err := NewRedisElector(client, ElectionConfig{Key: "leader:test", NodeID: "node-1", LeaseDuration: lease, RenewInterval: 100 * time.Millisecond})
+    if err != nil {
+        t.Fatalf("NewRedisElector: %v", err)
+    }
+    _, started, stopped := run(t, elector)
+    wait(t, started, time.Second, "leader")
+
+    client.hang.Store(true)
+    hung := time.Now()
+    // The lease is kept through the failed renews until it may expire
+    time.Sleep(lease / 2)
+    if !elector.IsLeader() {
+        t.Fatalf("stepped down %s after the renews hung, the lease is still held", time.Since(hung))
+    }
+    wait(t, stopped, lease, "task stopped")
+    if elector.IsLeader() {
+        t.Fatalf("still leader after the lease")
+    }
+}
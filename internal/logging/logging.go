@@ -0,0 +1,39 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+)
+
+// ComponentKey is the attribute naming the component that emitted a record.
+const ComponentKey = "component"
+
+// levelHandler drops the records below its own level before they reach the wrapped handler.
+type levelHandler struct {
+    level   slog.Leveler
+    handler slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    return level >= h.level.Level() && h.handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+    return h.handler.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &levelHandler{level: h.level, handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+    return &levelHandler{level: h.level, handler: h.handler.WithGroup(name)}
+}
+
+// ComponentLogger returns a logger tagging every record with the component, and only emitting records at or above
+// level, so each component can be tuned independently on top of a shared handler.
+//
+// A *slog.LevelVar can be passed as level to change it at runtime.
+func ComponentLogger(handler slog.Handler, component string, level slog.Leveler) *slog.Logger {
+    return slog.New(&levelHandler{level: level, handler: handler}).With(ComponentKey, component)
+}
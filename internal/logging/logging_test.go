@@ -0,0 +1,84 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "testing"
+)
+
+// recorder keeps the records it handles, with the attributes of its logger.
+type recorder struct {
+    mu      *sync.Mutex
+    records *[]slog.Record
+    attrs   []slog.Attr
+}
+
+func newRecorder() *recorder {
+    return &recorder{mu: &sync.Mutex{}, records: &[]slog.Record{}}
+}
+
+func (r *recorder) Enabled(context.Context, slog.Level) bool {
+    return true
+}
+
+func (r *recorder) Handle(_ context.Context, record slog.Record) error {
+    record = record.Clone()
+    record.AddAttrs(r.attrs...)
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    *r.records = append(*r.records, record)
+    return nil
+}
+
+func (r *recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+    return &recorder{mu: r.mu, records: r.records, attrs: append(append([]slog.Attr{}, r.attrs...), attrs...)}
+}
+
+func (r *recorder) WithGroup(string) slog.Handler {
+    return r
+}
+
+func (r *recorder) Records() []slog.Record {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return append([]slog.Record{}, *r.records...)
+}
+
+// attr returns the value of the attribute of the record, nil if it has none.
+func attr(record slog.Record, key string) any {
+    var value any
+    record.Attrs(func(a slog.Attr) bool {
+        if a.Key == key {
+            value = a.Value.Any()
+            return false
+        }
+        return true
+    })
+    return value
+}
+
+func TestComponentLogger(t *testing.T) {
+    r := newRecorder()
+    level := &slog.LevelVar{}
+    level.Set(slog.LevelWarn)
+    logger := ComponentLogger(r, "ratelimiter", level)
+    logger.Info("Request allowed")
+    logger.Warn("Store unavailable")
+    records := r.Records()
+    if len(records) != 1 || records[0].Message != "Store unavailable" || attr(records[0], ComponentKey) != "ratelimiter" {
+        t.Fatalf("records %v, the warning of the ratelimiter component expected", records)
+    }
+
+    // The level changes at runtime
+    level.Set(slog.LevelDebug)
+    logger.Debug("Key extracted")
+    if records := r.Records(); len(records) != 2 {
+        t.Fatalf("records %v, the debug record expected after lowering the level", records)
+    }
+    // Another component keeps its own level
+    ComponentLogger(r, "store", slog.LevelError).Warn("Slow command")
+    if records := r.Records(); len(records) != 2 {
+        t.Fatalf("records %v, the warning of the store component dropped expected", records)
+    }
+}
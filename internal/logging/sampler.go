@@ -0,0 +1,80 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+type samplerEntry struct {
+    windowStart time.Time
+    count       int
+    suppressed  int
+}
+
+// Sampler logs a sample of repeated records so a storm of rejections logged on every request doesn't flood the logs.
+//
+// In every interval the first records of a message are logged, then one in every thereafter. A logged record carries
+// the number of records dropped since the previous one in the SuppressedKey attribute. Unlike Throttle, a steady
+// stream of records keeps showing in the logs in proportion to its rate.
+type Sampler struct {
+    interval   time.Duration
+    first      int
+    thereafter int
+    now        func() time.Time
+
+    mu      sync.Mutex
+    entries map[string]*samplerEntry // Keyed by level and message
+}
+
+// NewSampler creates a Sampler logging the first records of each message per interval, then one in every
+// thereafter. A thereafter of 0 drops the records beyond the first, an interval of 0 disables sampling.
+func NewSampler(interval time.Duration, first, thereafter int) *Sampler {
+    return &Sampler{
+        interval:   interval,
+        first:      first,
+        thereafter: thereafter,
+        now:        time.Now,
+        entries:    make(map[string]*samplerEntry),
+    }
+}
+
+// Log logs the record with the logger if it is in the sample. The records below the level of the logger are dropped
+// without being counted.
+func (s *Sampler) Log(ctx context.Context, logger *slog.Logger, level slog.Level, msg string, args ...any) {
+    if !logger.Enabled(ctx, level) {
+        return
+    }
+    if s.interval == 0 {
+        logger.Log(ctx, level, msg, args...)
+        return
+    }
+    key := level.String() + msg
+    now := s.now()
+
+    s.mu.Lock()
+    entry, ok := s.entries[key]
+    if !ok || now.Sub(entry.windowStart) >= s.interval {
+        suppressed := 0
+        if ok {
+            suppressed = entry.suppressed
+        }
+        entry = &samplerEntry{windowStart: now, suppressed: suppressed}
+        s.entries[key] = entry
+    }
+    entry.count++
+    if entry.count > s.first && (s.thereafter == 0 || (entry.count-s.first)%s.thereafter != 0) {
+        entry.suppressed++
+        s.mu.Unlock()
+        return
+    }
+    suppressed := entry.suppressed
+    entry.suppressed = 0
+    s.mu.Unlock()
+
+    if suppressed > 0 {
+        args = append(args, SuppressedKey, suppressed)
+    }
+    logger.Log(ctx, level, msg, args...)
+}
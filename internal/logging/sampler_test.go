@@ -0,0 +1,53 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "testing"
+    "time"
+)
+
+func TestSampler(t *testing.T) {
+    r := newRecorder()
+    logger := slog.New(r)
+    now := time.Unix(0, 0)
+    sampler := NewSampler(time.Minute, 2, 3)
+    sampler.now = func() time.Time {
+        return now
+    }
+    ctx := context.Background()
+
+    // The first 2, then one in every 3
+    for range 8 {
+        sampler.Log(ctx, logger, slog.LevelWarn, "Request rejected")
+    }
+    records := r.Records()
+    if len(records) != 4 || attr(records[2], SuppressedKey) != int64(2) || attr(records[3], SuppressedKey) != int64(2) {
+        t.Fatalf("records %v, records 1, 2, 5 and 8 expected", records)
+    }
+
+    // A new interval logs the first records again, with the records suppressed at the end of the previous one
+    sampler.Log(ctx, logger, slog.LevelWarn, "Request rejected")
+    now = now.Add(time.Minute)
+    sampler.Log(ctx, logger, slog.LevelWarn, "Request rejected")
+    records = r.Records()
+    if len(records) != 5 || attr(records[4], SuppressedKey) != int64(1) {
+        t.Fatalf("records %v, the record suppressed in the previous interval counted expected", records)
+    }
+}
+
+func TestSamplerDropsDisabledLevels(t *testing.T) {
+    r := newRecorder()
+    logger := ComponentLogger(r, "ratelimiter", slog.LevelWarn)
+    sampler := NewSampler(time.Minute, 1, 0)
+    for range 3 {
+        sampler.Log(context.Background(), logger, slog.LevelInfo, "Request rejected")
+    }
+    sampler.Log(context.Background(), logger, slog.LevelWarn, "Request rejected")
+    sampler.Log(context.Background(), logger, slog.LevelWarn, "Request rejected")
+    // The info records are neither logged nor counted, the warnings beyond the first are dropped
+    records := r.Records()
+    if len(records) != 1 || attr(records[0], SuppressedKey) != nil {
+        t.Fatalf("records %v, the first warning expected", records)
+    }
+}
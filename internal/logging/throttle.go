@@ -0,0 +1,67 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+// SuppressedKey is the attribute counting the records dropped since the previous record with the same message.
+const SuppressedKey = "suppressed"
+
+type throttleEntry struct {
+    windowStart time.Time
+    suppressed  int
+}
+
+// Throttle deduplicates repeated records so an outage logging on every request doesn't flood the logs.
+//
+// The first record of a message is logged, the following ones are dropped and counted until the interval elapses.
+// The next record after that is logged with the number of dropped records in the SuppressedKey attribute.
+type Throttle struct {
+    interval time.Duration
+    now      func() time.Time
+
+    mu      sync.Mutex
+    entries map[string]*throttleEntry // Keyed by level and message
+}
+
+// NewThrottle creates a Throttle logging each message at most once per interval, an interval of 0 disables throttling.
+func NewThrottle(interval time.Duration) *Throttle {
+    return &Throttle{
+        interval: interval,
+        now:      time.Now,
+        entries:  make(map[string]*throttleEntry),
+    }
+}
+
+// Log logs the record with the logger unless a record with the same level and message was logged less than an
+// interval ago.
+func (t *Throttle) Log(ctx context.Context, logger *slog.Logger, level slog.Level, msg string, args ...any) {
+    if t.interval == 0 {
+        logger.Log(ctx, level, msg, args...)
+        return
+    }
+    key := level.String() + msg
+    now := t.now()
+
+    t.mu.Lock()
+    entry, ok := t.entries[key]
+    if ok && now.Sub(entry.windowStart) < t.interval {
+        entry.suppressed++
+        t.mu.Unlock()
+        return
+    }
+    suppressed := 0
+    if ok {
+        suppressed = entry.suppressed
+    }
+    t.entries[key] = &throttleEntry{windowStart: now}
+    t.mu.Unlock()
+
+    if suppressed > 0 {
+        args = append(args, SuppressedKey, suppressed)
+    }
+    logger.Log(ctx, level, msg, args...)
+}
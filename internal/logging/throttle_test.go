@@ -0,0 +1,47 @@
+package logging
+
+import (
+    "context"
+    "log/slog"
+    "testing"
+    "time"
+)
+
+func TestThrottle(t *testing.T) {
+    r := newRecorder()
+    logger := slog.New(r)
+    now := time.Unix(0, 0)
+    throttle := NewThrottle(time.Minute)
+    throttle.now = func() time.Time {
+        return now
+    }
+    ctx := context.Background()
+
+    for range 3 {
+        throttle.Log(ctx, logger, slog.LevelError, "Store unavailable")
+    }
+    // Another message, or another level, is throttled on its own
+    throttle.Log(ctx, logger, slog.LevelError, "Invalid key")
+    throttle.Log(ctx, logger, slog.LevelWarn, "Store unavailable")
+    if records := r.Records(); len(records) != 3 {
+        t.Fatalf("records %v, 3 expected", records)
+    }
+
+    now = now.Add(time.Minute)
+    throttle.Log(ctx, logger, slog.LevelError, "Store unavailable")
+    records := r.Records()
+    if len(records) != 4 || attr(records[3], SuppressedKey) != int64(2) {
+        t.Fatalf("records %v, the 2 suppressed records counted expected", records)
+    }
+}
+
+func TestThrottleDisabled(t *testing.T) {
+    r := newRecorder()
+    throttle := NewThrottle(0)
+    for range 3 {
+        throttle.Log(context.Background(), slog.New(r), slog.LevelError, "Store unavailable")
+    }
+    if records := r.Records(); len(records) != 3 {
+        t.Fatalf("records %v, all of them expected", records)
+    }
+}
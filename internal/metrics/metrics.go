@@ -0,0 +1,100 @@
+package metrics
+
+import (
+    "context"
+    "time"
+)
+
+// Tag is a dimension of a metric, e.g. the endpoint of a request.
+type Tag struct {
+    Key   string `json:"key"`
+    Value string `json:"value"`
+}
+
+// Sink receives the metrics of the subsystems, the backends implement it so the instrumented code doesn't depend on
+// any of them.
+type Sink interface {
+    // Count adds the value to a counter
+    Count(name string, value int64, tags ...Tag)
+    // Gauge sets the current value of a gauge
+    Gauge(name string, value float64, tags ...Tag)
+    // Timing records the duration of an operation
+    Timing(name string, duration time.Duration, tags ...Tag)
+}
+
+// ExemplarSink is implemented by the sinks able to attach exemplars to the metrics, linking a value to the trace of the
+// request that recorded it, e.g. to jump from a spike of rejections to example traces of the rejected requests.
+type ExemplarSink interface {
+    Sink
+    // CountContext adds the value to a counter like Count, with the span in ctx, if any, as exemplar
+    CountContext(ctx context.Context, name string, value int64, tags ...Tag)
+    // TimingContext records the duration of an operation like Timing, with the span in ctx, if any, as exemplar
+    TimingContext(ctx context.Context, name string, duration time.Duration, tags ...Tag)
+}
+
+// CountContext adds the value to a counter of the sink, with the span in ctx as exemplar if the sink implements
+// ExemplarSink.
+func CountContext(ctx context.Context, sink Sink, name string, value int64, tags ...Tag) {
+    if s, ok := sink.(ExemplarSink); ok {
+        s.CountContext(ctx, name, value, tags...)
+        return
+    }
+    sink.Count(name, value, tags...)
+}
+
+// TimingContext records the duration of an operation in the sink, with the span in ctx as exemplar if the sink
+// implements ExemplarSink.
+func TimingContext(ctx context.Context, sink Sink, name string, duration time.Duration, tags ...Tag) {
+    if s, ok := sink.(ExemplarSink); ok {
+        s.TimingContext(ctx, name, duration, tags...)
+        return
+    }
+    sink.Timing(name, duration, tags...)
+}
+
+type discard struct{}
+
+func (discard) Count(string, int64, ...Tag)          {}
+func (discard) Gauge(string, float64, ...Tag)        {}
+func (discard) Timing(string, time.Duration, ...Tag) {}
+
+// Discard drops every metric, it is the sink of the subsystems without metrics configured.
+var Discard Sink = discard{}
+
+type multi []Sink
+
+// NewMultiSink sends every metric to each of the sinks, e.g. to report to two backends during a migration. The
+// exemplars are passed on to the sinks implementing ExemplarSink.
+func NewMultiSink(sinks ...Sink) Sink {
+    return multi(sinks)
+}
+
+func (m multi) Count(name string, value int64, tags ...Tag) {
+    for _, s := range m {
+        s.Count(name, value, tags...)
+    }
+}
+
+func (m multi) Gauge(name string, value float64, tags ...Tag) {
+    for _, s := range m {
+        s.Gauge(name, value, tags...)
+    }
+}
+
+func (m multi) Timing(name string, duration time.Duration, tags ...Tag) {
+    for _, s := range m {
+        s.Timing(name, duration, tags...)
+    }
+}
+
+func (m multi) CountContext(ctx context.Context, name string, value int64, tags ...Tag) {
+    for _, s := range m {
+        CountContext(ctx, s, name, value, tags...)
+    }
+}
+
+func (m multi) TimingContext(ctx context.Context, name string, duration time.Duration, tags ...Tag) {
+    for _, s := range m {
+        TimingContext(ctx, s, name, duration, tags...)
+    }
+}
@@ -0,0 +1,98 @@
+package otel_metrics
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/metric"
+    "go.opentelemetry.io/otel/metric/noop"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+type otelSink struct {
+    meter metric.Meter
+
+    mu         sync.Mutex
+    counters   map[string]metric.Int64Counter
+    gauges     map[string]metric.Float64Gauge
+    histograms map[string]metric.Float64Histogram
+}
+
+// NewSink adapts an OpenTelemetry meter, e.g. otel.Meter("myapp"), to metrics.Sink. It is in a package of its own so
+// only the applications exporting to OpenTelemetry depend on it.
+//
+// The counts are counters, the gauges gauges and the timings histograms in seconds. The sink implements
+// metrics.ExemplarSink: the SDK samples the span in the context of a value as its exemplar, which the Prometheus
+// exporter exposes in the OpenMetrics format, so a spike of rejections links to traces of rejected requests. The
+// values of an instrument the meter fails to create are dropped.
+func NewSink(meter metric.Meter) metrics.ExemplarSink {
+    return &otelSink{
+        meter:      meter,
+        counters:   make(map[string]metric.Int64Counter),
+        gauges:     make(map[string]metric.Float64Gauge),
+        histograms: make(map[string]metric.Float64Histogram),
+    }
+}
+
+func (s *otelSink) Count(name string, value int64, tags ...metrics.Tag) {
+    s.CountContext(context.Background(), name, value, tags...)
+}
+
+func (s *otelSink) Gauge(name string, value float64, tags ...metrics.Tag) {
+    s.mu.Lock()
+    gauge, ok := s.gauges[name]
+    if !ok {
+        var err error
+        if gauge, err = s.meter.Float64Gauge(name); err != nil {
+            slog.Error("Error creating gauge", "name", name, "error", err)
+            gauge = noop.Float64Gauge{}
+        }
+        s.gauges[name] = gauge
+    }
+    s.mu.Unlock()
+    gauge.Record(context.Background(), value, metric.WithAttributes(convert(tags)...))
+}
+
+func (s *otelSink) Timing(name string, duration time.Duration, tags ...metrics.Tag) {
+    s.TimingContext(context.Background(), name, duration, tags...)
+}
+
+func (s *otelSink) CountContext(ctx context.Context, name string, value int64, tags ...metrics.Tag) {
+    s.mu.Lock()
+    counter, ok := s.counters[name]
+    if !ok {
+        var err error
+        if counter, err = s.meter.Int64Counter(name); err != nil {
+            slog.Error("Error creating counter", "name", name, "error", err)
+            counter = noop.Int64Counter{}
+        }
+        s.counters[name] = counter
+    }
+    s.mu.Unlock()
+    counter.Add(ctx, value, metric.WithAttributes(convert(tags)...))
+}
+
+func (s *otelSink) TimingContext(ctx context.Context, name string, duration time.Duration, tags ...metrics.Tag) {
+    s.mu.Lock()
+    histogram, ok := s.histograms[name]
+    if !ok {
+        var err error
+        if histogram, err = s.meter.Float64Histogram(name, metric.WithUnit("s")); err != nil {
+            slog.Error("Error creating histogram", "name", name, "error", err)
+            histogram = noop.Float64Histogram{}
+        }
+        s.histograms[name] = histogram
+    }
+    s.mu.Unlock()
+    histogram.Record(ctx, duration.Seconds(), metric.WithAttributes(convert(tags)...))
+}
+
+func convert(tags []metrics.Tag) []attribute.KeyValue {
+    kvs := make([]attribute.KeyValue, len(tags))
+    for i, t := range tags {
+        kvs[i] = attribute.String(t.Key, t.Value)
+    }
+    return kvs
+}
@@ -0,0 +1,133 @@
+package otel_metrics
+
+import (
+    "context"
+    "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/metric"
+    "go.opentelemetry.io/otel/metric/noop"
+    "testing"
+    "time"
+)
+
+type ctxKey struct{}
+
+// measurement is a value recorded by an instrument of the recordingMeter.
+type measurement struct {
+    instrument, unit string
+    value            float64
+    attributes       attribute.Set
+    ctx              context.Context
+}
+
+// recordingMeter creates instruments keeping their measurements, or fails to create them when err is set.
+type recordingMeter struct {
+    noop.Meter
+    created      map[string]int
+    measurements []measurement
+    err          error
+}
+
+func (m *recordingMeter) create(name string) error {
+    m.created[name]++
+    return m.err
+}
+
+func (m *recordingMeter) Int64Counter(name string, _ ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+    if err := m.create(name); err != nil {
+        return nil, err
+    }
+    return counter{meter: m, name: name}, nil
+}
+
+func (m *recordingMeter) Float64Gauge(name string, _ ...metric.Float64GaugeOption) (metric.Float64Gauge, error) {
+    if err := m.create(name); err != nil {
+        return nil, err
+    }
+    return gauge{meter: m, name: name}, nil
+}
+
+func (m *recordingMeter) Float64Histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+    if err := m.create(name); err != nil {
+        return nil, err
+    }
+    return histogram{meter: m, name: name, unit: metric.NewFloat64HistogramConfig(opts...).Unit()}, nil
+}
+
+type counter struct {
+    noop.Int64Counter
+    meter *recordingMeter
+    name  string
+}
+
+func (c counter) Add(ctx context.Context, value int64, opts ...metric.AddOption) {
+    c.meter.measurements = append(c.meter.measurements, measurement{c.name, "", float64(value), metric.NewAddConfig(opts).Attributes(), ctx})
+}
+
+type gauge struct {
+    noop.Float64Gauge
+    meter *recordingMeter
+    name  string
+}
+
+func (g gauge) Record(ctx context.Context, value float64, opts ...metric.RecordOption) {
+    g.meter.measurements = append(g.meter.measurements, measurement{g.name, "", value, metric.NewRecordConfig(opts).Attributes(), ctx})
+}
+
+type histogram struct {
+    noop.Float64Histogram
+    meter      *recordingMeter
+    name, unit string
+}
+
+func (h histogram) Record(ctx context.Context, value float64, opts ...metric.RecordOption) {
+    h.meter.measurements = append(h.meter.measurements, measurement{h.name, h.unit, value, metric.NewRecordConfig(opts).Attributes(), ctx})
+}
+
+func TestSink(t *testing.T) {
+    meter := &recordingMeter{created: map[string]int{}}
+    sink := NewSink(meter)
+    // The context holds the span sampled as the exemplar
+    ctx := context.WithValue(context.Background(), ctxKey{}, "span")
+    tags := []metrics.Tag{{Key: "endpoint", Value: "/api"}}
+    sink.CountContext(ctx, "ratelimiter.decisions", 1, tags...)
+    sink.Count("ratelimiter.decisions", 2, tags...)
+    sink.Gauge("ratelimiter.keys", 42)
+    sink.TimingContext(ctx, "ratelimiter.latency", 1500*time.Millisecond, tags...)
+
+    // The instruments are created once
+    if meter.created["ratelimiter.decisions"] != 1 || len(meter.created) != 3 {
+        t.Fatalf("instruments created %v", meter.created)
+    }
+    want := []measurement{
+        {"ratelimiter.decisions", "", 1, attribute.NewSet(attribute.String("endpoint", "/api")), ctx},
+        {"ratelimiter.decisions", "", 2, attribute.NewSet(attribute.String("endpoint", "/api")), nil},
+        {"ratelimiter.keys", "", 42, attribute.NewSet(), nil},
+        {"ratelimiter.latency", "s", 1.5, attribute.NewSet(attribute.String("endpoint", "/api")), ctx},
+    }
+    if len(meter.measurements) != len(want) {
+        t.Fatalf("measurements %v, %v expected", meter.measurements, want)
+    }
+    for i, m := range meter.measurements {
+        w := want[i]
+        if m.instrument != w.instrument || m.unit != w.unit || m.value != w.value || !m.attributes.Equals(&w.attributes) ||
+            (w.ctx != nil && m.ctx.Value(ctxKey{}) != "span") {
+            t.Fatalf("measurement %d: %+v, %+v expected", i, m, w)
+        }
+    }
+}
+
+func TestSinkDropsValuesOfFailedInstruments(t *testing.T) {
+    meter := &recordingMeter{created: map[string]int{}, err: errors.New("invalid instrument name")}
+    sink := NewSink(meter)
+    for range 2 {
+        sink.Count("ratelimiter decisions", 1)
+        sink.Gauge("ratelimiter keys", 42)
+        sink.Timing("ratelimiter latency", time.Second)
+    }
+    // The failure is not retried on every value
+    if meter.created["ratelimiter decisions"] != 1 || len(meter.measurements) != 0 {
+        t.Fatalf("instruments created %v, measurements %v", meter.created, meter.measurements)
+    }
+}
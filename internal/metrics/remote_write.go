@@ -0,0 +1,230 @@
+package metrics
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/logging"
+    "github.com/klauspost/compress/snappy"
+    "google.golang.org/protobuf/encoding/protowire"
+    "io"
+    "log/slog"
+    "math"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+type RemoteWriteConfig struct {
+    // URL of the remote write endpoint, e.g. http://prometheus:9090/api/v1/write
+    URL string `json:"url"`
+    // Headers are added to the requests, e.g. Authorization or the X-Scope-OrgID of the tenant
+    Headers map[string]string `json:"headers,omitempty"`
+    // Prefix is prepended to the metric names, e.g. "myapp_"
+    Prefix string `json:"prefix,omitempty"`
+    // Tags are added as labels to every series, e.g. the job and the instance, so the series of the instances of a
+    // fleet don't overwrite each other
+    Tags []Tag `json:"tags,omitempty"`
+    // FlushInterval is the interval at which the metrics are pushed
+    //
+    // Defaults to 15 seconds if not specified
+    FlushInterval time.Duration `json:"flush_interval,omitempty"`
+    // Timeout of a push
+    //
+    // Defaults to 10 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// remoteWriteSeries is a series with its labels, the metric name in __name__, sorted by name.
+type remoteWriteSeries struct {
+    labels []Tag
+    value  float64
+}
+
+// RemoteWriteSink pushes the metrics to a Prometheus remote write endpoint, see NewRemoteWriteSink.
+type RemoteWriteSink struct {
+    config RemoteWriteConfig
+    http   *http.Client
+    logger *slog.Logger
+    push   sync.Mutex // Serializes the pushes, the samples of a series must arrive in order
+
+    mu     sync.Mutex
+    series map[string]*remoteWriteSeries
+}
+
+// NewRemoteWriteSink creates a Sink pushing the metrics to a Prometheus compatible remote write endpoint, such as
+// Prometheus with --web.enable-remote-write-receiver, Mimir, Thanos or VictoriaMetrics, for the instances the server
+// can't scrape.
+//
+// The series are those a scrape would collect: the counts are counters named with a _total suffix, the gauges keep
+// their last value and the timings are summaries without quantiles, the _seconds_sum and _seconds_count counters. The
+// counters are cumulative since the start of the process, so a failed push only delays the samples to the next one.
+// The dots of the names are replaced with underscores, e.g. rate_limiter_requests_total.
+//
+// The metrics are pushed every FlushInterval until ctx is done, Flush pushes them right away, e.g. a last time on
+// shutdown.
+func NewRemoteWriteSink(ctx context.Context, config RemoteWriteConfig) (*RemoteWriteSink, error) {
+    if config.URL == "" {
+        return nil, fmt.Errorf("remote write URL is required")
+    }
+    if config.FlushInterval == 0 {
+        config.FlushInterval = 15 * time.Second
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 10 * time.Second
+    }
+    s := &RemoteWriteSink{
+        config: config,
+        http:   &http.Client{Timeout: config.Timeout},
+        logger: slog.Default().With(logging.ComponentKey, "remote_write"),
+        series: make(map[string]*remoteWriteSeries),
+    }
+    go s.run(ctx)
+    return s, nil
+}
+
+func (s *RemoteWriteSink) Count(name string, value int64, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.get(name+"_total", tags).value += float64(value)
+}
+
+func (s *RemoteWriteSink) Gauge(name string, value float64, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.get(name, tags).value = value
+}
+
+func (s *RemoteWriteSink) Timing(name string, duration time.Duration, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.get(name+"_seconds_sum", tags).value += duration.Seconds()
+    s.get(name+"_seconds_count", tags).value++
+}
+
+// get returns the series of the metric, created on its first value. It must be called with mu held.
+func (s *RemoteWriteSink) get(name string, tags []Tag) *remoteWriteSeries {
+    labels := make([]Tag, 0, 1+len(s.config.Tags)+len(tags))
+    labels = append(labels, Tag{Key: "__name__", Value: metricName(s.config.Prefix + name)})
+    for _, t := range append(s.config.Tags[:len(s.config.Tags):len(s.config.Tags)], tags...) {
+        labels = append(labels, Tag{Key: labelName(t.Key), Value: t.Value})
+    }
+    sort.SliceStable(labels, func(i, j int) bool {
+        return labels[i].Key < labels[j].Key
+    })
+    var key strings.Builder
+    for _, l := range labels {
+        key.WriteString(l.Key)
+        key.WriteByte(0)
+        key.WriteString(l.Value)
+        key.WriteByte(0)
+    }
+    series, ok := s.series[key.String()]
+    if !ok {
+        series = &remoteWriteSeries{labels: labels}
+        s.series[key.String()] = series
+    }
+    return series
+}
+
+// metricName replaces the characters not allowed in a Prometheus metric name with underscores.
+func metricName(name string) string {
+    name = strings.Map(func(r rune) rune {
+        if r == ':' || r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+            return r
+        }
+        return '_'
+    }, name)
+    if name != "" && '0' <= name[0] && name[0] <= '9' {
+        return "_" + name
+    }
+    return name
+}
+
+// labelName is metricName without the colons, reserved to the recording rules in the metric names and not allowed
+// in the label names.
+func labelName(name string) string {
+    return strings.ReplaceAll(metricName(name), ":", "_")
+}
+
+func (s *RemoteWriteSink) run(ctx context.Context) {
+    ticker := time.NewTicker(s.config.FlushInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if err := s.Flush(ctx); err != nil && ctx.Err() == nil {
+                // The endpoint may be restarting, the counters are cumulative so the next push catches up
+                s.logger.Error("Error pushing metrics", "url", s.config.URL, "error", err)
+            }
+        }
+    }
+}
+
+// Flush pushes the current value of every series.
+func (s *RemoteWriteSink) Flush(ctx context.Context) error {
+    s.push.Lock()
+    defer s.push.Unlock()
+    timestamp := time.Now().UnixMilli()
+    s.mu.Lock()
+    var body []byte
+    for _, series := range s.series {
+        body = protowire.AppendTag(body, 1, protowire.BytesType)
+        body = protowire.AppendBytes(body, encodeTimeSeries(series, timestamp))
+    }
+    s.mu.Unlock()
+    if len(body) == 0 {
+        return nil
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(snappy.Encode(nil, body)))
+    if err != nil {
+        return err
+    }
+    for k, v := range s.config.Headers {
+        req.Header.Set(k, v)
+    }
+    req.Header.Set("Content-Type", "application/x-protobuf")
+    req.Header.Set("Content-Encoding", "snappy")
+    req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+    resp, err := s.http.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to push metrics: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 {
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+        return fmt.Errorf("failed to push metrics: unexpected status %s: %s", resp.Status, bytes.TrimSpace(message))
+    }
+    return nil
+}
+
+// encodeTimeSeries encodes the series with a single sample as a prometheus.TimeSeries message of the remote write
+// protocol:
+//
+//    message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//    message Label { string name = 1; string value = 2; }
+//    message Sample { double value = 1; int64 timestamp = 2; }
+func encodeTimeSeries(series *remoteWriteSeries, timestamp int64) []byte {
+    var b []byte
+    for _, l := range series.labels {
+        var label []byte
+        label = protowire.AppendTag(label, 1, protowire.BytesType)
+        label = protowire.AppendString(label, l.Key)
+        label = protowire.AppendTag(label, 2, protowire.BytesType)
+        label = protowire.AppendString(label, l.Value)
+        b = protowire.AppendTag(b, 1, protowire.BytesType)
+        b = protowire.AppendBytes(b, label)
+    }
+    var sample []byte
+    sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+    sample = protowire.AppendFixed64(sample, math.Float64bits(series.value))
+    sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+    sample = protowire.AppendVarint(sample, uint64(timestamp))
+    b = protowire.AppendTag(b, 2, protowire.BytesType)
+    return protowire.AppendBytes(b, sample)
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+    "context"
+    "github.com/klauspost/compress/snappy"
+    "google.golang.org/protobuf/encoding/protowire"
+    "io"
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+// decodeWriteRequest decodes the series of a remote write request into their labels, formatted as
+// name{key="value",...}, and their value.
+func decodeWriteRequest(t *testing.T, body []byte) map[string]float64 {
+    t.Helper()
+    fields := func(b []byte, field func(num protowire.Number, v []byte, x uint64)) {
+        for len(b) > 0 {
+            num, typ, n := protowire.ConsumeTag(b)
+            b = b[n:]
+            switch typ {
+            case protowire.BytesType:
+                v, n := protowire.ConsumeBytes(b)
+                field(num, v, 0)
+                b = b[n:]
+            case protowire.Fixed64Type:
+                x, n := protowire.ConsumeFixed64(b)
+                field(num, nil, x)
+                b = b[n:]
+            case protowire.VarintType:
+                x, n := protowire.ConsumeVarint(b)
+                field(num, nil, x)
+                b = b[n:]
+            default:
+                t.Fatalf("unexpected wire type %d", typ)
+            }
+        }
+    }
+    series := make(map[string]float64)
+    fields(body, func(_ protowire.Number, ts []byte, _ uint64) {
+        var name string
+        var labels []string
+        var value float64
+        fields(ts, func(num protowire.Number, v []byte, _ uint64) {
+            if num == 2 {
+                fields(v, func(num protowire.Number, _ []byte, x uint64) {
+                    if num == 1 {
+                        value = math.Float64frombits(x)
+                    }
+                })
+                return
+            }
+            var key, val string
+            fields(v, func(num protowire.Number, v []byte, _ uint64) {
+                if num == 1 {
+                    key = string(v)
+                } else {
+                    val = string(v)
+                }
+            })
+            if key == "__name__" {
+                name = val
+            } else {
+                labels = append(labels, key+`="`+val+`"`)
+            }
+        })
+        series[name+"{"+strings.Join(labels, ",")+"}"] = value
+    })
+    return series
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+    pushes := make(chan map[string]float64, 1)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+            t.Errorf("unexpected headers %v", r.Header)
+        }
+        if r.Header.Get("X-Scope-OrgID") != "fleet" {
+            t.Errorf("configured header missing")
+        }
+        compressed, _ := io.ReadAll(r.Body)
+        body, err := snappy.Decode(nil, compressed)
+        if err != nil {
+            t.Errorf("Decode: %v", err)
+        }
+        pushes <- decodeWriteRequest(t, body)
+    }))
+    defer server.Close()
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    sink, err := NewRemoteWriteSink(ctx, RemoteWriteConfig{
+        URL:           server.URL,
+        Headers:       map[string]string{"X-Scope-OrgID": "fleet"},
+        Tags:          []Tag{{Key: "instance", Value: "a"}},
+        FlushInterval: time.Hour,
+    })
+    if err != nil {
+        t.Fatalf("NewRemoteWriteSink: %v", err)
+    }
+
+    endpoint := Tag{Key: "endpoint", Value: "/ping"}
+    sink.Count("rate_limiter.requests", 2, endpoint)
+    sink.Gauge("queue.depth", 3)
+    sink.Timing("rate_limiter.store_latency", 250*time.Millisecond, endpoint)
+    sink.Timing("rate_limiter.store_latency", 250*time.Millisecond, endpoint)
+    if err = sink.Flush(ctx); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    want := map[string]float64{
+        `rate_limiter_requests_total{endpoint="/ping",instance="a"}`:              2,
+        `queue_depth{instance="a"}`:                                               3,
+        `rate_limiter_store_latency_seconds_sum{endpoint="/ping",instance="a"}`:   0.5,
+        `rate_limiter_store_latency_seconds_count{endpoint="/ping",instance="a"}`: 2,
+    }
+    if got := <-pushes; !equal(got, want) {
+        t.Fatalf("pushed %v, %v expected", got, want)
+    }
+
+    // The counters are cumulative across the pushes
+    sink.Count("rate_limiter.requests", 1, endpoint)
+    if err = sink.Flush(ctx); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    want[`rate_limiter_requests_total{endpoint="/ping",instance="a"}`] = 3
+    if got := <-pushes; !equal(got, want) {
+        t.Fatalf("pushed %v, %v expected", got, want)
+    }
+}
+
+func equal(a, b map[string]float64) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for k, v := range a {
+        if w, ok := b[k]; !ok || w != v {
+            return false
+        }
+    }
+    return true
+}
+
+// A push rejected by the endpoint is reported to the caller of Flush.
+func TestRemoteWriteSinkRejected(t *testing.T) {
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "out of order sample", http.StatusBadRequest)
+    }))
+    defer server.Close()
+    sink, err := NewRemoteWriteSink(context.Background(), RemoteWriteConfig{URL: server.URL, FlushInterval: time.Hour})
+    if err != nil {
+        t.Fatalf("NewRemoteWriteSink: %v", err)
+    }
+    sink.Count("requests", 1)
+    if err = sink.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "out of order sample") {
+        t.Fatalf("Flush: %v, rejection expected", err)
+    }
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/logging"
+    "log/slog"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+type StatsDConfig struct {
+    // Addr of the StatsD agent, e.g. 127.0.0.1:8125
+    Addr string `json:"addr"`
+    // Prefix is prepended to the metric names, e.g. "myapp."
+    Prefix string `json:"prefix,omitempty"`
+    // DogStatsD sends the tags in the DogStatsD format, plain StatsD has no tags so their values are appended to the
+    // metric names instead
+    DogStatsD bool `json:"dogstatsd,omitempty"`
+    // Tags are added to every metric, e.g. the host or the environment
+    Tags []Tag `json:"tags,omitempty"`
+    // FlushInterval is the interval at which the aggregated metrics are sent
+    //
+    // Defaults to 1 second if not specified
+    FlushInterval time.Duration `json:"flush_interval,omitempty"`
+    // MaxPacketSize of the UDP packets, the metrics of a flush are split across packets of at most this size
+    //
+    // Defaults to 1432 bytes if not specified, to fit in an ethernet frame
+    MaxPacketSize int `json:"max_packet_size,omitempty"`
+}
+
+// statsdMetric identifies an aggregated metric by its type, name and tags.
+type statsdMetric struct {
+    kind string // "c", "g" or "ms"
+    name string
+    tags string // In the DogStatsD format, empty for plain StatsD
+}
+
+type statsd struct {
+    config StatsDConfig
+    conn   net.Conn
+    logger *slog.Logger
+
+    mu      sync.Mutex
+    counts  map[statsdMetric]int64
+    gauges  map[statsdMetric]float64
+    timings map[statsdMetric][]float64 // Timings are not aggregated, the agent computes their percentiles
+}
+
+// NewStatsDSink creates a Sink sending the metrics to a StatsD or DogStatsD agent over UDP.
+//
+// The metrics are aggregated in the client between flushes to cut the number of packets: the counts are summed and
+// the gauges keep their last value. They are flushed every FlushInterval and a last time when ctx is done.
+func NewStatsDSink(ctx context.Context, config StatsDConfig) (Sink, error) {
+    if config.FlushInterval == 0 {
+        config.FlushInterval = time.Second
+    }
+    if config.MaxPacketSize == 0 {
+        config.MaxPacketSize = 1432
+    }
+    conn, err := net.Dial("udp", config.Addr)
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to StatsD agent %s: %w", config.Addr, err)
+    }
+    s := &statsd{
+        config:  config,
+        conn:    conn,
+        logger:  slog.Default().With(logging.ComponentKey, "statsd"),
+        counts:  make(map[statsdMetric]int64),
+        gauges:  make(map[statsdMetric]float64),
+        timings: make(map[statsdMetric][]float64),
+    }
+    go s.run(ctx)
+    return s, nil
+}
+
+func (s *statsd) Count(name string, value int64, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.counts[s.metric("c", name, tags)] += value
+}
+
+func (s *statsd) Gauge(name string, value float64, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.gauges[s.metric("g", name, tags)] = value
+}
+
+func (s *statsd) Timing(name string, duration time.Duration, tags ...Tag) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    m := s.metric("ms", name, tags)
+    s.timings[m] = append(s.timings[m], float64(duration)/float64(time.Millisecond))
+}
+
+// metric formats the name with the prefix and the tags.
+func (s *statsd) metric(kind, name string, tags []Tag) statsdMetric {
+    var b strings.Builder
+    b.WriteString(s.config.Prefix)
+    b.WriteString(sanitize(name))
+    tags = append(s.config.Tags[:len(s.config.Tags):len(s.config.Tags)], tags...)
+    if !s.config.DogStatsD {
+        for _, t := range tags {
+            b.WriteString(".")
+            b.WriteString(sanitize(t.Value))
+        }
+        return statsdMetric{kind: kind, name: b.String()}
+    }
+    formatted := make([]string, len(tags))
+    for i, t := range tags {
+        formatted[i] = sanitize(t.Key) + ":" + sanitize(t.Value)
+    }
+    return statsdMetric{kind: kind, name: b.String(), tags: strings.Join(formatted, ",")}
+}
+
+// sanitize replaces the characters of the StatsD protocol, a value such as a path can't break the line.
+func sanitize(s string) string {
+    return strings.Map(func(r rune) rune {
+        switch r {
+        case ':', '|', ',', '#', '@', '\n', ' ':
+            return '_'
+        }
+        return r
+    }, s)
+}
+
+func (s *statsd) run(ctx context.Context) {
+    ticker := time.NewTicker(s.config.FlushInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            s.flush()
+            _ = s.conn.Close()
+            return
+        case <-ticker.C:
+            s.flush()
+        }
+    }
+}
+
+// flush sends the metrics aggregated since the previous flush.
+func (s *statsd) flush() {
+    s.mu.Lock()
+    var lines []string
+    for m, v := range s.counts {
+        lines = append(lines, line(m, strconv.FormatInt(v, 10)))
+    }
+    for m, v := range s.gauges {
+        lines = append(lines, line(m, strconv.FormatFloat(v, 'f', -1, 64)))
+    }
+    for m, values := range s.timings {
+        for _, v := range values {
+            lines = append(lines, line(m, strconv.FormatFloat(v, 'f', -1, 64)))
+        }
+    }
+    clear(s.counts)
+    clear(s.gauges)
+    clear(s.timings)
+    s.mu.Unlock()
+
+    var packet []byte
+    for _, l := range lines {
+        if len(packet) > 0 && len(packet)+1+len(l) > s.config.MaxPacketSize {
+            s.send(packet)
+            packet = packet[:0]
+        }
+        if len(packet) > 0 {
+            packet = append(packet, '\n')
+        }
+        packet = append(packet, l...)
+    }
+    if len(packet) > 0 {
+        s.send(packet)
+    }
+}
+
+// line formats a metric in the StatsD protocol, name:value|type, the DogStatsD tags going last.
+func line(m statsdMetric, value string) string {
+    if m.tags == "" {
+        return m.name + ":" + value + "|" + m.kind
+    }
+    return m.name + ":" + value + "|" + m.kind + "|#" + m.tags
+}
+
+func (s *statsd) send(packet []byte) {
+    if _, err := s.conn.Write(packet); err != nil {
+        // The agent may be restarting, the metrics of this flush are lost
+        s.logger.Error("Error sending metrics", "addr", s.config.Addr, "error", err)
+    }
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+    "context"
+    "net"
+    "slices"
+    "strings"
+    "testing"
+    "time"
+)
+
+// statsdAgent listens for the metrics on a local UDP port.
+func statsdAgent(t *testing.T) net.PacketConn {
+    t.Helper()
+    conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("ListenPacket: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = conn.Close()
+    })
+    return conn
+}
+
+// receive returns the packets the agent received until it stays silent for a while.
+func receive(t *testing.T, conn net.PacketConn) []string {
+    t.Helper()
+    var packets []string
+    buf := make([]byte, 65536)
+    for {
+        _ = conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+        n, _, err := conn.ReadFrom(buf)
+        if err != nil {
+            return packets
+        }
+        packets = append(packets, string(buf[:n]))
+    }
+}
+
+// lines returns the sorted lines of the packets.
+func lines(packets []string) []string {
+    var lines []string
+    for _, p := range packets {
+        lines = append(lines, strings.Split(p, "\n")...)
+    }
+    slices.Sort(lines)
+    return lines
+}
+
+func TestStatsDSink(t *testing.T) {
+    agent := statsdAgent(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    sink, err := NewStatsDSink(ctx, StatsDConfig{
+        Addr:          agent.LocalAddr().String(),
+        Prefix:        "myapp.",
+        DogStatsD:     true,
+        Tags:          []Tag{{Key: "env", Value: "prod"}},
+        FlushInterval: time.Hour,
+    })
+    if err != nil {
+        t.Fatalf("NewStatsDSink: %v", err)
+    }
+    // The counts are summed, the gauges keep their last value and every timing is sent
+    sink.Count("ratelimiter.decisions", 1, Tag{Key: "endpoint", Value: "/api"})
+    sink.Count("ratelimiter.decisions", 2, Tag{Key: "endpoint", Value: "/api"})
+    sink.Count("ratelimiter.decisions", 1, Tag{Key: "endpoint", Value: "/api|users"})
+    sink.Gauge("ratelimiter.keys", 40)
+    sink.Gauge("ratelimiter.keys", 42)
+    sink.Timing("ratelimiter.latency", 1500*time.Microsecond)
+    sink.Timing("ratelimiter.latency", 2*time.Millisecond)
+    // The metrics are flushed a last time when ctx is done
+    cancel()
+
+    want := []string{
+        "myapp.ratelimiter.decisions:1|c|#env:prod,endpoint:/api_users",
+        "myapp.ratelimiter.decisions:3|c|#env:prod,endpoint:/api",
+        "myapp.ratelimiter.keys:42|g|#env:prod",
+        "myapp.ratelimiter.latency:1.5|ms|#env:prod",
+        "myapp.ratelimiter.latency:2|ms|#env:prod",
+    }
+    if got := lines(receive(t, agent)); !slices.Equal(got, want) {
+        t.Fatalf("lines %q, %q expected", got, want)
+    }
+}
+
+func TestStatsDSinkPlain(t *testing.T) {
+    agent := statsdAgent(t)
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    sink, err := NewStatsDSink(ctx, StatsDConfig{Addr: agent.LocalAddr().String(), FlushInterval: 10 * time.Millisecond, MaxPacketSize: 64})
+    if err != nil {
+        t.Fatalf("NewStatsDSink: %v", err)
+    }
+    // Plain StatsD has no tags, their values are appended to the names
+    for _, endpoint := range []string{"orders", "users", "billing", "search"} {
+        sink.Count("ratelimiter.decisions", 1, Tag{Key: "endpoint", Value: endpoint})
+    }
+    packets := receive(t, agent)
+    want := []string{
+        "ratelimiter.decisions.billing:1|c",
+        "ratelimiter.decisions.orders:1|c",
+        "ratelimiter.decisions.search:1|c",
+        "ratelimiter.decisions.users:1|c",
+    }
+    if got := lines(packets); !slices.Equal(got, want) {
+        t.Fatalf("lines %q, %q expected", got, want)
+    }
+    // The lines are split across packets of at most MaxPacketSize
+    if len(packets) < 2 {
+        t.Fatalf("packets %q, the lines split expected", packets)
+    }
+    for _, p := range packets {
+        if len(p) > 64 {
+            t.Fatalf("packet of %d bytes, at most 64 expected", len(p))
+        }
+    }
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "hash/fnv"
+    "net/url"
+    "sort"
+    "strconv"
+    "sync"
+    "sync/atomic"
+)
+
+// AffinityMode selects how a client is pinned to one of the upstreams.
+type AffinityMode string
+
+const (
+    // AffinityNone spreads the requests over the upstreams in a round-robin fashion
+    AffinityNone AffinityMode = ""
+    // AffinityCookie pins a client to the upstream recorded in a cookie set on the first response
+    AffinityCookie AffinityMode = "cookie"
+    // AffinityHash pins a client to an upstream with consistent hashing of its identity
+    AffinityHash AffinityMode = "hash"
+)
+
+// virtualNodes is the number of points each upstream gets on the consistent hash ring.
+const virtualNodes = 100
+
+type AffinityConfig struct {
+    // Mode of the session affinity
+    Mode AffinityMode `json:"mode,omitempty"`
+    // CookieName is the name of the cookie storing the upstream in AffinityCookie mode
+    //
+    // Defaults to "proxy_affinity" if not specified
+    CookieName string `json:"cookie_name,omitempty"`
+    // CookieMaxAge is the lifetime of the affinity cookie in seconds, 0 makes it a session cookie
+    CookieMaxAge int `json:"cookie_max_age,omitempty"`
+    // Identity returns the value hashed in AffinityHash mode
+    //
+    // Defaults to the client IP if not specified
+    Identity func(c *app.RequestContext) string `json:"-"`
+}
+
+type ringNode struct {
+    hash     uint32
+    upstream int // Index of the upstream in balancer.upstreams
+}
+
+// balancer picks an upstream from a pool and keeps clients on the same upstream according to the AffinityConfig.
+type balancer struct {
+    upstreams []*url.URL
+    ids       []string // Stable identifiers of the upstreams, stored in the affinity cookie
+    ring      []ringNode
+    config    AffinityConfig
+    next      atomic.Uint64 // Round-robin counter
+
+    mu       sync.RWMutex
+    draining map[int]struct{} // Upstreams that should not receive any more sessions
+}
+
+func newBalancer(upstreams []string, config AffinityConfig) (*balancer, error) {
+    switch config.Mode {
+    case AffinityNone, AffinityCookie, AffinityHash:
+    default:
+        return nil, fmt.Errorf("unknown affinity mode %q", config.Mode)
+    }
+    if config.CookieName == "" {
+        config.CookieName = "proxy_affinity"
+    }
+    if config.Identity == nil {
+        config.Identity = func(c *app.RequestContext) string {
+            return c.ClientIP()
+        }
+    }
+    b := &balancer{
+        config:   config,
+        draining: make(map[int]struct{}),
+    }
+    for i, upstream := range upstreams {
+        u, err := parseUpstream(upstream)
+        if err != nil {
+            return nil, err
+        }
+        b.upstreams = append(b.upstreams, u)
+        b.ids = append(b.ids, strconv.FormatUint(uint64(hash(u.Host)), 16))
+        for v := 0; v < virtualNodes; v++ {
+            b.ring = append(b.ring, ringNode{hash: hash(u.Host + "#" + strconv.Itoa(v)), upstream: i})
+        }
+    }
+    sort.Slice(b.ring, func(i, j int) bool {
+        return b.ring[i].hash < b.ring[j].hash
+    })
+    return b, nil
+}
+
+func hash(s string) uint32 {
+    h := fnv.New32a()
+    h.Write([]byte(s))
+    return h.Sum32()
+}
+
+// pick returns the upstream for the request and, in AffinityCookie mode, the index of the upstream the client has been
+// (re)assigned to or -1 if the client keeps its upstream.
+func (b *balancer) pick(c *app.RequestContext) (*url.URL, int) {
+    b.mu.RLock()
+    defer b.mu.RUnlock()
+
+    switch b.config.Mode {
+    case AffinityHash:
+        return b.upstreams[b.lookup(hash(b.config.Identity(c)))], -1
+    case AffinityCookie:
+        if i, ok := b.fromCookie(c.Cookie(b.config.CookieName)); ok {
+            return b.upstreams[i], -1
+        }
+        // First request of the session or its upstream is draining, assign a new upstream
+        i := b.roundRobin()
+        return b.upstreams[i], i
+    default:
+        return b.upstreams[b.roundRobin()], -1
+    }
+}
+
+// setCookie records the assigned upstream in the affinity cookie of the response.
+func (b *balancer) setCookie(c *app.RequestContext, upstream int) {
+    cookie := protocol.AcquireCookie()
+    defer protocol.ReleaseCookie(cookie)
+    cookie.SetKey(b.config.CookieName)
+    cookie.SetValue(b.ids[upstream])
+    cookie.SetPath("/")
+    cookie.SetMaxAge(b.config.CookieMaxAge)
+    cookie.SetHTTPOnly(true)
+    c.Response.Header.SetCookie(cookie)
+}
+
+// fromCookie finds the upstream recorded in the affinity cookie if it is still serving new requests.
+func (b *balancer) fromCookie(value []byte) (int, bool) {
+    for i, id := range b.ids {
+        if id != string(value) {
+            continue
+        }
+        if _, draining := b.draining[i]; draining {
+            return 0, false
+        }
+        return i, true
+    }
+    return 0, false
+}
+
+// lookup walks the consistent hash ring clockwise from h to the first upstream that is not draining.
+//
+// Only the clients of a drained upstream are re-assigned, every other client keeps its upstream.
+func (b *balancer) lookup(h uint32) int {
+    start := sort.Search(len(b.ring), func(i int) bool {
+        return b.ring[i].hash >= h
+    })
+    for n := 0; n < len(b.ring); n++ {
+        node := b.ring[(start+n)%len(b.ring)]
+        if _, draining := b.draining[node.upstream]; !draining {
+            return node.upstream
+        }
+    }
+    // Every upstream is draining, keep serving from the hashed one rather than failing the request
+    return b.ring[start%len(b.ring)].upstream
+}
+
+func (b *balancer) roundRobin() int {
+    for n := 0; n < len(b.upstreams); n++ {
+        i := int(b.next.Add(1) % uint64(len(b.upstreams)))
+        if _, draining := b.draining[i]; !draining {
+            return i
+        }
+    }
+    return int(b.next.Load() % uint64(len(b.upstreams)))
+}
+
+// setDraining marks the upstream as draining so its clients are gracefully moved to the other upstreams.
+func (b *balancer) setDraining(upstream string, draining bool) error {
+    u, err := parseUpstream(upstream)
+    if err != nil {
+        return err
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    for i, candidate := range b.upstreams {
+        if candidate.Host != u.Host {
+            continue
+        }
+        if draining {
+            b.draining[i] = struct{}{}
+        } else {
+            delete(b.draining, i)
+        }
+        return nil
+    }
+    return fmt.Errorf("upstream %s is not part of the proxy", upstream)
+}
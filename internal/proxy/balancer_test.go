@@ -0,0 +1,127 @@
+package proxy
+
+import (
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "testing"
+)
+
+var pool = []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080"}
+
+// identified is a request of the client, identified by its X-Client header.
+func identified(client string) *app.RequestContext {
+    c := app.NewContext(0)
+    c.Request.Header.Set("X-Client", client)
+    return c
+}
+
+func identity(c *app.RequestContext) string {
+    return string(c.GetHeader("X-Client"))
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+    b, err := newBalancer(pool, AffinityConfig{})
+    if err != nil {
+        t.Fatalf("newBalancer: %v", err)
+    }
+    picked := map[string]int{}
+    for range 6 {
+        u, assigned := b.pick(app.NewContext(0))
+        if assigned != -1 {
+            t.Fatalf("assigned %d without affinity", assigned)
+        }
+        picked[u.Host]++
+    }
+    if len(picked) != 3 || picked["10.0.0.1:8080"] != 2 {
+        t.Fatalf("picked %v, each upstream twice expected", picked)
+    }
+
+    // A draining upstream gets no more requests
+    if err := b.setDraining("http://10.0.0.2:8080", true); err != nil {
+        t.Fatalf("setDraining: %v", err)
+    }
+    for range 6 {
+        if u, _ := b.pick(app.NewContext(0)); u.Host == "10.0.0.2:8080" {
+            t.Fatalf("draining upstream picked")
+        }
+    }
+    if err := b.setDraining("http://10.0.0.4:8080", true); err == nil {
+        t.Fatalf("setDraining of an upstream out of the pool accepted")
+    }
+}
+
+func TestBalancerHashAffinity(t *testing.T) {
+    b, err := newBalancer(pool, AffinityConfig{Mode: AffinityHash, Identity: identity})
+    if err != nil {
+        t.Fatalf("newBalancer: %v", err)
+    }
+    before := map[string]string{}
+    for i := range 100 {
+        client := fmt.Sprintf("client-%d", i)
+        u, _ := b.pick(identified(client))
+        if again, _ := b.pick(identified(client)); again != u {
+            t.Fatalf("%s moved from %s to %s", client, u.Host, again.Host)
+        }
+        before[client] = u.Host
+    }
+
+    // Only the clients of the draining upstream move
+    if err := b.setDraining("http://10.0.0.1:8080", true); err != nil {
+        t.Fatalf("setDraining: %v", err)
+    }
+    moved := 0
+    for client, host := range before {
+        u, _ := b.pick(identified(client))
+        switch {
+        case u.Host == "10.0.0.1:8080":
+            t.Fatalf("%s kept on the draining upstream", client)
+        case host != "10.0.0.1:8080" && u.Host != host:
+            t.Fatalf("%s moved from %s to %s", client, host, u.Host)
+        case u.Host != host:
+            moved++
+        }
+    }
+    if moved == 0 {
+        t.Fatalf("no client of the draining upstream moved")
+    }
+}
+
+func TestBalancerCookieAffinity(t *testing.T) {
+    b, err := newBalancer(pool, AffinityConfig{Mode: AffinityCookie, CookieMaxAge: 3600})
+    if err != nil {
+        t.Fatalf("newBalancer: %v", err)
+    }
+    // The first request is assigned an upstream, recorded in the cookie
+    c := app.NewContext(0)
+    u, assigned := b.pick(c)
+    if assigned < 0 {
+        t.Fatalf("first request not assigned")
+    }
+    b.setCookie(c, assigned)
+    cookie := protocol.AcquireCookie()
+    defer protocol.ReleaseCookie(cookie)
+    cookie.SetKey("proxy_affinity")
+    if !c.Response.Header.Cookie(cookie) || cookie.MaxAge() != 3600 || !cookie.HTTPOnly() {
+        t.Fatalf("cookie %s", cookie)
+    }
+
+    // The next requests of the client keep its upstream
+    for range 5 {
+        next := app.NewContext(0)
+        next.Request.Header.SetCookie("proxy_affinity", string(cookie.Value()))
+        if again, assigned := b.pick(next); again != u || assigned != -1 {
+            t.Fatalf("request moved to %s, assigned %d", again.Host, assigned)
+        }
+    }
+
+    // The client of a draining upstream is assigned another one
+    if err := b.setDraining(u.String(), true); err != nil {
+        t.Fatalf("setDraining: %v", err)
+    }
+    next := app.NewContext(0)
+    next.Request.Header.SetCookie("proxy_affinity", string(cookie.Value()))
+    if again, assigned := b.pick(next); again == u || assigned < 0 {
+        t.Fatalf("client of a draining upstream kept on %s", again.Host)
+    }
+}
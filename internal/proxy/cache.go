@@ -0,0 +1,362 @@
+package proxy
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cache"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// CacheStatusHeader tells the client whether the response was served from the cache.
+const CacheStatusHeader = "X-Cache"
+
+// cacheableStatus are the status codes that are cacheable by default (RFC 9110 section 15.1).
+var cacheableStatus = map[int]struct{}{
+    200: {}, 203: {}, 204: {}, 206: {}, 300: {}, 301: {}, 308: {}, 404: {}, 405: {}, 410: {}, 414: {}, 501: {},
+}
+
+type CacheConfig struct {
+    // Store is the cache backend, it can be shared with the response cache middleware, see cache.NewResponseCache
+    Store cache.Store `json:"-"`
+}
+
+// cachedResponse is the representation of a response in the cache Store.
+type cachedResponse struct {
+    Status   int         `json:"status"`
+    Header   [][2]string `json:"header"`
+    Body     []byte      `json:"body"`
+    StoredAt time.Time   `json:"stored_at"`
+    // InitialAge is the Age of the response when it was received from the upstream
+    InitialAge time.Duration `json:"initial_age"`
+    // Lifetime is the freshness lifetime of the response
+    Lifetime             time.Duration `json:"lifetime"`
+    StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+    StaleIfError         time.Duration `json:"stale_if_error,omitempty"`
+    // Vary holds the request headers named in the Vary response header and their values for this response
+    Vary map[string]string `json:"vary,omitempty"`
+}
+
+func (r *cachedResponse) age(now time.Time) time.Duration {
+    return r.InitialAge + now.Sub(r.StoredAt)
+}
+
+// proxyCache is a shared HTTP cache following RFC 9111.
+type proxyCache struct {
+    store        cache.Store
+    revalidating sync.Map // Keys being revalidated in the background
+}
+
+func newProxyCache(config CacheConfig) *proxyCache {
+    store := config.Store
+    if store == nil {
+        store = cache.NewMemoryStore(10000)
+    }
+    return &proxyCache{store: store}
+}
+
+// handle serves the request from the cache when possible, otherwise it forwards it and caches the upstream response.
+func (pc *proxyCache) handle(ctx context.Context, c *app.RequestContext, req *protocol.Request, send sendFunc) {
+    key := string(c.Request.Host()) + string(c.Request.RequestURI())
+    method := string(c.Request.Method())
+    if method != consts.MethodGet {
+        if method != consts.MethodHead && method != consts.MethodOptions && method != consts.MethodTrace {
+            // Unsafe methods invalidate the stored response of the target URI (RFC 9111 section 4.4)
+            if err := pc.store.Delete(ctx, key); err != nil {
+                slog.Error("Error invalidating cached response", "key", key, "error", err)
+            }
+        }
+        forward(ctx, c, req, send)
+        return
+    }
+
+    requestDirectives := parseCacheControl(c.Request.Header.Peek("Cache-Control"))
+    if _, noStore := requestDirectives["no-store"]; noStore {
+        forward(ctx, c, req, send)
+        return
+    }
+
+    now := time.Now()
+    entry := pc.lookup(ctx, key, req)
+    servertiming.Since(c, servertiming.StageCache, now)
+    _, noCache := requestDirectives["no-cache"]
+    if maxAge, ok := requestDirectives["max-age"]; ok && maxAge == "0" {
+        noCache = true
+    }
+    if entry != nil && !noCache {
+        age := entry.age(now)
+        if age < entry.Lifetime {
+            writeCached(c, entry, now, "HIT")
+            return
+        }
+        if age < entry.Lifetime+entry.StaleWhileRevalidate {
+            writeCached(c, entry, now, "STALE")
+            pc.revalidate(key, req, entry, send)
+            return
+        }
+    }
+
+    resp := protocol.AcquireResponse()
+    defer protocol.ReleaseResponse(resp)
+    // A stored response is revalidated rather than fetched again, unless the client validates its own copy
+    validating := entry != nil && !conditional(req) && setValidators(req, entry)
+    start := time.Now()
+    err := send(ctx, req, resp)
+    servertiming.Since(c, servertiming.StageUpstream, start)
+    if (err != nil || resp.StatusCode() >= consts.StatusInternalServerError) &&
+        entry != nil && entry.age(now) < entry.Lifetime+entry.StaleIfError {
+        writeCached(c, entry, now, "STALE")
+        return
+    }
+    if err != nil {
+        writeBadGateway(c, req, err)
+        return
+    }
+    if validating && resp.StatusCode() == consts.StatusNotModified {
+        refreshed := protocol.AcquireResponse()
+        defer protocol.ReleaseResponse(refreshed)
+        refresh(entry, resp, refreshed)
+        pc.save(ctx, key, req, refreshed, now)
+        refreshed.CopyTo(&c.Response)
+        c.Response.Header.Set(CacheStatusHeader, "REVALIDATED")
+        return
+    }
+    pc.save(ctx, key, req, resp, now)
+    resp.CopyTo(&c.Response)
+    c.Response.Header.Set(CacheStatusHeader, "MISS")
+}
+
+// conditional tells if the request has conditions of its own, the 304 answering them is for the client.
+func conditional(req *protocol.Request) bool {
+    return len(req.Header.Peek("If-None-Match")) > 0 || len(req.Header.Peek("If-Modified-Since")) > 0
+}
+
+// setValidators makes the request conditional on the ETag and the Last-Modified of the stored response, so the
+// upstream answers 304 without the body when it didn't change (RFC 9111 section 4.3.1). It returns false when the
+// stored response has neither.
+func setValidators(req *protocol.Request, entry *cachedResponse) bool {
+    validated := false
+    for _, h := range entry.Header {
+        switch {
+        case strings.EqualFold(h[0], "ETag"):
+            req.Header.Set("If-None-Match", h[1])
+            validated = true
+        case strings.EqualFold(h[0], "Last-Modified"):
+            req.Header.Set("If-Modified-Since", h[1])
+            validated = true
+        }
+    }
+    return validated
+}
+
+// refresh writes the stored response to resp, with its headers updated by the ones of the 304 that validated it
+// (RFC 9111 section 4.3.4).
+func refresh(entry *cachedResponse, notModified, resp *protocol.Response) {
+    resp.SetStatusCode(entry.Status)
+    for _, h := range entry.Header {
+        // The Age of the stored response is replaced by the one of the 304, if any
+        if h[0] != consts.HeaderContentLength && !strings.EqualFold(h[0], "Age") {
+            resp.Header.Add(h[0], h[1])
+        }
+    }
+    notModified.Header.VisitAll(func(k, _ []byte) {
+        resp.Header.Del(string(k))
+    })
+    notModified.Header.VisitAll(func(k, v []byte) {
+        if string(k) != consts.HeaderContentLength {
+            resp.Header.Add(string(k), string(v))
+        }
+    })
+    resp.SetBody(entry.Body)
+}
+
+// lookup returns the stored response for the key if it was selected by the same Vary header values.
+func (pc *proxyCache) lookup(ctx context.Context, key string, req *protocol.Request) *cachedResponse {
+    value, err := pc.store.Get(ctx, key)
+    if err != nil {
+        if !errors.Is(err, cache.ErrKeyNotFound) {
+            slog.Error("Error retrieving cached response", "key", key, "error", err)
+        }
+        return nil
+    }
+    var entry cachedResponse
+    if err = json.Unmarshal(value, &entry); err != nil {
+        slog.Error("Error decoding cached response", "key", key, "error", err)
+        return nil
+    }
+    for name, value := range entry.Vary {
+        if string(req.Header.Peek(name)) != value {
+            return nil
+        }
+    }
+    return &entry
+}
+
+// save stores the upstream response if it is cacheable by a shared cache.
+func (pc *proxyCache) save(ctx context.Context, key string, req *protocol.Request, resp *protocol.Response, now time.Time) {
+    if _, ok := cacheableStatus[resp.StatusCode()]; !ok {
+        return
+    }
+    directives := parseCacheControl(resp.Header.Peek("Cache-Control"))
+    for _, d := range []string{"no-store", "no-cache", "private"} {
+        if _, ok := directives[d]; ok {
+            return
+        }
+    }
+    // Responses to authenticated requests are only shared when the upstream explicitly allows it
+    if len(req.Header.Peek("Authorization")) > 0 {
+        _, public := directives["public"]
+        _, sMaxAge := directives["s-maxage"]
+        if !public && !sMaxAge {
+            return
+        }
+    }
+    // Responses setting cookies are specific to a client
+    if len(resp.Header.Peek("Set-Cookie")) > 0 {
+        return
+    }
+    lifetime := freshnessLifetime(directives, &resp.Header, now)
+    if lifetime <= 0 {
+        return
+    }
+
+    entry := cachedResponse{
+        Status:     resp.StatusCode(),
+        Body:       append([]byte(nil), resp.Body()...),
+        StoredAt:   now,
+        InitialAge: seconds(string(resp.Header.Peek("Age"))),
+        Lifetime:   lifetime,
+    }
+    // must-revalidate and proxy-revalidate forbid serving stale responses
+    _, mustRevalidate := directives["must-revalidate"]
+    _, proxyRevalidate := directives["proxy-revalidate"]
+    if !mustRevalidate && !proxyRevalidate {
+        entry.StaleWhileRevalidate = seconds(directives["stale-while-revalidate"])
+        entry.StaleIfError = seconds(directives["stale-if-error"])
+    }
+    for _, name := range strings.Split(string(resp.Header.Peek("Vary")), ",") {
+        name = strings.TrimSpace(name)
+        if name == "" {
+            continue
+        }
+        if name == "*" {
+            return
+        }
+        if entry.Vary == nil {
+            entry.Vary = make(map[string]string)
+        }
+        entry.Vary[name] = string(req.Header.Peek(name))
+    }
+    resp.Header.VisitAll(func(k, v []byte) {
+        entry.Header = append(entry.Header, [2]string{string(k), string(v)})
+    })
+
+    value, err := json.Marshal(entry)
+    if err != nil {
+        slog.Error("Error encoding cached response", "key", key, "error", err)
+        return
+    }
+    ttl := entry.Lifetime + max(entry.StaleWhileRevalidate, entry.StaleIfError)
+    if err = pc.store.Set(ctx, key, value, ttl); err != nil {
+        slog.Error("Error caching response", "key", key, "error", err)
+    }
+}
+
+// revalidate refreshes a stale response in the background, only one refresh per key runs at a time. The request is
+// conditional on the validators of the stored response, an unchanged response only refreshes its headers.
+func (pc *proxyCache) revalidate(key string, req *protocol.Request, entry *cachedResponse, send sendFunc) {
+    if _, running := pc.revalidating.LoadOrStore(key, struct{}{}); running {
+        return
+    }
+    // The request is released once the handler returns, keep a copy for the refresh
+    bgReq := protocol.AcquireRequest()
+    req.CopyTo(bgReq)
+    // The conditions of the client are for its own copy
+    bgReq.Header.Del("If-None-Match")
+    bgReq.Header.Del("If-Modified-Since")
+    validating := setValidators(bgReq, entry)
+    go func() {
+        defer pc.revalidating.Delete(key)
+        defer protocol.ReleaseRequest(bgReq)
+        resp := protocol.AcquireResponse()
+        defer protocol.ReleaseResponse(resp)
+        ctx := context.Background()
+        if err := send(ctx, bgReq, resp); err != nil {
+            slog.Error("Error revalidating cached response", "key", key, "error", err)
+            return
+        }
+        if validating && resp.StatusCode() == consts.StatusNotModified {
+            refreshed := protocol.AcquireResponse()
+            defer protocol.ReleaseResponse(refreshed)
+            refresh(entry, resp, refreshed)
+            pc.save(ctx, key, bgReq, refreshed, time.Now())
+            return
+        }
+        pc.save(ctx, key, bgReq, resp, time.Now())
+    }()
+}
+
+// writeCached writes a stored response to the client with its current Age.
+func writeCached(c *app.RequestContext, entry *cachedResponse, now time.Time, status string) {
+    c.Response.SetStatusCode(entry.Status)
+    for _, h := range entry.Header {
+        if h[0] == consts.HeaderContentLength {
+            continue
+        }
+        c.Response.Header.Add(h[0], h[1])
+    }
+    c.Response.Header.Set("Age", strconv.Itoa(int(entry.age(now).Seconds())))
+    c.Response.Header.Set(CacheStatusHeader, status)
+    c.Response.SetBody(entry.Body)
+}
+
+// freshnessLifetime computes how long a response stays fresh from s-maxage, max-age or Expires in that order.
+func freshnessLifetime(directives map[string]string, header *protocol.ResponseHeader, now time.Time) time.Duration {
+    if v, ok := directives["s-maxage"]; ok {
+        return seconds(v)
+    }
+    if v, ok := directives["max-age"]; ok {
+        return seconds(v)
+    }
+    expires, err := http.ParseTime(string(header.Peek("Expires")))
+    if err != nil {
+        // An invalid Expires, such as 0, means the response is already expired
+        return 0
+    }
+    date, err := http.ParseTime(string(header.Peek("Date")))
+    if err != nil {
+        date = now
+    }
+    return expires.Sub(date)
+}
+
+// parseCacheControl returns the Cache-Control directives, lowercased, mapped to their unquoted arguments.
+func parseCacheControl(value []byte) map[string]string {
+    directives := make(map[string]string)
+    for _, part := range strings.Split(string(value), ",") {
+        name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+        if name == "" {
+            continue
+        }
+        directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+    }
+    return directives
+}
+
+// seconds parses a delta-seconds value, invalid values are treated as 0.
+func seconds(v string) time.Duration {
+    n, err := strconv.Atoi(v)
+    if err != nil || n < 0 {
+        return 0
+    }
+    return time.Duration(n) * time.Second
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "testing"
+)
+
+// A stored response is revalidated with its ETag, the 304 of the upstream refreshes it without its body.
+func TestCacheRevalidatesWithValidators(t *testing.T) {
+    pc := newProxyCache(CacheConfig{})
+    var conditions []string
+    send := func(_ context.Context, req *protocol.Request, resp *protocol.Response) error {
+        condition := string(req.Header.Peek("If-None-Match"))
+        conditions = append(conditions, condition)
+        resp.Header.Set("Cache-Control", "max-age=60")
+        resp.Header.Set("ETag", `"v1"`)
+        if condition == `"v1"` {
+            resp.SetStatusCode(304)
+            return nil
+        }
+        resp.SetStatusCode(200)
+        resp.SetBodyString("document")
+        return nil
+    }
+    get := func(header ...string) *protocol.Response {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI("http://example.com/doc")
+        for i := 0; i < len(header); i += 2 {
+            c.Request.Header.Set(header[i], header[i+1])
+        }
+        req := protocol.AcquireRequest()
+        defer protocol.ReleaseRequest(req)
+        c.Request.CopyTo(req)
+        pc.handle(context.Background(), c, req, send)
+        return &c.Response
+    }
+
+    for _, test := range []struct {
+        header    []string
+        code      int
+        body      string
+        status    string
+        condition string // If-None-Match sent to the upstream
+    }{
+        {code: 200, body: "document", status: "MISS"},
+        {code: 200, body: "document", status: "HIT"},
+        // no-cache forces a revalidation, answered with the stored body
+        {header: []string{"Cache-Control", "no-cache"}, code: 200, body: "document", status: "REVALIDATED", condition: `"v1"`},
+        // The conditions of the client are forwarded as they are, the 304 is for its own copy
+        {header: []string{"Cache-Control", "no-cache", "If-None-Match", `"v0"`}, code: 200, body: "document", status: "MISS", condition: `"v0"`},
+        {header: []string{"Cache-Control", "no-cache", "If-None-Match", `"v1"`}, code: 304, status: "MISS", condition: `"v1"`},
+    } {
+        sent := len(conditions)
+        resp := get(test.header...)
+        if resp.StatusCode() != test.code || string(resp.Body()) != test.body || string(resp.Header.Peek(CacheStatusHeader)) != test.status {
+            t.Fatalf("%v: %d %q %s, %d %q %s expected", test.header, resp.StatusCode(), resp.Body(),
+                resp.Header.Peek(CacheStatusHeader), test.code, test.body, test.status)
+        }
+        if test.status == "HIT" {
+            if len(conditions) != sent {
+                t.Fatalf("%v: hit sent to the upstream", test.header)
+            }
+            continue
+        }
+        if condition := conditions[len(conditions)-1]; condition != test.condition {
+            t.Fatalf("%v: If-None-Match %q sent, %q expected", test.header, condition, test.condition)
+        }
+    }
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+    "fmt"
+    "log/slog"
+    "math/rand/v2"
+    "net/url"
+    "sync"
+    "time"
+)
+
+type CanaryConfig struct {
+    // Upstream is the base URL of the canary version
+    Upstream string `json:"upstream"`
+    // Weight is the percentage of requests routed to the canary, between 0 and 100
+    Weight float64 `json:"weight"`
+    // MaxErrorRate is the ratio of failed requests (transport errors and 5xx responses) above which the canary is rolled back
+    //
+    // Defaults to 0.05 if not specified
+    MaxErrorRate float64 `json:"max_error_rate,omitempty"`
+    // MaxAverageLatency is the average request duration above which the canary is rolled back
+    //
+    // Defaults to no latency threshold if not specified
+    MaxAverageLatency time.Duration `json:"max_average_latency,omitempty"`
+    // MinRequests is the number of requests in an evaluation interval before the thresholds are checked
+    //
+    // Defaults to 20 if not specified
+    MinRequests int `json:"min_requests,omitempty"`
+    // EvaluationInterval is the window over which the error rate and latency are computed
+    //
+    // Defaults to 30 seconds if not specified
+    EvaluationInterval time.Duration `json:"evaluation_interval,omitempty"`
+    // OnRollback is called once when the canary weight is reset to 0
+    OnRollback func(reason string) `json:"-"`
+}
+
+// redMetrics holds the rate, errors and duration of the requests sent to an upstream in one evaluation interval.
+type redMetrics struct {
+    requests int
+    errors   int
+    duration time.Duration
+}
+
+type canary struct {
+    upstream *url.URL
+    config   CanaryConfig
+
+    mu          sync.Mutex
+    weight      float64
+    windowStart time.Time
+    metrics     redMetrics
+}
+
+func newCanary(config CanaryConfig) (*canary, error) {
+    upstream, err := parseUpstream(config.Upstream)
+    if err != nil {
+        return nil, err
+    }
+    if config.Weight < 0 || config.Weight > 100 {
+        return nil, fmt.Errorf("canary weight for %s must be between 0 and 100", config.Upstream)
+    }
+    if config.MaxErrorRate == 0 {
+        config.MaxErrorRate = 0.05
+    }
+    if config.MinRequests == 0 {
+        config.MinRequests = 20
+    }
+    if config.EvaluationInterval == 0 {
+        config.EvaluationInterval = 30 * time.Second
+    }
+    return &canary{
+        upstream:    upstream,
+        config:      config,
+        weight:      config.Weight,
+        windowStart: time.Now(),
+    }, nil
+}
+
+// sample decides if a request is routed to the canary.
+func (c *canary) sample() bool {
+    c.mu.Lock()
+    weight := c.weight
+    c.mu.Unlock()
+    return weight > 0 && rand.Float64()*100 < weight
+}
+
+// record adds the outcome of a canary request and rolls the canary back if a threshold is breached.
+func (c *canary) record(now time.Time, duration time.Duration, failed bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if now.Sub(c.windowStart) >= c.config.EvaluationInterval {
+        c.windowStart = now
+        c.metrics = redMetrics{}
+    }
+    c.metrics.requests++
+    c.metrics.duration += duration
+    if failed {
+        c.metrics.errors++
+    }
+
+    if c.weight == 0 || c.metrics.requests < c.config.MinRequests {
+        return
+    }
+    var reason string
+    errorRate := float64(c.metrics.errors) / float64(c.metrics.requests)
+    averageLatency := c.metrics.duration / time.Duration(c.metrics.requests)
+    switch {
+    case errorRate > c.config.MaxErrorRate:
+        reason = fmt.Sprintf("error rate %.2f exceeded %.2f", errorRate, c.config.MaxErrorRate)
+    case c.config.MaxAverageLatency > 0 && averageLatency > c.config.MaxAverageLatency:
+        reason = fmt.Sprintf("average latency %s exceeded %s", averageLatency, c.config.MaxAverageLatency)
+    default:
+        return
+    }
+
+    // Stop routing to the canary until the proxy is reconfigured
+    c.weight = 0
+    slog.Warn("Rolling back canary", "upstream", c.upstream.Host, "reason", reason)
+    if c.config.OnRollback != nil {
+        go c.config.OnRollback(reason)
+    }
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+    "testing"
+    "time"
+)
+
+func TestCanaryRollback(t *testing.T) {
+    for _, test := range []struct {
+        name     string
+        config   CanaryConfig
+        latency  time.Duration
+        failures int
+        reason   string
+    }{
+        {"healthy", CanaryConfig{MinRequests: 10}, 10 * time.Millisecond, 0, ""},
+        {"errors below the rate", CanaryConfig{MinRequests: 10, MaxErrorRate: 0.2}, 10 * time.Millisecond, 2, ""},
+        {"errors", CanaryConfig{MinRequests: 10, MaxErrorRate: 0.2}, 10 * time.Millisecond, 3, "error rate 0.30 exceeded 0.20"},
+        {"latency", CanaryConfig{MinRequests: 10, MaxAverageLatency: 50 * time.Millisecond}, 60 * time.Millisecond, 0, "average latency 60ms exceeded 50ms"},
+    } {
+        rolledBack := make(chan string, 1)
+        test.config.Upstream = "http://localhost:8082"
+        test.config.Weight = 100
+        test.config.OnRollback = func(reason string) {
+            rolledBack <- reason
+        }
+        c, err := newCanary(test.config)
+        if err != nil {
+            t.Fatalf("%s: newCanary: %v", test.name, err)
+        }
+        now := time.Now()
+        for i := range 10 {
+            c.record(now, test.latency, i < test.failures)
+        }
+        if test.reason == "" {
+            if !c.sample() {
+                t.Fatalf("%s: canary rolled back", test.name)
+            }
+            continue
+        }
+        select {
+        case reason := <-rolledBack:
+            if reason != test.reason {
+                t.Fatalf("%s: rolled back for %q, %q expected", test.name, reason, test.reason)
+            }
+        case <-time.After(5 * time.Second):
+            t.Fatalf("%s: canary not rolled back", test.name)
+        }
+        // The canary gets no more requests
+        for range 100 {
+            if c.sample() {
+                t.Fatalf("%s: request routed to a rolled back canary", test.name)
+            }
+        }
+    }
+}
+
+func TestCanaryEvaluationInterval(t *testing.T) {
+    c, err := newCanary(CanaryConfig{Upstream: "http://localhost:8082", Weight: 50, MinRequests: 4, EvaluationInterval: time.Minute})
+    if err != nil {
+        t.Fatalf("newCanary: %v", err)
+    }
+    now := time.Now()
+    // Too few requests to judge the canary
+    for range 3 {
+        c.record(now, time.Millisecond, true)
+    }
+    // The failures of the previous interval are forgotten
+    now = now.Add(time.Minute)
+    for range 10 {
+        c.record(now, time.Millisecond, false)
+    }
+    if c.weight != 50 {
+        t.Fatalf("weight %v, the canary kept expected", c.weight)
+    }
+}
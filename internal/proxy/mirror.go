@@ -0,0 +1,108 @@
+package proxy
+
+import (
+    "context"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app/client"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "log/slog"
+    "math/rand/v2"
+    "net/url"
+    "sync"
+    "time"
+)
+
+type MirrorConfig struct {
+    // Upstream is the base URL of the shadow upstream
+    Upstream string `json:"upstream"`
+    // Percentage of requests copied to the shadow upstream, between 0 and 100
+    Percentage float64 `json:"percentage"`
+    // MaxBodySize is the largest request body in bytes that is buffered for mirroring, bigger requests are not mirrored
+    //
+    // Defaults to 64KiB if not specified
+    MaxBodySize int `json:"max_body_size,omitempty"`
+    // MaxRequestsPerSecond caps the requests sent to the shadow upstream so it can't be overwhelmed
+    //
+    // Defaults to no limit if not specified
+    MaxRequestsPerSecond int `json:"max_requests_per_second,omitempty"`
+    // Timeout for a mirrored request
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type mirror struct {
+    client   *client.Client
+    upstream *url.URL
+    config   MirrorConfig
+
+    mu          sync.Mutex
+    windowStart time.Time // Start of the current one second window
+    sent        int       // Requests mirrored in the current window
+}
+
+func newMirror(c *client.Client, config MirrorConfig) (*mirror, error) {
+    upstream, err := parseUpstream(config.Upstream)
+    if err != nil {
+        return nil, err
+    }
+    if config.Percentage < 0 || config.Percentage > 100 {
+        return nil, fmt.Errorf("mirror percentage for %s must be between 0 and 100", config.Upstream)
+    }
+    if config.MaxBodySize == 0 {
+        config.MaxBodySize = 64 << 10
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 5 * time.Second
+    }
+    return &mirror{
+        client:   c,
+        upstream: upstream,
+        config:   config,
+    }, nil
+}
+
+// mirror sends a copy of the request to the shadow upstream in the background if it is sampled.
+func (m *mirror) mirror(src *protocol.Request) {
+    if rand.Float64()*100 >= m.config.Percentage {
+        return
+    }
+    // Streamed bodies can only be read once, so they are never mirrored
+    if src.IsBodyStream() || len(src.Body()) > m.config.MaxBodySize {
+        return
+    }
+    if !m.allow(time.Now()) {
+        return
+    }
+
+    req := protocol.AcquireRequest()
+    src.CopyTo(req)
+    prepareRequest(req, m.upstream)
+    go func() {
+        defer protocol.ReleaseRequest(req)
+        resp := protocol.AcquireResponse()
+        defer protocol.ReleaseResponse(resp)
+        // The response of the shadow upstream is discarded
+        if err := m.client.DoTimeout(context.Background(), req, resp, m.config.Timeout); err != nil {
+            slog.Debug("Error mirroring request", "upstream", m.upstream.Host, "error", err)
+        }
+    }()
+}
+
+// allow checks if the shadow upstream can receive another request in the current one second window.
+func (m *mirror) allow(now time.Time) bool {
+    if m.config.MaxRequestsPerSecond == 0 {
+        return true
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if now.Sub(m.windowStart) >= time.Second {
+        m.windowStart = now.Truncate(time.Second)
+        m.sent = 0
+    }
+    if m.sent >= m.config.MaxRequestsPerSecond {
+        return false
+    }
+    m.sent++
+    return true
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+    "context"
+    "fmt"
+    requestsigning "github.com/aswinkm-tc/go-web-concepts/internal/request_signing"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/app/client"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "net/url"
+    "time"
+)
+
+// hopHeaders are removed before forwarding a request, they only apply to a single connection.
+var hopHeaders = []string{
+    "Connection",
+    "Proxy-Connection",
+    "Keep-Alive",
+    "Proxy-Authenticate",
+    "Proxy-Authorization",
+    "Te",
+    "Trailer",
+    "Transfer-Encoding",
+    "Upgrade",
+}
+
+// ReverseProxy interface defines the methods for a reverse proxy.
+type ReverseProxy interface {
+    // Handler forwards the request to the upstream and writes the upstream response back to the client
+    Handler(ctx context.Context, c *app.RequestContext)
+    // SetDraining stops assigning clients to the upstream, clients pinned to it are moved to the other upstreams
+    SetDraining(upstream string, draining bool) error
+}
+
+type ProxyConfig struct {
+    // Upstream is the base URL requests are forwarded to, e.g. http://localhost:8080
+    Upstream string `json:"upstream,omitempty"`
+    // Upstreams is a pool of base URLs the requests are balanced over, used instead of Upstream when set
+    Upstreams []string `json:"upstreams,omitempty"`
+    // Affinity pins clients to one of the Upstreams for stateful upstreams
+    Affinity AffinityConfig `json:"affinity,omitempty"`
+    // Mirrors receive a copy of a percentage of the proxied requests, their responses are discarded
+    Mirrors []MirrorConfig `json:"mirrors,omitempty"`
+    // Canary routes a weighted share of the requests to a new version of the upstream
+    Canary *CanaryConfig `json:"canary,omitempty"`
+    // Signer signs every request sent to the upstreams
+    Signer requestsigning.Signer `json:"-"`
+    // Cache enables the RFC 9111 caching mode when set
+    Cache *CacheConfig `json:"cache,omitempty"`
+}
+
+type reverseProxy struct {
+    client   *client.Client
+    balancer *balancer // Pool of upstreams the requests are balanced over
+    mirrors  []*mirror // Shadow upstreams receiving copies of the requests
+    canary   *canary   // Optional canary upstream, rolled back automatically when unhealthy
+    cache    *proxyCache
+}
+
+// NewReverseProxy creates a new ReverseProxy with the given configuration.
+func NewReverseProxy(config ProxyConfig) (ReverseProxy, error) {
+    upstreams := config.Upstreams
+    if len(upstreams) == 0 {
+        upstreams = []string{config.Upstream}
+    }
+    b, err := newBalancer(upstreams, config.Affinity)
+    if err != nil {
+        return nil, err
+    }
+    c, err := client.NewClient()
+    if err != nil {
+        return nil, fmt.Errorf("failed to create proxy client: %w", err)
+    }
+    if config.Signer != nil {
+        c.Use(requestsigning.Middleware(config.Signer))
+    }
+    p := &reverseProxy{
+        client:   c,
+        balancer: b,
+    }
+    for _, mc := range config.Mirrors {
+        m, err := newMirror(c, mc)
+        if err != nil {
+            return nil, err
+        }
+        p.mirrors = append(p.mirrors, m)
+    }
+    if config.Canary != nil {
+        if p.canary, err = newCanary(*config.Canary); err != nil {
+            return nil, err
+        }
+    }
+    if config.Cache != nil {
+        p.cache = newProxyCache(*config.Cache)
+    }
+    return p, nil
+}
+
+func parseUpstream(upstream string) (*url.URL, error) {
+    u, err := url.Parse(upstream)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse upstream %s: %w", upstream, err)
+    }
+    if u.Scheme == "" || u.Host == "" {
+        return nil, fmt.Errorf("upstream %s must include a scheme and a host", upstream)
+    }
+    return u, nil
+}
+
+// Handler forwards the request to the upstream and copies back the response.
+func (p *reverseProxy) Handler(ctx context.Context, c *app.RequestContext) {
+    for _, m := range p.mirrors {
+        m.mirror(&c.Request)
+    }
+
+    req := protocol.AcquireRequest()
+    defer protocol.ReleaseRequest(req)
+
+    var upstream *url.URL
+    assigned := -1
+    useCanary := p.canary != nil && p.canary.sample()
+    if useCanary {
+        upstream = p.canary.upstream
+    } else {
+        upstream, assigned = p.balancer.pick(c)
+    }
+
+    c.Request.CopyTo(req)
+    prepareRequest(req, upstream)
+    req.Header.Add("X-Forwarded-For", c.ClientIP())
+
+    send := func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+        start := time.Now()
+        err := p.client.Do(ctx, req, resp)
+        if useCanary {
+            p.canary.record(time.Now(), time.Since(start), err != nil || resp.StatusCode() >= consts.StatusInternalServerError)
+        }
+        for _, h := range hopHeaders {
+            resp.Header.Del(h)
+        }
+        return err
+    }
+    if p.cache != nil {
+        p.cache.handle(ctx, c, req, send)
+    } else {
+        forward(ctx, c, req, send)
+    }
+    if assigned >= 0 {
+        p.balancer.setCookie(c, assigned)
+    }
+}
+
+// sendFunc sends the prepared request to the upstream picked for it.
+type sendFunc func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error
+
+// forward sends the request to the upstream and copies the upstream response to the client.
+func forward(ctx context.Context, c *app.RequestContext, req *protocol.Request, send sendFunc) {
+    resp := protocol.AcquireResponse()
+    defer protocol.ReleaseResponse(resp)
+    start := time.Now()
+    err := send(ctx, req, resp)
+    servertiming.Since(c, servertiming.StageUpstream, start)
+    if err != nil {
+        writeBadGateway(c, req, err)
+        return
+    }
+    resp.CopyTo(&c.Response)
+}
+
+func writeBadGateway(c *app.RequestContext, req *protocol.Request, err error) {
+    slog.Error("Error forwarding request to upstream", "upstream", string(req.Host()), "error", err)
+    c.AbortWithStatusJSON(consts.StatusBadGateway, utils.H{"error": "Bad gateway"})
+}
+
+// SetDraining marks an upstream of the pool as draining or back in service.
+func (p *reverseProxy) SetDraining(upstream string, draining bool) error {
+    return p.balancer.setDraining(upstream, draining)
+}
+
+// prepareRequest points the request to the upstream and strips the hop-by-hop headers.
+func prepareRequest(req *protocol.Request, upstream *url.URL) {
+    req.URI().SetScheme(upstream.Scheme)
+    req.URI().SetHost(upstream.Host)
+    req.SetHost(upstream.Host)
+    req.SetIsTLS(upstream.Scheme == "https")
+    for _, h := range hopHeaders {
+        req.Header.Del(h)
+    }
+}
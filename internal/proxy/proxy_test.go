@@ -0,0 +1,168 @@
+package proxy
+
+import (
+    "context"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// upstream answers with its name and what it received, and counts its requests.
+type upstream struct {
+    *httptest.Server
+    mu       sync.Mutex
+    requests []*http.Request
+}
+
+func newUpstream(t *testing.T, name string) *upstream {
+    t.Helper()
+    u := &upstream{}
+    u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        u.mu.Lock()
+        u.requests = append(u.requests, r)
+        u.mu.Unlock()
+        w.Header().Set("Keep-Alive", "timeout=5")
+        w.Header().Set("X-Upstream", name)
+        _, _ = fmt.Fprintf(w, "%s %s %s", name, r.Method, r.URL.RequestURI())
+    }))
+    t.Cleanup(u.Close)
+    return u
+}
+
+func (u *upstream) count() int {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    return len(u.requests)
+}
+
+func (u *upstream) last() *http.Request {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    return u.requests[len(u.requests)-1]
+}
+
+// serve runs the handler of the proxy on a request, with the headers as key value pairs.
+func serve(p ReverseProxy, method, uri, body string, headers ...string) *app.RequestContext {
+    c := app.NewContext(0)
+    c.Request.SetMethod(method)
+    c.Request.SetRequestURI(uri)
+    c.Request.SetBodyString(body)
+    for i := 0; i+1 < len(headers); i += 2 {
+        c.Request.Header.Set(headers[i], headers[i+1])
+    }
+    p.Handler(context.Background(), c)
+    return c
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatalf("condition not met")
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
+
+func TestReverseProxy(t *testing.T) {
+    api := newUpstream(t, "api")
+    p, err := NewReverseProxy(ProxyConfig{Upstream: api.URL})
+    if err != nil {
+        t.Fatalf("NewReverseProxy: %v", err)
+    }
+    c := serve(p, "POST", "http://gateway.example.com/orders?page=2", `{"id":1042}`,
+        "Connection", "X-Debug", "Proxy-Authorization", "Basic czNjcmV0", "X-Request-Id", "r-1")
+    if c.Response.StatusCode() != 200 || string(c.Response.Body()) != "api POST /orders?page=2" {
+        t.Fatalf("response %d %s", c.Response.StatusCode(), c.Response.Body())
+    }
+    // The hop-by-hop headers are stripped both ways, the others are forwarded
+    req := api.last()
+    if req.Header.Get("Proxy-Authorization") != "" || req.Header.Get("X-Request-Id") != "r-1" || req.Header.Get("X-Forwarded-For") == "" {
+        t.Fatalf("upstream request headers %v", req.Header)
+    }
+    if len(c.Response.Header.Peek("Keep-Alive")) > 0 || string(c.Response.Header.Peek("X-Upstream")) != "api" {
+        t.Fatalf("response headers %s", c.Response.Header.Header())
+    }
+
+    // An upstream that can't be reached is a bad gateway
+    api.Close()
+    if c := serve(p, "GET", "http://gateway.example.com/orders", ""); c.Response.StatusCode() != 502 {
+        t.Fatalf("upstream down: %d, 502 expected", c.Response.StatusCode())
+    }
+}
+
+func TestReverseProxyMirrors(t *testing.T) {
+    api, shadow, sampled := newUpstream(t, "api"), newUpstream(t, "shadow"), newUpstream(t, "sampled")
+    p, err := NewReverseProxy(ProxyConfig{
+        Upstream: api.URL,
+        Mirrors: []MirrorConfig{
+            {Upstream: shadow.URL, Percentage: 100, MaxBodySize: 16},
+            {Upstream: sampled.URL, Percentage: 0},
+        },
+    })
+    if err != nil {
+        t.Fatalf("NewReverseProxy: %v", err)
+    }
+    // The bodies larger than MaxBodySize are not mirrored
+    serve(p, "POST", "http://gateway.example.com/orders", strings.Repeat("x", 17))
+    for range 5 {
+        // The response comes from the upstream only
+        if c := serve(p, "POST", "http://gateway.example.com/orders", `{"id":1042}`); string(c.Response.Body()) != "api POST /orders" {
+            t.Fatalf("response %s", c.Response.Body())
+        }
+    }
+    waitFor(t, func() bool {
+        return shadow.count() >= 5
+    })
+    time.Sleep(50 * time.Millisecond)
+    if shadow.count() != 5 || sampled.count() != 0 || api.count() != 6 {
+        t.Fatalf("%d mirrored, %d sampled and %d proxied requests, 5, 0 and 6 expected", shadow.count(), sampled.count(), api.count())
+    }
+    if req := shadow.last(); req.Method != "POST" || req.URL.Path != "/orders" {
+        t.Fatalf("mirrored request %s %s", req.Method, req.URL)
+    }
+}
+
+func TestMirrorAllow(t *testing.T) {
+    m, err := newMirror(nil, MirrorConfig{Upstream: "http://localhost:8082", Percentage: 100, MaxRequestsPerSecond: 2})
+    if err != nil {
+        t.Fatalf("newMirror: %v", err)
+    }
+    start := time.Unix(1700000000, 0)
+    for i, test := range []struct {
+        offset  time.Duration
+        allowed bool
+    }{
+        {0, true},
+        {100 * time.Millisecond, true},
+        {900 * time.Millisecond, false},
+        // A new one second window
+        {time.Second, true},
+        {1500 * time.Millisecond, true},
+        {1999 * time.Millisecond, false},
+    } {
+        if allowed := m.allow(start.Add(test.offset)); allowed != test.allowed {
+            t.Fatalf("request %d at %s: allowed %t, %t expected", i, test.offset, allowed, test.allowed)
+        }
+    }
+}
+
+func TestNewReverseProxyRejectsInvalidConfig(t *testing.T) {
+    for name, config := range map[string]ProxyConfig{
+        "relative upstream":  {Upstream: "/api"},
+        "mirror percentage":  {Upstream: "http://localhost:8081", Mirrors: []MirrorConfig{{Upstream: "http://localhost:8082", Percentage: 150}}},
+        "canary weight":      {Upstream: "http://localhost:8081", Canary: &CanaryConfig{Upstream: "http://localhost:8082", Weight: -1}},
+        "affinity mode":      {Upstreams: []string{"http://localhost:8081"}, Affinity: AffinityConfig{Mode: "sticky"}},
+        "upstream of a pool": {Upstreams: []string{"http://localhost:8081", "localhost:8082"}},
+    } {
+        if _, err := NewReverseProxy(config); err == nil {
+            t.Fatalf("%s: accepted", name)
+        }
+    }
+}
@@ -0,0 +1,249 @@
+package rate_limit_client
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+var ErrWaitTooLong = errors.New("rate limit budget not available in time")
+
+type ClientConfig struct {
+    // MaxWait is the longest a request waits for the budget, longer waits fail with ErrWaitTooLong instead
+    //
+    // Defaults to 1 minute if not specified
+    MaxWait time.Duration `json:"max_wait,omitempty"`
+    // MaxRetries of a request rejected with 429 despite the pacing, after waiting for its Retry-After
+    //
+    // Defaults to 1 if not specified, negative disables the retries
+    MaxRetries int `json:"max_retries,omitempty"`
+}
+
+// budget is what the server reported for an endpoint, updated from every response.
+type budget struct {
+    mu        sync.Mutex
+    known     bool      // Whether the server reported the remaining requests
+    remaining int       // Requests left until resetAt, decremented as they are sent
+    resetAt   time.Time // When the budget is replenished
+    nextAt    time.Time // Earliest time of the next request, to spread the remaining requests until resetAt
+}
+
+type transport struct {
+    base   http.RoundTripper
+    config ClientConfig
+
+    mu      sync.Mutex
+    budgets map[string]*budget // Keyed by host and path, the granularity of the server limits
+}
+
+// NewTransport wraps the base transport so the requests are paced by the RateLimit headers of the responses: the
+// remaining requests are spread until the reset, the requests wait once the budget is exhausted, and a 429 is retried
+// after its Retry-After.
+//
+// The IETF draft headers (RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset or the combined RateLimit), their
+// X-RateLimit-* variants and Retry-After are understood.
+func NewTransport(base http.RoundTripper, config ClientConfig) http.RoundTripper {
+    if base == nil {
+        base = http.DefaultTransport
+    }
+    if config.MaxWait == 0 {
+        config.MaxWait = time.Minute
+    }
+    if config.MaxRetries == 0 {
+        config.MaxRetries = 1
+    }
+    return &transport{
+        base:    base,
+        config:  config,
+        budgets: make(map[string]*budget),
+    }
+}
+
+// NewClient returns a copy of the client pacing its requests, see NewTransport.
+func NewClient(client *http.Client, config ClientConfig) *http.Client {
+    if client == nil {
+        client = http.DefaultClient
+    }
+    paced := *client
+    paced.Transport = NewTransport(client.Transport, config)
+    return &paced
+}
+
+func (t *transport) budgetFor(req *http.Request) *budget {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    key := req.URL.Host + req.URL.Path
+    b, ok := t.budgets[key]
+    if !ok {
+        b = &budget{}
+        t.budgets[key] = b
+    }
+    return b
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+    b := t.budgetFor(req)
+    for attempt := 0; ; attempt++ {
+        if err := t.wait(req.Context(), b.reserve(time.Now())); err != nil {
+            return nil, err
+        }
+        resp, err := t.base.RoundTrip(req)
+        if err != nil {
+            return nil, err
+        }
+        retryAfter := b.update(resp, time.Now())
+        if resp.StatusCode != http.StatusTooManyRequests || attempt >= t.config.MaxRetries || !rewindable(req) {
+            return resp, nil
+        }
+        // Wait for the Retry-After before replaying the request
+        _ = resp.Body.Close()
+        if err := t.wait(req.Context(), retryAfter); err != nil {
+            return nil, err
+        }
+        if req.GetBody != nil {
+            body, err := req.GetBody()
+            if err != nil {
+                return nil, fmt.Errorf("failed to rewind request body: %w", err)
+            }
+            req = req.Clone(req.Context())
+            req.Body = body
+        }
+    }
+}
+
+// rewindable reports whether the request can be sent again.
+func rewindable(req *http.Request) bool {
+    return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (t *transport) wait(ctx context.Context, d time.Duration) error {
+    if d <= 0 {
+        return nil
+    }
+    if d > t.config.MaxWait {
+        return fmt.Errorf("%w: would wait %s", ErrWaitTooLong, d)
+    }
+    timer := time.NewTimer(d)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+// reserve books the next slot of the budget and returns how long to wait for it.
+func (b *budget) reserve(now time.Time) time.Duration {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if !b.known || !now.Before(b.resetAt) {
+        // Nothing reported yet, or the budget was replenished since
+        b.known = false
+        return max(0, b.nextAt.Sub(now))
+    }
+    at := now
+    if b.nextAt.After(at) {
+        at = b.nextAt
+    }
+    if b.remaining <= 0 {
+        // Exhausted, wait for the reset and pace from there
+        at = b.resetAt
+        b.nextAt = at
+        return at.Sub(now)
+    }
+    // Spread the remaining requests evenly until the reset
+    b.nextAt = at.Add(b.resetAt.Sub(at) / time.Duration(b.remaining))
+    b.remaining--
+    return at.Sub(now)
+}
+
+// update records the budget reported by the response and returns its Retry-After, 0 if it has none.
+func (b *budget) update(resp *http.Response, now time.Time) time.Duration {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    remaining, reset, ok := parseRateLimit(resp.Header, now)
+    if ok {
+        b.known = true
+        b.remaining = remaining
+        b.resetAt = now.Add(reset)
+    }
+    retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+    if retryAfter > 0 {
+        // Nothing is allowed until then
+        b.known = true
+        b.remaining = 0
+        b.resetAt = now.Add(retryAfter)
+    }
+    if resp.StatusCode == http.StatusTooManyRequests && retryAfter == 0 && !ok {
+        // Rejected without any hint, back off for a second
+        retryAfter = time.Second
+        b.nextAt = now.Add(retryAfter)
+    }
+    return retryAfter
+}
+
+// parseRateLimit reads the remaining requests and the delay until the reset.
+func parseRateLimit(header http.Header, now time.Time) (int, time.Duration, bool) {
+    var remaining, reset string
+    if combined := header.Get("RateLimit"); combined != "" {
+        // RateLimit: limit=100, remaining=50, reset=30 or RateLimit: "default";r=50;t=30
+        for _, param := range strings.FieldsFunc(combined, func(r rune) bool { return r == ',' || r == ';' }) {
+            k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+            switch k {
+            case "remaining", "r":
+                remaining = v
+            case "reset", "t":
+                reset = v
+            }
+        }
+    }
+    for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+        if remaining == "" {
+            remaining = header.Get(prefix + "Remaining")
+        }
+        if reset == "" {
+            reset = header.Get(prefix + "Reset")
+        }
+    }
+    r, err := strconv.Atoi(firstValue(remaining))
+    if err != nil {
+        return 0, 0, false
+    }
+    s, err := strconv.ParseInt(firstValue(reset), 10, 64)
+    if err != nil {
+        return 0, 0, false
+    }
+    delay := time.Duration(s) * time.Second
+    if s > 1_000_000_000 {
+        // X-RateLimit-Reset is often a unix timestamp rather than a delay
+        delay = time.Unix(s, 0).Sub(now)
+    }
+    return r, max(0, delay), true
+}
+
+// firstValue returns the first item of a list, e.g. 100 in "100, 100;w=60".
+func firstValue(v string) string {
+    v, _, _ = strings.Cut(v, ",")
+    v, _, _ = strings.Cut(v, ";")
+    return strings.TrimSpace(v)
+}
+
+// parseRetryAfter reads a delay in seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+    if v == "" {
+        return 0
+    }
+    if s, err := strconv.Atoi(v); err == nil {
+        return max(0, time.Duration(s)*time.Second)
+    }
+    if at, err := http.ParseTime(v); err == nil {
+        return max(0, at.Sub(now))
+    }
+    return 0
+}
@@ -0,0 +1,156 @@
+package rate_limit_client
+
+import (
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+    now := time.Unix(1_700_000_000, 0)
+    for _, test := range []struct {
+        name      string
+        header    http.Header
+        remaining int
+        reset     time.Duration
+        ok        bool
+    }{
+        {"draft", http.Header{"Ratelimit-Remaining": {"5"}, "Ratelimit-Reset": {"30"}}, 5, 30 * time.Second, true},
+        {"combined", http.Header{"Ratelimit": {"limit=100, remaining=50, reset=20"}}, 50, 20 * time.Second, true},
+        {"structured", http.Header{"Ratelimit": {`"default";r=7;t=10`}}, 7, 10 * time.Second, true},
+        {"policy list", http.Header{"X-Ratelimit-Remaining": {"3, 100;w=60"}, "X-Ratelimit-Reset": {"12"}}, 3, 12 * time.Second, true},
+        // X-RateLimit-Reset as a unix timestamp
+        {"timestamp", http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Reset": {"1700000045"}}, 1, 45 * time.Second, true},
+        {"past timestamp", http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Reset": {"1600000000"}}, 1, 0, true},
+        {"no reset", http.Header{"Ratelimit-Remaining": {"5"}}, 0, 0, false},
+        {"none", http.Header{}, 0, 0, false},
+    } {
+        remaining, reset, ok := parseRateLimit(test.header, now)
+        if remaining != test.remaining || reset != test.reset || ok != test.ok {
+            t.Fatalf("%s: %d, %s, %t, %d, %s, %t expected", test.name, remaining, reset, ok, test.remaining, test.reset, test.ok)
+        }
+    }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+    now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    for v, d := range map[string]time.Duration{
+        "":                              0,
+        "3":                             3 * time.Second,
+        "-3":                            0,
+        "Mon, 01 Jan 2024 12:00:30 GMT": 30 * time.Second,
+        "Mon, 01 Jan 2024 11:00:00 GMT": 0,
+        "soon":                          0,
+    } {
+        if retryAfter := parseRetryAfter(v, now); retryAfter != d {
+            t.Fatalf("parseRetryAfter(%q): %s, %s expected", v, retryAfter, d)
+        }
+    }
+}
+
+func TestBudget(t *testing.T) {
+    now := time.Unix(1_700_000_000, 0)
+    b := &budget{}
+    // Nothing reported yet, the request is sent right away
+    if d := b.reserve(now); d != 0 {
+        t.Fatalf("reserve of an unknown budget: %s, 0 expected", d)
+    }
+    resp := &http.Response{StatusCode: 200, Header: http.Header{"Ratelimit-Remaining": {"4"}, "Ratelimit-Reset": {"8"}}}
+    if retryAfter := b.update(resp, now); retryAfter != 0 {
+        t.Fatalf("update: Retry-After %s, 0 expected", retryAfter)
+    }
+    // The 4 remaining requests are spread over the 8 seconds until the reset
+    for i, d := range []time.Duration{0, 2 * time.Second, 4 * time.Second, 6 * time.Second, 8 * time.Second} {
+        if wait := b.reserve(now); wait != d {
+            t.Fatalf("reserve %d: %s, %s expected", i, wait, d)
+        }
+    }
+    // Once replenished, the budget is unknown again
+    if d := b.reserve(now.Add(9 * time.Second)); d != 0 {
+        t.Fatalf("reserve after the reset: %s, 0 expected", d)
+    }
+
+    // A Retry-After holds every request until then
+    resp = &http.Response{StatusCode: 429, Header: http.Header{"Retry-After": {"5"}}}
+    if retryAfter := b.update(resp, now); retryAfter != 5*time.Second {
+        t.Fatalf("update: Retry-After %s, 5s expected", retryAfter)
+    }
+    if d := b.reserve(now); d != 5*time.Second {
+        t.Fatalf("reserve after a Retry-After: %s, 5s expected", d)
+    }
+
+    // A 429 without any hint backs off for a second
+    b = &budget{}
+    if retryAfter := b.update(&http.Response{StatusCode: 429, Header: http.Header{}}, now); retryAfter != time.Second {
+        t.Fatalf("update of a bare 429: %s, 1s expected", retryAfter)
+    }
+    if d := b.reserve(now); d != time.Second {
+        t.Fatalf("reserve after a bare 429: %s, 1s expected", d)
+    }
+}
+
+func TestTransportRetries(t *testing.T) {
+    var calls atomic.Int64
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        body, _ := io.ReadAll(r.Body)
+        if calls.Add(1) == 1 {
+            w.Header().Set("Retry-After", "1")
+            w.WriteHeader(http.StatusTooManyRequests)
+            return
+        }
+        _, _ = w.Write(body)
+    }))
+    defer server.Close()
+    client := NewClient(server.Client(), ClientConfig{})
+
+    // The body is sent again with the retry
+    start := time.Now()
+    resp, err := client.Post(server.URL+"/orders", "text/plain", strings.NewReader("order"))
+    if err != nil {
+        t.Fatalf("Post: %v", err)
+    }
+    defer resp.Body.Close()
+    body, _ := io.ReadAll(resp.Body)
+    if resp.StatusCode != 200 || string(body) != "order" || calls.Load() != 2 {
+        t.Fatalf("Post: %d %s after %d calls, 200 order after 2 expected", resp.StatusCode, body, calls.Load())
+    }
+    if elapsed := time.Since(start); elapsed < time.Second {
+        t.Fatalf("retried after %s, the Retry-After of 1s expected", elapsed)
+    }
+}
+
+func TestTransportWaitTooLong(t *testing.T) {
+    var calls atomic.Int64
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        calls.Add(1)
+        w.Header().Set("Retry-After", "120")
+        w.WriteHeader(http.StatusTooManyRequests)
+    }))
+    defer server.Close()
+    client := NewClient(server.Client(), ClientConfig{MaxWait: time.Second, MaxRetries: -1})
+
+    // Without retries the 429 is returned
+    resp, err := client.Get(server.URL + "/orders")
+    if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+        t.Fatalf("Get: %v, %v, 429 expected", resp, err)
+    }
+    _ = resp.Body.Close()
+    // The next request would wait for the Retry-After
+    if _, err := client.Get(server.URL + "/orders"); !errors.Is(err, ErrWaitTooLong) {
+        t.Fatalf("Get during the Retry-After: %v, ErrWaitTooLong expected", err)
+    }
+    // The budgets are per path
+    if resp, err := client.Get(server.URL + "/invoices"); err != nil {
+        t.Fatalf("Get of another path: %v", err)
+    } else {
+        _ = resp.Body.Close()
+    }
+    if calls.Load() != 2 {
+        t.Fatalf("%d calls, 2 expected", calls.Load())
+    }
+}
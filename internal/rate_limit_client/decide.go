@@ -0,0 +1,206 @@
+package rate_limit_client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "io"
+    "net"
+    "net/http"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+// ErrDecisionRejected is returned when the service rejects a call with a 4xx, e.g. a descriptor without a user_id. The
+// service is up, the call is wrong: the requests are allowed without the fallback and the next calls still go to the
+// service.
+var ErrDecisionRejected = errors.New("decision request rejected")
+
+type DecisionClientConfig struct {
+    // URL of the decision service, e.g. http://localhost:8080 for a ratelimitd sidecar
+    URL string `json:"url"`
+    // Timeout bounds each call, including its connection, the request is decided locally past it
+    //
+    // Defaults to 250 milliseconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+    // MaxConnections is the number of connections kept open to the service, the calls beyond wait for one
+    //
+    // Defaults to 64 if not specified
+    MaxConnections int `json:"max_connections,omitempty"`
+    // Cooldown is how long the requests are decided locally after a failed call, so an unreachable service doesn't
+    // cost every request its timeout
+    //
+    // Defaults to 1 second if not specified
+    Cooldown time.Duration `json:"cooldown,omitempty"`
+}
+
+type DecisionOption func(*DecisionClient)
+
+// WithFallback decides the requests with the limiter while the service is unavailable, e.g. a limiter with a memory
+// store limiting per instance, instead of letting them all through. Each descriptor is counted once, whatever its cost.
+func WithFallback(limiter ratelimiter.RateLimiter) DecisionOption {
+    return func(c *DecisionClient) {
+        c.fallback = limiter
+    }
+}
+
+// WithHTTPClient calls the service with the client instead of one pooling MaxConnections connections, e.g. to
+// authenticate the calls with mTLS.
+func WithHTTPClient(client *http.Client) DecisionOption {
+    return func(c *DecisionClient) {
+        c.client = client
+    }
+}
+
+// DecisionClient calls the decision protocol of a decision service, see ratelimiter.NewDecideHandler, so the
+// applications adopting the sidecar mode don't hand-roll the calls.
+//
+// The client fails open: when the service can't be reached, times out or fails with a 5xx, the requests are allowed, or
+// decided by the limiter of WithFallback, and the error is returned along with the decisions. A call rejected with a
+// 4xx is returned as ErrDecisionRejected.
+type DecisionClient struct {
+    url      string
+    timeout  time.Duration
+    cooldown time.Duration
+    client   *http.Client
+    fallback ratelimiter.RateLimiter // Nil to allow the requests while the service is unavailable
+    now      func() time.Time
+    // Unix nanoseconds until which the requests are decided locally, after a failed call
+    localUntil atomic.Int64
+}
+
+// NewDecisionClient creates a DecisionClient calling the service at the URL of the configuration.
+func NewDecisionClient(config DecisionClientConfig, opts ...DecisionOption) (*DecisionClient, error) {
+    if config.URL == "" {
+        return nil, fmt.Errorf("decision service URL is required")
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 250 * time.Millisecond
+    }
+    if config.MaxConnections == 0 {
+        config.MaxConnections = 64
+    }
+    if config.Cooldown == 0 {
+        config.Cooldown = time.Second
+    }
+    c := &DecisionClient{
+        url:      strings.TrimSuffix(config.URL, "/") + ratelimiter.DecidePath,
+        timeout:  config.Timeout,
+        cooldown: config.Cooldown,
+        client: &http.Client{Transport: &http.Transport{
+            Proxy:               http.ProxyFromEnvironment,
+            DialContext:         (&net.Dialer{Timeout: config.Timeout, KeepAlive: 30 * time.Second}).DialContext,
+            MaxIdleConns:        config.MaxConnections,
+            MaxIdleConnsPerHost: config.MaxConnections,
+            MaxConnsPerHost:     config.MaxConnections,
+            IdleConnTimeout:     90 * time.Second,
+        }},
+        now: time.Now,
+    }
+    for _, opt := range opts {
+        opt(c)
+    }
+    return c, nil
+}
+
+// Allow decides on a request of the user to the endpoint, see Decide.
+func (c *DecisionClient) Allow(ctx context.Context, endpoint, userId string) (ratelimiter.DescriptorDecision, error) {
+    resp, err := c.Decide(ctx, ratelimiter.Descriptor{Endpoint: endpoint, UserId: userId})
+    return resp.Decisions[0], err
+}
+
+// Decide decides on the descriptors in one call. The error is a failure to get the decisions of the service, they are
+// then made locally, or ErrDecisionRejected with the requests allowed.
+func (c *DecisionClient) Decide(ctx context.Context, descriptors ...ratelimiter.Descriptor) (ratelimiter.DecideResponse, error) {
+    if until := c.localUntil.Load(); until != 0 && c.now().UnixNano() < until {
+        return c.decideLocally(ctx, descriptors), fmt.Errorf("decision service unavailable, deciding locally")
+    }
+    resp, err := c.call(ctx, descriptors)
+    if errors.Is(err, ErrDecisionRejected) {
+        // Deciding locally would hide the mistake, and the service is still up
+        return allow(descriptors), err
+    }
+    if err != nil {
+        if ctx.Err() == nil {
+            // A call abandoned by the caller says nothing about the service
+            c.localUntil.Store(c.now().Add(c.cooldown).UnixNano())
+        }
+        return c.decideLocally(ctx, descriptors), err
+    }
+    c.localUntil.Store(0)
+    return resp, nil
+}
+
+func (c *DecisionClient) call(ctx context.Context, descriptors []ratelimiter.Descriptor) (ratelimiter.DecideResponse, error) {
+    body, err := json.Marshal(ratelimiter.DecideRequest{Descriptors: descriptors})
+    if err != nil {
+        return ratelimiter.DecideResponse{}, fmt.Errorf("failed to encode decision request: %w", err)
+    }
+    ctx, cancel := context.WithTimeout(ctx, c.timeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+    if err != nil {
+        return ratelimiter.DecideResponse{}, fmt.Errorf("failed to create decision request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.client.Do(req)
+    if err != nil {
+        return ratelimiter.DecideResponse{}, fmt.Errorf("failed to call decision service: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        // The rest is drained so the connection goes back to the pool
+        message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+        _, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+        if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+            return ratelimiter.DecideResponse{}, fmt.Errorf("%w: decision service answered %d: %s", ErrDecisionRejected, resp.StatusCode, bytes.TrimSpace(message))
+        }
+        return ratelimiter.DecideResponse{}, fmt.Errorf("decision service answered %d", resp.StatusCode)
+    }
+    var decided ratelimiter.DecideResponse
+    if err := json.NewDecoder(resp.Body).Decode(&decided); err != nil {
+        return ratelimiter.DecideResponse{}, fmt.Errorf("failed to decode decision response: %w", err)
+    }
+    if len(decided.Decisions) != len(descriptors) {
+        return ratelimiter.DecideResponse{}, fmt.Errorf("decision service answered %d decisions for %d descriptors", len(decided.Decisions), len(descriptors))
+    }
+    return decided, nil
+}
+
+// allow allows every descriptor.
+func allow(descriptors []ratelimiter.Descriptor) ratelimiter.DecideResponse {
+    resp := ratelimiter.DecideResponse{Allowed: true, Decisions: make([]ratelimiter.DescriptorDecision, len(descriptors))}
+    for i := range descriptors {
+        resp.Decisions[i] = ratelimiter.DescriptorDecision{Allowed: true}
+    }
+    return resp
+}
+
+// decideLocally decides with the fallback limiter, or allows every descriptor without one.
+func (c *DecisionClient) decideLocally(ctx context.Context, descriptors []ratelimiter.Descriptor) ratelimiter.DecideResponse {
+    resp := allow(descriptors)
+    if c.fallback == nil {
+        return resp
+    }
+    for i, desc := range descriptors {
+        d, err := c.fallback.AllowRequest(ctx, desc.Endpoint, desc.UserId)
+        resp.Decisions[i] = ratelimiter.DescriptorDecision{Allowed: d.Allowed, Limit: d.Limit, Remaining: d.Remaining}
+        if d.RetryAfter > 0 {
+            resp.Decisions[i].RetryAfter = int64((d.RetryAfter + time.Second - 1) / time.Second)
+        }
+        if err != nil {
+            resp.Decisions[i].Error = err.Error()
+        }
+        resp.Allowed = resp.Allowed && d.Allowed
+    }
+    return resp
+}
+
+// Close closes the idle connections to the service.
+func (c *DecisionClient) Close() {
+    c.client.CloseIdleConnections()
+}
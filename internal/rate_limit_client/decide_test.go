@@ -0,0 +1,52 @@
+package rate_limit_client
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+)
+
+// A call rejected with a 4xx is the caller's mistake: the next calls still go to the service. A 5xx fails over to the
+// local decisions for the cooldown.
+func TestDecideFailsOverOnlyOnServerErrors(t *testing.T) {
+    for _, test := range []struct {
+        status   int
+        rejected bool
+        calls    int64
+    }{
+        {status: http.StatusBadRequest, rejected: true, calls: 2},
+        {status: http.StatusServiceUnavailable, calls: 1},
+    } {
+        t.Run(http.StatusText(test.status), func(t *testing.T) {
+            var calls atomic.Int64
+            server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                calls.Add(1)
+                http.Error(w, `{"error":"Invalid decision request"}`, test.status)
+            }))
+            defer server.Close()
+            client, err := NewDecisionClient(DecisionClientConfig{URL: server.URL})
+            if err != nil {
+                t.Fatalf("NewDecisionClient: %v", err)
+            }
+            defer client.Close()
+            for range 2 {
+                d, err := client.Allow(context.Background(), "/ping", "user")
+                if err == nil {
+                    t.Fatalf("Allow: no error")
+                }
+                if rejected := errors.Is(err, ErrDecisionRejected); rejected != test.rejected {
+                    t.Fatalf("Allow: %v, rejected %t expected", err, test.rejected)
+                }
+                if !d.Allowed {
+                    t.Fatalf("request denied, the client fails open")
+                }
+            }
+            if n := calls.Load(); n != test.calls {
+                t.Fatalf("%d calls to the service, %d expected", n, test.calls)
+            }
+        })
+    }
+}
@@ -0,0 +1,337 @@
+package rate_limiter
+
+import (
+    "context"
+    "fmt"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+    "time"
+)
+
+// Names of the built-in algorithms, selected with EndpointConfig.Algorithm.
+const (
+    AlgorithmSlidingWindow = "sliding_window"
+    AlgorithmFixedWindow   = "fixed_window"
+    AlgorithmTokenBucket   = "token_bucket"
+    AlgorithmLeakyBucket   = "leaky_bucket"
+    AlgorithmGCRA          = "gcra"
+)
+
+// Algorithm holds the windowing math of a rate limit, the rate limiter handles everything around it: configurations,
+// policies, stores and errors.
+type Algorithm interface {
+    // Allow reports whether the request of the key is allowed at now under the configuration, and counts it if so
+    Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error)
+}
+
+// BatchAlgorithm is implemented by the algorithms able to count a request for several, e.g. the items of a batch.
+type BatchAlgorithm interface {
+    // AllowN reports whether the request of the key is allowed at now for cost, and counts it for cost if so. It also
+    // returns the cost the key could still afford, the hint of a rejected batch.
+    AllowN(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig, cost int64) (bool, int64, error)
+}
+
+// RemainingAlgorithm is implemented by the algorithms counting a request once that can tell the budget left after it,
+// e.g. for the rate limit headers.
+type RemainingAlgorithm interface {
+    // AllowRemaining is Allow, also returning the limit of the key and the requests it could still make at now
+    AllowRemaining(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, int64, int64, error)
+}
+
+// BucketAlgorithm is implemented by the algorithms counting the requests in buckets, so the windows of an endpoint,
+// see EndpointConfig.Windows, are checked and counted together with ratelimiterstore.BatchSetIfBelow: a request
+// rejected by a window is counted by none.
+type BucketAlgorithm interface {
+    // BatchKey returns the buckets and the limit the request of the key is checked against at now
+    BatchKey(key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) ratelimiterstore.BatchKey
+}
+
+// RetryAlgorithm is implemented by the algorithms able to tell a rejected key when to retry, the Retry-After header of
+// the rejection.
+type RetryAlgorithm interface {
+    // RetryAfter returns how long the key should wait after a rejection at now before it is allowed a request again
+    RetryAfter(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (time.Duration, error)
+}
+
+// SlidingWindow counts the requests in buckets of SlidingWindowInterval kept for TimeWindow, and allows a request
+// while the sum of the buckets is under MaxRequests. The check and the count are atomic with a store implementing
+// ratelimiterstore.AtomicStore.
+type SlidingWindow struct{}
+
+func (SlidingWindow) Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error) {
+    if atomic, ok := store.(ratelimiterstore.AtomicStore); ok {
+        // The first request of a user is always allowed
+        allowed, err := atomic.SetIfBelow(ctx, key, max(int64(conf.MaxRequests), 1), now, conf.SlidingWindowInterval, conf.TimeWindow)
+        if err != nil {
+            return false, fmt.Errorf("failed to set count: %w", err)
+        }
+        return allowed, nil
+    }
+    count, err := countWindows(ctx, store, key, now, conf.SlidingWindowInterval, conf.TimeWindow)
+    if err != nil {
+        return false, fmt.Errorf("failed to get count: %w", err)
+    }
+    // The first request of a user is always allowed
+    if count != 0 && count >= int64(conf.MaxRequests) {
+        return false, nil
+    }
+    if err := store.Set(ctx, key, now, conf.SlidingWindowInterval, conf.TimeWindow); err != nil {
+        return false, fmt.Errorf("failed to set count: %w", err)
+    }
+    return true, nil
+}
+
+func (SlidingWindow) AllowN(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig, cost int64) (bool, int64, error) {
+    return allowN(ctx, store, key, now, cost, max(int64(conf.MaxRequests), 1), conf.SlidingWindowInterval, conf.TimeWindow)
+}
+
+// BatchKey returns the buckets of SlidingWindowInterval kept for TimeWindow, the first request of a user is always
+// allowed.
+func (SlidingWindow) BatchKey(key ratelimiterstore.RateLimiterKey, _ time.Time, conf EndpointConfig) ratelimiterstore.BatchKey {
+    return ratelimiterstore.BatchKey{Key: key, WindowInterval: conf.SlidingWindowInterval, TTL: conf.TimeWindow, Limit: max(int64(conf.MaxRequests), 1)}
+}
+
+// RetryAfter returns how long until the oldest bucket expires, freeing its requests, with a store implementing
+// ratelimiterstore.WindowExpirer. Otherwise, it returns how long until the next window, when a bucket may expire.
+func (SlidingWindow) RetryAfter(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (time.Duration, error) {
+    if expirer, ok := store.(ratelimiterstore.WindowExpirer); ok {
+        left, err := expirer.OldestExpiry(ctx, key, now, conf.SlidingWindowInterval, conf.TimeWindow)
+        if err != nil {
+            return 0, fmt.Errorf("failed to get expiry: %w", err)
+        }
+        if left > 0 {
+            return left, nil
+        }
+    }
+    return ratelimiterstore.WindowStart(now, conf.SlidingWindowInterval).Add(conf.SlidingWindowInterval).Sub(now), nil
+}
+
+// FixedWindow counts the requests in windows of TimeWindow aligned on UTC, e.g. per calendar minute or day, and
+// allows MaxRequests per window. It is cheaper than SlidingWindow, a single bucket is read, but allows bursts of up to
+// twice MaxRequests around the window boundaries.
+type FixedWindow struct{}
+
+func (FixedWindow) Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error) {
+    // The bucket expires at the end of its window, so Get only ever sums the current one
+    end := ratelimiterstore.WindowStart(now, conf.TimeWindow).Add(conf.TimeWindow)
+    if atomic, ok := store.(ratelimiterstore.AtomicStore); ok {
+        allowed, err := atomic.SetIfBelow(ctx, key, int64(conf.MaxRequests), now, conf.TimeWindow, end.Sub(now))
+        if err != nil {
+            return false, fmt.Errorf("failed to set count: %w", err)
+        }
+        return allowed, nil
+    }
+    count, err := countWindows(ctx, store, key, now, conf.TimeWindow, end.Sub(now))
+    if err != nil {
+        return false, fmt.Errorf("failed to get count: %w", err)
+    }
+    if count >= int64(conf.MaxRequests) {
+        return false, nil
+    }
+    if err := store.Set(ctx, key, now, conf.TimeWindow, end.Sub(now)); err != nil {
+        return false, fmt.Errorf("failed to set count: %w", err)
+    }
+    return true, nil
+}
+
+func (FixedWindow) AllowN(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig, cost int64) (bool, int64, error) {
+    end := ratelimiterstore.WindowStart(now, conf.TimeWindow).Add(conf.TimeWindow)
+    return allowN(ctx, store, key, now, cost, int64(conf.MaxRequests), conf.TimeWindow, end.Sub(now))
+}
+
+// BatchKey returns the bucket of the window, expiring at its end.
+func (FixedWindow) BatchKey(key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) ratelimiterstore.BatchKey {
+    end := ratelimiterstore.WindowStart(now, conf.TimeWindow).Add(conf.TimeWindow)
+    return ratelimiterstore.BatchKey{Key: key, WindowInterval: conf.TimeWindow, TTL: end.Sub(now), Limit: int64(conf.MaxRequests)}
+}
+
+// RetryAfter returns how long until the end of the window.
+func (FixedWindow) RetryAfter(_ context.Context, _ ratelimiterstore.Store, _ ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (time.Duration, error) {
+    return ratelimiterstore.WindowStart(now, conf.TimeWindow).Add(conf.TimeWindow).Sub(now), nil
+}
+
+// allowN counts the request for cost in the buckets of windowInterval kept for ttl if the count stays within limit,
+// and returns the cost the key could afford before the request.
+func allowN(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, cost, limit int64, windowInterval, ttl time.Duration) (bool, int64, error) {
+    if atomic, ok := store.(ratelimiterstore.AtomicStore); ok {
+        count, added, err := atomic.AddIfBelow(ctx, key, cost, limit, now, windowInterval, ttl)
+        if err != nil {
+            return false, 0, fmt.Errorf("failed to set count: %w", err)
+        }
+        return added, max(limit-count, 0), nil
+    }
+    count, err := countWindows(ctx, store, key, now, windowInterval, ttl)
+    if err != nil {
+        return false, 0, fmt.Errorf("failed to get count: %w", err)
+    }
+    if count > limit-cost {
+        return false, max(limit-count, 0), nil
+    }
+    // Set counts a single request
+    for range cost {
+        if err := store.Set(ctx, key, now, windowInterval, ttl); err != nil {
+            return false, 0, fmt.Errorf("failed to set count: %w", err)
+        }
+    }
+    return true, limit - count, nil
+}
+
+// countWindows returns the count of the key, finding its buckets by name if the store can rather than with Get.
+func countWindows(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if counter, ok := store.(ratelimiterstore.WindowCounter); ok {
+        return counter.CountWindows(ctx, key, now, windowInterval, ttl)
+    }
+    return store.Get(ctx, key)
+}
+
+// TokenBucket allows bursts of up to MaxRequests, refilled at MaxRequests per TimeWindow. It needs a store
+// implementing ratelimiterstore.TokenBucketStore.
+type TokenBucket struct{}
+
+func (t TokenBucket) Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error) {
+    allowed, _, _, err := t.AllowRemaining(ctx, store, key, now, conf)
+    return allowed, err
+}
+
+// AllowRemaining returns MaxRequests as the limit and the tokens left in the bucket.
+func (TokenBucket) AllowRemaining(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, int64, int64, error) {
+    buckets, ok := store.(ratelimiterstore.TokenBucketStore)
+    if !ok {
+        return false, 0, 0, fmt.Errorf("store doesn't support token buckets")
+    }
+    if conf.MaxRequests <= 0 {
+        return false, 0, 0, nil
+    }
+    allowed, remaining, err := buckets.TakeToken(ctx, key, now, int64(conf.MaxRequests), conf.TimeWindow/time.Duration(conf.MaxRequests))
+    if err != nil {
+        return false, 0, 0, fmt.Errorf("failed to take token: %w", err)
+    }
+    return allowed, int64(conf.MaxRequests), remaining, nil
+}
+
+// RetryAfter returns how long an empty bucket takes to refill a token, at most.
+func (TokenBucket) RetryAfter(_ context.Context, _ ratelimiterstore.Store, _ ratelimiterstore.RateLimiterKey, _ time.Time, conf EndpointConfig) (time.Duration, error) {
+    return emissionInterval(conf), nil
+}
+
+// emissionInterval returns the interval between two requests at MaxRequests per TimeWindow, TimeWindow if no request
+// is allowed.
+func emissionInterval(conf EndpointConfig) time.Duration {
+    if conf.MaxRequests <= 0 {
+        return conf.TimeWindow
+    }
+    return conf.TimeWindow / time.Duration(conf.MaxRequests)
+}
+
+// LeakyBucket lets the requests through at a steady rate of MaxRequests per TimeWindow, holding up to QueueDepth
+// requests back until their turn and rejecting the requests beyond, e.g. to smooth the calls to a downstream service
+// sensitive to bursts. It needs a store implementing ratelimiterstore.LeakyBucketStore.
+type LeakyBucket struct {
+    // Wait holds the request back for the delay, a request whose context is done meanwhile is rejected
+    //
+    // Defaults to a timer if not specified
+    Wait func(ctx context.Context, delay time.Duration) error
+}
+
+func (l LeakyBucket) Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error) {
+    allowed, _, _, err := l.AllowRemaining(ctx, store, key, now, conf)
+    return allowed, err
+}
+
+// AllowRemaining returns the places of the bucket, QueueDepth and the one of the request let through, as the limit
+// and the places left when the request was enqueued.
+func (l LeakyBucket) AllowRemaining(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, int64, int64, error) {
+    buckets, ok := store.(ratelimiterstore.LeakyBucketStore)
+    if !ok {
+        return false, 0, 0, fmt.Errorf("store doesn't support leaky buckets")
+    }
+    if conf.MaxRequests <= 0 {
+        return false, 0, 0, nil
+    }
+    // The request being let through takes a place besides the queue
+    capacity := int64(conf.QueueDepth) + 1
+    delay, allowed, remaining, err := buckets.Enqueue(ctx, key, now, capacity, conf.TimeWindow/time.Duration(conf.MaxRequests))
+    if err != nil {
+        return false, 0, 0, fmt.Errorf("failed to enqueue request: %w", err)
+    }
+    if !allowed || delay <= 0 {
+        return allowed, capacity, remaining, nil
+    }
+    wait := l.Wait
+    if wait == nil {
+        wait = sleep
+    }
+    // The request keeps its place in the bucket, it leaks out whether or not it waited
+    return wait(ctx, delay) == nil, capacity, remaining, nil
+}
+
+// RetryAfter returns how long a full bucket takes to leak a request.
+func (LeakyBucket) RetryAfter(_ context.Context, _ ratelimiterstore.Store, _ ratelimiterstore.RateLimiterKey, _ time.Time, conf EndpointConfig) (time.Duration, error) {
+    return emissionInterval(conf), nil
+}
+
+// sleep waits for the delay unless ctx is done first.
+func sleep(ctx context.Context, delay time.Duration) error {
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+// GCRA is the generic cell rate algorithm, it allows bursts of up to MaxRequests at MaxRequests per TimeWindow like
+// TokenBucket but keeps a single value per key, the theoretical arrival time of the next request, instead of a key per
+// SlidingWindowInterval. It needs a store implementing ratelimiterstore.GCRAStore.
+type GCRA struct{}
+
+func (g GCRA) Allow(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, error) {
+    allowed, _, _, err := g.AllowRemaining(ctx, store, key, now, conf)
+    return allowed, err
+}
+
+// AllowRemaining returns MaxRequests as the limit and the requests that would still conform at now.
+func (GCRA) AllowRemaining(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, now time.Time, conf EndpointConfig) (bool, int64, int64, error) {
+    tats, ok := store.(ratelimiterstore.GCRAStore)
+    if !ok {
+        return false, 0, 0, fmt.Errorf("store doesn't support GCRA")
+    }
+    if conf.MaxRequests <= 0 {
+        return false, 0, 0, nil
+    }
+    emission := conf.TimeWindow / time.Duration(conf.MaxRequests)
+    // A burst of MaxRequests pushes the arrival time a whole TimeWindow ahead, the last of them conforms at
+    // TimeWindow - emission
+    conforms, remaining, err := tats.Conform(ctx, key, now, emission, conf.TimeWindow-emission)
+    if err != nil {
+        return false, 0, 0, fmt.Errorf("failed to check arrival time: %w", err)
+    }
+    return conforms, int64(conf.MaxRequests), remaining, nil
+}
+
+// RetryAfter returns the emission interval, the longest a rejected key waits for its next request to conform.
+func (GCRA) RetryAfter(_ context.Context, _ ratelimiterstore.Store, _ ratelimiterstore.RateLimiterKey, _ time.Time, conf EndpointConfig) (time.Duration, error) {
+    return emissionInterval(conf), nil
+}
+
+// WithAlgorithm registers an algorithm the endpoints can select by name with EndpointConfig.Algorithm, to experiment
+// without forking the rate limiter. The built-in algorithms can be replaced too.
+func WithAlgorithm(name string, algorithm Algorithm) Option {
+    return func(rl *rateLimiter) {
+        rl.algorithms[name] = algorithm
+    }
+}
+
+// algorithmFor returns the algorithm of the endpoint, falling back to SlidingWindow for unknown names.
+func (rl *rateLimiter) algorithmFor(ctx context.Context, endpoint string, conf EndpointConfig) Algorithm {
+    if conf.Algorithm == "" {
+        return rl.algorithms[AlgorithmSlidingWindow]
+    }
+    if algorithm, ok := rl.algorithms[conf.Algorithm]; ok {
+        return algorithm
+    }
+    rl.logThrottle.Log(ctx, rl.logger, slog.LevelWarn, "Unknown algorithm, using the sliding window", "endpoint", endpoint, "algorithm", conf.Algorithm)
+    return rl.algorithms[AlgorithmSlidingWindow]
+}
@@ -0,0 +1,233 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store/storetest"
+    "pgregory.net/rapid"
+    "testing"
+    "time"
+)
+
+var testKey = ratelimiterstore.RateLimiterKey{Endpoint: "/test", UserId: "user"}
+
+// trace is a random sequence of request times, in order, some of them at the same time.
+func trace(t *rapid.T, maxStep time.Duration) []time.Time {
+    // Start anywhere in a window, the windows are aligned on UTC
+    now := time.Unix(rapid.Int64Range(1e9, 2e9).Draw(t, "start"), rapid.Int64Range(0, 999999999).Draw(t, "nanos"))
+    steps := rapid.SliceOfN(rapid.Int64Range(0, int64(maxStep)), 1, 300).Draw(t, "steps")
+    times := make([]time.Time, len(steps))
+    for i, step := range steps {
+        now = now.Add(time.Duration(step))
+        times[i] = now
+    }
+    return times
+}
+
+// windowConfig draws a configuration of whole-second windows, the buckets of the stores are named by the second.
+func windowConfig(t *rapid.T) EndpointConfig {
+    interval := rapid.SampledFrom([]time.Duration{time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second}).Draw(t, "interval")
+    return EndpointConfig{
+        MaxRequests:           rapid.IntRange(1, 20).Draw(t, "max_requests"),
+        TimeWindow:            interval * time.Duration(rapid.IntRange(2, 12).Draw(t, "intervals")),
+        SlidingWindowInterval: interval,
+    }
+}
+
+// run sends the requests of the trace to the algorithm, the clock of the store following the trace, and returns the
+// times of the allowed requests. check is called after every request.
+func run(t *rapid.T, algorithm Algorithm, conf EndpointConfig, times []time.Time, check func(store *storetest.FakeStore, now time.Time, allowed bool)) []time.Time {
+    ctx := context.Background()
+    store := storetest.NewFakeStore()
+    var now time.Time
+    store.Now = func() time.Time {
+        return now
+    }
+    var allowed []time.Time
+    for _, now = range times {
+        ok, err := algorithm.Allow(ctx, store, testKey, now, conf)
+        if err != nil {
+            t.Fatalf("Allow: %v", err)
+        }
+        if ok {
+            allowed = append(allowed, now)
+        }
+        if check != nil {
+            check(store, now, ok)
+        }
+    }
+    return allowed
+}
+
+// maxInSpan returns the highest number of times within any span shorter than span, the times being in order.
+func maxInSpan(times []time.Time, span time.Duration) (int, time.Time) {
+    var (
+        most  int
+        first time.Time
+    )
+    start := 0
+    for end := range times {
+        for times[end].Sub(times[start]) >= span {
+            start++
+        }
+        if n := end - start + 1; n > most {
+            most, first = n, times[start]
+        }
+    }
+    return most, first
+}
+
+// checkRate fails if more than burst requests plus the requests emitted since the first were allowed in a span.
+func checkRate(t *rapid.T, allowed []time.Time, burst int, emission time.Duration) {
+    for start := range allowed {
+        for end := start; end < len(allowed); end++ {
+            n := end - start + 1
+            // The refill is counted in floats by the stores, leave room for their rounding
+            bound := burst + int(float64(allowed[end].Sub(allowed[start]))/float64(emission)+1e-6)
+            if n > bound {
+                t.Fatalf("%d requests allowed between %s and %s, at most %d expected", n, allowed[start], allowed[end], bound)
+            }
+        }
+    }
+}
+
+// The sliding window never allows more than MaxRequests in a span of TimeWindow - SlidingWindowInterval, the span
+// always covered by the buckets.
+func TestSlidingWindowNeverExceedsLimit(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        allowed := run(t, SlidingWindow{}, conf, trace(t, conf.TimeWindow/4), nil)
+        if n, first := maxInSpan(allowed, conf.TimeWindow-conf.SlidingWindowInterval+1); n > conf.MaxRequests {
+            t.Fatalf("%d requests allowed from %s, at most %d expected", n, first, conf.MaxRequests)
+        }
+    })
+}
+
+// Over a whole TimeWindow, the exact sliding log allows MaxRequests. The sliding window approximates it with buckets, a
+// bucket expiring up to a SlidingWindowInterval early, so it allows at most the requests of one interval more.
+func TestSlidingWindowErrorBound(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        allowed := run(t, SlidingWindow{}, conf, trace(t, conf.TimeWindow/4), nil)
+        for start := range allowed {
+            var window, early int
+            for _, at := range allowed[start:] {
+                elapsed := at.Sub(allowed[start])
+                if elapsed >= conf.TimeWindow {
+                    break
+                }
+                window++
+                if elapsed < conf.SlidingWindowInterval {
+                    early++
+                }
+            }
+            if window > conf.MaxRequests+early {
+                t.Fatalf("%d requests allowed in the window from %s, the exact log allows %d and the error bound is %d",
+                    window, allowed[start], conf.MaxRequests, early)
+            }
+        }
+    })
+}
+
+// The fixed window never allows more than MaxRequests in a window aligned on UTC.
+func TestFixedWindowNeverExceedsLimit(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        allowed := run(t, FixedWindow{}, conf, trace(t, conf.TimeWindow/4), nil)
+        counts := make(map[time.Time]int)
+        for _, at := range allowed {
+            window := ratelimiterstore.WindowStart(at, conf.TimeWindow)
+            if counts[window]++; counts[window] > conf.MaxRequests {
+                t.Fatalf("%d requests allowed in the window of %s, at most %d expected", counts[window], window, conf.MaxRequests)
+            }
+        }
+    })
+}
+
+// The token bucket and the GCRA allow a burst of MaxRequests, then MaxRequests per TimeWindow.
+func TestBurstAlgorithmsNeverExceedRate(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        algorithm := rapid.SampledFrom([]Algorithm{TokenBucket{}, GCRA{}}).Draw(t, "algorithm")
+        allowed := run(t, algorithm, conf, trace(t, conf.TimeWindow/4), nil)
+        checkRate(t, allowed, conf.MaxRequests, emissionInterval(conf))
+    })
+}
+
+// The leaky bucket lets through the request being served and QueueDepth queued ones, then MaxRequests per TimeWindow.
+func TestLeakyBucketNeverExceedsRate(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        conf.QueueDepth = rapid.IntRange(0, 10).Draw(t, "queue_depth")
+        noWait := LeakyBucket{Wait: func(context.Context, time.Duration) error {
+            return nil
+        }}
+        allowed := run(t, noWait, conf, trace(t, conf.TimeWindow/4), nil)
+        checkRate(t, allowed, conf.QueueDepth+1, emissionInterval(conf))
+    })
+}
+
+// The time a rejected key is told to retry at never moves back, whatever requests come meanwhile.
+func TestResetTimesAreMonotonic(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        algorithm := rapid.SampledFrom([]Algorithm{SlidingWindow{}, FixedWindow{}, TokenBucket{}, GCRA{}}).Draw(t, "algorithm")
+        var last time.Time
+        run(t, algorithm, conf, trace(t, conf.TimeWindow/4), func(store *storetest.FakeStore, now time.Time, allowed bool) {
+            if allowed {
+                return
+            }
+            retryAfter, err := algorithm.(RetryAlgorithm).RetryAfter(context.Background(), store, testKey, now, conf)
+            if err != nil {
+                t.Fatalf("RetryAfter: %v", err)
+            }
+            if retryAfter <= 0 {
+                t.Fatalf("rejected at %s with a retry after of %s", now, retryAfter)
+            }
+            reset := now.Add(retryAfter)
+            if reset.Before(last) {
+                t.Fatalf("reset at %s after a reset at %s", reset, last)
+            }
+            last = reset
+        })
+    })
+}
+
+// The remaining requests told after a request are the ones the key can still make at the same time.
+func TestRemainingIsTheBurstLeft(t *testing.T) {
+    rapid.Check(t, func(t *rapid.T) {
+        conf := windowConfig(t)
+        conf.QueueDepth = rapid.IntRange(0, 10).Draw(t, "queue_depth")
+        noWait := LeakyBucket{Wait: func(context.Context, time.Duration) error {
+            return nil
+        }}
+        algorithm := rapid.SampledFrom([]RemainingAlgorithm{TokenBucket{}, noWait, GCRA{}}).Draw(t, "algorithm")
+        var (
+            store *storetest.FakeStore
+            now   time.Time
+        )
+        run(t, algorithm.(Algorithm), conf, trace(t, conf.TimeWindow/4), func(s *storetest.FakeStore, n time.Time, _ bool) {
+            store, now = s, n
+        })
+        // Drain the budget at the time of the last request, the remaining requests count down to the rejection
+        var told []int64
+        for {
+            allowed, limit, remaining, err := algorithm.AllowRemaining(context.Background(), store, testKey, now, conf)
+            if err != nil {
+                t.Fatalf("AllowRemaining: %v", err)
+            }
+            if remaining < 0 || remaining >= limit {
+                t.Fatalf("%d requests remaining of a limit of %d", remaining, limit)
+            }
+            if !allowed {
+                break
+            }
+            told = append(told, remaining)
+        }
+        for i, remaining := range told {
+            if left := int64(len(told) - i - 1); remaining != left {
+                t.Fatalf("%d requests remaining after request %d, %d allowed after it", remaining, i, left)
+            }
+        }
+    })
+}
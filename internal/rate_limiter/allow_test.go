@@ -0,0 +1,72 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strconv"
+    "testing"
+    "time"
+)
+
+// benchmarkLimiter limits /ping with a sliding window on a memory store, high enough for every request to be allowed.
+func benchmarkLimiter() RateLimiter {
+    config := RateLimiterConfig{"/ping": {MaxRequests: 1 << 40, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    return NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    })
+}
+
+func BenchmarkAllowRequest(b *testing.B) {
+    rl := benchmarkLimiter()
+    defer rl.Close()
+    ctx := context.Background()
+    users := make([]string, 1000)
+    for i := range users {
+        users[i] = "ip:10.0.0." + strconv.Itoa(i)
+    }
+    b.ReportAllocs()
+    i := 0
+    for b.Loop() {
+        if _, err := rl.AllowRequest(ctx, "/ping", users[i%len(users)]); err != nil {
+            b.Fatalf("AllowRequest: %v", err)
+        }
+        i++
+    }
+}
+
+func BenchmarkAllowRequestParallel(b *testing.B) {
+    rl := benchmarkLimiter()
+    defer rl.Close()
+    ctx := context.Background()
+    b.ReportAllocs()
+    b.RunParallel(func(pb *testing.PB) {
+        i := 0
+        for pb.Next() {
+            if _, err := rl.AllowRequest(ctx, "/ping", "ip:10.0.0."+strconv.Itoa(i%1000)); err != nil {
+                b.Errorf("AllowRequest: %v", err)
+                return
+            }
+            i++
+        }
+    })
+}
+
+// BenchmarkMiddleware is the allow path of a request through the Hertz middleware, from the identity of the client to
+// the headers of the decision.
+func BenchmarkMiddleware(b *testing.B) {
+    rl := benchmarkLimiter()
+    defer rl.Close()
+    ctx := context.Background()
+    c := app.NewContext(0)
+    b.ReportAllocs()
+    for b.Loop() {
+        c.Reset()
+        c.Request.SetRequestURI("/ping")
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        rl.Middleware(ctx, c)
+        if c.Response.StatusCode() != 200 {
+            b.Fatalf("status %d", c.Response.StatusCode())
+        }
+    }
+}
@@ -0,0 +1,139 @@
+package rate_limiter
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/cache"
+    "log/slog"
+    "time"
+)
+
+// ErrUnknownKey is returned by a KeyResolver for a key it doesn't know, the requests with the key are answered 401.
+var ErrUnknownKey = errors.New("unknown API key")
+
+// APIKey is the caller an API key belongs to.
+type APIKey struct {
+    // ID the requests of the key are counted for, e.g. the customer, so its keys share a budget and the keys
+    // themselves are not written to the store
+    ID string `json:"id"`
+    // Limits replacing the endpoint configurations for the caller, e.g. the higher quotas of a paid plan
+    //
+    // Defaults to the endpoint configurations if not specified
+    Limits RateLimiterConfig `json:"limits,omitempty"`
+}
+
+// KeyResolver resolves the API keys of the requests, e.g. from the database of the customers.
+type KeyResolver interface {
+    // Resolve returns the caller of the key, or ErrUnknownKey if the key is not valid
+    Resolve(ctx context.Context, key string) (APIKey, error)
+}
+
+// StaticKeyResolver resolves the API keys it maps, e.g. loaded from the configuration file.
+type StaticKeyResolver map[string]APIKey
+
+func (r StaticKeyResolver) Resolve(_ context.Context, key string) (APIKey, error) {
+    apiKey, ok := r[key]
+    if !ok {
+        return APIKey{}, ErrUnknownKey
+    }
+    return apiKey, nil
+}
+
+type APIKeyConfig struct {
+    // Header holding the API key
+    //
+    // Defaults to X-API-Key if not specified
+    Header string `json:"header,omitempty"`
+    // Required answers the requests without an API key with 401, they are counted per identity or client IP as
+    // anonymous traffic otherwise
+    Required bool `json:"required,omitempty"`
+    // CacheTTL is how long a resolved key is cached in the process, a revoked key is accepted until it expires
+    //
+    // Defaults to 1 minute if not specified
+    CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+    // NegativeTTL is how long an unknown key is cached, so clients retrying a bad key don't reach the resolver
+    //
+    // Defaults to 10 seconds if not specified
+    NegativeTTL time.Duration `json:"negative_ttl,omitempty"`
+    // MaxKeys cached, the least recently used ones are evicted beyond
+    //
+    // Defaults to 10000 if not specified
+    MaxKeys int `json:"max_keys,omitempty"`
+}
+
+type apiKeys struct {
+    config   APIKeyConfig
+    resolver KeyResolver
+    cache    cache.Store // Resolved keys by the SHA-256 of the key, an empty ID for the unknown ones
+}
+
+// WithAPIKeys identifies the callers by the API key of their requests, resolved by the resolver, and applies the
+// limits of their key, e.g. so paying customers get higher quotas than the anonymous traffic. The key is read by every
+// middleware, it takes precedence over the other identities. A request with an unknown key is answered 401, a request
+// whose key can't be resolved is counted like a request without a key.
+func WithAPIKeys(resolver KeyResolver, config APIKeyConfig) Option {
+    return func(rl *rateLimiter) {
+        if config.Header == "" {
+            config.Header = "X-API-Key"
+        }
+        if config.CacheTTL == 0 {
+            config.CacheTTL = time.Minute
+        }
+        if config.NegativeTTL == 0 {
+            config.NegativeTTL = 10 * time.Second
+        }
+        if config.MaxKeys == 0 {
+            config.MaxKeys = 10000
+        }
+        rl.apiKeys = &apiKeys{
+            config:   config,
+            resolver: resolver,
+            cache:    cache.NewMemoryStore(config.MaxKeys),
+        }
+    }
+}
+
+// caller returns the caller of the API key of the request, with found false if it has none or it can't be resolved.
+func (rl *rateLimiter) caller(ctx context.Context, req Request) (apiKey APIKey, found bool, err error) {
+    key := req.Header(rl.apiKeys.config.Header)
+    if key == "" {
+        if rl.apiKeys.config.Required {
+            return APIKey{}, false, ErrMissingKey
+        }
+        return APIKey{}, false, nil
+    }
+    sum := sha256.Sum256([]byte(key))
+    hash := hex.EncodeToString(sum[:])
+    if value, err := rl.apiKeys.cache.Get(ctx, hash); err == nil && json.Unmarshal(value, &apiKey) == nil {
+        if apiKey.ID == "" {
+            return APIKey{}, false, ErrUnknownKey
+        }
+        return apiKey, true, nil
+    }
+    apiKey, err = rl.apiKeys.resolver.Resolve(ctx, key)
+    ttl := rl.apiKeys.config.CacheTTL
+    switch {
+    case errors.Is(err, ErrUnknownKey):
+        apiKey, ttl = APIKey{}, rl.apiKeys.config.NegativeTTL
+    case err != nil:
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error resolving API key", "error", err)
+        return APIKey{}, false, nil
+    case apiKey.ID == "":
+        // Counted for the key rather than for nobody, apart from the keys of a KeyExtractor
+        apiKey.ID = "apikey:" + hash
+    }
+    if err := apiKey.Limits.Validate(); err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Invalid limits of API key, using the endpoint ones", "user", apiKey.ID, "error", err)
+        apiKey.Limits = nil
+    }
+    if value, err := json.Marshal(apiKey); err == nil {
+        _ = rl.apiKeys.cache.Set(ctx, hash, value, ttl)
+    }
+    if apiKey.ID == "" {
+        return APIKey{}, false, ErrUnknownKey
+    }
+    return apiKey, true, nil
+}
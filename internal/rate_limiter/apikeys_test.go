@@ -0,0 +1,140 @@
+package rate_limiter
+
+import (
+    "context"
+    "errors"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// countingResolver counts the keys resolved, and fails them while err is set.
+type countingResolver struct {
+    StaticKeyResolver
+    calls atomic.Int64
+    err   error
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, key string) (APIKey, error) {
+    r.calls.Add(1)
+    if r.err != nil {
+        return APIKey{}, r.err
+    }
+    return r.StaticKeyResolver.Resolve(ctx, key)
+}
+
+func newKeyLimiter(t *testing.T, resolver KeyResolver, config APIKeyConfig) *rateLimiter {
+    t.Helper()
+    rl := NewRateLimiter(RateLimiterConfig{"/api": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+        ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+            return string(path)
+        }, WithAPIKeys(resolver, config)).(*rateLimiter)
+    t.Cleanup(func() {
+        _ = rl.Close()
+    })
+    return rl
+}
+
+// serveKey serves a request of the client IP with the API key in the header of the limiter, "" for none, and returns
+// its status.
+func serveKey(rl *rateLimiter, key string) int {
+    c := app.NewContext(0)
+    c.Request.SetRequestURI("/api")
+    c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+    if key != "" {
+        c.Request.Header.Set(rl.apiKeys.config.Header, key)
+    }
+    c.SetHandlers(app.HandlersChain{rl.Middleware, func(_ context.Context, c *app.RequestContext) {
+        c.String(200, "ok")
+    }})
+    c.Next(context.Background())
+    return c.Response.StatusCode()
+}
+
+func TestAPIKeys(t *testing.T) {
+    resolver := &countingResolver{StaticKeyResolver: StaticKeyResolver{
+        "acme-1":   {ID: "acme"},
+        "acme-2":   {ID: "acme"},
+        "globex-1": {ID: "globex", Limits: RateLimiterConfig{"/api": {MaxRequests: 3, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}},
+    }}
+    rl := newKeyLimiter(t, resolver, APIKeyConfig{})
+
+    // The keys of a caller share its budget
+    for i, test := range []struct {
+        key    string
+        status int
+    }{
+        {"acme-1", 200},
+        {"acme-2", 200},
+        {"acme-1", 429},
+        // The limits of the key replace the endpoint ones
+        {"globex-1", 200},
+        {"globex-1", 200},
+        {"globex-1", 200},
+        {"globex-1", 429},
+        // The requests without a key are counted per client IP
+        {"", 200},
+        {"", 200},
+        {"", 429},
+        {"unknown", 401},
+        {"unknown", 401},
+    } {
+        if status := serveKey(rl, test.key); status != test.status {
+            t.Fatalf("request %d with key %q: %d, %d expected", i, test.key, status, test.status)
+        }
+    }
+    // The keys are resolved once, the unknown ones included
+    if calls := resolver.calls.Load(); calls != 4 {
+        t.Fatalf("%d keys resolved, 4 expected", calls)
+    }
+}
+
+func TestAPIKeysFallBack(t *testing.T) {
+    resolver := &countingResolver{StaticKeyResolver: StaticKeyResolver{
+        "anonymous-key": {},
+        "invalid-limits": {ID: "initech", Limits: RateLimiterConfig{
+            "/api": {MaxRequests: 100, TimeWindow: time.Second, SlidingWindowInterval: time.Minute},
+        }},
+    }}
+    rl := newKeyLimiter(t, resolver, APIKeyConfig{})
+    user := func(key string) string {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI("/api")
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        c.Request.Header.Set("X-API-Key", key)
+        a, v := rl.admit(context.Background(), hertzRequest{c: c, rl: rl})
+        if a == nil {
+            t.Fatalf("request with key %q not admitted: %v", key, v)
+        }
+        return a.user
+    }
+
+    // A key without an ID is counted for its hash, never for the key itself
+    if u := user("anonymous-key"); !strings.HasPrefix(u, "apikey:") || strings.Contains(u, "anonymous-key") {
+        t.Fatalf("key without an ID counted for %q", u)
+    }
+    // Invalid limits are replaced by the endpoint ones
+    for i, status := range []int{200, 200, 429} {
+        if s := serveKey(rl, "invalid-limits"); s != status {
+            t.Fatalf("request %d with invalid limits: %d, %d expected", i, s, status)
+        }
+    }
+    // A key that can't be resolved is counted like a request without a key
+    resolver.err = errors.New("customers database unavailable")
+    if u := user("other-key"); u != "ip:10.0.0.1" {
+        t.Fatalf("key that can't be resolved counted for %q, ip:10.0.0.1 expected", u)
+    }
+}
+
+func TestAPIKeysRequired(t *testing.T) {
+    rl := newKeyLimiter(t, StaticKeyResolver{"acme-1": {ID: "acme"}}, APIKeyConfig{Header: "Authorization", Required: true})
+    if status := serveKey(rl, ""); status != 401 {
+        t.Fatalf("request without a key: %d, 401 expected", status)
+    }
+    if status := serveKey(rl, "acme-1"); status != 200 {
+        t.Fatalf("request with a key: %d, 200 expected", status)
+    }
+}
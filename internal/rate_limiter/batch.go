@@ -0,0 +1,128 @@
+package rate_limiter
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strconv"
+)
+
+type BatchConfig struct {
+    // Endpoints of the batch APIs, matched against the sanitized path
+    Endpoints []string `json:"endpoints"`
+    // Header holding the number of items of a batch. The items of the body are counted anyway, the header is only a
+    // lower bound so a client can't declare fewer items than it sends, and the size of the batches whose body can't be
+    // counted
+    //
+    // Defaults to X-Batch-Size if not specified
+    Header string `json:"header,omitempty"`
+    // Field of the top-level JSON object holding the items, e.g. "items"
+    //
+    // Defaults to the body itself being the JSON array of items if not specified
+    Field string `json:"field,omitempty"`
+    // MaxBodyBytes bounds the bytes of the body read to count the items, a longer body is charged as one item, or the
+    // header if it declares more, and passed on whole to the next handlers
+    //
+    // Defaults to 1MiB if not specified
+    MaxBodyBytes int64 `json:"max_body_bytes,omitempty"`
+}
+
+type batches struct {
+    config    BatchConfig
+    endpoints map[string]struct{}
+}
+
+// WithBatches charges the requests of batch APIs for their number of items instead of one, read from a header or
+// counted in the JSON body. A rejected batch gets the number of items the user may send now, so the client can split
+// it instead of retrying it whole.
+//
+// Items are counted by the algorithms implementing BatchAlgorithm, the others count a batch as one request.
+func WithBatches(config BatchConfig) Option {
+    return func(rl *rateLimiter) {
+        if config.Header == "" {
+            config.Header = "X-Batch-Size"
+        }
+        if config.MaxBodyBytes == 0 {
+            config.MaxBodyBytes = 1 << 20
+        }
+        b := &batches{
+            config:    config,
+            endpoints: make(map[string]struct{}, len(config.Endpoints)),
+        }
+        for _, e := range config.Endpoints {
+            b.endpoints[e] = struct{}{}
+        }
+        rl.batches = b
+    }
+}
+
+// size returns the number of items of the request if the endpoint is a batch API, 0 otherwise: the items counted in
+// the body, or the header if it declares more. A batch whose items can't be counted, e.g. with a body over
+// MaxBodyBytes, is charged as one request.
+func (b *batches) size(endpoint string, req Request) int64 {
+    if _, ok := b.endpoints[endpoint]; !ok {
+        return 0
+    }
+    size := int64(1)
+    if body, ok := req.Body(b.config.MaxBodyBytes); ok {
+        if n, err := countItems(body, b.config.Field); err == nil {
+            size = max(size, n)
+        }
+    }
+    if v := req.Header(b.config.Header); v != "" {
+        if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+            size = max(size, n)
+        }
+    }
+    return size
+}
+
+// countItems counts the elements of the JSON array in the body, or in the field of the object in the body, without
+// decoding them.
+func countItems(body []byte, field string) (int64, error) {
+    dec := json.NewDecoder(bytes.NewReader(body))
+    if field != "" {
+        if err := expectDelim(dec, '{'); err != nil {
+            return 0, err
+        }
+        for {
+            if !dec.More() {
+                return 0, fmt.Errorf("field %s not found", field)
+            }
+            name, err := dec.Token()
+            if err != nil {
+                return 0, err
+            }
+            if name == field {
+                break
+            }
+            var skip json.RawMessage
+            if err := dec.Decode(&skip); err != nil {
+                return 0, err
+            }
+        }
+    }
+    if err := expectDelim(dec, '['); err != nil {
+        return 0, err
+    }
+    var n int64
+    for dec.More() {
+        var skip json.RawMessage
+        if err := dec.Decode(&skip); err != nil {
+            return 0, err
+        }
+        n++
+    }
+    return n, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+    t, err := dec.Token()
+    if err != nil {
+        return err
+    }
+    if t != delim {
+        return fmt.Errorf("expected %s, got %v", delim, t)
+    }
+    return nil
+}
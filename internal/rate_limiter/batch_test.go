@@ -0,0 +1,48 @@
+package rate_limiter
+
+import (
+    "io"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestBatchSizeCapsTheBody(t *testing.T) {
+    b := &batches{config: BatchConfig{Header: "X-Batch-Size", MaxBodyBytes: 16}, endpoints: map[string]struct{}{"/events": {}}}
+    for _, tt := range []struct {
+        name          string
+        body          string
+        header        string
+        unknownLength bool
+        size          int64
+    }{
+        {name: "counted", body: `[1,2,3]`, size: 3},
+        {name: "header declaring more", body: `[1,2,3]`, header: "5", size: 5},
+        {name: "header declaring fewer", body: `[1,2,3]`, header: "1", size: 3},
+        {name: "over the cap", body: `[1,2,3,4,5,6,7,8,9]`, size: 1},
+        {name: "over the cap without length", body: `[1,2,3,4,5,6,7,8,9]`, unknownLength: true, size: 1},
+        {name: "over the cap with header", body: `[1,2,3,4,5,6,7,8,9]`, header: "9", size: 9},
+    } {
+        t.Run(tt.name, func(t *testing.T) {
+            r := httptest.NewRequest("POST", "/events", strings.NewReader(tt.body))
+            if tt.unknownLength {
+                r.ContentLength = -1
+            }
+            if tt.header != "" {
+                r.Header.Set("X-Batch-Size", tt.header)
+            }
+            req := &httpRequest{r: r}
+            if size := b.size("/events", req); size != tt.size {
+                t.Fatalf("size %d, %d expected", size, tt.size)
+            }
+            // The next handlers read the whole body
+            body, err := io.ReadAll(r.Body)
+            if err != nil {
+                t.Fatalf("ReadAll: %v", err)
+            }
+            if string(body) != tt.body {
+                t.Fatalf("next handlers read %q, %q expected", body, tt.body)
+            }
+        })
+    }
+}
@@ -0,0 +1,137 @@
+package rate_limiter
+
+import (
+    "github.com/cloudwego/hertz/pkg/app"
+    "math"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// AllEndpoints reports a capacity applying to every endpoint, e.g. when the database shared by the backends degrades.
+const AllEndpoints = ""
+
+type CapacityConfig struct {
+    // Header of the responses in which the backends report their capacity, as a fraction of the nominal one such as
+    // 0.5 or a percentage such as 50%. It is removed from the response before it reaches the client.
+    //
+    // Defaults to X-Backend-Capacity if not specified
+    Header string `json:"header,omitempty"`
+    // TTL of a report, an endpoint is back to its nominal limits once no report was received for it for TTL, so a
+    // backend that stops reporting doesn't stay throttled
+    //
+    // Defaults to 1 minute if not specified
+    TTL time.Duration `json:"ttl,omitempty"`
+    // MinScale floors the scale of the limits, so a backend reporting no capacity doesn't lock every user out
+    //
+    // Defaults to 0.1 if not specified
+    MinScale float64 `json:"min_scale,omitempty"`
+}
+
+type capacityReport struct {
+    scale     float64
+    expiresAt time.Time
+}
+
+// Capacity holds the capacity reported by the backends per endpoint, the rate limiter scales the MaxRequests of an
+// endpoint by it. Reports come from the responses of the backends, see CapacityConfig.Header, or from Report.
+type Capacity struct {
+    config CapacityConfig
+    now    func() time.Time
+
+    mu      sync.Mutex
+    reports map[string]capacityReport // Keyed by endpoint, AllEndpoints for the reports applying to every endpoint
+}
+
+// NewCapacity creates a Capacity with every endpoint at its nominal capacity.
+func NewCapacity(config CapacityConfig) *Capacity {
+    if config.Header == "" {
+        config.Header = "X-Backend-Capacity"
+    }
+    if config.TTL == 0 {
+        config.TTL = time.Minute
+    }
+    if config.MinScale == 0 {
+        config.MinScale = 0.1
+    }
+    return &Capacity{
+        config:  config,
+        now:     time.Now,
+        reports: make(map[string]capacityReport),
+    }
+}
+
+// Report sets the capacity of the endpoint, or of every endpoint with AllEndpoints, as a fraction of the nominal one
+// for TTL. It is the hook for the signals outside the responses, e.g. drop to 0.5 when the replica lag of the database
+// passes a threshold.
+func (c *Capacity) Report(endpoint string, scale float64) {
+    scale = min(max(scale, c.config.MinScale), 1)
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.reports[endpoint] = capacityReport{scale: scale, expiresAt: c.now().Add(c.config.TTL)}
+}
+
+// scale returns the lowest unexpired scale reported for the endpoint or every endpoint.
+func (c *Capacity) scale(endpoint string) float64 {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    now := c.now()
+    scale := 1.0
+    for _, k := range []string{endpoint, AllEndpoints} {
+        r, ok := c.reports[k]
+        if !ok {
+            continue
+        }
+        if !now.Before(r.expiresAt) {
+            delete(c.reports, k)
+            continue
+        }
+        scale = min(scale, r.scale)
+    }
+    return scale
+}
+
+// observe records the capacity reported in the response header and removes it.
+func (c *Capacity) observe(endpoint string, ctx *app.RequestContext) {
+    v := string(ctx.Response.Header.Peek(c.config.Header))
+    if v == "" {
+        return
+    }
+    ctx.Response.Header.Del(c.config.Header)
+    v = strings.TrimSpace(v)
+    divisor := 1.0
+    if strings.HasSuffix(v, "%") {
+        v, divisor = strings.TrimSuffix(v, "%"), 100
+    }
+    scale, err := strconv.ParseFloat(v, 64)
+    if err != nil || math.IsNaN(scale) {
+        return
+    }
+    c.Report(endpoint, scale/divisor)
+}
+
+// WithCapacity scales the limits of the endpoints by the capacity reported by their backends, e.g. a backend
+// answering with X-Backend-Capacity: 50% halves the MaxRequests of its endpoint until it reports again or the report
+// expires.
+func WithCapacity(capacity *Capacity) Option {
+    return func(rl *rateLimiter) {
+        rl.capacity = capacity
+    }
+}
+
+// scaleLimit applies the capacity of the endpoint to the configuration.
+func (rl *rateLimiter) scaleLimit(endpoint string, conf EndpointConfig) EndpointConfig {
+    if rl.capacity == nil {
+        return conf
+    }
+    if scale := rl.capacity.scale(endpoint); scale < 1 {
+        conf.MaxRequests = int(math.Ceil(float64(conf.MaxRequests) * scale))
+        conf.Windows = slices.Clone(conf.Windows)
+        for i, w := range conf.Windows {
+            conf.Windows[i].MaxRequests = int(math.Ceil(float64(w.MaxRequests) * scale))
+        }
+    }
+    return conf
+}
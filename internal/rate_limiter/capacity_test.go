@@ -0,0 +1,67 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "testing"
+    "time"
+)
+
+func TestCapacity(t *testing.T) {
+    now := time.Unix(1_700_000_000, 0)
+    c := NewCapacity(CapacityConfig{})
+    c.now = func() time.Time {
+        return now
+    }
+    if scale := c.scale("/api"); scale != 1 {
+        t.Fatalf("scale without report: %v, 1 expected", scale)
+    }
+    c.Report("/api", 0.5)
+    c.Report("/search", -1)
+    c.Report(AllEndpoints, 0.8)
+    // The lowest of the endpoint and every endpoint applies, floored by MinScale
+    for endpoint, scale := range map[string]float64{"/api": 0.5, "/search": 0.1, "/orders": 0.8} {
+        if s := c.scale(endpoint); s != scale {
+            t.Fatalf("scale of %s: %v, %v expected", endpoint, s, scale)
+        }
+    }
+    // The reports expire
+    now = now.Add(time.Minute)
+    if scale := c.scale("/api"); scale != 1 {
+        t.Fatalf("scale after the TTL: %v, 1 expected", scale)
+    }
+
+    for header, scale := range map[string]float64{"0.25": 0.25, " 40% ": 0.4, "200%": 1, "NaN": 1, "full": 1} {
+        c := NewCapacity(CapacityConfig{})
+        ctx := app.NewContext(0)
+        ctx.Response.Header.Set("X-Backend-Capacity", header)
+        c.observe("/api", ctx)
+        if s := c.scale("/api"); s != scale || ctx.Response.Header.Peek("X-Backend-Capacity") != nil {
+            t.Fatalf("observe of %q: scale %v, %v expected, and the header removed", header, s, scale)
+        }
+    }
+}
+
+func TestCapacityMiddleware(t *testing.T) {
+    config := RateLimiterConfig{"/api": {MaxRequests: 4, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    }, WithCapacity(NewCapacity(CapacityConfig{})))
+    defer rl.Close()
+
+    // The backend reports half its capacity with the first response, the limit of 4 drops to 2
+    for i, status := range []int{200, 200, 429} {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI("/api")
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        c.SetHandlers(app.HandlersChain{rl.Middleware, func(_ context.Context, c *app.RequestContext) {
+            c.Header("X-Backend-Capacity", "50%")
+            c.String(200, "ok")
+        }})
+        c.Next(context.Background())
+        if c.Response.StatusCode() != status || c.Response.Header.Peek("X-Backend-Capacity") != nil {
+            t.Fatalf("request %d: %d %s, %d without the capacity header expected", i, c.Response.StatusCode(), c.Response.Header.Header(), status)
+        }
+    }
+}
@@ -0,0 +1,116 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/logging"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+    "sync"
+    "time"
+)
+
+// serverTimeTimeout bounds the read of the server time, the request re-anchoring the clock waits for it.
+const serverTimeTimeout = 100 * time.Millisecond
+
+// MonotonicClock timestamps requests with the wall clock advanced by the monotonic clock, so an NTP step can't move
+// requests into a past window, where they would be under-counted, or skip windows ahead.
+//
+// The clock is re-anchored on the wall clock every resync interval so instances don't drift apart, only ever moving
+// forward: a wall clock stepped backward is ignored until it catches up again. The request re-anchoring the clock reads
+// the wall clock without holding the lock, the other requests keep counting from the previous anchor meanwhile.
+type MonotonicClock struct {
+    resync time.Duration
+    wall   func() (time.Time, error) // Reads the clock the anchors are taken on
+
+    mu      sync.Mutex
+    anchor  time.Time // Local reading carrying a monotonic reading
+    base    time.Time // Time of the wall clock at the anchor
+    syncing bool      // A request is reading the wall clock
+}
+
+// NewMonotonicClock creates a MonotonicClock re-anchored on the wall clock every resync interval.
+func NewMonotonicClock(resync time.Duration) *MonotonicClock {
+    return newMonotonicClock(resync, func() (time.Time, error) {
+        return time.Now(), nil
+    }, slog.Default())
+}
+
+// NewServerClock creates a MonotonicClock re-anchored on the clock of the store server every resync interval rather
+// than the wall clock, so instances with drifting clocks, e.g. containers on a host without NTP, agree on the windows.
+// The TTLs of the buckets are relative and already run on the server clock.
+//
+// The server time is read with a round trip, its midpoint is taken as the time of the reading. The wall clock is used
+// until the server answers, the error reading it is logged with logger, slog.Default() if nil.
+func NewServerClock(store ratelimiterstore.ServerClock, resync time.Duration, logger *slog.Logger) *MonotonicClock {
+    if logger == nil {
+        logger = slog.Default()
+    }
+    return newMonotonicClock(resync, func() (time.Time, error) {
+        ctx, cancel := context.WithTimeout(context.Background(), serverTimeTimeout)
+        defer cancel()
+        start := time.Now()
+        t, err := store.ServerTime(ctx)
+        if err != nil {
+            return time.Time{}, err
+        }
+        // The anchor is taken when the read started
+        return t.Add(-time.Since(start) / 2), nil
+    }, logger)
+}
+
+func newMonotonicClock(resync time.Duration, wall func() (time.Time, error), logger *slog.Logger) *MonotonicClock {
+    c := &MonotonicClock{
+        resync: resync,
+        wall:   wall,
+        anchor: time.Now(),
+    }
+    c.base = c.anchor
+    if base, err := wall(); err != nil {
+        logger.With(logging.ComponentKey, "rate_limiter").Warn("Error reading the clock, using the wall clock", "error", err)
+    } else {
+        c.base = base
+    }
+    return c
+}
+
+// Now returns the current time in UTC, never earlier than a previously returned time.
+func (c *MonotonicClock) Now() time.Time {
+    c.mu.Lock()
+    // time.Since uses the monotonic readings, so elapsed is unaffected by wall clock steps
+    elapsed := time.Since(c.anchor)
+    if elapsed < c.resync || c.syncing {
+        now := c.base.Add(elapsed)
+        c.mu.Unlock()
+        // Strip the monotonic reading, it is meaningless outside this process
+        return now.Round(0).UTC()
+    }
+    c.syncing = true
+    c.mu.Unlock()
+
+    // The server clock takes a round trip, don't hold up the other requests
+    start := time.Now()
+    wall, err := c.wall()
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.syncing = false
+    anchor := time.Now()
+    now := c.base.Add(anchor.Sub(c.anchor))
+    c.anchor, c.base = anchor, now
+    // The wall clock was read at start
+    if wall = wall.Add(anchor.Sub(start)); err == nil && wall.Round(0).After(now.Round(0)) {
+        c.base = wall
+        now = wall
+    }
+    // Otherwise the wall clock is behind or can't be read, keep counting from the previous anchor
+    return now.Round(0).UTC()
+}
+
+// WithClock sets the clock used to timestamp requests.
+//
+// Defaults to a MonotonicClock re-synced every minute if not specified
+func WithClock(now func() time.Time) Option {
+    return func(rl *rateLimiter) {
+        rl.now = now
+    }
+}
@@ -0,0 +1,169 @@
+package rate_limiter
+
+import (
+    "errors"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+    "sync"
+    "testing"
+    "time"
+)
+
+// steppedWall returns the readings in order, then the last one forever.
+func steppedWall(readings ...time.Time) func() (time.Time, error) {
+    return func() (time.Time, error) {
+        t := readings[0]
+        if len(readings) > 1 {
+            readings = readings[1:]
+        }
+        return t, nil
+    }
+}
+
+// checkClock reads the clock n times, failing if it goes back or returns a time outside UTC, and returns the readings.
+func checkClock(t *testing.T, c *MonotonicClock, n int) []time.Time {
+    t.Helper()
+    readings := make([]time.Time, n)
+    for i := range readings {
+        readings[i] = c.Now()
+        if readings[i].Location() != time.UTC {
+            t.Fatalf("reading %d is in %s, not UTC", i, readings[i].Location())
+        }
+        if i > 0 && readings[i].Before(readings[i-1]) {
+            t.Fatalf("reading %d at %s went back from %s", i, readings[i], readings[i-1])
+        }
+    }
+    return readings
+}
+
+// checkWindows fails if the windows of the readings are not aligned on UTC.
+func checkWindows(t *testing.T, readings []time.Time) {
+    t.Helper()
+    for _, interval := range []time.Duration{time.Second, time.Minute, time.Hour, 24 * time.Hour} {
+        for _, r := range readings {
+            start := ratelimiterstore.WindowStart(r, interval)
+            if start.Location() != time.UTC || start.UnixNano()%int64(interval) != 0 {
+                t.Fatalf("window of %s for %s starts at %s, not aligned on UTC", interval, r, start)
+            }
+            if r.Before(start) || !r.Before(start.Add(interval)) {
+                t.Fatalf("window of %s starting at %s doesn't hold %s", interval, start, r)
+            }
+        }
+    }
+}
+
+func TestMonotonicClockWallStepForward(t *testing.T) {
+    base := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+    // Resynced on every reading, the wall clock jumps an hour ahead on the second one
+    c := newMonotonicClock(0, steppedWall(base, base.Add(time.Hour)), slog.Default())
+    readings := checkClock(t, c, 5)
+    if readings[len(readings)-1].Before(base.Add(time.Hour)) {
+        t.Fatalf("clock at %s didn't follow the wall clock stepped to %s", readings[len(readings)-1], base.Add(time.Hour))
+    }
+    checkWindows(t, readings)
+}
+
+func TestMonotonicClockWallStepBackward(t *testing.T) {
+    base := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+    // The wall clock steps an hour back, then catches up with the time it left
+    c := newMonotonicClock(0, steppedWall(base, base.Add(-time.Hour), base.Add(-time.Minute), base.Add(time.Hour)), slog.Default())
+    readings := checkClock(t, c, 5)
+    if readings[1].Before(base) || readings[2].Before(base) {
+        t.Fatalf("clock followed the wall clock back: %v", readings)
+    }
+    if readings[len(readings)-1].Before(base.Add(time.Hour)) {
+        t.Fatalf("clock at %s didn't catch up with the wall clock at %s", readings[len(readings)-1], base.Add(time.Hour))
+    }
+    checkWindows(t, readings)
+}
+
+func TestMonotonicClockLeapSecond(t *testing.T) {
+    // A leap second repeats 23:59:59, the kernel steps the wall clock back a second at midnight
+    midnight := time.Date(2016, 12, 31, 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+    c := newMonotonicClock(0, steppedWall(
+        midnight.Add(-time.Second),
+        midnight.Add(-time.Second/2),
+        midnight.Add(-time.Second), // The repeated second
+        midnight.Add(-time.Second/2),
+        midnight,
+        midnight.Add(time.Second),
+    ), slog.Default())
+    readings := checkClock(t, c, 8)
+    checkWindows(t, readings)
+    // The requests of the repeated second are not moved back into the windows they already left
+    for _, r := range readings[2:] {
+        if r.Before(midnight.Add(-time.Second / 2)) {
+            t.Fatalf("reading %s went back into the repeated second", r)
+        }
+    }
+}
+
+func TestMonotonicClockSkewedZone(t *testing.T) {
+    // A wall clock read in another zone, e.g. a server clock parsed with its offset, gives the same windows
+    zone := time.FixedZone("UTC+5:30", 5*3600+1800)
+    base := time.Date(2025, 6, 1, 23, 59, 59, 0, zone)
+    c := newMonotonicClock(0, steppedWall(base, base.Add(time.Second)), slog.Default())
+    readings := checkClock(t, c, 4)
+    checkWindows(t, readings)
+    if day := ratelimiterstore.WindowStart(readings[len(readings)-1], 24*time.Hour); !day.Equal(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)) {
+        t.Fatalf("day window starts at %s, not midnight UTC", day)
+    }
+}
+
+func TestMonotonicClockWallError(t *testing.T) {
+    base := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+    failing := false
+    c := newMonotonicClock(0, func() (time.Time, error) {
+        if failing {
+            return time.Time{}, errors.New("server unavailable")
+        }
+        return base, nil
+    }, slog.Default())
+    failing = true
+    // The clock keeps counting on the monotonic clock from the last anchor
+    readings := checkClock(t, c, 3)
+    if readings[0].Before(base) {
+        t.Fatalf("clock at %s went back from the anchor at %s", readings[0], base)
+    }
+}
+
+func TestMonotonicClockSlowWallDoesNotBlock(t *testing.T) {
+    base := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+    reading, release := make(chan struct{}), make(chan struct{})
+    c := newMonotonicClock(0, steppedWall(base), slog.Default())
+    // The next reading is a round trip to a slow server
+    var slow sync.Once
+    c.wall = func() (time.Time, error) {
+        slow.Do(func() {
+            reading <- struct{}{}
+            <-release
+        })
+        return base.Add(time.Hour), nil
+    }
+    resynced := make(chan time.Time)
+    go func() {
+        resynced <- c.Now()
+    }()
+    <-reading
+    // The other requests count from the previous anchor while the wall clock is read
+    done := make(chan []time.Time)
+    go func() {
+        done <- []time.Time{c.Now(), c.Now(), c.Now()}
+    }()
+    var readings []time.Time
+    select {
+    case readings = <-done:
+    case <-time.After(time.Second):
+        t.Fatal("clock blocked on the wall clock read by another request")
+    }
+    if readings[0].Before(base) || readings[1].Before(readings[0]) || readings[2].Before(readings[1]) || !readings[2].Before(base.Add(time.Hour)) {
+        t.Fatalf("readings %v not counted from the previous anchor at %s", readings, base)
+    }
+    close(release)
+    if now := <-resynced; now.Before(base.Add(time.Hour)) {
+        t.Fatalf("clock at %s didn't follow the wall clock read at %s", now, base.Add(time.Hour))
+    }
+    if now := c.Now(); now.Before(readings[2]) {
+        t.Fatalf("clock at %s went back from %s", now, readings[2])
+    }
+}
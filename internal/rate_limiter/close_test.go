@@ -0,0 +1,40 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "go.uber.org/goleak"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// Close closes the default store and the stores selected by name, none of their goroutines outlive the rate limiter.
+func TestRateLimiterCloseLeavesNoGoroutine(t *testing.T) {
+    mr := miniredis.RunT(t)
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    ctx := context.Background()
+    sqlite, err := ratelimiterstore.NewSQLiteStore(ctx, ratelimiterstore.SQLiteConfig{Path: filepath.Join(t.TempDir(), "ratelimiter.db")})
+    if err != nil {
+        t.Fatalf("NewSQLiteStore: %v", err)
+    }
+    redis, err := ratelimiterstore.NewRedisStore(ctx, mr.Addr(), 100)
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    config := RateLimiterConfig{
+        "/local":  {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+        "/shared": {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second, Store: "shared"},
+    }
+    // The default store is selected by name too, it is closed once
+    rl := NewRateLimiter(config, sqlite, nil, WithStores(map[string]ratelimiterstore.Store{"shared": redis, "default": sqlite}))
+    for endpoint := range config {
+        if _, err := rl.AllowRequest(ctx, endpoint, "user"); err != nil {
+            t.Fatalf("AllowRequest %s: %v", endpoint, err)
+        }
+    }
+    if err := rl.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+}
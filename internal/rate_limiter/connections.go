@@ -0,0 +1,171 @@
+package rate_limiter
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha1"
+    "encoding/base64"
+    "encoding/binary"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/network"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "math"
+    "strconv"
+    "sync"
+    "time"
+)
+
+// websocketGUID is appended to the key of a handshake to compute its accept value, see RFC 6455.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocketTryAgainLater is the close code of a server asking the client to reconnect later, see RFC 6455.
+const websocketTryAgainLater = 1013
+
+type ConnectionConfig struct {
+    // Rate limits the establishment of the WebSocket and SSE connections of a user to an endpoint, in a budget
+    // separate from the other requests of the endpoint
+    //
+    // Defaults to the budget of the endpoint if not specified
+    Rate *EndpointConfig `json:"rate,omitempty"`
+    // MaxConcurrent long-lived connections of a user to an endpoint, counted per process
+    //
+    // Defaults to 0 if not specified, no limit
+    MaxConcurrent int `json:"max_concurrent,omitempty"`
+    // RetryAfter is the delay hinted to the clients whose connection is refused
+    //
+    // Defaults to 30 seconds if not specified
+    RetryAfter time.Duration `json:"retry_after,omitempty"`
+}
+
+type connectionKind int
+
+const (
+    notLongLived connectionKind = iota
+    websocketConnection
+    sseConnection
+)
+
+type connections struct {
+    config ConnectionConfig
+
+    mu   sync.Mutex
+    open map[string]int // Open connections, keyed by user and endpoint
+}
+
+// WithConnectionLimits limits the WebSocket upgrades and the SSE requests: their establishment rate and the number of
+// connections a user holds open at once.
+//
+// Refused connections get a hint of when to retry that their clients follow: a WebSocket is upgraded then closed
+// with the 1013 Try Again Later code, an SSE stream gets a retry field so EventSource reconnects after the delay, both
+// with a Retry-After header.
+func WithConnectionLimits(config ConnectionConfig) Option {
+    return func(rl *rateLimiter) {
+        if config.RetryAfter == 0 {
+            config.RetryAfter = 30 * time.Second
+        }
+        rl.connections = &connections{
+            config: config,
+            open:   make(map[string]int),
+        }
+    }
+}
+
+// kind tells the long-lived connections apart from the other requests.
+func (cl *connections) kind(c *app.RequestContext) connectionKind {
+    switch {
+    case bytes.EqualFold(c.GetHeader("Upgrade"), []byte("websocket")) && len(c.GetHeader("Sec-WebSocket-Key")) > 0:
+        return websocketConnection
+    case bytes.Contains(c.GetHeader("Accept"), []byte("text/event-stream")):
+        return sseConnection
+    default:
+        return notLongLived
+    }
+}
+
+// acquire takes a connection slot of the user at the endpoint, it reports false if they are all taken.
+func (cl *connections) acquire(key string) bool {
+    cl.mu.Lock()
+    defer cl.mu.Unlock()
+    if cl.config.MaxConcurrent > 0 && cl.open[key] >= cl.config.MaxConcurrent {
+        return false
+    }
+    cl.open[key]++
+    return true
+}
+
+func (cl *connections) release(key string) {
+    cl.mu.Lock()
+    defer cl.mu.Unlock()
+    if cl.open[key]--; cl.open[key] <= 0 {
+        delete(cl.open, key)
+    }
+}
+
+// serve applies the connection limits to a long-lived connection and runs the handlers if it is allowed.
+func (cl *connections) serve(ctx context.Context, rl *rateLimiter, c *app.RequestContext, kind connectionKind, endpoint, userId string, info requestInfo) {
+    if cl.config.Rate != nil {
+        info.budget, info.limit = "connect "+endpoint, cl.config.Rate
+    }
+    key := userId + "#" + endpoint
+    // The slot is taken first, so a connection refused for the slots doesn't consume the rate budget
+    if !cl.acquire(key) {
+        cl.refuse(c, kind)
+        c.Abort()
+        return
+    }
+    if d, _ := rl.allowRequest(ctx, endpoint, userId, info); !d.Allowed {
+        cl.release(key)
+        cl.refuse(c, kind)
+        c.Abort()
+        return
+    }
+    c.Next(ctx)
+    if handler := c.GetHijackHandler(); handler != nil {
+        // A WebSocket lives in the hijack handler, which runs once the handlers returned and the upgrade was sent
+        c.Hijack(func(conn network.Conn) {
+            defer cl.release(key)
+            handler(conn)
+        })
+        return
+    }
+    // An SSE stream lives in the handler
+    cl.release(key)
+}
+
+// refuse answers a refused connection with a hint of when to retry.
+func (cl *connections) refuse(c *app.RequestContext, kind connectionKind) {
+    retryAfter := cl.config.RetryAfter
+    c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+    switch kind {
+    case websocketConnection:
+        // Browsers hide the status of a failed handshake from the page, upgrade then close with a reason it can read
+        h := sha1.Sum(append(c.GetHeader("Sec-WebSocket-Key"), websocketGUID...))
+        c.Header("Upgrade", "websocket")
+        c.Header("Connection", "Upgrade")
+        c.Header("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(h[:]))
+        c.Status(consts.StatusSwitchingProtocols)
+        frame := closeFrame(websocketTryAgainLater, fmt.Sprintf("Rate limit exceeded, retry after %s", retryAfter))
+        c.Hijack(func(conn network.Conn) {
+            _, _ = conn.Write(frame)
+            _ = conn.Flush()
+        })
+    case sseConnection:
+        // EventSource gives up on an error status but reconnects after the retry delay of a stream that ended
+        // c.String would set a text/plain content type, which EventSource rejects
+        c.Data(consts.StatusOK, "text/event-stream", []byte(fmt.Sprintf("retry: %d\n\n", retryAfter.Milliseconds())))
+    }
+}
+
+// closeFrame builds an unmasked WebSocket close frame, as sent by a server. The reason is truncated to the 123 bytes a
+// control frame can hold besides the code.
+func closeFrame(code uint16, reason string) []byte {
+    if len(reason) > 123 {
+        reason = reason[:123]
+    }
+    frame := make([]byte, 4, 4+len(reason))
+    frame[0] = 0x88 // FIN and the close opcode
+    frame[1] = byte(2 + len(reason))
+    binary.BigEndian.PutUint16(frame[2:], code)
+    return append(frame, reason...)
+}
@@ -0,0 +1,73 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/route"
+    "testing"
+    "time"
+)
+
+// A stream refused for its slots doesn't consume the rate budget, and is told when to retry in a form EventSource
+// follows.
+func TestConnectionLimitsSSE(t *testing.T) {
+    rl := NewRateLimiter(RateLimiterConfig{"/events": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+        ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+            return string(path)
+        }, WithConnectionLimits(ConnectionConfig{MaxConcurrent: 1, RetryAfter: 1500 * time.Millisecond}))
+    defer rl.Close()
+    started, stop := make(chan struct{}), make(chan struct{})
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.GET("/events", rl.Middleware, func(_ context.Context, c *app.RequestContext) {
+        started <- struct{}{}
+        <-stop
+        c.Data(200, "text/event-stream", []byte("data: done\n\n"))
+    })
+    stream := func() *protocol.Response {
+        return ut.PerformRequest(engine, "GET", "/events", nil,
+            ut.Header{Key: "Accept", Value: "text/event-stream"}, ut.Header{Key: "X-Forwarded-For", Value: "10.0.0.1"}).Result()
+    }
+
+    // open runs a stream until stop is closed, once the handler started
+    done := make(chan *protocol.Response, 1)
+    open := func() {
+        t.Helper()
+        go func() {
+            done <- stream()
+        }()
+        select {
+        case <-started:
+        case resp := <-done:
+            t.Fatalf("stream refused: %q", resp.Body())
+        }
+    }
+    open()
+    for range 3 {
+        resp := stream()
+        if resp.StatusCode() != 200 || string(resp.Header.ContentType()) != "text/event-stream" || string(resp.Body()) != "retry: 1500\n\n" {
+            t.Fatalf("refused stream: %d %s %q", resp.StatusCode(), resp.Header.ContentType(), resp.Body())
+        }
+        if retryAfter := string(resp.Header.Peek("Retry-After")); retryAfter != "2" {
+            t.Fatalf("Retry-After %q, 2 expected", retryAfter)
+        }
+    }
+    close(stop)
+    if resp := <-done; string(resp.Body()) != "data: done\n\n" {
+        t.Fatalf("first stream %q", resp.Body())
+    }
+
+    // The refused streams left the second request of the budget
+    open()
+    <-done
+    if resp := stream(); string(resp.Body()) != "retry: 1500\n\n" {
+        t.Fatalf("third stream %q, refused by the rate expected", resp.Body())
+    }
+    // The stream refused by the rate gave its slot back
+    if open := rl.(*rateLimiter).connections.open; len(open) != 0 {
+        t.Fatalf("open connections %v after the streams ended", open)
+    }
+}
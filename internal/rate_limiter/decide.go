@@ -0,0 +1,113 @@
+package rate_limiter
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "time"
+)
+
+// DecidePath is the path of the decision protocol, e.g. h.POST(ratelimiter.DecidePath, handler).
+const DecidePath = "/v1/decide"
+
+type DecideConfig struct {
+    // MaxDescriptors is the most descriptors of one request, larger batches are rejected with 400
+    //
+    // Defaults to 100 if not specified
+    MaxDescriptors int `json:"max_descriptors,omitempty"`
+}
+
+// DecideRequest is the body of a decision request, one decision is made per descriptor.
+type DecideRequest struct {
+    Descriptors []Descriptor `json:"descriptors"`
+}
+
+// Descriptor is a request to decide on, as the limiter would see it in the middleware.
+type Descriptor struct {
+    Endpoint string `json:"endpoint"`
+    UserId   string `json:"user_id"`
+    // Cost is the number of items of a batch request, see WithBatches
+    //
+    // Defaults to 1 if not specified
+    Cost int64 `json:"cost,omitempty"`
+    // RequestId is the id of the request, with WithDeduplication a retry of a request already counted under it is
+    // allowed without being counted again
+    RequestId string `json:"request_id,omitempty"`
+}
+
+// DecideResponse is the body of the reply, the decisions are in the order of the descriptors.
+type DecideResponse struct {
+    // Allowed is whether every descriptor is allowed
+    Allowed   bool                 `json:"allowed"`
+    Decisions []DescriptorDecision `json:"decisions"`
+}
+
+// DescriptorDecision is the Decision of a descriptor with the durations in seconds, rounded up.
+type DescriptorDecision struct {
+    Allowed   bool  `json:"allowed"`
+    Limit     int64 `json:"limit,omitempty"`
+    Remaining int64 `json:"remaining,omitempty"`
+    // Reset is the number of seconds until the budget frees requests, 0 if unknown
+    Reset int64 `json:"reset,omitempty"`
+    // RetryAfter is the number of seconds a rejected user should wait, 0 if allowed or unknown
+    RetryAfter int64 `json:"retry_after,omitempty"`
+    // Error is set when the store failed, the decision then follows the store error policy of the endpoint
+    Error string `json:"error,omitempty"`
+}
+
+// NewDecideHandler serves the decision protocol, so edge workers and services in other languages consult the limiter
+// in one round trip: a DecideRequest is posted as JSON and answered with a DecideResponse.
+//
+// The descriptors are decided one after the other and each is counted if allowed, a batch is not all or nothing.
+func NewDecideHandler(limiter RateLimiter, config DecideConfig) (app.HandlerFunc, error) {
+    rl, ok := limiter.(*rateLimiter)
+    if !ok {
+        return nil, fmt.Errorf("rate limiter %T was not created by NewRateLimiter", limiter)
+    }
+    if config.MaxDescriptors == 0 {
+        config.MaxDescriptors = 100
+    }
+    return func(ctx context.Context, c *app.RequestContext) {
+        var req DecideRequest
+        if err := json.Unmarshal(c.Request.Body(), &req); err != nil {
+            c.AbortWithStatusJSON(consts.StatusBadRequest, utils.H{"error": "Invalid decision request: " + err.Error()})
+            return
+        }
+        if len(req.Descriptors) == 0 || len(req.Descriptors) > config.MaxDescriptors {
+            c.AbortWithStatusJSON(consts.StatusBadRequest, utils.H{"error": fmt.Sprintf("Expected 1 to %d descriptors", config.MaxDescriptors)})
+            return
+        }
+        for i, desc := range req.Descriptors {
+            if desc.Endpoint == "" || desc.UserId == "" || desc.Cost < 0 {
+                c.AbortWithStatusJSON(consts.StatusBadRequest, utils.H{"error": fmt.Sprintf("Descriptor %d needs an endpoint, a user_id and a positive cost", i)})
+                return
+            }
+        }
+        resp := DecideResponse{Allowed: true, Decisions: make([]DescriptorDecision, len(req.Descriptors))}
+        for i, desc := range req.Descriptors {
+            info := requestInfo{cost: desc.Cost, detail: true}
+            if rl.dedupHeader != "" {
+                info.requestId = desc.RequestId
+            }
+            d, err := rl.allowRequest(ctx, desc.Endpoint, desc.UserId, info)
+            dd := DescriptorDecision{
+                Allowed:    d.Allowed,
+                Limit:      d.Limit,
+                Remaining:  d.Remaining,
+                RetryAfter: seconds(d.RetryAfter),
+            }
+            if !d.ResetAt.IsZero() {
+                dd.Reset = seconds(max(d.ResetAt.Sub(rl.now()), time.Duration(0)))
+            }
+            if err != nil {
+                dd.Error = err.Error()
+            }
+            resp.Decisions[i] = dd
+            resp.Allowed = resp.Allowed && d.Allowed
+        }
+        c.JSON(consts.StatusOK, resp)
+    }, nil
+}
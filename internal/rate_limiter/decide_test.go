@@ -0,0 +1,100 @@
+package rate_limiter
+
+import (
+    "bytes"
+    "encoding/json"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "testing"
+    "time"
+)
+
+func newDecideEngine(t *testing.T, opts ...Option) *route.Engine {
+    t.Helper()
+    rl := NewRateLimiter(RateLimiterConfig{"/api": {MaxRequests: 3, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+        ratelimiterstore.NewMemoryStore(), nil, opts...)
+    t.Cleanup(func() {
+        _ = rl.Close()
+    })
+    handler, err := NewDecideHandler(rl, DecideConfig{MaxDescriptors: 3})
+    if err != nil {
+        t.Fatalf("NewDecideHandler: %v", err)
+    }
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.POST(DecidePath, handler)
+    return engine
+}
+
+func decide(t *testing.T, engine *route.Engine, body string) (int, DecideResponse) {
+    t.Helper()
+    resp := ut.PerformRequest(engine, "POST", DecidePath, &ut.Body{Body: bytes.NewBufferString(body), Len: len(body)}).Result()
+    var decided DecideResponse
+    if resp.StatusCode() == 200 {
+        if err := json.Unmarshal(resp.Body(), &decided); err != nil {
+            t.Fatalf("response %s: %v", resp.Body(), err)
+        }
+    }
+    return resp.StatusCode(), decided
+}
+
+func TestDecideHandler(t *testing.T) {
+    engine := newDecideEngine(t)
+    status, resp := decide(t, engine, `{"descriptors":[{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"ada"}]}`)
+    if status != 200 || !resp.Allowed || len(resp.Decisions) != 2 || resp.Decisions[0].Limit != 3 ||
+        resp.Decisions[0].Remaining != 2 || resp.Decisions[1].Remaining != 1 {
+        t.Fatalf("first batch: %d %+v", status, resp)
+    }
+
+    // The descriptors are decided one by one, the batch isn't all or nothing
+    status, resp = decide(t, engine, `{"descriptors":[{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"grace"}]}`)
+    if status != 200 || resp.Allowed || !resp.Decisions[0].Allowed || resp.Decisions[1].Allowed || !resp.Decisions[2].Allowed {
+        t.Fatalf("second batch: %d %+v", status, resp)
+    }
+    if d := resp.Decisions[1]; d.RetryAfter < 1 || d.RetryAfter > 60 || d.Error != "" {
+        t.Fatalf("rejected descriptor %+v, a retry after of 1 to 60 seconds expected", d)
+    }
+    // The endpoints not limited are allowed
+    if status, resp := decide(t, engine, `{"descriptors":[{"endpoint":"/healthz","user_id":"ada"}]}`); status != 200 || !resp.Allowed {
+        t.Fatalf("endpoint not limited: %d %+v", status, resp)
+    }
+}
+
+func TestDecideHandlerRejects(t *testing.T) {
+    engine := newDecideEngine(t)
+    for _, body := range []string{
+        `{"descriptors":`,
+        `{"descriptors":[]}`,
+        `{"descriptors":[{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"ada"},{"endpoint":"/api","user_id":"ada"}]}`,
+        `{"descriptors":[{"endpoint":"/api"}]}`,
+        `{"descriptors":[{"user_id":"ada"}]}`,
+        `{"descriptors":[{"endpoint":"/api","user_id":"ada","cost":-1}]}`,
+    } {
+        if status, _ := decide(t, engine, body); status != 400 {
+            t.Fatalf("%s: %d, 400 expected", body, status)
+        }
+    }
+    // None was counted
+    if _, resp := decide(t, engine, `{"descriptors":[{"endpoint":"/api","user_id":"ada"}]}`); resp.Decisions[0].Remaining != 2 {
+        t.Fatalf("decision after the invalid requests: %+v, 2 remaining expected", resp)
+    }
+
+    if _, err := NewDecideHandler(nil, DecideConfig{}); err == nil {
+        t.Fatalf("NewDecideHandler of a limiter not created by NewRateLimiter: no error")
+    }
+}
+
+func TestDecideHandlerDeduplicates(t *testing.T) {
+    engine := newDecideEngine(t, WithDeduplication("Idempotency-Key", time.Minute))
+    for i := range 3 {
+        status, resp := decide(t, engine, `{"descriptors":[{"endpoint":"/api","user_id":"ada","request_id":"order-1"}]}`)
+        if status != 200 || !resp.Allowed {
+            t.Fatalf("retry %d: %d %+v", i, status, resp)
+        }
+    }
+    // The retries were counted once
+    if _, resp := decide(t, engine, `{"descriptors":[{"endpoint":"/api","user_id":"ada"}]}`); resp.Decisions[0].Remaining != 1 {
+        t.Fatalf("decision after the retries: %+v, 1 remaining expected", resp)
+    }
+}
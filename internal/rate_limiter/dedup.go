@@ -0,0 +1,46 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+    "time"
+)
+
+// WithDeduplication counts the requests carrying the same id in the header once, e.g. Idempotency-Key or X-Request-Id,
+// so automatic client retries during an incident don't consume the budget of the user twice. An id is remembered for
+// ttl after its request was allowed, retries of a rejected request are still limited.
+//
+// It requires a store implementing ratelimiterstore.Deduplicator, and is ignored for the endpoints using other stores.
+func WithDeduplication(header string, ttl time.Duration) Option {
+    return func(rl *rateLimiter) {
+        rl.dedupHeader = header
+        rl.dedupTTL = ttl
+    }
+}
+
+// isRetry reports whether the request id was already counted for the key in the store.
+func (rl *rateLimiter) isRetry(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, requestId string) bool {
+    dedup, ok := store.(ratelimiterstore.Deduplicator)
+    if !ok || requestId == "" {
+        return false
+    }
+    seen, err := dedup.Seen(ctx, key, requestId)
+    if err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error retrieving request id", "endpoint", key.Endpoint, "error", err)
+        // Count the request, a retry counted twice is better than an uncounted request
+        return false
+    }
+    return seen
+}
+
+// markCounted records the request id was counted for the key in the store.
+func (rl *rateLimiter) markCounted(ctx context.Context, store ratelimiterstore.Store, key ratelimiterstore.RateLimiterKey, requestId string) {
+    dedup, ok := store.(ratelimiterstore.Deduplicator)
+    if !ok || requestId == "" {
+        return
+    }
+    if err := dedup.MarkSeen(ctx, key, requestId, rl.dedupTTL); err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error recording request id", "endpoint", key.Endpoint, "error", err)
+    }
+}
@@ -0,0 +1,64 @@
+package rate_limiter
+
+import (
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/route"
+    "maps"
+    "slices"
+)
+
+type DiscoveryConfig struct {
+    // ApplyDefault configures the discovered endpoints without a limit with Default instead of leaving them unlimited
+    ApplyDefault bool `json:"apply_default,omitempty"`
+    // Default is the configuration applied to the endpoints without a limit
+    //
+    // Defaults to DefaultEndpointConfig() if not specified
+    Default *EndpointConfig `json:"default,omitempty"`
+}
+
+// DiscoverEndpoints maps the routes registered on the Hertz router, e.g. h.Routes(), to their endpoints with the
+// SanitizerFunc of the rate limiter and returns the endpoints without a limit, warning about each of them. Call it once
+// the routes are registered, before h.Spin.
+//
+// With ApplyDefault, the endpoints without a limit are added to the configuration with the default one. A later
+// UpdateConfig replaces them like the rest of the configuration.
+func DiscoverEndpoints(limiter RateLimiter, routes route.RoutesInfo, config DiscoveryConfig) ([]string, error) {
+    rl, ok := limiter.(*rateLimiter)
+    if !ok {
+        return nil, fmt.Errorf("rate limiter %T was not created by NewRateLimiter", limiter)
+    }
+    current := *rl.config.Load()
+    missing := make(map[string]struct{})
+    for _, r := range routes {
+        endpoint := r.Path
+        if rl.pathSanitizer != nil {
+            endpoint = rl.pathSanitizer([]byte(r.Path))
+        }
+        if _, ok := current[endpoint]; ok {
+            continue
+        }
+        if _, ok := missing[endpoint]; !ok {
+            rl.logger.Warn("Route has no rate limit", "method", r.Method, "route", r.Path, "endpoint", endpoint)
+        }
+        missing[endpoint] = struct{}{}
+    }
+    endpoints := slices.Sorted(maps.Keys(missing))
+    if !config.ApplyDefault || len(endpoints) == 0 {
+        return endpoints, nil
+    }
+
+    conf := DefaultEndpointConfig()
+    if config.Default != nil {
+        conf = *config.Default
+    }
+    updated := make(RateLimiterConfig, len(current)+len(endpoints))
+    maps.Copy(updated, current)
+    for _, endpoint := range endpoints {
+        updated[endpoint] = conf
+    }
+    if err := updated.Validate(); err != nil {
+        return endpoints, fmt.Errorf("failed to apply the default configuration: %w", err)
+    }
+    rl.UpdateConfig(updated)
+    return endpoints, nil
+}
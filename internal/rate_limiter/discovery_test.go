@@ -0,0 +1,72 @@
+package rate_limiter
+
+import (
+    "bytes"
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/route"
+    "log/slog"
+    "slices"
+    "strings"
+    "testing"
+    "time"
+)
+
+func newRoutes() route.RoutesInfo {
+    engine := route.NewEngine(config.NewOptions(nil))
+    handler := func(context.Context, *app.RequestContext) {}
+    engine.GET("/api", handler)
+    engine.GET("/orders", handler)
+    engine.POST("/orders", handler)
+    engine.GET("/Search", handler)
+    return engine.Routes()
+}
+
+func TestDiscoverEndpoints(t *testing.T) {
+    var logs bytes.Buffer
+    config := RateLimiterConfig{"/api": {MaxRequests: 1, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return strings.ToLower(string(path))
+    }, WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+    defer rl.Close()
+
+    // The routes are mapped to their endpoints by the sanitizer, each endpoint is warned about once
+    endpoints, err := DiscoverEndpoints(rl, newRoutes(), DiscoveryConfig{})
+    if err != nil || !slices.Equal(endpoints, []string{"/orders", "/search"}) {
+        t.Fatalf("DiscoverEndpoints: %v, %v, /orders and /search expected", endpoints, err)
+    }
+    if warnings := strings.Count(logs.String(), "Route has no rate limit"); warnings != 2 {
+        t.Fatalf("%d warnings, 2 expected:\n%s", warnings, logs.String())
+    }
+    // They are left unlimited
+    if _, ok := (*rl.(*rateLimiter).config.Load())["/orders"]; ok {
+        t.Fatalf("endpoint configured without ApplyDefault")
+    }
+}
+
+func TestDiscoverEndpointsApplyDefault(t *testing.T) {
+    config := RateLimiterConfig{"/api": {MaxRequests: 1, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), nil)
+    defer rl.Close()
+    conf := EndpointConfig{MaxRequests: 5, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}
+    if _, err := DiscoverEndpoints(rl, newRoutes(), DiscoveryConfig{ApplyDefault: true, Default: &conf}); err != nil {
+        t.Fatalf("DiscoverEndpoints: %v", err)
+    }
+    current := *rl.(*rateLimiter).config.Load()
+    if current["/orders"].MaxRequests != 5 || current["/Search"].MaxRequests != 5 || current["/api"].MaxRequests != 1 {
+        t.Fatalf("configuration %+v, the default applied to the endpoints without a limit only expected", current)
+    }
+
+    // An invalid default leaves the configuration as it was
+    rl = NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), nil)
+    defer rl.Close()
+    invalid := EndpointConfig{MaxRequests: 5, TimeWindow: time.Second, SlidingWindowInterval: time.Minute}
+    if _, err := DiscoverEndpoints(rl, newRoutes(), DiscoveryConfig{ApplyDefault: true, Default: &invalid}); err == nil {
+        t.Fatalf("DiscoverEndpoints with an invalid default: no error")
+    }
+    if current := *rl.(*rateLimiter).config.Load(); len(current) != 1 {
+        t.Fatalf("configuration %+v after an invalid default", current)
+    }
+}
@@ -0,0 +1,74 @@
+package echomw
+
+import (
+    "context"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/labstack/echo/v4"
+)
+
+// IdentityFunc returns the user a request is counted for, e.g. from the claims echo-jwt sets in the context, or "" to
+// count it for its client IP.
+type IdentityFunc func(c echo.Context) string
+
+type Option func(*middleware)
+
+// WithIdentity counts the requests per identity, like ratelimiter.WithIdentity does for the Hertz middleware.
+func WithIdentity(identity IdentityFunc) Option {
+    return func(m *middleware) {
+        m.identity = identity
+    }
+}
+
+type middleware struct {
+    limiter  ratelimiter.RateLimiter
+    identity IdentityFunc // Nil to count the requests per client IP
+}
+
+// Middleware is the rate limiter middleware for Echo, e.g. e.Use(echomw.Middleware(limiter)), with the same limits as
+// its HTTPMiddleware.
+func Middleware(limiter ratelimiter.RateLimiter, opts ...Option) echo.MiddlewareFunc {
+    m := &middleware{limiter: limiter}
+    for _, opt := range opts {
+        opt(m)
+    }
+    return func(next echo.HandlerFunc) echo.HandlerFunc {
+        return func(c echo.Context) error {
+            req := c.Request()
+            if !m.limiter.Handle(req.Context(), response{c: c}, request{Request: ratelimiter.NewHTTPRequest(req), c: c, identity: m.identity}) {
+                return nil
+            }
+            return next(c)
+        }
+    }
+}
+
+// request is read like the net/http one but for the client IP and the identity.
+type request struct {
+    ratelimiter.Request
+    c        echo.Context
+    identity IdentityFunc
+}
+
+// ClientIP honors the IPExtractor of the Echo server.
+func (r request) ClientIP() string {
+    return r.c.RealIP()
+}
+
+func (r request) Identity(context.Context) (string, error) {
+    if r.identity == nil {
+        return "", nil
+    }
+    return r.identity(r.c), nil
+}
+
+type response struct {
+    c echo.Context
+}
+
+func (r response) SetHeader(key, value string) {
+    r.c.Response().Header().Set(key, value)
+}
+
+func (r response) WriteJSON(status int, body map[string]any) {
+    _ = r.c.JSON(status, body)
+}
@@ -0,0 +1,42 @@
+package echomw
+
+import (
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/labstack/echo/v4"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+// The requests over the limit are answered with 429 before reaching the handler, per identity.
+func TestMiddleware(t *testing.T) {
+    config := ratelimiter.RateLimiterConfig{"/ping": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    limiter := ratelimiter.NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    })
+    defer limiter.Close()
+    e := echo.New()
+    e.Use(Middleware(limiter, WithIdentity(func(c echo.Context) string {
+        return c.Request().Header.Get("X-User")
+    })))
+    e.GET("/ping", func(c echo.Context) error {
+        return c.String(http.StatusOK, "pong")
+    })
+    status := func(user string) int {
+        req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+        req.Header.Set("X-User", user)
+        rec := httptest.NewRecorder()
+        e.ServeHTTP(rec, req)
+        return rec.Code
+    }
+    for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+        if got := status("alice"); got != want {
+            t.Fatalf("request %d of alice answered %d, %d expected", i, got, want)
+        }
+    }
+    if got := status("bob"); got != http.StatusOK {
+        t.Fatalf("request of bob answered %d, %d expected", got, http.StatusOK)
+    }
+}
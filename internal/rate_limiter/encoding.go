@@ -0,0 +1,65 @@
+package rate_limiter
+
+import (
+    "encoding/json"
+    "maps"
+    "reflect"
+    "strings"
+    "sync"
+)
+
+// endpointConfigFields returns the JSON names of the fields of EndpointConfig.
+var endpointConfigFields = sync.OnceValue(func() map[string]struct{} {
+    t := reflect.TypeFor[EndpointConfig]()
+    fields := make(map[string]struct{}, t.NumField())
+    for i := range t.NumField() {
+        name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+        if name != "" && name != "-" {
+            fields[name] = struct{}{}
+        }
+    }
+    return fields
+})
+
+// UnmarshalJSON decodes the configuration and keeps the fields it doesn't know in Unknown, e.g. fields added by a newer
+// version of the control plane, so they survive a round trip through an instance not upgraded yet.
+func (c *EndpointConfig) UnmarshalJSON(data []byte) error {
+    type plain EndpointConfig
+    var decoded plain
+    if err := json.Unmarshal(data, &decoded); err != nil {
+        return err
+    }
+    var fields map[string]json.RawMessage
+    if err := json.Unmarshal(data, &fields); err != nil {
+        return err
+    }
+    maps.DeleteFunc(fields, func(name string, _ json.RawMessage) bool {
+        _, known := endpointConfigFields()[name]
+        return known
+    })
+    decoded.Unknown = nil
+    if len(fields) > 0 {
+        decoded.Unknown = fields
+    }
+    *c = EndpointConfig(decoded)
+    return nil
+}
+
+// MarshalJSON encodes the configuration with the fields kept in Unknown, the known fields win over them.
+func (c EndpointConfig) MarshalJSON() ([]byte, error) {
+    type plain EndpointConfig
+    data, err := json.Marshal(plain(c))
+    if err != nil || len(c.Unknown) == 0 {
+        return data, err
+    }
+    var fields map[string]json.RawMessage
+    if err = json.Unmarshal(data, &fields); err != nil {
+        return nil, err
+    }
+    for name, value := range c.Unknown {
+        if _, ok := fields[name]; !ok {
+            fields[name] = value
+        }
+    }
+    return json.Marshal(fields)
+}
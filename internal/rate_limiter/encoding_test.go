@@ -0,0 +1,43 @@
+package rate_limiter
+
+import (
+    "encoding/json"
+    "testing"
+    "time"
+)
+
+// A configuration from a newer control plane goes through an instance not upgraded yet without losing its new fields.
+func TestEndpointConfigKeepsUnknownFields(t *testing.T) {
+    data := []byte(`{"max_requests":5,"time_window":60000000000,"sliding_window_interval":1000000000,"burst":{"size":10},"max_requests_per_key":2}`)
+    var conf EndpointConfig
+    if err := json.Unmarshal(data, &conf); err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    if conf.MaxRequests != 5 || conf.TimeWindow != time.Minute || conf.SlidingWindowInterval != time.Second {
+        t.Fatalf("known fields %+v", conf)
+    }
+    if len(conf.Unknown) != 2 || string(conf.Unknown["burst"]) != `{"size":10}` || string(conf.Unknown["max_requests_per_key"]) != "2" {
+        t.Fatalf("unknown fields %v", conf.Unknown)
+    }
+
+    // The known fields updated since win over the unknown ones
+    conf.MaxRequests = 3
+    conf.Unknown["max_requests"] = json.RawMessage("100")
+    encoded, err := json.Marshal(conf)
+    if err != nil {
+        t.Fatalf("Marshal: %v", err)
+    }
+    var fields map[string]json.RawMessage
+    if err := json.Unmarshal(encoded, &fields); err != nil {
+        t.Fatalf("Unmarshal: %v", err)
+    }
+    if string(fields["max_requests"]) != "3" || string(fields["burst"]) != `{"size":10}` || string(fields["max_requests_per_key"]) != "2" {
+        t.Fatalf("encoded %s", encoded)
+    }
+
+    // A configuration without unknown fields decodes without any
+    var plain EndpointConfig
+    if err := json.Unmarshal([]byte(`{"max_requests":5}`), &plain); err != nil || plain.Unknown != nil {
+        t.Fatalf("Unmarshal: %+v, %v", plain, err)
+    }
+}
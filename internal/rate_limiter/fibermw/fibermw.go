@@ -0,0 +1,96 @@
+package fibermw
+
+import (
+    "context"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    "github.com/gofiber/fiber/v2"
+    "time"
+)
+
+// IdentityFunc returns the user a request is counted for, or "" to count it for its client IP.
+type IdentityFunc func(c *fiber.Ctx) string
+
+type Option func(*middleware)
+
+// WithIdentity counts the requests per identity, like ratelimiter.WithIdentity does for the Hertz middleware.
+func WithIdentity(identity IdentityFunc) Option {
+    return func(m *middleware) {
+        m.identity = identity
+    }
+}
+
+type middleware struct {
+    limiter  ratelimiter.RateLimiter
+    identity IdentityFunc // Nil to count the requests per client IP
+}
+
+// Middleware is the rate limiter middleware for Fiber, e.g. app.Use(fibermw.Middleware(limiter)), with the same limits
+// as its HTTPMiddleware.
+func Middleware(limiter ratelimiter.RateLimiter, opts ...Option) fiber.Handler {
+    m := &middleware{limiter: limiter}
+    for _, opt := range opts {
+        opt(m)
+    }
+    return func(c *fiber.Ctx) error {
+        if !m.limiter.Handle(c.UserContext(), response{c: c}, request{c: c, identity: m.identity}) {
+            return nil
+        }
+        return c.Next()
+    }
+}
+
+// request is the request of the Fiber middleware. Fiber is built on fasthttp like Hertz, the path is the raw bytes
+// passed to the SanitizerFunc and the body is already read.
+type request struct {
+    c        *fiber.Ctx
+    identity IdentityFunc
+}
+
+func (r request) Method() string {
+    return r.c.Method()
+}
+
+func (r request) Path() []byte {
+    return r.c.Request().URI().Path()
+}
+
+func (r request) Header(name string) string {
+    return r.c.Get(name)
+}
+
+// ClientIP honors the ProxyHeader of the Fiber app.
+func (r request) ClientIP() string {
+    return r.c.IP()
+}
+
+func (r request) Body(limit int64) ([]byte, bool) {
+    if int64(r.c.Request().Header.ContentLength()) > limit {
+        return nil, false
+    }
+    body := r.c.Body()
+    return body, int64(len(body)) <= limit
+}
+
+func (r request) Identity(context.Context) (string, error) {
+    if r.identity == nil {
+        return "", nil
+    }
+    return r.identity(r.c), nil
+}
+
+// Start is unknown, fasthttp only tells when it started handling the request.
+func (r request) Start() (time.Time, bool) {
+    return time.Time{}, false
+}
+
+type response struct {
+    c *fiber.Ctx
+}
+
+func (r response) SetHeader(key, value string) {
+    r.c.Set(key, value)
+}
+
+func (r response) WriteJSON(status int, body map[string]any) {
+    _ = r.c.Status(status).JSON(body)
+}
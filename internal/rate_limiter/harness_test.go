@@ -0,0 +1,250 @@
+package rate_limiter
+
+import (
+    "context"
+    "fmt"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "math/rand/v2"
+    "sync"
+    "testing"
+    "time"
+)
+
+// harnessConfig configures a deterministic run of several limiter instances sharing one Store.
+type harnessConfig struct {
+    // Instances is the number of limiter instances sharing the store
+    Instances int
+    // Users is the number of distinct users sending requests
+    Users int
+    // Rounds is the number of rounds, every instance sends one request per round concurrently with the other instances
+    Rounds int
+    // MaxStep is the largest random advance of the simulated clock between two rounds
+    MaxStep time.Duration
+    // Seed makes the interleavings and the clock advances reproducible
+    Seed uint64
+    // Endpoint and its configuration shared by every instance
+    Endpoint       string
+    EndpointConfig EndpointConfig
+    // Store shared by the instances, e.g. NewRedisStore connected to a miniredis
+    Store ratelimiterstore.Store
+    // Advance is called with every advance of the simulated clock, e.g. miniredis FastForward so TTLs follow the clock
+    Advance func(d time.Duration)
+}
+
+// harnessReport is the outcome of a harness run.
+type harnessReport struct {
+    // Allowed is the number of allowed requests
+    Allowed int
+    // Bound is the documented maximum number of requests allowed per user in any span of the checked window
+    Bound int
+    // MaxObserved is the highest number of requests allowed per user in any span of the checked window
+    MaxObserved int
+    // Violations describes every span where more than Bound requests were allowed
+    Violations []string
+}
+
+// runHarness runs the instances against the shared store with a simulated clock and seeded random interleavings of
+// their store calls, then checks the global limit held.
+//
+// Without an atomic store, AllowRequest reads the count then increments it, so instances racing on the same user can
+// each see the last free slot. The documented bound is therefore MaxRequests + Instances - 1 requests per user in any
+// span shorter than TimeWindow - SlidingWindowInterval, the part of the window always covered by the buckets. With a
+// store implementing ratelimiterstore.AtomicStore the bound is MaxRequests.
+func runHarness(ctx context.Context, config harnessConfig) (harnessReport, error) {
+    conf := config.EndpointConfig
+    if config.Instances < 1 || config.Users < 1 || conf.TimeWindow <= conf.SlidingWindowInterval {
+        return harnessReport{}, fmt.Errorf("harness needs instances, users and a time window longer than the sliding window interval")
+    }
+    rnd := rand.New(rand.NewPCG(config.Seed, config.Seed))
+    sched := &scheduler{rnd: rnd}
+    now := time.Unix(0, 0).Add(conf.TimeWindow)
+    clock := func() time.Time {
+        return now
+    }
+
+    var store ratelimiterstore.Store = &scheduledStore{Store: config.Store, sched: sched}
+    bound := conf.MaxRequests + config.Instances - 1
+    if _, ok := config.Store.(ratelimiterstore.AtomicStore); ok {
+        store = atomicScheduledStore{store.(*scheduledStore)}
+        bound = conf.MaxRequests
+    }
+    instances := make([]*rateLimiter, config.Instances)
+    for i := range instances {
+        rl := NewRateLimiter(RateLimiterConfig{config.Endpoint: conf}, store, nil).(*rateLimiter)
+        rl.now = clock
+        instances[i] = rl
+    }
+
+    allowed := make(map[string][]time.Time)
+    for round := 0; round < config.Rounds; round++ {
+        users := make([]string, len(instances))
+        results := make([]bool, len(instances))
+        for i := range instances {
+            users[i] = fmt.Sprintf("user-%d", rnd.IntN(config.Users))
+        }
+        sched.run(len(instances), func(i int) {
+            d, _ := instances[i].AllowRequest(ctx, config.Endpoint, users[i])
+            results[i] = d.Allowed
+        })
+        for i, ok := range results {
+            if ok {
+                allowed[users[i]] = append(allowed[users[i]], now)
+            }
+        }
+
+        step := time.Duration(rnd.Int64N(int64(config.MaxStep) + 1))
+        now = now.Add(step)
+        if config.Advance != nil {
+            config.Advance(step)
+        }
+    }
+
+    report := harnessReport{Bound: bound}
+    span := conf.TimeWindow - conf.SlidingWindowInterval
+    for user, times := range allowed {
+        report.Allowed += len(times)
+        // Sliding span over the allowed timestamps, which are in order
+        start := 0
+        for end := range times {
+            for times[end].Sub(times[start]) >= span {
+                start++
+            }
+            n := end - start + 1
+            report.MaxObserved = max(report.MaxObserved, n)
+            if n > report.Bound {
+                report.Violations = append(report.Violations, fmt.Sprintf("%s: %d requests allowed between %s and %s",
+                    user, n, times[start].Format(time.RFC3339Nano), times[end].Format(time.RFC3339Nano)))
+            }
+        }
+    }
+    return report, nil
+}
+
+// scheduler runs goroutines one at a time, choosing at random which one proceeds at each store call.
+type scheduler struct {
+    rnd     *rand.Rand
+    mu      sync.Mutex
+    waiting []chan struct{} // Goroutines blocked before a store call
+    yield   chan struct{}   // Signalled when the running goroutine blocks or returns
+}
+
+// run starts n goroutines and interleaves their store calls until they all return.
+func (s *scheduler) run(n int, f func(i int)) {
+    s.yield = make(chan struct{})
+    for i := 0; i < n; i++ {
+        go func() {
+            defer func() { s.yield <- struct{}{} }()
+            f(i)
+        }()
+        // Let the goroutine run up to its first store call so the set of waiting goroutines is deterministic
+        <-s.yield
+    }
+    for {
+        s.mu.Lock()
+        if len(s.waiting) == 0 {
+            s.mu.Unlock()
+            return
+        }
+        i := s.rnd.IntN(len(s.waiting))
+        next := s.waiting[i]
+        s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+        s.mu.Unlock()
+        close(next)
+        <-s.yield
+    }
+}
+
+// wait blocks the calling goroutine until the scheduler picks it.
+func (s *scheduler) wait() {
+    ready := make(chan struct{})
+    s.mu.Lock()
+    s.waiting = append(s.waiting, ready)
+    s.mu.Unlock()
+    s.yield <- struct{}{}
+    <-ready
+}
+
+// scheduledStore hands control back to the scheduler before every call to the wrapped store.
+type scheduledStore struct {
+    ratelimiterstore.Store
+    sched *scheduler
+}
+
+func (s *scheduledStore) Get(ctx context.Context, key ratelimiterstore.RateLimiterKey) (int64, error) {
+    s.sched.wait()
+    return s.Store.Get(ctx, key)
+}
+
+func (s *scheduledStore) Set(ctx context.Context, key ratelimiterstore.RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    s.sched.wait()
+    return s.Store.Set(ctx, key, timestamp, windowInterval, ttl)
+}
+
+// atomicScheduledStore also hands control back to the scheduler before the atomic check-and-set of the wrapped store.
+type atomicScheduledStore struct {
+    *scheduledStore
+}
+
+func (s atomicScheduledStore) SetIfBelow(ctx context.Context, key ratelimiterstore.RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    s.sched.wait()
+    return s.Store.(ratelimiterstore.AtomicStore).SetIfBelow(ctx, key, limit, timestamp, windowInterval, ttl)
+}
+
+func (s atomicScheduledStore) AddIfBelow(ctx context.Context, key ratelimiterstore.RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    s.sched.wait()
+    return s.Store.(ratelimiterstore.AtomicStore).AddIfBelow(ctx, key, cost, limit, timestamp, windowInterval, ttl)
+}
+
+// nonAtomicStore hides the atomic methods of the wrapped store, so the rate limiter reads the count before incrementing
+// it.
+type nonAtomicStore struct {
+    ratelimiterstore.Store
+}
+
+func TestHarnessRedis(t *testing.T) {
+    for _, tc := range []struct {
+        name   string
+        atomic bool
+    }{
+        {name: "atomic", atomic: true},
+        {name: "non-atomic"},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            for seed := uint64(1); seed <= 5; seed++ {
+                ctx := context.Background()
+                mr := miniredis.RunT(t)
+                store, err := ratelimiterstore.NewRedisStore(ctx, mr.Addr(), 100)
+                if err != nil {
+                    t.Fatalf("NewRedisStore: %v", err)
+                }
+                t.Cleanup(func() {
+                    store.Close()
+                })
+                if !tc.atomic {
+                    store = nonAtomicStore{store}
+                }
+                report, err := runHarness(ctx, harnessConfig{
+                    Instances:      4,
+                    Users:          3,
+                    Rounds:         300,
+                    MaxStep:        2 * time.Second,
+                    Seed:           seed,
+                    Endpoint:       "/ping",
+                    EndpointConfig: EndpointConfig{MaxRequests: 5, TimeWindow: time.Minute, SlidingWindowInterval: 5 * time.Second},
+                    Store:          store,
+                    Advance:        mr.FastForward,
+                })
+                if err != nil {
+                    t.Fatalf("runHarness: %v", err)
+                }
+                if len(report.Violations) > 0 {
+                    t.Fatalf("seed %d, bound %d: %v", seed, report.Bound, report.Violations)
+                }
+                if report.Allowed == 0 {
+                    t.Fatalf("seed %d: no request allowed", seed)
+                }
+            }
+        })
+    }
+}
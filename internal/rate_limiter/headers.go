@@ -0,0 +1,116 @@
+package rate_limiter
+
+import (
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "strconv"
+    "time"
+)
+
+// RateLimitStatus is the budget of a user after a request, as told to the client by a HeaderEmitter.
+type RateLimitStatus struct {
+    // Budget is the name of the budget, the endpoint or e.g. "HEAD /files" for a method limited on its own
+    Budget    string
+    Limit     int64
+    Remaining int64
+    // Window is the TimeWindow of the limit
+    Window time.Duration
+    // Reset is how long until the budget frees requests, 0 if unknown
+    Reset time.Duration
+}
+
+// Used returns the requests counted in the budget.
+func (s RateLimitStatus) Used() int64 {
+    return max(s.Limit-s.Remaining, 0)
+}
+
+// HeaderEmitter writes the rate limit headers of a response, so a deployment can keep the header scheme of its public
+// API. See GitHubHeaders, DraftHeaders, IETFHeaders and CustomHeaders.
+type HeaderEmitter interface {
+    Emit(header *protocol.ResponseHeader, status RateLimitStatus)
+}
+
+// WithHeaders adds the rate limit headers of the emitter to the responses of the endpoints configured for rate
+// limiting, allowed or not.
+//
+// The headers are only known to the algorithms implementing BatchAlgorithm or RemainingAlgorithm, the other algorithms
+// add none. The reset takes another store call with the sliding window, see RetryAlgorithm.
+func WithHeaders(emitter HeaderEmitter) Option {
+    return func(rl *rateLimiter) {
+        rl.headers = emitter
+    }
+}
+
+// CustomHeaders emits the headers under the names of a custom scheme, the empty names are left out.
+type CustomHeaders struct {
+    Limit     string `json:"limit,omitempty"`
+    Remaining string `json:"remaining,omitempty"`
+    Used      string `json:"used,omitempty"`
+    Reset     string `json:"reset,omitempty"`
+    // ResetUnix sends the reset as a unix timestamp in seconds instead of a delay in seconds
+    ResetUnix bool `json:"reset_unix,omitempty"`
+    // Resource holds the name of the budget
+    Resource string `json:"resource,omitempty"`
+}
+
+// GitHubHeaders returns the X-RateLimit-* scheme of the GitHub API, the reset being a unix timestamp.
+func GitHubHeaders() CustomHeaders {
+    return CustomHeaders{
+        Limit:     "X-RateLimit-Limit",
+        Remaining: "X-RateLimit-Remaining",
+        Used:      "X-RateLimit-Used",
+        Reset:     "X-RateLimit-Reset",
+        ResetUnix: true,
+        Resource:  "X-RateLimit-Resource",
+    }
+}
+
+// DraftHeaders returns the separate RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers of the early
+// drafts of the IETF RateLimit header fields, still the most widely supported.
+func DraftHeaders() CustomHeaders {
+    return CustomHeaders{
+        Limit:     "RateLimit-Limit",
+        Remaining: "RateLimit-Remaining",
+        Reset:     "RateLimit-Reset",
+    }
+}
+
+func (h CustomHeaders) Emit(header *protocol.ResponseHeader, status RateLimitStatus) {
+    set := func(name, value string) {
+        if name != "" {
+            header.Set(name, value)
+        }
+    }
+    set(h.Limit, strconv.FormatInt(status.Limit, 10))
+    set(h.Remaining, strconv.FormatInt(status.Remaining, 10))
+    set(h.Used, strconv.FormatInt(status.Used(), 10))
+    if h.ResetUnix {
+        set(h.Reset, strconv.FormatInt(time.Now().Add(status.Reset).Unix(), 10))
+    } else {
+        set(h.Reset, strconv.FormatInt(seconds(status.Reset), 10))
+    }
+    set(h.Resource, status.Budget)
+}
+
+// IETFHeaders emits the RateLimit and RateLimit-Policy header fields of the current IETF draft, e.g.
+// `RateLimit: "default";r=50;t=30` and `RateLimit-Policy: "default";q=100;w=3600`.
+type IETFHeaders struct {
+    // Policy is the name of the quota policy
+    //
+    // Defaults to "default" if not specified
+    Policy string `json:"policy,omitempty"`
+}
+
+func (h IETFHeaders) Emit(header *protocol.ResponseHeader, status RateLimitStatus) {
+    policy := h.Policy
+    if policy == "" {
+        policy = "default"
+    }
+    header.Set("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, status.Remaining, seconds(status.Reset)))
+    header.Set("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", policy, status.Limit, seconds(status.Window)))
+}
+
+// seconds rounds the duration up to whole seconds, a client waiting on the dot would find the budget still spent.
+func seconds(d time.Duration) int64 {
+    return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,89 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func TestHeaderEmitters(t *testing.T) {
+    status := RateLimitStatus{Budget: "/api", Limit: 100, Remaining: 40, Window: time.Hour, Reset: 1500 * time.Millisecond}
+    for _, test := range []struct {
+        name    string
+        emitter HeaderEmitter
+        headers map[string]string
+    }{
+        {"draft", DraftHeaders(), map[string]string{
+            "RateLimit-Limit": "100", "RateLimit-Remaining": "40", "RateLimit-Reset": "2", "X-RateLimit-Used": "",
+        }},
+        {"ietf", IETFHeaders{}, map[string]string{
+            "RateLimit": `"default";r=40;t=2`, "RateLimit-Policy": `"default";q=100;w=3600`,
+        }},
+        {"ietf policy", IETFHeaders{Policy: "api"}, map[string]string{
+            "RateLimit": `"api";r=40;t=2`, "RateLimit-Policy": `"api";q=100;w=3600`,
+        }},
+        // The empty names are left out
+        {"custom", CustomHeaders{Remaining: "X-Quota-Left", Resource: "X-Quota-Name"}, map[string]string{
+            "X-Quota-Left": "40", "X-Quota-Name": "/api", "RateLimit-Limit": "",
+        }},
+    } {
+        var header protocol.ResponseHeader
+        test.emitter.Emit(&header, status)
+        for name, value := range test.headers {
+            if v := string(header.Peek(name)); v != value {
+                t.Fatalf("%s: %s %q, %q expected", test.name, name, v, value)
+            }
+        }
+    }
+
+    // The reset of GitHub is a unix timestamp
+    var header protocol.ResponseHeader
+    GitHubHeaders().Emit(&header, status)
+    reset, _ := strconv.ParseInt(string(header.Peek("X-RateLimit-Reset")), 10, 64)
+    if string(header.Peek("X-RateLimit-Used")) != "60" || string(header.Peek("X-RateLimit-Resource")) != "/api" ||
+        reset < time.Now().Unix() || reset > time.Now().Add(2*time.Second).Unix() {
+        t.Fatalf("GitHub headers %s", header.Header())
+    }
+    // A budget raised above its use isn't negative
+    if used := (RateLimitStatus{Limit: 10, Remaining: 12}).Used(); used != 0 {
+        t.Fatalf("Used: %d, 0 expected", used)
+    }
+}
+
+func TestHeadersMiddleware(t *testing.T) {
+    rl := NewRateLimiter(RateLimiterConfig{"/api": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+        ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+            return string(path)
+        }, WithHeaders(DraftHeaders()))
+    defer rl.Close()
+    serve := func(path string) *app.RequestContext {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI(path)
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        c.SetHandlers(app.HandlersChain{rl.Middleware, func(_ context.Context, c *app.RequestContext) {
+            c.String(200, "ok")
+        }})
+        c.Next(context.Background())
+        return c
+    }
+
+    // The allowed and the rejected responses tell the budget
+    for i, test := range []struct {
+        status    int
+        remaining string
+    }{{200, "1"}, {200, "0"}, {429, "0"}} {
+        c := serve("/api")
+        if c.Response.StatusCode() != test.status || string(c.Response.Header.Peek("RateLimit-Limit")) != "2" ||
+            string(c.Response.Header.Peek("RateLimit-Remaining")) != test.remaining {
+            t.Fatalf("request %d: %d %s", i, c.Response.StatusCode(), c.Response.Header.Header())
+        }
+    }
+    // The endpoints not limited have none
+    if c := serve("/healthz"); c.Response.Header.Peek("RateLimit-Limit") != nil {
+        t.Fatalf("endpoint not limited: %s", c.Response.Header.Header())
+    }
+}
@@ -0,0 +1,96 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+    "time"
+)
+
+// FlagAbusive flags the users who hit a honeypot.
+const FlagAbusive = "abusive"
+
+type HoneypotConfig struct {
+    // Paths no legitimate client requests, e.g. /wp-admin or /.env, matched against the sanitized path
+    Paths []string `json:"paths"`
+    // Duration the offenders stay in the penalty box
+    //
+    // Defaults to 24 hours if not specified
+    Duration time.Duration `json:"duration,omitempty"`
+    // Penalty replaces the configuration of every endpoint for the offenders, including the endpoints not limited
+    //
+    // Defaults to 10 requests per hour if not specified
+    Penalty *EndpointConfig `json:"penalty,omitempty"`
+}
+
+type honeypots struct {
+    config  HoneypotConfig
+    paths   map[string]struct{}
+    flagger ratelimiterstore.Flagger
+}
+
+// WithHoneypots flags the users requesting one of the honeypot paths as abusive, they get a 404 and their requests to
+// every real endpoint are limited by the penalty configuration until the flag expires.
+//
+// It requires a store implementing ratelimiterstore.Flagger, and is ignored otherwise.
+func WithHoneypots(config HoneypotConfig) Option {
+    return func(rl *rateLimiter) {
+        flagger, ok := rl.store.(ratelimiterstore.Flagger)
+        if !ok {
+            rl.logger.Warn("Store can't flag users, honeypots are disabled")
+            return
+        }
+        if config.Duration == 0 {
+            config.Duration = 24 * time.Hour
+        }
+        if config.Penalty == nil {
+            config.Penalty = &EndpointConfig{
+                MaxRequests:           10,
+                TimeWindow:            time.Hour,
+                SlidingWindowInterval: time.Minute,
+            }
+        }
+        h := &honeypots{
+            config:  config,
+            paths:   make(map[string]struct{}, len(config.Paths)),
+            flagger: flagger,
+        }
+        for _, p := range config.Paths {
+            h.paths[p] = struct{}{}
+        }
+        rl.honeypots = h
+    }
+}
+
+// isHoneypot reports whether the endpoint is a honeypot.
+func (rl *rateLimiter) isHoneypot(endpoint string) bool {
+    if rl.honeypots == nil {
+        return false
+    }
+    _, ok := rl.honeypots.paths[endpoint]
+    return ok
+}
+
+// flagAbusive puts the user in the penalty box.
+func (rl *rateLimiter) flagAbusive(ctx context.Context, endpoint, userId string) {
+    rl.logSampler.Log(ctx, rl.logger, slog.LevelInfo, "Honeypot hit, flagging user", "endpoint", endpoint, "user", userId)
+    if err := rl.honeypots.flagger.Flag(ctx, userId, FlagAbusive, rl.honeypots.config.Duration); err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error flagging user", "endpoint", endpoint, "error", err)
+    }
+}
+
+// penalty returns the penalty configuration if the user is in the penalty box.
+func (rl *rateLimiter) penalty(ctx context.Context, endpoint, userId string) *EndpointConfig {
+    if rl.honeypots == nil {
+        return nil
+    }
+    flagged, err := rl.honeypots.flagger.Flagged(ctx, userId, FlagAbusive)
+    if err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error retrieving flag", "endpoint", endpoint, "error", err)
+        return nil
+    }
+    if !flagged {
+        return nil
+    }
+    return rl.honeypots.config.Penalty
+}
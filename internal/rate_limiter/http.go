@@ -0,0 +1,139 @@
+package rate_limiter
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "io"
+    "net"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// httpRequest is the request of the net/http middleware.
+type httpRequest struct {
+    r        *http.Request
+    identity HTTPIdentityFunc // Nil to count the requests per client IP
+}
+
+// NewHTTPRequest returns the Request of a net/http request without an identity, for the middlewares of the
+// transports built on net/http, e.g. Echo, which tell the client IP and the identity their own way.
+func NewHTTPRequest(r *http.Request) Request {
+    return &httpRequest{r: r}
+}
+
+func (r *httpRequest) Method() string {
+    return r.r.Method
+}
+
+func (r *httpRequest) Path() []byte {
+    return []byte(r.r.URL.Path)
+}
+
+func (r *httpRequest) Header(name string) string {
+    return r.r.Header.Get(name)
+}
+
+func (r *httpRequest) ClientIP() string {
+    host, _, err := net.SplitHostPort(r.r.RemoteAddr)
+    if err != nil {
+        return r.r.RemoteAddr
+    }
+    return host
+}
+
+// Body reads up to limit bytes of the body and puts them back for the next handlers, followed by the rest.
+func (r *httpRequest) Body(limit int64) ([]byte, bool) {
+    if r.r.Body == nil || r.r.ContentLength > limit {
+        return nil, false
+    }
+    data, err := io.ReadAll(io.LimitReader(r.r.Body, limit+1))
+    // The part read before an error is passed on, the next handlers get the error reading the rest
+    r.r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(data), r.r.Body), Closer: r.r.Body}
+    if err != nil || int64(len(data)) > limit {
+        return nil, false
+    }
+    return data, true
+}
+
+// readCloser reads from the Reader and closes the Closer.
+type readCloser struct {
+    io.Reader
+    io.Closer
+}
+
+func (r *httpRequest) Identity(context.Context) (string, error) {
+    if r.identity == nil {
+        return "", nil
+    }
+    return r.identity(r.r), nil
+}
+
+// Start is unknown, net/http doesn't tell when it started reading the request.
+func (r *httpRequest) Start() (time.Time, bool) {
+    return time.Time{}, false
+}
+
+func (rl *rateLimiter) HTTPMiddleware(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if rl.Handle(r.Context(), httpResponse{w: w}, &httpRequest{r: r, identity: rl.httpIdentity}) {
+            next.ServeHTTP(w, r)
+        }
+    })
+}
+
+// ResponseWriter is how the middlewares not built on Hertz answer the requests they stop, see RateLimiter.Handle.
+type ResponseWriter interface {
+    SetHeader(key, value string)
+    // WriteJSON writes the status and the body, after the headers
+    WriteJSON(status int, body map[string]any)
+}
+
+type httpResponse struct {
+    w http.ResponseWriter
+}
+
+func (r httpResponse) SetHeader(key, value string) {
+    r.w.Header().Set(key, value)
+}
+
+func (r httpResponse) WriteJSON(status int, body map[string]any) {
+    r.w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    r.w.WriteHeader(status)
+    _ = json.NewEncoder(r.w).Encode(body)
+}
+
+func (rl *rateLimiter) Handle(ctx context.Context, w ResponseWriter, req Request) bool {
+    a, v := rl.admit(ctx, req)
+    if a == nil {
+        if v == verdictNext {
+            return true
+        }
+        w.WriteJSON(response(v, decision{}, requestInfo{}))
+        return false
+    }
+    d, v := rl.decide(a, req)
+    if v == verdictUnavailable {
+        w.WriteJSON(response(v, d, a.info))
+        return false
+    }
+    if d.status != nil {
+        // The emitters write Hertz headers
+        var header protocol.ResponseHeader
+        header.SetNoDefaultContentType(true)
+        rl.headers.Emit(&header, *d.status)
+        header.VisitAll(func(key, value []byte) {
+            w.SetHeader(string(key), string(value))
+        })
+    }
+    if v == verdictRejected {
+        if d.RetryAfter > 0 {
+            w.SetHeader("Retry-After", strconv.FormatInt(seconds(d.RetryAfter), 10))
+        }
+        w.WriteJSON(response(v, d, a.info))
+        return false
+    }
+    return true
+}
@@ -0,0 +1,58 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "net/http"
+)
+
+// IdentityFunc returns the user a request is counted for, e.g. the subject of its token, or "" to count it for its
+// client IP.
+type IdentityFunc func(ctx context.Context, c *app.RequestContext) string
+
+// WithIdentity counts the requests per identity instead of per client IP, so users behind a shared NAT don't share a
+// budget and a user can't get another one by changing networks. The honeypots and the tarpit still flag client IPs.
+func WithIdentity(identity IdentityFunc) Option {
+    return func(rl *rateLimiter) {
+        rl.identity = identity
+    }
+}
+
+// ClientIP identifies the requests by the client IP Hertz finds, counted under "ip:" like the requests without an
+// identity. Unlike the X-Forwarded-For header read by default, it is the remote address unless the engine trusts the
+// proxy, see server.Hertz.SetClientIPFunc.
+func ClientIP(_ context.Context, c *app.RequestContext) string {
+    return ipPrefix + c.ClientIP()
+}
+
+// HTTPIdentityFunc is the IdentityFunc of the net/http middleware, see RateLimiter.HTTPMiddleware.
+type HTTPIdentityFunc func(r *http.Request) string
+
+// WithHTTPIdentity counts the requests of the net/http middleware per identity, like WithIdentity does for the Hertz
+// one.
+func WithHTTPIdentity(identity HTTPIdentityFunc) Option {
+    return func(rl *rateLimiter) {
+        rl.httpIdentity = identity
+    }
+}
+
+// WithIdentityOverrides replaces the endpoint configurations for the requests of an identity, e.g. the quota of each
+// internal service identified by the signature of its requests. Unlike the per-user overrides of WithPolicies they are
+// part of the configuration, for the few well-known callers.
+func WithIdentityOverrides(overrides map[string]RateLimiterConfig) Option {
+    return func(rl *rateLimiter) {
+        rl.identities = overrides
+    }
+}
+
+// userId returns the identity of the request, falling back to its client IP under ipPrefix.
+func (rl *rateLimiter) userId(ctx context.Context, req Request, ip string) (string, error) {
+    id, err := req.Identity(ctx)
+    if err != nil {
+        return "", err
+    }
+    if id != "" {
+        return id, nil
+    }
+    return ipPrefix + ip, nil
+}
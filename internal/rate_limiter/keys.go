@@ -0,0 +1,89 @@
+package rate_limiter
+
+import (
+    "context"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "strings"
+)
+
+// ErrMissingKey is returned by the extractors of RequireKey for a request without a key.
+var ErrMissingKey = errors.New("missing rate limit key")
+
+// The requests are counted for the key of the KeyExtractor under keyPrefix and for their client IP under ipPrefix, so
+// a client can't send a header or a cookie holding the IP, the identity or the API key ID of another one to spend its
+// budget. The identities and the API key IDs are not prefixed, the client doesn't choose them.
+const (
+    keyPrefix = "key:"
+    ipPrefix  = "ip:"
+)
+
+// KeyExtractor returns the key a request is counted for, "" to count it for its identity or else its client IP, or an
+// error to answer it with 401 without counting it. The key is counted under "key:", the client IP under "ip:".
+type KeyExtractor func(ctx context.Context, c *app.RequestContext) (string, error)
+
+// WithKeyExtractor counts the requests of the Hertz middleware per key, e.g. an API key, the subject of a JWT, a
+// session cookie or a tenant ID, or a combination of them with CombineKeys. It takes precedence over WithIdentity,
+// which identifies the requests it finds no key for.
+// The key is not extracted for the exempt methods of WithMethods nor for the honeypots, which flag client IPs.
+func WithKeyExtractor(extractor KeyExtractor) Option {
+    return func(rl *rateLimiter) {
+        rl.keyExtractor = extractor
+    }
+}
+
+// HeaderKey keys the requests by the value of a header, e.g. X-API-Key.
+func HeaderKey(name string) KeyExtractor {
+    return func(_ context.Context, c *app.RequestContext) (string, error) {
+        return string(c.GetHeader(name)), nil
+    }
+}
+
+// CookieKey keys the requests by the value of a cookie, e.g. the session one.
+func CookieKey(name string) KeyExtractor {
+    return func(_ context.Context, c *app.RequestContext) (string, error) {
+        return string(c.Cookie(name)), nil
+    }
+}
+
+// CombineKeys keys the requests by all the keys of the extractors joined with ":", e.g. the tenant and the user. The
+// key is "" if any of them is, the requests are then counted like without a key.
+func CombineKeys(extractors ...KeyExtractor) KeyExtractor {
+    return func(ctx context.Context, c *app.RequestContext) (string, error) {
+        keys := make([]string, 0, len(extractors))
+        for _, extractor := range extractors {
+            key, err := extractor(ctx, c)
+            if err != nil || key == "" {
+                return "", err
+            }
+            keys = append(keys, key)
+        }
+        return strings.Join(keys, ":"), nil
+    }
+}
+
+// FirstKey keys the requests by the first key the extractors find, e.g. the API key of machine clients or else the
+// session cookie of browsers.
+func FirstKey(extractors ...KeyExtractor) KeyExtractor {
+    return func(ctx context.Context, c *app.RequestContext) (string, error) {
+        for _, extractor := range extractors {
+            key, err := extractor(ctx, c)
+            if err != nil || key != "" {
+                return key, err
+            }
+        }
+        return "", nil
+    }
+}
+
+// RequireKey rejects the requests the extractor finds no key for with ErrMissingKey, instead of counting them for
+// their identity or client IP.
+func RequireKey(extractor KeyExtractor) KeyExtractor {
+    return func(ctx context.Context, c *app.RequestContext) (string, error) {
+        key, err := extractor(ctx, c)
+        if err == nil && key == "" {
+            err = ErrMissingKey
+        }
+        return key, err
+    }
+}
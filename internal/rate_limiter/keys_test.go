@@ -0,0 +1,53 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "testing"
+    "time"
+)
+
+// A client sending the IP of another one as its key doesn't spend its budget.
+func TestExtractedKeysDontShareTheIPs(t *testing.T) {
+    config := RateLimiterConfig{"/ping": {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    }, WithKeyExtractor(HeaderKey("X-API-Key"))).(*rateLimiter)
+    user := func(header string) string {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI("/ping")
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        if header != "" {
+            c.Request.Header.Set("X-API-Key", header)
+        }
+        a, v := rl.admit(context.Background(), hertzRequest{c: c, rl: rl})
+        if a == nil {
+            t.Fatalf("request not admitted: %v", v)
+        }
+        return a.user
+    }
+    if ip, key := user(""), user("10.0.0.1"); ip != "ip:10.0.0.1" || key != "key:10.0.0.1" {
+        t.Fatalf("counted for %q and %q, ip:10.0.0.1 and key:10.0.0.1 expected", ip, key)
+    }
+}
+
+// The requests the extractor finds no key for are counted for their identity rather than their client IP.
+func TestExtractorFallsBackToIdentity(t *testing.T) {
+    config := RateLimiterConfig{"/ping": {MaxRequests: 10, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    }, WithKeyExtractor(HeaderKey("X-API-Key")), WithIdentity(func(context.Context, *app.RequestContext) string {
+        return "ip:192.0.2.1"
+    })).(*rateLimiter)
+    c := app.NewContext(0)
+    c.Request.SetRequestURI("/ping")
+    c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+    a, v := rl.admit(context.Background(), hertzRequest{c: c, rl: rl})
+    if a == nil {
+        t.Fatalf("request not admitted: %v", v)
+    }
+    if a.user != "ip:192.0.2.1" {
+        t.Fatalf("counted for %q, ip:192.0.2.1 expected", a.user)
+    }
+}
@@ -0,0 +1,83 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// WithRequestStartHeader reads when the request was received from the header set by the load balancer, e.g.
+// X-Request-Start, so the time it queued before reaching the server is measured too. The value is a unix timestamp in
+// seconds, milliseconds, microseconds or nanoseconds, optionally prefixed with t= like NGINX and Heroku send it.
+//
+// Defaults to the time the server started reading the request if not specified, with the tracing of Hertz enabled,
+// and to the time the middleware is reached otherwise
+func WithRequestStartHeader(header string) Option {
+    return func(rl *rateLimiter) {
+        rl.startHeader = header
+    }
+}
+
+// requestStart returns the intended start of the request, see WithRequestStartHeader. Timing a request from when it
+// reached the middleware would hide the time it queued behind the others, the latency reported under overload would
+// be the latency of the requests that got through rather than the one seen by the clients (coordinated omission).
+func (rl *rateLimiter) requestStart(req Request, now time.Time) time.Time {
+    if rl.startHeader != "" {
+        if start, ok := parseRequestStart(req.Header(rl.startHeader)); ok {
+            return notAfter(start, now)
+        }
+    }
+    if start, ok := req.Start(); ok {
+        return notAfter(start, now)
+    }
+    return now
+}
+
+// notAfter returns start, or now if start is later, the clock of the load balancer may be ahead.
+func notAfter(start, now time.Time) time.Time {
+    if start.After(now) {
+        return now
+    }
+    return start
+}
+
+// parseRequestStart parses a unix timestamp, its unit told by its magnitude and its fraction, if any, in seconds.
+func parseRequestStart(v string) (time.Time, bool) {
+    v = strings.TrimPrefix(strings.TrimSpace(v), "t=")
+    if v == "" {
+        return time.Time{}, false
+    }
+    if strings.Contains(v, ".") {
+        s, err := strconv.ParseFloat(v, 64)
+        if err != nil || s <= 0 {
+            return time.Time{}, false
+        }
+        return time.UnixMicro(int64(s * 1e6)), true
+    }
+    n, err := strconv.ParseInt(v, 10, 64)
+    switch {
+    case err != nil || n <= 0:
+        return time.Time{}, false
+    case n < 1e11:
+        return time.Unix(n, 0), true
+    case n < 1e14:
+        return time.UnixMilli(n), true
+    case n < 1e17:
+        return time.UnixMicro(n), true
+    default:
+        return time.Unix(0, n), true
+    }
+}
+
+// recordLatency times the request from its intended start to its decision, and the part of it spent before the
+// middleware.
+func (rl *rateLimiter) recordLatency(ctx context.Context, endpoint string, start, reached time.Time, allowed bool) {
+    result := "allowed"
+    if !allowed {
+        result = "rejected"
+    }
+    rl.metrics.Timing(MetricQueueTime, reached.Sub(start), metrics.Tag{Key: "endpoint", Value: endpoint})
+    metrics.TimingContext(ctx, rl.metrics, MetricDecisionLatency, time.Since(start), metrics.Tag{Key: "endpoint", Value: endpoint}, metrics.Tag{Key: "result", Value: result})
+}
@@ -0,0 +1,156 @@
+package rate_limiter
+
+import (
+    "cmp"
+    "fmt"
+    "slices"
+    "strings"
+    "time"
+)
+
+// Rules of the findings of Lint.
+const (
+    // LintIntervalWindow flags a sliding window interval not shorter than its time window, the window is then fixed
+    // and lets through bursts of twice the limit around its boundaries
+    LintIntervalWindow = "interval-window"
+    // LintZeroLimit flags a MaxRequests of 0, which blocks every request rather than leaving the endpoint unlimited
+    LintZeroLimit = "zero-limit"
+    // LintOverlap flags an endpoint looser than an endpoint it is under, whose limit then doesn't bound it
+    LintOverlap = "overlap"
+    // LintAuthFailOpen flags an authentication endpoint letting the requests through while its store fails, opening
+    // it to credential stuffing during an outage
+    LintAuthFailOpen = "auth-fail-open"
+    // LintUnreachableWindow flags a window of an endpoint allowing at least what its shorter windows let through over
+    // its time window, its limit is then never reached
+    LintUnreachableWindow = "unreachable-window"
+)
+
+// Finding is a risky endpoint configuration found by Lint, valid but likely not what was meant.
+type Finding struct {
+    Endpoint string `json:"endpoint"`
+    Rule     string `json:"rule"`
+    Message  string `json:"message"`
+}
+
+func (f Finding) String() string {
+    return fmt.Sprintf("%s: %s: %s", f.Endpoint, f.Rule, f.Message)
+}
+
+type LintOptions struct {
+    // DefaultStoreErrorPolicy is the policy of the endpoints without OnStoreError, see WithStoreErrorPolicy
+    //
+    // Defaults to StoreErrorAllow if not specified
+    DefaultStoreErrorPolicy string `json:"default_store_error_policy,omitempty"`
+    // AuthSegments are the path segments of the authentication endpoints
+    //
+    // Defaults to login, signin, auth, token, oauth, password, otp, mfa, register and signup if not specified
+    AuthSegments []string `json:"auth_segments,omitempty"`
+}
+
+var defaultAuthSegments = []string{"login", "signin", "auth", "token", "oauth", "password", "otp", "mfa", "register", "signup"}
+
+// Lint returns the risky endpoint configurations, sorted by endpoint. Unlike Validate the findings don't prevent using
+// the configuration. The endpoints are assumed to cover the paths beneath them, like a SanitizerFunc matching the
+// longest configured prefix does.
+func (c RateLimiterConfig) Lint(options LintOptions) []Finding {
+    if options.DefaultStoreErrorPolicy == "" {
+        options.DefaultStoreErrorPolicy = StoreErrorAllow
+    }
+    if len(options.AuthSegments) == 0 {
+        options.AuthSegments = defaultAuthSegments
+    }
+    var findings []Finding
+    for endpoint, conf := range c {
+        window, interval := effectiveWindow(conf)
+        switch conf.Algorithm {
+        case "", AlgorithmSlidingWindow:
+            if interval >= window {
+                findings = append(findings, Finding{endpoint, LintIntervalWindow, fmt.Sprintf(
+                    "sliding window interval %s is not shorter than the time window %s, bursts of twice the limit pass around the window boundaries", interval, window)})
+            }
+        }
+        if conf.MaxRequests == 0 {
+            findings = append(findings, Finding{endpoint, LintZeroLimit,
+                "max_requests is 0 and blocks every request, remove the endpoint to leave it unlimited"})
+        }
+        base := conf
+        base.TimeWindow, base.SlidingWindowInterval = window, interval
+        findings = append(findings, unreachableWindows(endpoint, base.windows(endpoint))...)
+        for parent, parentConf := range c {
+            if parent == endpoint || !under(endpoint, parent) || !looser(conf, parentConf) {
+                continue
+            }
+            findings = append(findings, Finding{endpoint, LintOverlap, fmt.Sprintf(
+                "allows %s while %s, which covers it, allows %s", rate(conf), parent, rate(parentConf))})
+        }
+        policy := cmp.Or(conf.OnStoreError, options.DefaultStoreErrorPolicy)
+        if policy == StoreErrorAllow && isAuthEndpoint(endpoint, options.AuthSegments) {
+            findings = append(findings, Finding{endpoint, LintAuthFailOpen,
+                "authentication endpoint lets every request through while its store fails, use reject or local"})
+        }
+    }
+    slices.SortFunc(findings, func(a, b Finding) int {
+        return cmp.Or(cmp.Compare(a.Endpoint, b.Endpoint), cmp.Compare(a.Rule, b.Rule), cmp.Compare(a.Message, b.Message))
+    })
+    return findings
+}
+
+// effectiveWindow returns the time window and the sliding window interval of the configuration, with their defaults.
+func effectiveWindow(conf EndpointConfig) (time.Duration, time.Duration) {
+    defaults := DefaultEndpointConfig()
+    return cmp.Or(conf.TimeWindow, defaults.TimeWindow), cmp.Or(conf.SlidingWindowInterval, defaults.SlidingWindowInterval)
+}
+
+// under tells whether the endpoint is a path beneath the parent, in whole segments.
+func under(endpoint, parent string) bool {
+    if parent == "/" {
+        return strings.HasPrefix(endpoint, "/")
+    }
+    return strings.HasPrefix(endpoint, strings.TrimSuffix(parent, "/")+"/")
+}
+
+// looser tells whether the configuration allows more requests per second than the other one.
+func looser(conf, other EndpointConfig) bool {
+    window, _ := effectiveWindow(conf)
+    otherWindow, _ := effectiveWindow(other)
+    // Compared cross-multiplied, MaxRequests/window > other.MaxRequests/otherWindow
+    return float64(conf.MaxRequests)*otherWindow.Seconds() > float64(other.MaxRequests)*window.Seconds()
+}
+
+// unreachableWindows returns a finding for each window the shorter ones keep from reaching its limit.
+func unreachableWindows(endpoint string, windows []limitWindow) []Finding {
+    var findings []Finding
+    for i, longer := range windows {
+        for _, shorter := range windows[:i] {
+            // The most requests the shorter window lets through over the longer one
+            spans := (longer.conf.TimeWindow + shorter.conf.TimeWindow - 1) / shorter.conf.TimeWindow
+            if shorter.conf.MaxRequests > 0 && int64(longer.conf.MaxRequests) >= int64(shorter.conf.MaxRequests)*int64(spans) {
+                findings = append(findings, Finding{endpoint, LintUnreachableWindow, fmt.Sprintf(
+                    "window of %s is never reached under the window of %s", rate(longer.conf), rate(shorter.conf))})
+                break
+            }
+        }
+    }
+    return findings
+}
+
+func rate(conf EndpointConfig) string {
+    window, _ := effectiveWindow(conf)
+    return fmt.Sprintf("%d requests per %s", conf.MaxRequests, window)
+}
+
+func isAuthEndpoint(endpoint string, segments []string) bool {
+    for _, segment := range strings.FieldsFunc(strings.ToLower(endpoint), func(r rune) bool { return r == '/' || r == '-' || r == '_' || r == '.' }) {
+        if slices.Contains(segments, segment) {
+            return true
+        }
+    }
+    return false
+}
+
+// lint logs the findings of the configuration, for the limiter to warn about a risky configuration when loading it.
+func (rl *rateLimiter) lint(config RateLimiterConfig) {
+    for _, f := range config.Lint(LintOptions{DefaultStoreErrorPolicy: rl.onStoreError}) {
+        rl.logger.Warn("Risky rate limit configuration", "endpoint", f.Endpoint, "rule", f.Rule, "message", f.Message)
+    }
+}
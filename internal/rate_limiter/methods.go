@@ -0,0 +1,47 @@
+package rate_limiter
+
+type MethodConfig struct {
+    // ExemptPreflight lets the CORS preflights through without counting them, the OPTIONS requests carrying an Origin
+    // and an Access-Control-Request-Method header
+    ExemptPreflight bool `json:"exempt_preflight,omitempty"`
+    // Exempt lets the requests of the methods through without counting them, e.g. OPTIONS and HEAD
+    Exempt []string `json:"exempt,omitempty"`
+    // Limits counts the requests of the methods in a budget of their own under the given configuration, separate from
+    // the other methods of the endpoint. They only apply to the endpoints configured for rate limiting.
+    Limits map[string]EndpointConfig `json:"limits,omitempty"`
+}
+
+type methods struct {
+    config MethodConfig
+    exempt map[string]struct{}
+}
+
+// WithMethods exempts or separately limits the requests of some methods, so the preflights and HEAD requests of
+// browsers don't consume the budget of the real calls.
+func WithMethods(config MethodConfig) Option {
+    return func(rl *rateLimiter) {
+        m := &methods{
+            config: config,
+            exempt: make(map[string]struct{}, len(config.Exempt)),
+        }
+        for _, method := range config.Exempt {
+            m.exempt[method] = struct{}{}
+        }
+        rl.methods = m
+    }
+}
+
+// lookup reports whether the request is exempt, or returns the configuration of its method if it has one.
+func (m *methods) lookup(req Request) (*EndpointConfig, bool) {
+    method := req.Method()
+    if _, ok := m.exempt[method]; ok {
+        return nil, true
+    }
+    if m.config.ExemptPreflight && method == "OPTIONS" && req.Header("Origin") != "" && req.Header("Access-Control-Request-Method") != "" {
+        return nil, true
+    }
+    if conf, ok := m.config.Limits[method]; ok {
+        return &conf, false
+    }
+    return nil, false
+}
@@ -0,0 +1,53 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
+    "time"
+)
+
+// Names of the metrics of the rate limiter, tagged with the endpoint.
+const (
+    // MetricRequests counts the decisions, tagged with the result: allowed or rejected
+    MetricRequests = "rate_limiter.requests"
+    // MetricStoreErrors counts the requests allowed because the store failed, tagged with the store
+    MetricStoreErrors = "rate_limiter.store_errors"
+    // MetricStoreLatency times the algorithm and its store calls, tagged with the store
+    MetricStoreLatency = "rate_limiter.store_latency"
+    // MetricQueueTime times the requests from their intended start to the middleware, see WithRequestStartHeader
+    MetricQueueTime = "rate_limiter.queue_time"
+    // MetricDecisionLatency times the requests from their intended start to their decision, including the queue time
+    // and the wait of AlgorithmLeakyBucket, tagged with the result: allowed or rejected
+    MetricDecisionLatency = "rate_limiter.decision_latency"
+    // MetricDisabled counts the requests of the configured endpoints let through because their limit is disabled, see
+    // EndpointConfig.DisabledUntil
+    MetricDisabled = "rate_limiter.disabled"
+)
+
+// WithMetrics reports the decisions and the store health of the rate limiter to the sink, e.g. a StatsD agent.
+//
+// The decisions and their latency are recorded with the span of the request as exemplar when the sink implements
+// metrics.ExemplarSink and tracing is enabled, see WithTracer.
+//
+// Defaults to metrics.Discard if not specified
+func WithMetrics(sink metrics.Sink) Option {
+    return func(rl *rateLimiter) {
+        rl.metrics = sink
+    }
+}
+
+func (rl *rateLimiter) recordDecision(ctx context.Context, endpoint string, allowed bool) {
+    result := "allowed"
+    if !allowed {
+        result = "rejected"
+    }
+    metrics.CountContext(ctx, rl.metrics, MetricRequests, 1, metrics.Tag{Key: "endpoint", Value: endpoint}, metrics.Tag{Key: "result", Value: result})
+}
+
+func (rl *rateLimiter) recordStoreCall(endpoint, storeName string, latency time.Duration, err error) {
+    tags := []metrics.Tag{{Key: "endpoint", Value: endpoint}, {Key: "store", Value: storeName}}
+    rl.metrics.Timing(MetricStoreLatency, latency, tags...)
+    if err != nil {
+        rl.metrics.Count(MetricStoreErrors, 1, tags...)
+    }
+}
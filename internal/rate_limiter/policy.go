@@ -0,0 +1,80 @@
+package rate_limiter
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    clientcache "github.com/aswinkm-tc/go-web-concepts/internal/client_cache"
+    "log/slog"
+)
+
+// Keys of the per-user policies, followed by the user id. They are managed centrally in Redis, e.g. with
+// SET ratelimiter:ban:<userId> 1 EX 3600.
+const (
+    // ExemptPrefix keys exempt the user from the limits
+    ExemptPrefix = "ratelimiter:exempt:"
+    // BanPrefix keys reject every request of the user
+    BanPrefix = "ratelimiter:ban:"
+    // OverridePrefix keys hold a JSON RateLimiterConfig replacing the endpoint configurations for the user
+    OverridePrefix = "ratelimiter:override:"
+    // NotePrefix keys hold a JSON note of the operators on the user, e.g. why it is exempted, see admin.NoteStore. They
+    // don't change the limits.
+    NotePrefix = "ratelimiter:note:"
+)
+
+// PolicyPrefixes are the prefixes to cache for WithPolicies.
+var PolicyPrefixes = []string{ExemptPrefix, BanPrefix, OverridePrefix}
+
+// WithPolicies applies the bans, exemptions and configuration overrides of the users, read through the cache so the
+// checks don't cost a round trip to Redis on every request. The cache should track PolicyPrefixes.
+func WithPolicies(cache clientcache.Cache) Option {
+    return func(rl *rateLimiter) {
+        rl.policies = cache
+    }
+}
+
+type policy int
+
+const (
+    policyLimit policy = iota
+    policyExempt
+    policyBan
+)
+
+// userPolicy returns the policy of the user and the endpoint configuration overriding the configured one, if any.
+// Policies that can't be read are ignored, the user is limited with the configured endpoint.
+func (rl *rateLimiter) userPolicy(ctx context.Context, endpoint, userId string) (policy, *EndpointConfig) {
+    if rl.policies == nil {
+        return policyLimit, nil
+    }
+    if rl.hasPolicy(ctx, ExemptPrefix+userId) {
+        return policyExempt, nil
+    }
+    if rl.hasPolicy(ctx, BanPrefix+userId) {
+        return policyBan, nil
+    }
+    value, err := rl.policies.Get(ctx, OverridePrefix+userId)
+    if err != nil {
+        if !errors.Is(err, clientcache.ErrKeyNotFound) {
+            rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error retrieving policy", "endpoint", endpoint, "error", err)
+        }
+        return policyLimit, nil
+    }
+    var override RateLimiterConfig
+    if err := json.Unmarshal(value, &override); err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error decoding override", "endpoint", endpoint, "error", err)
+        return policyLimit, nil
+    }
+    if conf, ok := override[endpoint]; ok {
+        return policyLimit, &conf
+    }
+    return policyLimit, nil
+}
+
+func (rl *rateLimiter) hasPolicy(ctx context.Context, key string) bool {
+    _, err := rl.policies.Get(ctx, key)
+    if err != nil && !errors.Is(err, clientcache.ErrKeyNotFound) {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error retrieving policy", "key", key, "error", err)
+    }
+    return err == nil
+}
@@ -2,18 +2,46 @@ package rate_limiter
 
 import (
     "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    clientcache "github.com/aswinkm-tc/go-web-concepts/internal/client_cache"
+    "github.com/aswinkm-tc/go-web-concepts/internal/logging"
+    "github.com/aswinkm-tc/go-web-concepts/internal/metrics"
     ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    servertiming "github.com/aswinkm-tc/go-web-concepts/internal/server_timing"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
     "github.com/cloudwego/hertz/pkg/app"
-    "github.com/cloudwego/hertz/pkg/common/utils"
-    "github.com/cloudwego/hertz/pkg/protocol/consts"
     "log/slog"
+    "maps"
+    "net/http"
+    "slices"
+    "strconv"
+    "sync/atomic"
     "time"
 )
 
 // RateLimiter interface defines the methods for a rate limiter.
 type RateLimiter interface {
-    AllowRequest(ctx context.Context, endpoint, userId string) bool
+    // AllowRequest checks if a request is allowed for the given endpoint and user ID. The error is a failure of the
+    // store, the request is then decided by the store error policy, see WithStoreErrorPolicy.
+    AllowRequest(ctx context.Context, endpoint, userId string) (Decision, error)
     Middleware(ctx context.Context, c *app.RequestContext)
+    // HTTPMiddleware is the Middleware for net/http, e.g. http.ListenAndServe(addr, limiter.HTTPMiddleware(mux)). The
+    // long-lived connections are limited like the other requests, the rejected requests are not tarpitted and the
+    // capacity is not read from the responses, those need Hertz.
+    HTTPMiddleware(next http.Handler) http.Handler
+    // Handle decides on a request of a middleware not built on Hertz nor net/http, e.g. the ones of the echomw and
+    // fibermw packages, with the same limits as HTTPMiddleware. It answers the requests it stops like the Hertz
+    // middleware and returns false if the request must not reach the next handlers.
+    Handle(ctx context.Context, w ResponseWriter, req Request) bool
+    // Config returns the endpoint configurations in use, it must not be modified
+    Config() RateLimiterConfig
+    // UpdateConfig replaces the endpoint configurations, requests in flight finish with the previous configuration
+    UpdateConfig(config RateLimiterConfig)
+    // Close closes the store, the stores of WithStores and the local fallback of StoreErrorLocal, see Store.Close. The
+    // rate limiter must not be used afterwards.
+    Close() error
 }
 
 type EndpointConfig struct {
@@ -27,6 +55,37 @@ type EndpointConfig struct {
     //
     // Defaults to 1 minute if not specified
     SlidingWindowInterval time.Duration `json:"sliding_window_interval,omitempty"`
+    // QueueDepth is the number of requests AlgorithmLeakyBucket holds back until their turn, the requests beyond are
+    // rejected
+    //
+    // Defaults to 0 if not specified, requests over the rate are rejected
+    QueueDepth int `json:"queue_depth,omitempty"`
+    // Algorithm is the name of the algorithm applying the limit, see WithAlgorithm
+    //
+    // Defaults to AlgorithmSlidingWindow if not specified
+    Algorithm string `json:"algorithm,omitempty"`
+    // Store is the name of the store holding the counters of the endpoint, see WithStores
+    //
+    // Defaults to the store of NewRateLimiter if not specified
+    Store string `json:"store,omitempty"`
+    // OnStoreError is the policy applied to the requests when the store fails: StoreErrorAllow, StoreErrorReject or
+    // StoreErrorLocal
+    //
+    // Defaults to the policy of WithStoreErrorPolicy if not specified
+    OnStoreError string `json:"on_store_error,omitempty"`
+    // Windows are limits enforced together with MaxRequests per TimeWindow, e.g. a sustained hourly limit on top of a
+    // burst limit per second. A request must be allowed by every window, and the headers tell the budget of the window
+    // leaving the fewest requests.
+    //
+    // Defaults to no additional window if not specified
+    Windows []WindowConfig `json:"windows,omitempty"`
+    // DisabledUntil soft-deletes the limit of the endpoint until the time, e.g. during a migration: its requests are
+    // not limited, the bans aside, and the configuration is kept to apply again afterwards. See admin.EndpointToggle.
+    //
+    // Defaults to the zero time if not specified, the endpoint is limited
+    DisabledUntil time.Time `json:"disabled_until,omitzero"`
+    // Unknown holds the fields of the JSON encoding this version doesn't know, they are encoded back unchanged
+    Unknown map[string]json.RawMessage `json:"-"`
 }
 
 // DefaultEndpointConfig returns the default configuration for an endpoint.
@@ -43,87 +102,453 @@ func DefaultEndpointConfig() EndpointConfig {
     }
 }
 
+// Disabled tells whether the limit of the endpoint is soft-deleted at the time, see DisabledUntil.
+func (c EndpointConfig) Disabled(now time.Time) bool {
+    return now.Before(c.DisabledUntil)
+}
+
 // RateLimiterConfig is a map of endpoint configurations for rate limiting.
 type RateLimiterConfig map[string]EndpointConfig
 
+// Validate checks the endpoint configurations can be used by the rate limiter.
+func (c RateLimiterConfig) Validate() error {
+    for endpoint, conf := range c {
+        if conf.MaxRequests < 0 || conf.TimeWindow < 0 || conf.SlidingWindowInterval < 0 || conf.QueueDepth < 0 {
+            return fmt.Errorf("endpoint %s has a negative limit", endpoint)
+        }
+        if (conf.TimeWindow > 0 && conf.TimeWindow < time.Millisecond) || (conf.SlidingWindowInterval > 0 && conf.SlidingWindowInterval < time.Millisecond) {
+            return fmt.Errorf("endpoint %s has a window shorter than a millisecond", endpoint)
+        }
+        if conf.TimeWindow > 0 && conf.SlidingWindowInterval > conf.TimeWindow {
+            return fmt.Errorf("endpoint %s has a sliding window interval longer than its time window", endpoint)
+        }
+        if err := conf.validateWindows(endpoint); err != nil {
+            return err
+        }
+        if !validStoreErrorPolicy(conf.OnStoreError) {
+            return fmt.Errorf("endpoint %s has an unknown store error policy %q", endpoint, conf.OnStoreError)
+        }
+    }
+    return nil
+}
+
 // SanitizerFunc is a function type that sanitizes the path for rate limiting.
 //
 // It takes a byte slice representing the path and returns a sanitized path as a string.
 type SanitizerFunc func(path []byte) string
 
 type rateLimiter struct {
-    config        RateLimiterConfig
+    config        atomic.Pointer[RateLimiterConfig]
     store         ratelimiterstore.Store // Store for persisting rate limiting data
     pathSanitizer SanitizerFunc          // Function to sanitize the path for rate limiting
+    now           func() time.Time       // Clock used to timestamp requests, replaced when replaying usage
+    logger        *slog.Logger
+    logThrottle   *logging.Throttle                 // Deduplicates the store errors logged on every request during an outage
+    logSampler    *logging.Sampler                  // Samples the rejections logged during a storm
+    policies      clientcache.Cache                 // Bans, exemptions and overrides of the users, nil if not used
+    stores        map[string]ratelimiterstore.Store // Stores selected by name in the endpoint configurations
+    dedupHeader   string                            // Header holding the request id, empty if retries are counted
+    dedupTTL      time.Duration
+    honeypots     *honeypots // Nil if no honeypot is declared
+    tarpit        *tarpit    // Nil if the abusive users are rejected normally
+    userAgents    *userAgentOverrides
+    algorithms    map[string]Algorithm // Algorithms selected by name in the endpoint configurations
+    metrics       metrics.Sink
+    tracer        tracing.Tracer
+    capacity      *Capacity     // Nil if the limits are not scaled by the capacity of the backends
+    methods       *methods      // Nil if every method shares the budget of the endpoint
+    connections   *connections  // Nil if the long-lived connections are limited like the other requests
+    batches       *batches      // Nil if every request counts as one
+    headers       HeaderEmitter // Nil if no rate limit header is sent
+    onStoreError  string
+    fallback      ratelimiterstore.Store       // Limits the requests while their store fails, with StoreErrorLocal
+    identity      IdentityFunc                 // Nil to count the requests per client IP
+    keyExtractor  KeyExtractor                 // Takes precedence over identity, nil to use it
+    apiKeys       *apiKeys                     // Takes precedence over the identities, nil if not used
+    httpIdentity  HTTPIdentityFunc             // Identity of the net/http middleware, nil to count per client IP
+    identities    map[string]RateLimiterConfig // Configurations replacing the endpoint ones for an identity
+    startHeader   string                       // Header holding when the load balancer received the request
+}
+
+// Option configures optional behaviour of the RateLimiter.
+type Option func(*rateLimiter)
+
+// WithLogger sets the logger of the rate limiter, records are enriched with the component and the endpoint.
+//
+// Defaults to slog.Default() if not specified
+func WithLogger(logger *slog.Logger) Option {
+    return func(rl *rateLimiter) {
+        rl.logger = logger.With(logging.ComponentKey, "rate_limiter")
+    }
+}
+
+// WithLogThrottle logs each store error message at most once per interval, with a count of the suppressed ones.
+// An interval of 0 logs every error.
+//
+// Defaults to 1 minute if not specified
+func WithLogThrottle(interval time.Duration) Option {
+    return func(rl *rateLimiter) {
+        rl.logThrottle = logging.NewThrottle(interval)
+    }
+}
+
+// WithLogSampling logs the first rejections of each interval at debug level, then one in every thereafter, with a
+// count of the suppressed ones. An interval of 0 logs every rejection.
+//
+// Defaults to the first 10 then 1 in 100 per second if not specified
+func WithLogSampling(interval time.Duration, first, thereafter int) Option {
+    return func(rl *rateLimiter) {
+        rl.logSampler = logging.NewSampler(interval, first, thereafter)
+    }
 }
 
 // NewRateLimiter creates a new RateLimiter with the given configuration.
-func NewRateLimiter(config RateLimiterConfig, store ratelimiterstore.Store, pathSanitizer SanitizerFunc) RateLimiter {
+func NewRateLimiter(config RateLimiterConfig, store ratelimiterstore.Store, pathSanitizer SanitizerFunc, opts ...Option) RateLimiter {
     c := &rateLimiter{
-        config:        config,
         store:         store,
         pathSanitizer: pathSanitizer,
+        onStoreError:  StoreErrorAllow,
+        fallback:      ratelimiterstore.NewMemoryStore(),
+        now:           NewMonotonicClock(time.Minute).Now,
+        metrics:       metrics.Discard,
+        tracer:        tracing.Noop,
+        algorithms: map[string]Algorithm{
+            AlgorithmSlidingWindow: SlidingWindow{},
+            AlgorithmFixedWindow:   FixedWindow{},
+            AlgorithmTokenBucket:   TokenBucket{},
+            AlgorithmLeakyBucket:   LeakyBucket{},
+            AlgorithmGCRA:          GCRA{},
+        },
+    }
+    WithLogger(slog.Default())(c)
+    WithLogThrottle(time.Minute)(c)
+    WithLogSampling(time.Second, 10, 100)(c)
+    for _, opt := range opts {
+        opt(c)
     }
+    c.lint(config)
+    c.config.Store(&config)
     return c
 }
 
-// AllowRequest checks if a request is allowed for the given endpoint and user ID.
-func (rl *rateLimiter) AllowRequest(ctx context.Context, endpoint string, userId string) bool {
-    conf, ok := rl.config[endpoint]
+// Decision is the outcome of AllowRequest.
+type Decision struct {
+    Allowed bool
+    // Limit and Remaining are the budget of the user after the request, only counted by the algorithms implementing
+    // BatchAlgorithm or RemainingAlgorithm. Both are 0 for the endpoints not configured for rate limiting.
+    Limit     int64
+    Remaining int64
+    // ResetAt is when the budget frees requests, the zero time if unknown, see RetryAlgorithm
+    ResetAt time.Time
+    // RetryAfter is how long a rejected user should wait, 0 if the request is allowed or the delay unknown
+    RetryAfter time.Duration
+}
+
+func (rl *rateLimiter) AllowRequest(ctx context.Context, endpoint string, userId string) (Decision, error) {
+    d, err := rl.allowRequest(ctx, endpoint, userId, requestInfo{detail: true})
+    return d.Decision, err
+}
+
+// requestInfo holds what the middleware knows about a request beyond its endpoint and user.
+type requestInfo struct {
+    requestId string // A retry of a request already counted under it is allowed without being counted again
+    userAgent string
+    // budget names a budget of the endpoint separate from its own under the limit configuration, e.g. for a method
+    // limited on its own. It only applies to the endpoints configured for rate limiting.
+    budget string
+    limit  *EndpointConfig
+    cost   int64 // Items of a batch request, counted as one request below 2
+    // keyLimits replace the endpoint configurations for the caller of the API key, see WithAPIKeys
+    keyLimits RateLimiterConfig
+    detail    bool // Tells the limit, remaining requests and reset of an allowed request too
+}
+
+// decision is the outcome of allowRequest.
+type decision struct {
+    Decision
+    allowance int64            // Cost a rejected batch could afford, see BatchAlgorithm
+    status    *RateLimitStatus // Nil unless the headers are sent and the algorithm counts the remaining requests
+    window    time.Duration    // TimeWindow of the window deciding the request, see EndpointConfig.Windows
+}
+
+// allowRequest checks if a request is allowed.
+func (rl *rateLimiter) allowRequest(ctx context.Context, endpoint, userId string, info requestInfo) (d decision, err error) {
+    ctx, span := rl.tracer.Start(ctx, SpanDecision, tracing.Attribute{Key: "endpoint", Value: endpoint})
+    var storeLatency time.Duration
+    defer func() {
+        rl.recordDecision(ctx, endpoint, d.Allowed)
+        if !d.Allowed && err == nil {
+            rl.logSampler.Log(ctx, rl.logger, slog.LevelDebug, "Request rejected", "endpoint", endpoint, "user", userId, "retry_after", d.RetryAfter)
+        }
+        span.SetAttributes(append(remainingAttributes(d.Decision),
+            tracing.Attribute{Key: "allowed", Value: d.Allowed},
+            tracing.Attribute{Key: "decision", Value: decisionName(d.Allowed, err)},
+            tracing.Attribute{Key: "store_latency", Value: storeLatency},
+        )...)
+        if err != nil {
+            span.RecordError(err)
+        }
+        span.End()
+    }()
+    config := *rl.config.Load()
+    conf, ok := config[endpoint]
+    budget := endpoint
+    if info.limit != nil && ok {
+        conf, budget = *info.limit, info.budget
+    }
+    if override := rl.userAgentOverride(endpoint, info.userAgent); override != nil {
+        conf, ok = *override, true
+    }
+    if override, found := rl.identities[userId][endpoint]; found {
+        conf, ok = override, true
+    }
+    if override, found := info.keyLimits[endpoint]; found {
+        conf, ok = override, true
+    }
+    switch p, override := rl.userPolicy(ctx, endpoint, userId); {
+    case p == policyExempt:
+        return decision{Decision: Decision{Allowed: true}}, nil
+    case p == policyBan:
+        return decision{}, nil
+    case override != nil:
+        conf, ok = *override, true
+    }
+    if penalty := rl.penalty(ctx, endpoint, userId); penalty != nil {
+        conf, ok = *penalty, true
+    }
+    if base, configured := config[endpoint]; configured && base.Disabled(rl.now()) {
+        // Left unlimited like an endpoint not configured, whatever overrides its configuration for the user
+        metrics.CountContext(ctx, rl.metrics, MetricDisabled, 1, metrics.Tag{Key: "endpoint", Value: endpoint})
+        return decision{Decision: Decision{Allowed: true}}, nil
+    }
     // If the endpoint is not configured for rate limiting, allow the request
     if !ok {
-        return true
+        return decision{Decision: Decision{Allowed: true}}, nil
     }
-    // Get the current timestamp
-    curTimeStamp := time.Now()
-    count, err := rl.store.Get(ctx, ratelimiterstore.RateLimiterKey{
+    conf = rl.scaleLimit(endpoint, conf)
+    key := ratelimiterstore.RateLimiterKey{
         UserId:   userId,
-        Endpoint: endpoint,
-    })
+        Endpoint: budget,
+    }
+    store, storeName := rl.storeFor(ctx, endpoint, conf)
+    if rl.isRetry(ctx, store, key, info.requestId) {
+        return decision{Decision: Decision{Allowed: true}}, nil
+    }
+    algorithm := rl.algorithmFor(ctx, endpoint, conf)
+    cost := max(info.cost, 1)
+    batch, counts := algorithm.(BatchAlgorithm)
+    remaining, remains := algorithm.(RemainingAlgorithm)
+    // Counting the request as a batch of one also tells the remaining requests for the headers
+    detail := info.detail || rl.headers != nil
+    counts = counts && (cost > 1 || detail)
+    if info.cost > 1 && !counts {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelWarn, "Algorithm can't count batches, counting the request once", "endpoint", endpoint, "algorithm", conf.Algorithm)
+    }
+    // call runs a call of the algorithm on the store, traced and timed
+    call := func(storeName string, f func(ctx context.Context) error) error {
+        ctx, span := rl.tracer.Start(ctx, SpanStore, tracing.Attribute{Key: "store", Value: storeName})
+        defer span.End()
+        start := time.Now()
+        err := f(ctx)
+        latency := time.Since(start)
+        storeLatency += latency
+        rl.recordStoreCall(endpoint, storeName, latency, err)
+        if err != nil {
+            span.RecordError(err)
+        }
+        return err
+    }
+    windows := conf.windows(budget)
+    buckets, together := algorithm.(BucketAlgorithm)
+    together = together && len(windows) > 1
+    // apply counts the request in the windows of the limit and returns the count of each, up to the first window
+    // rejecting the request
+    apply := func(store ratelimiterstore.Store, storeName string) ([]windowCount, error) {
+        if together {
+            var counted []windowCount
+            err := call(storeName, func(ctx context.Context) (err error) {
+                counted, err = countBuckets(ctx, store, buckets, key, windows, rl.now(), cost, counts)
+                return err
+            })
+            return counted, err
+        }
+        // The windows are counted from the shortest, a request rejected by a longer window was counted by the shorter
+        // ones
+        counted := make([]windowCount, 0, len(windows))
+        for _, window := range windows {
+            windowKey := key
+            windowKey.Endpoint = window.budget
+            var c windowCount
+            err := call(storeName, func(ctx context.Context) (err error) {
+                switch {
+                case counts:
+                    c.allowed, c.allowance, err = batch.AllowN(ctx, store, windowKey, rl.now(), window.conf, cost)
+                    c.known, c.limit, c.remaining = true, int64(window.conf.MaxRequests), c.allowance
+                    if c.allowed {
+                        c.remaining -= cost
+                    }
+                case remains && detail:
+                    c.allowed, c.limit, c.remaining, err = remaining.AllowRemaining(ctx, store, windowKey, rl.now(), window.conf)
+                    c.known = true
+                default:
+                    c.allowed, err = algorithm.Allow(ctx, store, windowKey, rl.now(), window.conf)
+                }
+                return err
+            })
+            if err != nil {
+                return nil, err
+            }
+            if counted = append(counted, c); !c.allowed {
+                break
+            }
+        }
+        return counted, nil
+    }
+    counted, err := apply(store, storeName)
     if err != nil {
-        slog.Error("Error retrieving rate limiter object", "error", err)
-        // If there is an error retrieving the rate limiter object, allow the request
-        return true
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error applying rate limit", "endpoint", endpoint, "store", storeName, "error", err)
+        switch rl.storeErrorPolicy(conf) {
+        case StoreErrorReject:
+            return decision{}, err
+        case StoreErrorLocal:
+            // Limit per process until the store is back, the counts start over on both sides
+            store, storeName = rl.fallback, fallbackStoreName
+            if counted, err = apply(store, storeName); err != nil {
+                return decision{Decision: Decision{Allowed: true}}, err
+            }
+        default:
+            return decision{Decision: Decision{Allowed: true}}, err
+        }
     }
-    if count == 0 {
-        // If the key is not found, create a new rate limiter object with the current timestamp
-        if err = rl.store.Set(ctx, ratelimiterstore.RateLimiterKey{
-            UserId:   userId,
-            Endpoint: endpoint,
-        }, curTimeStamp, conf.SlidingWindowInterval, conf.TimeWindow); err != nil {
-            slog.Error("Error setting rate limiter object", "error", err)
-            // If there is an error setting the rate limiter object, allow the request
-            return true
+    for i, c := range counted {
+        windowKey := key
+        windowKey.Endpoint = windows[i].budget
+        wd := rl.windowDecision(ctx, endpoint, store, storeName, windowKey, windows[i].conf, algorithm, c, detail)
+        if wd.status != nil {
+            // The client is told the budget of the endpoint whichever window constrains it
+            wd.status.Budget = budget
+        }
+        if !c.allowed {
+            return wd, nil
+        }
+        if i == 0 || wd.constrains(d) {
+            d = wd
         }
-        // Allow the request since this is the first request for this user and endpoint
-        return true
     }
+    rl.markCounted(ctx, store, key, info.requestId)
+    return d, nil
+}
+
+// windowCount is the outcome of a window, with the budget told by the algorithm, see BatchAlgorithm and
+// RemainingAlgorithm.
+type windowCount struct {
+    allowed   bool
+    known     bool  // Whether the algorithm told the budget
+    allowance int64 // Cost a rejected batch could afford
+    limit     int64
+    remaining int64 // Requests left after the request
+}
 
-    if count < int32(conf.MaxRequests) {
-        // If the sum of requests is less than the max allowed, allow the request
-        if err = rl.store.Set(ctx, ratelimiterstore.RateLimiterKey{
-            UserId:   userId,
-            Endpoint: endpoint,
-        }, curTimeStamp, conf.SlidingWindowInterval, conf.TimeWindow); err != nil {
-            slog.Error("Error setting rate limiter object", "error", err)
-            return true
+// windowDecision is the decision of a window of the limit, with the budget told to the client.
+func (rl *rateLimiter) windowDecision(ctx context.Context, endpoint string, store ratelimiterstore.Store, storeName string, key ratelimiterstore.RateLimiterKey, conf EndpointConfig, algorithm Algorithm, counted windowCount, detail bool) decision {
+    allowed := counted.allowed
+    d := decision{Decision: Decision{Allowed: allowed}, allowance: counted.allowance, window: conf.TimeWindow}
+    var reset time.Duration
+    if retry, ok := algorithm.(RetryAlgorithm); ok && (!allowed || detail) {
+        var err error
+        if reset, err = retry.RetryAfter(ctx, store, key, rl.now(), conf); err != nil {
+            rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error computing retry delay", "endpoint", endpoint, "store", storeName, "error", err)
+        } else if reset > 0 {
+            d.ResetAt = rl.now().Add(reset)
         }
-        return true
     }
+    if !allowed {
+        d.RetryAfter = reset
+    }
+    if counted.known {
+        d.Limit, d.Remaining = counted.limit, max(counted.remaining, 0)
+        if rl.headers != nil {
+            d.status = &RateLimitStatus{
+                Budget:    key.Endpoint,
+                Limit:     d.Limit,
+                Remaining: d.Remaining,
+                Window:    conf.TimeWindow,
+                Reset:     reset,
+            }
+        }
+    }
+    return d
+}
 
-    return false
+func (rl *rateLimiter) Config() RateLimiterConfig {
+    return *rl.config.Load()
+}
+
+// UpdateConfig atomically swaps the endpoint configurations.
+func (rl *rateLimiter) UpdateConfig(config RateLimiterConfig) {
+    rl.lint(config)
+    rl.config.Store(&config)
+}
+
+func (rl *rateLimiter) Close() error {
+    // A store can be both the default one and selected by name
+    closed := make(map[ratelimiterstore.Store]struct{})
+    var errs []error
+    for _, store := range append([]ratelimiterstore.Store{rl.store, rl.fallback}, slices.Collect(maps.Values(rl.stores))...) {
+        if _, ok := closed[store]; ok {
+            continue
+        }
+        closed[store] = struct{}{}
+        if err := store.Close(); err != nil {
+            errs = append(errs, fmt.Errorf("failed to close store: %w", err))
+        }
+    }
+    return errors.Join(errs...)
 }
 
 func (rl *rateLimiter) Middleware(ctx context.Context, c *app.RequestContext) {
-    endpoint := rl.pathSanitizer(c.Path()) // Get the endpoint from the request path
-    ip := string(c.GetHeader("X-Forwarded-For"))
-    if ip == "" {
-        ip = c.ClientIP() // Fallback to the remote IP if X-Forwarded-For is not set
+    start := time.Now()
+    req := hertzRequest{c: c, rl: rl}
+    a, v := rl.admit(ctx, req)
+    if a == nil {
+        servertiming.Since(c, servertiming.StageRateLimit, start)
+        if v == verdictNext {
+            c.Next(ctx)
+            return
+        }
+        c.AbortWithStatusJSON(response(v, decision{}, requestInfo{}))
+        return
+    }
+    if rl.connections != nil {
+        if kind := rl.connections.kind(c); kind != notLongLived {
+            // The connection is limited for as long as it is open, in spans of its own
+            endSpan(a.span, DecisionLongLived)
+            rl.connections.serve(ctx, rl, c, kind, a.endpoint, a.user, a.info)
+            return
+        }
     }
-    // Assume user_id is passed as a query parameter
-    if !rl.AllowRequest(ctx, endpoint, ip) {
-        c.JSON(consts.StatusTooManyRequests, utils.H{"error": "Rate limit exceeded"})
-        c.Abort()
+    d, v := rl.decide(a, req)
+    servertiming.Since(c, servertiming.StageRateLimit, start)
+    if v == verdictUnavailable {
+        c.AbortWithStatusJSON(response(v, d, a.info))
+        return
+    }
+    if d.status != nil {
+        rl.headers.Emit(&c.Response.Header, *d.status)
+    }
+    if v == verdictRejected {
+        if rl.tarpit != nil && rl.tarpit.reject(ctx, rl, c, a.ip) {
+            c.Abort()
+            return
+        }
+        if d.RetryAfter > 0 {
+            c.Header("Retry-After", strconv.FormatInt(seconds(d.RetryAfter), 10))
+        }
+        c.AbortWithStatusJSON(response(v, d, a.info))
+        return
     }
     c.Next(ctx)
+    if rl.capacity != nil {
+        rl.capacity.observe(a.endpoint, c)
+    }
 }
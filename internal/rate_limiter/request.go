@@ -0,0 +1,204 @@
+package rate_limiter
+
+import (
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/tracer/stats"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "time"
+)
+
+// Request is what the rate limiter reads of a request, so the middlewares of every transport share the decisions, see
+// RateLimiter.Handle. The echomw and fibermw packages adapt Echo and Fiber.
+type Request interface {
+    Method() string
+    // Path is passed to the SanitizerFunc
+    Path() []byte
+    Header(name string) string
+    // ClientIP is the remote address of the request, the middleware reads X-Forwarded-For first
+    ClientIP() string
+    // Body is only read for the batch endpoints, see WithBatches. It reports false if the body is longer than limit
+    // bytes or can't be read, and leaves the body readable by the next handlers
+    Body(limit int64) ([]byte, bool)
+    // Identity returns the user of the request, "" to count it for its client IP, or an error if the request can't be
+    // counted for anyone
+    Identity(ctx context.Context) (string, error)
+    // Start returns when the server started reading the request, if it tells
+    Start() (time.Time, bool)
+}
+
+// hertzRequest is the request of the Hertz middleware.
+type hertzRequest struct {
+    c  *app.RequestContext
+    rl *rateLimiter
+}
+
+func (r hertzRequest) Method() string {
+    return string(r.c.Method())
+}
+
+func (r hertzRequest) Path() []byte {
+    return r.c.Path()
+}
+
+func (r hertzRequest) Header(name string) string {
+    return string(r.c.GetHeader(name))
+}
+
+func (r hertzRequest) ClientIP() string {
+    return r.c.ClientIP()
+}
+
+func (r hertzRequest) Body(limit int64) ([]byte, bool) {
+    if int64(r.c.Request.Header.ContentLength()) > limit {
+        return nil, false
+    }
+    body := r.c.Request.Body()
+    return body, int64(len(body)) <= limit
+}
+
+func (r hertzRequest) Identity(ctx context.Context) (string, error) {
+    rl := r.rl
+    if rl.keyExtractor != nil {
+        key, err := rl.keyExtractor(ctx, r.c)
+        if err != nil {
+            return "", err
+        }
+        if key != "" {
+            // The key is whatever the client sent, it can't pass for an identity or an IP
+            return keyPrefix + key, nil
+        }
+    }
+    if rl.identity == nil {
+        return "", nil
+    }
+    return rl.identity(ctx, r.c), nil
+}
+
+// Start returns when Hertz started reading the request, only known if its tracing is enabled.
+func (r hertzRequest) Start() (time.Time, bool) {
+    if ti := r.c.GetTraceInfo(); ti != nil && ti.Stats() != nil {
+        if e := ti.Stats().GetEvent(stats.HTTPStart); e != nil && !e.IsNil() && !e.Time().IsZero() {
+            return e.Time(), true
+        }
+    }
+    return time.Time{}, false
+}
+
+// verdict is what the middleware does with a request.
+type verdict int
+
+const (
+    verdictNext         verdict = iota // Run the next handlers
+    verdictNotFound                    // A honeypot, answered with 404
+    verdictUnavailable                 // Rejected by StoreErrorReject, answered with 503
+    verdictRejected                    // Over its limit, answered with 429
+    verdictUnauthorized                // Its KeyExtractor failed, answered with 401
+)
+
+// admission is a request admitted to the decision, between admit and decide.
+type admission struct {
+    ctx      context.Context // Holds the span of the middleware
+    span     tracing.Span
+    reached  time.Time
+    endpoint string
+    ip       string
+    user     string // What the request is counted for, its client IP if it has no identity
+    info     requestInfo
+}
+
+// admit runs the checks preceding the decision, the honeypots and the exempt methods, and gathers what the request
+// tells of its budget. It returns nil with the verdict if the request is already decided.
+func (rl *rateLimiter) admit(ctx context.Context, req Request) (*admission, verdict) {
+    a := &admission{reached: time.Now()}
+    a.endpoint = rl.pathSanitizer(req.Path()) // Get the endpoint from the request path
+    // The span covers the rate limiting only, the next handlers run with ctx so they are not its children
+    a.ctx, a.span = rl.tracer.Start(ctx, SpanMiddleware, tracing.Attribute{Key: "endpoint", Value: a.endpoint})
+    a.ip = req.Header("X-Forwarded-For")
+    if a.ip == "" {
+        a.ip = req.ClientIP() // Fallback to the remote IP if X-Forwarded-For is not set
+    }
+    if rl.isHoneypot(a.endpoint) {
+        rl.flagAbusive(a.ctx, a.endpoint, a.ip)
+        endSpan(a.span, DecisionHoneypot)
+        return nil, verdictNotFound
+    }
+    if rl.dedupHeader != "" {
+        a.info.requestId = req.Header(rl.dedupHeader)
+    }
+    if rl.userAgents != nil {
+        a.info.userAgent = req.Header("User-Agent")
+    }
+    if rl.methods != nil {
+        limit, exempt := rl.methods.lookup(req)
+        if exempt {
+            endSpan(a.span, DecisionExempt)
+            return nil, verdictNext
+        }
+        if limit != nil {
+            a.info.budget, a.info.limit = req.Method()+" "+a.endpoint, limit
+        }
+    }
+    // The key is extracted after the exempt methods, so preflight requests don't need credentials
+    var (
+        apiKey APIKey
+        found  bool
+        err    error
+    )
+    if rl.apiKeys != nil {
+        apiKey, found, err = rl.caller(a.ctx, req)
+    }
+    user := apiKey.ID
+    if !found && err == nil {
+        user, err = rl.userId(a.ctx, req, a.ip)
+    }
+    if err != nil {
+        rl.logSampler.Log(a.ctx, rl.logger, slog.LevelDebug, "Error extracting key", "endpoint", a.endpoint, "error", err)
+        endSpan(a.span, DecisionUnauthorized)
+        return nil, verdictUnauthorized
+    }
+    a.user, a.info.keyLimits = user, apiKey.Limits
+    return a, verdictNext
+}
+
+// decide decides on the admitted request and ends the span of the middleware.
+func (rl *rateLimiter) decide(a *admission, req Request) (decision, verdict) {
+    if rl.batches != nil {
+        a.info.cost = rl.batches.size(a.endpoint, req)
+    }
+    d, err := rl.allowRequest(a.ctx, a.endpoint, a.user, a.info)
+    rl.recordLatency(a.ctx, a.endpoint, rl.requestStart(req, a.reached), a.reached, d.Allowed)
+    endSpan(a.span, decisionName(d.Allowed, err), remainingAttributes(d.Decision)...)
+    switch {
+    case err != nil && !d.Allowed:
+        // Rejected by StoreErrorReject, the client is not over its limit
+        return d, verdictUnavailable
+    case !d.Allowed:
+        return d, verdictRejected
+    default:
+        return d, verdictNext
+    }
+}
+
+// response returns the status and the body of a request stopped by the verdict.
+func response(v verdict, d decision, info requestInfo) (int, utils.H) {
+    switch {
+    case v == verdictNotFound:
+        return consts.StatusNotFound, utils.H{"error": "Not found"}
+    case v == verdictUnavailable:
+        return consts.StatusServiceUnavailable, utils.H{"error": "Rate limiter unavailable"}
+    case v == verdictUnauthorized:
+        return consts.StatusUnauthorized, utils.H{"error": "Unauthorized"}
+    case info.cost > 1:
+        return consts.StatusTooManyRequests, utils.H{
+            "error":         fmt.Sprintf("Rate limit exceeded, you may send up to %d items now", d.allowance),
+            "allowed_items": d.allowance,
+        }
+    default:
+        return consts.StatusTooManyRequests, utils.H{"error": "Rate limit exceeded"}
+    }
+}
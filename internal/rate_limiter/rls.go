@@ -0,0 +1,167 @@
+package rate_limiter
+
+import (
+    "context"
+    "fmt"
+    ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+    rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+    "google.golang.org/protobuf/types/known/durationpb"
+    "strings"
+    "time"
+)
+
+// RateLimitServiceName is the name of the Envoy rate limit service, e.g. to report it serving with the health server.
+const RateLimitServiceName = "envoy.service.ratelimit.v3.RateLimitService"
+
+type RateLimitServiceConfig struct {
+    // MaxDescriptors is the most descriptors of one request, larger requests are rejected with InvalidArgument
+    //
+    // Defaults to 100 if not specified
+    MaxDescriptors int `json:"max_descriptors,omitempty"`
+    // MaxEntries is the most entries of one descriptor, longer descriptors are rejected with InvalidArgument
+    //
+    // Defaults to 8 if not specified
+    MaxEntries int `json:"max_entries,omitempty"`
+}
+
+type rateLimitService struct {
+    rlsv3.UnimplementedRateLimitServiceServer
+    rl     *rateLimiter
+    config RateLimitServiceConfig
+}
+
+// NewRateLimitService serves the envoy.service.ratelimit.v3 API, so Envoy and Istio gateways use the limiter as their
+// global rate limit service, e.g. rlsv3.RegisterRateLimitServiceServer(s, service).
+//
+// A descriptor is limited by the endpoint named after the domain and its entries, see DescriptorEndpoint: an entry
+// matches "key=value" if configured and else "key", whose value then counts towards the user. The earlier entries are
+// the more significant, as in the configuration of the Envoy ratelimit service. A descriptor matching no endpoint is
+// not limited.
+//
+// The descriptors are decided one after the other, each counted hits_addend times if allowed. The limit overrides of
+// the descriptors are ignored, the limits are those of the configuration.
+func NewRateLimitService(limiter RateLimiter, config RateLimitServiceConfig) (rlsv3.RateLimitServiceServer, error) {
+    rl, ok := limiter.(*rateLimiter)
+    if !ok {
+        return nil, fmt.Errorf("rate limiter %T was not created by NewRateLimiter", limiter)
+    }
+    if config.MaxDescriptors == 0 {
+        config.MaxDescriptors = 100
+    }
+    if config.MaxEntries == 0 {
+        config.MaxEntries = 8
+    }
+    return &rateLimitService{rl: rl, config: config}, nil
+}
+
+// DescriptorEndpoint is the endpoint of a descriptor with the given entries, e.g. DescriptorEndpoint("edge",
+// "path=/login", "remote_address") is "edge|path=/login|remote_address" and limits each remote address on /login.
+func DescriptorEndpoint(domain string, entries ...string) string {
+    return strings.Join(append([]string{domain}, entries...), "|")
+}
+
+func (s *rateLimitService) ShouldRateLimit(ctx context.Context, req *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+    if req.GetDomain() == "" {
+        return nil, status.Error(codes.InvalidArgument, "Expected a domain")
+    }
+    descriptors := req.GetDescriptors()
+    if len(descriptors) == 0 || len(descriptors) > s.config.MaxDescriptors {
+        return nil, status.Errorf(codes.InvalidArgument, "Expected 1 to %d descriptors", s.config.MaxDescriptors)
+    }
+    config := *s.rl.config.Load()
+    resp := &rlsv3.RateLimitResponse{
+        OverallCode: rlsv3.RateLimitResponse_OK,
+        Statuses:    make([]*rlsv3.RateLimitResponse_DescriptorStatus, len(descriptors)),
+    }
+    for i, desc := range descriptors {
+        entries := desc.GetEntries()
+        if len(entries) == 0 || len(entries) > s.config.MaxEntries {
+            return nil, status.Errorf(codes.InvalidArgument, "Descriptor %d needs 1 to %d entries", i, s.config.MaxEntries)
+        }
+        cost := int64(req.GetHitsAddend())
+        if desc.GetHitsAddend() != nil {
+            cost = int64(desc.GetHitsAddend().GetValue())
+        }
+        endpoint, userId := matchDescriptor(config, req.GetDomain(), entries)
+        if endpoint == "" {
+            resp.Statuses[i] = &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+            continue
+        }
+        d, err := s.rl.allowRequest(ctx, endpoint, userId, requestInfo{cost: cost, detail: true})
+        if err != nil && !d.Allowed {
+            // Envoy applies its own failure mode to an unavailable service
+            return nil, status.Errorf(codes.Unavailable, "Failed to decide on descriptor %d: %v", i, err)
+        }
+        resp.Statuses[i] = s.descriptorStatus(endpoint, d)
+        if !d.Allowed {
+            resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+        }
+    }
+    return resp, nil
+}
+
+// matchDescriptor returns the most specific endpoint configured for the entries and the user counted by it, the
+// values of the entries matched by key only. The endpoint is empty if none is configured.
+func matchDescriptor(config RateLimiterConfig, domain string, entries []*ratelimitv3.RateLimitDescriptor_Entry) (endpoint, userId string) {
+    n := len(entries)
+    parts := make([]string, n)
+    for mask := 1<<n - 1; mask >= 0; mask-- {
+        var values []string
+        for i, entry := range entries {
+            if mask&(1<<(n-1-i)) != 0 {
+                parts[i] = entry.GetKey() + "=" + entry.GetValue()
+            } else {
+                parts[i] = entry.GetKey()
+                values = append(values, entry.GetValue())
+            }
+        }
+        endpoint = DescriptorEndpoint(domain, parts...)
+        if _, ok := config[endpoint]; ok {
+            if len(values) == 0 {
+                // Every entry is matched by its value, the users of the descriptor share one budget
+                return endpoint, "*"
+            }
+            return endpoint, strings.Join(values, "|")
+        }
+    }
+    return "", ""
+}
+
+// descriptorStatus is the status of an allowed or rejected descriptor.
+func (s *rateLimitService) descriptorStatus(endpoint string, d decision) *rlsv3.RateLimitResponse_DescriptorStatus {
+    st := &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+    if !d.Allowed {
+        st.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+    }
+    if d.Limit > 0 {
+        st.CurrentLimit = &rlsv3.RateLimitResponse_RateLimit{
+            Name:            endpoint,
+            RequestsPerUnit: uint32(d.Limit),
+            Unit:            rateLimitUnit(d.window),
+        }
+        st.LimitRemaining = uint32(max(d.Remaining, 0))
+    }
+    if !d.ResetAt.IsZero() {
+        st.DurationUntilReset = durationpb.New(max(d.ResetAt.Sub(s.rl.now()), time.Duration(0)))
+    } else if d.RetryAfter > 0 {
+        st.DurationUntilReset = durationpb.New(d.RetryAfter)
+    }
+    return st
+}
+
+// rateLimitUnit is the unit of a time window, UNKNOWN unless the window is exactly one unit long.
+func rateLimitUnit(window time.Duration) rlsv3.RateLimitResponse_RateLimit_Unit {
+    switch window {
+    case time.Second:
+        return rlsv3.RateLimitResponse_RateLimit_SECOND
+    case time.Minute:
+        return rlsv3.RateLimitResponse_RateLimit_MINUTE
+    case time.Hour:
+        return rlsv3.RateLimitResponse_RateLimit_HOUR
+    case 24 * time.Hour:
+        return rlsv3.RateLimitResponse_RateLimit_DAY
+    }
+    return rlsv3.RateLimitResponse_RateLimit_UNKNOWN
+}
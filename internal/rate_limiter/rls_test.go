@@ -0,0 +1,111 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+    rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+    "testing"
+    "time"
+)
+
+func newRateLimitService(t *testing.T) rlsv3.RateLimitServiceServer {
+    t.Helper()
+    rl := NewRateLimiter(RateLimiterConfig{
+        DescriptorEndpoint("edge", "remote_address"):                {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+        DescriptorEndpoint("edge", "path=/login", "remote_address"): {MaxRequests: 1, TimeWindow: time.Hour, SlidingWindowInterval: time.Minute},
+        DescriptorEndpoint("edge", "path", "remote_address"):        {MaxRequests: 100, TimeWindow: time.Minute, SlidingWindowInterval: time.Second},
+        DescriptorEndpoint("edge", "path=/admin"):                   {MaxRequests: 1, TimeWindow: 90 * time.Second, SlidingWindowInterval: time.Second},
+    }, ratelimiterstore.NewMemoryStore(), nil)
+    t.Cleanup(func() {
+        _ = rl.Close()
+    })
+    s, err := NewRateLimitService(rl, RateLimitServiceConfig{MaxEntries: 2})
+    if err != nil {
+        t.Fatalf("NewRateLimitService: %v", err)
+    }
+    return s
+}
+
+func descriptor(entries ...string) *ratelimitv3.RateLimitDescriptor {
+    desc := &ratelimitv3.RateLimitDescriptor{}
+    for i := 0; i < len(entries); i += 2 {
+        desc.Entries = append(desc.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+    }
+    return desc
+}
+
+func TestRateLimitService(t *testing.T) {
+    s := newRateLimitService(t)
+    shouldRateLimit := func(descriptors ...*ratelimitv3.RateLimitDescriptor) *rlsv3.RateLimitResponse {
+        t.Helper()
+        resp, err := s.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{Domain: "edge", Descriptors: descriptors})
+        if err != nil {
+            t.Fatalf("ShouldRateLimit: %v", err)
+        }
+        return resp
+    }
+
+    // Each remote address has its budget
+    for i, code := range []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OVER_LIMIT} {
+        resp := shouldRateLimit(descriptor("remote_address", "10.0.0.1"))
+        st := resp.Statuses[0]
+        if resp.OverallCode != code || st.Code != code || st.CurrentLimit.GetRequestsPerUnit() != 2 ||
+            st.CurrentLimit.GetUnit() != rlsv3.RateLimitResponse_RateLimit_MINUTE || st.CurrentLimit.GetName() != "edge|remote_address" {
+            t.Fatalf("request %d: %v", i, resp)
+        }
+        if code == rlsv3.RateLimitResponse_OVER_LIMIT && st.GetDurationUntilReset().AsDuration() <= 0 {
+            t.Fatalf("rejected descriptor without a reset: %v", st)
+        }
+    }
+    if resp := shouldRateLimit(descriptor("remote_address", "10.0.0.2")); resp.OverallCode != rlsv3.RateLimitResponse_OK {
+        t.Fatalf("another remote address: %v", resp)
+    }
+
+    // The most specific endpoint applies, the descriptors of a request are decided one by one
+    resp := shouldRateLimit(descriptor("path", "/login", "remote_address", "10.0.0.3"), descriptor("path", "/login", "remote_address", "10.0.0.3"))
+    if resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT || resp.Statuses[0].Code != rlsv3.RateLimitResponse_OK ||
+        resp.Statuses[1].Code != rlsv3.RateLimitResponse_OVER_LIMIT || resp.Statuses[0].CurrentLimit.GetUnit() != rlsv3.RateLimitResponse_RateLimit_HOUR {
+        t.Fatalf("login: %v", resp)
+    }
+    // Every entry matched by its value, the budget is shared, and the window of 90s has no unit
+    resp = shouldRateLimit(descriptor("path", "/admin"), descriptor("path", "/admin"), descriptor("path", "/orders"))
+    if resp.Statuses[0].Code != rlsv3.RateLimitResponse_OK || resp.Statuses[1].Code != rlsv3.RateLimitResponse_OVER_LIMIT ||
+        resp.Statuses[0].CurrentLimit.GetUnit() != rlsv3.RateLimitResponse_RateLimit_UNKNOWN {
+        t.Fatalf("admin: %v", resp)
+    }
+    // A descriptor matching no endpoint is not limited
+    if st := resp.Statuses[2]; st.Code != rlsv3.RateLimitResponse_OK || st.CurrentLimit != nil {
+        t.Fatalf("descriptor without an endpoint: %v", st)
+    }
+
+    // The hits are counted by hits_addend
+    resp, err := s.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+        Domain: "edge", HitsAddend: 2, Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", "10.0.0.4")},
+    })
+    if err != nil || resp.OverallCode != rlsv3.RateLimitResponse_OK || resp.Statuses[0].LimitRemaining != 0 {
+        t.Fatalf("hits_addend of 2: %v, %v", resp, err)
+    }
+    if resp := shouldRateLimit(descriptor("remote_address", "10.0.0.4")); resp.OverallCode != rlsv3.RateLimitResponse_OVER_LIMIT {
+        t.Fatalf("request after 2 hits: %v", resp)
+    }
+}
+
+func TestRateLimitServiceRejects(t *testing.T) {
+    s := newRateLimitService(t)
+    for _, req := range []*rlsv3.RateLimitRequest{
+        {Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("remote_address", "10.0.0.1")}},
+        {Domain: "edge"},
+        {Domain: "edge", Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor()}},
+        {Domain: "edge", Descriptors: []*ratelimitv3.RateLimitDescriptor{descriptor("a", "1", "b", "2", "c", "3")}},
+    } {
+        if _, err := s.ShouldRateLimit(context.Background(), req); status.Code(err) != codes.InvalidArgument {
+            t.Fatalf("%v: %v, InvalidArgument expected", req, err)
+        }
+    }
+    if _, err := NewRateLimitService(nil, RateLimitServiceConfig{}); err == nil {
+        t.Fatalf("NewRateLimitService of a limiter not created by NewRateLimiter: no error")
+    }
+}
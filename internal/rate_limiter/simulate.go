@@ -0,0 +1,102 @@
+package rate_limiter
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "fmt"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "io"
+    "sort"
+    "time"
+)
+
+// UsageEvent is one request of an exported decision/usage stream.
+type UsageEvent struct {
+    Timestamp time.Time `json:"timestamp"`
+    Endpoint  string    `json:"endpoint"`
+    UserId    string    `json:"user_id"`
+}
+
+// SimulationCount holds the number of replayed and rejected requests.
+type SimulationCount struct {
+    Total    int `json:"total"`
+    Rejected int `json:"rejected"`
+}
+
+// SimulationReport is the outcome of replaying a usage stream against a configuration.
+type SimulationReport struct {
+    Total SimulationCount `json:"total"`
+    // Endpoints holds the counts per endpoint
+    Endpoints map[string]SimulationCount `json:"endpoints"`
+    // Keys holds the counts per endpoint and user, keyed by "<userId>#<endpoint>"
+    Keys map[string]SimulationCount `json:"keys"`
+}
+
+// ReadUsageEvents decodes a usage stream with one JSON encoded UsageEvent per line.
+func ReadUsageEvents(r io.Reader) ([]UsageEvent, error) {
+    var events []UsageEvent
+    scanner := bufio.NewScanner(r)
+    for line := 1; scanner.Scan(); line++ {
+        if len(scanner.Bytes()) == 0 {
+            continue
+        }
+        var e UsageEvent
+        if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+            return nil, fmt.Errorf("failed to decode usage event on line %d: %w", line, err)
+        }
+        events = append(events, e)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read usage events: %w", err)
+    }
+    return events, nil
+}
+
+// Simulate replays the usage events offline against a candidate configuration and reports how many requests would
+// have been rejected.
+//
+// Events are replayed in timestamp order through the same decision logic as AllowRequest, on a memory store whose
+// buckets expire on the simulated clock.
+func Simulate(config RateLimiterConfig, events []UsageEvent) (SimulationReport, error) {
+    if err := config.Validate(); err != nil {
+        return SimulationReport{}, err
+    }
+    events = append([]UsageEvent(nil), events...)
+    sort.SliceStable(events, func(i, j int) bool {
+        return events[i].Timestamp.Before(events[j].Timestamp)
+    })
+
+    var now time.Time
+    clock := func() time.Time {
+        return now
+    }
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(ratelimiterstore.WithMemoryClock(clock)), nil).(*rateLimiter)
+    rl.now = clock
+    // The requests held back by a leaky bucket are let through at once, the clock only moves between events
+    rl.algorithms[AlgorithmLeakyBucket] = LeakyBucket{Wait: func(context.Context, time.Duration) error { return nil }}
+
+    report := SimulationReport{
+        Endpoints: make(map[string]SimulationCount),
+        Keys:      make(map[string]SimulationCount),
+    }
+    ctx := context.Background()
+    for _, e := range events {
+        now = e.Timestamp
+        rejected := 0
+        if d, _ := rl.AllowRequest(ctx, e.Endpoint, e.UserId); !d.Allowed {
+            rejected = 1
+        }
+        report.Total = report.Total.add(rejected)
+        report.Endpoints[e.Endpoint] = report.Endpoints[e.Endpoint].add(rejected)
+        key := e.UserId + "#" + e.Endpoint
+        report.Keys[key] = report.Keys[key].add(rejected)
+    }
+    return report, nil
+}
+
+func (c SimulationCount) add(rejected int) SimulationCount {
+    c.Total++
+    c.Rejected += rejected
+    return c
+}
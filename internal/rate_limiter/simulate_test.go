@@ -0,0 +1,23 @@
+package rate_limiter
+
+import (
+    "testing"
+    "time"
+)
+
+// The counters expire on the clock of the replayed events, not on the wall clock of the replay.
+func TestSimulateFollowsTheEventClock(t *testing.T) {
+    config := RateLimiterConfig{"/ping": {MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+    var events []UsageEvent
+    for _, offset := range []time.Duration{0, time.Second, 2 * time.Second, 5 * time.Minute} {
+        events = append(events, UsageEvent{Timestamp: start.Add(offset), Endpoint: "/ping", UserId: "alice"})
+    }
+    report, err := Simulate(config, events)
+    if err != nil {
+        t.Fatalf("Simulate: %v", err)
+    }
+    if want := (SimulationCount{Total: 4, Rejected: 1}); report.Total != want || report.Keys["alice#/ping"] != want {
+        t.Fatalf("report %+v, %+v expected", report, want)
+    }
+}
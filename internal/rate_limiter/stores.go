@@ -0,0 +1,73 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "log/slog"
+)
+
+// WithStores names the stores the endpoints can select with EndpointConfig.Store, e.g. critical login limits on Redis
+// and bulk analytics endpoints on a local memory store.
+//
+// Each store fails independently: an outage of one store only affects the endpoints using it, and the errors are
+// logged with the name of the store.
+func WithStores(stores map[string]ratelimiterstore.Store) Option {
+    return func(rl *rateLimiter) {
+        rl.stores = stores
+    }
+}
+
+// defaultStoreName names the store of NewRateLimiter in the logs.
+const defaultStoreName = "default"
+
+// storeFor returns the store of the endpoint and its name, falling back to the default store for unknown names.
+func (rl *rateLimiter) storeFor(ctx context.Context, endpoint string, conf EndpointConfig) (ratelimiterstore.Store, string) {
+    if conf.Store == "" {
+        return rl.store, defaultStoreName
+    }
+    if store, ok := rl.stores[conf.Store]; ok {
+        return store, conf.Store
+    }
+    rl.logThrottle.Log(ctx, rl.logger, slog.LevelWarn, "Unknown store, using the default store", "endpoint", endpoint, "store", conf.Store)
+    return rl.store, defaultStoreName
+}
+
+// Policies applied to a request when its store fails, selected with EndpointConfig.OnStoreError or
+// WithStoreErrorPolicy.
+const (
+    // StoreErrorAllow lets the request through unlimited, an outage of the store doesn't take the endpoint down
+    StoreErrorAllow = "allow"
+    // StoreErrorReject rejects the request, an outage of the store doesn't open the endpoint to abuse
+    StoreErrorReject = "reject"
+    // StoreErrorLocal limits the request with an in-process store, the limits are per instance during the outage
+    StoreErrorLocal = "local"
+)
+
+// fallbackStoreName names the in-process store of StoreErrorLocal in the logs.
+const fallbackStoreName = "local"
+
+// WithStoreErrorPolicy sets the policy of the endpoints without an EndpointConfig.OnStoreError when their store fails.
+//
+// Defaults to StoreErrorAllow if not specified
+func WithStoreErrorPolicy(policy string) Option {
+    return func(rl *rateLimiter) {
+        rl.onStoreError = policy
+    }
+}
+
+// storeErrorPolicy returns the policy of the endpoint when its store fails.
+func (rl *rateLimiter) storeErrorPolicy(conf EndpointConfig) string {
+    if conf.OnStoreError != "" {
+        return conf.OnStoreError
+    }
+    return rl.onStoreError
+}
+
+// validStoreErrorPolicy reports whether the policy is known, empty for the default.
+func validStoreErrorPolicy(policy string) bool {
+    switch policy {
+    case "", StoreErrorAllow, StoreErrorReject, StoreErrorLocal:
+        return true
+    }
+    return false
+}
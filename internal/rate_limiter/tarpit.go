@@ -0,0 +1,110 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+    "log/slog"
+    "strings"
+    "time"
+)
+
+type TarpitConfig struct {
+    // Delay between the chunks of the response
+    //
+    // Defaults to 1 second if not specified
+    Delay time.Duration `json:"delay,omitempty"`
+    // Chunks written before the response ends
+    //
+    // Defaults to 30 if not specified
+    Chunks int `json:"chunks,omitempty"`
+    // ChunkSize in bytes
+    //
+    // Defaults to 1 if not specified
+    ChunkSize int `json:"chunk_size,omitempty"`
+    // MaxConcurrent tarpitted requests, the rejections beyond it are fast 429s so the tarpit can't exhaust our own
+    // goroutines and connections
+    //
+    // Defaults to 100 if not specified
+    MaxConcurrent int `json:"max_concurrent,omitempty"`
+}
+
+type tarpit struct {
+    config  TarpitConfig
+    slots   chan struct{} // Holds a token per tarpitted request
+    flagger ratelimiterstore.Flagger
+    chunk   []byte
+}
+
+// WithTarpit rejects the requests of the users flagged as abusive, e.g. by a honeypot, by slowly dripping a 429
+// response instead of answering immediately, tying up the resources of scrapers.
+//
+// It requires a store implementing ratelimiterstore.Flagger, and is ignored otherwise.
+func WithTarpit(config TarpitConfig) Option {
+    return func(rl *rateLimiter) {
+        flagger, ok := rl.store.(ratelimiterstore.Flagger)
+        if !ok {
+            rl.logger.Warn("Store can't flag users, tarpit is disabled")
+            return
+        }
+        if config.Delay == 0 {
+            config.Delay = time.Second
+        }
+        if config.Chunks == 0 {
+            config.Chunks = 30
+        }
+        if config.ChunkSize == 0 {
+            config.ChunkSize = 1
+        }
+        if config.MaxConcurrent == 0 {
+            config.MaxConcurrent = 100
+        }
+        rl.tarpit = &tarpit{
+            config:  config,
+            slots:   make(chan struct{}, config.MaxConcurrent),
+            flagger: flagger,
+            chunk:   []byte(strings.Repeat(" ", config.ChunkSize)),
+        }
+    }
+}
+
+// reject tarpits the rejected request if the user is flagged as abusive and a slot is free, it reports false if the
+// request should be rejected normally.
+func (t *tarpit) reject(ctx context.Context, rl *rateLimiter, c *app.RequestContext, userId string) bool {
+    flagged, err := t.flagger.Flagged(ctx, userId, FlagAbusive)
+    if err != nil {
+        rl.logThrottle.Log(ctx, rl.logger, slog.LevelError, "Error retrieving flag", "error", err)
+        return false
+    }
+    if !flagged {
+        return false
+    }
+    select {
+    case t.slots <- struct{}{}:
+        defer func() { <-t.slots }()
+    default:
+        // The tarpit is full
+        return false
+    }
+
+    c.SetStatusCode(consts.StatusTooManyRequests)
+    c.Response.Header.SetContentType("application/json")
+    c.Response.HijackWriter(resp.NewChunkedBodyWriter(&c.Response, c.GetWriter()))
+    for i := 0; i < t.config.Chunks; i++ {
+        if _, err := c.Write(t.chunk); err != nil {
+            return true
+        }
+        if err := c.Flush(); err != nil {
+            // The client gave up
+            return true
+        }
+        if err := sleep(ctx, t.config.Delay); err != nil {
+            // The request is cancelled, e.g. the server is shutting down, free the slot
+            return true
+        }
+    }
+    _, _ = c.Write([]byte(`{"error":"Rate limit exceeded"}`))
+    return true
+}
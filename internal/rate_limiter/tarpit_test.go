@@ -0,0 +1,137 @@
+package rate_limiter
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/test/mock"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/protocol/http1/resp"
+    "strings"
+    "testing"
+    "time"
+)
+
+func newTarpit(t *testing.T, store ratelimiterstore.Store, conf TarpitConfig) RateLimiter {
+    t.Helper()
+    rl := NewRateLimiter(RateLimiterConfig{"/api": {MaxRequests: 1, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+        store, func(path []byte) string {
+            return string(path)
+        }, WithTarpit(conf))
+    t.Cleanup(func() {
+        _ = rl.Close()
+    })
+    return rl
+}
+
+// request serves a request of the ip through a connection, the tarpit writes its response to the connection itself.
+func request(ctx context.Context, t *testing.T, rl RateLimiter, ip string) *protocol.Response {
+    t.Helper()
+    c := app.NewContext(0)
+    conn := mock.NewConn("")
+    c.SetConn(conn)
+    c.Request.SetRequestURI("/api")
+    c.Request.Header.Set("X-Forwarded-For", ip)
+    c.SetHandlers(app.HandlersChain{rl.Middleware, func(_ context.Context, c *app.RequestContext) {
+        c.String(200, "ok")
+    }})
+    c.Next(ctx)
+    w := c.Response.GetHijackWriter()
+    if w == nil {
+        return &c.Response
+    }
+    if err := w.Finalize(); err != nil {
+        t.Errorf("Finalize: %v", err)
+    }
+    _ = conn.Flush()
+    r := &protocol.Response{}
+    if err := resp.Read(r, conn.WriterRecorder()); err != nil {
+        t.Errorf("Read: %v", err)
+    }
+    return r
+}
+
+func TestTarpit(t *testing.T) {
+    store := ratelimiterstore.NewMemoryStore()
+    rl := newTarpit(t, store, TarpitConfig{Delay: 50 * time.Millisecond, Chunks: 4, ChunkSize: 2})
+    if err := store.(ratelimiterstore.Flagger).Flag(context.Background(), "10.0.0.1", FlagAbusive, time.Hour); err != nil {
+        t.Fatalf("Flag: %v", err)
+    }
+    for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+        if resp := request(context.Background(), t, rl, ip); resp.StatusCode() != 200 {
+            t.Fatalf("first request of %s: %d", ip, resp.StatusCode())
+        }
+    }
+
+    // The rejection of the flagged user is dripped
+    start := time.Now()
+    resp := request(context.Background(), t, rl, "10.0.0.1")
+    if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+        t.Fatalf("flagged user rejected after %s, 4 chunks of 50ms expected", elapsed)
+    }
+    if resp.StatusCode() != 429 || string(resp.Body()) != strings.Repeat(" ", 8)+`{"error":"Rate limit exceeded"}` {
+        t.Fatalf("flagged user: %d %q", resp.StatusCode(), resp.Body())
+    }
+
+    // The others are rejected right away
+    start = time.Now()
+    resp = request(context.Background(), t, rl, "10.0.0.2")
+    if elapsed := time.Since(start); resp.StatusCode() != 429 || strings.HasPrefix(string(resp.Body()), " ") || elapsed >= 50*time.Millisecond {
+        t.Fatalf("user not flagged: %d %q after %s", resp.StatusCode(), resp.Body(), elapsed)
+    }
+}
+
+func TestTarpitFull(t *testing.T) {
+    store := ratelimiterstore.NewMemoryStore()
+    rl := newTarpit(t, store, TarpitConfig{Delay: 100 * time.Millisecond, Chunks: 3, MaxConcurrent: 1})
+    for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+        if err := store.(ratelimiterstore.Flagger).Flag(context.Background(), ip, FlagAbusive, time.Hour); err != nil {
+            t.Fatalf("Flag: %v", err)
+        }
+        request(context.Background(), t, rl, ip)
+    }
+
+    // The tarpit holds a single request, the other flagged users are rejected normally meanwhile
+    done := make(chan *protocol.Response)
+    go func() {
+        done <- request(context.Background(), t, rl, "10.0.0.1")
+    }()
+    time.Sleep(50 * time.Millisecond)
+    start := time.Now()
+    resp := request(context.Background(), t, rl, "10.0.0.2")
+    if elapsed := time.Since(start); resp.StatusCode() != 429 || elapsed >= 100*time.Millisecond {
+        t.Fatalf("request while the tarpit is full: %d after %s, a fast 429 expected", resp.StatusCode(), elapsed)
+    }
+    if resp := <-done; resp.StatusCode() != 429 || !strings.HasPrefix(string(resp.Body()), "   {") {
+        t.Fatalf("tarpitted request: %d %q", resp.StatusCode(), resp.Body())
+    }
+    // The slot is freed
+    if resp := request(context.Background(), t, rl, "10.0.0.2"); !strings.HasPrefix(string(resp.Body()), "   {") {
+        t.Fatalf("request once the tarpit is free: %q, tarpitted expected", resp.Body())
+    }
+}
+
+func TestTarpitCancelled(t *testing.T) {
+    store := ratelimiterstore.NewMemoryStore()
+    rl := newTarpit(t, store, TarpitConfig{Delay: time.Second, Chunks: 30, MaxConcurrent: 1})
+    if err := store.(ratelimiterstore.Flagger).Flag(context.Background(), "10.0.0.1", FlagAbusive, time.Hour); err != nil {
+        t.Fatalf("Flag: %v", err)
+    }
+    request(context.Background(), t, rl, "10.0.0.1")
+
+    // The server shutting down frees the request and its slot
+    ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    if resp := request(ctx, t, rl, "10.0.0.1"); resp.StatusCode() != 429 {
+        t.Fatalf("cancelled request: %d, 429 expected", resp.StatusCode())
+    }
+    if elapsed := time.Since(start); elapsed >= time.Second {
+        t.Fatalf("cancelled request tarpitted for %s", elapsed)
+    }
+    ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+    defer cancel()
+    if resp := request(ctx, t, rl, "10.0.0.1"); !strings.HasPrefix(string(resp.Body()), " ") {
+        t.Fatalf("request after a cancelled one: %q, tarpitted expected", resp.Body())
+    }
+}
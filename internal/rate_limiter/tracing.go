@@ -0,0 +1,69 @@
+package rate_limiter
+
+import (
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
+)
+
+// Names of the spans of the rate limiter.
+const (
+    // SpanDecision covers a decision, with the endpoint and whether the request was allowed
+    SpanDecision = "rate_limiter.decision"
+    // SpanStore covers the algorithm and its store calls, with the store
+    SpanStore = "rate_limiter.store"
+    // SpanMiddleware covers the rate limiting of a request by the middleware, with the endpoint, the decision and the
+    // remaining requests, and ends before the next handlers run
+    SpanMiddleware = "rate_limiter.middleware"
+)
+
+// Decisions recorded in the decision attribute of the spans.
+const (
+    DecisionAllowed  = "allowed"
+    DecisionRejected = "rejected"
+    // DecisionUnavailable is a request rejected because the store failed, see StoreErrorReject
+    DecisionUnavailable = "unavailable"
+    // DecisionExempt is a request of a method exempted from the limits, see WithMethods
+    DecisionExempt = "exempt"
+    // DecisionHoneypot is a request to a honeypot, whose client is flagged, see WithHoneypots
+    DecisionHoneypot = "honeypot"
+    // DecisionLongLived is a long-lived connection, limited while it is open, see WithConnectionLimits
+    DecisionLongLived = "long_lived"
+    // DecisionUnauthorized is a request whose key can't be extracted, see WithKeyExtractor
+    DecisionUnauthorized = "unauthorized"
+)
+
+// WithTracer traces the decisions of the rate limiter and their store calls, so the time a request spends being
+// limited shows in its trace.
+//
+// Defaults to tracing.Noop if not specified
+func WithTracer(tracer tracing.Tracer) Option {
+    return func(rl *rateLimiter) {
+        rl.tracer = tracer
+    }
+}
+
+// decisionName returns the decision of allowRequest, a request allowed because the store failed is allowed.
+func decisionName(allowed bool, err error) string {
+    switch {
+    case allowed:
+        return DecisionAllowed
+    case err != nil:
+        return DecisionUnavailable
+    default:
+        return DecisionRejected
+    }
+}
+
+// remainingAttributes returns the remaining requests of the decision as an attribute, none if the algorithm doesn't
+// count them.
+func remainingAttributes(d Decision) []tracing.Attribute {
+    if d.Limit == 0 {
+        return nil
+    }
+    return []tracing.Attribute{{Key: "remaining", Value: d.Remaining}}
+}
+
+// endSpan records the decision of the middleware and ends its span.
+func endSpan(span tracing.Span, decision string, attributes ...tracing.Attribute) {
+    span.SetAttributes(append(attributes, tracing.Attribute{Key: "decision", Value: decision})...)
+    span.End()
+}
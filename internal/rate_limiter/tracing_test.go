@@ -0,0 +1,132 @@
+package rate_limiter
+
+import (
+    "context"
+    "errors"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
+    "github.com/cloudwego/hertz/pkg/app"
+    "sync"
+    "testing"
+    "time"
+)
+
+// recordedSpan is a span ended by the recorder, with the name of its parent.
+type recordedSpan struct {
+    name, parent string
+    attributes   map[string]any
+    err          error
+}
+
+// recorder is a tracing.Tracer keeping the ended spans.
+type recorder struct {
+    mu    sync.Mutex
+    spans []*recordedSpan
+}
+
+type spanKey struct{}
+
+type span struct {
+    recorder *recorder
+    recorded *recordedSpan
+}
+
+func (r *recorder) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+    s := span{recorder: r, recorded: &recordedSpan{name: name, attributes: map[string]any{}}}
+    if parent, ok := ctx.Value(spanKey{}).(span); ok {
+        s.recorded.parent = parent.recorded.name
+    }
+    s.SetAttributes(attributes...)
+    return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s span) SetAttributes(attributes ...tracing.Attribute) {
+    for _, a := range attributes {
+        s.recorded.attributes[a.Key] = a.Value
+    }
+}
+
+func (s span) RecordError(err error) {
+    s.recorded.err = err
+}
+
+func (s span) End() {
+    s.recorder.mu.Lock()
+    defer s.recorder.mu.Unlock()
+    s.recorder.spans = append(s.recorder.spans, s.recorded)
+}
+
+// take returns the ended spans and forgets them.
+func (r *recorder) take() []*recordedSpan {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    spans := r.spans
+    r.spans = nil
+    return spans
+}
+
+// failingStore fails like a store that can't be reached.
+type failingStore struct {
+    ratelimiterstore.Store
+}
+
+func (failingStore) Get(context.Context, ratelimiterstore.RateLimiterKey) (int64, error) {
+    return 0, errors.New("connection refused")
+}
+
+func (failingStore) Set(context.Context, ratelimiterstore.RateLimiterKey, time.Time, time.Duration, time.Duration) error {
+    return errors.New("connection refused")
+}
+
+func TestTracer(t *testing.T) {
+    r := &recorder{}
+    config := RateLimiterConfig{"/api": {MaxRequests: 1, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}}
+    rl := NewRateLimiter(config, ratelimiterstore.NewMemoryStore(), func(path []byte) string {
+        return string(path)
+    }, WithTracer(r))
+    defer rl.Close()
+
+    for _, decision := range []string{DecisionAllowed, DecisionRejected} {
+        c := app.NewContext(0)
+        c.Request.SetRequestURI("/api")
+        c.Request.Header.Set("X-Forwarded-For", "10.0.0.1")
+        rl.Middleware(context.Background(), c)
+        // The store call is a child of the decision, a child of the middleware
+        spans := r.take()
+        if len(spans) != 3 || spans[0].name != SpanStore || spans[0].parent != SpanDecision ||
+            spans[1].name != SpanDecision || spans[1].parent != SpanMiddleware || spans[2].name != SpanMiddleware {
+            t.Fatalf("%s: spans %+v", decision, spans)
+        }
+        store, d, middleware := spans[0].attributes, spans[1].attributes, spans[2].attributes
+        if store["store"] == nil || d["endpoint"] != "/api" || d["decision"] != decision || d["allowed"] != (decision == DecisionAllowed) ||
+            middleware["endpoint"] != "/api" || middleware["decision"] != decision {
+            t.Fatalf("%s: attributes %v, %v and %v", decision, store, d, middleware)
+        }
+        if _, ok := d["store_latency"].(time.Duration); !ok {
+            t.Fatalf("%s: no store latency in %v", decision, d)
+        }
+    }
+
+    // The endpoints not limited are decided without the store
+    if _, err := rl.AllowRequest(context.Background(), "/healthz", "ip:10.0.0.1"); err != nil {
+        t.Fatalf("AllowRequest: %v", err)
+    }
+    if spans := r.take(); len(spans) != 1 || spans[0].name != SpanDecision || spans[0].attributes["decision"] != DecisionAllowed {
+        t.Fatalf("spans %+v, the decision only expected", spans)
+    }
+}
+
+func TestTracerStoreErrors(t *testing.T) {
+    r := &recorder{}
+    config := RateLimiterConfig{"/api": {MaxRequests: 1, TimeWindow: time.Minute, SlidingWindowInterval: time.Second, OnStoreError: StoreErrorReject}}
+    rl := NewRateLimiter(config, failingStore{ratelimiterstore.NewMemoryStore()}, nil, WithTracer(r))
+    defer rl.Close()
+    if _, err := rl.AllowRequest(context.Background(), "/api", "ip:10.0.0.1"); err == nil {
+        t.Fatalf("AllowRequest: the error of the store expected")
+    }
+    spans := r.take()
+    if len(spans) < 2 || spans[0].err == nil || spans[len(spans)-1].err == nil ||
+        spans[len(spans)-1].attributes["decision"] != DecisionUnavailable {
+        t.Fatalf("spans %+v, the store error recorded expected", spans)
+    }
+}
@@ -0,0 +1,84 @@
+package rate_limiter
+
+import (
+    "fmt"
+    "regexp"
+)
+
+type UserAgentFamily struct {
+    // Name of the family, e.g. mobile, web, partner-sdk or cli
+    Name string `json:"name"`
+    // Pattern is a regular expression matched against the User-Agent header
+    Pattern string `json:"pattern"`
+}
+
+// DefaultUserAgentFamilies tell command line tools, mobile apps and browsers apart. Families specific to an API, such
+// as a partner SDK, are usually declared before them.
+var DefaultUserAgentFamilies = []UserAgentFamily{
+    {Name: "cli", Pattern: `(?i)^(curl|wget|httpie|python-requests|go-http-client|okhttp)/`},
+    {Name: "mobile", Pattern: `(?i)(android|iphone|ipad|mobile)`},
+    {Name: "web", Pattern: `(?i)^mozilla/`},
+}
+
+// UnknownUserAgent is the family of the requests matching no family, or without a User-Agent.
+const UnknownUserAgent = "unknown"
+
+// UserAgentParser normalizes User-Agent headers to their family.
+type UserAgentParser struct {
+    families []UserAgentFamily
+    patterns []*regexp.Regexp
+}
+
+// NewUserAgentParser compiles the families, they are matched in order and the first matching one names the family.
+func NewUserAgentParser(families []UserAgentFamily) (*UserAgentParser, error) {
+    p := &UserAgentParser{families: families}
+    for _, f := range families {
+        re, err := regexp.Compile(f.Pattern)
+        if err != nil {
+            return nil, fmt.Errorf("failed to compile pattern of user agent family %s: %w", f.Name, err)
+        }
+        p.patterns = append(p.patterns, re)
+    }
+    return p, nil
+}
+
+// Family returns the family of the User-Agent, or UnknownUserAgent.
+func (p *UserAgentParser) Family(userAgent string) string {
+    for i, re := range p.patterns {
+        if re.MatchString(userAgent) {
+            return p.families[i].Name
+        }
+    }
+    return UnknownUserAgent
+}
+
+type userAgentOverrides struct {
+    parser    *UserAgentParser
+    overrides map[string]RateLimiterConfig
+}
+
+// WithUserAgentOverrides replaces the endpoint configurations for the requests of a User-Agent family, e.g. a partner
+// SDK legitimately needing higher limits than browsers.
+//
+// Configurations apply in order of precedence: exemptions and bans, the penalty of abusive users, the per-user
+// overrides, the identity overrides, the User-Agent family overrides, then the endpoint configuration.
+func WithUserAgentOverrides(parser *UserAgentParser, overrides map[string]RateLimiterConfig) Option {
+    return func(rl *rateLimiter) {
+        rl.userAgents = &userAgentOverrides{
+            parser:    parser,
+            overrides: overrides,
+        }
+    }
+}
+
+// userAgentOverride returns the configuration of the endpoint for the family of the User-Agent, if any.
+func (rl *rateLimiter) userAgentOverride(endpoint, userAgent string) *EndpointConfig {
+    if rl.userAgents == nil {
+        return nil
+    }
+    conf, ok := rl.userAgents.overrides[rl.userAgents.parser.Family(userAgent)][endpoint]
+    if !ok {
+        return nil
+    }
+    return &conf
+}
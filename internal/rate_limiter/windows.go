@@ -0,0 +1,113 @@
+package rate_limiter
+
+import (
+    "context"
+    "fmt"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "slices"
+    "time"
+)
+
+// WindowConfig is a limit enforced together with the one of its endpoint, see EndpointConfig.Windows.
+type WindowConfig struct {
+    // MaxRequests is the maximum number of requests allowed in the window
+    MaxRequests int `json:"max_requests"`
+    // TimeWindow of the limit, it must differ from the one of the endpoint and of its other windows
+    TimeWindow time.Duration `json:"time_window"`
+    // SlidingWindowInterval is used to round timestamps to the nearest boundary for rate limiting
+    //
+    // Defaults to the SlidingWindowInterval of the endpoint, or the TimeWindow if shorter, if not specified
+    SlidingWindowInterval time.Duration `json:"sliding_window_interval,omitempty"`
+}
+
+// limitWindow is a window of an endpoint counted in a budget of its own.
+type limitWindow struct {
+    conf   EndpointConfig
+    budget string
+}
+
+// windows returns the windows of the limit from the shortest to the longest. The window of the endpoint keeps the
+// budget, so adding windows to an endpoint doesn't reset its counters, the others are counted under the budget
+// suffixed with their time window, e.g. "/search|1h0m0s".
+func (c EndpointConfig) windows(budget string) []limitWindow {
+    windows := []limitWindow{{conf: c, budget: budget}}
+    for _, w := range c.Windows {
+        conf := c
+        conf.MaxRequests, conf.TimeWindow = w.MaxRequests, w.TimeWindow
+        conf.SlidingWindowInterval = w.SlidingWindowInterval
+        if conf.SlidingWindowInterval == 0 {
+            conf.SlidingWindowInterval = min(c.SlidingWindowInterval, w.TimeWindow)
+        }
+        windows = append(windows, limitWindow{conf: conf, budget: fmt.Sprintf("%s|%s", budget, w.TimeWindow)})
+    }
+    slices.SortStableFunc(windows, func(a, b limitWindow) int {
+        return int(a.conf.TimeWindow - b.conf.TimeWindow)
+    })
+    return windows
+}
+
+// validateWindows checks the windows of an endpoint can be told apart and used by the algorithms.
+func (c EndpointConfig) validateWindows(endpoint string) error {
+    seen := map[time.Duration]struct{}{c.TimeWindow: {}}
+    for _, w := range c.Windows {
+        if w.MaxRequests < 0 || w.TimeWindow <= 0 || w.SlidingWindowInterval < 0 {
+            return fmt.Errorf("endpoint %s has a window with a negative limit or without time window", endpoint)
+        }
+        if w.TimeWindow < time.Millisecond || (w.SlidingWindowInterval > 0 && w.SlidingWindowInterval < time.Millisecond) {
+            return fmt.Errorf("endpoint %s has a window shorter than a millisecond", endpoint)
+        }
+        if w.SlidingWindowInterval > w.TimeWindow {
+            return fmt.Errorf("endpoint %s has a window with a sliding window interval longer than its time window", endpoint)
+        }
+        if _, ok := seen[w.TimeWindow]; ok {
+            return fmt.Errorf("endpoint %s has several windows of %s", endpoint, w.TimeWindow)
+        }
+        seen[w.TimeWindow] = struct{}{}
+    }
+    return nil
+}
+
+// constrains tells whether the decision of a window leaves the user less room than the one of another window, so its
+// budget is the one told to the client: the fewest remaining requests, then the furthest reset.
+func (d decision) constrains(other decision) bool {
+    switch {
+    case d.Limit == 0:
+        return false
+    case other.Limit == 0 || d.Remaining != other.Remaining:
+        return other.Limit == 0 || d.Remaining < other.Remaining
+    }
+    return d.ResetAt.After(other.ResetAt)
+}
+
+// countBuckets counts the request for cost in every window at once with ratelimiterstore.BatchSetIfBelow, and returns
+// the count of each up to the first window rejecting the request. known tells the budget of the windows.
+func countBuckets(ctx context.Context, store ratelimiterstore.Store, algorithm BucketAlgorithm, key ratelimiterstore.RateLimiterKey, windows []limitWindow, now time.Time, cost int64, known bool) ([]windowCount, error) {
+    keys := make([]ratelimiterstore.BatchKey, len(windows))
+    for i, window := range windows {
+        windowKey := key
+        windowKey.Endpoint = window.budget
+        keys[i] = algorithm.BatchKey(windowKey, now, window.conf)
+        keys[i].Cost = cost
+    }
+    before, allowed, err := ratelimiterstore.BatchSetIfBelow(ctx, store, keys, now)
+    if err != nil {
+        return nil, fmt.Errorf("failed to set counts: %w", err)
+    }
+    counted := make([]windowCount, len(keys))
+    for i, k := range keys {
+        c := windowCount{known: known, allowance: max(k.Limit-before[i], 0), limit: int64(windows[i].conf.MaxRequests)}
+        c.allowed, c.remaining = allowed || before[i] <= k.Limit-cost, c.allowance
+        if allowed {
+            c.remaining -= cost
+        }
+        counted[i] = c
+        if !c.allowed {
+            return counted[:i+1], nil
+        }
+    }
+    if !allowed {
+        // The store rejected the request without a window over its limit, e.g. a store of its own, blame the longest
+        counted[len(counted)-1].allowed = false
+    }
+    return counted, nil
+}
@@ -0,0 +1,69 @@
+package rate_limiter
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "testing"
+    "time"
+)
+
+// A request rejected by a window of the endpoint is counted by none of its windows, whatever its cost.
+func TestWindowsCountAllOrNothing(t *testing.T) {
+    ctx := context.Background()
+    stores := map[string]func(t *testing.T) ratelimiterstore.Store{
+        "memory": func(*testing.T) ratelimiterstore.Store {
+            return ratelimiterstore.NewMemoryStore()
+        },
+        "redis": func(t *testing.T) ratelimiterstore.Store {
+            store, err := ratelimiterstore.NewRedisStore(ctx, miniredis.RunT(t).Addr(), 100)
+            if err != nil {
+                t.Fatalf("NewRedisStore: %v", err)
+            }
+            t.Cleanup(func() { _ = store.Close() })
+            return store
+        },
+    }
+    for name, newStore := range stores {
+        for _, algorithm := range []string{AlgorithmSlidingWindow, AlgorithmFixedWindow} {
+            t.Run(name+"/"+algorithm, func(t *testing.T) {
+                store := newStore(t)
+                conf := EndpointConfig{
+                    Algorithm:             algorithm,
+                    MaxRequests:           10,
+                    TimeWindow:            time.Minute,
+                    SlidingWindowInterval: time.Second,
+                    Windows:               []WindowConfig{{MaxRequests: 4, TimeWindow: time.Hour}},
+                }
+                rl := NewRateLimiter(RateLimiterConfig{"/search": conf}, store, nil).(*rateLimiter)
+                // The hour allows 4 requests, the batch of 4 and the requests after the batch of 3 are rejected by it
+                for i, cost := range []int64{1, 4, 3, 1, 1} {
+                    d, err := rl.allowRequest(ctx, "/search", "user", requestInfo{cost: cost, detail: true})
+                    if err != nil {
+                        t.Fatalf("allowRequest: %v", err)
+                    }
+                    if want := i == 0 || i == 2; d.Allowed != want {
+                        t.Fatalf("request %d for %d allowed: %t, expected %t", i, cost, d.Allowed, want)
+                    }
+                    if d.Limit != 4 {
+                        t.Fatalf("request %d told the limit %d of the minute rather than the hour", i, d.Limit)
+                    }
+                }
+                var keys []ratelimiterstore.BatchKey
+                for _, window := range conf.windows("/search") {
+                    key := ratelimiterstore.RateLimiterKey{UserId: "user", Endpoint: window.budget}
+                    keys = append(keys, rl.algorithms[algorithm].(BucketAlgorithm).BatchKey(key, time.Now(), window.conf))
+                }
+                counts, err := ratelimiterstore.BatchGet(ctx, store, keys, time.Now())
+                if err != nil {
+                    t.Fatalf("BatchGet: %v", err)
+                }
+                for i, count := range counts {
+                    if count != 4 {
+                        t.Fatalf("window %s counted %d requests, only the 4 allowed expected", keys[i].Key.Endpoint, count)
+                    }
+                }
+            })
+        }
+    }
+}
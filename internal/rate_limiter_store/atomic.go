@@ -0,0 +1,95 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+// addIfBelowLua sums the buckets of the key and increments the bucket of the current window in one round trip. The
+// bucket names are built from the prefixes in KEYS, the current one first and the legacy one during a schema
+// transition. The current buckets share the hash tag of their prefix so they are on the same cluster slot, the legacy
+// format predates the cluster support. It returns whether the cost was counted and the count before.
+//
+// The windows are in milliseconds and the buckets are named by the second their window starts, like windowKeys, so
+// the sub-second windows sharing a second are counted once.
+const addIfBelowLua = `
+local window = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local buckets = tonumber(ARGV[3])
+local limit = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[5])
+local cost = tonumber(ARGV[6])
+local count = 0
+for _, prefix in ipairs(KEYS) do
+    local last
+    for i = 0, buckets - 1 do
+        local second = math.floor((window - i * interval) / 1000)
+        if second ~= last then
+            count = count + (tonumber(redis.call("GET", prefix .. second)) or 0)
+            last = second
+        end
+    end
+end
+if count + cost > limit then
+    return {0, count}
+end
+local k = KEYS[1] .. math.floor(window / 1000)
+if redis.call("INCRBY", k, cost) == cost then
+    redis.call("EXPIRE", k, math.max(1, ttl))
+end
+return {1, count}
+`
+
+var addIfBelowScript = radix.NewEvalScript(addIfBelowLua)
+
+func (r *redis) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := r.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (r *redis) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    if windowInterval < time.Millisecond {
+        // No window the script can name, check and count in two steps
+        count, err := r.CountWindows(ctx, key, timestamp, windowInterval, ttl)
+        if err != nil || count > limit-cost {
+            return count, false, err
+        }
+        return count, true, r.incrBy(ctx, key, cost, timestamp, windowInterval, ttl)
+    }
+    window := WindowStart(timestamp, windowInterval).UnixMilli()
+    interval := windowInterval.Milliseconds()
+    buckets := windowCount(windowInterval, ttl)
+    prefixes := []string{r.keys.generateKeyPrefix(key)}
+    if time.Now().Before(r.legacyUntil) {
+        prefixes = append(prefixes, generateLegacyKeyPrefix(key))
+    }
+    var result []int64
+    if err := r.client.Do(ctx, addIfBelowScript.Cmd(&result, prefixes,
+        strconv.FormatInt(window, 10), strconv.FormatInt(interval, 10), strconv.FormatInt(buckets, 10), strconv.FormatInt(limit, 10),
+        strconv.Itoa(int(ttl.Seconds())), strconv.FormatInt(cost, 10))); err != nil {
+        return 0, false, fmt.Errorf("failed to set user %s for endpoint %s at %s: %w", key.UserId, key.Endpoint, timestamp, err)
+    }
+    if len(result) != 2 {
+        return 0, false, fmt.Errorf("unexpected reply %v to set user %s for endpoint %s", result, key.UserId, key.Endpoint)
+    }
+    return result[1], result[0] == 1, nil
+}
+
+func (m *memory) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := m.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (m *memory) AddIfBelow(_ context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    count, err := m.count(key)
+    if err != nil || count > limit-cost {
+        return count, false, err
+    }
+    m.increment(key, cost, timestamp, windowInterval, ttl)
+    return count, true, nil
+}
@@ -0,0 +1,66 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// Concurrent requests never take more than the limit, whatever the window: sub-second windows share the bucket of
+// their second and must still be checked and counted in one step.
+func TestRedisAddIfBelowIsAtomic(t *testing.T) {
+    for _, interval := range []time.Duration{100 * time.Millisecond, 1500 * time.Millisecond, 5 * time.Second} {
+        t.Run(interval.String(), func(t *testing.T) {
+            ctx := context.Background()
+            mr := miniredis.RunT(t)
+            store, err := NewRedisStore(ctx, mr.Addr(), 100)
+            if err != nil {
+                t.Fatalf("NewRedisStore: %v", err)
+            }
+            defer store.Close()
+            key := RateLimiterKey{Endpoint: "/ping", UserId: "user"}
+            const limit = 10
+            now := time.Now()
+            ttl := 10 * interval
+            var (
+                wg      sync.WaitGroup
+                allowed atomic.Int64
+            )
+            for range 50 {
+                wg.Add(1)
+                go func() {
+                    defer wg.Done()
+                    ok, err := store.(AtomicStore).SetIfBelow(ctx, key, limit, now, interval, ttl)
+                    if err != nil {
+                        t.Errorf("SetIfBelow: %v", err)
+                    }
+                    if ok {
+                        allowed.Add(1)
+                    }
+                }()
+            }
+            wg.Wait()
+            if n := allowed.Load(); n != limit {
+                t.Fatalf("%d requests allowed, %d expected", n, limit)
+            }
+            count, err := store.(WindowCounter).CountWindows(ctx, key, now, interval, ttl)
+            if err != nil {
+                t.Fatalf("CountWindows: %v", err)
+            }
+            if count != limit {
+                t.Fatalf("counted %d, %d expected", count, limit)
+            }
+            // The next window still counts the requests of this one
+            count, _, err = store.(AtomicStore).AddIfBelow(ctx, key, 1, limit, now.Add(interval), interval, ttl)
+            if err != nil {
+                t.Fatalf("AddIfBelow: %v", err)
+            }
+            if count != limit {
+                t.Fatalf("AddIfBelow counted %d in the next window, %d expected", count, limit)
+            }
+        })
+    }
+}
@@ -0,0 +1,345 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "slices"
+    "strconv"
+    "time"
+)
+
+// BatchGet returns the counts of the keys in one round trip with a store implementing BatchStore, and key by key
+// otherwise.
+func BatchGet(ctx context.Context, store Store, keys []BatchKey, now time.Time) ([]int64, error) {
+    if batch, ok := store.(BatchStore); ok {
+        return batch.BatchGet(ctx, keys, now)
+    }
+    return getEach(ctx, store, keys, now)
+}
+
+// BatchSet counts a request for every key in one round trip with a store implementing BatchStore, and key by key
+// otherwise.
+func BatchSet(ctx context.Context, store Store, keys []BatchKey, timestamp time.Time) error {
+    if batch, ok := store.(BatchStore); ok {
+        return batch.BatchSet(ctx, keys, timestamp)
+    }
+    return setEach(ctx, store, keys, timestamp)
+}
+
+// getEach counts the keys one at a time, finding their buckets by name if the store can rather than with Get.
+func getEach(ctx context.Context, store Store, keys []BatchKey, now time.Time) ([]int64, error) {
+    counts := make([]int64, len(keys))
+    for i, k := range keys {
+        var err error
+        if counter, ok := store.(WindowCounter); ok {
+            counts[i], err = counter.CountWindows(ctx, k.Key, now, k.WindowInterval, k.TTL)
+        } else {
+            counts[i], err = store.Get(ctx, k.Key)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    return counts, nil
+}
+
+// setEach counts a request for the keys one at a time.
+func setEach(ctx context.Context, store Store, keys []BatchKey, timestamp time.Time) error {
+    for _, k := range keys {
+        if err := store.Set(ctx, k.Key, timestamp, k.WindowInterval, k.TTL); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// batchWindowKeys returns the names of the buckets of every key, and where the buckets of each key end in them. It
+// returns false if a key has no window to derive the names from.
+func batchWindowKeys(format func(RateLimiterKey, time.Time) string, keys []BatchKey, now time.Time) ([]string, []int, bool) {
+    var names []string
+    ends := make([]int, len(keys))
+    for i, k := range keys {
+        if k.WindowInterval <= 0 {
+            return nil, nil, false
+        }
+        names = append(names, windowKeys(format, k.Key, now, k.WindowInterval, k.TTL)...)
+        ends[i] = len(names)
+    }
+    return names, ends, true
+}
+
+// sumBatch sums the values of the buckets of every key, missing buckets count for 0.
+func sumBatch(names []string, ends []int, values []*int64) ([]int64, error) {
+    if len(values) != len(names) {
+        return nil, fmt.Errorf("unexpected reply of %d values to fetch %d rate limiters", len(values), len(names))
+    }
+    counts := make([]int64, len(ends))
+    start := 0
+    for i, end := range ends {
+        var err error
+        for j := start; j < end; j++ {
+            if values[j] == nil {
+                continue
+            }
+            if counts[i], err = AddCount(counts[i], *values[j]); err != nil {
+                return nil, fmt.Errorf("failed to count rate limiter %s with value %d: %w", names[j], *values[j], err)
+            }
+        }
+        start = end
+    }
+    return counts, nil
+}
+
+// batchSetLua increments the buckets in KEYS and sets the TTL in seconds of the matching ARGV on the new ones.
+const batchSetLua = `
+for i, k in ipairs(KEYS) do
+    if redis.call("INCR", k) == 1 then
+        redis.call("EXPIRE", k, math.max(1, tonumber(ARGV[i])))
+    end
+end
+return 0
+`
+
+var batchSetScript = radix.NewEvalScript(batchSetLua)
+
+// BatchGet reads the buckets of every key with a single MGET, from the replica while it is fresh. The keys of a batch
+// are on different cluster slots, and the legacy buckets of a schema transition are read along the current ones, so
+// the keys are then counted one at a time.
+func (r *redis) BatchGet(ctx context.Context, keys []BatchKey, now time.Time) ([]int64, error) {
+    names, ends, ok := batchWindowKeys(r.keys.generateKey, keys, now)
+    if _, isCluster := cluster(r.client); !ok || isCluster || len(names) == 0 || time.Now().Before(r.legacyUntil) {
+        return getEach(ctx, r, keys, now)
+    }
+    mget := func(client radix.Client) ([]int64, error) {
+        var values []*int64
+        if err := client.Do(ctx, radix.Cmd(&values, "MGET", names...)); err != nil {
+            return nil, fmt.Errorf("failed to fetch rate limiters %s: %w", names[0], err)
+        }
+        return sumBatch(names, ends, values)
+    }
+    if r.replica != nil && r.replica.usable(ctx) {
+        if counts, err := mget(r.replica.client); err == nil {
+            return counts, nil
+        }
+        // Fall back to the primary, the replica is checked again on the next interval
+    }
+    return mget(r.client)
+}
+
+// BatchSet increments the buckets of every key with a single script, key by key on a cluster.
+func (r *redis) BatchSet(ctx context.Context, keys []BatchKey, timestamp time.Time) error {
+    if _, ok := cluster(r.client); ok || len(keys) == 0 {
+        return setEach(ctx, r, keys, timestamp)
+    }
+    names := make([]string, len(keys))
+    ttls := make([]string, len(keys))
+    for i, k := range keys {
+        names[i] = r.keys.generateKey(k.Key, WindowStart(timestamp, k.WindowInterval))
+        ttls[i] = strconv.Itoa(int(k.TTL.Seconds()))
+    }
+    if err := r.client.Do(ctx, batchSetScript.Cmd(nil, names, ttls...)); err != nil {
+        return fmt.Errorf("failed to set rate limiters %s at %s: %w", names[0], timestamp, err)
+    }
+    return nil
+}
+
+// BatchGet reads the buckets of every key with a single MGET.
+func (r *restRedis) BatchGet(ctx context.Context, keys []BatchKey, now time.Time) ([]int64, error) {
+    names, ends, ok := batchWindowKeys(r.keys.generateKey, keys, now)
+    if !ok || len(names) == 0 {
+        return getEach(ctx, r, keys, now)
+    }
+    var raw []*string
+    if err := r.do(ctx, &raw, append([]any{"MGET"}, stringsToAny(names)...)...); err != nil {
+        return nil, fmt.Errorf("failed to fetch rate limiters %s: %w", names[0], err)
+    }
+    values := make([]*int64, len(raw))
+    for i, v := range raw {
+        if v == nil {
+            continue
+        }
+        c, err := strconv.ParseInt(*v, 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse rate limiter %s: %w", names[i], err)
+        }
+        values[i] = &c
+    }
+    return sumBatch(names, ends, values)
+}
+
+// BatchSet increments the buckets of every key in one request, the TTL is only set on the new buckets.
+func (r *restRedis) BatchSet(ctx context.Context, keys []BatchKey, timestamp time.Time) error {
+    if len(keys) == 0 {
+        return nil
+    }
+    cmds := make([][]any, 0, 2*len(keys))
+    for _, k := range keys {
+        name := r.keys.generateKey(k.Key, WindowStart(timestamp, k.WindowInterval))
+        cmds = append(cmds, []any{"INCRBY", name, 1}, []any{"EXPIRE", name, max(int64(k.TTL.Seconds()), 1), "NX"})
+    }
+    if err := r.pipeline(ctx, cmds...); err != nil {
+        return fmt.Errorf("failed to set rate limiters %s at %s: %w", cmds[0][1], timestamp, err)
+    }
+    return nil
+}
+
+// BatchSetIfBelow counts a request for every key if all of them are below their limit, atomically with a store
+// implementing AtomicBatchStore. The other stores are checked with BatchGet then counted with BatchSet: concurrent
+// requests can then all take the last free slot, but a rejected request still counts on none of the keys.
+func BatchSetIfBelow(ctx context.Context, store Store, keys []BatchKey, timestamp time.Time) ([]int64, bool, error) {
+    if batch, ok := store.(AtomicBatchStore); ok {
+        return batch.BatchSetIfBelow(ctx, keys, timestamp)
+    }
+    return setEachIfBelow(ctx, store, keys, timestamp)
+}
+
+// setEachIfBelow checks the keys then counts the request in two steps.
+func setEachIfBelow(ctx context.Context, store Store, keys []BatchKey, timestamp time.Time) ([]int64, bool, error) {
+    counts, err := BatchGet(ctx, store, keys, timestamp)
+    if err != nil {
+        return nil, false, err
+    }
+    cost := int64(1)
+    for i, k := range keys {
+        if counts[i] > k.Limit-k.cost() {
+            return counts, false, nil
+        }
+        cost = max(cost, k.cost())
+    }
+    // BatchSet counts a single request, the keys of a lower cost are left out once counted for it
+    for n := range cost {
+        pending := slices.DeleteFunc(slices.Clone(keys), func(k BatchKey) bool {
+            return k.cost() <= n
+        })
+        if err := BatchSet(ctx, store, pending, timestamp); err != nil {
+            return counts, false, err
+        }
+    }
+    return counts, true, nil
+}
+
+// cost returns the cost of the key, 1 if not specified.
+func (k BatchKey) cost() int64 {
+    return max(k.Cost, 1)
+}
+
+// batchSetIfBelowLua sums the buckets of every key like addIfBelowLua, then increments the bucket of the current window
+// of every key by its cost if all of them stay within their limit. The bucket names are built from the prefixes in KEYS,
+// ARGV holds the window and interval in milliseconds, number of buckets, limit, TTL in seconds and cost of every key in
+// turn. It returns whether the request was counted followed by the counts before.
+const batchSetIfBelowLua = `
+local reply = {1}
+for i, prefix in ipairs(KEYS) do
+    local a = (i - 1) * 6
+    local window = tonumber(ARGV[a + 1])
+    local interval = tonumber(ARGV[a + 2])
+    local count = 0
+    local last
+    for j = 0, tonumber(ARGV[a + 3]) - 1 do
+        local second = math.floor((window - j * interval) / 1000)
+        if second ~= last then
+            count = count + (tonumber(redis.call("GET", prefix .. second)) or 0)
+            last = second
+        end
+    end
+    reply[i + 1] = count
+    if count + tonumber(ARGV[a + 6]) > tonumber(ARGV[a + 4]) then
+        reply[1] = 0
+    end
+end
+if reply[1] == 0 then
+    return reply
+end
+for i, prefix in ipairs(KEYS) do
+    local a = (i - 1) * 6
+    local k = prefix .. math.floor(tonumber(ARGV[a + 1]) / 1000)
+    local cost = tonumber(ARGV[a + 6])
+    if redis.call("INCRBY", k, cost) == cost then
+        redis.call("EXPIRE", k, math.max(1, tonumber(ARGV[a + 5])))
+    end
+end
+return reply
+`
+
+var batchSetIfBelowScript = radix.NewEvalScript(batchSetIfBelowLua)
+
+// batchSetIfBelowArgs returns the prefixes and the arguments of batchSetIfBelowLua. It returns false if a key has no
+// window the script can name, shorter than a millisecond.
+func batchSetIfBelowArgs(keys keyspace, batch []BatchKey, timestamp time.Time) ([]string, []string, bool) {
+    prefixes := make([]string, len(batch))
+    args := make([]string, 0, 6*len(batch))
+    for i, k := range batch {
+        if k.WindowInterval < time.Millisecond {
+            return nil, nil, false
+        }
+        prefixes[i] = keys.generateKeyPrefix(k.Key)
+        args = append(args,
+            strconv.FormatInt(WindowStart(timestamp, k.WindowInterval).UnixMilli(), 10),
+            strconv.FormatInt(k.WindowInterval.Milliseconds(), 10),
+            strconv.FormatInt(windowCount(k.WindowInterval, k.TTL), 10),
+            strconv.FormatInt(k.Limit, 10),
+            strconv.Itoa(int(k.TTL.Seconds())),
+            strconv.FormatInt(k.cost(), 10))
+    }
+    return prefixes, args, true
+}
+
+// batchSetIfBelowResult splits the reply of batchSetIfBelowLua.
+func batchSetIfBelowResult(result []int64, keys []BatchKey) ([]int64, bool, error) {
+    if len(result) != len(keys)+1 {
+        return nil, false, fmt.Errorf("unexpected reply %v to set %d rate limiters", result, len(keys))
+    }
+    return result[1:], result[0] == 1, nil
+}
+
+// BatchSetIfBelow checks and counts every key with a single script. The keys of a batch are on different cluster
+// slots, and the legacy buckets of a schema transition would need to be read along the current ones, so the keys are
+// then checked and counted in two steps.
+func (r *redis) BatchSetIfBelow(ctx context.Context, keys []BatchKey, timestamp time.Time) ([]int64, bool, error) {
+    prefixes, args, ok := batchSetIfBelowArgs(r.keys, keys, timestamp)
+    if _, isCluster := cluster(r.client); !ok || isCluster || len(keys) == 0 || time.Now().Before(r.legacyUntil) {
+        return setEachIfBelow(ctx, r, keys, timestamp)
+    }
+    var result []int64
+    if err := r.client.Do(ctx, batchSetIfBelowScript.Cmd(&result, prefixes, args...)); err != nil {
+        return nil, false, fmt.Errorf("failed to set rate limiters %s at %s: %w", prefixes[0], timestamp, err)
+    }
+    return batchSetIfBelowResult(result, keys)
+}
+
+// BatchSetIfBelow checks and counts every key with the script of the Redis store.
+func (r *restRedis) BatchSetIfBelow(ctx context.Context, keys []BatchKey, timestamp time.Time) ([]int64, bool, error) {
+    prefixes, args, ok := batchSetIfBelowArgs(r.keys, keys, timestamp)
+    if !ok || len(keys) == 0 {
+        return setEachIfBelow(ctx, r, keys, timestamp)
+    }
+    cmd := append([]any{"EVAL", batchSetIfBelowLua, len(prefixes)}, stringsToAny(prefixes)...)
+    var result []int64
+    if err := r.do(ctx, &result, append(cmd, stringsToAny(args)...)...); err != nil {
+        return nil, false, fmt.Errorf("failed to set rate limiters %s at %s: %w", prefixes[0], timestamp, err)
+    }
+    return batchSetIfBelowResult(result, keys)
+}
+
+// BatchSetIfBelow checks and counts every key under the lock of the store.
+func (m *memory) BatchSetIfBelow(_ context.Context, keys []BatchKey, timestamp time.Time) ([]int64, bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    counts := make([]int64, len(keys))
+    below := true
+    for i, k := range keys {
+        var err error
+        if counts[i], err = m.count(k.Key); err != nil {
+            return nil, false, err
+        }
+        below = below && counts[i] <= k.Limit-k.cost()
+    }
+    if !below {
+        return counts, false, nil
+    }
+    for _, k := range keys {
+        m.increment(k.Key, k.cost(), timestamp, k.WindowInterval, k.TTL)
+    }
+    return counts, true, nil
+}
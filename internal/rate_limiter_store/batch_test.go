@@ -0,0 +1,61 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    "testing"
+    "time"
+)
+
+// twoSteps hides the AtomicBatchStore of a store, so BatchSetIfBelow checks then counts the keys.
+type twoSteps struct {
+    Store
+}
+
+// BatchSetIfBelow counts the cost of every key or of none, in one step or two.
+func TestBatchSetIfBelowCost(t *testing.T) {
+    ctx := context.Background()
+    mr := miniredis.RunT(t)
+    redis, err := NewRedisStore(ctx, mr.Addr(), 100)
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    defer redis.Close()
+    stores := map[string]Store{
+        "memory":          NewMemoryStore(),
+        "redis":           redis,
+        "memory_two_step": twoSteps{NewMemoryStore()},
+    }
+    for name, store := range stores {
+        t.Run(name, func(t *testing.T) {
+            user := RateLimiterKey{Endpoint: "/ping", UserId: name}
+            global := RateLimiterKey{Endpoint: "/ping", UserId: "global-" + name}
+            now := time.Now()
+            keys := func(cost int64) []BatchKey {
+                return []BatchKey{
+                    {Key: user, WindowInterval: time.Second, TTL: time.Minute, Limit: 10, Cost: cost},
+                    {Key: global, WindowInterval: time.Second, TTL: time.Minute, Limit: 5},
+                }
+            }
+            // The global key is charged a single request, the user key the cost
+            for i, step := range []struct {
+                cost    int64
+                allowed bool
+                before  []int64
+            }{
+                {cost: 4, allowed: true, before: []int64{0, 0}},
+                {cost: 7, allowed: false, before: []int64{4, 1}},
+                {cost: 6, allowed: true, before: []int64{4, 1}},
+                {cost: 0, allowed: false, before: []int64{10, 2}},
+            } {
+                before, allowed, err := BatchSetIfBelow(ctx, store, keys(step.cost), now)
+                if err != nil {
+                    t.Fatalf("BatchSetIfBelow: %v", err)
+                }
+                if allowed != step.allowed || before[0] != step.before[0] || before[1] != step.before[1] {
+                    t.Fatalf("step %d counted %t from %v, %t from %v expected", i, allowed, before, step.allowed, step.before)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,339 @@
+package rate_limiter_store
+
+import (
+    "bytes"
+    "context"
+    "encoding/binary"
+    "fmt"
+    bolt "go.etcd.io/bbolt"
+    "log/slog"
+    "net/url"
+    "time"
+)
+
+var (
+    boltBuckets = []byte("buckets")
+    boltSeen    = []byte("seen")
+    boltFlags   = []byte("flags")
+)
+
+type BoltConfig struct {
+    // Path of the database file, created if it doesn't exist
+    Path string `json:"path"`
+    // PruneInterval is the interval between two deletions of the expired buckets, request ids and flags
+    //
+    // Defaults to 1 minute if not specified
+    PruneInterval time.Duration `json:"prune_interval,omitempty"`
+    // OpenTimeout is how long to wait for another process holding the database file to release it
+    //
+    // Defaults to 1 second if not specified
+    OpenTimeout time.Duration `json:"open_timeout,omitempty"`
+    // Logger logs the errors of the store in the background
+    //
+    // Defaults to slog.Default() if not specified
+    Logger *slog.Logger `json:"-"`
+}
+
+// bolt has no expiry, every value starts with its expiry in unix milliseconds and the expired values are skipped until
+// they are pruned. The rate limiter buckets hold their count after it.
+type boltStore struct {
+    db     *bolt.DB
+    logger *slog.Logger
+    cancel context.CancelFunc
+    // done is closed once the pruning stopped and the file is closed, with the error of closing it in closeErr
+    done     chan struct{}
+    closeErr error
+}
+
+// NewBoltStore creates a Store persisting the counts in a bbolt file, for CLI tools and desktop agents embedding the
+// limiter without a database server.
+//
+// bbolt has a single writer, so a request is checked and counted in one transaction, see AtomicStore. The file is
+// locked by the process, another process opening it waits up to OpenTimeout. The expired values are pruned every
+// PruneInterval until ctx is done or the store is closed, the database is then closed and the file unlocked.
+func NewBoltStore(ctx context.Context, config BoltConfig) (Store, error) {
+    if config.PruneInterval == 0 {
+        config.PruneInterval = time.Minute
+    }
+    if config.OpenTimeout == 0 {
+        config.OpenTimeout = time.Second
+    }
+    db, err := bolt.Open(config.Path, 0o600, &bolt.Options{Timeout: config.OpenTimeout})
+    if err != nil {
+        return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+    }
+    err = db.Update(func(tx *bolt.Tx) error {
+        for _, name := range [][]byte{boltBuckets, boltSeen, boltFlags} {
+            if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        _ = db.Close()
+        return nil, fmt.Errorf("failed to create the buckets of %s: %w", config.Path, err)
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    b := &boltStore{db: db, logger: storeLogger(config.Logger), cancel: cancel, done: make(chan struct{})}
+    go b.prune(ctx, config.PruneInterval)
+    return b, nil
+}
+
+func (b *boltStore) prune(ctx context.Context, interval time.Duration) {
+    defer func() {
+        b.closeErr = b.db.Close()
+        close(b.done)
+    }()
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        now := time.Now().UnixMilli()
+        err := b.db.Update(func(tx *bolt.Tx) error {
+            for _, name := range [][]byte{boltBuckets, boltSeen, boltFlags} {
+                bucket := tx.Bucket(name)
+                var expired [][]byte
+                err := bucket.ForEach(func(k, v []byte) error {
+                    if boltExpiresAt(v) <= now {
+                        expired = append(expired, k)
+                    }
+                    return nil
+                })
+                if err != nil {
+                    return err
+                }
+                for _, k := range expired {
+                    if err = bucket.Delete(k); err != nil {
+                        return err
+                    }
+                }
+            }
+            return nil
+        })
+        if err != nil {
+            b.logger.Error("Error pruning expired values", "error", err)
+        }
+    }
+}
+
+// boltPrefix is the prefix of the names of the buckets of the key, the parts are query escaped so they can't contain
+// the separator.
+func boltPrefix(key RateLimiterKey) []byte {
+    return []byte(url.QueryEscape(key.UserId) + "#" + url.QueryEscape(key.Endpoint) + "#")
+}
+
+// generateBoltKey appends the start of the window, big endian so the buckets of a key are sorted by window.
+func generateBoltKey(key RateLimiterKey, timestampWindow time.Time) []byte {
+    return binary.BigEndian.AppendUint64(boltPrefix(key), uint64(timestampWindow.UnixMilli()))
+}
+
+func generateBoltSeenKey(key RateLimiterKey, requestId string) []byte {
+    return append(boltPrefix(key), url.QueryEscape(requestId)...)
+}
+
+func generateBoltFlagKey(userId, flag string) []byte {
+    return []byte(url.QueryEscape(flag) + ":" + url.QueryEscape(userId))
+}
+
+func boltExpiresAt(v []byte) int64 {
+    if len(v) < 8 {
+        return 0
+    }
+    return int64(binary.BigEndian.Uint64(v))
+}
+
+func (b *boltStore) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    return b.CountWindows(ctx, key, time.Time{}, 0, 0)
+}
+
+// count sums the buckets of the key that have not expired, from the window starting at since.
+func (b *boltStore) count(tx *bolt.Tx, key RateLimiterKey, since int64) (int64, error) {
+    prefix := boltPrefix(key)
+    now := time.Now().UnixMilli()
+    var count int64
+    c := tx.Bucket(boltBuckets).Cursor()
+    for k, v := c.Seek(binary.BigEndian.AppendUint64(prefix, uint64(max(since, 0)))); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+        if len(v) != 16 || boltExpiresAt(v) <= now {
+            continue
+        }
+        var err error
+        if count, err = AddCount(count, int64(binary.BigEndian.Uint64(v[8:]))); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+        }
+    }
+    return count, nil
+}
+
+func (b *boltStore) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    err := b.db.Update(func(tx *bolt.Tx) error {
+        return b.increment(tx, key, 1, timestamp, windowInterval, ttl)
+    })
+    if err != nil {
+        return fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// increment counts a request for cost in the bucket of the timestamp, starting the bucket over if it expired.
+func (b *boltStore) increment(tx *bolt.Tx, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    bucket := tx.Bucket(boltBuckets)
+    k := generateBoltKey(key, WindowStart(timestamp, windowInterval))
+    now := time.Now()
+    expiresAt, count := now.Add(ttl).UnixMilli(), cost
+    if v := bucket.Get(k); len(v) == 16 && boltExpiresAt(v) > now.UnixMilli() {
+        expiresAt, count = boltExpiresAt(v), int64(binary.BigEndian.Uint64(v[8:]))+cost
+    }
+    v := binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, uint64(expiresAt)), uint64(count))
+    return bucket.Put(k, v)
+}
+
+func (b *boltStore) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    var count int64
+    err := b.db.View(func(tx *bolt.Tx) (err error) {
+        count, err = b.count(tx, key, boltSince(now, windowInterval, ttl))
+        return err
+    })
+    return count, err
+}
+
+// boltSince returns the start of the oldest window whose bucket can still exist at now, see windowCount.
+func boltSince(now time.Time, windowInterval, ttl time.Duration) int64 {
+    if windowInterval <= 0 {
+        return 0
+    }
+    return WindowStart(now, windowInterval).Add(-time.Duration(windowCount(windowInterval, ttl)-1) * windowInterval).UnixMilli()
+}
+
+func (b *boltStore) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    prefix := boltPrefix(key)
+    current := time.Now().UnixMilli()
+    var oldest int64
+    err := b.db.View(func(tx *bolt.Tx) error {
+        c := tx.Bucket(boltBuckets).Cursor()
+        for k, v := c.Seek(binary.BigEndian.AppendUint64(prefix, uint64(boltSince(now, windowInterval, ttl)))); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+            if expiresAt := boltExpiresAt(v); expiresAt > current && (oldest == 0 || expiresAt < oldest) {
+                oldest = expiresAt
+            }
+        }
+        return nil
+    })
+    if err != nil || oldest == 0 {
+        return 0, err
+    }
+    return time.Duration(oldest-current) * time.Millisecond, nil
+}
+
+func (b *boltStore) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := b.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (b *boltStore) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (count int64, added bool, err error) {
+    if err = ctx.Err(); err != nil {
+        return 0, false, err
+    }
+    err = b.db.Update(func(tx *bolt.Tx) error {
+        if count, err = b.count(tx, key, boltSince(timestamp, windowInterval, ttl)); err != nil || count > limit-cost {
+            return err
+        }
+        added = true
+        return b.increment(tx, key, cost, timestamp, windowInterval, ttl)
+    })
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return count, added, nil
+}
+
+func (b *boltStore) Reset(ctx context.Context, key RateLimiterKey) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    prefix := boltPrefix(key)
+    err := b.db.Update(func(tx *bolt.Tx) error {
+        for _, name := range [][]byte{boltBuckets, boltSeen} {
+            bucket := tx.Bucket(name)
+            // Deleting under a cursor skips the next key, collect them first
+            var keys [][]byte
+            c := bucket.Cursor()
+            for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+                keys = append(keys, k)
+            }
+            for _, k := range keys {
+                if err := bucket.Delete(k); err != nil {
+                    return err
+                }
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("failed to reset rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// Close stops the pruning and waits for the file to be closed and unlocked, so another process can open it.
+func (b *boltStore) Close() error {
+    b.cancel()
+    <-b.done
+    return b.closeErr
+}
+
+func (b *boltStore) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    return b.exists(ctx, boltSeen, generateBoltSeenKey(key, requestId))
+}
+
+func (b *boltStore) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    return b.mark(ctx, boltSeen, generateBoltSeenKey(key, requestId), ttl)
+}
+
+func (b *boltStore) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    return b.mark(ctx, boltFlags, generateBoltFlagKey(userId, flag), ttl)
+}
+
+func (b *boltStore) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    return b.exists(ctx, boltFlags, generateBoltFlagKey(userId, flag))
+}
+
+func (b *boltStore) exists(ctx context.Context, name, k []byte) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
+    }
+    var ok bool
+    err := b.db.View(func(tx *bolt.Tx) error {
+        ok = boltExpiresAt(tx.Bucket(name).Get(k)) > time.Now().UnixMilli()
+        return nil
+    })
+    if err != nil {
+        return false, fmt.Errorf("failed to check %s: %w", k, err)
+    }
+    return ok, nil
+}
+
+func (b *boltStore) mark(ctx context.Context, name, k []byte, ttl time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    err := b.db.Update(func(tx *bolt.Tx) error {
+        return tx.Bucket(name).Put(k, binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(ttl).UnixMilli())))
+    })
+    if err != nil {
+        return fmt.Errorf("failed to set %s: %w", k, err)
+    }
+    return nil
+}
@@ -0,0 +1,191 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "errors"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/jackc/pgx/v5/pgproto3"
+    "go.uber.org/goleak"
+    "net"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+// use counts a request so the store starts its connections before it is closed.
+func use(t *testing.T, store Store) {
+    t.Helper()
+    key := RateLimiterKey{Endpoint: "/ping", UserId: "user"}
+    if err := store.Set(context.Background(), key, time.Now(), time.Second, time.Minute); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+}
+
+func TestRedisCloseLeavesNoGoroutine(t *testing.T) {
+    mr := miniredis.RunT(t)
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    store, err := NewRedisStore(context.Background(), mr.Addr(), 100)
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    use(t, store)
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+}
+
+func TestSQLiteCloseLeavesNoGoroutine(t *testing.T) {
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    store, err := NewSQLiteStore(context.Background(), SQLiteConfig{Path: filepath.Join(t.TempDir(), "ratelimiter.db")})
+    if err != nil {
+        t.Fatalf("NewSQLiteStore: %v", err)
+    }
+    use(t, store)
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+}
+
+func TestSnapshotCloseLeavesNoGoroutine(t *testing.T) {
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    objects := NewDirObjectStore(t.TempDir())
+    store, err := NewSnapshotMemoryStore(context.Background(), objects, SnapshotConfig{})
+    if err != nil {
+        t.Fatalf("NewSnapshotMemoryStore: %v", err)
+    }
+    use(t, store)
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    // The final snapshot is saved by Close
+    if _, err := objects.Get(context.Background(), "ratelimiter/snapshot.json"); err != nil {
+        t.Fatalf("final snapshot: %v", err)
+    }
+}
+
+func TestLocalCloseLeavesNoGoroutine(t *testing.T) {
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    // Unix socket paths are short, keep out of the long test directories
+    dir, err := os.MkdirTemp("", "local")
+    if err != nil {
+        t.Fatalf("MkdirTemp: %v", err)
+    }
+    defer os.RemoveAll(dir)
+    socket := filepath.Join(dir, "ratelimiter.sock")
+    aggregator, err := NewLocalStore(context.Background(), socket)
+    if err != nil {
+        t.Fatalf("NewLocalStore: %v", err)
+    }
+    // Another process forwarding its calls to the aggregator
+    forwarder, err := NewLocalStore(context.Background(), socket)
+    if err != nil {
+        t.Fatalf("NewLocalStore: %v", err)
+    }
+    use(t, aggregator)
+    use(t, forwarder)
+    if err := forwarder.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if err := aggregator.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+}
+
+func TestPostgresCloseLeavesNoGoroutine(t *testing.T) {
+    server := newFakePostgres(t)
+    defer server.close()
+    defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+    store, err := NewPostgresStore(context.Background(), "postgres://user@"+server.addr()+"/ratelimiter?sslmode=disable", PostgresConfig{})
+    if err != nil {
+        t.Fatalf("NewPostgresStore: %v", err)
+    }
+    if err := store.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+}
+
+// fakePostgres speaks enough of the PostgreSQL protocol to open a pool and run the simple queries creating the
+// tables, so the pool can be closed without a server.
+type fakePostgres struct {
+    listener net.Listener
+    wg       sync.WaitGroup
+    mu       sync.Mutex
+    conns    map[net.Conn]struct{}
+}
+
+func newFakePostgres(t *testing.T) *fakePostgres {
+    t.Helper()
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen: %v", err)
+    }
+    s := &fakePostgres{listener: listener, conns: make(map[net.Conn]struct{})}
+    s.wg.Add(1)
+    go s.serve(t)
+    return s
+}
+
+func (s *fakePostgres) addr() string {
+    return s.listener.Addr().String()
+}
+
+func (s *fakePostgres) serve(t *testing.T) {
+    defer s.wg.Done()
+    for {
+        conn, err := s.listener.Accept()
+        if err != nil {
+            if !errors.Is(err, net.ErrClosed) {
+                t.Errorf("Accept: %v", err)
+            }
+            return
+        }
+        s.mu.Lock()
+        s.conns[conn] = struct{}{}
+        s.mu.Unlock()
+        s.wg.Add(1)
+        go s.serveConn(conn)
+    }
+}
+
+func (s *fakePostgres) serveConn(conn net.Conn) {
+    defer s.wg.Done()
+    defer conn.Close()
+    backend := pgproto3.NewBackend(conn, conn)
+    if _, err := backend.ReceiveStartupMessage(); err != nil {
+        return
+    }
+    backend.Send(&pgproto3.AuthenticationOk{})
+    backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+    if err := backend.Flush(); err != nil {
+        return
+    }
+    for {
+        msg, err := backend.Receive()
+        if err != nil {
+            return
+        }
+        switch msg.(type) {
+        case *pgproto3.Query:
+            backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("CREATE TABLE")})
+            backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+            if err := backend.Flush(); err != nil {
+                return
+            }
+        case *pgproto3.Terminate:
+            return
+        }
+    }
+}
+
+// close stops the server and hangs up on the connections left open.
+func (s *fakePostgres) close() {
+    _ = s.listener.Close()
+    s.mu.Lock()
+    for conn := range s.conns {
+        _ = conn.Close()
+    }
+    s.mu.Unlock()
+    s.wg.Wait()
+}
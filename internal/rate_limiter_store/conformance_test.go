@@ -0,0 +1,351 @@
+package rate_limiter_store
+
+import (
+    "cloud.google.com/go/firestore"
+    "context"
+    "errors"
+    "github.com/alicebob/miniredis/v2"
+    clientv3 "go.etcd.io/etcd/client/v3"
+    "net"
+    "os"
+    "path/filepath"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// conformanceBackend creates a store of a backend for a test, the store is closed when the test ends.
+type conformanceBackend struct {
+    name string
+    new  func(t *testing.T) Store
+    // wait lets the time pass for the expiry of the buckets
+    //
+    // Defaults to time.Sleep if not specified
+    wait func(t *testing.T, d time.Duration)
+}
+
+// conformanceBackends are the in-process backends, always run, and the network ones, skipped when their service is
+// unreachable. The address of a network service is read from its environment variable, or its default port on
+// localhost.
+func conformanceBackends() []conformanceBackend {
+    var (
+        mr   *miniredis.Miniredis
+        fake *fakeMemcached
+    )
+    return []conformanceBackend{
+        {name: "memory", new: func(t *testing.T) Store {
+            return NewMemoryStore()
+        }},
+        {name: "redis", new: func(t *testing.T) Store {
+            mr = miniredis.RunT(t)
+            store, err := NewRedisStore(context.Background(), mr.Addr(), 100)
+            if err != nil {
+                t.Fatalf("NewRedisStore: %v", err)
+            }
+            return store
+        }, wait: func(t *testing.T, d time.Duration) {
+            // miniredis expires its keys when told the time passed
+            mr.FastForward(d)
+        }},
+        {name: "rest", new: func(t *testing.T) Store {
+            mr = miniredis.RunT(t)
+            return NewRedisRESTStore(RedisRESTConfig{URL: newUpstash(t, mr).URL, Token: "s3cret"})
+        }, wait: func(t *testing.T, d time.Duration) {
+            mr.FastForward(d)
+        }},
+        {name: "bolt", new: func(t *testing.T) Store {
+            store, err := NewBoltStore(context.Background(), BoltConfig{Path: filepath.Join(t.TempDir(), "ratelimiter.db")})
+            if err != nil {
+                t.Fatalf("NewBoltStore: %v", err)
+            }
+            return store
+        }},
+        {name: "sqlite", new: func(t *testing.T) Store {
+            store, err := NewSQLiteStore(context.Background(), SQLiteConfig{Path: filepath.Join(t.TempDir(), "ratelimiter.db")})
+            if err != nil {
+                t.Fatalf("NewSQLiteStore: %v", err)
+            }
+            return store
+        }},
+        {name: "snapshot", new: func(t *testing.T) Store {
+            store, err := NewSnapshotMemoryStore(context.Background(), NewDirObjectStore(t.TempDir()), SnapshotConfig{})
+            if err != nil {
+                t.Fatalf("NewSnapshotMemoryStore: %v", err)
+            }
+            return store
+        }},
+        {name: "local", new: func(t *testing.T) Store {
+            // Unix socket paths are short, keep out of the long test directories
+            dir, err := os.MkdirTemp("", "local")
+            if err != nil {
+                t.Fatalf("MkdirTemp: %v", err)
+            }
+            t.Cleanup(func() {
+                _ = os.RemoveAll(dir)
+            })
+            socket := filepath.Join(dir, "ratelimiter.sock")
+            aggregator, err := NewLocalStore(context.Background(), socket)
+            if err != nil {
+                t.Fatalf("NewLocalStore: %v", err)
+            }
+            t.Cleanup(func() {
+                _ = aggregator.Close()
+            })
+            // The calls of the forwarder go through the socket to the aggregator
+            forwarder, err := NewLocalStore(context.Background(), socket)
+            if err != nil {
+                t.Fatalf("NewLocalStore: %v", err)
+            }
+            return forwarder
+        }},
+        {name: "postgres", new: func(t *testing.T) Store {
+            addr := reachable(t, "RATELIMITER_TEST_POSTGRES", "localhost:5432")
+            store, err := NewPostgresStore(context.Background(), "postgres://postgres:postgres@"+addr+"/postgres?sslmode=disable",
+                PostgresConfig{Table: "conformance_buckets"})
+            if err != nil {
+                t.Fatalf("NewPostgresStore: %v", err)
+            }
+            return store
+        }},
+        {name: "etcd", new: func(t *testing.T) Store {
+            addr := reachable(t, "RATELIMITER_TEST_ETCD", "localhost:2379")
+            client, err := clientv3.New(clientv3.Config{Endpoints: []string{addr}, DialTimeout: time.Second})
+            if err != nil {
+                t.Fatalf("clientv3.New: %v", err)
+            }
+            t.Cleanup(func() {
+                _ = client.Close()
+            })
+            return NewEtcdStore(client, "conformance/")
+        }},
+        {name: "memcached", new: func(t *testing.T) Store {
+            return NewMemcachedStore(reachable(t, "RATELIMITER_TEST_MEMCACHED", "localhost:11211"))
+        }},
+        {name: "fake memcached", new: func(t *testing.T) Store {
+            fake = newFakeMemcached(t)
+            return NewMemcachedStore(fake.addr())
+        }, wait: func(t *testing.T, d time.Duration) {
+            fake.advance(d)
+        }},
+        {name: "firestore", new: func(t *testing.T) Store {
+            // The client only talks to the emulator when FIRESTORE_EMULATOR_HOST is set, never skip to a project
+            if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+                t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+            }
+            reachable(t, "FIRESTORE_EMULATOR_HOST", "")
+            client, err := firestore.NewClient(context.Background(), "conformance")
+            if err != nil {
+                t.Fatalf("firestore.NewClient: %v", err)
+            }
+            t.Cleanup(func() {
+                _ = client.Close()
+            })
+            return NewFirestoreStore(client, FirestoreConfig{Collection: "conformance"})
+        }},
+    }
+}
+
+// reachable returns the address of the service in the environment variable, or addr, and skips the test if nothing
+// listens on it.
+func reachable(t *testing.T, env, addr string) string {
+    t.Helper()
+    if v := os.Getenv(env); v != "" {
+        addr = v
+    }
+    conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
+    if err != nil {
+        t.Skipf("%s is unreachable, set %s: %v", addr, env, err)
+    }
+    _ = conn.Close()
+    return addr
+}
+
+// conformanceKey is a key of its own for each test, so the tests don't share the buckets of a network backend.
+func conformanceKey(t *testing.T) RateLimiterKey {
+    return RateLimiterKey{Endpoint: "/ping", UserId: t.Name() + "#" + time.Now().Format(time.RFC3339Nano)}
+}
+
+// skipUnsupported skips the test when the store can't do what the test checks, e.g. list the buckets of memcached.
+func skipUnsupported(t *testing.T, err error) {
+    t.Helper()
+    if errors.Is(err, errors.ErrUnsupported) {
+        t.Skip(err)
+    }
+}
+
+// TestStoreConformance checks that every backend behaves like the others, on the methods of Store and the optional
+// interfaces it implements.
+func TestStoreConformance(t *testing.T) {
+    const (
+        interval = time.Second
+        ttl      = time.Minute
+    )
+    ctx := context.Background()
+    tests := []struct {
+        name string
+        run  func(t *testing.T, store Store, wait func(time.Duration))
+    }{
+        {"get counts the requests of the key", func(t *testing.T, store Store, _ func(time.Duration)) {
+            key := conformanceKey(t)
+            now := time.Now()
+            for i := range 3 {
+                // The requests are counted in two windows
+                if err := store.Set(ctx, key, now.Add(time.Duration(i)*interval), interval, ttl); err != nil {
+                    t.Fatalf("Set: %v", err)
+                }
+            }
+            count, err := store.Get(ctx, key)
+            skipUnsupported(t, err)
+            if err != nil || count != 3 {
+                t.Fatalf("Get: %d, %v, 3 expected", count, err)
+            }
+            for _, other := range []RateLimiterKey{
+                {Endpoint: key.Endpoint, UserId: key.UserId + "-other"},
+                {Endpoint: key.Endpoint + "/other", UserId: key.UserId},
+            } {
+                if count, err := store.Get(ctx, other); err != nil || count != 0 {
+                    t.Fatalf("Get of %v: %d, %v, 0 expected", other, count, err)
+                }
+            }
+        }},
+        {"get skips the expired buckets", func(t *testing.T, store Store, wait func(time.Duration)) {
+            key := conformanceKey(t)
+            if err := store.Set(ctx, key, time.Now(), interval, interval); err != nil {
+                t.Fatalf("Set: %v", err)
+            }
+            // A second is the shortest expiry of every backend
+            wait(2 * interval)
+            count, err := store.Get(ctx, key)
+            skipUnsupported(t, err)
+            if err != nil || count != 0 {
+                t.Fatalf("Get: %d, %v, 0 expected", count, err)
+            }
+        }},
+        {"reset deletes the buckets of the key only", func(t *testing.T, store Store, _ func(time.Duration)) {
+            key := conformanceKey(t)
+            other := RateLimiterKey{Endpoint: key.Endpoint, UserId: key.UserId + "-other"}
+            now := time.Now()
+            for _, k := range []RateLimiterKey{key, other} {
+                if err := store.Set(ctx, k, now, interval, ttl); err != nil {
+                    t.Fatalf("Set: %v", err)
+                }
+            }
+            err := store.Reset(ctx, key)
+            skipUnsupported(t, err)
+            if err != nil {
+                t.Fatalf("Reset: %v", err)
+            }
+            if count, err := store.Get(ctx, key); err != nil || count != 0 {
+                t.Fatalf("Get after Reset: %d, %v, 0 expected", count, err)
+            }
+            if count, err := store.Get(ctx, other); err != nil || count != 1 {
+                t.Fatalf("Get of the other key: %d, %v, 1 expected", count, err)
+            }
+        }},
+        {"count windows counts the windows of the ttl", func(t *testing.T, store Store, _ func(time.Duration)) {
+            counter, ok := store.(WindowCounter)
+            if !ok {
+                t.Skip("not a WindowCounter")
+            }
+            key := conformanceKey(t)
+            now := WindowStart(time.Now(), interval)
+            for _, timestamp := range []time.Time{now, now, now.Add(interval)} {
+                if err := store.Set(ctx, key, timestamp, interval, ttl); err != nil {
+                    t.Fatalf("Set: %v", err)
+                }
+            }
+            for _, test := range []struct {
+                now   time.Time
+                count int64
+            }{
+                {now.Add(interval), 3},
+                {now.Add(ttl + interval), 3},
+                // A bucket lives ttl after its first request, which can come at the end of its window
+                {now.Add(ttl + 2*interval), 1},
+                {now.Add(ttl + 3*interval), 0},
+            } {
+                if count, err := counter.CountWindows(ctx, key, test.now, interval, ttl); err != nil || count != test.count {
+                    t.Fatalf("CountWindows at %s: %d, %v, %d expected", test.now.Sub(now), count, err, test.count)
+                }
+            }
+        }},
+        {"set if below stops at the limit", func(t *testing.T, store Store, _ func(time.Duration)) {
+            atomicStore, ok := store.(AtomicStore)
+            if !ok {
+                t.Skip("not an AtomicStore")
+            }
+            key := conformanceKey(t)
+            now := time.Now()
+            for i, want := range []bool{true, true, true, false} {
+                if ok, err := atomicStore.SetIfBelow(ctx, key, 3, now, interval, ttl); err != nil || ok != want {
+                    t.Fatalf("SetIfBelow %d: %t, %v, %t expected", i, ok, err, want)
+                }
+            }
+            for i, want := range []struct {
+                before int64
+                ok     bool
+            }{{3, true}, {5, false}} {
+                if before, ok, err := atomicStore.AddIfBelow(ctx, key, 2, 6, now, interval, ttl); err != nil || before != want.before || ok != want.ok {
+                    t.Fatalf("AddIfBelow %d: %d, %t, %v, %d, %t expected", i, before, ok, err, want.before, want.ok)
+                }
+            }
+        }},
+        {"set if below is atomic", func(t *testing.T, store Store, _ func(time.Duration)) {
+            atomicStore, ok := store.(AtomicStore)
+            if !ok {
+                t.Skip("not an AtomicStore")
+            }
+            key := conformanceKey(t)
+            now := time.Now()
+            const limit = 5
+            var (
+                wg      sync.WaitGroup
+                allowed atomic.Int64
+            )
+            for range 20 {
+                wg.Add(1)
+                go func() {
+                    defer wg.Done()
+                    ok, err := atomicStore.SetIfBelow(ctx, key, limit, now, interval, ttl)
+                    if err != nil {
+                        t.Errorf("SetIfBelow: %v", err)
+                    }
+                    if ok {
+                        allowed.Add(1)
+                    }
+                }()
+            }
+            wg.Wait()
+            if n := allowed.Load(); n != limit {
+                t.Fatalf("%d requests allowed, %d expected", n, limit)
+            }
+        }},
+        {"close can be called more than once", func(t *testing.T, store Store, _ func(time.Duration)) {
+            for range 2 {
+                if err := store.Close(); err != nil {
+                    t.Fatalf("Close: %v", err)
+                }
+            }
+        }},
+    }
+    for _, backend := range conformanceBackends() {
+        t.Run(backend.name, func(t *testing.T) {
+            for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                    store := backend.new(t)
+                    t.Cleanup(func() {
+                        _ = store.Close()
+                    })
+                    wait := time.Sleep
+                    if backend.wait != nil {
+                        wait = func(d time.Duration) {
+                            backend.wait(t, d)
+                        }
+                    }
+                    test.run(t, store, wait)
+                })
+            }
+        })
+    }
+}
@@ -0,0 +1,209 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    clientv3 "go.etcd.io/etcd/client/v3"
+    "go.etcd.io/etcd/client/v3/concurrency"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+type etcdStore struct {
+    client *clientv3.Client
+    prefix string
+}
+
+// NewEtcdStore creates a Store on an etcd cluster, for Kubernetes native deployments reusing their etcd for small
+// scale limiting. The keys are under the prefix, e.g. ratelimiter/.
+//
+// Every bucket is a key attached to a lease of its ttl, so etcd deletes it when it expires. etcd rounds the leases up
+// to its minimum TTL, a few seconds, so shorter windows outlive their ttl. The counts are checked and incremented in
+// software transactions, see AtomicStore, retried when another instance counted a request of the key in between.
+// Every request is a write through the Raft log, the store suits low request rates only.
+func NewEtcdStore(client *clientv3.Client, prefix string) Store {
+    return &etcdStore{client: client, prefix: prefix}
+}
+
+// userKey is the prefix of the buckets of the key, the parts are query escaped so they can't contain the separator.
+func (e *etcdStore) userKey(key RateLimiterKey) string {
+    return fmt.Sprintf("%s%s#%s#", e.prefix, url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint))
+}
+
+func (e *etcdStore) generateKey(key RateLimiterKey, timestampWindow time.Time) string {
+    return e.userKey(key) + strconv.FormatInt(timestampWindow.Unix(), 10)
+}
+
+func (e *etcdStore) generateSeenKey(key RateLimiterKey, requestId string) string {
+    return fmt.Sprintf("%sseen/%s#%s#%s", e.prefix, url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint), url.QueryEscape(requestId))
+}
+
+func (e *etcdStore) generateFlagKey(userId, flag string) string {
+    return fmt.Sprintf("%sflag/%s:%s", e.prefix, url.QueryEscape(flag), url.QueryEscape(userId))
+}
+
+// etcdTTL converts the ttl to the seconds of a lease, at least a second.
+func etcdTTL(ttl time.Duration) int64 {
+    return int64(max((ttl+time.Second-1)/time.Second, 1))
+}
+
+func (e *etcdStore) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    resp, err := e.client.Get(ctx, e.userKey(key), clientv3.WithPrefix())
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    var count int64
+    for _, kv := range resp.Kvs {
+        v, err := strconv.ParseInt(string(kv.Value), 10, 64)
+        if err != nil {
+            return 0, fmt.Errorf("failed to parse rate limiter %s: %w", kv.Key, err)
+        }
+        if count, err = AddCount(count, v); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", kv.Key, v, err)
+        }
+    }
+    return count, nil
+}
+
+func (e *etcdStore) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    _, err := concurrency.NewSTM(e.client, func(stm concurrency.STM) error {
+        return e.increment(ctx, stm, key, 1, timestamp, windowInterval, ttl)
+    }, concurrency.WithAbortContext(ctx))
+    if err != nil {
+        return fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// increment counts a request for cost in the bucket of the timestamp. A new bucket is attached to a new lease of the
+// ttl, an existing one keeps its lease.
+func (e *etcdStore) increment(ctx context.Context, stm concurrency.STM, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    k := e.generateKey(key, WindowStart(timestamp, windowInterval))
+    if stm.Rev(k) != 0 {
+        count, err := strconv.ParseInt(stm.Get(k), 10, 64)
+        if err != nil {
+            return fmt.Errorf("failed to parse rate limiter %s: %w", k, err)
+        }
+        count, _ = AddCount(count, cost)
+        stm.Put(k, strconv.FormatInt(count, 10), clientv3.WithIgnoreLease())
+        return nil
+    }
+    // A retried transaction grants another lease, the unused ones expire on their own
+    lease, err := e.client.Grant(ctx, etcdTTL(ttl))
+    if err != nil {
+        return fmt.Errorf("failed to grant lease for rate limiter %s: %w", k, err)
+    }
+    stm.Put(k, strconv.FormatInt(cost, 10), clientv3.WithLease(lease.ID))
+    return nil
+}
+
+// countWindows sums the buckets of the key that can still exist at now, read in the software transaction.
+func (e *etcdStore) countWindows(stm concurrency.STM, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    var count int64
+    for _, k := range windowKeys(e.generateKey, key, now, windowInterval, ttl) {
+        value := stm.Get(k)
+        if value == "" {
+            continue
+        }
+        v, err := strconv.ParseInt(value, 10, 64)
+        if err != nil {
+            return 0, fmt.Errorf("failed to parse rate limiter %s: %w", k, err)
+        }
+        if count, err = AddCount(count, v); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", k, v, err)
+        }
+    }
+    return count, nil
+}
+
+func (e *etcdStore) OldestExpiry(ctx context.Context, key RateLimiterKey, _ time.Time, _, _ time.Duration) (time.Duration, error) {
+    resp, err := e.client.Get(ctx, e.userKey(key), clientv3.WithPrefix())
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    var oldest time.Duration
+    for _, kv := range resp.Kvs {
+        lease, err := e.client.TimeToLive(ctx, clientv3.LeaseID(kv.Lease))
+        if err != nil {
+            return 0, fmt.Errorf("failed to fetch lease of rate limiter %s: %w", kv.Key, err)
+        }
+        if left := time.Duration(lease.TTL) * time.Second; left > 0 && (oldest == 0 || left < oldest) {
+            oldest = left
+        }
+    }
+    return oldest, nil
+}
+
+func (e *etcdStore) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := e.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (e *etcdStore) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (count int64, added bool, err error) {
+    _, err = concurrency.NewSTM(e.client, func(stm concurrency.STM) error {
+        count, added = 0, false
+        var err error
+        if count, err = e.countWindows(stm, key, timestamp, windowInterval, ttl); err != nil || count > limit-cost {
+            return err
+        }
+        added = true
+        return e.increment(ctx, stm, key, cost, timestamp, windowInterval, ttl)
+    }, concurrency.WithAbortContext(ctx))
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return count, added, nil
+}
+
+func (e *etcdStore) Reset(ctx context.Context, key RateLimiterKey) error {
+    seen := fmt.Sprintf("%sseen/%s#%s#", e.prefix, url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint))
+    _, err := e.client.Txn(ctx).Then(
+        clientv3.OpDelete(e.userKey(key), clientv3.WithPrefix()),
+        clientv3.OpDelete(seen, clientv3.WithPrefix()),
+    ).Commit()
+    if err != nil {
+        return fmt.Errorf("failed to reset rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// Close does nothing, the client is left open for its owner to close.
+func (e *etcdStore) Close() error {
+    return nil
+}
+
+func (e *etcdStore) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    return e.exists(ctx, e.generateSeenKey(key, requestId))
+}
+
+func (e *etcdStore) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    return e.mark(ctx, e.generateSeenKey(key, requestId), ttl)
+}
+
+func (e *etcdStore) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    return e.mark(ctx, e.generateFlagKey(userId, flag), ttl)
+}
+
+func (e *etcdStore) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    return e.exists(ctx, e.generateFlagKey(userId, flag))
+}
+
+func (e *etcdStore) exists(ctx context.Context, k string) (bool, error) {
+    resp, err := e.client.Get(ctx, k, clientv3.WithCountOnly())
+    if err != nil {
+        return false, fmt.Errorf("failed to check %s: %w", k, err)
+    }
+    return resp.Count > 0, nil
+}
+
+func (e *etcdStore) mark(ctx context.Context, k string, ttl time.Duration) error {
+    lease, err := e.client.Grant(ctx, etcdTTL(ttl))
+    if err != nil {
+        return fmt.Errorf("failed to grant lease for %s: %w", k, err)
+    }
+    if _, err = e.client.Put(ctx, k, "1", clientv3.WithLease(lease.ID)); err != nil {
+        return fmt.Errorf("failed to set %s: %w", k, err)
+    }
+    return nil
+}
@@ -0,0 +1,35 @@
+package rate_limiter_store
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestEtcdKeys(t *testing.T) {
+    e := &etcdStore{prefix: "ratelimiter/"}
+    key := RateLimiterKey{UserId: "ada", Endpoint: "/api"}
+    if k := e.generateKey(key, time.Unix(60, 0)); k != "ratelimiter/ada#%2Fapi#60" {
+        t.Fatalf("key %q", k)
+    }
+    // Get reads the buckets by the prefix of the user, the other users never share it
+    for _, other := range []RateLimiterKey{
+        {UserId: "ada2", Endpoint: "/api"},
+        {UserId: "ada", Endpoint: "/api/admin"},
+        {UserId: "ada#/api", Endpoint: "/admin"},
+    } {
+        if k := e.generateKey(other, time.Unix(60, 0)); strings.HasPrefix(k, e.userKey(key)) {
+            t.Fatalf("bucket %q of %v under the prefix %q of %v", k, other, e.userKey(key), key)
+        }
+    }
+    if k := e.generateSeenKey(key, "order 1"); strings.HasPrefix(k, e.userKey(key)) || strings.Contains(k, " ") {
+        t.Fatalf("request id key %q", k)
+    }
+
+    // The leases last whole seconds
+    for ttl, seconds := range map[time.Duration]int64{0: 1, 1500 * time.Millisecond: 2, time.Minute: 60} {
+        if s := etcdTTL(ttl); s != seconds {
+            t.Fatalf("etcdTTL(%s): %d, %d expected", ttl, s, seconds)
+        }
+    }
+}
@@ -0,0 +1,276 @@
+package rate_limiter_store
+
+import (
+    "cloud.google.com/go/firestore"
+    "context"
+    "fmt"
+    "net/url"
+    "time"
+)
+
+type FirestoreConfig struct {
+    // Collection holding the buckets, the request ids and flags are in the collections with the _seen and _flags
+    // suffixes
+    //
+    // Defaults to ratelimiter if not specified
+    Collection string `json:"collection,omitempty"`
+}
+
+// firestoreBucket is a bucket document, expires_at can be the field of a TTL policy so Firestore deletes the expired
+// documents.
+type firestoreBucket struct {
+    UserId    string    `firestore:"user_id"`
+    Endpoint  string    `firestore:"endpoint"`
+    Window    time.Time `firestore:"window"`
+    Count     int64     `firestore:"count"`
+    ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// firestoreMark is a request id or flag document.
+type firestoreMark struct {
+    ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+type firestoreStore struct {
+    client  *firestore.Client
+    buckets *firestore.CollectionRef
+    seen    *firestore.CollectionRef
+    flags   *firestore.CollectionRef
+}
+
+// NewFirestoreStore creates a Store in Firestore, for serverless deployments on GCP without a Redis to reach.
+//
+// The buckets are documents named by their windows, found with a single batched read, see WindowCounter. Every count
+// is a transaction, so a request is checked and counted atomically, see AtomicStore. Firestore has no expiry, expired
+// documents are skipped and should be deleted by a TTL policy on the expires_at field of the collections.
+func NewFirestoreStore(client *firestore.Client, config FirestoreConfig) Store {
+    if config.Collection == "" {
+        config.Collection = "ratelimiter"
+    }
+    return &firestoreStore{
+        client:  client,
+        buckets: client.Collection(config.Collection),
+        seen:    client.Collection(config.Collection + "_seen"),
+        flags:   client.Collection(config.Collection + "_flags"),
+    }
+}
+
+// generateFirestoreKey names the bucket, the parts are query escaped as document ids can't contain slashes.
+func generateFirestoreKey(key RateLimiterKey, timestampWindow time.Time) string {
+    return fmt.Sprintf("%s#%s#%d", url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint), timestampWindow.Unix())
+}
+
+func generateFirestoreSeenKey(key RateLimiterKey, requestId string) string {
+    return fmt.Sprintf("%s#%s#%s", url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint), url.QueryEscape(requestId))
+}
+
+func generateFirestoreFlagKey(userId, flag string) string {
+    return fmt.Sprintf("%s:%s", url.QueryEscape(flag), url.QueryEscape(userId))
+}
+
+func (f *firestoreStore) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    docs, err := f.buckets.Where("user_id", "==", key.UserId).Where("endpoint", "==", key.Endpoint).Documents(ctx).GetAll()
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return firestoreCount(key, docs)
+}
+
+// firestoreCount sums the buckets that have not expired.
+func firestoreCount(key RateLimiterKey, docs []*firestore.DocumentSnapshot) (int64, error) {
+    var count int64
+    now := time.Now()
+    for _, doc := range docs {
+        if !doc.Exists() {
+            continue
+        }
+        var b firestoreBucket
+        if err := doc.DataTo(&b); err != nil {
+            return 0, fmt.Errorf("failed to parse rate limiter %s: %w", doc.Ref.ID, err)
+        }
+        if !now.Before(b.ExpiresAt) {
+            continue
+        }
+        var err error
+        if count, err = AddCount(count, b.Count); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s#%s with value %d: %w", key.UserId, key.Endpoint, b.Count, err)
+        }
+    }
+    return count, nil
+}
+
+func (f *firestoreStore) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    err := f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+        return f.increment(tx, key, 1, timestamp, windowInterval, ttl)
+    })
+    if err != nil {
+        return fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// increment counts a request for cost in the bucket of the timestamp, starting the bucket over if it expired.
+func (f *firestoreStore) increment(tx *firestore.Transaction, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    window := WindowStart(timestamp, windowInterval)
+    ref := f.buckets.Doc(generateFirestoreKey(key, window))
+    docs, err := tx.GetAll([]*firestore.DocumentRef{ref})
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+    b := firestoreBucket{UserId: key.UserId, Endpoint: key.Endpoint, Window: window, Count: cost, ExpiresAt: now.Add(ttl)}
+    var current firestoreBucket
+    if docs[0].Exists() {
+        if err = docs[0].DataTo(&current); err != nil {
+            return err
+        }
+        if now.Before(current.ExpiresAt) {
+            b.Count, _ = AddCount(current.Count, cost)
+            b.ExpiresAt = current.ExpiresAt
+        }
+    }
+    return tx.Set(ref, b)
+}
+
+// windowRefs returns the documents of the buckets of the key that can still exist at now.
+func (f *firestoreStore) windowRefs(key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) []*firestore.DocumentRef {
+    var refs []*firestore.DocumentRef
+    for _, id := range windowKeys(generateFirestoreKey, key, now, windowInterval, ttl) {
+        refs = append(refs, f.buckets.Doc(id))
+    }
+    return refs
+}
+
+func (f *firestoreStore) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if windowInterval <= 0 {
+        // No window to derive the names from
+        return f.Get(ctx, key)
+    }
+    docs, err := f.client.GetAll(ctx, f.windowRefs(key, now, windowInterval, ttl))
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return firestoreCount(key, docs)
+}
+
+func (f *firestoreStore) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    if windowInterval <= 0 {
+        return 0, nil
+    }
+    docs, err := f.client.GetAll(ctx, f.windowRefs(key, now, windowInterval, ttl))
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    var oldest time.Duration
+    current := time.Now()
+    for _, doc := range docs {
+        var b firestoreBucket
+        if !doc.Exists() || doc.DataTo(&b) != nil {
+            continue
+        }
+        if left := b.ExpiresAt.Sub(current); left > 0 && (oldest == 0 || left < oldest) {
+            oldest = left
+        }
+    }
+    return oldest, nil
+}
+
+func (f *firestoreStore) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := f.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+// AddIfBelow reads the buckets and counts the request in one transaction, Firestore retries it if another instance
+// counted a request of the key in between.
+func (f *firestoreStore) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (count int64, added bool, err error) {
+    err = f.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+        count, added = 0, false
+        docs, err := tx.GetAll(f.windowRefs(key, timestamp, windowInterval, ttl))
+        if err != nil {
+            return err
+        }
+        if count, err = firestoreCount(key, docs); err != nil || count > limit-cost {
+            return err
+        }
+        added = true
+        return f.increment(tx, key, cost, timestamp, windowInterval, ttl)
+    })
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return count, added, nil
+}
+
+func (f *firestoreStore) Reset(ctx context.Context, key RateLimiterKey) error {
+    buckets, err := f.buckets.Where("user_id", "==", key.UserId).Where("endpoint", "==", key.Endpoint).Select().Documents(ctx).GetAll()
+    if err != nil {
+        return fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    // The request id documents only have an expiry, they are found by the prefix of their ids
+    prefix := url.QueryEscape(key.UserId) + "#" + url.QueryEscape(key.Endpoint) + "#"
+    seen, err := f.seen.Where(firestore.DocumentID, ">=", f.seen.Doc(prefix)).Where(firestore.DocumentID, "<", f.seen.Doc(prefix+"\uf8ff")).
+        Select().Documents(ctx).GetAll()
+    if err != nil {
+        return fmt.Errorf("failed to fetch request ids of %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    bw := f.client.BulkWriter(ctx)
+    var jobs []*firestore.BulkWriterJob
+    for _, doc := range append(buckets, seen...) {
+        job, err := bw.Delete(doc.Ref)
+        if err != nil {
+            bw.End()
+            return fmt.Errorf("failed to delete %s: %w", doc.Ref.ID, err)
+        }
+        jobs = append(jobs, job)
+    }
+    bw.End()
+    for _, job := range jobs {
+        if _, err := job.Results(); err != nil {
+            return fmt.Errorf("failed to reset rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+        }
+    }
+    return nil
+}
+
+// Close does nothing, the client is left open for its owner to close.
+func (f *firestoreStore) Close() error {
+    return nil
+}
+
+func (f *firestoreStore) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    return f.exists(ctx, f.seen.Doc(generateFirestoreSeenKey(key, requestId)))
+}
+
+func (f *firestoreStore) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    return f.mark(ctx, f.seen.Doc(generateFirestoreSeenKey(key, requestId)), ttl)
+}
+
+func (f *firestoreStore) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    return f.mark(ctx, f.flags.Doc(generateFirestoreFlagKey(userId, flag)), ttl)
+}
+
+func (f *firestoreStore) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    return f.exists(ctx, f.flags.Doc(generateFirestoreFlagKey(userId, flag)))
+}
+
+func (f *firestoreStore) exists(ctx context.Context, ref *firestore.DocumentRef) (bool, error) {
+    docs, err := f.client.GetAll(ctx, []*firestore.DocumentRef{ref})
+    if err != nil {
+        return false, fmt.Errorf("failed to check %s: %w", ref.ID, err)
+    }
+    var m firestoreMark
+    if !docs[0].Exists() {
+        return false, nil
+    }
+    if err = docs[0].DataTo(&m); err != nil {
+        return false, fmt.Errorf("failed to parse %s: %w", ref.ID, err)
+    }
+    return time.Now().Before(m.ExpiresAt), nil
+}
+
+func (f *firestoreStore) mark(ctx context.Context, ref *firestore.DocumentRef, ttl time.Duration) error {
+    if _, err := ref.Set(ctx, firestoreMark{ExpiresAt: time.Now().Add(ttl)}); err != nil {
+        return fmt.Errorf("failed to set %s: %w", ref.ID, err)
+    }
+    return nil
+}
@@ -0,0 +1,25 @@
+package rate_limiter_store
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestFirestoreKeys(t *testing.T) {
+    // Document ids can't contain slashes, and the parts of the ids can't be confused
+    for _, id := range []string{
+        generateFirestoreKey(RateLimiterKey{UserId: "ada", Endpoint: "/api/orders"}, time.Unix(60, 0)),
+        generateFirestoreKey(RateLimiterKey{UserId: "ada#/api", Endpoint: "/orders"}, time.Unix(60, 0)),
+        generateFirestoreSeenKey(RateLimiterKey{UserId: "ada", Endpoint: "/api"}, "orders/1"),
+        generateFirestoreFlagKey("10.0.0.1", "abusive"),
+    } {
+        if strings.Contains(id, "/") {
+            t.Fatalf("document id %q with a slash", id)
+        }
+    }
+    if a, b := generateFirestoreKey(RateLimiterKey{UserId: "ada", Endpoint: "#/api"}, time.Unix(60, 0)),
+        generateFirestoreKey(RateLimiterKey{UserId: "ada#", Endpoint: "/api"}, time.Unix(60, 0)); a == b {
+        t.Fatalf("buckets of two keys share the id %q", a)
+    }
+}
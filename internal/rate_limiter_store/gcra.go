@@ -0,0 +1,64 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+// conformScript checks and pushes the theoretical arrival time atomically, so instances racing on the same key can't
+// both take the last slot. The key holds the arrival time in milliseconds and expires once it is in the past. It
+// returns whether the request conforms and how many more would conform at now.
+var conformScript = radix.NewEvalScript(`
+local now = tonumber(ARGV[1])
+local emission = tonumber(ARGV[2])
+local tolerance = tonumber(ARGV[3])
+local tat = math.max(tonumber(redis.call("GET", KEYS[1])) or now, now)
+if tat - now > tolerance then
+    return {0, 0}
+end
+tat = tat + emission
+redis.call("SET", KEYS[1], tostring(tat), "PX", math.max(1, math.ceil(tat - now)))
+local remaining = 0
+if emission > 0 and tat - now <= tolerance then
+    remaining = math.floor((tolerance - (tat - now)) / emission) + 1
+end
+return {1, remaining}
+`)
+
+func (r *redis) Conform(ctx context.Context, key RateLimiterKey, now time.Time, emissionInterval, tolerance time.Duration) (bool, int64, error) {
+    var result []int64
+    if err := r.client.Do(ctx, conformScript.Cmd(&result, []string{r.keys.generateTATKey(key)}, strconv.FormatInt(now.UnixMilli(), 10), formatMillis(emissionInterval), formatMillis(tolerance))); err != nil {
+        return false, 0, fmt.Errorf("failed to check arrival time of user %s for endpoint %s: %w", key.UserId, key.Endpoint, err)
+    }
+    if len(result) != 2 {
+        return false, 0, fmt.Errorf("unexpected reply %v to check arrival time of user %s for endpoint %s", result, key.UserId, key.Endpoint)
+    }
+    return result[0] == 1, result[1], nil
+}
+
+func (m *memory) Conform(_ context.Context, key RateLimiterKey, now time.Time, emissionInterval, tolerance time.Duration) (bool, int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if now.Sub(m.tatsSwept) >= time.Second {
+        // An arrival time in the past is the same as a missing one, drop them so the users who left don't leak
+        for k, tat := range m.tats {
+            if !tat.After(now) {
+                delete(m.tats, k)
+            }
+        }
+        m.tatsSwept = now
+    }
+    tat := m.tats[key]
+    if tat.Before(now) {
+        tat = now
+    }
+    if tat.Sub(now) > tolerance {
+        return false, 0, nil
+    }
+    tat = tat.Add(emissionInterval)
+    m.tats[key] = tat
+    return true, ConformingRequests(tat, now, emissionInterval, tolerance), nil
+}
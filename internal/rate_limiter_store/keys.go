@@ -0,0 +1,115 @@
+package rate_limiter_store
+
+import (
+    "strconv"
+    "strings"
+    "time"
+)
+
+// keyBufferSize fits the names of most keys, the longer ones grow the buffer on the heap.
+const keyBufferSize = 128
+
+// keyspace builds the names of the Redis keys under the prefix of a store, see WithKeyPrefix.
+//
+// The names are appended to a buffer on the stack and converted to a string once, formatting them allocated the boxed
+// arguments and the concatenation with the prefix on every decision.
+type keyspace string
+
+// appendTag appends the prefix and the hash tag of the key, {<userId>#<endpoint>}.
+func (ks keyspace) appendTag(b []byte, key RateLimiterKey) []byte {
+    b = append(b, ks...)
+    b = append(b, '{')
+    b = append(b, key.UserId...)
+    b = append(b, '#')
+    b = append(b, key.Endpoint...)
+    return append(b, '}')
+}
+
+// withSuffix returns the name of a key of the user and endpoint other than a counter.
+func (ks keyspace) withSuffix(key RateLimiterKey, suffix string) string {
+    b := ks.appendTag(make([]byte, 0, keyBufferSize), key)
+    return string(append(b, suffix...))
+}
+
+func (ks keyspace) generateKey(key RateLimiterKey, timestampWindow time.Time) string {
+    b := ks.appendTag(make([]byte, 0, keyBufferSize), key)
+    b = append(b, '#')
+    return string(strconv.AppendInt(b, timestampWindow.Unix(), 10))
+}
+
+// generateKeyPrefix is generateKey without the window.
+func (ks keyspace) generateKeyPrefix(key RateLimiterKey) string {
+    return ks.withSuffix(key, "#")
+}
+
+// appendEscaped appends s with its glob characters escaped.
+func appendEscaped(b []byte, s string) []byte {
+    for i := 0; i < len(s); i++ {
+        if strings.IndexByte(`*?[]\`, s[i]) >= 0 {
+            b = append(b, '\\')
+        }
+        b = append(b, s[i])
+    }
+    return b
+}
+
+// appendTagMatcher appends the prefix and the hash tag of the key with their glob characters escaped, so a user id
+// like "*" doesn't match the keys of other users.
+func (ks keyspace) appendTagMatcher(b []byte, key RateLimiterKey) []byte {
+    b = appendEscaped(b, string(ks))
+    b = append(b, '{')
+    b = appendEscaped(b, key.UserId)
+    b = append(b, '#')
+    b = appendEscaped(b, key.Endpoint)
+    return append(b, '}')
+}
+
+// generateKeyMatcher matches the counters of the key.
+func (ks keyspace) generateKeyMatcher(key RateLimiterKey) string {
+    b := ks.appendTagMatcher(make([]byte, 0, keyBufferSize), key)
+    return string(append(b, '#', '*'))
+}
+
+// generateResetMatcher matches every key in the hash tag of the key, the counters, the request ids and the state of
+// the other algorithms.
+func (ks keyspace) generateResetMatcher(key RateLimiterKey) string {
+    b := ks.appendTagMatcher(make([]byte, 0, keyBufferSize), key)
+    return string(append(b, '*'))
+}
+
+// generateSeenKey uses another separator than the counters so they don't match generateKeyMatcher, and the same hash
+// tag so they are on the same cluster slot.
+func (ks keyspace) generateSeenKey(key RateLimiterKey, requestId string) string {
+    b := ks.appendTag(make([]byte, 0, keyBufferSize), key)
+    b = append(b, ":seen:"...)
+    return string(append(b, requestId...))
+}
+
+// generateFlagKey is outside the hash tags of the counters, a flag applies to every endpoint of the user.
+func (ks keyspace) generateFlagKey(userId, flag string) string {
+    b := append(make([]byte, 0, keyBufferSize), ks...)
+    b = append(b, "ratelimiter:flag:"...)
+    b = append(b, flag...)
+    b = append(b, ':')
+    return string(append(b, userId...))
+}
+
+// generateTATKey uses another separator than the counters so it doesn't match generateKeyMatcher.
+func (ks keyspace) generateTATKey(key RateLimiterKey) string {
+    return ks.withSuffix(key, ":tat")
+}
+
+// generateBucketKey uses another separator than the counters so it doesn't match generateKeyMatcher.
+func (ks keyspace) generateBucketKey(key RateLimiterKey) string {
+    return ks.withSuffix(key, ":bucket")
+}
+
+// generateLeakyBucketKey uses another separator than the counters so it doesn't match generateKeyMatcher.
+func (ks keyspace) generateLeakyBucketKey(key RateLimiterKey) string {
+    return ks.withSuffix(key, ":leaky")
+}
+
+// formatMillis formats a duration in milliseconds for the scripts, with its fraction.
+func formatMillis(d time.Duration) string {
+    return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'g', -1, 64)
+}
@@ -0,0 +1,46 @@
+package rate_limiter_store
+
+import (
+    "fmt"
+    "testing"
+    "time"
+)
+
+var benchmarkKey = RateLimiterKey{Endpoint: "/api/v1/users", UserId: "ip:203.0.113.42"}
+
+func BenchmarkGenerateKey(b *testing.B) {
+    ks := keyspace("app:")
+    now := time.Now()
+    b.ReportAllocs()
+    for b.Loop() {
+        _ = ks.generateKey(benchmarkKey, now)
+    }
+}
+
+// BenchmarkGenerateKeySprintf is the former formatting of the key names, the baseline of BenchmarkGenerateKey.
+func BenchmarkGenerateKeySprintf(b *testing.B) {
+    prefix := "app:"
+    now := time.Now()
+    b.ReportAllocs()
+    for b.Loop() {
+        _ = prefix + fmt.Sprintf("{%s#%s}#%d", benchmarkKey.UserId, benchmarkKey.Endpoint, now.Unix())
+    }
+}
+
+// BenchmarkWindowKeys names the 13 counters of a sliding window of 1 minute by 5 seconds.
+func BenchmarkWindowKeys(b *testing.B) {
+    ks := keyspace("app:")
+    now := time.Now()
+    b.ReportAllocs()
+    for b.Loop() {
+        _ = windowKeys(ks.generateKey, benchmarkKey, now, 5*time.Second, time.Minute)
+    }
+}
+
+func TestGenerateKey(t *testing.T) {
+    now := time.Unix(1700000000, 0)
+    want := "app:" + fmt.Sprintf("{%s#%s}#%d", benchmarkKey.UserId, benchmarkKey.Endpoint, now.Unix())
+    if got := keyspace("app:").generateKey(benchmarkKey, now); got != want {
+        t.Fatalf("generateKey: %q, %q expected", got, want)
+    }
+}
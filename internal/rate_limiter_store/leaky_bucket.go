@@ -0,0 +1,86 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+// enqueueScript drains and fills a leaky bucket atomically, so instances racing on the same bucket can't both take
+// the last place. The bucket is a hash holding the level and the time of the last drain in milliseconds, it expires
+// once empty. It returns the delay of the request in milliseconds, or -1 if the bucket is full, and the whole places
+// left.
+var enqueueScript = radix.NewEvalScript(`
+local now = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local leak = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "level", "last")
+local level = tonumber(bucket[1]) or 0
+local last = tonumber(bucket[2]) or now
+if now > last and leak > 0 then
+    level = math.max(0, level - (now - last) / leak)
+    last = now
+end
+if level + 1 > capacity then
+    return {-1, 0}
+end
+local delay = level * leak
+level = level + 1
+redis.call("HSET", KEYS[1], "level", tostring(level), "last", tostring(last))
+redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil(level * leak)))
+return {math.floor(delay), math.floor(capacity - level)}
+`)
+
+func (r *redis) Enqueue(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, leakInterval time.Duration) (time.Duration, bool, int64, error) {
+    var result []int64
+    if err := r.client.Do(ctx, enqueueScript.Cmd(&result, []string{r.keys.generateLeakyBucketKey(key)}, strconv.FormatInt(now.UnixMilli(), 10), strconv.FormatInt(capacity, 10), formatMillis(leakInterval))); err != nil {
+        return 0, false, 0, fmt.Errorf("failed to enqueue request of user %s for endpoint %s: %w", key.UserId, key.Endpoint, err)
+    }
+    if len(result) != 2 {
+        return 0, false, 0, fmt.Errorf("unexpected reply %v to enqueue request of user %s for endpoint %s", result, key.UserId, key.Endpoint)
+    }
+    if result[0] < 0 {
+        return 0, false, 0, nil
+    }
+    return time.Duration(result[0]) * time.Millisecond, true, result[1], nil
+}
+
+type memoryLeakyBucket struct {
+    level     float64
+    last      time.Time
+    expiresAt time.Time // When the bucket is empty with its own leak interval
+}
+
+func (m *memory) Enqueue(_ context.Context, key RateLimiterKey, now time.Time, capacity int64, leakInterval time.Duration) (time.Duration, bool, int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if now.Sub(m.leakySwept) >= time.Second {
+        // An empty bucket is the same as a missing one, drop them so the users who left don't leak. Each bucket drains
+        // at its own endpoint's leak interval, not the one of this call
+        for k, b := range m.leakyBuckets {
+            if !b.expiresAt.IsZero() && !now.Before(b.expiresAt) {
+                delete(m.leakyBuckets, k)
+            }
+        }
+        m.leakySwept = now
+    }
+    b, ok := m.leakyBuckets[key]
+    if !ok {
+        b = &memoryLeakyBucket{last: now}
+        m.leakyBuckets[key] = b
+    }
+    b.level = DrainLevel(b.level, b.last, now, leakInterval)
+    if now.After(b.last) {
+        b.last = now
+    }
+    if b.level+1 > float64(capacity) {
+        b.expiresAt = b.last.Add(time.Duration(b.level * float64(leakInterval)))
+        return 0, false, 0, nil
+    }
+    delay := time.Duration(b.level * float64(leakInterval))
+    b.level++
+    b.expiresAt = b.last.Add(time.Duration(b.level * float64(leakInterval)))
+    return delay, true, int64(float64(capacity) - b.level), nil
+}
@@ -0,0 +1,395 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "net"
+    "os"
+    "sync"
+    "syscall"
+    "time"
+)
+
+type localRequest struct {
+    Op             string         `json:"op"` // "get", "set", "reset", "set_if_below", "add_if_below", "oldest_expiry", "seen", "mark_seen", "flag", "flagged", "take_token", "enqueue" or "conform"
+    Key            RateLimiterKey `json:"key"`
+    RequestId      string         `json:"request_id,omitempty"`
+    Flag           string         `json:"flag,omitempty"` // The user is in Key
+    Capacity       int64          `json:"capacity,omitempty"`
+    Cost           int64          `json:"cost,omitempty"`
+    Timestamp      time.Time      `json:"timestamp,omitempty"`
+    WindowInterval time.Duration  `json:"window_interval,omitempty"`
+    TTL            time.Duration  `json:"ttl,omitempty"`
+}
+
+type localResponse struct {
+    // Count is the nanoseconds left of oldest_expiry, the count before add_if_below, minus one and negated if it didn't
+    // count the request, 1 for a request counted by set_if_below, a seen request id, a flagged user, a token taken or a
+    // conforming request, and the delay of an enqueued request or -1 if its bucket is full
+    Count int64 `json:"count,omitempty"`
+    // Remaining is the budget left after take_token, enqueue and conform
+    Remaining int64  `json:"remaining,omitempty"`
+    Error     string `json:"error,omitempty"`
+}
+
+// local shares an in-memory Store between the processes of a host through a unix socket.
+type local struct {
+    ctx    context.Context
+    cancel context.CancelFunc
+    path   string
+    logger *slog.Logger
+    wg     sync.WaitGroup // The goroutines of the aggregator
+
+    mu      sync.Mutex
+    store   Store // Set when this process is the aggregator
+    conn    net.Conn
+    encoder *json.Encoder
+    decoder *json.Decoder
+    closed  bool
+}
+
+// LocalOption configures the local store.
+type LocalOption func(*local)
+
+// WithLocalLogger sets the logger of the aggregator.
+//
+// Defaults to slog.Default() if not specified
+func WithLocalLogger(logger *slog.Logger) LocalOption {
+    return func(l *local) {
+        l.logger = logger
+    }
+}
+
+// NewLocalStore creates a Store sharing its counts between the processes of a host, e.g. prefork workers, so the
+// limits are per host rather than per process.
+//
+// The first process to start listens on the unix socket at socketPath and keeps the counts in memory, the aggregator.
+// The others forward their calls to it. If the aggregator exits, the next call of another process takes over with
+// empty counts. The socket is removed when ctx is done or the store is closed.
+func NewLocalStore(ctx context.Context, socketPath string, opts ...LocalOption) (Store, error) {
+    ctx, cancel := context.WithCancel(ctx)
+    l := &local{
+        ctx:    ctx,
+        cancel: cancel,
+        path:   socketPath,
+    }
+    for _, opt := range opts {
+        opt(l)
+    }
+    l.logger = storeLogger(l.logger)
+    if err := l.connect(); err != nil {
+        cancel()
+        return nil, err
+    }
+    return l, nil
+}
+
+// connect dials the aggregator, or becomes it when there is none.
+func (l *local) connect() error {
+    conn, err := net.Dial("unix", l.path)
+    if err == nil {
+        l.conn = conn
+        l.encoder = json.NewEncoder(conn)
+        l.decoder = json.NewDecoder(conn)
+        return nil
+    }
+    if errors.Is(err, syscall.ECONNREFUSED) {
+        // The socket was left behind by an aggregator that exited
+        if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+            return fmt.Errorf("failed to remove stale socket %s: %w", l.path, err)
+        }
+    } else if !errors.Is(err, os.ErrNotExist) {
+        return fmt.Errorf("failed to connect to local store %s: %w", l.path, err)
+    }
+
+    listener, err := net.Listen("unix", l.path)
+    if err != nil {
+        if errors.Is(err, syscall.EADDRINUSE) {
+            // Another process became the aggregator first
+            return l.connect()
+        }
+        return fmt.Errorf("failed to listen on %s: %w", l.path, err)
+    }
+    l.store = NewMemoryStore()
+    l.wg.Add(2)
+    go func() {
+        defer l.wg.Done()
+        <-l.ctx.Done()
+        _ = listener.Close() // Removes the socket
+    }()
+    go l.serve(listener)
+    return nil
+}
+
+func (l *local) serve(listener net.Listener) {
+    defer l.wg.Done()
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            if !errors.Is(err, net.ErrClosed) {
+                l.logger.Error("Error accepting local store connection", "path", l.path, "error", err)
+            }
+            return
+        }
+        l.wg.Add(1)
+        go l.serveConn(conn)
+    }
+}
+
+func (l *local) serveConn(conn net.Conn) {
+    defer l.wg.Done()
+    defer conn.Close()
+    // Hang up on the other processes when ctx is done so they take over
+    stop := context.AfterFunc(l.ctx, func() { _ = conn.Close() })
+    defer stop()
+    decoder := json.NewDecoder(conn)
+    encoder := json.NewEncoder(conn)
+    for {
+        var req localRequest
+        if err := decoder.Decode(&req); err != nil {
+            // The process exited or closed the connection after an error
+            return
+        }
+        var (
+            resp localResponse
+            err  error
+        )
+        switch req.Op {
+        case "get":
+            resp.Count, err = l.store.Get(l.ctx, req.Key)
+        case "set":
+            err = l.store.Set(l.ctx, req.Key, req.Timestamp, req.WindowInterval, req.TTL)
+        case "reset":
+            err = l.store.Reset(l.ctx, req.Key)
+        case "set_if_below", "add_if_below", "oldest_expiry", "seen", "mark_seen", "flag", "flagged", "take_token", "enqueue", "conform":
+            resp, err = l.extension(l.ctx, req)
+        default:
+            err = fmt.Errorf("unknown operation %q", req.Op)
+        }
+        if err != nil {
+            resp.Error = err.Error()
+        }
+        if err := encoder.Encode(resp); err != nil {
+            return
+        }
+    }
+}
+
+// do runs the request on the aggregator and returns the count of its response.
+func (l *local) do(ctx context.Context, req localRequest) (int64, error) {
+    resp, err := l.call(ctx, req)
+    return resp.Count, err
+}
+
+// call runs the request on the aggregator.
+func (l *local) call(ctx context.Context, req localRequest) (localResponse, error) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    if l.closed {
+        return localResponse{}, fmt.Errorf("local store %s is closed: %w", l.path, net.ErrClosed)
+    }
+    if l.store == nil && l.conn == nil {
+        if err := l.connect(); err != nil {
+            return localResponse{}, err
+        }
+    }
+    if l.store != nil {
+        switch req.Op {
+        case "get":
+            count, err := l.store.Get(ctx, req.Key)
+            return localResponse{Count: count}, err
+        case "set":
+            return localResponse{}, l.store.Set(ctx, req.Key, req.Timestamp, req.WindowInterval, req.TTL)
+        case "reset":
+            return localResponse{}, l.store.Reset(ctx, req.Key)
+        default:
+            return l.extension(ctx, req)
+        }
+    }
+
+    deadline, _ := ctx.Deadline() // The zero time clears the deadline
+    if err := l.conn.SetDeadline(deadline); err != nil {
+        return localResponse{}, l.reset(fmt.Errorf("failed to set deadline on local store: %w", err))
+    }
+    if err := l.encoder.Encode(req); err != nil {
+        return localResponse{}, l.reset(fmt.Errorf("failed to send %s to local store: %w", req.Op, err))
+    }
+    var resp localResponse
+    if err := l.decoder.Decode(&resp); err != nil {
+        return localResponse{}, l.reset(fmt.Errorf("failed to receive %s from local store: %w", req.Op, err))
+    }
+    if resp.Error != "" {
+        return localResponse{}, fmt.Errorf("local store failed to %s: %s", req.Op, resp.Error)
+    }
+    return resp, nil
+}
+
+// reset drops the connection so the next call reconnects, taking over if the aggregator exited.
+func (l *local) reset(err error) error {
+    _ = l.conn.Close()
+    l.conn = nil
+    return err
+}
+
+// Close hangs up on the aggregator, or when this process is the aggregator removes the socket and hangs up on the
+// other processes so the next of their calls takes over. It waits for the connections to be closed.
+func (l *local) Close() error {
+    l.mu.Lock()
+    l.closed = true
+    if l.conn != nil {
+        _ = l.reset(nil)
+    }
+    l.mu.Unlock()
+    l.cancel()
+    l.wg.Wait()
+    return nil
+}
+
+func (l *local) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    return l.do(ctx, localRequest{Op: "get", Key: key})
+}
+
+func (l *local) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    _, err := l.do(ctx, localRequest{
+        Op:             "set",
+        Key:            key,
+        Timestamp:      timestamp,
+        WindowInterval: windowInterval,
+        TTL:            ttl,
+    })
+    return err
+}
+
+func (l *local) Reset(ctx context.Context, key RateLimiterKey) error {
+    _, err := l.do(ctx, localRequest{Op: "reset", Key: key})
+    return err
+}
+
+func (l *local) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    counted, err := l.do(ctx, localRequest{
+        Op:             "set_if_below",
+        Key:            key,
+        Capacity:       limit,
+        Timestamp:      timestamp,
+        WindowInterval: windowInterval,
+        TTL:            ttl,
+    })
+    return counted == 1, err
+}
+
+func (l *local) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    count, err := l.do(ctx, localRequest{
+        Op:             "add_if_below",
+        Key:            key,
+        Cost:           cost,
+        Capacity:       limit,
+        Timestamp:      timestamp,
+        WindowInterval: windowInterval,
+        TTL:            ttl,
+    })
+    if err != nil {
+        return 0, false, err
+    }
+    if count < 0 {
+        return -count - 1, false, nil
+    }
+    return count, true, nil
+}
+
+func (l *local) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    left, err := l.do(ctx, localRequest{Op: "oldest_expiry", Key: key, Timestamp: now, WindowInterval: windowInterval, TTL: ttl})
+    return time.Duration(left), err
+}
+
+func (l *local) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    seen, err := l.do(ctx, localRequest{Op: "seen", Key: key, RequestId: requestId})
+    return seen == 1, err
+}
+
+func (l *local) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    _, err := l.do(ctx, localRequest{Op: "mark_seen", Key: key, RequestId: requestId, TTL: ttl})
+    return err
+}
+
+func (l *local) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    _, err := l.do(ctx, localRequest{Op: "flag", Key: RateLimiterKey{UserId: userId}, Flag: flag, TTL: ttl})
+    return err
+}
+
+func (l *local) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    flagged, err := l.do(ctx, localRequest{Op: "flagged", Key: RateLimiterKey{UserId: userId}, Flag: flag})
+    return flagged == 1, err
+}
+
+func (l *local) TakeToken(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, refillInterval time.Duration) (bool, int64, error) {
+    resp, err := l.call(ctx, localRequest{Op: "take_token", Key: key, Timestamp: now, Capacity: capacity, WindowInterval: refillInterval})
+    return resp.Count == 1, resp.Remaining, err
+}
+
+func (l *local) Enqueue(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, leakInterval time.Duration) (time.Duration, bool, int64, error) {
+    resp, err := l.call(ctx, localRequest{Op: "enqueue", Key: key, Timestamp: now, Capacity: capacity, WindowInterval: leakInterval})
+    if err != nil || resp.Count < 0 {
+        return 0, false, 0, err
+    }
+    return time.Duration(resp.Count), true, resp.Remaining, nil
+}
+
+func (l *local) Conform(ctx context.Context, key RateLimiterKey, now time.Time, emissionInterval, tolerance time.Duration) (bool, int64, error) {
+    resp, err := l.call(ctx, localRequest{Op: "conform", Key: key, Timestamp: now, WindowInterval: emissionInterval, TTL: tolerance})
+    return resp.Count == 1, resp.Remaining, err
+}
+
+// extension runs an AtomicStore, WindowExpirer, Deduplicator, Flagger, TokenBucketStore, LeakyBucketStore or GCRAStore
+// request on the in-memory store of the aggregator.
+func (l *local) extension(ctx context.Context, req localRequest) (localResponse, error) {
+    var (
+        resp localResponse
+        ok   bool
+        err  error
+    )
+    switch req.Op {
+    case "mark_seen":
+        return resp, l.store.(Deduplicator).MarkSeen(ctx, req.Key, req.RequestId, req.TTL)
+    case "flag":
+        return resp, l.store.(Flagger).Flag(ctx, req.Key.UserId, req.Flag, req.TTL)
+    case "set_if_below":
+        // Capacity is the limit
+        ok, err = l.store.(AtomicStore).SetIfBelow(ctx, req.Key, req.Capacity, req.Timestamp, req.WindowInterval, req.TTL)
+    case "add_if_below":
+        // Capacity is the limit
+        count, added, err := l.store.(AtomicStore).AddIfBelow(ctx, req.Key, req.Cost, req.Capacity, req.Timestamp, req.WindowInterval, req.TTL)
+        if !added {
+            count = -count - 1
+        }
+        return localResponse{Count: count}, err
+    case "oldest_expiry":
+        left, err := l.store.(WindowExpirer).OldestExpiry(ctx, req.Key, req.Timestamp, req.WindowInterval, req.TTL)
+        return localResponse{Count: int64(left)}, err
+    case "seen":
+        ok, err = l.store.(Deduplicator).Seen(ctx, req.Key, req.RequestId)
+    case "flagged":
+        ok, err = l.store.(Flagger).Flagged(ctx, req.Key.UserId, req.Flag)
+    case "take_token":
+        // WindowInterval is the refill interval
+        ok, resp.Remaining, err = l.store.(TokenBucketStore).TakeToken(ctx, req.Key, req.Timestamp, req.Capacity, req.WindowInterval)
+    case "enqueue":
+        // WindowInterval is the leak interval
+        delay, ok, remaining, err := l.store.(LeakyBucketStore).Enqueue(ctx, req.Key, req.Timestamp, req.Capacity, req.WindowInterval)
+        if !ok {
+            return localResponse{Count: -1}, err
+        }
+        return localResponse{Count: int64(delay), Remaining: remaining}, err
+    case "conform":
+        // WindowInterval is the emission interval and TTL the tolerance
+        ok, resp.Remaining, err = l.store.(GCRAStore).Conform(ctx, req.Key, req.Timestamp, req.WindowInterval, req.TTL)
+    default:
+        return resp, fmt.Errorf("unknown operation %q", req.Op)
+    }
+    if ok {
+        resp.Count = 1
+    }
+    return resp, err
+}
@@ -0,0 +1,219 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "github.com/bradfitz/gomemcache/memcache"
+    "net/url"
+    "strconv"
+    "time"
+)
+
+const (
+    // maxMemcachedKeyLength is the longest key memcached accepts, longer names are hashed
+    maxMemcachedKeyLength = 250
+    // maxMemcachedRelativeExpiration is the longest expiration memcached reads as seconds, the longer ones are unix
+    // timestamps
+    maxMemcachedRelativeExpiration = 30 * 24 * time.Hour
+)
+
+type memcached struct {
+    client *memcache.Client
+    owned  bool // The client was created by the store and is closed with it
+}
+
+// NewMemcachedStore creates a Store on the memcached servers, the keys are spread across them.
+func NewMemcachedStore(servers ...string) Store {
+    return &memcached{client: memcache.New(servers...), owned: true}
+}
+
+// NewMemcachedStoreWithClient creates a Store on an existing memcached client, so the connections can be shared.
+//
+// Memcached can't list keys, so the buckets are found by name from their windows, see WindowCounter, and Get fails.
+// The counts are checked and incremented with incr, see AtomicStore.
+func NewMemcachedStoreWithClient(client *memcache.Client) Store {
+    return &memcached{client: client}
+}
+
+// memcachedName hashes the names too long for memcached. The parts of the names are query escaped, memcached doesn't
+// accept spaces and control characters in keys.
+func memcachedName(name string) string {
+    if len(name) > maxMemcachedKeyLength {
+        sum := sha256.Sum256([]byte(name))
+        return "ratelimiter:" + hex.EncodeToString(sum[:])
+    }
+    return name
+}
+
+func generateMemcachedKey(key RateLimiterKey, timestampWindow time.Time) string {
+    return memcachedName(fmt.Sprintf("ratelimiter:%s#%s#%d", url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint), timestampWindow.Unix()))
+}
+
+func generateMemcachedSeenKey(key RateLimiterKey, requestId string) string {
+    return memcachedName(fmt.Sprintf("ratelimiter:seen:%s#%s#%s", url.QueryEscape(key.UserId), url.QueryEscape(key.Endpoint), url.QueryEscape(requestId)))
+}
+
+func generateMemcachedFlagKey(userId, flag string) string {
+    return memcachedName(fmt.Sprintf("ratelimiter:flag:%s:%s", url.QueryEscape(flag), url.QueryEscape(userId)))
+}
+
+// memcachedExpiration converts the ttl to the expiration of memcached, at least a second.
+func memcachedExpiration(ttl time.Duration) int32 {
+    if ttl > maxMemcachedRelativeExpiration {
+        return int32(time.Now().Add(ttl).Unix())
+    }
+    return int32(max((ttl+time.Second-1)/time.Second, 1))
+}
+
+func (m *memcached) Get(_ context.Context, key RateLimiterKey) (int64, error) {
+    return 0, fmt.Errorf("memcached can't list the buckets of %s#%s: %w", key.UserId, key.Endpoint, errors.ErrUnsupported)
+}
+
+func (m *memcached) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    _, err := m.incrBy(generateMemcachedKey(key, WindowStart(timestamp, windowInterval)), 1, ttl)
+    return err
+}
+
+func (m *memcached) Reset(_ context.Context, key RateLimiterKey) error {
+    return fmt.Errorf("memcached can't list the buckets of %s#%s: %w", key.UserId, key.Endpoint, errors.ErrUnsupported)
+}
+
+// Close closes the idle connections if the store created the client, see NewMemcachedStore.
+func (m *memcached) Close() error {
+    if !m.owned {
+        return nil
+    }
+    return m.client.Close()
+}
+
+// incrBy increments the bucket by cost and returns its count, creating it with the ttl if it doesn't exist.
+func (m *memcached) incrBy(k string, cost int64, ttl time.Duration) (int64, error) {
+    count, err := m.client.Increment(k, uint64(cost))
+    if errors.Is(err, memcache.ErrCacheMiss) {
+        err = m.client.Add(&memcache.Item{Key: k, Value: []byte(strconv.FormatInt(cost, 10)), Expiration: memcachedExpiration(ttl)})
+        if err == nil {
+            return cost, nil
+        }
+        if errors.Is(err, memcache.ErrNotStored) {
+            // Another instance created the bucket first
+            count, err = m.client.Increment(k, uint64(cost))
+        }
+    }
+    if err != nil {
+        return 0, fmt.Errorf("failed to increment rate limiter %s: %w", k, err)
+    }
+    return int64(count), nil
+}
+
+func (m *memcached) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if windowInterval <= 0 {
+        // No window to derive the names from
+        return m.Get(ctx, key)
+    }
+    if err := ctx.Err(); err != nil {
+        return 0, err
+    }
+    return m.sumKeys(windowKeys(generateMemcachedKey, key, now, windowInterval, ttl))
+}
+
+// sumKeys sums the counters of the keys, missing keys count for 0.
+func (m *memcached) sumKeys(keys []string) (int64, error) {
+    if len(keys) == 0 {
+        return 0, nil
+    }
+    items, err := m.client.GetMulti(keys)
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s: %w", keys[0], err)
+    }
+    var count int64
+    for k, item := range items {
+        v, err := strconv.ParseInt(string(item.Value), 10, 64)
+        if err != nil {
+            return 0, fmt.Errorf("failed to parse rate limiter %s: %w", k, err)
+        }
+        if count, err = AddCount(count, v); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", k, v, err)
+        }
+    }
+    return count, nil
+}
+
+func (m *memcached) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := m.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+// AddIfBelow increments the bucket first and takes the increment back if the count went over the limit, so concurrent
+// requests can't all take the last free slot. The count of the bucket is the one returned by its increment, so each
+// of the requests racing for the last slots sees its own place in it and exactly the free slots are taken.
+func (m *memcached) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    if windowInterval <= 0 {
+        // No window to derive the names from
+        _, err := m.Get(ctx, key)
+        return 0, false, err
+    }
+    if err := ctx.Err(); err != nil {
+        return 0, false, err
+    }
+    keys := windowKeys(generateMemcachedKey, key, timestamp, windowInterval, ttl)
+    k := keys[0]
+    current, err := m.incrBy(k, cost, ttl)
+    if err != nil {
+        return 0, false, err
+    }
+    count, err := m.sumKeys(keys[1:])
+    count += current
+    if err == nil && count <= limit {
+        return count - cost, true, nil
+    }
+    if _, decrErr := m.client.Decrement(k, uint64(cost)); decrErr != nil && !errors.Is(decrErr, memcache.ErrCacheMiss) {
+        return 0, false, fmt.Errorf("failed to take back rate limiter %s: %w", k, decrErr)
+    }
+    return max(count-cost, 0), false, err
+}
+
+func (m *memcached) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    return m.exists(ctx, generateMemcachedSeenKey(key, requestId))
+}
+
+func (m *memcached) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    return m.mark(ctx, generateMemcachedSeenKey(key, requestId), ttl)
+}
+
+func (m *memcached) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    return m.mark(ctx, generateMemcachedFlagKey(userId, flag), ttl)
+}
+
+func (m *memcached) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    return m.exists(ctx, generateMemcachedFlagKey(userId, flag))
+}
+
+func (m *memcached) exists(ctx context.Context, k string) (bool, error) {
+    if err := ctx.Err(); err != nil {
+        return false, err
+    }
+    _, err := m.client.Get(k)
+    if errors.Is(err, memcache.ErrCacheMiss) {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to check %s: %w", k, err)
+    }
+    return true, nil
+}
+
+func (m *memcached) mark(ctx context.Context, k string, ttl time.Duration) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    if err := m.client.Set(&memcache.Item{Key: k, Value: []byte("1"), Expiration: memcachedExpiration(ttl)}); err != nil {
+        return fmt.Errorf("failed to set %s: %w", k, err)
+    }
+    return nil
+}
@@ -0,0 +1,195 @@
+package rate_limiter_store
+
+import (
+    "bufio"
+    "context"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeMemcached speaks the text protocol of memcached for the commands of the store, with a clock the tests advance.
+type fakeMemcached struct {
+    listener net.Listener
+
+    mu    sync.Mutex
+    now   time.Time
+    items map[string]fakeItem
+    cas   uint64
+}
+
+type fakeItem struct {
+    value     []byte
+    expiresAt time.Time
+}
+
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+    t.Helper()
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("Listen: %v", err)
+    }
+    m := &fakeMemcached{listener: listener, now: time.Now(), items: make(map[string]fakeItem)}
+    t.Cleanup(func() {
+        _ = listener.Close()
+    })
+    go func() {
+        for {
+            conn, err := listener.Accept()
+            if err != nil {
+                return
+            }
+            go m.serve(conn)
+        }
+    }()
+    return m
+}
+
+func (m *fakeMemcached) addr() string {
+    return m.listener.Addr().String()
+}
+
+// advance moves the clock of the expirations.
+func (m *fakeMemcached) advance(d time.Duration) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.now = m.now.Add(d)
+}
+
+func (m *fakeMemcached) serve(conn net.Conn) {
+    defer conn.Close()
+    r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            return
+        }
+        var value []byte
+        if fields[0] == "set" || fields[0] == "add" {
+            n, _ := strconv.Atoi(fields[4])
+            value = make([]byte, n+2)
+            if _, err := io.ReadFull(r, value); err != nil {
+                return
+            }
+            value = value[:n]
+        }
+        m.handle(w, fields, value)
+        if err := w.Flush(); err != nil {
+            return
+        }
+    }
+}
+
+func (m *fakeMemcached) handle(w *bufio.Writer, fields []string, value []byte) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    get := func(k string) (fakeItem, bool) {
+        item, ok := m.items[k]
+        if ok && !m.now.Before(item.expiresAt) {
+            delete(m.items, k)
+            return fakeItem{}, false
+        }
+        return item, ok
+    }
+    switch fields[0] {
+    case "get", "gets":
+        for _, k := range fields[1:] {
+            if item, ok := get(k); ok {
+                m.cas++
+                _, _ = fmt.Fprintf(w, "VALUE %s 0 %d %d\r\n%s\r\n", k, len(item.value), m.cas, item.value)
+            }
+        }
+        _, _ = w.WriteString("END\r\n")
+    case "set", "add":
+        if _, ok := get(fields[1]); ok && fields[0] == "add" {
+            _, _ = w.WriteString("NOT_STORED\r\n")
+            return
+        }
+        exp, _ := strconv.ParseInt(fields[3], 10, 64)
+        expiresAt := m.now.Add(time.Duration(exp) * time.Second)
+        if time.Duration(exp)*time.Second > maxMemcachedRelativeExpiration {
+            expiresAt = time.Unix(exp, 0)
+        }
+        m.items[fields[1]] = fakeItem{value: value, expiresAt: expiresAt}
+        _, _ = w.WriteString("STORED\r\n")
+    case "incr", "decr":
+        item, ok := get(fields[1])
+        if !ok {
+            _, _ = w.WriteString("NOT_FOUND\r\n")
+            return
+        }
+        count, _ := strconv.ParseUint(string(item.value), 10, 64)
+        delta, _ := strconv.ParseUint(fields[2], 10, 64)
+        if fields[0] == "incr" {
+            count += delta
+        } else {
+            count -= min(count, delta)
+        }
+        item.value = []byte(strconv.FormatUint(count, 10))
+        m.items[fields[1]] = item
+        _, _ = fmt.Fprintf(w, "%d\r\n", count)
+    default:
+        _, _ = w.WriteString("ERROR\r\n")
+    }
+}
+
+func TestMemcachedNames(t *testing.T) {
+    key := RateLimiterKey{UserId: "ada lovelace", Endpoint: "/ping"}
+    if k := generateMemcachedKey(key, time.Unix(60, 0)); k != "ratelimiter:ada+lovelace#%2Fping#60" {
+        t.Fatalf("key %q, the escaped parts expected", k)
+    }
+    // The names too long for memcached are hashed
+    long := RateLimiterKey{UserId: strings.Repeat("a", 300), Endpoint: "/ping"}
+    if k := generateMemcachedKey(long, time.Unix(60, 0)); len(k) > maxMemcachedKeyLength || !strings.HasPrefix(k, "ratelimiter:") {
+        t.Fatalf("key %q of a long name", k)
+    }
+    if k, other := generateMemcachedSeenKey(long, "a"), generateMemcachedSeenKey(long, "b"); k == other {
+        t.Fatalf("hashed names of two requests collide: %q", k)
+    }
+
+    for ttl, exp := range map[time.Duration]int32{0: 1, 1500 * time.Millisecond: 2, time.Hour: 3600} {
+        if e := memcachedExpiration(ttl); e != exp {
+            t.Fatalf("expiration of %s: %d, %d expected", ttl, e, exp)
+        }
+    }
+    // Beyond 30 days memcached reads a unix timestamp
+    if e := memcachedExpiration(60 * 24 * time.Hour); int64(e) < time.Now().Add(59*24*time.Hour).Unix() {
+        t.Fatalf("expiration of 60 days: %d, a unix timestamp expected", e)
+    }
+}
+
+func TestMemcachedStoreTakesBackTheRejections(t *testing.T) {
+    m := newFakeMemcached(t)
+    store := NewMemcachedStore(m.addr())
+    defer store.Close()
+    ctx := context.Background()
+    key := RateLimiterKey{UserId: "ada", Endpoint: "/ping"}
+    now := time.Now()
+    // A request of an earlier window counts towards the limit
+    if err := store.Set(ctx, key, now.Add(-time.Second), time.Second, time.Minute); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    for i, allowed := range []bool{true, true, false, false} {
+        if added, err := store.(AtomicStore).SetIfBelow(ctx, key, 3, now, time.Second, time.Minute); err != nil || added != allowed {
+            t.Fatalf("SetIfBelow %d: %t, %v, %t expected", i, added, err, allowed)
+        }
+    }
+    // The rejected requests are not counted
+    if count, err := store.(WindowCounter).CountWindows(ctx, key, now, time.Second, time.Minute); err != nil || count != 3 {
+        t.Fatalf("CountWindows: %d, %v, 3 expected", count, err)
+    }
+    // The buckets expire with their ttl
+    m.advance(2 * time.Minute)
+    if count, err := store.(WindowCounter).CountWindows(ctx, key, now, time.Second, time.Minute); err != nil || count != 0 {
+        t.Fatalf("CountWindows after the ttl: %d, %v, 0 expected", count, err)
+    }
+}
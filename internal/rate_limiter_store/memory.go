@@ -0,0 +1,224 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+type memoryBucket struct {
+    count     int64
+    expiresAt time.Time
+}
+
+type seenRequest struct {
+    key       RateLimiterKey
+    requestId string
+}
+
+type memory struct {
+    now          func() time.Time
+    mu           sync.Mutex
+    buckets      map[RateLimiterKey]map[int64]*memoryBucket // Keyed by the unix start of the window
+    bucketsSwept time.Time                                  // Last time the expired buckets were dropped
+    seen         map[seenRequest]time.Time                  // Expiry of the recorded request ids
+    swept        time.Time                                  // Last time the expired request ids were dropped
+    flags        map[string]time.Time                       // Expiry of the flags, keyed by flag and user
+    flagsSwept   time.Time                                  // Last time the expired flags were dropped
+
+    tokenBuckets map[RateLimiterKey]*memoryTokenBucket
+    tokensSwept  time.Time // Last time the full token buckets were dropped
+
+    leakyBuckets map[RateLimiterKey]*memoryLeakyBucket
+    leakySwept   time.Time // Last time the empty leaky buckets were dropped
+
+    tats      map[RateLimiterKey]time.Time // Theoretical arrival times of the GCRA
+    tatsSwept time.Time                    // Last time the past arrival times were dropped
+}
+
+// MemoryOption configures the memory store.
+type MemoryOption func(*memory)
+
+// WithMemoryClock sets the clock the expiry of the counters, the request ids and the flags follows, e.g. the simulated
+// clock of a replay. The timestamps passed to the methods must follow it too.
+//
+// Defaults to time.Now if not specified
+func WithMemoryClock(now func() time.Time) MemoryOption {
+    return func(m *memory) {
+        m.now = now
+    }
+}
+
+// NewMemoryStore creates an in-process Store, limits are per process and the counts are lost on restart.
+func NewMemoryStore(opts ...MemoryOption) Store {
+    m := &memory{
+        now:     time.Now,
+        buckets: make(map[RateLimiterKey]map[int64]*memoryBucket),
+        seen:    make(map[seenRequest]time.Time),
+        flags:   make(map[string]time.Time),
+
+        tokenBuckets: make(map[RateLimiterKey]*memoryTokenBucket),
+        leakyBuckets: make(map[RateLimiterKey]*memoryLeakyBucket),
+        tats:         make(map[RateLimiterKey]time.Time),
+    }
+    for _, opt := range opts {
+        opt(m)
+    }
+    return m
+}
+
+func (m *memory) Get(_ context.Context, key RateLimiterKey) (int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.count(key)
+}
+
+// count sums the buckets of the key that have not expired, m.mu must be held.
+func (m *memory) count(key RateLimiterKey) (int64, error) {
+    var (
+        count int64
+        err   error
+    )
+    now := m.now()
+    for window, b := range m.buckets[key] {
+        if !now.Before(b.expiresAt) {
+            delete(m.buckets[key], window)
+            continue
+        }
+        if count, err = AddCount(count, b.count); err != nil {
+            return 0, err
+        }
+    }
+    if len(m.buckets[key]) == 0 {
+        delete(m.buckets, key)
+    }
+    return count, nil
+}
+
+func (m *memory) Set(_ context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.increment(key, 1, timestamp, windowInterval, ttl)
+    return nil
+}
+
+// increment counts a request for cost in the bucket of the timestamp, m.mu must be held.
+func (m *memory) increment(key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) {
+    now := m.now()
+    if now.Sub(m.bucketsSwept) >= time.Second {
+        // The keys of the users who left are never read again, drop their expired buckets as new ones are counted
+        for k, windows := range m.buckets {
+            for window, b := range windows {
+                if !now.Before(b.expiresAt) {
+                    delete(windows, window)
+                }
+            }
+            if len(windows) == 0 {
+                delete(m.buckets, k)
+            }
+        }
+        m.bucketsSwept = now
+    }
+    if m.buckets[key] == nil {
+        m.buckets[key] = make(map[int64]*memoryBucket)
+    }
+    window := WindowStart(timestamp, windowInterval).Unix()
+    b, ok := m.buckets[key][window]
+    if !ok || !now.Before(b.expiresAt) {
+        // Set the TTL if this is a new time window
+        b = &memoryBucket{expiresAt: now.Add(ttl)}
+        m.buckets[key][window] = b
+    }
+    b.count, _ = AddCount(b.count, cost)
+}
+
+func (m *memory) OldestExpiry(_ context.Context, key RateLimiterKey, _ time.Time, _, _ time.Duration) (time.Duration, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    var oldest time.Duration
+    now := m.now()
+    for _, b := range m.buckets[key] {
+        if left := b.expiresAt.Sub(now); left > 0 && (oldest == 0 || left < oldest) {
+            oldest = left
+        }
+    }
+    return oldest, nil
+}
+
+func (m *memory) Seen(_ context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    r := seenRequest{key: key, requestId: requestId}
+    expiresAt, ok := m.seen[r]
+    if ok && !m.now().Before(expiresAt) {
+        delete(m.seen, r)
+        return false, nil
+    }
+    return ok, nil
+}
+
+func (m *memory) MarkSeen(_ context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    now := m.now()
+    if now.Sub(m.swept) >= time.Second {
+        // Request ids are rarely retried, drop the expired ones as new ones are recorded
+        for r, expiresAt := range m.seen {
+            if !now.Before(expiresAt) {
+                delete(m.seen, r)
+            }
+        }
+        m.swept = now
+    }
+    m.seen[seenRequest{key: key, requestId: requestId}] = now.Add(ttl)
+    return nil
+}
+
+func (m *memory) Flag(_ context.Context, userId, flag string, ttl time.Duration) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    now := m.now()
+    if now.Sub(m.flagsSwept) >= time.Second {
+        // Most users are never flagged again, drop the expired flags as new ones are set
+        for k, expiresAt := range m.flags {
+            if !now.Before(expiresAt) {
+                delete(m.flags, k)
+            }
+        }
+        m.flagsSwept = now
+    }
+    m.flags[flag+"#"+userId] = now.Add(ttl)
+    return nil
+}
+
+func (m *memory) Flagged(_ context.Context, userId, flag string) (bool, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    k := flag + "#" + userId
+    expiresAt, ok := m.flags[k]
+    if ok && !m.now().Before(expiresAt) {
+        delete(m.flags, k)
+        return false, nil
+    }
+    return ok, nil
+}
+
+func (m *memory) Reset(_ context.Context, key RateLimiterKey) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.buckets, key)
+    delete(m.tokenBuckets, key)
+    delete(m.leakyBuckets, key)
+    delete(m.tats, key)
+    for r := range m.seen {
+        if r.key == key {
+            delete(m.seen, r)
+        }
+    }
+    return nil
+}
+
+// Close does nothing, the buckets are dropped with the store.
+func (m *memory) Close() error {
+    return nil
+}
@@ -2,77 +2,547 @@ package rate_limiter_store
 
 import (
     "context"
+    "crypto/tls"
     "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
     "github.com/mediocregopher/radix/v4"
+    "log/slog"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
     "time"
 )
 
-type redis struct {
-    client    radix.Client
-    scanCount int // Number of keys to scan in each iteration
+// SpanRedisCommand covers a command or script of a Redis client, see WithTracer.
+const SpanRedisCommand = "redis.command"
+
+// NetDialer creates the network connections to Redis, it is implemented by net.Dialer.
+type NetDialer interface {
+    DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+type redisOptions struct {
+    network        string
+    cluster        bool
+    sentinel       radix.SentinelConfig
+    primary        string // Name of the primary when connecting through Sentinel
+    pool           radix.PoolConfig
+    dialTimeout    time.Duration  // Zero to dial without a timeout
+    commandTimeout time.Duration  // Zero to bound the commands by their context only
+    tracer         tracing.Tracer // Nil to not trace the commands
+    replica        *replica
+    keyPrefix      string
+    logger         *slog.Logger // Nil for slog.Default()
+}
+
+// RedisOption configures the connection of the Redis store.
+type RedisOption func(*redisOptions)
+
+// WithUnixSocket connects to Redis over the unix socket at the host path instead of TCP.
+func WithUnixSocket() RedisOption {
+    return func(o *redisOptions) {
+        o.network = "unix"
+    }
+}
+
+// WithCluster connects to a Redis Cluster, the host is then a comma separated list of seed nodes the topology is
+// discovered from. The keys of a user and endpoint share a hash tag, so the scripts counting them run on one node.
+func WithCluster() RedisOption {
+    return func(o *redisOptions) {
+        o.cluster = true
+    }
+}
+
+// WithSentinel connects to the primary named primaryName as reported by Redis Sentinel, following its failovers. The
+// host is then a comma separated list of sentinels, the other options apply to the primary and replicas.
+func WithSentinel(primaryName string) RedisOption {
+    return func(o *redisOptions) {
+        o.primary = primaryName
+    }
+}
+
+// WithSentinelAuth authenticates the connections to the sentinels, which usually have other credentials than the
+// primary, see WithAuth.
+func WithSentinelAuth(username, password string) RedisOption {
+    return func(o *redisOptions) {
+        o.sentinel.SentinelDialer.AuthUser = username
+        o.sentinel.SentinelDialer.AuthPass = password
+    }
+}
+
+// WithNetDialer creates the connections with the dialer, e.g. to go through a proxy or an SSH tunnel.
+//
+// Defaults to net.Dialer if not specified
+func WithNetDialer(dialer NetDialer) RedisOption {
+    return func(o *redisOptions) {
+        o.pool.Dialer.NetDialer = dialer
+    }
+}
+
+// WithTLS connects to Redis over TLS, replacing the dialer, see TLSConfig.Load.
+func WithTLS(config *tls.Config) RedisOption {
+    return func(o *redisOptions) {
+        o.pool.Dialer.NetDialer = &tls.Dialer{Config: config}
+    }
+}
+
+// WithAuth authenticates the connections with an ACL user, or with the legacy requirepass when username is empty.
+func WithAuth(username, password string) RedisOption {
+    return func(o *redisOptions) {
+        o.pool.Dialer.AuthUser = username
+        o.pool.Dialer.AuthPass = password
+    }
+}
+
+// WithDB selects the logical database of the connections, e.g. to share a Redis between environments. Redis Cluster
+// only has the database 0.
+//
+// Defaults to 0 if not specified
+func WithDB(index int) RedisOption {
+    return func(o *redisOptions) {
+        o.pool.Dialer.SelectDB = strconv.Itoa(index)
+    }
+}
+
+// WithPoolSize sets the number of connections of the pool, per node on a cluster.
+//
+// Defaults to 4 times GOMAXPROCS if not specified
+func WithPoolSize(size int) RedisOption {
+    return func(o *redisOptions) {
+        o.pool.Size = size
+    }
+}
+
+// WithDialTimeout bounds the creation of each connection, including its authentication and the reconnections of the
+// pool.
+func WithDialTimeout(timeout time.Duration) RedisOption {
+    return func(o *redisOptions) {
+        o.dialTimeout = timeout
+    }
+}
+
+// WithCommandTimeout bounds each command or script, from writing it to reading its reply. The connections read and
+// write under the deadline of the context, so this is both the read and the write timeout, the tighter deadline of the
+// caller's context still applies.
+func WithCommandTimeout(timeout time.Duration) RedisOption {
+    return func(o *redisOptions) {
+        o.commandTimeout = timeout
+    }
+}
+
+// WithTracer traces each command or script in a SpanRedisCommand span, a child of the span of the caller, with the
+// command and its number of keys. The keys are left out, they hold the user ids.
+//
+// Defaults to no tracing if not specified
+func WithTracer(tracer tracing.Tracer) RedisOption {
+    return func(o *redisOptions) {
+        o.tracer = tracer
+    }
+}
+
+// WithKeyPrefix prefixes every key of the store, e.g. "ratelimit:orders:", so applications sharing a Redis don't
+// collide. The prefix is outside the hash tags, braces in it would put every key on the same cluster slot.
+//
+// It only applies to NewRedisStore and NewRedisStoreWithClient.
+func WithKeyPrefix(prefix string) RedisOption {
+    return func(o *redisOptions) {
+        o.keyPrefix = prefix
+    }
+}
+
+// WithLogger sets the logger of the store.
+//
+// Defaults to slog.Default() if not specified
+func WithLogger(logger *slog.Logger) RedisOption {
+    return func(o *redisOptions) {
+        o.logger = logger
+    }
 }
 
-func NewRedisStore(ctx context.Context, host string, scanCount int) (Store, error) {
-    poolConfig := radix.PoolConfig{}
-    c, err := poolConfig.New(ctx, "tcp", host)
+// NewRedisClient creates a Redis connection pool configured by the options.
+func NewRedisClient(ctx context.Context, host string, opts ...RedisOption) (radix.Client, error) {
+    o := redisOptions{network: "tcp"}
+    for _, opt := range opts {
+        opt(&o)
+    }
+    // The sentinels are reached like the primary, with their own credentials
+    o.sentinel.SentinelDialer.NetDialer = o.pool.Dialer.NetDialer
+    if o.dialTimeout > 0 {
+        o.pool.Dialer = timeoutDialer(o.pool.Dialer, o.dialTimeout)
+        o.sentinel.SentinelDialer = timeoutDialer(o.sentinel.SentinelDialer, o.dialTimeout)
+    }
+    if o.cluster {
+        if db := o.pool.Dialer.SelectDB; db != "" && db != "0" {
+            return nil, fmt.Errorf("failed to connect to Redis Cluster: database %s can't be selected on a cluster", db)
+        }
+        c, err := (radix.ClusterConfig{PoolConfig: o.pool}).New(ctx, strings.Split(host, ","))
+        if err != nil {
+            return nil, fmt.Errorf("failed to connect to Redis Cluster: %w", err)
+        }
+        return &multiClient{MultiClient: c, addrs: host, actions: o.actions()}, nil
+    }
+    if o.primary != "" {
+        sentinel := o.sentinel
+        sentinel.PoolConfig = o.pool
+        c, err := sentinel.New(ctx, o.primary, strings.Split(host, ","))
+        if err != nil {
+            return nil, fmt.Errorf("failed to connect to Redis primary %s through Sentinel: %w", o.primary, err)
+        }
+        return &multiClient{MultiClient: c, addrs: host, actions: o.actions()}, nil
+    }
+    c, err := o.pool.New(ctx, o.network, host)
     if err != nil {
         return nil, fmt.Errorf("failed to create Redis pool: %w", err)
     }
+    if o.commandTimeout > 0 || o.tracer != nil {
+        return &actionClient{Client: c, actions: o.actions()}, nil
+    }
+    return c, nil
+}
+
+// timeoutDialer bounds each connection of the dialer, from connecting to the replies of AUTH and SELECT.
+func timeoutDialer(dialer radix.Dialer, timeout time.Duration) radix.Dialer {
+    return radix.Dialer{
+        CustomConn: func(ctx context.Context, network, addr string) (radix.Conn, error) {
+            ctx, cancel := context.WithTimeout(ctx, timeout)
+            defer cancel()
+            return dialer.Dial(ctx, network, addr)
+        },
+    }
+}
+
+// actions returns what applies to each action of the client.
+func (o *redisOptions) actions() actionOptions {
+    return actionOptions{timeout: o.commandTimeout, tracer: o.tracer}
+}
+
+// actionOptions bounds and traces each action of a client.
+type actionOptions struct {
+    timeout time.Duration  // Zero for no bound
+    tracer  tracing.Tracer // Nil for no tracing
+}
+
+// do performs the action with do, under the timeout and in a span.
+func (a actionOptions) do(ctx context.Context, action radix.Action, do func(context.Context, radix.Action) error) (err error) {
+    if a.tracer != nil {
+        var span tracing.Span
+        ctx, span = a.tracer.Start(ctx, SpanRedisCommand,
+            tracing.Attribute{Key: "db.system", Value: "redis"},
+            tracing.Attribute{Key: "db.operation", Value: commandName(action)},
+            tracing.Attribute{Key: "db.redis.keys", Value: len(action.Properties().Keys)})
+        defer func() {
+            if err != nil {
+                span.RecordError(err)
+            }
+            span.End()
+        }()
+    }
+    if a.timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, a.timeout)
+        defer cancel()
+    }
+    return do(ctx, action)
+}
+
+// commandName returns the command of the action, EVALSHA for the scripts whose actions don't tell it.
+func commandName(action radix.Action) string {
+    switch a := action.(type) {
+    case *radix.Pipeline:
+        return "PIPELINE"
+    case fmt.Stringer:
+        // The commands are formatted as ["GET" "key"]
+        name, _, _ := strings.Cut(strings.TrimPrefix(a.String(), `["`), `"`)
+        return name
+    default:
+        return "EVALSHA"
+    }
+}
+
+// actionClient bounds and traces each action of the client.
+type actionClient struct {
+    radix.Client
+    actions actionOptions
+}
+
+func (c *actionClient) Do(ctx context.Context, action radix.Action) error {
+    return c.actions.do(ctx, action, c.Client.Do)
+}
+
+// multiClient is a radix.Cluster or radix.Sentinel used as a radix.Client, the actions are routed to the primary of
+// their keys.
+type multiClient struct {
+    radix.MultiClient
+    addrs   string
+    actions actionOptions
+}
+
+func (c *multiClient) Do(ctx context.Context, action radix.Action) error {
+    return c.actions.do(ctx, action, c.MultiClient.Do)
+}
+
+func (c *multiClient) DoSecondary(ctx context.Context, action radix.Action) error {
+    return c.actions.do(ctx, action, c.MultiClient.DoSecondary)
+}
+
+func (c *multiClient) Addr() net.Addr {
+    return multiAddr(c.addrs)
+}
+
+// cluster returns the cluster of the client, if it is one.
+func cluster(client radix.Client) (*radix.Cluster, bool) {
+    m, ok := client.(*multiClient)
+    if !ok {
+        return nil, false
+    }
+    c, ok := m.MultiClient.(*radix.Cluster)
+    return c, ok
+}
+
+// multiAddr is the seed nodes of a cluster or the sentinels.
+type multiAddr string
+
+func (multiAddr) Network() string {
+    return "tcp"
+}
+
+func (a multiAddr) String() string {
+    return string(a)
+}
+
+// closing is a context done when a store is closed, so the calls in flight stop instead of holding the connections.
+type closing struct {
+    ctx    context.Context
+    cancel context.CancelFunc
+}
+
+func newClosing() closing {
+    ctx, cancel := context.WithCancel(context.Background())
+    return closing{ctx: ctx, cancel: cancel}
+}
+
+// scope returns a context done when ctx is done or the store is closed, stop releases it.
+func (c closing) scope(ctx context.Context) (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancel(ctx)
+    unregister := context.AfterFunc(c.ctx, cancel)
+    return ctx, func() {
+        unregister()
+        cancel()
+    }
+}
+
+type redis struct {
+    client      radix.Client
+    replica     *replica  // Serves the reads while fresh, nil to read from the primary
+    scanCount   int       // Number of keys to scan in each iteration
+    legacyUntil time.Time // Keys of the previous schema version are read until then
+    keys        keyspace  // Names the keys under the key prefix, the legacy keys predate it
+    closing     closing   // Cancels the scans in flight on Close
+    owned       bool      // The client was created by the store and is closed with it
+
+    closeOnce sync.Once
+    closeErr  error
+}
+
+// NewRedisStore creates a Store on a new client connected to host, see NewRedisClient and NewRedisStoreWithClient.
+// The client is closed with the store.
+func NewRedisStore(ctx context.Context, host string, scanCount int, opts ...RedisOption) (Store, error) {
+    c, err := NewRedisClient(ctx, host, opts...)
+    if err != nil {
+        return nil, err
+    }
+    store, err := newRedisStore(ctx, c, scanCount, true, opts...)
+    if err != nil {
+        _ = c.Close()
+        return nil, err
+    }
+    return store, nil
+}
+
+// NewRedisStoreWithClient creates a Store on an existing Redis client, so the connection pool can be shared.
+//
+// The key schema version is checked on startup, and a transition reading both the previous and the current key
+// formats is started if the keyspace was written in an older format.
+//
+// The connection options are ignored, the client is already connected. The schema version is kept per key prefix, see
+// WithKeyPrefix. The client is left open on Close.
+func NewRedisStoreWithClient(ctx context.Context, client radix.Client, scanCount int, opts ...RedisOption) (Store, error) {
+    return newRedisStore(ctx, client, scanCount, false, opts...)
+}
+
+func newRedisStore(ctx context.Context, client radix.Client, scanCount int, owned bool, opts ...RedisOption) (*redis, error) {
+    var o redisOptions
+    for _, opt := range opts {
+        opt(&o)
+    }
+    legacyUntil, err := migrateSchema(ctx, client, o.keyPrefix)
+    if err != nil {
+        return nil, err
+    }
+    if _, ok := cluster(client); ok && !legacyUntil.IsZero() {
+        // The keys of the first schema have no hash tag, a script or MGET can't read them with the current ones
+        storeLogger(o.logger).Warn("Key schema transition is not supported on Redis Cluster, ignoring the keys of the previous schema")
+        legacyUntil = time.Time{}
+    }
     return &redis{
-        client:    c,
-        scanCount: scanCount,
+        client:      client,
+        replica:     o.replica,
+        scanCount:   scanCount,
+        legacyUntil: legacyUntil,
+        keys:        keyspace(o.keyPrefix),
+        closing:     newClosing(),
+        owned:       owned,
     }, nil
 }
 
-func generateKeyMatcher(key RateLimiterKey) string {
-    return fmt.Sprintf("%s#%s#*", key.UserId, key.Endpoint)
+// Close cancels the scans in flight, and closes the client if the store created it, see NewRedisStore. The replica
+// client is left open.
+func (r *redis) Close() error {
+    r.closeOnce.Do(func() {
+        r.closing.cancel()
+        if r.owned {
+            r.closeErr = r.client.Close()
+        }
+    })
+    return r.closeErr
 }
 
-func generateKey(key RateLimiterKey, timestampWindow time.Time) string {
-    return fmt.Sprintf("%s#%s#%d", key.UserId, key.Endpoint, timestampWindow.Unix())
+func (r *redis) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    if r.replica != nil && r.replica.usable(ctx) {
+        if count, err := r.count(ctx, r.replica.client, key); err == nil {
+            return count, nil
+        }
+        // Fall back to the primary, the replica is checked again on the next interval
+    }
+    return r.count(ctx, r.client, key)
 }
 
-func (r *redis) Get(ctx context.Context, key RateLimiterKey) (int32, error) {
+// count sums the counters of the user at the endpoint, reading from the client.
+func (r *redis) count(ctx context.Context, client radix.Client, key RateLimiterKey) (int64, error) {
+    count, err := r.sumMatching(ctx, client, r.keys.generateKeyMatcher(key))
+    if err != nil {
+        return 0, err
+    }
+    if time.Now().Before(r.legacyUntil) {
+        // Counters written before the schema migration are still inside their time window
+        legacy, err := r.sumMatching(ctx, client, generateLegacyKeyMatcher(key))
+        if err != nil {
+            return 0, err
+        }
+        if count, err = AddCount(count, legacy); err != nil {
+            return 0, err
+        }
+    }
+    return count, nil
+}
+
+// sumMatching sums the counters of all keys matching the pattern, reading from the client.
+func (r *redis) sumMatching(ctx context.Context, client radix.Client, pattern string) (int64, error) {
+    ctx, stop := r.closing.scope(ctx)
+    defer stop()
     var (
         k     string
-        count int32
+        count int64
+        err   error
     )
     found := make(map[string]struct{})
     // Use a scanner to get all fields and values for the user at the given endpoint
-    s := (radix.ScannerConfig{
-        Pattern: generateKeyMatcher(key),
+    sc := radix.ScannerConfig{
+        Pattern: pattern,
         Count:   r.scanCount,
         Type:    "string",
-    }).New(r.client)
+    }
+    var s radix.Scanner
+    if c, ok := cluster(client); ok {
+        // Every primary holds a part of the keyspace
+        s = sc.NewMulti(c)
+    } else {
+        s = sc.New(client)
+    }
     for s.Next(ctx, &k) {
         if _, exists := found[k]; exists {
             // If the key has already been processed, skip it
             continue
         }
-        var c int32
-        if err := r.client.Do(ctx, radix.FlatCmd(&c, "GET", k)); err != nil {
+        var c int64
+        if err := client.Do(ctx, radix.FlatCmd(&c, "GET", k)); err != nil {
             return 0, fmt.Errorf("failed to fetch rate limiter %s: %w", k, err)
         }
-        count += c
+        if count, err = AddCount(count, c); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", k, c, err)
+        }
         found[k] = struct{}{} // Mark this key as processed
     }
+    // The scan stops early when ctx is done, the count would be short
+    if err := s.Close(); err != nil {
+        return 0, fmt.Errorf("failed to scan rate limiters %s: %w", pattern, err)
+    }
     return count, nil
 }
 
+// Reset deletes the keys of the user at the endpoint on the primary, and the counters of the previous schema during the
+// transition.
+func (r *redis) Reset(ctx context.Context, key RateLimiterKey) error {
+    patterns := []string{r.keys.generateResetMatcher(key)}
+    if time.Now().Before(r.legacyUntil) {
+        patterns = append(patterns, generateLegacyKeyMatcher(key))
+    }
+    for _, pattern := range patterns {
+        if err := r.deleteMatching(ctx, pattern); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// deleteMatching deletes all keys matching the pattern.
+func (r *redis) deleteMatching(ctx context.Context, pattern string) error {
+    ctx, stop := r.closing.scope(ctx)
+    defer stop()
+    var k string
+    sc := radix.ScannerConfig{
+        Pattern: pattern,
+        Count:   r.scanCount,
+    }
+    var s radix.Scanner
+    if c, ok := cluster(r.client); ok {
+        s = sc.NewMulti(c)
+    } else {
+        s = sc.New(r.client)
+    }
+    for s.Next(ctx, &k) {
+        // Deleting a key returned twice by the scan is a no-op
+        if err := r.client.Do(ctx, radix.Cmd(nil, "DEL", k)); err != nil {
+            return fmt.Errorf("failed to delete rate limiter %s: %w", k, err)
+        }
+    }
+    if err := s.Close(); err != nil {
+        return fmt.Errorf("failed to scan rate limiters %s: %w", pattern, err)
+    }
+    return nil
+}
+
 // Set increments the request count for the user at the given timestamp by approximating the timestamp to the nearest
 // redis.SlidingWindowInterval interval and sets the TTL for the key if it's a new time window.
 func (r *redis) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    return r.incrBy(ctx, key, 1, timestamp, windowInterval, ttl)
+}
+
+// incrBy counts a request for cost, see Set.
+func (r *redis) incrBy(ctx context.Context, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
     // Calculate the boundary timestamp
-    timestampWindow := timestamp.Truncate(windowInterval)
+    timestampWindow := WindowStart(timestamp, windowInterval)
 
-    // Use INCR to increment the count for the user at the boundary timestamp
-    var count int32
-    k := generateKey(key, timestampWindow)
-    if err := r.client.Do(ctx, radix.FlatCmd(&count, "INCR", k)); err != nil {
+    // Use INCRBY to increment the count for the user at the boundary timestamp, Redis refuses to increment past
+    // math.MaxInt64 so a saturated bucket stays saturated until it expires
+    var count int64
+    k := r.keys.generateKey(key, timestampWindow)
+    if err := r.client.Do(ctx, radix.FlatCmd(&count, "INCRBY", k, cost)); err != nil {
         return fmt.Errorf("failed to set user %s for endpoint %s at %s: %w", key.UserId, key.Endpoint, timestampWindow, err)
     }
 
-    if count == 1 {
+    if count == cost {
         // Set the TTL for the key if this is a new timeWindow
         if err := r.client.Do(ctx, radix.FlatCmd(nil, "EXPIRE", k, int(ttl.Seconds()))); err != nil {
             return fmt.Errorf("failed to set TTL user %s for endpoint %s at  %s: %w", key.UserId, key.Endpoint, timestamp, err)
@@ -81,3 +551,58 @@ func (r *redis) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time
 
     return nil
 }
+
+// ServerTime returns the time of the primary, the replica may be another host with its own clock.
+func (r *redis) ServerTime(ctx context.Context) (time.Time, error) {
+    var reply []string
+    if err := r.client.Do(ctx, radix.Cmd(&reply, "TIME")); err != nil {
+        return time.Time{}, fmt.Errorf("failed to fetch server time: %w", err)
+    }
+    return parseRedisTime(reply)
+}
+
+// parseRedisTime parses the reply to TIME, the seconds and the microseconds since the epoch.
+func parseRedisTime(reply []string) (time.Time, error) {
+    if len(reply) != 2 {
+        return time.Time{}, fmt.Errorf("unexpected reply to server time %q", reply)
+    }
+    seconds, err := strconv.ParseInt(reply[0], 10, 64)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("failed to parse server time %q: %w", reply, err)
+    }
+    micros, err := strconv.ParseInt(reply[1], 10, 64)
+    if err != nil {
+        return time.Time{}, fmt.Errorf("failed to parse server time %q: %w", reply, err)
+    }
+    return time.Unix(seconds, micros*int64(time.Microsecond)).UTC(), nil
+}
+
+func (r *redis) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    var exists int
+    if err := r.client.Do(ctx, radix.Cmd(&exists, "EXISTS", r.keys.generateSeenKey(key, requestId))); err != nil {
+        return false, fmt.Errorf("failed to check request %s of user %s for endpoint %s: %w", requestId, key.UserId, key.Endpoint, err)
+    }
+    return exists == 1, nil
+}
+
+func (r *redis) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    if err := r.client.Do(ctx, radix.FlatCmd(nil, "SET", r.keys.generateSeenKey(key, requestId), 1, "PX", ttl.Milliseconds())); err != nil {
+        return fmt.Errorf("failed to record request %s of user %s for endpoint %s: %w", requestId, key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+func (r *redis) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    if err := r.client.Do(ctx, radix.FlatCmd(nil, "SET", r.keys.generateFlagKey(userId, flag), 1, "PX", ttl.Milliseconds())); err != nil {
+        return fmt.Errorf("failed to flag user %s as %s: %w", userId, flag, err)
+    }
+    return nil
+}
+
+func (r *redis) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    var exists int
+    if err := r.client.Do(ctx, radix.Cmd(&exists, "EXISTS", r.keys.generateFlagKey(userId, flag))); err != nil {
+        return false, fmt.Errorf("failed to check flag %s of user %s: %w", flag, userId, err)
+    }
+    return exists == 1, nil
+}
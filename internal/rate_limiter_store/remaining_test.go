@@ -0,0 +1,50 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    "testing"
+    "time"
+)
+
+// The scripts of the Redis store tell the same budget as the memory store, request after request.
+func TestRedisRemainingMatchesMemory(t *testing.T) {
+    ctx := context.Background()
+    mr := miniredis.RunT(t)
+    store, err := NewRedisStore(ctx, mr.Addr(), 100)
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    defer store.Close()
+    memory := NewMemoryStore()
+    key := RateLimiterKey{Endpoint: "/ping", UserId: "user"}
+    // Whole milliseconds, the scripts count in milliseconds
+    now := time.UnixMilli(time.Now().UnixMilli())
+    for i, at := range []time.Duration{0, 0, 0, 0, 0, 0, 250 * time.Millisecond, 300 * time.Millisecond, 2 * time.Second} {
+        at := now.Add(at)
+        rTaken, rTokens, err := store.(TokenBucketStore).TakeToken(ctx, key, at, 4, 500*time.Millisecond)
+        if err != nil {
+            t.Fatalf("TakeToken: %v", err)
+        }
+        mTaken, mTokens, _ := memory.(TokenBucketStore).TakeToken(ctx, key, at, 4, 500*time.Millisecond)
+        if rTaken != mTaken || rTokens != mTokens {
+            t.Fatalf("request %d: redis took %t with %d tokens left, memory %t with %d", i, rTaken, rTokens, mTaken, mTokens)
+        }
+        _, rQueued, rPlaces, err := store.(LeakyBucketStore).Enqueue(ctx, key, at, 4, 500*time.Millisecond)
+        if err != nil {
+            t.Fatalf("Enqueue: %v", err)
+        }
+        _, mQueued, mPlaces, _ := memory.(LeakyBucketStore).Enqueue(ctx, key, at, 4, 500*time.Millisecond)
+        if rQueued != mQueued || rPlaces != mPlaces {
+            t.Fatalf("request %d: redis queued %t with %d places left, memory %t with %d", i, rQueued, rPlaces, mQueued, mPlaces)
+        }
+        rConforms, rLeft, err := store.(GCRAStore).Conform(ctx, key, at, 500*time.Millisecond, 1500*time.Millisecond)
+        if err != nil {
+            t.Fatalf("Conform: %v", err)
+        }
+        mConforms, mLeft, _ := memory.(GCRAStore).Conform(ctx, key, at, 500*time.Millisecond, 1500*time.Millisecond)
+        if rConforms != mConforms || rLeft != mLeft {
+            t.Fatalf("request %d: redis conformed %t with %d left, memory %t with %d", i, rConforms, rLeft, mConforms, mLeft)
+        }
+    }
+}
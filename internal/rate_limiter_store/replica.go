@@ -0,0 +1,69 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// replicaCheckInterval is how often the replication lag of the replica is checked.
+const replicaCheckInterval = time.Second
+
+// replica routes the reads to a Redis replica while it is in sync with the primary.
+type replica struct {
+    client       radix.Client
+    maxStaleness time.Duration
+
+    mu        sync.Mutex
+    checkedAt time.Time
+    fresh     bool
+}
+
+// WithReplicaReads routes Get to the replica while increments stay on the primary, reducing the load of the primary.
+//
+// A replica lags behind its primary, so counts read from it can miss the latest increments and allow a few requests
+// over the limit. The replica is only used while its link to the primary is up and it heard from the primary less than
+// maxStaleness ago, Redis reports this with a precision of a second. Reads fall back to the primary otherwise.
+//
+// It only applies to NewRedisStore and NewRedisStoreWithClient.
+func WithReplicaReads(client radix.Client, maxStaleness time.Duration) RedisOption {
+    return func(o *redisOptions) {
+        o.replica = &replica{
+            client:       client,
+            maxStaleness: maxStaleness,
+        }
+    }
+}
+
+// usable reports whether the replica is fresh enough to read from, checking it at most once per replicaCheckInterval.
+func (r *replica) usable(ctx context.Context) bool {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if time.Since(r.checkedAt) < replicaCheckInterval {
+        return r.fresh
+    }
+    r.checkedAt = time.Now()
+    r.fresh = false
+    var info string
+    if err := r.client.Do(ctx, radix.Cmd(&info, "INFO", "replication")); err != nil {
+        return false
+    }
+    fields := make(map[string]string)
+    for _, line := range strings.Split(info, "\r\n") {
+        if k, v, ok := strings.Cut(line, ":"); ok {
+            fields[k] = v
+        }
+    }
+    if fields["role"] != "slave" || fields["master_link_status"] != "up" {
+        return false
+    }
+    lastIO, err := strconv.Atoi(fields["master_last_io_seconds_ago"])
+    if err != nil || lastIO < 0 {
+        return false
+    }
+    r.fresh = time.Duration(lastIO)*time.Second <= r.maxStaleness
+    return r.fresh
+}
@@ -0,0 +1,106 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/alicebob/miniredis/v2/server"
+    "github.com/mediocregopher/radix/v4"
+    "sync"
+    "testing"
+    "time"
+)
+
+// fakeReplica is a miniredis answering INFO replication like a replica, with its own data.
+type fakeReplica struct {
+    *miniredis.Miniredis
+    mu   sync.Mutex
+    info string // Answered to INFO, an error if empty
+    down bool   // Fails the other commands
+}
+
+func newFakeReplica(t *testing.T) *fakeReplica {
+    t.Helper()
+    r := &fakeReplica{Miniredis: miniredis.RunT(t)}
+    r.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        switch {
+        case cmd == "INFO" && r.info == "":
+            c.WriteError("ERR unavailable")
+        case cmd == "INFO":
+            c.WriteBulk(r.info)
+        case r.down:
+            c.WriteError("LOADING Redis is loading the dataset in memory")
+        default:
+            return false
+        }
+        return true
+    })
+    return r
+}
+
+func (r *fakeReplica) set(info string, down bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.info = info
+    r.down = down
+}
+
+func replication(role, link, lastIO string) string {
+    return "# Replication\r\nrole:" + role + "\r\nmaster_link_status:" + link + "\r\nmaster_last_io_seconds_ago:" + lastIO + "\r\n"
+}
+
+func TestReplicaReads(t *testing.T) {
+    ctx := context.Background()
+    primary, fake := miniredis.RunT(t), newFakeReplica(t)
+    client, err := (radix.PoolConfig{}).New(ctx, "tcp", fake.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    defer client.Close()
+    store, err := NewRedisStore(ctx, primary.Addr(), 100, WithReplicaReads(client, 2*time.Second))
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    defer store.Close()
+    // The increments go to the primary only, the replica has not caught up with them
+    key := RateLimiterKey{UserId: "ada", Endpoint: "/ping"}
+    for range 3 {
+        if err := store.Set(ctx, key, time.Now(), time.Second, time.Minute); err != nil {
+            t.Fatalf("Set: %v", err)
+        }
+    }
+
+    for _, test := range []struct {
+        name  string
+        info  string
+        down  bool
+        count int64
+    }{
+        {"fresh replica", replication("slave", "up", "1"), false, 0},
+        {"stale replica", replication("slave", "up", "5"), false, 3},
+        {"link down", replication("slave", "down", "0"), false, 3},
+        {"no master yet", replication("slave", "up", "-1"), false, 3},
+        {"promoted replica", "# Replication\r\nrole:master\r\n", false, 3},
+        {"INFO fails", "", false, 3},
+        // Fresh, but the read fails
+        {"failing replica", replication("slave", "up", "0"), true, 3},
+    } {
+        fake.set(test.info, test.down)
+        store.(*redis).replica.checkedAt = time.Time{}
+        if count, err := store.Get(ctx, key); err != nil || count != test.count {
+            t.Fatalf("%s: %d, %v, %d expected", test.name, count, err, test.count)
+        }
+    }
+
+    // The lag is checked at most once per interval
+    fake.set(replication("slave", "up", "0"), false)
+    store.(*redis).replica.checkedAt = time.Time{}
+    if count, _ := store.Get(ctx, key); count != 0 {
+        t.Fatalf("Get from the fresh replica: %d, 0 expected", count)
+    }
+    fake.set(replication("slave", "down", "0"), false)
+    if count, _ := store.Get(ctx, key); count != 0 {
+        t.Fatalf("Get within the check interval: %d, still read from the replica expected", count)
+    }
+}
@@ -0,0 +1,336 @@
+package rate_limiter_store
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type RedisRESTConfig struct {
+    // URL of the REST API, e.g. https://eu1-example-12345.upstash.io
+    URL string `json:"url"`
+    // Token sent as the bearer token of every request
+    Token string `json:"token"`
+    // Timeout of every request
+    //
+    // Defaults to 5 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+    // ScanCount is the number of keys to scan in each iteration of Get
+    //
+    // Defaults to 100 if not specified
+    ScanCount int `json:"scan_count,omitempty"`
+    // KeyPrefix is prepended to every key, it must match the prefix of the Redis stores sharing the database, see
+    // WithKeyPrefix
+    KeyPrefix string `json:"key_prefix,omitempty"`
+}
+
+type restRedis struct {
+    client    *http.Client
+    url       string
+    token     string
+    scanCount int
+    keys      keyspace
+    closing   closing // Cancels the requests in flight on Close
+    owned     bool    // The client was created by the store, its idle connections are closed with it
+}
+
+// restReply is the reply to a command, either its result or an error.
+type restReply struct {
+    Result json.RawMessage `json:"result"`
+    Error  string          `json:"error"`
+}
+
+// NewRedisRESTStore creates a Store on a Redis REST API in the style of Upstash, for edge runtimes which can't open
+// TCP connections to Redis.
+func NewRedisRESTStore(config RedisRESTConfig) Store {
+    if config.Timeout == 0 {
+        config.Timeout = 5 * time.Second
+    }
+    r := NewRedisRESTStoreWithClient(&http.Client{Timeout: config.Timeout}, config).(*restRedis)
+    r.owned = true
+    return r
+}
+
+// NewRedisRESTStoreWithClient creates a Store on a Redis REST API with an existing HTTP client, e.g. the fetch based
+// client of an edge runtime.
+//
+// Every command is a JSON array posted to the URL, the commands counting a request are pipelined or sent as the same
+// Lua scripts as the Redis store so they are a single request. The keys are those of the Redis store, so a REST and a
+// TCP instance can share a database. The client is left open on Close.
+func NewRedisRESTStoreWithClient(client *http.Client, config RedisRESTConfig) Store {
+    if config.ScanCount == 0 {
+        config.ScanCount = 100
+    }
+    return &restRedis{
+        client:    client,
+        url:       strings.TrimSuffix(config.URL, "/"),
+        token:     config.Token,
+        scanCount: config.ScanCount,
+        keys:      keyspace(config.KeyPrefix),
+        closing:   newClosing(),
+    }
+}
+
+// Close cancels the requests in flight, e.g. the scans of Get and Reset, and closes the idle connections if the store
+// created the client, see NewRedisRESTStore.
+func (r *restRedis) Close() error {
+    r.closing.cancel()
+    if r.owned {
+        r.client.CloseIdleConnections()
+    }
+    return nil
+}
+
+// post sends the body to the path and decodes the reply into v.
+func (r *restRedis) post(ctx context.Context, path string, body, v any) error {
+    data, err := json.Marshal(body)
+    if err != nil {
+        return err
+    }
+    ctx, stop := r.closing.scope(ctx)
+    defer stop()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+path, bytes.NewReader(data))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Authorization", "Bearer "+r.token)
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := r.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    data, err = io.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+    if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusUnauthorized {
+        return fmt.Errorf("unexpected status %s: %s", resp.Status, data)
+    }
+    return json.Unmarshal(data, v)
+}
+
+// do sends a single command and decodes its result into v, nil to ignore it.
+func (r *restRedis) do(ctx context.Context, v any, args ...any) error {
+    var reply restReply
+    if err := r.post(ctx, "", args, &reply); err != nil {
+        return err
+    }
+    if reply.Error != "" {
+        return errors.New(reply.Error)
+    }
+    if v == nil {
+        return nil
+    }
+    return json.Unmarshal(reply.Result, v)
+}
+
+// pipeline sends the commands in a single request, the results are not returned.
+func (r *restRedis) pipeline(ctx context.Context, cmds ...[]any) error {
+    var replies []restReply
+    if err := r.post(ctx, "/pipeline", cmds, &replies); err != nil {
+        return err
+    }
+    for _, reply := range replies {
+        if reply.Error != "" {
+            return errors.New(reply.Error)
+        }
+    }
+    return nil
+}
+
+func (r *restRedis) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    var count int64
+    found := make(map[string]struct{})
+    pattern := r.keys.generateKeyMatcher(key)
+    cursor := "0"
+    for {
+        var page []json.RawMessage
+        if err := r.do(ctx, &page, "SCAN", cursor, "MATCH", pattern, "COUNT", r.scanCount, "TYPE", "string"); err != nil {
+            return 0, fmt.Errorf("failed to scan rate limiters %s: %w", pattern, err)
+        }
+        var keys []string
+        if len(page) != 2 || json.Unmarshal(page[0], &cursor) != nil || json.Unmarshal(page[1], &keys) != nil {
+            return 0, fmt.Errorf("unexpected reply to scan rate limiters %s", pattern)
+        }
+        // A key can be returned by several iterations of the scan
+        keys = slices.DeleteFunc(keys, func(k string) bool {
+            _, exists := found[k]
+            found[k] = struct{}{}
+            return exists
+        })
+        if len(keys) > 0 {
+            c, err := r.sumKeys(ctx, keys)
+            if err != nil {
+                return 0, err
+            }
+            if count, err = AddCount(count, c); err != nil {
+                return 0, err
+            }
+        }
+        if cursor == "0" {
+            return count, nil
+        }
+    }
+}
+
+// Reset deletes the keys of the user at the endpoint.
+func (r *restRedis) Reset(ctx context.Context, key RateLimiterKey) error {
+    pattern := r.keys.generateResetMatcher(key)
+    cursor := "0"
+    for {
+        var page []json.RawMessage
+        if err := r.do(ctx, &page, "SCAN", cursor, "MATCH", pattern, "COUNT", r.scanCount); err != nil {
+            return fmt.Errorf("failed to scan rate limiters %s: %w", pattern, err)
+        }
+        var keys []string
+        if len(page) != 2 || json.Unmarshal(page[0], &cursor) != nil || json.Unmarshal(page[1], &keys) != nil {
+            return fmt.Errorf("unexpected reply to scan rate limiters %s", pattern)
+        }
+        // Deleting a key returned by several iterations of the scan is a no-op
+        if len(keys) > 0 {
+            if err := r.do(ctx, nil, append([]any{"DEL"}, stringsToAny(keys)...)...); err != nil {
+                return fmt.Errorf("failed to delete rate limiters %s: %w", keys[0], err)
+            }
+        }
+        if cursor == "0" {
+            return nil
+        }
+    }
+}
+
+// sumKeys sums the counters of the keys, missing keys count for 0.
+func (r *restRedis) sumKeys(ctx context.Context, keys []string) (int64, error) {
+    var values []*string
+    if err := r.do(ctx, &values, append([]any{"MGET"}, stringsToAny(keys)...)...); err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s: %w", keys[0], err)
+    }
+    var count int64
+    for i, v := range values {
+        if v == nil {
+            continue
+        }
+        c, err := strconv.ParseInt(*v, 10, 64)
+        if err != nil {
+            return 0, fmt.Errorf("failed to parse rate limiter %s: %w", keys[i], err)
+        }
+        if count, err = AddCount(count, c); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", keys[i], c, err)
+        }
+    }
+    return count, nil
+}
+
+func stringsToAny(values []string) []any {
+    args := make([]any, len(values))
+    for i, v := range values {
+        args[i] = v
+    }
+    return args
+}
+
+func (r *restRedis) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    return r.incrBy(ctx, key, 1, timestamp, windowInterval, ttl)
+}
+
+// incrBy counts a request for cost in one request, the TTL is only set on a new bucket.
+func (r *restRedis) incrBy(ctx context.Context, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    k := r.keys.generateKey(key, WindowStart(timestamp, windowInterval))
+    if err := r.pipeline(ctx, []any{"INCRBY", k, cost}, []any{"EXPIRE", k, max(int64(ttl.Seconds()), 1), "NX"}); err != nil {
+        return fmt.Errorf("failed to set user %s for endpoint %s at %s: %w", key.UserId, key.Endpoint, timestamp, err)
+    }
+    return nil
+}
+
+func (r *restRedis) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if windowInterval <= 0 {
+        // No window to derive the names from
+        return r.Get(ctx, key)
+    }
+    return r.sumKeys(ctx, windowKeys(r.keys.generateKey, key, now, windowInterval, ttl))
+}
+
+func (r *restRedis) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    if windowInterval <= 0 {
+        return 0, nil
+    }
+    keys := windowKeys(r.keys.generateKey, key, now, windowInterval, ttl)
+    slices.Reverse(keys)
+    var ms int64
+    if err := r.do(ctx, &ms, append([]any{"EVAL", oldestExpiryLua, len(keys)}, stringsToAny(keys)...)...); err != nil {
+        return 0, fmt.Errorf("failed to fetch expiry of rate limiter %s: %w", keys[0], err)
+    }
+    return time.Duration(ms) * time.Millisecond, nil
+}
+
+func (r *restRedis) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := r.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (r *restRedis) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    if windowInterval < time.Millisecond {
+        // No window the script can name, check and count in two steps
+        count, err := r.CountWindows(ctx, key, timestamp, windowInterval, ttl)
+        if err != nil || count > limit-cost {
+            return count, false, err
+        }
+        return count, true, r.incrBy(ctx, key, cost, timestamp, windowInterval, ttl)
+    }
+    var result []int64
+    err := r.do(ctx, &result, "EVAL", addIfBelowLua, 1, r.keys.generateKeyPrefix(key),
+        WindowStart(timestamp, windowInterval).UnixMilli(), windowInterval.Milliseconds(), windowCount(windowInterval, ttl), limit, int(ttl.Seconds()), cost)
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to set user %s for endpoint %s at %s: %w", key.UserId, key.Endpoint, timestamp, err)
+    }
+    if len(result) != 2 {
+        return 0, false, fmt.Errorf("unexpected reply %v to set user %s for endpoint %s", result, key.UserId, key.Endpoint)
+    }
+    return result[1], result[0] == 1, nil
+}
+
+func (r *restRedis) ServerTime(ctx context.Context) (time.Time, error) {
+    var reply []string
+    if err := r.do(ctx, &reply, "TIME"); err != nil {
+        return time.Time{}, fmt.Errorf("failed to fetch server time: %w", err)
+    }
+    return parseRedisTime(reply)
+}
+
+func (r *restRedis) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    var exists int
+    if err := r.do(ctx, &exists, "EXISTS", r.keys.generateSeenKey(key, requestId)); err != nil {
+        return false, fmt.Errorf("failed to check request %s of user %s for endpoint %s: %w", requestId, key.UserId, key.Endpoint, err)
+    }
+    return exists == 1, nil
+}
+
+func (r *restRedis) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    if err := r.do(ctx, nil, "SET", r.keys.generateSeenKey(key, requestId), 1, "PX", ttl.Milliseconds()); err != nil {
+        return fmt.Errorf("failed to record request %s of user %s for endpoint %s: %w", requestId, key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+func (r *restRedis) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    if err := r.do(ctx, nil, "SET", r.keys.generateFlagKey(userId, flag), 1, "PX", ttl.Milliseconds()); err != nil {
+        return fmt.Errorf("failed to flag user %s as %s: %w", userId, flag, err)
+    }
+    return nil
+}
+
+func (r *restRedis) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    var exists int
+    if err := r.do(ctx, &exists, "EXISTS", r.keys.generateFlagKey(userId, flag)); err != nil {
+        return false, fmt.Errorf("failed to check flag %s of user %s: %w", flag, userId, err)
+    }
+    return exists == 1, nil
+}
@@ -0,0 +1,168 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/alicebob/miniredis/v2"
+    "github.com/mediocregopher/radix/v4"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// upstash serves the REST API of Upstash on a miniredis, and counts the requests.
+type upstash struct {
+    *httptest.Server
+    requests atomic.Int64
+}
+
+func newUpstash(t *testing.T, mr *miniredis.Miniredis) *upstash {
+    t.Helper()
+    client, err := (radix.PoolConfig{}).New(context.Background(), "tcp", mr.Addr())
+    if err != nil {
+        t.Fatalf("radix: %v", err)
+    }
+    t.Cleanup(func() {
+        _ = client.Close()
+    })
+    run := func(ctx context.Context, cmd []any) restReply {
+        args := make([]string, len(cmd))
+        for i, arg := range cmd {
+            args[i] = fmt.Sprint(arg)
+        }
+        var result any
+        if err := client.Do(ctx, radix.Cmd(&result, args[0], args[1:]...)); err != nil {
+            return restReply{Error: err.Error()}
+        }
+        data, _ := json.Marshal(restResult(result))
+        return restReply{Result: data}
+    }
+    u := &upstash{}
+    u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        u.requests.Add(1)
+        if r.Header.Get("Authorization") != "Bearer s3cret" {
+            http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+            return
+        }
+        decoder := json.NewDecoder(r.Body)
+        decoder.UseNumber()
+        var reply any
+        if r.URL.Path == "/pipeline" {
+            var cmds [][]any
+            if err := decoder.Decode(&cmds); err != nil {
+                http.Error(w, err.Error(), http.StatusBadRequest)
+                return
+            }
+            replies := make([]restReply, len(cmds))
+            for i, cmd := range cmds {
+                replies[i] = run(r.Context(), cmd)
+            }
+            reply = replies
+        } else {
+            var cmd []any
+            if err := decoder.Decode(&cmd); err != nil || len(cmd) == 0 {
+                http.Error(w, fmt.Sprintf("invalid command: %v", err), http.StatusBadRequest)
+                return
+            }
+            reply = run(r.Context(), cmd)
+        }
+        _ = json.NewEncoder(w).Encode(reply)
+    }))
+    t.Cleanup(u.Close)
+    return u
+}
+
+// restResult converts a reply of radix to the JSON of Upstash, the bulk strings being strings and the nil ones null.
+func restResult(v any) any {
+    switch v := v.(type) {
+    case []byte:
+        if v == nil {
+            return nil
+        }
+        return string(v)
+    case []any:
+        for i := range v {
+            v[i] = restResult(v[i])
+        }
+    }
+    return v
+}
+
+func TestRedisRESTStore(t *testing.T) {
+    mr := miniredis.RunT(t)
+    u := newUpstash(t, mr)
+    ctx := context.Background()
+    store := NewRedisRESTStore(RedisRESTConfig{URL: u.URL + "/", Token: "s3cret", KeyPrefix: "edge:"})
+    defer store.Close()
+
+    key := RateLimiterKey{UserId: "ada", Endpoint: "/ping"}
+    if err := store.Set(ctx, key, time.Now(), time.Second, time.Minute); err != nil {
+        t.Fatalf("Set: %v", err)
+    }
+    // The keys are those of the Redis store with the same prefix, so both share the database
+    redisStore, err := NewRedisStore(ctx, mr.Addr(), 100, WithKeyPrefix("edge:"))
+    if err != nil {
+        t.Fatalf("NewRedisStore: %v", err)
+    }
+    defer redisStore.Close()
+    if count, err := redisStore.Get(ctx, key); err != nil || count != 1 {
+        t.Fatalf("Get of the Redis store: %d, %v, 1 expected", count, err)
+    }
+    for _, k := range mr.Keys() {
+        if !strings.HasPrefix(k, "edge:") {
+            t.Fatalf("key %s without the prefix", k)
+        }
+    }
+
+    // Checking and counting a request is a single request
+    requests := u.requests.Load()
+    if allowed, err := store.(AtomicStore).SetIfBelow(ctx, key, 2, time.Now(), time.Second, time.Minute); err != nil || !allowed {
+        t.Fatalf("SetIfBelow: %t, %v", allowed, err)
+    }
+    if n := u.requests.Load() - requests; n != 1 {
+        t.Fatalf("SetIfBelow sent %d requests, 1 expected", n)
+    }
+    if allowed, err := store.(AtomicStore).SetIfBelow(ctx, key, 2, time.Now(), time.Second, time.Minute); err != nil || allowed {
+        t.Fatalf("SetIfBelow over the limit: %t, %v", allowed, err)
+    }
+}
+
+func TestRedisRESTStoreErrors(t *testing.T) {
+    u := newUpstash(t, miniredis.RunT(t))
+    ctx := context.Background()
+    store := NewRedisRESTStore(RedisRESTConfig{URL: u.URL, Token: "wrong"})
+    defer store.Close()
+    if _, err := store.Get(ctx, RateLimiterKey{UserId: "ada", Endpoint: "/ping"}); err == nil || !strings.Contains(err.Error(), "401") {
+        t.Fatalf("Get with a wrong token: %v, the 401 expected", err)
+    }
+
+    // Close cancels the requests in flight
+    release := make(chan struct{})
+    slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        select {
+        case <-r.Context().Done():
+        case <-release:
+        }
+    }))
+    defer slow.Close()
+    defer close(release)
+    store = NewRedisRESTStore(RedisRESTConfig{URL: slow.URL, Token: "s3cret"})
+    done := make(chan error, 1)
+    go func() {
+        done <- store.Set(ctx, RateLimiterKey{UserId: "ada", Endpoint: "/ping"}, time.Now(), time.Second, time.Minute)
+    }()
+    time.Sleep(50 * time.Millisecond)
+    _ = store.Close()
+    select {
+    case err := <-done:
+        if err == nil {
+            t.Fatalf("Set cancelled by Close: no error")
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("Set not cancelled by Close")
+    }
+}
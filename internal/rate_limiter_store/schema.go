@@ -0,0 +1,98 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+const (
+    // CurrentSchemaVersion is the version of the key format written by the Redis store
+    //
+    // Versions:
+    // - 1: <userId>#<endpoint>#<timestamp>
+    // - 2: {<userId>#<endpoint>}#<timestamp>, the hash tag keeps the window keys of a user and endpoint on one cluster slot
+    CurrentSchemaVersion = 2
+    // SchemaTransitionWindow is how long the keys of the previous format are still read after a migration started,
+    // it must be at least the longest TimeWindow so the old counters expire before they stop being read
+    SchemaTransitionWindow = 24 * time.Hour
+
+    schemaVersionKey   = "ratelimiter:schema_version"
+    schemaMigrationKey = "ratelimiter:schema_migration" // Exists, holding the previous version, during a transition
+)
+
+var ErrSchemaTooNew = errors.New("key schema is newer than supported")
+
+// migrateSchema records the current schema version in Redis and starts a transition when the keyspace was written in
+// an older format. It returns the time until which the keys of the previous format must still be read.
+//
+// Migrating is safe with several instances starting concurrently, the transition is only started once. The version is
+// kept under the key prefix, the prefixed keyspaces never used the first format.
+func migrateSchema(ctx context.Context, client radix.Client, prefix string) (time.Time, error) {
+    versionKey, migrationKey := prefix+schemaVersionKey, prefix+schemaMigrationKey
+    var stored string
+    maybe := radix.Maybe{Rcv: &stored}
+    if err := client.Do(ctx, radix.Cmd(&maybe, "GET", versionKey)); err != nil {
+        return time.Time{}, fmt.Errorf("failed to get key schema version: %w", err)
+    }
+    version := 1 // Keyspaces written before the schema was versioned use the first format
+    if prefix != "" {
+        version = CurrentSchemaVersion
+    }
+    if !maybe.Null {
+        v, err := strconv.Atoi(stored)
+        if err != nil {
+            return time.Time{}, fmt.Errorf("invalid key schema version %q: %w", stored, err)
+        }
+        version = v
+    }
+
+    switch {
+    case version > CurrentSchemaVersion:
+        return time.Time{}, fmt.Errorf("%w: found version %d, supported version %d", ErrSchemaTooNew, version, CurrentSchemaVersion)
+    case version < CurrentSchemaVersion:
+        // Two commands rather than a pipeline, the keys are on different cluster slots
+        if err := client.Do(ctx, radix.FlatCmd(nil, "SET", migrationKey, version, "EX", int(SchemaTransitionWindow.Seconds()), "NX")); err != nil {
+            return time.Time{}, fmt.Errorf("failed to start key schema migration: %w", err)
+        }
+        if err := client.Do(ctx, radix.FlatCmd(nil, "SET", versionKey, CurrentSchemaVersion)); err != nil {
+            return time.Time{}, fmt.Errorf("failed to start key schema migration: %w", err)
+        }
+    case maybe.Null:
+        // A new prefixed keyspace, recorded so a later format can tell it apart
+        if err := client.Do(ctx, radix.FlatCmd(nil, "SET", versionKey, CurrentSchemaVersion, "NX")); err != nil {
+            return time.Time{}, fmt.Errorf("failed to set key schema version: %w", err)
+        }
+    }
+
+    var ttl int64
+    if err := client.Do(ctx, radix.Cmd(&ttl, "PTTL", migrationKey)); err != nil {
+        return time.Time{}, fmt.Errorf("failed to get key schema migration: %w", err)
+    }
+    if ttl <= 0 {
+        // No transition in progress
+        return time.Time{}, nil
+    }
+    return time.Now().Add(time.Duration(ttl) * time.Millisecond), nil
+}
+
+// generateLegacyKeyMatcher matches the keys written with schema version 1.
+func generateLegacyKeyMatcher(key RateLimiterKey) string {
+    b := appendEscaped(make([]byte, 0, keyBufferSize), key.UserId)
+    b = append(b, '#')
+    b = appendEscaped(b, key.Endpoint)
+    return string(append(b, '#', '*'))
+}
+
+// generateLegacyKeyPrefix is the key of schema version 1 without the window.
+func generateLegacyKeyPrefix(key RateLimiterKey) string {
+    return fmt.Sprintf("%s#%s#", key.UserId, key.Endpoint)
+}
+
+// generateLegacyKey is the key of schema version 1.
+func generateLegacyKey(key RateLimiterKey, timestampWindow time.Time) string {
+    return fmt.Sprintf("%s#%s#%d", key.UserId, key.Endpoint, timestampWindow.Unix())
+}
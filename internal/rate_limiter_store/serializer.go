@@ -0,0 +1,123 @@
+package rate_limiter_store
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "github.com/vmihailenco/msgpack/v5"
+)
+
+var ErrUnknownEncoding = errors.New("unknown encoding")
+
+// Serializer encodes the structured values of the stores, e.g. their snapshots, the state of a token bucket or a
+// lease, where a counter isn't enough.
+type Serializer interface {
+    // Name of the encoding in the configurations, e.g. json
+    Name() string
+    // ID identifies the encoding in the header of the payloads, 'j' and 'm' are taken by JSON and Msgpack
+    ID() byte
+    Marshal(v any) ([]byte, error)
+    Unmarshal(data []byte, v any) error
+}
+
+// JSON encodes the values as JSON, readable with the usual tools.
+var JSON Serializer = jsonSerializer{}
+
+// Msgpack encodes the values as MessagePack, smaller and faster to decode than JSON. The json tags of the structs
+// name their fields, so a type is encoded alike by both.
+var Msgpack Serializer = msgpackSerializer{}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Name() string {
+    return "json"
+}
+
+func (jsonSerializer) ID() byte {
+    return 'j'
+}
+
+func (jsonSerializer) Marshal(v any) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v any) error {
+    return json.Unmarshal(data, v)
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Name() string {
+    return "msgpack"
+}
+
+func (msgpackSerializer) ID() byte {
+    return 'm'
+}
+
+func (msgpackSerializer) Marshal(v any) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := msgpack.NewEncoder(&buf)
+    enc.SetCustomStructTag("json")
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, v any) error {
+    dec := msgpack.NewDecoder(bytes.NewReader(data))
+    dec.SetCustomStructTag("json")
+    return dec.Decode(v)
+}
+
+// SerializerByName returns the serializer of the encoding, JSON if name is empty.
+func SerializerByName(name string) (Serializer, error) {
+    switch name {
+    case "", JSON.Name():
+        return JSON, nil
+    case Msgpack.Name():
+        return Msgpack, nil
+    }
+    return nil, fmt.Errorf("%w %q", ErrUnknownEncoding, name)
+}
+
+// payloadMagic starts the header of the encoded payloads, a byte neither JSON nor MessagePack starts with, so the
+// payloads written before the header was introduced are still recognized.
+const payloadMagic = 0xc1
+
+// EncodeValue encodes the value with the serializer behind a header naming the encoding and the version of the value,
+// so a store can change its encoding or the shape of its values and still read what it wrote before.
+func EncodeValue(s Serializer, version uint8, v any) ([]byte, error) {
+    data, err := s.Marshal(v)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode value as %s: %w", s.Name(), err)
+    }
+    return append([]byte{payloadMagic, s.ID(), version}, data...), nil
+}
+
+// DecodeValue decodes a payload of EncodeValue into v with the serializer named by its header, among JSON, Msgpack
+// and the serializers given, and returns the version of the value. A payload without header is decoded as JSON of
+// version 0.
+func DecodeValue(data []byte, v any, serializers ...Serializer) (uint8, error) {
+    if len(data) == 0 || data[0] != payloadMagic {
+        if err := json.Unmarshal(data, v); err != nil {
+            return 0, fmt.Errorf("failed to decode value as json: %w", err)
+        }
+        return 0, nil
+    }
+    if len(data) < 3 {
+        return 0, fmt.Errorf("failed to decode value: truncated header")
+    }
+    for _, s := range append([]Serializer{JSON, Msgpack}, serializers...) {
+        if s.ID() != data[1] {
+            continue
+        }
+        if err := s.Unmarshal(data[3:], v); err != nil {
+            return 0, fmt.Errorf("failed to decode value as %s: %w", s.Name(), err)
+        }
+        return data[2], nil
+    }
+    return 0, fmt.Errorf("failed to decode value: %w %q", ErrUnknownEncoding, data[1])
+}
@@ -0,0 +1,289 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// ObjectStore holds the snapshots of the memory store, e.g. an S3 or GCS bucket behind a few lines of adapter.
+type ObjectStore interface {
+    // Get returns the content of the object, or an error wrapping os.ErrNotExist if there is none
+    Get(ctx context.Context, name string) ([]byte, error)
+    // Put replaces the content of the object
+    Put(ctx context.Context, name string, data []byte) error
+}
+
+type SnapshotConfig struct {
+    // Object is the name of the snapshot in the object store
+    //
+    // Defaults to ratelimiter/snapshot.json if not specified
+    Object string `json:"object,omitempty"`
+    // Interval is the interval between two snapshots, the requests counted since the last snapshot are lost on a crash
+    //
+    // Defaults to 1 minute if not specified
+    Interval time.Duration `json:"interval,omitempty"`
+    // Timeout of the final snapshot taken when the context is done or the store is closed
+    //
+    // Defaults to 10 seconds if not specified
+    Timeout time.Duration `json:"timeout,omitempty"`
+    // Encoding of the snapshots, json or msgpack, see SerializerByName. The snapshots of either encoding are restored
+    //
+    // Defaults to json if not specified
+    Encoding string `json:"encoding,omitempty"`
+    // Logger logs the errors of the store in the background
+    //
+    // Defaults to slog.Default() if not specified
+    Logger *slog.Logger `json:"-"`
+}
+
+// snapshotVersion is bumped when the format of snapshot changes, older snapshots are then ignored.
+const snapshotVersion = 1
+
+type snapshot struct {
+    // Version of the snapshots written before the header of EncodeValue held it
+    Version      int                   `json:"version,omitempty"`
+    TakenAt      time.Time             `json:"taken_at"`
+    Buckets      []snapshotBucket      `json:"buckets,omitempty"`
+    Seen         []snapshotSeen        `json:"seen,omitempty"`
+    Flags        map[string]time.Time  `json:"flags,omitempty"`
+    TokenBuckets []snapshotTokenBucket `json:"token_buckets,omitempty"`
+    LeakyBuckets []snapshotTokenBucket `json:"leaky_buckets,omitempty"`
+    Tats         []snapshotTat         `json:"tats,omitempty"`
+}
+
+// snapshotKey is a RateLimiterKey with the names of the snapshot.
+type snapshotKey struct {
+    UserId   string `json:"user_id"`
+    Endpoint string `json:"endpoint"`
+}
+
+type snapshotBucket struct {
+    snapshotKey
+    Window    int64     `json:"window"`
+    Count     int64     `json:"count"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+type snapshotSeen struct {
+    snapshotKey
+    RequestId string    `json:"request_id"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// snapshotTokenBucket is a token bucket with its tokens or a leaky bucket with its level.
+type snapshotTokenBucket struct {
+    snapshotKey
+    Value     float64   `json:"value"`
+    Last      time.Time `json:"last"`
+    ExpiresAt time.Time `json:"expires_at,omitempty"` // Zero in the snapshots of older versions, kept until written
+}
+
+type snapshotTat struct {
+    snapshotKey
+    Tat time.Time `json:"tat"`
+}
+
+// snapshotMemory is a memory store written to an object store.
+type snapshotMemory struct {
+    *memory
+    logger *slog.Logger
+    cancel context.CancelFunc
+    // done is closed once the final snapshot is saved, with the error of saving it in saveErr
+    done    chan struct{}
+    saveErr error
+}
+
+// NewSnapshotMemoryStore creates a memory store restored from the last snapshot in objects, for single instance
+// deployments without Redis that shouldn't reset every count on a deploy.
+//
+// The store is written to objects every Interval and once more when ctx is done or the store is closed. Entries which expired in between are
+// dropped on restore, a missing or older format snapshot starts an empty store.
+func NewSnapshotMemoryStore(ctx context.Context, objects ObjectStore, config SnapshotConfig) (Store, error) {
+    if config.Object == "" {
+        config.Object = "ratelimiter/snapshot.json"
+    }
+    if config.Interval == 0 {
+        config.Interval = time.Minute
+    }
+    if config.Timeout == 0 {
+        config.Timeout = 10 * time.Second
+    }
+    serializer, err := SerializerByName(config.Encoding)
+    if err != nil {
+        return nil, err
+    }
+    logger := storeLogger(config.Logger)
+    m := NewMemoryStore().(*memory)
+    data, err := objects.Get(ctx, config.Object)
+    switch {
+    case errors.Is(err, os.ErrNotExist):
+    case err != nil:
+        return nil, fmt.Errorf("failed to fetch snapshot %s: %w", config.Object, err)
+    default:
+        var s snapshot
+        version, err := DecodeValue(data, &s)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse snapshot %s: %w", config.Object, err)
+        }
+        if version == 0 {
+            version = uint8(s.Version)
+        }
+        if version != snapshotVersion {
+            logger.Warn("Ignoring snapshot of another version", "object", config.Object, "version", version)
+        } else {
+            m.restore(s)
+            logger.Info("Restored rate limiter snapshot", "object", config.Object, "taken_at", s.TakenAt)
+        }
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    s := &snapshotMemory{memory: m, logger: logger, cancel: cancel, done: make(chan struct{})}
+    go s.snapshots(ctx, objects, config, serializer)
+    return s, nil
+}
+
+func (s *snapshotMemory) snapshots(ctx context.Context, objects ObjectStore, config SnapshotConfig, serializer Serializer) {
+    defer close(s.done)
+    ticker := time.NewTicker(config.Interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            // The context of the final snapshot outlives ctx
+            ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.Timeout)
+            defer cancel()
+            if s.saveErr = s.save(ctx, objects, config.Object, serializer); s.saveErr != nil {
+                s.logger.Error("Error saving final rate limiter snapshot", "object", config.Object, "error", s.saveErr)
+            }
+            return
+        case <-ticker.C:
+        }
+        if err := s.save(ctx, objects, config.Object, serializer); err != nil {
+            s.logger.Error("Error saving rate limiter snapshot", "object", config.Object, "error", err)
+        }
+    }
+}
+
+// Close takes the final snapshot and waits for it to be saved. The counts are still served from memory afterwards
+// but are no longer saved.
+func (s *snapshotMemory) Close() error {
+    s.cancel()
+    <-s.done
+    return s.saveErr
+}
+
+func (m *memory) save(ctx context.Context, objects ObjectStore, object string, serializer Serializer) error {
+    data, err := EncodeValue(serializer, snapshotVersion, m.snapshot())
+    if err != nil {
+        return err
+    }
+    return objects.Put(ctx, object, data)
+}
+
+// snapshot copies the entries which have not expired.
+func (m *memory) snapshot() snapshot {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    now := m.now()
+    s := snapshot{TakenAt: now, Flags: make(map[string]time.Time)}
+    for key, windows := range m.buckets {
+        for window, b := range windows {
+            if now.Before(b.expiresAt) {
+                s.Buckets = append(s.Buckets, snapshotBucket{snapshotKey: snapshotKey(key), Window: window, Count: b.count, ExpiresAt: b.expiresAt})
+            }
+        }
+    }
+    for r, expiresAt := range m.seen {
+        if now.Before(expiresAt) {
+            s.Seen = append(s.Seen, snapshotSeen{snapshotKey: snapshotKey(r.key), RequestId: r.requestId, ExpiresAt: expiresAt})
+        }
+    }
+    for k, expiresAt := range m.flags {
+        if now.Before(expiresAt) {
+            s.Flags[k] = expiresAt
+        }
+    }
+    for key, b := range m.tokenBuckets {
+        s.TokenBuckets = append(s.TokenBuckets, snapshotTokenBucket{snapshotKey: snapshotKey(key), Value: b.tokens, Last: b.last, ExpiresAt: b.expiresAt})
+    }
+    for key, b := range m.leakyBuckets {
+        s.LeakyBuckets = append(s.LeakyBuckets, snapshotTokenBucket{snapshotKey: snapshotKey(key), Value: b.level, Last: b.last, ExpiresAt: b.expiresAt})
+    }
+    for key, tat := range m.tats {
+        s.Tats = append(s.Tats, snapshotTat{snapshotKey: snapshotKey(key), Tat: tat})
+    }
+    return s
+}
+
+// restore loads the entries of the snapshot which have not expired since it was taken.
+func (m *memory) restore(s snapshot) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    now := m.now()
+    for _, b := range s.Buckets {
+        if !now.Before(b.ExpiresAt) {
+            continue
+        }
+        key := RateLimiterKey(b.snapshotKey)
+        if m.buckets[key] == nil {
+            m.buckets[key] = make(map[int64]*memoryBucket)
+        }
+        m.buckets[key][b.Window] = &memoryBucket{count: b.Count, expiresAt: b.ExpiresAt}
+    }
+    for _, r := range s.Seen {
+        if now.Before(r.ExpiresAt) {
+            m.seen[seenRequest{key: RateLimiterKey(r.snapshotKey), requestId: r.RequestId}] = r.ExpiresAt
+        }
+    }
+    for k, expiresAt := range s.Flags {
+        if now.Before(expiresAt) {
+            m.flags[k] = expiresAt
+        }
+    }
+    for _, b := range s.TokenBuckets {
+        if !b.ExpiresAt.IsZero() && !now.Before(b.ExpiresAt) {
+            continue
+        }
+        m.tokenBuckets[RateLimiterKey(b.snapshotKey)] = &memoryTokenBucket{tokens: b.Value, last: b.Last, expiresAt: b.ExpiresAt}
+    }
+    for _, b := range s.LeakyBuckets {
+        if !b.ExpiresAt.IsZero() && !now.Before(b.ExpiresAt) {
+            continue
+        }
+        m.leakyBuckets[RateLimiterKey(b.snapshotKey)] = &memoryLeakyBucket{level: b.Value, last: b.Last, expiresAt: b.ExpiresAt}
+    }
+    for _, t := range s.Tats {
+        m.tats[RateLimiterKey(t.snapshotKey)] = t.Tat
+    }
+}
+
+type dirObjectStore struct {
+    dir string
+}
+
+// NewDirObjectStore creates an ObjectStore keeping the objects as files in dir, e.g. a persistent volume or a bucket
+// mounted with a FUSE driver.
+func NewDirObjectStore(dir string) ObjectStore {
+    return dirObjectStore{dir: dir}
+}
+
+func (d dirObjectStore) Get(_ context.Context, name string) ([]byte, error) {
+    return os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
+func (d dirObjectStore) Put(_ context.Context, name string, data []byte) error {
+    path := filepath.Join(d.dir, filepath.FromSlash(name))
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return err
+    }
+    // Write to a temporary file first so a crash never leaves a truncated snapshot behind
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, path)
+}
@@ -0,0 +1,286 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "database/sql"
+    "errors"
+    "fmt"
+    "log/slog"
+    _ "modernc.org/sqlite" // Pure Go driver, registered as "sqlite"
+    "net/url"
+    "time"
+)
+
+type SQLiteConfig struct {
+    // Path of the database file, created if it doesn't exist
+    Path string `json:"path"`
+    // PruneInterval is the interval between two deletions of the expired buckets, request ids and flags
+    //
+    // Defaults to 1 minute if not specified
+    PruneInterval time.Duration `json:"prune_interval,omitempty"`
+    // Logger logs the errors of the store in the background
+    //
+    // Defaults to slog.Default() if not specified
+    Logger *slog.Logger `json:"-"`
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS buckets (
+    user_id    TEXT    NOT NULL,
+    endpoint   TEXT    NOT NULL,
+    window     INTEGER NOT NULL,
+    count      INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, endpoint, window)
+);
+CREATE INDEX IF NOT EXISTS buckets_expires_at ON buckets (expires_at);
+CREATE TABLE IF NOT EXISTS seen (
+    user_id    TEXT    NOT NULL,
+    endpoint   TEXT    NOT NULL,
+    request_id TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, endpoint, request_id)
+);
+CREATE TABLE IF NOT EXISTS flags (
+    user_id    TEXT    NOT NULL,
+    flag       TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, flag)
+);
+`
+
+// Times are stored as unix milliseconds, so the counts survive a restart and sub-second windows have buckets of their
+// own.
+type sqliteStore struct {
+    db     *sql.DB
+    logger *slog.Logger
+    cancel context.CancelFunc
+    // done is closed once the pruning stopped and the database is closed, with the error of closing it in closeErr
+    done     chan struct{}
+    closeErr error
+}
+
+// NewSQLiteStore creates a Store persisting the counts in a SQLite database, for single binary deployments, e.g. edge
+// gateways, that need the counts to survive a restart but can't run Redis.
+//
+// The database is in WAL mode so the reads don't block behind the writes, and every check-and-count is a transaction,
+// see AtomicStore. The expired rows are pruned every PruneInterval until ctx is done or the store is closed, the database is then closed.
+func NewSQLiteStore(ctx context.Context, config SQLiteConfig) (Store, error) {
+    if config.PruneInterval == 0 {
+        config.PruneInterval = time.Minute
+    }
+    // Transactions take the write lock when they start, so two processes checking the same count can't both pass
+    dsn := "file:" + config.Path + "?" + url.Values{
+        "_pragma": {"journal_mode(WAL)", "busy_timeout(5000)", "synchronous(NORMAL)"},
+        "_txlock": {"immediate"},
+    }.Encode()
+    db, err := sql.Open("sqlite", dsn)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+    }
+    // SQLite has a single writer, more connections would only wait for each other
+    db.SetMaxOpenConns(1)
+    if _, err = db.ExecContext(ctx, sqliteSchema); err != nil {
+        _ = db.Close()
+        return nil, fmt.Errorf("failed to create the tables of %s: %w", config.Path, err)
+    }
+    ctx, cancel := context.WithCancel(ctx)
+    s := &sqliteStore{db: db, logger: storeLogger(config.Logger), cancel: cancel, done: make(chan struct{})}
+    go s.prune(ctx, config.PruneInterval)
+    return s, nil
+}
+
+func (s *sqliteStore) prune(ctx context.Context, interval time.Duration) {
+    defer func() {
+        s.closeErr = s.db.Close()
+        close(s.done)
+    }()
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        now := time.Now().UnixMilli()
+        for _, table := range []string{"buckets", "seen", "flags"} {
+            if _, err := s.db.ExecContext(ctx, "DELETE FROM "+table+" WHERE expires_at <= ?", now); err != nil && ctx.Err() == nil {
+                s.logger.Error("Error pruning expired rows", "table", table, "error", err)
+            }
+        }
+    }
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+    QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+    ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func (s *sqliteStore) Get(ctx context.Context, key RateLimiterKey) (int64, error) {
+    return s.count(ctx, s.db, key, 0)
+}
+
+// count sums the buckets of the key that have not expired, from the window starting at since.
+func (s *sqliteStore) count(ctx context.Context, q querier, key RateLimiterKey, since int64) (int64, error) {
+    rows, err := q.QueryContext(ctx, "SELECT count FROM buckets WHERE user_id = ? AND endpoint = ? AND window >= ? AND expires_at > ?",
+        key.UserId, key.Endpoint, since, time.Now().UnixMilli())
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    defer rows.Close()
+    var count int64
+    for rows.Next() {
+        var c int64
+        if err = rows.Scan(&c); err != nil {
+            return 0, fmt.Errorf("failed to read rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+        }
+        if count, err = AddCount(count, c); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s#%s with value %d: %w", key.UserId, key.Endpoint, c, err)
+        }
+    }
+    if err = rows.Err(); err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return count, nil
+}
+
+func (s *sqliteStore) Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    return s.increment(ctx, s.db, key, 1, timestamp, windowInterval, ttl)
+}
+
+// increment counts a request for cost in the bucket of the timestamp, starting the bucket over if it expired.
+func (s *sqliteStore) increment(ctx context.Context, q querier, key RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    now := time.Now()
+    _, err := q.ExecContext(ctx, `
+INSERT INTO buckets (user_id, endpoint, window, count, expires_at) VALUES (?1, ?2, ?3, ?4, ?5)
+ON CONFLICT (user_id, endpoint, window) DO UPDATE SET
+    count = CASE WHEN expires_at <= ?6 THEN ?4 ELSE count + ?4 END,
+    expires_at = CASE WHEN expires_at <= ?6 THEN ?5 ELSE expires_at END`,
+        key.UserId, key.Endpoint, WindowStart(timestamp, windowInterval).UnixMilli(), cost, now.Add(ttl).UnixMilli(), now.UnixMilli())
+    if err != nil {
+        return fmt.Errorf("failed to increment rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+func (s *sqliteStore) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    return s.count(ctx, s.db, key, sqliteSince(now, windowInterval, ttl))
+}
+
+func (s *sqliteStore) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    var oldest sql.NullInt64
+    current := time.Now()
+    err := s.db.QueryRowContext(ctx, "SELECT MIN(expires_at) FROM buckets WHERE user_id = ? AND endpoint = ? AND window >= ? AND expires_at > ?",
+        key.UserId, key.Endpoint, sqliteSince(now, windowInterval, ttl), current.UnixMilli()).Scan(&oldest)
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch expiry of rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    if !oldest.Valid {
+        return 0, nil
+    }
+    return time.UnixMilli(oldest.Int64).Sub(current), nil
+}
+
+// sqliteSince returns the start of the oldest window whose bucket can still exist at now, see windowCount.
+func sqliteSince(now time.Time, windowInterval, ttl time.Duration) int64 {
+    if windowInterval <= 0 {
+        return 0
+    }
+    return WindowStart(now, windowInterval).Add(-time.Duration(windowCount(windowInterval, ttl)-1) * windowInterval).UnixMilli()
+}
+
+func (s *sqliteStore) SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    _, added, err := s.AddIfBelow(ctx, key, 1, limit, timestamp, windowInterval, ttl)
+    return added, err
+}
+
+func (s *sqliteStore) AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (count int64, added bool, err error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer func() {
+        if err != nil || !added {
+            _ = tx.Rollback()
+        }
+    }()
+    if count, err = s.count(ctx, tx, key, sqliteSince(timestamp, windowInterval, ttl)); err != nil || count > limit-cost {
+        return count, false, err
+    }
+    if err = s.increment(ctx, tx, key, cost, timestamp, windowInterval, ttl); err != nil {
+        return 0, false, err
+    }
+    if err = tx.Commit(); err != nil {
+        return 0, false, fmt.Errorf("failed to commit rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return count, true, nil
+}
+
+func (s *sqliteStore) Reset(ctx context.Context, key RateLimiterKey) (err error) {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer func() {
+        if err != nil {
+            _ = tx.Rollback()
+        }
+    }()
+    for _, table := range []string{"buckets", "seen"} {
+        if _, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ? AND endpoint = ?", key.UserId, key.Endpoint); err != nil {
+            return fmt.Errorf("failed to reset rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+        }
+    }
+    if err = tx.Commit(); err != nil {
+        return fmt.Errorf("failed to commit reset of rate limiter %s#%s: %w", key.UserId, key.Endpoint, err)
+    }
+    return nil
+}
+
+// Close stops the pruning and waits for the database to be closed.
+func (s *sqliteStore) Close() error {
+    s.cancel()
+    <-s.done
+    return s.closeErr
+}
+
+func (s *sqliteStore) Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error) {
+    return s.exists(ctx, "SELECT 1 FROM seen WHERE user_id = ? AND endpoint = ? AND request_id = ? AND expires_at > ?",
+        key.UserId, key.Endpoint, requestId, time.Now().UnixMilli())
+}
+
+func (s *sqliteStore) MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error {
+    _, err := s.db.ExecContext(ctx, "INSERT OR REPLACE INTO seen (user_id, endpoint, request_id, expires_at) VALUES (?, ?, ?, ?)",
+        key.UserId, key.Endpoint, requestId, time.Now().Add(ttl).UnixMilli())
+    if err != nil {
+        return fmt.Errorf("failed to mark request %s as seen: %w", requestId, err)
+    }
+    return nil
+}
+
+func (s *sqliteStore) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    _, err := s.db.ExecContext(ctx, "INSERT OR REPLACE INTO flags (user_id, flag, expires_at) VALUES (?, ?, ?)",
+        userId, flag, time.Now().Add(ttl).UnixMilli())
+    if err != nil {
+        return fmt.Errorf("failed to flag user %s as %s: %w", userId, flag, err)
+    }
+    return nil
+}
+
+func (s *sqliteStore) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    return s.exists(ctx, "SELECT 1 FROM flags WHERE user_id = ? AND flag = ? AND expires_at > ?", userId, flag, time.Now().UnixMilli())
+}
+
+func (s *sqliteStore) exists(ctx context.Context, query string, args ...any) (bool, error) {
+    var one int
+    err := s.db.QueryRowContext(ctx, query, args...).Scan(&one)
+    if errors.Is(err, sql.ErrNoRows) {
+        return false, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to query: %w", err)
+    }
+    return true, nil
+}
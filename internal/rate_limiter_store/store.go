@@ -3,10 +3,16 @@ package rate_limiter_store
 import (
     "context"
     "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/logging"
+    "log/slog"
+    "math"
     "time"
 )
 
-var ErrKeyNotFound = errors.New("key not found")
+var (
+    ErrKeyNotFound  = errors.New("key not found")
+    ErrInvalidCount = errors.New("invalid count")
+)
 
 type RateLimiterKey struct {
     UserId   string
@@ -15,7 +21,178 @@ type RateLimiterKey struct {
 
 type Store interface {
     // Get retrieves the value associated with the given key
-    Get(ctx context.Context, key RateLimiterKey) (int32, error)
+    //
+    // The count saturates at math.MaxInt64 instead of wrapping, and a negative bucket fails with ErrInvalidCount
+    Get(ctx context.Context, key RateLimiterKey) (int64, error)
     // Set sets the value for the given key
     Set(ctx context.Context, key RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error
+    // Reset deletes every bucket of the key along with the rest of the state of the user at the endpoint, the buckets
+    // of the other algorithms and the recorded request ids, e.g. to lift a limit at once or to erase the data of a
+    // user. The flags of the user apply to every endpoint and are kept.
+    Reset(ctx context.Context, key RateLimiterKey) error
+    // Close stops the background work of the store, e.g. the pruning or the snapshots, cancels the scans in flight and
+    // releases the connections the store opened. The clients passed to the store are left open for their owner to
+    // close. Close can be called more than once.
+    Close() error
+}
+
+// AtomicStore is implemented by the stores able to check the count of a key and count a request in one atomic step, so
+// concurrent requests can't all read the last free slot.
+type AtomicStore interface {
+    // SetIfBelow counts the request like Set if the count of the key, as returned by Get, is below limit, and reports
+    // whether it did
+    SetIfBelow(ctx context.Context, key RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error)
+    // AddIfBelow counts the request for cost, e.g. the items of a batch, if the count of the key plus cost is at most
+    // limit. It returns the count before and whether it counted the request.
+    AddIfBelow(ctx context.Context, key RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error)
+}
+
+// WindowCounter is implemented by the stores able to find the buckets of a key by name, derived from the windows,
+// instead of looking them up.
+type WindowCounter interface {
+    // CountWindows returns the count of the key like Get, from the buckets of windowInterval started in the last ttl,
+    // the only ones Set can still hold at now
+    CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error)
+}
+
+// BatchKey is a key of a batch with the windows of its buckets, each key can have its own.
+type BatchKey struct {
+    Key            RateLimiterKey
+    WindowInterval time.Duration
+    TTL            time.Duration
+    // Limit of the key, only used by BatchSetIfBelow
+    Limit int64
+    // Cost the request is counted for on the key, only used by BatchSetIfBelow, e.g. the items of a batch
+    //
+    // Defaults to 1 if not specified
+    Cost int64
+}
+
+// BatchStore is implemented by the stores able to read or count several keys in one round trip, e.g. the per-IP,
+// per-user and global limits of a request. See BatchGet and BatchSet for the other stores.
+type BatchStore interface {
+    // BatchGet returns the counts of the keys like CountWindows, in their order
+    BatchGet(ctx context.Context, keys []BatchKey, now time.Time) ([]int64, error)
+    // BatchSet counts a request for every key like Set
+    BatchSet(ctx context.Context, keys []BatchKey, timestamp time.Time) error
+}
+
+// AtomicBatchStore is implemented by the stores able to check and count several keys in one atomic step, so a request
+// passing its per-user limit but failing the global one doesn't consume the per-user budget. See BatchSetIfBelow for
+// the other stores.
+type AtomicBatchStore interface {
+    // BatchSetIfBelow counts the request for its cost on every key like Set if the count of every key, as returned by
+    // BatchGet, stays within its limit, and on none otherwise. It returns the counts before, in the order of the keys,
+    // and whether it counted the request.
+    BatchSetIfBelow(ctx context.Context, keys []BatchKey, timestamp time.Time) ([]int64, bool, error)
+}
+
+// WindowExpirer is implemented by the stores able to tell when the buckets of a key expire.
+type WindowExpirer interface {
+    // OldestExpiry returns how long until the oldest bucket of the key, among the buckets of windowInterval started in
+    // the last ttl like CountWindows, expires and frees its requests. It returns 0 if the key has no bucket.
+    OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error)
+}
+
+// Deduplicator is implemented by the stores able to remember the ids of the requests already counted, so retries of a
+// request are not counted again.
+type Deduplicator interface {
+    // Seen reports whether the request id was recorded for the key less than its ttl ago
+    Seen(ctx context.Context, key RateLimiterKey, requestId string) (bool, error)
+    // MarkSeen records the request id for the key for ttl
+    MarkSeen(ctx context.Context, key RateLimiterKey, requestId string, ttl time.Duration) error
+}
+
+// Flagger is implemented by the stores able to flag users, e.g. as abusive, for a while.
+type Flagger interface {
+    // Flag flags the user for ttl
+    Flag(ctx context.Context, userId, flag string, ttl time.Duration) error
+    // Flagged reports whether the user was flagged less than the ttl of the flag ago
+    Flagged(ctx context.Context, userId, flag string) (bool, error)
+}
+
+// TokenBucketStore is implemented by the stores able to keep token buckets.
+type TokenBucketStore interface {
+    // TakeToken refills the bucket of the key with a token per refillInterval elapsed since its last refill, up to
+    // capacity, then takes a token. It reports false if the bucket was empty, and returns the whole tokens left. A new
+    // bucket starts full.
+    TakeToken(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, refillInterval time.Duration) (bool, int64, error)
+}
+
+// LeakyBucketStore is implemented by the stores able to keep leaky buckets.
+type LeakyBucketStore interface {
+    // Enqueue drains the bucket of the key by a request per leakInterval elapsed since its last drain, then adds the
+    // request if the bucket holds fewer than capacity. It returns how long until the request leaks out, after the ones
+    // ahead of it, and false if the bucket was full. It also returns the whole places left in the bucket.
+    Enqueue(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, leakInterval time.Duration) (time.Duration, bool, int64, error)
+}
+
+// GCRAStore is implemented by the stores able to keep the theoretical arrival time (TAT) of the generic cell rate
+// algorithm, a single value per key.
+type GCRAStore interface {
+    // Conform reports whether the request at now conforms, i.e. the TAT of the key is at most tolerance ahead of now,
+    // and pushes the TAT emissionInterval further if so. A missing TAT, or one in the past, is now. It also returns how
+    // many more requests would conform at now, see ConformingRequests.
+    Conform(ctx context.Context, key RateLimiterKey, now time.Time, emissionInterval, tolerance time.Duration) (bool, int64, error)
+}
+
+// ServerClock is implemented by the stores able to tell the time of their server, so the instances can timestamp the
+// requests on a shared clock rather than their own, which may drift.
+type ServerClock interface {
+    // ServerTime returns the current time of the server
+    ServerTime(ctx context.Context) (time.Time, error)
+}
+
+// DrainLevel returns the level of a bucket holding level requests at last, drained up to now.
+func DrainLevel(level float64, last, now time.Time, leakInterval time.Duration) float64 {
+    if elapsed := now.Sub(last); elapsed > 0 && leakInterval > 0 {
+        level -= float64(elapsed) / float64(leakInterval)
+    }
+    return max(level, 0)
+}
+
+// RefillTokens returns the tokens of a bucket holding tokens at last, refilled up to now.
+func RefillTokens(tokens float64, last, now time.Time, capacity int64, refillInterval time.Duration) float64 {
+    if elapsed := now.Sub(last); elapsed > 0 && refillInterval > 0 {
+        tokens += float64(elapsed) / float64(refillInterval)
+    }
+    return min(tokens, float64(capacity))
+}
+
+// ConformingRequests returns how many requests would conform at now with the theoretical arrival time tat, one per
+// emissionInterval until tat is over tolerance ahead of now.
+func ConformingRequests(tat, now time.Time, emissionInterval, tolerance time.Duration) int64 {
+    ahead := tat.Sub(now)
+    if emissionInterval <= 0 || ahead > tolerance {
+        return 0
+    }
+    return int64((tolerance-ahead)/emissionInterval) + 1
+}
+
+// WindowStart returns the start of the window of the given interval holding the timestamp.
+//
+// The timestamp is normalized to UTC without its monotonic reading, so the boundaries are the same whatever the time
+// zone of the caller and a window of a day starts at midnight UTC.
+func WindowStart(timestamp time.Time, windowInterval time.Duration) time.Time {
+    return timestamp.Round(0).UTC().Truncate(windowInterval)
+}
+
+// AddCount adds the count of a bucket to a total, saturating at math.MaxInt64 so long windows with a high volume of
+// requests can't wrap around to a count that would allow requests again.
+func AddCount(total, count int64) (int64, error) {
+    if count < 0 {
+        return 0, ErrInvalidCount
+    }
+    if total > math.MaxInt64-count {
+        return math.MaxInt64, nil
+    }
+    return total + count, nil
+}
+
+// storeLogger returns the logger of a store, slog.Default() if not specified, naming the component.
+func storeLogger(logger *slog.Logger) *slog.Logger {
+    if logger == nil {
+        logger = slog.Default()
+    }
+    return logger.With(logging.ComponentKey, "rate_limiter_store")
 }
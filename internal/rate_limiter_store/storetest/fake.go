@@ -0,0 +1,458 @@
+package storetest
+
+import (
+    "context"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "sync"
+    "time"
+)
+
+// Op identifies a Store method.
+type Op string
+
+const (
+    OpGet          Op = "Get"
+    OpSet          Op = "Set"
+    OpReset        Op = "Reset"
+    OpSeen         Op = "Seen"
+    OpMarkSeen     Op = "MarkSeen"
+    OpFlag         Op = "Flag"
+    OpFlagged      Op = "Flagged"
+    OpTakeToken    Op = "TakeToken"
+    OpEnqueue      Op = "Enqueue"
+    OpConform      Op = "Conform"
+    OpSetIfBelow   Op = "SetIfBelow"
+    OpAddIfBelow   Op = "AddIfBelow"
+    OpOldestExpiry Op = "OldestExpiry"
+    OpClose        Op = "Close"
+)
+
+// Call is a recorded call to the FakeStore.
+type Call struct {
+    Op  Op
+    Key ratelimiterstore.RateLimiterKey
+    // Limit is only set for OpSetIfBelow and OpAddIfBelow, Cost for OpAddIfBelow
+    Limit int64
+    Cost  int64
+    // Timestamp is only set for OpSet, OpSetIfBelow, OpAddIfBelow, OpOldestExpiry, OpTakeToken, OpEnqueue and
+    // OpConform, WindowInterval for OpSet, OpTakeToken where it is the refill interval, OpEnqueue where it is the leak
+    // interval and OpConform where it is the emission interval, WindowInterval and TTL for OpSetIfBelow, OpAddIfBelow
+    // and OpOldestExpiry, TTL for OpSet, OpMarkSeen, OpFlag and OpConform where it is the tolerance
+    Timestamp      time.Time
+    WindowInterval time.Duration
+    TTL            time.Duration
+    // RequestId is only set for OpSeen and OpMarkSeen
+    RequestId string
+    // Flag is only set for OpFlag and OpFlagged, the user is in Key
+    Flag string
+    // Err is the error returned to the caller
+    Err error
+}
+
+type fakeBucket struct {
+    count     int64
+    expiresAt time.Time
+}
+
+type seenRequest struct {
+    key       ratelimiterstore.RateLimiterKey
+    requestId string
+}
+
+type fakeTokenBucket struct {
+    tokens float64
+    last   time.Time
+}
+
+type fakeLeakyBucket struct {
+    level float64
+    last  time.Time
+}
+
+type scriptedError struct {
+    err   error
+    times int // Remaining failures, negative for every call
+}
+
+// FakeStore is an in-memory Store for unit tests with scriptable latencies, error injection and call recording.
+//
+// Counts follow the Redis store: Set increments the bucket of the timestamp truncated to the window interval, the
+// bucket expires ttl after its first increment, and Get sums the buckets that have not expired.
+type FakeStore struct {
+    // Now is the clock used to expire buckets
+    //
+    // Defaults to time.Now if not specified
+    Now func() time.Time
+
+    mu      sync.Mutex
+    buckets map[ratelimiterstore.RateLimiterKey]map[int64]*fakeBucket
+    counts  map[ratelimiterstore.RateLimiterKey]int64 // Counts forced with SetCount
+    seen    map[seenRequest]time.Time                 // Expiry of the request ids recorded with MarkSeen
+    flags   map[string]time.Time                      // Expiry of the flags, keyed by flag and user
+    tokens  map[ratelimiterstore.RateLimiterKey]*fakeTokenBucket
+    leaky   map[ratelimiterstore.RateLimiterKey]*fakeLeakyBucket
+    tats    map[ratelimiterstore.RateLimiterKey]time.Time
+    latency map[Op]time.Duration
+    errors  map[Op]*scriptedError
+    calls   []Call
+}
+
+// NewFakeStore creates an empty FakeStore.
+func NewFakeStore() *FakeStore {
+    return &FakeStore{
+        Now:     time.Now,
+        buckets: make(map[ratelimiterstore.RateLimiterKey]map[int64]*fakeBucket),
+        counts:  make(map[ratelimiterstore.RateLimiterKey]int64),
+        seen:    make(map[seenRequest]time.Time),
+        flags:   make(map[string]time.Time),
+        tokens:  make(map[ratelimiterstore.RateLimiterKey]*fakeTokenBucket),
+        leaky:   make(map[ratelimiterstore.RateLimiterKey]*fakeLeakyBucket),
+        tats:    make(map[ratelimiterstore.RateLimiterKey]time.Time),
+        latency: make(map[Op]time.Duration),
+        errors:  make(map[Op]*scriptedError),
+    }
+}
+
+// SetLatency delays every call to op, a cancelled context interrupts the delay and is returned as the error.
+func (f *FakeStore) SetLatency(op Op, latency time.Duration) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.latency[op] = latency
+}
+
+// FailNext makes the next n calls to op return err.
+func (f *FakeStore) FailNext(op Op, err error, n int) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.errors[op] = &scriptedError{err: err, times: n}
+}
+
+// FailAlways makes every call to op return err, until Recover is called.
+func (f *FakeStore) FailAlways(op Op, err error) {
+    f.FailNext(op, err, -1)
+}
+
+// Recover stops injecting errors for op.
+func (f *FakeStore) Recover(op Op) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    delete(f.errors, op)
+}
+
+// SetCount forces the count returned by Get for the key, ignoring the buckets.
+func (f *FakeStore) SetCount(key ratelimiterstore.RateLimiterKey, count int64) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.counts[key] = count
+}
+
+// Calls returns the calls recorded so far, in order.
+func (f *FakeStore) Calls() []Call {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the recorded calls to op.
+func (f *FakeStore) CallsTo(op Op) []Call {
+    var calls []Call
+    for _, c := range f.Calls() {
+        if c.Op == op {
+            calls = append(calls, c)
+        }
+    }
+    return calls
+}
+
+// Clear clears the counts, the scripted behaviours and the recorded calls.
+func (f *FakeStore) Clear() {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    clear(f.buckets)
+    clear(f.counts)
+    clear(f.seen)
+    clear(f.flags)
+    clear(f.tokens)
+    clear(f.leaky)
+    clear(f.tats)
+    clear(f.latency)
+    clear(f.errors)
+    f.calls = nil
+}
+
+func (f *FakeStore) Get(ctx context.Context, key ratelimiterstore.RateLimiterKey) (int64, error) {
+    call := Call{Op: OpGet, Key: key}
+    if err := f.before(ctx, &call); err != nil {
+        return 0, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.count(key)
+}
+
+// count returns the count of the key, f.mu must be held.
+func (f *FakeStore) count(key ratelimiterstore.RateLimiterKey) (int64, error) {
+    if count, ok := f.counts[key]; ok {
+        if count < 0 {
+            return 0, ratelimiterstore.ErrInvalidCount
+        }
+        return count, nil
+    }
+    var (
+        count int64
+        err   error
+    )
+    now := f.Now()
+    for window, b := range f.buckets[key] {
+        if !now.Before(b.expiresAt) {
+            delete(f.buckets[key], window)
+            continue
+        }
+        if count, err = ratelimiterstore.AddCount(count, b.count); err != nil {
+            return 0, err
+        }
+    }
+    return count, nil
+}
+
+func (f *FakeStore) Set(ctx context.Context, key ratelimiterstore.RateLimiterKey, timestamp time.Time, windowInterval, ttl time.Duration) error {
+    call := Call{Op: OpSet, Key: key, Timestamp: timestamp, WindowInterval: windowInterval, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.increment(key, 1, timestamp, windowInterval, ttl)
+    return nil
+}
+
+// Reset deletes the buckets, the request ids and the state of the other algorithms of the key, and the count forced
+// with SetCount.
+func (f *FakeStore) Reset(ctx context.Context, key ratelimiterstore.RateLimiterKey) error {
+    call := Call{Op: OpReset, Key: key}
+    if err := f.before(ctx, &call); err != nil {
+        return err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    delete(f.buckets, key)
+    delete(f.counts, key)
+    delete(f.tokens, key)
+    delete(f.leaky, key)
+    delete(f.tats, key)
+    for r := range f.seen {
+        if r.key == key {
+            delete(f.seen, r)
+        }
+    }
+    return nil
+}
+
+// Close only records the call, the counts are kept so a test can check them after closing the rate limiter.
+func (f *FakeStore) Close() error {
+    call := Call{Op: OpClose}
+    return f.before(context.Background(), &call)
+}
+
+// SetIfBelow checks the count like Get and increments it like Set, the call is recorded as a single OpSetIfBelow.
+func (f *FakeStore) SetIfBelow(ctx context.Context, key ratelimiterstore.RateLimiterKey, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (bool, error) {
+    call := Call{Op: OpSetIfBelow, Key: key, Limit: limit, Timestamp: timestamp, WindowInterval: windowInterval, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return false, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    count, err := f.count(key)
+    if err != nil || count >= limit {
+        return false, err
+    }
+    f.increment(key, 1, timestamp, windowInterval, ttl)
+    return true, nil
+}
+
+// AddIfBelow checks the count like Get and increments it by cost, the call is recorded as a single OpAddIfBelow.
+func (f *FakeStore) AddIfBelow(ctx context.Context, key ratelimiterstore.RateLimiterKey, cost, limit int64, timestamp time.Time, windowInterval, ttl time.Duration) (int64, bool, error) {
+    call := Call{Op: OpAddIfBelow, Key: key, Limit: limit, Cost: cost, Timestamp: timestamp, WindowInterval: windowInterval, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return 0, false, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    count, err := f.count(key)
+    if err != nil || count > limit-cost {
+        return count, false, err
+    }
+    f.increment(key, cost, timestamp, windowInterval, ttl)
+    return count, true, nil
+}
+
+// increment counts a request for cost in the bucket of the timestamp, f.mu must be held.
+func (f *FakeStore) increment(key ratelimiterstore.RateLimiterKey, cost int64, timestamp time.Time, windowInterval, ttl time.Duration) {
+    window := ratelimiterstore.WindowStart(timestamp, windowInterval).Unix()
+    if f.buckets[key] == nil {
+        f.buckets[key] = make(map[int64]*fakeBucket)
+    }
+    now := f.Now()
+    b, ok := f.buckets[key][window]
+    if !ok || !now.Before(b.expiresAt) {
+        b = &fakeBucket{expiresAt: now.Add(ttl)}
+        f.buckets[key][window] = b
+    }
+    b.count, _ = ratelimiterstore.AddCount(b.count, cost)
+}
+
+// OldestExpiry returns how long until the first bucket of the key expires, 0 for a count forced with SetCount.
+func (f *FakeStore) OldestExpiry(ctx context.Context, key ratelimiterstore.RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    call := Call{Op: OpOldestExpiry, Key: key, Timestamp: now, WindowInterval: windowInterval, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return 0, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    var oldest time.Duration
+    clock := f.Now()
+    for _, b := range f.buckets[key] {
+        if left := b.expiresAt.Sub(clock); left > 0 && (oldest == 0 || left < oldest) {
+            oldest = left
+        }
+    }
+    return oldest, nil
+}
+
+func (f *FakeStore) Seen(ctx context.Context, key ratelimiterstore.RateLimiterKey, requestId string) (bool, error) {
+    call := Call{Op: OpSeen, Key: key, RequestId: requestId}
+    if err := f.before(ctx, &call); err != nil {
+        return false, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    expiresAt, ok := f.seen[seenRequest{key: key, requestId: requestId}]
+    return ok && f.Now().Before(expiresAt), nil
+}
+
+func (f *FakeStore) MarkSeen(ctx context.Context, key ratelimiterstore.RateLimiterKey, requestId string, ttl time.Duration) error {
+    call := Call{Op: OpMarkSeen, Key: key, RequestId: requestId, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.seen[seenRequest{key: key, requestId: requestId}] = f.Now().Add(ttl)
+    return nil
+}
+
+func (f *FakeStore) Flag(ctx context.Context, userId, flag string, ttl time.Duration) error {
+    call := Call{Op: OpFlag, Key: ratelimiterstore.RateLimiterKey{UserId: userId}, Flag: flag, TTL: ttl}
+    if err := f.before(ctx, &call); err != nil {
+        return err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.flags[flag+"#"+userId] = f.Now().Add(ttl)
+    return nil
+}
+
+func (f *FakeStore) Flagged(ctx context.Context, userId, flag string) (bool, error) {
+    call := Call{Op: OpFlagged, Key: ratelimiterstore.RateLimiterKey{UserId: userId}, Flag: flag}
+    if err := f.before(ctx, &call); err != nil {
+        return false, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    expiresAt, ok := f.flags[flag+"#"+userId]
+    return ok && f.Now().Before(expiresAt), nil
+}
+
+func (f *FakeStore) TakeToken(ctx context.Context, key ratelimiterstore.RateLimiterKey, now time.Time, capacity int64, refillInterval time.Duration) (bool, int64, error) {
+    call := Call{Op: OpTakeToken, Key: key, Timestamp: now, WindowInterval: refillInterval}
+    if err := f.before(ctx, &call); err != nil {
+        return false, 0, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    b, ok := f.tokens[key]
+    if !ok {
+        b = &fakeTokenBucket{tokens: float64(capacity), last: now}
+        f.tokens[key] = b
+    }
+    b.tokens = ratelimiterstore.RefillTokens(b.tokens, b.last, now, capacity, refillInterval)
+    if now.After(b.last) {
+        b.last = now
+    }
+    if b.tokens < 1 {
+        return false, 0, nil
+    }
+    b.tokens--
+    return true, int64(b.tokens), nil
+}
+
+func (f *FakeStore) Enqueue(ctx context.Context, key ratelimiterstore.RateLimiterKey, now time.Time, capacity int64, leakInterval time.Duration) (time.Duration, bool, int64, error) {
+    call := Call{Op: OpEnqueue, Key: key, Timestamp: now, WindowInterval: leakInterval}
+    if err := f.before(ctx, &call); err != nil {
+        return 0, false, 0, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    b, ok := f.leaky[key]
+    if !ok {
+        b = &fakeLeakyBucket{last: now}
+        f.leaky[key] = b
+    }
+    b.level = ratelimiterstore.DrainLevel(b.level, b.last, now, leakInterval)
+    if now.After(b.last) {
+        b.last = now
+    }
+    if b.level+1 > float64(capacity) {
+        return 0, false, 0, nil
+    }
+    delay := time.Duration(b.level * float64(leakInterval))
+    b.level++
+    return delay, true, int64(float64(capacity) - b.level), nil
+}
+
+func (f *FakeStore) Conform(ctx context.Context, key ratelimiterstore.RateLimiterKey, now time.Time, emissionInterval, tolerance time.Duration) (bool, int64, error) {
+    call := Call{Op: OpConform, Key: key, Timestamp: now, WindowInterval: emissionInterval, TTL: tolerance}
+    if err := f.before(ctx, &call); err != nil {
+        return false, 0, err
+    }
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    tat := f.tats[key]
+    if tat.Before(now) {
+        tat = now
+    }
+    if tat.Sub(now) > tolerance {
+        return false, 0, nil
+    }
+    tat = tat.Add(emissionInterval)
+    f.tats[key] = tat
+    return true, ratelimiterstore.ConformingRequests(tat, now, emissionInterval, tolerance), nil
+}
+
+// before applies the scripted latency and error of the call and records it.
+func (f *FakeStore) before(ctx context.Context, call *Call) error {
+    f.mu.Lock()
+    latency := f.latency[call.Op]
+    if scripted, ok := f.errors[call.Op]; ok {
+        call.Err = scripted.err
+        if scripted.times > 0 {
+            scripted.times--
+            if scripted.times == 0 {
+                delete(f.errors, call.Op)
+            }
+        }
+    }
+    f.mu.Unlock()
+
+    if latency > 0 {
+        select {
+        case <-ctx.Done():
+            call.Err = ctx.Err()
+        case <-time.After(latency):
+        }
+    }
+    f.mu.Lock()
+    f.calls = append(f.calls, *call)
+    f.mu.Unlock()
+    return call.Err
+}
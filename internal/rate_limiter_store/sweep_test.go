@@ -0,0 +1,67 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+// A sweep triggered by an endpoint with a small capacity doesn't refill the buckets of an endpoint with a larger one.
+func TestMemoryTokenSweepKeepsOtherEndpoints(t *testing.T) {
+    ctx := context.Background()
+    store := NewMemoryStore().(TokenBucketStore)
+    large := RateLimiterKey{Endpoint: "/large", UserId: "user"}
+    small := RateLimiterKey{Endpoint: "/small", UserId: "user"}
+    now := time.Now()
+    for range 61 {
+        if taken, _, err := store.TakeToken(ctx, large, now, 100, time.Minute); err != nil || !taken {
+            t.Fatalf("TakeToken: %t, %v", taken, err)
+        }
+    }
+    // Sweeps every bucket, the large one is still 39 tokens short
+    if _, _, err := store.TakeToken(ctx, small, now.Add(2*time.Second), 5, time.Second); err != nil {
+        t.Fatalf("TakeToken: %v", err)
+    }
+    _, tokens, err := store.TakeToken(ctx, large, now.Add(2*time.Second), 100, time.Minute)
+    if err != nil {
+        t.Fatalf("TakeToken: %v", err)
+    }
+    if tokens != 38 {
+        t.Fatalf("%d tokens left, 38 expected", tokens)
+    }
+    // Both full again two hours later, the users who left don't leak
+    if _, _, err := store.TakeToken(ctx, small, now.Add(2*time.Hour), 5, time.Second); err != nil {
+        t.Fatalf("TakeToken: %v", err)
+    }
+    if _, ok := store.(*memory).tokenBuckets[large]; ok {
+        t.Fatalf("full bucket of %s not swept", large.Endpoint)
+    }
+}
+
+// A sweep triggered by an endpoint with a fast leak doesn't drain the queues of an endpoint with a slow one.
+func TestMemoryLeakySweepKeepsOtherEndpoints(t *testing.T) {
+    ctx := context.Background()
+    store := NewMemoryStore().(LeakyBucketStore)
+    slow := RateLimiterKey{Endpoint: "/slow", UserId: "user"}
+    fast := RateLimiterKey{Endpoint: "/fast", UserId: "user"}
+    now := time.Now()
+    for range 3 {
+        if _, ok, _, err := store.Enqueue(ctx, slow, now, 3, time.Minute); err != nil || !ok {
+            t.Fatalf("Enqueue: %t, %v", ok, err)
+        }
+    }
+    // Sweeps every queue, the slow one is still full
+    if _, _, _, err := store.Enqueue(ctx, fast, now.Add(2*time.Second), 3, time.Millisecond); err != nil {
+        t.Fatalf("Enqueue: %v", err)
+    }
+    if _, ok, _, err := store.Enqueue(ctx, slow, now.Add(2*time.Second), 3, time.Minute); err != nil || ok {
+        t.Fatalf("Enqueue on a full queue: %t, %v", ok, err)
+    }
+    // Both empty again five minutes later, the users who left don't leak
+    if _, _, _, err := store.Enqueue(ctx, fast, now.Add(5*time.Minute), 3, time.Millisecond); err != nil {
+        t.Fatalf("Enqueue: %v", err)
+    }
+    if _, ok := store.(*memory).leakyBuckets[slow]; ok {
+        t.Fatalf("empty queue of %s not swept", slow.Endpoint)
+    }
+}
@@ -0,0 +1,49 @@
+package rate_limiter_store
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "fmt"
+    "os"
+)
+
+// TLSConfig configures the TLS connections to a managed Redis, e.g. ElastiCache, Azure Cache or Upstash.
+type TLSConfig struct {
+    // CAFile is the PEM bundle used to verify the server certificate
+    //
+    // Defaults to the system roots if not specified
+    CAFile string `json:"ca_file,omitempty"`
+    // CertFile and KeyFile are the PEM client certificate and key, for servers requiring mutual TLS
+    CertFile string `json:"cert_file,omitempty"`
+    KeyFile  string `json:"key_file,omitempty"`
+    // ServerName overrides the name verified in the server certificate
+    //
+    // Defaults to the host of the address if not specified
+    ServerName string `json:"server_name,omitempty"`
+}
+
+// Load reads the certificates into a tls.Config.
+func (c TLSConfig) Load() (*tls.Config, error) {
+    config := &tls.Config{
+        MinVersion: tls.VersionTLS12,
+        ServerName: c.ServerName,
+    }
+    if c.CAFile != "" {
+        pem, err := os.ReadFile(c.CAFile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read CA file %s: %w", c.CAFile, err)
+        }
+        config.RootCAs = x509.NewCertPool()
+        if !config.RootCAs.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("no certificate found in CA file %s", c.CAFile)
+        }
+    }
+    if c.CertFile != "" || c.KeyFile != "" {
+        cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+        if err != nil {
+            return nil, fmt.Errorf("failed to load client certificate: %w", err)
+        }
+        config.Certificates = []tls.Certificate{cert}
+    }
+    return config, nil
+}
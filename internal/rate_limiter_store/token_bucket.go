@@ -0,0 +1,89 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "strconv"
+    "time"
+)
+
+// takeTokenScript refills and takes a token atomically, so instances racing on the same bucket can't both take the
+// last token. The bucket is a hash holding the tokens and the time of the last refill in milliseconds, it expires once
+// it would be full again. It returns whether a token was taken and the whole tokens left.
+var takeTokenScript = radix.NewEvalScript(`
+local now = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local refill = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(bucket[1]) or capacity
+local last = tonumber(bucket[2]) or now
+if now > last and refill > 0 then
+    tokens = math.min(capacity, tokens + (now - last) / refill)
+    last = now
+end
+local allowed = 0
+if tokens >= 1 then
+    tokens = tokens - 1
+    allowed = 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(last))
+redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil((capacity - tokens) * refill)))
+return {allowed, math.floor(tokens)}
+`)
+
+func (r *redis) TakeToken(ctx context.Context, key RateLimiterKey, now time.Time, capacity int64, refillInterval time.Duration) (bool, int64, error) {
+    var result []int64
+    if err := r.client.Do(ctx, takeTokenScript.Cmd(&result, []string{r.keys.generateBucketKey(key)}, strconv.FormatInt(now.UnixMilli(), 10), strconv.FormatInt(capacity, 10), formatMillis(refillInterval))); err != nil {
+        return false, 0, fmt.Errorf("failed to take token of user %s for endpoint %s: %w", key.UserId, key.Endpoint, err)
+    }
+    if len(result) != 2 {
+        return false, 0, fmt.Errorf("unexpected reply %v to take token of user %s for endpoint %s", result, key.UserId, key.Endpoint)
+    }
+    return result[0] == 1, result[1], nil
+}
+
+type memoryTokenBucket struct {
+    tokens    float64
+    last      time.Time
+    expiresAt time.Time // When the bucket is full again with its own capacity and refill, zero if never
+}
+
+// fullAt returns when a bucket with the tokens at last is full again, zero if it is never refilled.
+func fullAt(tokens float64, last time.Time, capacity int64, refillInterval time.Duration) time.Time {
+    if refillInterval <= 0 {
+        return time.Time{}
+    }
+    return last.Add(time.Duration((float64(capacity) - tokens) * float64(refillInterval)))
+}
+
+func (m *memory) TakeToken(_ context.Context, key RateLimiterKey, now time.Time, capacity int64, refillInterval time.Duration) (bool, int64, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if now.Sub(m.tokensSwept) >= time.Second {
+        // A full bucket is the same as a missing one, drop them so the users who left don't leak. Each bucket is full
+        // again by its own endpoint's capacity and refill, not the ones of this call
+        for k, b := range m.tokenBuckets {
+            if !b.expiresAt.IsZero() && !now.Before(b.expiresAt) {
+                delete(m.tokenBuckets, k)
+            }
+        }
+        m.tokensSwept = now
+    }
+    b, ok := m.tokenBuckets[key]
+    if !ok {
+        b = &memoryTokenBucket{tokens: float64(capacity), last: now}
+        m.tokenBuckets[key] = b
+    }
+    b.tokens = RefillTokens(b.tokens, b.last, now, capacity, refillInterval)
+    if now.After(b.last) {
+        b.last = now
+    }
+    if b.tokens < 1 {
+        b.expiresAt = fullAt(b.tokens, b.last, capacity, refillInterval)
+        return false, 0, nil
+    }
+    b.tokens--
+    b.expiresAt = fullAt(b.tokens, b.last, capacity, refillInterval)
+    return true, int64(b.tokens), nil
+}
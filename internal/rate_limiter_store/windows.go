@@ -0,0 +1,115 @@
+package rate_limiter_store
+
+import (
+    "context"
+    "fmt"
+    "github.com/mediocregopher/radix/v4"
+    "slices"
+    "time"
+)
+
+// windowCount is the number of windows whose bucket can still exist. A bucket lives ttl after its first increment, so
+// the buckets of the windows started in the last ttl plus a window are the only ones that can.
+func windowCount(windowInterval, ttl time.Duration) int64 {
+    return int64(ttl/windowInterval) + 2
+}
+
+// windowKeys returns the names of the buckets of the key that can still exist at now, generated by the format.
+//
+// Buckets are named by the second their window starts, sub-second windows sharing a second share a bucket so the
+// names are deduplicated. The windows go back in time, so the names of a shared second follow each other.
+func windowKeys(format func(RateLimiterKey, time.Time) string, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) []string {
+    start := WindowStart(now, windowInterval)
+    n := windowCount(windowInterval, ttl)
+    keys := make([]string, 0, n)
+    for i := int64(0); i < n; i++ {
+        k := format(key, start.Add(-time.Duration(i)*windowInterval))
+        if len(keys) > 0 && keys[len(keys)-1] == k {
+            continue
+        }
+        keys = append(keys, k)
+    }
+    return keys
+}
+
+// CountWindows sums the buckets with a single MGET of their names instead of scanning the keyspace, which is
+// O(keyspace) on every call.
+func (r *redis) CountWindows(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (int64, error) {
+    if windowInterval <= 0 {
+        // No window to derive the names from
+        return r.Get(ctx, key)
+    }
+    client := r.client
+    if r.replica != nil && r.replica.usable(ctx) {
+        client = r.replica.client
+    }
+    count, err := r.sumKeys(ctx, client, windowKeys(r.keys.generateKey, key, now, windowInterval, ttl))
+    if err != nil && client != r.client {
+        // Fall back to the primary, the replica is checked again on the next interval
+        client = r.client
+        count, err = r.sumKeys(ctx, client, windowKeys(r.keys.generateKey, key, now, windowInterval, ttl))
+    }
+    if err != nil {
+        return 0, err
+    }
+    if time.Now().Before(r.legacyUntil) {
+        // The legacy buckets are on other cluster slots than the current ones, they are fetched separately
+        legacy, err := r.sumKeys(ctx, client, windowKeys(generateLegacyKey, key, now, windowInterval, ttl))
+        if err != nil {
+            return 0, err
+        }
+        if count, err = AddCount(count, legacy); err != nil {
+            return 0, err
+        }
+    }
+    return count, nil
+}
+
+// sumKeys sums the counters of the keys, missing keys count for 0.
+func (r *redis) sumKeys(ctx context.Context, client radix.Client, keys []string) (int64, error) {
+    var values []*int64
+    if err := client.Do(ctx, radix.Cmd(&values, "MGET", keys...)); err != nil {
+        return 0, fmt.Errorf("failed to fetch rate limiters %s: %w", keys[0], err)
+    }
+    var (
+        count int64
+        err   error
+    )
+    for i, v := range values {
+        if v == nil {
+            continue
+        }
+        if count, err = AddCount(count, *v); err != nil {
+            return 0, fmt.Errorf("failed to count rate limiter %s with value %d: %w", keys[i], *v, err)
+        }
+    }
+    return count, nil
+}
+
+// oldestExpiryLua returns the milliseconds left to the first bucket of KEYS that exists, 0 if none does.
+const oldestExpiryLua = `
+for _, k in ipairs(KEYS) do
+    local ttl = redis.call("PTTL", k)
+    if ttl > 0 then
+        return ttl
+    end
+end
+return 0
+`
+
+var oldestExpiryScript = radix.NewEvalScript(oldestExpiryLua)
+
+// OldestExpiry checks the time to live of the buckets from the oldest window in one round trip. The legacy buckets of a
+// schema transition are ignored, they only hold the requests of the last ttl before the upgrade.
+func (r *redis) OldestExpiry(ctx context.Context, key RateLimiterKey, now time.Time, windowInterval, ttl time.Duration) (time.Duration, error) {
+    if windowInterval <= 0 {
+        return 0, nil
+    }
+    keys := windowKeys(r.keys.generateKey, key, now, windowInterval, ttl)
+    slices.Reverse(keys)
+    var ms int64
+    if err := r.client.Do(ctx, oldestExpiryScript.Cmd(&ms, keys)); err != nil {
+        return 0, fmt.Errorf("failed to fetch expiry of rate limiter %s: %w", keys[0], err)
+    }
+    return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,78 @@
+package request_signing
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "strconv"
+    "time"
+)
+
+// Algorithms of the signatures sent in the X-Signature header, the HMAC scheme is assumed when none is sent.
+const (
+    AlgorithmHMAC    = "hmac-sha256"
+    AlgorithmEd25519 = "ed25519"
+    AlgorithmECDSA   = "ecdsa-p256-sha256"
+)
+
+type keySigner struct {
+    keyID     string
+    key       crypto.Signer
+    algorithm string
+    now       func() time.Time
+}
+
+// NewKeySigner creates a Signer using the scheme of NewHMACSigner with a private key instead of a shared secret, so the
+// verifying services only hold the public key. Ed25519 and ECDSA P-256 keys are supported, the signature is sent as:
+//
+//    X-Signature: keyId=<key id>,ts=<unix seconds>,alg=<algorithm>,sig=<hex signature>
+func NewKeySigner(keyID string, key crypto.Signer) (Signer, error) {
+    s := &keySigner{
+        keyID: keyID,
+        key:   key,
+        now:   time.Now,
+    }
+    switch k := key.(type) {
+    case ed25519.PrivateKey:
+        s.algorithm = AlgorithmEd25519
+    case *ecdsa.PrivateKey:
+        if k.Curve != elliptic.P256() {
+            return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+        }
+        s.algorithm = AlgorithmECDSA
+    default:
+        return nil, fmt.Errorf("unsupported signing key %T", key)
+    }
+    return s, nil
+}
+
+func (s *keySigner) Sign(_ context.Context, req *protocol.Request) error {
+    if req.IsBodyStream() {
+        return fmt.Errorf("streamed bodies can't be signed with the %s scheme", s.algorithm)
+    }
+    ts := strconv.FormatInt(s.now().Unix(), 10)
+    data := []byte(stringToSign(req, ts))
+    var (
+        signature []byte
+        err       error
+    )
+    switch k := s.key.(type) {
+    case ed25519.PrivateKey:
+        signature = ed25519.Sign(k, data)
+    case *ecdsa.PrivateKey:
+        digest := sha256.Sum256(data)
+        signature, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+    }
+    if err != nil {
+        return fmt.Errorf("failed to compute %s signature: %w", s.algorithm, err)
+    }
+    req.Header.Set(SignatureHeader, fmt.Sprintf("keyId=%s,ts=%s,alg=%s,sig=%s", s.keyID, ts, s.algorithm, hex.EncodeToString(signature)))
+    return nil
+}
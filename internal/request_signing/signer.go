@@ -0,0 +1,81 @@
+package request_signing
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app/client"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "os"
+)
+
+var ErrMissingCredentials = errors.New("missing credentials")
+
+// Credentials used to sign outbound requests.
+type Credentials struct {
+    // AccessKeyID identifies the key, it is sent along with the signature
+    AccessKeyID string
+    // SecretAccessKey is the shared secret used to compute the signature, it is never sent
+    SecretAccessKey string
+    // SessionToken is sent along with temporary credentials
+    SessionToken string
+}
+
+// CredentialsProvider interface defines how credentials are retrieved, implementations can cache and rotate them.
+type CredentialsProvider interface {
+    Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials is a CredentialsProvider that always returns the same credentials.
+type StaticCredentials Credentials
+
+func (s StaticCredentials) Retrieve(_ context.Context) (Credentials, error) {
+    if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+        return Credentials{}, ErrMissingCredentials
+    }
+    return Credentials(s), nil
+}
+
+// EnvCredentials is a CredentialsProvider reading the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables on every call.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+    return StaticCredentials{
+        AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+        SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+        SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+    }.Retrieve(ctx)
+}
+
+// Signer interface defines the methods for signing an outbound request.
+type Signer interface {
+    // Sign adds the signature headers to the request, it must be called once the request is final
+    Sign(ctx context.Context, req *protocol.Request) error
+}
+
+// Middleware returns a hertz client middleware signing every request sent by the client.
+func Middleware(signer Signer) client.Middleware {
+    return func(next client.Endpoint) client.Endpoint {
+        return func(ctx context.Context, req *protocol.Request, resp *protocol.Response) error {
+            if err := signer.Sign(ctx, req); err != nil {
+                return fmt.Errorf("failed to sign request: %w", err)
+            }
+            return next(ctx, req, resp)
+        }
+    }
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+    h := sha256.Sum256(data)
+    return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,182 @@
+package request_signing
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/elliptic"
+    "crypto/hmac"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// CallerKey is the key of the service that signed the request in the request context, set by the verifier middleware.
+const CallerKey = "request_signing.caller"
+
+// ServiceKey is a key a service signs its requests with.
+type ServiceKey struct {
+    // Service the key belongs to, the identity of the requests signed with it
+    Service string `json:"service"`
+    // Secret shared with the service for the HMAC scheme
+    Secret string `json:"secret,omitempty"`
+    // PublicKey is the PEM encoded Ed25519 or ECDSA P-256 public key of the service, used instead of Secret for the
+    // signatures of NewKeySigner
+    PublicKey string `json:"public_key,omitempty"`
+}
+
+type VerifierConfig struct {
+    // Keys of the services by key id, a service can have several keys while rotating them
+    Keys map[string]ServiceKey `json:"keys"`
+    // MaxSkew is the largest difference accepted between the timestamp of a signature and the clock, it also bounds how
+    // long a captured request can be replayed
+    //
+    // Defaults to 5 minutes if not specified
+    MaxSkew time.Duration `json:"max_skew,omitempty"`
+}
+
+type verifyingKey struct {
+    service   string
+    algorithm string
+    secret    []byte
+    public    any // ed25519.PublicKey or *ecdsa.PublicKey
+}
+
+// Verifier verifies the signatures of the requests from other services, sent by NewHMACSigner or NewKeySigner.
+type Verifier struct {
+    keys    map[string]verifyingKey
+    maxSkew time.Duration
+    now     func() time.Time
+}
+
+// NewVerifier creates a Verifier accepting the signatures of the keys of the configuration.
+func NewVerifier(config VerifierConfig) (*Verifier, error) {
+    if config.MaxSkew == 0 {
+        config.MaxSkew = 5 * time.Minute
+    }
+    v := &Verifier{
+        keys:    make(map[string]verifyingKey, len(config.Keys)),
+        maxSkew: config.MaxSkew,
+        now:     time.Now,
+    }
+    for id, k := range config.Keys {
+        key, err := parseServiceKey(k)
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse key %s: %w", id, err)
+        }
+        v.keys[id] = key
+    }
+    return v, nil
+}
+
+func parseServiceKey(k ServiceKey) (verifyingKey, error) {
+    if k.Service == "" {
+        return verifyingKey{}, errors.New("missing service")
+    }
+    if (k.Secret == "") == (k.PublicKey == "") {
+        return verifyingKey{}, errors.New("exactly one of secret and public key must be set")
+    }
+    if k.Secret != "" {
+        return verifyingKey{service: k.Service, algorithm: AlgorithmHMAC, secret: []byte(k.Secret)}, nil
+    }
+    block, _ := pem.Decode([]byte(k.PublicKey))
+    if block == nil {
+        return verifyingKey{}, errors.New("no PEM block in public key")
+    }
+    public, err := x509.ParsePKIXPublicKey(block.Bytes)
+    if err != nil {
+        return verifyingKey{}, err
+    }
+    key := verifyingKey{service: k.Service, public: public}
+    switch p := public.(type) {
+    case ed25519.PublicKey:
+        key.algorithm = AlgorithmEd25519
+    case *ecdsa.PublicKey:
+        if p.Curve != elliptic.P256() {
+            return verifyingKey{}, fmt.Errorf("unsupported ECDSA curve %s", p.Curve.Params().Name)
+        }
+        key.algorithm = AlgorithmECDSA
+    default:
+        return verifyingKey{}, fmt.Errorf("unsupported public key %T", public)
+    }
+    return key, nil
+}
+
+// Verify checks the signature of the request and returns the service that signed it.
+func (v *Verifier) Verify(req *protocol.Request) (string, error) {
+    params := make(map[string]string, 4)
+    for _, param := range strings.Split(string(req.Header.Peek(SignatureHeader)), ",") {
+        name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+        params[name] = value
+    }
+    key, ok := v.keys[params["keyId"]]
+    if !ok {
+        return "", fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, params["keyId"])
+    }
+    algorithm := params["alg"]
+    if algorithm == "" {
+        algorithm = AlgorithmHMAC
+    }
+    if algorithm != key.algorithm {
+        return "", fmt.Errorf("%w: algorithm %s doesn't match the %s key", ErrInvalidSignature, algorithm, key.algorithm)
+    }
+    ts, err := strconv.ParseInt(params["ts"], 10, 64)
+    if err != nil {
+        return "", fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, params["ts"])
+    }
+    if skew := v.now().Sub(time.Unix(ts, 0)).Abs(); skew > v.maxSkew {
+        return "", fmt.Errorf("%w: timestamp is %s off", ErrInvalidSignature, skew)
+    }
+    signature, err := hex.DecodeString(params["sig"])
+    if err != nil {
+        return "", fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+    }
+    if req.IsBodyStream() {
+        // The signature covers the hash of the body
+        req.Body()
+    }
+    data := stringToSign(req, params["ts"])
+    switch algorithm {
+    case AlgorithmHMAC:
+        ok = hmac.Equal(signature, hmacSHA256(key.secret, data))
+    case AlgorithmEd25519:
+        ok = ed25519.Verify(key.public.(ed25519.PublicKey), []byte(data), signature)
+    case AlgorithmECDSA:
+        digest := sha256.Sum256([]byte(data))
+        ok = ecdsa.VerifyASN1(key.public.(*ecdsa.PublicKey), digest[:], signature)
+    }
+    if !ok {
+        return "", fmt.Errorf("%w: signature mismatch for key %s", ErrInvalidSignature, params["keyId"])
+    }
+    return key.service, nil
+}
+
+// Middleware rejects the requests without a valid signature with 401, the service that signed an accepted request is
+// set under CallerKey.
+func (v *Verifier) Middleware(ctx context.Context, c *app.RequestContext) {
+    service, err := v.Verify(&c.Request)
+    if err != nil {
+        c.AbortWithStatusJSON(consts.StatusUnauthorized, utils.H{"error": "Invalid signature"})
+        return
+    }
+    c.Set(CallerKey, service)
+    c.Next(ctx)
+}
+
+// Identity returns the service that signed the request, as verified by the middleware. It matches
+// ratelimiter.IdentityFunc, e.g. ratelimiter.WithIdentity(verifier.Identity), so each service gets its own quota.
+func (v *Verifier) Identity(_ context.Context, c *app.RequestContext) string {
+    return c.GetString(CallerKey)
+}
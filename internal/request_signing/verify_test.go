@@ -0,0 +1,181 @@
+package request_signing
+
+import (
+    "context"
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/ed25519"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/protocol"
+    "github.com/cloudwego/hertz/pkg/route"
+    "strings"
+    "testing"
+    "time"
+)
+
+func publicPEM(t *testing.T, key crypto.Signer) string {
+    t.Helper()
+    der, err := x509.MarshalPKIXPublicKey(key.Public())
+    if err != nil {
+        t.Fatalf("MarshalPKIXPublicKey: %v", err)
+    }
+    return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// signers returns a signer of each scheme, and the verifier accepting them.
+func signers(t *testing.T) (map[string]Signer, *Verifier) {
+    t.Helper()
+    _, edKey, err := ed25519.GenerateKey(rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    edSigner, err := NewKeySigner("billing-ed", edKey)
+    if err != nil {
+        t.Fatalf("NewKeySigner: %v", err)
+    }
+    ecSigner, err := NewKeySigner("billing-ec", ecKey)
+    if err != nil {
+        t.Fatalf("NewKeySigner: %v", err)
+    }
+    verifier, err := NewVerifier(VerifierConfig{Keys: map[string]ServiceKey{
+        "orders":     {Service: "orders", Secret: "secret"},
+        "billing-ed": {Service: "billing", PublicKey: publicPEM(t, edKey)},
+        "billing-ec": {Service: "billing", PublicKey: publicPEM(t, ecKey)},
+    }})
+    if err != nil {
+        t.Fatalf("NewVerifier: %v", err)
+    }
+    return map[string]Signer{
+        AlgorithmHMAC:    NewHMACSigner(StaticCredentials{AccessKeyID: "orders", SecretAccessKey: "secret"}),
+        AlgorithmEd25519: edSigner,
+        AlgorithmECDSA:   ecSigner,
+    }, verifier
+}
+
+func signedRequest(t *testing.T, signer Signer) *protocol.Request {
+    t.Helper()
+    req := protocol.NewRequest("POST", "http://inventory.internal/reserve?sku=42", nil)
+    req.SetBodyString(`{"quantity":1}`)
+    if err := signer.Sign(context.Background(), req); err != nil {
+        t.Fatalf("Sign: %v", err)
+    }
+    return req
+}
+
+func TestVerifier(t *testing.T) {
+    signers, verifier := signers(t)
+    for algorithm, signer := range signers {
+        t.Run(algorithm, func(t *testing.T) {
+            want := "billing"
+            if algorithm == AlgorithmHMAC {
+                want = "orders"
+            }
+            if service, err := verifier.Verify(signedRequest(t, signer)); err != nil || service != want {
+                t.Fatalf("Verify: %q, %v, %s expected", service, err, want)
+            }
+            // The signature covers the method, the path, the query and the body
+            for name, tamper := range map[string]func(req *protocol.Request){
+                "method": func(req *protocol.Request) { req.SetMethod("PUT") },
+                "path":   func(req *protocol.Request) { req.URI().SetPath("/release") },
+                "query":  func(req *protocol.Request) { req.URI().SetQueryString("sku=43") },
+                "body":   func(req *protocol.Request) { req.SetBodyString(`{"quantity":100}`) },
+            } {
+                req := signedRequest(t, signer)
+                tamper(req)
+                if _, err := verifier.Verify(req); !errors.Is(err, ErrInvalidSignature) {
+                    t.Fatalf("tampered %s: %v, ErrInvalidSignature expected", name, err)
+                }
+            }
+        })
+    }
+}
+
+func TestVerifierRejects(t *testing.T) {
+    signers, verifier := signers(t)
+    for _, test := range []struct {
+        name   string
+        header func(signed string) string
+    }{
+        {"no signature", func(string) string { return "" }},
+        {"unknown key", func(signed string) string { return strings.Replace(signed, "keyId=orders", "keyId=payments", 1) }},
+        // A public key has no secret, anybody can compute an HMAC with an empty one
+        {"hmac with a public key", func(signed string) string {
+            ts := strings.Split(strings.Split(signed, "ts=")[1], ",")[0]
+            req := protocol.NewRequest("POST", "http://inventory.internal/reserve?sku=42", nil)
+            req.SetBodyString(`{"quantity":1}`)
+            return "keyId=billing-ed,ts=" + ts + ",sig=" + hex.EncodeToString(hmacSHA256(nil, stringToSign(req, ts)))
+        }},
+        {"bad timestamp", func(signed string) string { return strings.Replace(signed, "ts=", "ts=x", 1) }},
+    } {
+        t.Run(test.name, func(t *testing.T) {
+            req := signedRequest(t, signers[AlgorithmHMAC])
+            req.Header.Set(SignatureHeader, test.header(string(req.Header.Peek(SignatureHeader))))
+            if _, err := verifier.Verify(req); !errors.Is(err, ErrInvalidSignature) {
+                t.Fatalf("Verify: %v, ErrInvalidSignature expected", err)
+            }
+        })
+    }
+
+    // A captured request can only be replayed within MaxSkew
+    req := signedRequest(t, signers[AlgorithmHMAC])
+    verifier.now = func() time.Time {
+        return time.Now().Add(6 * time.Minute)
+    }
+    if _, err := verifier.Verify(req); !errors.Is(err, ErrInvalidSignature) {
+        t.Fatalf("Verify of a stale signature: %v, ErrInvalidSignature expected", err)
+    }
+}
+
+func TestNewVerifierRejectsBadKeys(t *testing.T) {
+    ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+    if err != nil {
+        t.Fatalf("GenerateKey: %v", err)
+    }
+    for name, key := range map[string]ServiceKey{
+        "no service":        {Secret: "secret"},
+        "secret and key":    {Service: "orders", Secret: "secret", PublicKey: publicPEM(t, ecKey)},
+        "neither":           {Service: "orders"},
+        "not PEM":           {Service: "orders", PublicKey: "key"},
+        "unsupported curve": {Service: "orders", PublicKey: publicPEM(t, ecKey)},
+    } {
+        if _, err := NewVerifier(VerifierConfig{Keys: map[string]ServiceKey{"key": key}}); err == nil {
+            t.Fatalf("%s: accepted", name)
+        }
+    }
+}
+
+func TestVerifierMiddleware(t *testing.T) {
+    signers, verifier := signers(t)
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.POST("/reserve", verifier.Middleware, func(ctx context.Context, c *app.RequestContext) {
+        c.String(200, verifier.Identity(ctx, c))
+    })
+    perform := func(req *protocol.Request) *protocol.Response {
+        var headers []ut.Header
+        req.Header.VisitAll(func(key, value []byte) {
+            headers = append(headers, ut.Header{Key: string(key), Value: string(value)})
+        })
+        return ut.PerformRequest(engine, "POST", string(req.URI().RequestURI()), &ut.Body{Body: strings.NewReader(string(req.Body())), Len: len(req.Body())}, headers...).Result()
+    }
+
+    req := signedRequest(t, signers[AlgorithmEd25519])
+    if resp := perform(req); resp.StatusCode() != 200 || string(resp.Body()) != "billing" {
+        t.Fatalf("signed request: %d %s", resp.StatusCode(), resp.Body())
+    }
+    req.SetBodyString(`{"quantity":100}`)
+    if resp := perform(req); resp.StatusCode() != 401 {
+        t.Fatalf("tampered request: %d %s, 401 expected", resp.StatusCode(), resp.Body())
+    }
+}
@@ -0,0 +1,155 @@
+package server_timing
+
+import (
+    "context"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "net"
+    "net/netip"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Names of the entries of the middleware stages.
+const (
+    StageRateLimit = "ratelimit"
+    StageAuth      = "auth"
+    StageCache     = "cache"
+    StageUpstream  = "upstream"
+    // StageQueue is the wait in the admission queue of the bulkhead
+    StageQueue = "queue"
+    // StageTotal is the time from the middleware to the end of the next handlers
+    StageTotal = "total"
+)
+
+// timingsKey is the key of the timings of the request in the request context, set by the middleware.
+const timingsKey = "server_timing.timings"
+
+type ServerTimingConfig struct {
+    // Public sends the entries to every client. They tell how the service is built and how loaded it is, so by
+    // default only the clients of the allowlist get them
+    Public bool `json:"public,omitempty"`
+    // Allowlist of the IPs and CIDRs getting the entries when they are not public, e.g. the internal services and the
+    // office network
+    //
+    // Defaults to the loopback and private networks if not specified
+    Allowlist []string `json:"allowlist,omitempty"`
+    // ForwardedFor reads the client IP from X-Forwarded-For, only for a service behind a proxy overwriting it, the
+    // remote address is used otherwise so the allowlist can't be bypassed with a forged header
+    ForwardedFor bool `json:"forwarded_for,omitempty"`
+}
+
+// defaultAllowlist are the loopback and private networks.
+var defaultAllowlist = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// entry is a stage the request went through.
+type entry struct {
+    name string
+    dur  time.Duration
+}
+
+// timings are the entries of a request, stages may record from other goroutines, e.g. a hedged upstream request.
+type timings struct {
+    mu      sync.Mutex
+    entries []entry
+}
+
+// ServerTiming reports the time spent in each middleware stage of a request in a Server-Timing header, so the
+// consumers of the API and the browser devtools show where the time goes.
+type ServerTiming struct {
+    public       bool
+    allowlist    []netip.Prefix
+    forwardedFor bool
+}
+
+// NewServerTiming creates a ServerTiming reporting the stages recorded with Add.
+func NewServerTiming(config ServerTimingConfig) (*ServerTiming, error) {
+    if len(config.Allowlist) == 0 {
+        config.Allowlist = defaultAllowlist
+    }
+    st := &ServerTiming{public: config.Public, forwardedFor: config.ForwardedFor}
+    for _, e := range config.Allowlist {
+        prefix, err := netip.ParsePrefix(e)
+        if err != nil {
+            addr, addrErr := netip.ParseAddr(e)
+            if addrErr != nil {
+                return nil, fmt.Errorf("invalid allowlist entry %q: %w", e, err)
+            }
+            prefix = netip.PrefixFrom(addr, addr.BitLen())
+        }
+        st.allowlist = append(st.allowlist, prefix.Masked())
+    }
+    return st, nil
+}
+
+// Middleware collects the entries of the next handlers and writes them in the Server-Timing header of the response,
+// with the total. It must run before the stages it reports, e.g. first with h.Use. The stages record nothing for the
+// clients that don't get the entries.
+func (st *ServerTiming) Middleware(ctx context.Context, c *app.RequestContext) {
+    if !st.exposed(c) {
+        c.Next(ctx)
+        return
+    }
+    start := time.Now()
+    t := &timings{}
+    c.Set(timingsKey, t)
+    c.Next(ctx)
+    Add(c, StageTotal, time.Since(start))
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    values := make([]string, 0, len(t.entries))
+    for _, e := range t.entries {
+        values = append(values, fmt.Sprintf("%s;dur=%.3f", e.name, float64(e.dur.Microseconds())/1000))
+    }
+    c.Response.Header.Add("Server-Timing", strings.Join(values, ", "))
+}
+
+func (st *ServerTiming) exposed(c *app.RequestContext) bool {
+    if st.public {
+        return true
+    }
+    addr, err := netip.ParseAddr(st.clientIP(c))
+    if err != nil {
+        return false
+    }
+    addr = addr.Unmap()
+    for _, prefix := range st.allowlist {
+        if prefix.Contains(addr) {
+            return true
+        }
+    }
+    return false
+}
+
+func (st *ServerTiming) clientIP(c *app.RequestContext) string {
+    if st.forwardedFor {
+        return c.ClientIP()
+    }
+    addr := c.RemoteAddr()
+    if addr == nil {
+        return ""
+    }
+    host, _, err := net.SplitHostPort(addr.String())
+    if err != nil {
+        return addr.String()
+    }
+    return host
+}
+
+// Add records the time the request spent in a stage, e.g. StageCache, reported by the middleware. It does nothing if
+// the middleware doesn't report the timings of the request.
+func Add(c *app.RequestContext, name string, dur time.Duration) {
+    t, ok := c.Value(timingsKey).(*timings)
+    if !ok {
+        return
+    }
+    t.mu.Lock()
+    t.entries = append(t.entries, entry{name: name, dur: dur})
+    t.mu.Unlock()
+}
+
+// Since records the time since start in a stage, see Add.
+func Since(c *app.RequestContext, name string, start time.Time) {
+    Add(c, name, time.Since(start))
+}
@@ -0,0 +1,92 @@
+package server_timing
+
+import (
+    "context"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/network"
+    "net"
+    "regexp"
+    "testing"
+    "time"
+)
+
+// remoteConn is a connection from a client address, the only method the middleware calls.
+type remoteConn struct {
+    network.Conn
+    addr net.Addr
+}
+
+func (c remoteConn) RemoteAddr() net.Addr {
+    return c.addr
+}
+
+// serve runs the middleware on a request from the client IP, before a handler recording a cache stage, and returns
+// the Server-Timing header of the response.
+func serve(st *ServerTiming, ip string, headers ...string) string {
+    c := app.NewContext(0)
+    c.SetConn(remoteConn{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+    for i := 0; i+1 < len(headers); i += 2 {
+        c.Request.Header.Set(headers[i], headers[i+1])
+    }
+    c.SetHandlers(app.HandlersChain{func(ctx context.Context, c *app.RequestContext) {
+        Since(c, StageCache, time.Now().Add(-1500*time.Microsecond))
+        Add(c, StageUpstream, 20*time.Millisecond)
+    }})
+    st.Middleware(context.Background(), c)
+    return string(c.Response.Header.Peek("Server-Timing"))
+}
+
+var header = regexp.MustCompile(`^cache;dur=1\.[0-9]{3}, upstream;dur=20\.000, total;dur=[0-9]+\.[0-9]{3}$`)
+
+func TestServerTiming(t *testing.T) {
+    st, err := NewServerTiming(ServerTimingConfig{Allowlist: []string{"203.0.113.0/24", "198.51.100.7"}})
+    if err != nil {
+        t.Fatalf("NewServerTiming: %v", err)
+    }
+    for _, test := range []struct {
+        ip       string
+        headers  []string
+        reported bool
+    }{
+        {"203.0.113.10", nil, true},
+        {"198.51.100.7", nil, true},
+        {"::ffff:198.51.100.7", nil, true},
+        {"198.51.100.8", nil, false},
+        // The header of the client is ignored, only a proxy would overwrite it
+        {"198.51.100.8", []string{"X-Forwarded-For", "198.51.100.7"}, false},
+    } {
+        value := serve(st, test.ip, test.headers...)
+        if header.MatchString(value) != test.reported || (!test.reported && value != "") {
+            t.Fatalf("%s %v: Server-Timing %q, reported %t expected", test.ip, test.headers, value, test.reported)
+        }
+    }
+}
+
+func TestServerTimingDefaults(t *testing.T) {
+    st, err := NewServerTiming(ServerTimingConfig{})
+    if err != nil {
+        t.Fatalf("NewServerTiming: %v", err)
+    }
+    // The loopback and private networks get the entries
+    for _, ip := range []string{"127.0.0.1", "::1", "10.1.2.3", "192.168.1.1", "fd00::1"} {
+        if value := serve(st, ip); !header.MatchString(value) {
+            t.Fatalf("%s: Server-Timing %q", ip, value)
+        }
+    }
+    if value := serve(st, "203.0.113.10"); value != "" {
+        t.Fatalf("public client: Server-Timing %q", value)
+    }
+
+    st, _ = NewServerTiming(ServerTimingConfig{Public: true})
+    if value := serve(st, "203.0.113.10"); !header.MatchString(value) {
+        t.Fatalf("public: Server-Timing %q", value)
+    }
+    st, _ = NewServerTiming(ServerTimingConfig{ForwardedFor: true})
+    if value := serve(st, "203.0.113.10", "X-Forwarded-For", "10.0.0.1"); !header.MatchString(value) {
+        t.Fatalf("forwarded for 10.0.0.1: Server-Timing %q", value)
+    }
+
+    if _, err := NewServerTiming(ServerTimingConfig{Allowlist: []string{"office"}}); err == nil {
+        t.Fatalf("invalid allowlist accepted")
+    }
+}
@@ -0,0 +1,70 @@
+package otel_tracing
+
+import (
+    "context"
+    "fmt"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+    "time"
+)
+
+type otelTracer struct {
+    tracer trace.Tracer
+}
+
+// NewTracer adapts an OpenTelemetry tracer, e.g. otel.Tracer("myapp"), to tracing.Tracer. It is in a package of its
+// own so only the applications exporting to OpenTelemetry depend on it.
+func NewTracer(tracer trace.Tracer) tracing.Tracer {
+    return otelTracer{tracer: tracer}
+}
+
+func (t otelTracer) Start(ctx context.Context, name string, attributes ...tracing.Attribute) (context.Context, tracing.Span) {
+    ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(convert(attributes)...))
+    return ctx, otelSpan{span: span}
+}
+
+type otelSpan struct {
+    span trace.Span
+}
+
+func (s otelSpan) SetAttributes(attributes ...tracing.Attribute) {
+    s.span.SetAttributes(convert(attributes)...)
+}
+
+func (s otelSpan) RecordError(err error) {
+    s.span.RecordError(err)
+    s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+    s.span.End()
+}
+
+// convert converts the attributes to OpenTelemetry ones, durations in milliseconds with their key suffixed with _ms
+// and the types OpenTelemetry doesn't have formatted as strings.
+func convert(attributes []tracing.Attribute) []attribute.KeyValue {
+    kvs := make([]attribute.KeyValue, 0, len(attributes))
+    for _, a := range attributes {
+        switch v := a.Value.(type) {
+        case string:
+            kvs = append(kvs, attribute.String(a.Key, v))
+        case bool:
+            kvs = append(kvs, attribute.Bool(a.Key, v))
+        case int:
+            kvs = append(kvs, attribute.Int(a.Key, v))
+        case int64:
+            kvs = append(kvs, attribute.Int64(a.Key, v))
+        case float64:
+            kvs = append(kvs, attribute.Float64(a.Key, v))
+        case time.Duration:
+            kvs = append(kvs, attribute.Float64(a.Key+"_ms", float64(v)/float64(time.Millisecond)))
+        case []string:
+            kvs = append(kvs, attribute.StringSlice(a.Key, v))
+        default:
+            kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+        }
+    }
+    return kvs
+}
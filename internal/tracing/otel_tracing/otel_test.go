@@ -0,0 +1,106 @@
+package otel_tracing
+
+import (
+    "context"
+    "errors"
+    "github.com/aswinkm-tc/go-web-concepts/internal/tracing"
+    "go.opentelemetry.io/otel/attribute"
+    "go.opentelemetry.io/otel/codes"
+    "go.opentelemetry.io/otel/trace"
+    "go.opentelemetry.io/otel/trace/noop"
+    "testing"
+    "time"
+)
+
+// recordingSpan keeps what the adapter sets on it.
+type recordingSpan struct {
+    trace.Span
+    name       string
+    attributes []attribute.KeyValue
+    status     codes.Code
+    errors     []error
+    ended      bool
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+    s.attributes = append(s.attributes, kv...)
+}
+
+func (s *recordingSpan) RecordError(err error, _ ...trace.EventOption) {
+    s.errors = append(s.errors, err)
+}
+
+func (s *recordingSpan) SetStatus(code codes.Code, _ string) {
+    s.status = code
+}
+
+func (s *recordingSpan) End(...trace.SpanEndOption) {
+    s.ended = true
+}
+
+// recordingTracer starts recordingSpans.
+type recordingTracer struct {
+    trace.Tracer
+    spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+    config := trace.NewSpanStartConfig(opts...)
+    s := &recordingSpan{Span: noop.Span{}, name: name, attributes: config.Attributes()}
+    t.spans = append(t.spans, s)
+    return trace.ContextWithSpan(ctx, s), s
+}
+
+func TestTracer(t *testing.T) {
+    recorder := &recordingTracer{Tracer: noop.NewTracerProvider().Tracer("test")}
+    tracer := NewTracer(recorder)
+    ctx, span := tracer.Start(context.Background(), "rate_limiter.decision", tracing.Attribute{Key: "endpoint", Value: "/api"})
+    if trace.SpanFromContext(ctx) != recorder.spans[0] {
+        t.Fatalf("span not in the context")
+    }
+    span.SetAttributes(tracing.Attribute{Key: "allowed", Value: false})
+    span.RecordError(errors.New("connection refused"))
+    span.End()
+
+    s := recorder.spans[0]
+    if s.name != "rate_limiter.decision" || len(s.attributes) != 2 || s.attributes[0] != attribute.String("endpoint", "/api") ||
+        s.attributes[1] != attribute.Bool("allowed", false) {
+        t.Fatalf("span %s with attributes %v", s.name, s.attributes)
+    }
+    if len(s.errors) != 1 || s.status != codes.Error || !s.ended {
+        t.Fatalf("span errors %v, status %v, ended %t", s.errors, s.status, s.ended)
+    }
+}
+
+func TestConvert(t *testing.T) {
+    kvs := convert([]tracing.Attribute{
+        {Key: "endpoint", Value: "/api"},
+        {Key: "allowed", Value: true},
+        {Key: "cost", Value: 3},
+        {Key: "remaining", Value: int64(7)},
+        {Key: "ratio", Value: 0.5},
+        {Key: "store_latency", Value: 1500 * time.Microsecond},
+        {Key: "windows", Value: []string{"1m", "1h"}},
+        {Key: "retry_after", Value: struct{ Seconds int }{30}},
+    })
+    want := []attribute.KeyValue{
+        attribute.String("endpoint", "/api"),
+        attribute.Bool("allowed", true),
+        attribute.Int("cost", 3),
+        attribute.Int64("remaining", 7),
+        attribute.Float64("ratio", 0.5),
+        // The durations are in milliseconds
+        attribute.Float64("store_latency_ms", 1.5),
+        attribute.StringSlice("windows", []string{"1m", "1h"}),
+        // The other types are formatted
+        attribute.String("retry_after", "{30}"),
+    }
+    if len(kvs) != len(want) {
+        t.Fatalf("attributes %v, %v expected", kvs, want)
+    }
+    for i := range want {
+        if kvs[i].Key != want[i].Key || kvs[i].Value.Emit() != want[i].Value.Emit() || kvs[i].Value.Type() != want[i].Value.Type() {
+            t.Fatalf("attribute %v, %v expected", kvs[i], want[i])
+        }
+    }
+}
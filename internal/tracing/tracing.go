@@ -0,0 +1,41 @@
+package tracing
+
+import (
+    "context"
+)
+
+// Attribute describes a span, e.g. the endpoint of a request.
+type Attribute struct {
+    Key   string `json:"key"`
+    Value any    `json:"value"`
+}
+
+// Tracer starts the spans of the subsystems, the tracing backends implement it, e.g. with an adapter to OpenTelemetry,
+// so the instrumented code doesn't depend on any of them.
+type Tracer interface {
+    // Start starts a span, a child of the span in ctx if any, and returns a context holding it
+    Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+    // SetAttributes adds attributes known once the operation ran, e.g. its result
+    SetAttributes(attributes ...Attribute)
+    // RecordError marks the span as failed with the error
+    RecordError(err error)
+    // End ends the span, it must be called once
+    End()
+}
+
+type noop struct{}
+
+func (noop) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+    return ctx, noop{}
+}
+
+func (noop) SetAttributes(...Attribute) {}
+func (noop) RecordError(error)          {}
+func (noop) End()                       {}
+
+// Noop starts spans that record nothing, it is the tracer of the subsystems without tracing configured.
+var Noop Tracer = noop{}
@@ -0,0 +1,264 @@
+package transform
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "github.com/cloudwego/hertz/pkg/app"
+    "log/slog"
+    "regexp"
+    "strings"
+)
+
+// DefaultRedaction replaces the redacted JSON fields when Rule.Redaction is not specified.
+const DefaultRedaction = "[REDACTED]"
+
+// Transformer interface defines the methods for rewriting requests and responses.
+type Transformer interface {
+    // Middleware applies the request rules before the next handlers and the response rules after them
+    Middleware(ctx context.Context, c *app.RequestContext)
+}
+
+type Rule struct {
+    // PathPrefix restricts the rule to requests whose path starts with it
+    //
+    // Defaults to every path if not specified
+    PathPrefix string `json:"path_prefix,omitempty"`
+    // Methods restricts the rule to the given HTTP methods
+    //
+    // Defaults to every method if not specified
+    Methods []string `json:"methods,omitempty"`
+    // SetHeaders sets the headers, replacing any existing value
+    SetHeaders map[string]string `json:"set_headers,omitempty"`
+    // AddHeaders adds the headers, keeping the existing values
+    AddHeaders map[string]string `json:"add_headers,omitempty"`
+    // RemoveHeaders removes the headers
+    RemoveHeaders []string `json:"remove_headers,omitempty"`
+    // RewritePath replaces the matches of a regular expression in the request path, it is ignored for response rules
+    RewritePath *PathRewrite `json:"rewrite_path,omitempty"`
+    // RedactFields lists the dot separated paths of JSON body fields to redact, * matches every array element or object field
+    RedactFields []string `json:"redact_fields,omitempty"`
+    // Redaction replaces the redacted fields
+    //
+    // Defaults to DefaultRedaction if not specified
+    Redaction string `json:"redaction,omitempty"`
+}
+
+type PathRewrite struct {
+    // Match is a regular expression matched against the request path
+    Match string `json:"match"`
+    // Replacement can reference the groups of Match with $1, $2...
+    Replacement string `json:"replacement"`
+}
+
+type TransformConfig struct {
+    // Request rules are applied in order before the request reaches the handler
+    Request []Rule `json:"request,omitempty"`
+    // Response rules are applied in order to the response written by the handler
+    Response []Rule `json:"response,omitempty"`
+}
+
+type rule struct {
+    Rule
+    methods     map[string]struct{}
+    rewrite     *regexp.Regexp
+    redactPaths [][]string
+    index       int // Of the rule in the configuration, to keep the declaration order across the indexes
+}
+
+// ruleSet indexes the rules by the first segment of their PathPrefix, so a request only evaluates the rules of its route.
+type ruleSet struct {
+    bySegment map[string][]*rule
+    global    []*rule // Rules without a PathPrefix, or with a PathPrefix shorter than a full segment
+}
+
+type transformer struct {
+    request  ruleSet
+    response ruleSet
+}
+
+// NewTransformer compiles the rules of the configuration into a Transformer.
+func NewTransformer(config TransformConfig) (Transformer, error) {
+    request, err := compile(config.Request)
+    if err != nil {
+        return nil, err
+    }
+    response, err := compile(config.Response)
+    if err != nil {
+        return nil, err
+    }
+    return &transformer{
+        request:  request,
+        response: response,
+    }, nil
+}
+
+func compile(rules []Rule) (ruleSet, error) {
+    set := ruleSet{bySegment: make(map[string][]*rule)}
+    for i, r := range rules {
+        compiled := &rule{Rule: r, index: i}
+        if compiled.Redaction == "" {
+            compiled.Redaction = DefaultRedaction
+        }
+        if len(r.Methods) > 0 {
+            compiled.methods = make(map[string]struct{}, len(r.Methods))
+            for _, m := range r.Methods {
+                compiled.methods[strings.ToUpper(m)] = struct{}{}
+            }
+        }
+        if r.RewritePath != nil {
+            re, err := regexp.Compile(r.RewritePath.Match)
+            if err != nil {
+                return ruleSet{}, fmt.Errorf("failed to compile path rewrite %s: %w", r.RewritePath.Match, err)
+            }
+            compiled.rewrite = re
+        }
+        for _, field := range r.RedactFields {
+            compiled.redactPaths = append(compiled.redactPaths, strings.Split(field, "."))
+        }
+
+        segment, complete := firstSegment(r.PathPrefix)
+        if complete {
+            set.bySegment[segment] = append(set.bySegment[segment], compiled)
+        } else {
+            set.global = append(set.global, compiled)
+        }
+    }
+    return set, nil
+}
+
+// firstSegment returns the first segment of the path and whether the path contains that whole segment.
+func firstSegment(path string) (string, bool) {
+    trimmed := strings.TrimPrefix(path, "/")
+    segment, _, found := strings.Cut(trimmed, "/")
+    return segment, found && segment != ""
+}
+
+// match returns the rules applying to the request, in the order they were declared.
+func (s ruleSet) match(method, path string) []*rule {
+    segment, _ := firstSegment(path + "/")
+    var matched []*rule
+    // Both slices are in declaration order, merge them by index
+    global, scoped := s.global, s.bySegment[segment]
+    for len(global) > 0 || len(scoped) > 0 {
+        var r *rule
+        if len(scoped) == 0 || (len(global) > 0 && global[0].index < scoped[0].index) {
+            r, global = global[0], global[1:]
+        } else {
+            r, scoped = scoped[0], scoped[1:]
+        }
+        if r.matches(method, path) {
+            matched = append(matched, r)
+        }
+    }
+    return matched
+}
+
+func (r *rule) matches(method, path string) bool {
+    if !strings.HasPrefix(path, r.PathPrefix) {
+        return false
+    }
+    _, ok := r.methods[method]
+    return r.methods == nil || ok
+}
+
+func (t *transformer) Middleware(ctx context.Context, c *app.RequestContext) {
+    method := string(c.Method())
+    // Response rules are selected with the original path, before it is rewritten
+    path := string(c.Path())
+
+    for _, r := range t.request.match(method, path) {
+        r.applyHeaders(c.Request.Header.Set, c.Request.Header.Add, c.Request.Header.Del)
+        if r.rewrite != nil {
+            c.Request.URI().SetPath(r.rewrite.ReplaceAllString(string(c.Request.URI().Path()), r.RewritePath.Replacement))
+        }
+        if len(r.redactPaths) > 0 && isJSON(c.Request.Header.ContentType()) {
+            if body, ok := r.redact(c.Request.Body()); ok {
+                c.Request.SetBody(body)
+            }
+        }
+    }
+
+    c.Next(ctx)
+
+    for _, r := range t.response.match(method, path) {
+        r.applyHeaders(c.Response.Header.Set, c.Response.Header.Add, c.Response.Header.Del)
+        if len(r.redactPaths) > 0 && isJSON(c.Response.Header.ContentType()) {
+            if body, ok := r.redact(c.Response.Body()); ok {
+                c.Response.SetBody(body)
+            }
+        }
+    }
+}
+
+func (r *rule) applyHeaders(set, add func(key, value string), del func(key string)) {
+    for _, name := range r.RemoveHeaders {
+        del(name)
+    }
+    for name, value := range r.SetHeaders {
+        set(name, value)
+    }
+    for name, value := range r.AddHeaders {
+        add(name, value)
+    }
+}
+
+// redact replaces the configured fields of a JSON body, it returns false if the body was left untouched.
+func (r *rule) redact(body []byte) ([]byte, bool) {
+    var doc any
+    if err := json.Unmarshal(body, &doc); err != nil {
+        slog.Debug("Skipping redaction of invalid JSON body", "error", err)
+        return nil, false
+    }
+    redacted := false
+    for _, path := range r.redactPaths {
+        if redactPath(doc, path, r.Redaction) {
+            redacted = true
+        }
+    }
+    if !redacted {
+        return nil, false
+    }
+    out, err := json.Marshal(doc)
+    if err != nil {
+        slog.Error("Error encoding redacted body", "error", err)
+        return nil, false
+    }
+    return out, true
+}
+
+// redactPath walks the JSON document along the path and replaces the values found at its end.
+func redactPath(node any, path []string, redaction string) bool {
+    redacted := false
+    switch v := node.(type) {
+    case map[string]any:
+        for key, child := range v {
+            if path[0] != "*" && path[0] != key {
+                continue
+            }
+            if len(path) == 1 {
+                v[key] = redaction
+                redacted = true
+            } else if redactPath(child, path[1:], redaction) {
+                redacted = true
+            }
+        }
+    case []any:
+        for i, child := range v {
+            if path[0] != "*" && path[0] != fmt.Sprint(i) {
+                continue
+            }
+            if len(path) == 1 {
+                v[i] = redaction
+                redacted = true
+            } else if redactPath(child, path[1:], redaction) {
+                redacted = true
+            }
+        }
+    }
+    return redacted
+}
+
+func isJSON(contentType []byte) bool {
+    return strings.Contains(strings.ToLower(string(contentType)), "json")
+}
@@ -0,0 +1,124 @@
+package transform
+
+import (
+    "context"
+    "encoding/json"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "strings"
+    "testing"
+)
+
+// echo is the request as received by the handler.
+type echo struct {
+    Path   string   `json:"path"`
+    Route  string   `json:"route"`
+    Client string   `json:"client"`
+    Trace  []string `json:"trace"`
+    Body   string   `json:"body"`
+    Token  string   `json:"token"`
+}
+
+func newEngine(t *testing.T, conf TransformConfig) *route.Engine {
+    t.Helper()
+    transformer, err := NewTransformer(conf)
+    if err != nil {
+        t.Fatalf("NewTransformer: %v", err)
+    }
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.Use(transformer.Middleware)
+    handler := func(_ context.Context, c *app.RequestContext) {
+        var trace []string
+        c.Request.Header.VisitAll(func(key, value []byte) {
+            if string(key) == "X-Trace" {
+                trace = append(trace, string(value))
+            }
+        })
+        c.Header("X-Powered-By", "hertz")
+        c.JSON(200, echo{
+            Path:   string(c.Path()),
+            Route:  string(c.GetHeader("X-Route")),
+            Client: string(c.GetHeader("X-Client")),
+            Trace:  trace,
+            Body:   string(c.Request.Body()),
+            Token:  "secret",
+        })
+    }
+    engine.POST("/api/v1/users", handler)
+    engine.GET("/api/v1/users", handler)
+    engine.GET("/health", handler)
+    return engine
+}
+
+func perform(t *testing.T, engine *route.Engine, method, path, contentType, body string, headers ...ut.Header) (echo, map[string]string) {
+    t.Helper()
+    headers = append(headers, ut.Header{Key: "Content-Type", Value: contentType})
+    resp := ut.PerformRequest(engine, method, path, &ut.Body{Body: strings.NewReader(body), Len: len(body)}, headers...).Result()
+    var e echo
+    if err := json.Unmarshal(resp.Body(), &e); err != nil {
+        t.Fatalf("%s %s: %v, %s", method, path, err, resp.Body())
+    }
+    h := make(map[string]string)
+    resp.Header.VisitAll(func(key, value []byte) {
+        h[string(key)] = string(value)
+    })
+    return e, h
+}
+
+func TestTransformer(t *testing.T) {
+    engine := newEngine(t, TransformConfig{
+        Request: []Rule{
+            {PathPrefix: "/api/", SetHeaders: map[string]string{"X-Route": "api"}, AddHeaders: map[string]string{"X-Trace": "gateway"}},
+            // Declared after the rule of /api/, it applies after it
+            {SetHeaders: map[string]string{"X-Route": "global"}, RemoveHeaders: []string{"X-Client"}},
+            {PathPrefix: "/api/v1/", RewritePath: &PathRewrite{Match: "^/api/v1/(.*)$", Replacement: "/api/v2/$1"}},
+            {PathPrefix: "/api/", Methods: []string{"post"}, RedactFields: []string{"password", "cards.*.number"}},
+        },
+        Response: []Rule{
+            {RemoveHeaders: []string{"X-Powered-By"}},
+            // Selected with the path of the request before it was rewritten
+            {PathPrefix: "/api/v1/", RedactFields: []string{"token"}, Redaction: "***"},
+        },
+    })
+
+    e, headers := perform(t, engine, "POST", "/api/v1/users", "application/json",
+        `{"name":"ada","password":"hunter2","cards":[{"number":"4111"},{"number":"5500"}]}`,
+        ut.Header{Key: "X-Client", Value: "10.0.0.1"}, ut.Header{Key: "X-Trace", Value: "client"})
+    if e.Path != "/api/v2/users" {
+        t.Fatalf("path %s, /api/v2/users expected", e.Path)
+    }
+    if e.Route != "global" || e.Client != "" || strings.Join(e.Trace, ",") != "client,gateway" {
+        t.Fatalf("headers %+v", e)
+    }
+    if e.Body != `{"cards":[{"number":"[REDACTED]"},{"number":"[REDACTED]"}],"name":"ada","password":"[REDACTED]"}` {
+        t.Fatalf("body %s", e.Body)
+    }
+    if e.Token != "***" {
+        t.Fatalf("token %s, *** expected", e.Token)
+    }
+    if _, ok := headers["X-Powered-By"]; ok {
+        t.Fatalf("X-Powered-By not removed")
+    }
+
+    // The redaction is restricted to the POST requests, and to the JSON bodies
+    if e, _ := perform(t, engine, "GET", "/api/v1/users", "application/json", `{"password":"hunter2"}`); e.Body != `{"password":"hunter2"}` {
+        t.Fatalf("GET body %s", e.Body)
+    }
+    if e, _ := perform(t, engine, "POST", "/api/v1/users", "text/plain", `{"password":"hunter2"}`); e.Body != `{"password":"hunter2"}` {
+        t.Fatalf("text body %s", e.Body)
+    }
+
+    // The other routes only get the global rules
+    e, _ = perform(t, engine, "GET", "/health", "application/json", "", ut.Header{Key: "X-Client", Value: "10.0.0.1"})
+    if e.Path != "/health" || e.Route != "global" || e.Client != "" || len(e.Trace) != 0 || e.Token != "secret" {
+        t.Fatalf("/health %+v", e)
+    }
+}
+
+func TestNewTransformerRejectsInvalidRewrite(t *testing.T) {
+    if _, err := NewTransformer(TransformConfig{Request: []Rule{{RewritePath: &PathRewrite{Match: "("}}}}); err == nil {
+        t.Fatalf("invalid path rewrite accepted")
+    }
+}
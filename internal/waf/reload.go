@@ -0,0 +1,59 @@
+package waf
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "os"
+    "time"
+)
+
+// LoadFile reads a JSON WAFConfig.
+func LoadFile(path string) (WAFConfig, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return WAFConfig{}, fmt.Errorf("failed to read rules %s: %w", path, err)
+    }
+    var config WAFConfig
+    if err := json.Unmarshal(data, &config); err != nil {
+        return WAFConfig{}, fmt.Errorf("failed to decode rules %s: %w", path, err)
+    }
+    return config, nil
+}
+
+// Watch reloads the rules of the WAF from the JSON file whenever it is modified, checking it every interval until ctx
+// is done. Invalid rules are logged and the previous rules are kept.
+func Watch(ctx context.Context, w WAF, path string, interval time.Duration) {
+    var modTime time.Time
+    if info, err := os.Stat(path); err == nil {
+        modTime = info.ModTime()
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+        info, err := os.Stat(path)
+        if err != nil {
+            slog.Error("Error checking WAF rules", "path", path, "error", err)
+            continue
+        }
+        if info.ModTime().Equal(modTime) {
+            continue
+        }
+        modTime = info.ModTime()
+        config, err := LoadFile(path)
+        if err == nil {
+            err = w.Update(config)
+        }
+        if err != nil {
+            slog.Error("Error reloading WAF rules", "path", path, "error", err)
+            continue
+        }
+        slog.Info("Reloaded WAF rules", "path", path, "rules", len(config.Rules))
+    }
+}
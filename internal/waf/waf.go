@@ -0,0 +1,234 @@
+package waf
+
+import (
+    "context"
+    "fmt"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/utils"
+    "github.com/cloudwego/hertz/pkg/protocol/consts"
+    "log/slog"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "sync/atomic"
+)
+
+// WAF interface defines the methods of a lightweight web application firewall.
+type WAF interface {
+    // Middleware evaluates the rules before the request reaches the next handlers
+    Middleware(ctx context.Context, c *app.RequestContext)
+    // Update compiles and swaps the rules, the previous rules are kept if the configuration is invalid
+    Update(config WAFConfig) error
+}
+
+type Action string
+
+const (
+    // ActionAllow lets the request through without evaluating the following rules
+    ActionAllow Action = "allow"
+    // ActionDeny rejects the request with 403 Forbidden
+    ActionDeny Action = "deny"
+    // ActionLimit rejects the request with 429 Too Many Requests when the client is over the limit of the rule
+    ActionLimit Action = "limit"
+)
+
+type Rule struct {
+    // Name identifies the rule in the logs and the limits, it must be unique
+    Name string `json:"name"`
+    // Methods restricts the rule to the given HTTP methods
+    //
+    // Defaults to every method if not specified
+    Methods []string `json:"methods,omitempty"`
+    // Path is a regular expression matched against the request path
+    //
+    // Defaults to every path if not specified
+    Path string `json:"path,omitempty"`
+    // Headers maps header names to regular expressions their value must match, a missing header matches as empty
+    Headers map[string]string `json:"headers,omitempty"`
+    // Body is a regular expression matched against the first MaxBodyBytes of the request body
+    Body string `json:"body,omitempty"`
+    // Action applied to the matching requests
+    Action Action `json:"action"`
+    // Limit of the requests per client for ActionLimit
+    Limit *ratelimiter.EndpointConfig `json:"limit,omitempty"`
+}
+
+type WAFConfig struct {
+    // Rules are evaluated in order, the first matching rule decides, the request is allowed if none matches
+    Rules []Rule `json:"rules"`
+    // MaxBodyBytes inspected by the body patterns
+    //
+    // Defaults to 64KiB if not specified
+    MaxBodyBytes int `json:"max_body_bytes,omitempty"`
+}
+
+type rule struct {
+    Rule
+    methods map[string]struct{}
+    path    *regexp.Regexp
+    headers map[string]*regexp.Regexp
+    body    *regexp.Regexp
+}
+
+type rules struct {
+    rules        []*rule
+    maxBodyBytes int
+}
+
+type waf struct {
+    rules   atomic.Pointer[rules]
+    limiter ratelimiter.RateLimiter // Counts the requests of the limit rules, keyed by rule name and client
+}
+
+// NewWAF compiles the rules of the configuration into a WAF, the limit rules count the requests in the store.
+func NewWAF(config WAFConfig, store ratelimiterstore.Store) (WAF, error) {
+    w := &waf{
+        limiter: ratelimiter.NewRateLimiter(ratelimiter.RateLimiterConfig{}, store, nil),
+    }
+    if err := w.Update(config); err != nil {
+        return nil, err
+    }
+    return w, nil
+}
+
+func (w *waf) Update(config WAFConfig) error {
+    compiled, limits, err := compile(config)
+    if err != nil {
+        return err
+    }
+    w.limiter.UpdateConfig(limits)
+    w.rules.Store(compiled)
+    return nil
+}
+
+// limitEndpoint is the rate limiter endpoint counting the requests of a limit rule.
+func limitEndpoint(name string) string {
+    return "waf:" + name
+}
+
+func compile(config WAFConfig) (*rules, ratelimiter.RateLimiterConfig, error) {
+    compiled := &rules{maxBodyBytes: config.MaxBodyBytes}
+    if compiled.maxBodyBytes == 0 {
+        compiled.maxBodyBytes = 64 << 10
+    }
+    limits := make(ratelimiter.RateLimiterConfig)
+    names := make(map[string]struct{}, len(config.Rules))
+    for _, r := range config.Rules {
+        if _, exists := names[r.Name]; exists || r.Name == "" {
+            return nil, nil, fmt.Errorf("rule names must be unique and not empty, got %q", r.Name)
+        }
+        names[r.Name] = struct{}{}
+        c := &rule{Rule: r}
+        switch r.Action {
+        case ActionAllow, ActionDeny:
+        case ActionLimit:
+            if r.Limit == nil {
+                return nil, nil, fmt.Errorf("rule %s has no limit", r.Name)
+            }
+            limits[limitEndpoint(r.Name)] = *r.Limit
+        default:
+            return nil, nil, fmt.Errorf("rule %s has an unknown action %q", r.Name, r.Action)
+        }
+        if len(r.Methods) > 0 {
+            c.methods = make(map[string]struct{}, len(r.Methods))
+            for _, m := range r.Methods {
+                c.methods[strings.ToUpper(m)] = struct{}{}
+            }
+        }
+        var err error
+        if c.path, err = compilePattern(r.Name, "path", r.Path); err != nil {
+            return nil, nil, err
+        }
+        if c.body, err = compilePattern(r.Name, "body", r.Body); err != nil {
+            return nil, nil, err
+        }
+        for name, pattern := range r.Headers {
+            re, err := compilePattern(r.Name, "header "+name, pattern)
+            if err != nil {
+                return nil, nil, err
+            }
+            if c.headers == nil {
+                c.headers = make(map[string]*regexp.Regexp, len(r.Headers))
+            }
+            c.headers[name] = re
+        }
+        compiled.rules = append(compiled.rules, c)
+    }
+    if err := limits.Validate(); err != nil {
+        return nil, nil, fmt.Errorf("invalid limit: %w", err)
+    }
+    return compiled, limits, nil
+}
+
+func compilePattern(rule, field, pattern string) (*regexp.Regexp, error) {
+    if pattern == "" {
+        return nil, nil
+    }
+    re, err := regexp.Compile(pattern)
+    if err != nil {
+        return nil, fmt.Errorf("failed to compile %s pattern of rule %s: %w", field, rule, err)
+    }
+    return re, nil
+}
+
+func (r *rule) matches(c *app.RequestContext, maxBodyBytes int) bool {
+    if _, ok := r.methods[string(c.Method())]; r.methods != nil && !ok {
+        return false
+    }
+    if r.path != nil && !r.path.Match(c.Path()) {
+        return false
+    }
+    for name, re := range r.headers {
+        if !re.Match(c.GetHeader(name)) {
+            return false
+        }
+    }
+    if r.body != nil {
+        body := c.Request.Body()
+        if len(body) > maxBodyBytes {
+            body = body[:maxBodyBytes]
+        }
+        if !r.body.Match(body) {
+            return false
+        }
+    }
+    return true
+}
+
+func (w *waf) Middleware(ctx context.Context, c *app.RequestContext) {
+    current := w.rules.Load()
+    for _, r := range current.rules {
+        if !r.matches(c, current.maxBodyBytes) {
+            continue
+        }
+        switch r.Action {
+        case ActionDeny:
+            slog.Debug("Request denied", "rule", r.Name, "path", string(c.Path()))
+            c.AbortWithStatusJSON(consts.StatusForbidden, utils.H{"error": "Forbidden"})
+            return
+        case ActionLimit:
+            if d, _ := w.limiter.AllowRequest(ctx, limitEndpoint(r.Name), clientIP(c)); !d.Allowed {
+                slog.Debug("Request limited", "rule", r.Name, "path", string(c.Path()))
+                if d.RetryAfter > 0 {
+                    c.Header("Retry-After", strconv.Itoa(int(math.Ceil(d.RetryAfter.Seconds()))))
+                }
+                c.AbortWithStatusJSON(consts.StatusTooManyRequests, utils.H{"error": "Rate limit exceeded"})
+                return
+            }
+        }
+        // The first matching rule decides
+        break
+    }
+    c.Next(ctx)
+}
+
+func clientIP(c *app.RequestContext) string {
+    ip := string(c.GetHeader("X-Forwarded-For"))
+    if ip == "" {
+        ip = c.ClientIP() // Fallback to the remote IP if X-Forwarded-For is not set
+    }
+    return ip
+}
@@ -0,0 +1,168 @@
+package waf
+
+import (
+    "context"
+    "encoding/json"
+    ratelimiter "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter"
+    ratelimiterstore "github.com/aswinkm-tc/go-web-concepts/internal/rate_limiter_store"
+    "github.com/cloudwego/hertz/pkg/app"
+    "github.com/cloudwego/hertz/pkg/common/config"
+    "github.com/cloudwego/hertz/pkg/common/ut"
+    "github.com/cloudwego/hertz/pkg/route"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+var testConfig = WAFConfig{
+    Rules: []Rule{
+        {Name: "health", Path: "^/health$", Action: ActionAllow},
+        {Name: "scanners", Headers: map[string]string{"User-Agent": "(?i)sqlmap|nikto"}, Action: ActionDeny},
+        {Name: "sql-injection", Methods: []string{"post"}, Body: `(?i)union\s+select`, Action: ActionDeny},
+        {Name: "login", Methods: []string{"POST"}, Path: "^/login$", Action: ActionLimit,
+            Limit: &ratelimiter.EndpointConfig{MaxRequests: 2, TimeWindow: time.Minute, SlidingWindowInterval: time.Second}},
+    },
+    MaxBodyBytes: 64,
+}
+
+func newEngine(t *testing.T, w WAF) *route.Engine {
+    t.Helper()
+    engine := route.NewEngine(config.NewOptions(nil))
+    engine.Use(w.Middleware)
+    handler := func(_ context.Context, c *app.RequestContext) {
+        c.Status(200)
+    }
+    engine.GET("/health", handler)
+    engine.GET("/search", handler)
+    engine.POST("/search", handler)
+    engine.POST("/login", handler)
+    return engine
+}
+
+func perform(engine *route.Engine, method, path, body string, headers ...string) int {
+    var h []ut.Header
+    for i := 0; i+1 < len(headers); i += 2 {
+        h = append(h, ut.Header{Key: headers[i], Value: headers[i+1]})
+    }
+    return ut.PerformRequest(engine, method, path, &ut.Body{Body: strings.NewReader(body), Len: len(body)}, h...).Result().StatusCode()
+}
+
+func TestWAF(t *testing.T) {
+    w, err := NewWAF(testConfig, ratelimiterstore.NewMemoryStore())
+    if err != nil {
+        t.Fatalf("NewWAF: %v", err)
+    }
+    engine := newEngine(t, w)
+    for _, test := range []struct {
+        name, method, path, body string
+        headers                  []string
+        status                   int
+    }{
+        {"no rule matches", "GET", "/search", "", nil, 200},
+        {"scanner", "GET", "/search", "", []string{"User-Agent", "sqlmap/1.7"}, 403},
+        {"allowed before the following rules", "GET", "/health", "", []string{"User-Agent", "sqlmap/1.7"}, 200},
+        {"injection", "POST", "/search", "q=1 UNION  SELECT password", nil, 403},
+        {"injection of another method", "GET", "/search", "q=1 UNION SELECT password", nil, 200},
+        {"injection past the inspected bytes", "POST", "/search", strings.Repeat(" ", 64) + "union select", nil, 200},
+        {"login", "POST", "/login", "", []string{"X-Forwarded-For", "10.0.0.1"}, 200},
+        {"login", "POST", "/login", "", []string{"X-Forwarded-For", "10.0.0.1"}, 200},
+        {"login over the limit", "POST", "/login", "", []string{"X-Forwarded-For", "10.0.0.1"}, 429},
+        {"login of another client", "POST", "/login", "", []string{"X-Forwarded-For", "10.0.0.2"}, 200},
+    } {
+        if status := perform(engine, test.method, test.path, test.body, test.headers...); status != test.status {
+            t.Fatalf("%s: %d, %d expected", test.name, status, test.status)
+        }
+    }
+}
+
+func TestWAFUpdate(t *testing.T) {
+    w, err := NewWAF(testConfig, ratelimiterstore.NewMemoryStore())
+    if err != nil {
+        t.Fatalf("NewWAF: %v", err)
+    }
+    engine := newEngine(t, w)
+    for name, invalid := range map[string]WAFConfig{
+        "no name":             {Rules: []Rule{{Action: ActionDeny}}},
+        "duplicate name":      {Rules: []Rule{{Name: "a", Action: ActionDeny}, {Name: "a", Action: ActionAllow}}},
+        "unknown action":      {Rules: []Rule{{Name: "a", Action: "block"}}},
+        "limit with no limit": {Rules: []Rule{{Name: "a", Action: ActionLimit}}},
+        "invalid limit":       {Rules: []Rule{{Name: "a", Action: ActionLimit, Limit: &ratelimiter.EndpointConfig{MaxRequests: 1, TimeWindow: time.Second, SlidingWindowInterval: time.Minute}}}},
+        "invalid path":        {Rules: []Rule{{Name: "a", Path: "(", Action: ActionDeny}}},
+        "invalid header":      {Rules: []Rule{{Name: "a", Headers: map[string]string{"User-Agent": "["}, Action: ActionDeny}}},
+    } {
+        if err := w.Update(invalid); err == nil {
+            t.Fatalf("%s: accepted", name)
+        }
+    }
+    // The previous rules are kept
+    if status := perform(engine, "GET", "/search", "", "User-Agent", "nikto"); status != 403 {
+        t.Fatalf("after the invalid updates: %d, 403 expected", status)
+    }
+
+    if err := w.Update(WAFConfig{Rules: []Rule{{Name: "search", Path: "^/search", Action: ActionDeny}}}); err != nil {
+        t.Fatalf("Update: %v", err)
+    }
+    if status := perform(engine, "GET", "/search", ""); status != 403 {
+        t.Fatalf("after the update: %d, 403 expected", status)
+    }
+    if status := perform(engine, "GET", "/health", "", "User-Agent", "nikto"); status != 200 {
+        t.Fatalf("rule removed by the update: %d, 200 expected", status)
+    }
+}
+
+func TestWatch(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "waf.json")
+    write := func(config WAFConfig, modTime time.Time) {
+        data, err := json.Marshal(config)
+        if err != nil {
+            t.Fatalf("Marshal: %v", err)
+        }
+        if err := os.WriteFile(path, data, 0o600); err != nil {
+            t.Fatalf("WriteFile: %v", err)
+        }
+        // The modification time of a file written twice in a row may not change on every file system
+        if err := os.Chtimes(path, modTime, modTime); err != nil {
+            t.Fatalf("Chtimes: %v", err)
+        }
+    }
+    write(testConfig, time.Now().Add(-time.Hour))
+    config, err := LoadFile(path)
+    if err != nil {
+        t.Fatalf("LoadFile: %v", err)
+    }
+    w, err := NewWAF(config, ratelimiterstore.NewMemoryStore())
+    if err != nil {
+        t.Fatalf("NewWAF: %v", err)
+    }
+    engine := newEngine(t, w)
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    go Watch(ctx, w, path, 10*time.Millisecond)
+    // Watch takes the modification time of the rules loaded when it starts
+    time.Sleep(50 * time.Millisecond)
+
+    waitFor := func(status int) {
+        t.Helper()
+        deadline := time.Now().Add(5 * time.Second)
+        for perform(engine, "GET", "/search", "") != status {
+            if time.Now().After(deadline) {
+                t.Fatalf("GET /search still not %d", status)
+            }
+            time.Sleep(10 * time.Millisecond)
+        }
+    }
+    waitFor(200)
+    write(WAFConfig{Rules: []Rule{{Name: "search", Path: "^/search", Action: ActionDeny}}}, time.Now().Add(-time.Minute))
+    waitFor(403)
+
+    // An invalid file keeps the rules in place
+    if err := os.WriteFile(path, []byte(`{"rules":[{"name":"search","action":"block"}]}`), 0o600); err != nil {
+        t.Fatalf("WriteFile: %v", err)
+    }
+    time.Sleep(100 * time.Millisecond)
+    if status := perform(engine, "GET", "/search", ""); status != 403 {
+        t.Fatalf("after an invalid file: %d, 403 expected", status)
+    }
+}